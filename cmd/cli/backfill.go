@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+
+	"github.com/kbsch/trough/internal/repository"
+)
+
+func backfillSearchCmd() *cobra.Command {
+	var force bool
+	var batchSize int
+
+	cmd := &cobra.Command{
+		Use:   "backfill-search",
+		Short: "Build the search vector of listings that have none, so text search finds them",
+		Long: `Build the search vector of listings that have none, e.g. ones written by
+a path that didn't build it, in batches. With --force every listing's search
+vector is rebuilt.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if batchSize < 1 {
+				return fmt.Errorf("--batch-size must be at least 1")
+			}
+			ctx := context.Background()
+			listingRepo := repository.NewListingRepository(db)
+
+			var total int64
+			after := uuid.Nil
+			for {
+				var n int64
+				var err error
+				if force {
+					after, n, err = listingRepo.RebuildSearchVector(ctx, after, batchSize)
+				} else {
+					n, err = listingRepo.BackfillSearchVector(ctx, batchSize)
+				}
+				if err != nil {
+					return err
+				}
+				if n == 0 {
+					break
+				}
+				total += n
+				fmt.Printf("  %d listing(s) updated, %d so far\n", n, total)
+			}
+
+			if force {
+				fmt.Printf("Rebuilt the search vectors of %d listing(s)\n", total)
+			} else {
+				fmt.Printf("Backfilled the search vectors of %d listing(s)\n", total)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "Rebuild every listing's search vector, not only missing ones")
+	cmd.Flags().IntVar(&batchSize, "batch-size", 1000, "Listings updated per statement")
+
+	return cmd
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+	"github.com/kbsch/trough/internal/scraper/engine"
+)
+
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+// doctorTables maps each table to the domain type scanned from it, so the
+// expected columns follow the struct db tags
+var doctorTables = []struct {
+	table string
+	model interface{}
+}{
+	{"sources", domain.Source{}},
+	{"listings", domain.Listing{}},
+	{"listing_locations", domain.ListingLocation{}},
+	{"listing_documents", domain.ListingDocument{}},
+	{"listing_price_history", domain.PriceChange{}},
+	{"listing_changes", domain.ListingChange{}},
+	{"scrape_jobs", domain.ScrapeJob{}},
+	{"scrape_job_requests", domain.ScrapeJobRequest{}},
+}
+
+// doctorReport prints check results and counts failures
+type doctorReport struct {
+	failures int
+}
+
+func (r *doctorReport) ok(format string, args ...interface{}) {
+	fmt.Printf("  %s✓%s %s\n", colorGreen, colorReset, fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) warn(format string, args ...interface{}) {
+	fmt.Printf("  %s!%s %s\n", colorYellow, colorReset, fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) fail(format string, args ...interface{}) {
+	r.failures++
+	fmt.Printf("  %s✗%s %s\n", colorRed, colorReset, fmt.Sprintf(format, args...))
+}
+
+func doctorCmd() *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that active sources have scrapers, reachable URLs and the expected schema",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			report := &doctorReport{}
+
+			fmt.Println("Schema")
+			if err := checkSchema(ctx, report); err != nil {
+				return err
+			}
+
+			sourceRepo := repository.NewSourceRepository(db)
+			activeSources, err := sourceRepo.ListActive(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list sources: %w", err)
+			}
+
+			fmt.Println()
+			fmt.Println("Sources")
+			if len(activeSources) == 0 {
+				report.warn("no active sources (run `trough seed`)")
+			}
+
+			client := &http.Client{Timeout: timeout}
+			colly := collyScrapers()
+			for _, s := range activeSources {
+				checkScraper(report, s, colly)
+				checkBaseURL(ctx, report, client, s)
+			}
+
+			fmt.Println()
+			if report.failures > 0 {
+				fmt.Printf("%s%d problem(s) found%s\n", colorRed, report.failures, colorReset)
+				return fmt.Errorf("doctor found %d problem(s)", report.failures)
+			}
+			fmt.Printf("%sAll checks passed%s\n", colorGreen, colorReset)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second, "Timeout for each base URL request")
+
+	return cmd
+}
+
+// checkScraper verifies a source's config is valid and its slug has a scraper
+// of its configured type. Sources crawled from a sitemap or an API don't need
+// one.
+func checkScraper(report *doctorReport, s domain.Source, colly map[string]engine.Scraper) {
+	cfg, err := domain.ParseSourceConfig(s.Config)
+	if err != nil {
+		report.fail("%s: %v", s.Slug, err)
+		return
+	}
+	if cfg.CrawlStrategy == domain.CrawlStrategySitemap {
+		report.ok("%s: crawled from its sitemap (%s)", s.Slug, cfg.Sitemap.SitemapPath())
+		return
+	}
+	if cfg.CrawlStrategy == domain.CrawlStrategyAPI {
+		report.ok("%s: crawled from its API (%s)", s.Slug, cfg.API.Endpoint)
+		return
+	}
+
+	_, hasColly := colly[s.Slug]
+	_, hasRod := rodScrapers[s.Slug]
+
+	if !hasColly && !hasRod {
+		report.fail("%s: no scraper registered for slug %q", s.Slug, s.Slug)
+		return
+	}
+
+	switch s.ScraperType {
+	case "colly":
+		if !hasColly {
+			report.fail("%s: scraper_type is colly but only a rod scraper is registered", s.Slug)
+			return
+		}
+	case "rod":
+		if !hasRod {
+			report.fail("%s: scraper_type is rod but only a colly scraper is registered", s.Slug)
+			return
+		}
+	default:
+		report.fail("%s: unknown scraper_type %q (want colly or rod)", s.Slug, s.ScraperType)
+		return
+	}
+	report.ok("%s: %s scraper registered", s.Slug, s.ScraperType)
+}
+
+// checkBaseURL HEAD-requests a source's base URL. Other 4xx responses are only
+// warnings since many sites refuse HEAD requests or bot user agents.
+func checkBaseURL(ctx context.Context, report *doctorReport, client *http.Client, s domain.Source) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.BaseURL, nil)
+	if err != nil {
+		report.fail("%s: invalid base_url %q: %v", s.Slug, s.BaseURL, err)
+		return
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		report.fail("%s: %s unreachable: %v", s.Slug, s.BaseURL, err)
+		return
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		report.fail("%s: %s returned %d", s.Slug, s.BaseURL, resp.StatusCode)
+	case resp.StatusCode >= 400:
+		report.warn("%s: %s returned %d", s.Slug, s.BaseURL, resp.StatusCode)
+	default:
+		report.ok("%s: %s returned %d", s.Slug, s.BaseURL, resp.StatusCode)
+	}
+}
+
+// checkSchema compares each table's columns against its domain type
+func checkSchema(ctx context.Context, report *doctorReport) error {
+	for _, t := range doctorTables {
+		var columns []string
+		err := db.SelectContext(ctx, &columns, `
+			SELECT column_name FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1
+		`, t.table)
+		if err != nil {
+			return fmt.Errorf("failed to read columns for %s: %w", t.table, err)
+		}
+		if len(columns) == 0 {
+			report.fail("%s: table missing (pending migrations?)", t.table)
+			continue
+		}
+
+		if missing := missingColumns(columns, structColumns(t.model)); len(missing) > 0 {
+			report.fail("%s: missing columns %s (pending migrations?)", t.table, strings.Join(missing, ", "))
+			continue
+		}
+		report.ok("%s: %d columns", t.table, len(columns))
+	}
+	return nil
+}
+
+// structColumns returns the db tags of a struct's column fields, skipping
+// embedded relations such as Listing.Source
+func structColumns(model interface{}) []string {
+	timeType := reflect.TypeOf(time.Time{})
+
+	var columns []string
+	t := reflect.TypeOf(model)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != timeType {
+			continue
+		}
+		columns = append(columns, tag)
+	}
+	return columns
+}
+
+// missingColumns returns the expected columns not present in actual, sorted
+func missingColumns(actual, expected []string) []string {
+	have := make(map[string]bool, len(actual))
+	for _, c := range actual {
+		have[c] = true
+	}
+
+	var missing []string
+	for _, c := range expected {
+		if !have[c] {
+			missing = append(missing, c)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/scraper/engine"
+)
+
+func TestStructColumnsSkipsRelations(t *testing.T) {
+	columns := structColumns(domain.Listing{})
+
+	has := make(map[string]bool)
+	for _, c := range columns {
+		has[c] = true
+	}
+	for _, want := range []string{"id", "raw_data", "first_seen_at", "enriched_at"} {
+		if !has[want] {
+			t.Errorf("expected column %q", want)
+		}
+	}
+	if has["source"] {
+		t.Error("embedded Source relation should not be a column")
+	}
+}
+
+func TestMissingColumns(t *testing.T) {
+	got := missingColumns([]string{"id", "name"}, []string{"slug", "id", "config", "name"})
+	if want := []string{"config", "slug"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missingColumns = %v, want %v", got, want)
+	}
+}
+
+func TestCheckScraper(t *testing.T) {
+	colly := map[string]engine.Scraper{"bizquest": nil, "bizbuysell": nil}
+
+	tests := []struct {
+		name        string
+		slug        string
+		scraperType string
+		config      string
+		wantFail    bool
+	}{
+		{"colly registered", "bizquest", "colly", "", false},
+		{"rod registered", "bizbuysell", "rod", "", false},
+		{"rod missing", "bizquest", "rod", "", true},
+		{"unregistered slug", "newbroker", "colly", "", true},
+		{"unknown type", "bizquest", "playwright", "", true},
+		{"sitemap without scraper", "newbroker", "colly", `{"crawl_strategy":"sitemap","sitemap":{"listing_pattern":"/listing/"}}`, false},
+		{"api without scraper", "newbroker", "colly", `{"crawl_strategy":"api","api":{"endpoint":"/api/search","results":"items","fields":{"external_id":"id","title":"name","url":"link"}}}`, false},
+		{"invalid config", "bizquest", "colly", `{"crawl_strategy":"rss"}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &doctorReport{}
+			source := domain.Source{Slug: tt.slug, ScraperType: tt.scraperType, Config: json.RawMessage(tt.config)}
+			checkScraper(report, source, colly)
+			if got := report.failures > 0; got != tt.wantFail {
+				t.Errorf("failed = %v, want %v", got, tt.wantFail)
+			}
+		})
+	}
+}
+
+func TestCheckBaseURL(t *testing.T) {
+	tests := []struct {
+		status   int
+		wantFail bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusForbidden, false},
+		{http.StatusNotFound, true},
+		{http.StatusBadGateway, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodHead {
+					t.Errorf("method = %s, want HEAD", r.Method)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			report := &doctorReport{}
+			checkBaseURL(context.Background(), report, srv.Client(), domain.Source{Slug: "test", BaseURL: srv.URL})
+			if got := report.failures > 0; got != tt.wantFail {
+				t.Errorf("failed = %v, want %v", got, tt.wantFail)
+			}
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		url := srv.URL
+		srv.Close()
+
+		report := &doctorReport{}
+		checkBaseURL(context.Background(), report, http.DefaultClient, domain.Source{Slug: "test", BaseURL: url})
+		if report.failures != 1 {
+			t.Errorf("failures = %d, want 1", report.failures)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kbsch/trough/internal/repository"
+)
+
+func scrapeUnquarantineCmd() *cobra.Command {
+	var sourceSlug string
+
+	cmd := &cobra.Command{
+		Use:   "unquarantine",
+		Short: "Let a source quarantined after repeated blocked runs be scraped again before its cooldown passes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if sourceSlug == "" {
+				return fmt.Errorf("--source is required")
+			}
+
+			err := repository.NewSourceRepository(db).ClearQuarantine(context.Background(), sourceSlug)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("source not found: %s", sourceSlug)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to clear quarantine of %s: %w", sourceSlug, err)
+			}
+
+			fmt.Printf("Cleared quarantine of %s\n", sourceSlug)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&sourceSlug, "source", "s", "", "Source slug (required)")
+
+	return cmd
+}
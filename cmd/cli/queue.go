@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/riverdriver/riverpgxv5"
+	"github.com/riverqueue/river/rivertype"
+	"github.com/spf13/cobra"
+
+	"github.com/kbsch/trough/internal/database"
+)
+
+// jobStates are the River job states `queue status --state` accepts
+var jobStates = []rivertype.JobState{
+	rivertype.JobStateAvailable,
+	rivertype.JobStateScheduled,
+	rivertype.JobStateRetryable,
+	rivertype.JobStateRunning,
+	rivertype.JobStateCompleted,
+	rivertype.JobStateDiscarded,
+	rivertype.JobStateCancelled,
+	rivertype.JobStatePending,
+}
+
+// withRiverClient runs fn with an insert-only River client, for inspecting
+// and changing jobs without working them
+func withRiverClient(ctx context.Context, fn func(*river.Client[pgx.Tx]) error) error {
+	pool, err := database.NewPgxPool(ctx, cfg.DatabaseURL, cfg.DBPool)
+	if err != nil {
+		return fmt.Errorf("failed to create pgx pool: %w", err)
+	}
+	defer pool.Close()
+
+	client, err := river.NewClient(riverpgxv5.New(pool), &river.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to create River client: %w", err)
+	}
+	return fn(client)
+}
+
+func queueStatusCmd() *cobra.Command {
+	var states []string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "List queued, running and finished jobs, newest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params := river.NewJobListParams().
+				OrderBy(river.JobListOrderByID, river.SortOrderDesc).
+				First(limit)
+			if len(states) > 0 {
+				parsed, err := parseJobStates(states)
+				if err != nil {
+					return err
+				}
+				params = params.States(parsed...)
+			}
+
+			return withRiverClient(context.Background(), func(client *river.Client[pgx.Tx]) error {
+				result, err := client.JobList(context.Background(), params)
+				if err != nil {
+					return fmt.Errorf("failed to list jobs: %w", err)
+				}
+				if len(result.Jobs) == 0 {
+					fmt.Println("No jobs found")
+					return nil
+				}
+				return printJobs(cmd.OutOrStdout(), result.Jobs)
+			})
+		},
+	}
+	cmd.Flags().StringSliceVar(&states, "state", nil, "Only jobs in these states (available, running, completed, discarded, ...)")
+	cmd.Flags().IntVarP(&limit, "limit", "l", 50, "Max jobs to list")
+
+	return cmd
+}
+
+func queueCancelCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cancel <job-id>",
+		Short: "Cancel a queued or running job",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid job ID %q", args[0])
+			}
+
+			return withRiverClient(context.Background(), func(client *river.Client[pgx.Tx]) error {
+				job, err := client.JobCancel(context.Background(), id)
+				if errors.Is(err, rivertype.ErrNotFound) {
+					return fmt.Errorf("job not found: %d", id)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to cancel job %d: %w", id, err)
+				}
+
+				// A running job is only marked; it stops once its worker
+				// sees the cancellation
+				if job.State == rivertype.JobStateRunning {
+					fmt.Printf("Cancelling running job %d (%s)\n", job.ID, job.Kind)
+				} else {
+					fmt.Printf("Job %d (%s) is %s\n", job.ID, job.Kind, job.State)
+				}
+				return nil
+			})
+		},
+	}
+}
+
+// parseJobStates validates --state values, which may also be comma-separated
+func parseJobStates(values []string) ([]rivertype.JobState, error) {
+	var states []rivertype.JobState
+	for _, v := range values {
+		state := rivertype.JobState(strings.ToLower(strings.TrimSpace(v)))
+		valid := false
+		for _, s := range jobStates {
+			valid = valid || s == state
+		}
+		if !valid {
+			names := make([]string, len(jobStates))
+			for i, s := range jobStates {
+				names[i] = string(s)
+			}
+			return nil, fmt.Errorf("unknown job state %q; want one of %s", v, strings.Join(names, ", "))
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// printJobs writes one line per job: ID, kind, state, attempts so far out of
+// the maximum, and when it is or was scheduled to run
+func printJobs(w io.Writer, jobs []*rivertype.JobRow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tSTATE\tATTEMPTS\tSCHEDULED")
+	for _, job := range jobs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d/%d\t%s\n",
+			job.ID, job.Kind, job.State, job.Attempt, job.MaxAttempts, job.ScheduledAt.UTC().Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
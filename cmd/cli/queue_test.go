@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river/rivertype"
+)
+
+func TestParseJobStates(t *testing.T) {
+	states, err := parseJobStates([]string{"available", " Running", "discarded"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []rivertype.JobState{rivertype.JobStateAvailable, rivertype.JobStateRunning, rivertype.JobStateDiscarded}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("states = %v, want %v", states, want)
+	}
+
+	if _, err := parseJobStates([]string{"completed", "stuck"}); err == nil || !strings.Contains(err.Error(), `"stuck"`) {
+		t.Errorf("err = %v, want one naming the unknown state", err)
+	}
+}
+
+func TestPrintJobs(t *testing.T) {
+	scheduled := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	err := printJobs(&buf, []*rivertype.JobRow{
+		{ID: 42, Kind: "scrape", State: rivertype.JobStateRunning, Attempt: 1, MaxAttempts: 3, ScheduledAt: scheduled},
+		{ID: 7, Kind: "scrape_all", State: rivertype.JobStateDiscarded, Attempt: 3, MaxAttempts: 3, ScheduledAt: scheduled},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want a header and 2 jobs:\n%s", len(lines), buf.String())
+	}
+	if got := strings.Fields(lines[1]); !reflect.DeepEqual(got, []string{"42", "scrape", "running", "1/3", "2026-03-14T09:30:00Z"}) {
+		t.Errorf("first job = %q", got)
+	}
+	if got := strings.Fields(lines[2]); got[3] != "3/3" || got[2] != "discarded" {
+		t.Errorf("second job = %q", got)
+	}
+}
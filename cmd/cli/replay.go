@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kbsch/trough/internal/repository"
+)
+
+func replayFailedCmd() *cobra.Command {
+	var sourceSlug string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "replay-failed",
+		Short: "Retry listings that failed to upsert during scrapes, ignoring the retry cap",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			listingRepo := repository.NewListingRepository(db)
+			listingRepo.SetMaxDescriptionLength(cfg.MaxDescriptionLen)
+
+			failed, err := listingRepo.ListFailedUpserts(ctx, sourceSlug, limit)
+			if err != nil {
+				return fmt.Errorf("failed to list failed upserts: %w", err)
+			}
+			if len(failed) == 0 {
+				fmt.Println("No failed upserts to replay")
+				return nil
+			}
+
+			saved := 0
+			for _, f := range failed {
+				listing, err := f.DecodeListing()
+				if err != nil {
+					fmt.Printf("  %s✗%s %s/%s: stored listing is unreadable: %v\n", colorRed, colorReset, f.SourceSlug, f.ExternalID, err)
+					continue
+				}
+				listing.SourceID = f.SourceID
+
+				if upsertErr := listingRepo.Upsert(ctx, listing); upsertErr != nil {
+					attempts, err := listingRepo.RecordFailedUpsert(ctx, listing, upsertErr)
+					if err != nil {
+						return fmt.Errorf("failed to record failed upsert of %s/%s: %w", f.SourceSlug, f.ExternalID, err)
+					}
+					fmt.Printf("  %s✗%s %s/%s (attempt %d): %v\n", colorRed, colorReset, f.SourceSlug, f.ExternalID, attempts, upsertErr)
+					continue
+				}
+
+				if err := listingRepo.ClearFailedUpserts(ctx, f.SourceID, []string{f.ExternalID}); err != nil {
+					return fmt.Errorf("failed to clear failed upsert of %s/%s: %w", f.SourceSlug, f.ExternalID, err)
+				}
+				fmt.Printf("  %s✓%s %s/%s\n", colorGreen, colorReset, f.SourceSlug, f.ExternalID)
+				saved++
+			}
+
+			fmt.Println()
+			fmt.Printf("Replayed %d of %d failed upserts\n", saved, len(failed))
+			if saved < len(failed) {
+				return fmt.Errorf("%d listing(s) still fail to upsert", len(failed)-saved)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&sourceSlug, "source", "s", "", "Source slug (empty for all)")
+	cmd.Flags().IntVarP(&limit, "limit", "l", 100, "Max listings to replay")
+
+	return cmd
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/spf13/cobra"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+	"github.com/kbsch/trough/internal/scraper/engine"
+	"github.com/kbsch/trough/internal/scraper/jobs"
+	"github.com/kbsch/trough/internal/scraper/sources"
+)
+
+func rescrapeOutdatedCmd() *cobra.Command {
+	var sourceSlug string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "rescrape-outdated",
+		Short: "Queue detail fetches of a source's listings parsed by an older version of its scraper",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if sourceSlug == "" {
+				return fmt.Errorf("--source is required")
+			}
+			ctx := context.Background()
+
+			source, err := repository.NewSourceRepository(db).GetBySlug(ctx, sourceSlug)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("source not found: %s", sourceSlug)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to load source %s: %w", sourceSlug, err)
+			}
+			version, err := currentScraperVersion(source)
+			if err != nil {
+				return err
+			}
+
+			ids, err := repository.NewListingRepository(db).ListOutdated(ctx, source.ID, version, limit)
+			if err != nil {
+				return fmt.Errorf("failed to list outdated listings: %w", err)
+			}
+			if len(ids) == 0 {
+				fmt.Printf("No %s listings parsed before scraper version %d\n", sourceSlug, version)
+				return nil
+			}
+
+			return withRiverClient(ctx, func(client *river.Client[pgx.Tx]) error {
+				if _, err := client.InsertMany(ctx, jobs.RescrapeParams(ids, version, time.Now())); err != nil {
+					return fmt.Errorf("failed to queue detail fetches: %w", err)
+				}
+				fmt.Printf("Queued detail fetches of %d %s listing(s) parsed before scraper version %d\n", len(ids), sourceSlug, version)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVarP(&sourceSlug, "source", "s", "", "Source slug (required)")
+	cmd.Flags().IntVarP(&limit, "limit", "l", 1000, "Max listings to queue")
+
+	return cmd
+}
+
+// currentScraperVersion returns the version of the scraper source is crawled
+// with, which must have one
+func currentScraperVersion(source *domain.Source) (int, error) {
+	cfg, err := domain.ParseSourceConfig(source.Config)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", source.Slug, err)
+	}
+
+	var scraper engine.Scraper
+	switch cfg.CrawlStrategy {
+	case domain.CrawlStrategySitemap:
+		scraper = sources.NewSitemapScraper(logger)
+	case domain.CrawlStrategyAPI:
+		scraper = sources.NewAPIScraper(logger)
+	default:
+		if scraper = collyScrapers()[source.Slug]; scraper == nil {
+			return 0, fmt.Errorf("no scraper registered for: %s", source.Slug)
+		}
+	}
+
+	version := engine.ScraperVersion(scraper)
+	if version == 0 {
+		return 0, fmt.Errorf("the %s scraper has no version", scraper.Name())
+	}
+	return version, nil
+}
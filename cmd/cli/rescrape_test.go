@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestCurrentScraperVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  domain.Source
+		wantErr string
+	}{
+		{"colly scraper", domain.Source{Slug: "bizquest", Config: []byte(`{}`)}, ""},
+		{"sitemap strategy", domain.Source{Slug: "custom", Config: []byte(`{"crawl_strategy":"sitemap","sitemap":{"listing_pattern":"/listing/"}}`)}, ""},
+		{"api strategy", domain.Source{Slug: "custom", Config: []byte(`{"crawl_strategy":"api","api":{"endpoint":"/api/search","results":"items","fields":{"external_id":"id","title":"name","url":"link"}}}`)}, ""},
+		{"no scraper", domain.Source{Slug: "custom", Config: []byte(`{}`)}, "no scraper registered for: custom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := currentScraperVersion(&tt.source)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || version < 1 {
+				t.Errorf("currentScraperVersion = %d, %v; want a version", version, err)
+			}
+		})
+	}
+}
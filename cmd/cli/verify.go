@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+	"github.com/kbsch/trough/internal/scraper/engine"
+)
+
+// cardSelectorLister is implemented by scrapers that report listing cards to
+// ScrapeOptions.MatchCard
+type cardSelectorLister interface {
+	CardSelectors() []string
+}
+
+// verifyFields are the card fields whose fill rate verify reports
+var verifyFields = []struct {
+	name   string
+	filled func(l *domain.Listing) bool
+}{
+	{"title", func(l *domain.Listing) bool { return l.Title != "" }},
+	{"url", func(l *domain.Listing) bool { return l.URL != "" }},
+	{"description", func(l *domain.Listing) bool { return l.Description != nil }},
+	{"asking_price", func(l *domain.Listing) bool { return l.AskingPrice != nil }},
+	{"cash_flow", func(l *domain.Listing) bool { return l.CashFlow != nil }},
+	{"revenue", func(l *domain.Listing) bool { return l.Revenue != nil }},
+	{"city", func(l *domain.Listing) bool { return l.City != nil }},
+	{"state", func(l *domain.Listing) bool { return l.State != nil }},
+	{"industry", func(l *domain.Listing) bool { return l.Industry != nil }},
+}
+
+// fieldFill is how many parsed cards populated a field
+type fieldFill struct {
+	field  string
+	filled int
+}
+
+// fieldFillRates counts, for each verify field, the listings that populated it
+func fieldFillRates(listings []*domain.Listing) []fieldFill {
+	fills := make([]fieldFill, len(verifyFields))
+	for i, f := range verifyFields {
+		fills[i].field = f.name
+		for _, l := range listings {
+			if f.filled(l) {
+				fills[i].filled++
+			}
+		}
+	}
+	return fills
+}
+
+// selectorMatch is how many cards a selector group matched
+type selectorMatch struct {
+	selector string
+	cards    int
+}
+
+// selectorMatches lists the scraper's selector groups in order, including the
+// ones that matched nothing, followed by any other group that matched
+func selectorMatches(groups []string, matched map[string]int) []selectorMatch {
+	result := make([]selectorMatch, 0, len(matched))
+	seen := make(map[string]bool)
+	for _, g := range groups {
+		result = append(result, selectorMatch{g, matched[g]})
+		seen[g] = true
+	}
+
+	var others []string
+	for g := range matched {
+		if !seen[g] {
+			others = append(others, g)
+		}
+	}
+	sort.Strings(others)
+	for _, g := range others {
+		result = append(result, selectorMatch{g, matched[g]})
+	}
+	return result
+}
+
+// verifyRun is what a single-page verify scrape saw
+type verifyRun struct {
+	mu       sync.Mutex
+	requests []domain.ScrapeJobRequest
+	matched  map[string]int
+	listings []*domain.Listing
+	errors   []error
+}
+
+func scrapeVerifyCmd() *cobra.Command {
+	var sourceSlug string
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Scrape a source's live start page and report how well its selectors match, without saving",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if sourceSlug == "" {
+				return fmt.Errorf("--source is required")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			// The source row is only read, for its base URL, start path and config
+			source, err := repository.NewSourceRepository(db).GetBySlug(ctx, sourceSlug)
+			if err != nil {
+				return fmt.Errorf("failed to load source %s: %w", sourceSlug, err)
+			}
+			cfg, err := domain.ParseSourceConfig(source.Config)
+			if err != nil {
+				return fmt.Errorf("%s: %w", sourceSlug, err)
+			}
+			if cfg.CrawlStrategy == domain.CrawlStrategySitemap {
+				return fmt.Errorf("%s is crawled from its sitemap and has no search page selectors to verify", sourceSlug)
+			}
+			if cfg.CrawlStrategy == domain.CrawlStrategyAPI {
+				return fmt.Errorf("%s is crawled from its API and has no search page selectors to verify", sourceSlug)
+			}
+			scraper, ok := collyScrapers()[sourceSlug]
+			if !ok {
+				return fmt.Errorf("no scraper registered for %s", sourceSlug)
+			}
+
+			run := verifySource(ctx, scraper, source, cfg)
+			var groups []string
+			if lister, ok := scraper.(cardSelectorLister); ok {
+				groups = lister.CardSelectors()
+			}
+			return printVerifyReport(source, groups, run)
+		},
+	}
+	cmd.Flags().StringVarP(&sourceSlug, "source", "s", "", "Source slug to verify")
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Minute, "Timeout for the verify scrape")
+
+	return cmd
+}
+
+// verifySource scrapes the source's first results page at the usual rate
+// limit and collects what the scraper found
+func verifySource(ctx context.Context, scraper engine.Scraper, source *domain.Source, cfg domain.SourceConfig) *verifyRun {
+	run := &verifyRun{matched: make(map[string]int)}
+
+	opts := domain.ScrapeOptions{
+		MaxPages:     1,
+		RateLimit:    engine.DefaultRateLimit,
+		BaseURL:      source.BaseURL,
+		StartPath:    cfg.StartPath,
+		SourceConfig: source.Config,
+		RecordRequest: func(url string, status int, err error) {
+			req := domain.ScrapeJobRequest{URL: url, Status: status}
+			if err != nil {
+				req.Error = domain.StrPtr(err.Error())
+			}
+			run.mu.Lock()
+			run.requests = append(run.requests, req)
+			run.mu.Unlock()
+		},
+		MatchCard: func(selector string) {
+			run.mu.Lock()
+			run.matched[selector]++
+			run.mu.Unlock()
+		},
+	}
+
+	listings, errs := scraper.Scrape(ctx, opts)
+	for listings != nil || errs != nil {
+		select {
+		case l, ok := <-listings:
+			if !ok {
+				listings = nil
+				continue
+			}
+			run.listings = append(run.listings, l)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			run.errors = append(run.errors, err)
+		}
+	}
+	return run
+}
+
+// printVerifyReport prints the fetched pages, selector matches and field fill
+// rates, failing if no cards were found or parsed
+func printVerifyReport(source *domain.Source, groups []string, run *verifyRun) error {
+	fmt.Printf("Verify %s (%s)\n", source.Name, source.Slug)
+
+	fmt.Println()
+	fmt.Println("Requests")
+	for _, req := range run.requests {
+		if req.Error != nil {
+			fmt.Printf("  %s✗%s %d %s: %s\n", colorRed, colorReset, req.Status, req.URL, *req.Error)
+			continue
+		}
+		fmt.Printf("  %s✓%s %d %s\n", colorGreen, colorReset, req.Status, req.URL)
+	}
+	for _, err := range run.errors {
+		fmt.Printf("  %s✗%s %v\n", colorRed, colorReset, err)
+	}
+
+	fmt.Println()
+	fmt.Println("Card selectors")
+	cards := 0
+	for _, m := range selectorMatches(groups, run.matched) {
+		color := colorGreen
+		if m.cards == 0 {
+			color = colorYellow
+		}
+		fmt.Printf("  %s%3d%s cards  %s\n", color, m.cards, colorReset, m.selector)
+		cards += m.cards
+	}
+
+	fmt.Println()
+	fmt.Printf("Fields (%d of %d cards parsed)\n", len(run.listings), cards)
+	for _, f := range fieldFillRates(run.listings) {
+		color := colorGreen
+		switch {
+		case f.filled == 0:
+			color = colorRed
+		case f.filled < len(run.listings):
+			color = colorYellow
+		}
+		fmt.Printf("  %-14s %s%d/%d%s\n", f.field, color, f.filled, len(run.listings), colorReset)
+	}
+
+	fmt.Println()
+	switch {
+	case cards == 0:
+		return fmt.Errorf("no listing cards matched on %s; its selectors may be out of date", source.Slug)
+	case len(run.listings) == 0:
+		return fmt.Errorf("%d cards matched on %s but none parsed", cards, source.Slug)
+	}
+	fmt.Printf("%sSelectors look healthy%s\n", colorGreen, colorReset)
+	return nil
+}
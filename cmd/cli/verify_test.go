@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/scraper/sources"
+)
+
+func TestFieldFillRates(t *testing.T) {
+	price := int64(100000)
+	listings := []*domain.Listing{
+		{Title: "Cafe", URL: "https://example.com/1", AskingPrice: &price, City: domain.StrPtr("Austin")},
+		{Title: "Gym", URL: "https://example.com/2"},
+	}
+
+	got := make(map[string]int)
+	for _, f := range fieldFillRates(listings) {
+		got[f.field] = f.filled
+	}
+	want := map[string]int{"title": 2, "url": 2, "asking_price": 1, "city": 1, "state": 0, "revenue": 0}
+	for field, n := range want {
+		if got[field] != n {
+			t.Errorf("%s filled on %d cards, want %d", field, got[field], n)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	got := selectorMatches([]string{"div.listing", "div[data-id]"}, map[string]int{"div[data-id]": 3, "article": 1})
+	want := []selectorMatch{{"div.listing", 0}, {"div[data-id]", 3}, {"article", 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("selectorMatches = %v, want %v", got, want)
+	}
+}
+
+func TestVerifySourceFetchesOnePage(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeFile(w, r, filepath.Join("..", "..", "internal", "scraper", "sources", "testdata", "bizquest.html"))
+	}))
+	defer srv.Close()
+
+	scraper := sources.NewBizQuestScraper(nil)
+	source := &domain.Source{Slug: "bizquest", BaseURL: srv.URL}
+	run := verifySource(context.Background(), scraper, source, domain.SourceConfig{})
+
+	if requests != 1 || len(run.requests) != 1 || run.requests[0].Status != http.StatusOK {
+		t.Errorf("server saw %d requests, recorded %v; want the start page once", requests, run.requests)
+	}
+	if len(run.listings) != 2 {
+		t.Errorf("parsed %d listings, want 2", len(run.listings))
+	}
+	matches := selectorMatches(scraper.CardSelectors(), run.matched)
+	if len(matches) != 1 || matches[0].cards != 2 {
+		t.Errorf("selector matches = %v, want 2 cards on the one group", matches)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// pinger is satisfied by *sqlx.DB
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// newHealthServer serves Prometheus metrics and a liveness check for the worker.
+// /health reports unhealthy until River has started and whenever the database is unreachable.
+func newHealthServer(addr string, db pinger, riverStarted *atomic.Bool) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/health", healthHandler(db, riverStarted))
+
+	return &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+}
+
+func healthHandler(db pinger, riverStarted *atomic.Bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		dbOK := db.PingContext(ctx) == nil
+		started := riverStarted.Load()
+
+		status := "healthy"
+		statusCode := http.StatusOK
+		if !dbOK || !started {
+			status = "unhealthy"
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": status,
+			"checks": map[string]interface{}{
+				"database": dbOK,
+				"river":    started,
+			},
+			"time": time.Now().UTC(),
+		})
+	}
+}
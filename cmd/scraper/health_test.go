@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+type fakePinger struct{ err error }
+
+func (p fakePinger) PingContext(ctx context.Context) error { return p.err }
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		dbErr   error
+		started bool
+		want    int
+	}{
+		{"healthy", nil, true, http.StatusOK},
+		{"river not started", nil, false, http.StatusServiceUnavailable},
+		{"database down", errors.New("connection refused"), true, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var started atomic.Bool
+			started.Store(tt.started)
+
+			rec := httptest.NewRecorder()
+			healthHandler(fakePinger{tt.dbErr}, &started)(rec, httptest.NewRequest("GET", "/health", nil))
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthServerServesMetrics(t *testing.T) {
+	var started atomic.Bool
+	srv := newHealthServer(":0", fakePinger{}, &started)
+
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/metrics status = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// listingCounter is satisfied by *repository.ListingRepository
+type listingCounter interface {
+	CountBySource(ctx context.Context) ([]domain.SourceListingCount, error)
+}
+
+// runListingMetrics refreshes the trough_listings_total gauges every interval,
+// independently of scrape runs, until ctx is cancelled
+func runListingMetrics(ctx context.Context, counter listingCounter, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := updateListingMetrics(ctx, counter); err != nil && ctx.Err() == nil {
+			logger.Warn("failed to count listings for metrics", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateListingMetrics sets the trough_listings_total gauges from one grouped
+// count. Sources that no longer have listings in a state drop out.
+func updateListingMetrics(ctx context.Context, counter listingCounter) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	counts, err := counter.CountBySource(ctx)
+	if err != nil {
+		return err
+	}
+
+	middleware.ListingsTotal.Reset()
+	for _, c := range counts {
+		middleware.ListingsTotal.WithLabelValues(c.Source, strconv.FormatBool(c.Active)).Set(float64(c.Count))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/domain"
+)
+
+type fakeListingCounter struct {
+	counts []domain.SourceListingCount
+	err    error
+}
+
+func (f fakeListingCounter) CountBySource(ctx context.Context) ([]domain.SourceListingCount, error) {
+	return f.counts, f.err
+}
+
+func TestUpdateListingMetrics(t *testing.T) {
+	counter := fakeListingCounter{counts: []domain.SourceListingCount{
+		{Source: "bizbuysell", Active: true, Count: 120},
+		{Source: "bizbuysell", Active: false, Count: 30},
+		{Source: "bizquest", Active: true, Count: 7},
+	}}
+	if err := updateListingMetrics(context.Background(), counter); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[[2]string]float64{
+		{"bizbuysell", "true"}:  120,
+		{"bizbuysell", "false"}: 30,
+		{"bizquest", "true"}:    7,
+	}
+	for labels, n := range want {
+		if got := testutil.ToFloat64(middleware.ListingsTotal.WithLabelValues(labels[0], labels[1])); got != n {
+			t.Errorf("trough_listings_total{source=%q,active=%q} = %v, want %v", labels[0], labels[1], got, n)
+		}
+	}
+
+	// A later count replaces the gauges, dropping states that emptied
+	counter.counts = counter.counts[:1]
+	if err := updateListingMetrics(context.Background(), counter); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(middleware.ListingsTotal); n != 1 {
+		t.Errorf("%d series after recount, want 1", n)
+	}
+
+	// A failed count leaves the last values in place
+	counter.err = errors.New("connection refused")
+	if err := updateListingMetrics(context.Background(), counter); err == nil {
+		t.Error("expected the count error")
+	}
+	if n := testutil.CollectAndCount(middleware.ListingsTotal); n != 1 {
+		t.Errorf("%d series after failed count, want 1", n)
+	}
+}
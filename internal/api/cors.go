@@ -0,0 +1,30 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-chi/cors"
+)
+
+// corsOptions builds the CORS config for the given exact origins. Credentialed
+// requests are allowed, so wildcard origins are rejected.
+func corsOptions(origins []string) (cors.Options, error) {
+	opts := cors.Options{
+		AllowedOrigins:   origins,
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Idempotency-Key", "X-API-Key"},
+		ExposedHeaders:   []string{"Link", "Deprecation", "Sunset", "Warning", "X-Request-ID", "ETag", "X-Total-Count", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
+		AllowCredentials: true,
+		MaxAge:           300,
+	}
+
+	if opts.AllowCredentials {
+		for _, o := range origins {
+			if strings.Contains(o, "*") {
+				return cors.Options{}, fmt.Errorf("CORS_ALLOWED_ORIGINS: wildcard origin %q is not allowed with credentials; list exact origins", o)
+			}
+		}
+	}
+	return opts, nil
+}
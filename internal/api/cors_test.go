@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/cors"
+)
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	opts, err := corsOptions([]string{"https://trough.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := cors.Handler(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		origin string
+		want   string
+	}{
+		{"https://trough.example.com", "https://trough.example.com"},
+		{"https://evil.example.com", ""},
+		{"http://localhost:3000", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/listings", nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSExposesRateLimitHeaders(t *testing.T) {
+	opts, err := corsOptions([]string{"https://trough.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := cors.Handler(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/listings", nil)
+	req.Header.Set("Origin", "https://trough.example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	exposed := strings.ToLower(rec.Header().Get("Access-Control-Expose-Headers"))
+	for _, header := range []string{"Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"} {
+		if !strings.Contains(exposed, strings.ToLower(header)) {
+			t.Errorf("Access-Control-Expose-Headers = %q, missing %s", exposed, header)
+		}
+	}
+}
+
+func TestCORSOptionsRejectsWildcard(t *testing.T) {
+	for _, origins := range [][]string{{"*"}, {"https://*"}, {"https://ok.example.com", "http://localhost:*"}} {
+		if _, err := corsOptions(origins); err == nil {
+			t.Errorf("corsOptions(%v) returned no error, want wildcard rejected", origins)
+		}
+	}
+}
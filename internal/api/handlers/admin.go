@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/repository"
+	"github.com/kbsch/trough/internal/scraper/jobs"
+)
+
+// AdminHandler serves maintenance endpoints for admins, behind the API key
+type AdminHandler struct {
+	listings    *repository.ListingRepository
+	queue       JobQueue
+	rateLimiter middleware.Limiter
+}
+
+// NewAdminHandler creates an admin handler that queues jobs on queue. The
+// rate limiter guards the expensive endpoints; if nil, an in-memory limiter
+// allowing 1 request per hour is used.
+func NewAdminHandler(listings *repository.ListingRepository, queue JobQueue, rateLimiter middleware.Limiter) *AdminHandler {
+	if rateLimiter == nil {
+		rateLimiter = middleware.NewRateLimiter(1, time.Hour)
+	}
+	return &AdminHandler{listings: listings, queue: queue, rateLimiter: rateLimiter}
+}
+
+// GeocodeMissing queues a geocode backfill of up to ?limit= active listings
+// lacking coordinates, e.g. after fixing the geocoder or location parsing.
+// The worker reports its progress in the trough_geocode_* metrics.
+func (h *AdminHandler) GeocodeMissing(w http.ResponseWriter, r *http.Request) {
+	args := jobs.GeocodeBackfillJobArgs{}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > jobs.MaxGeocodeBackfillLimit {
+			BadRequest(w, r, fmt.Sprintf("limit must be between 1 and %d", jobs.MaxGeocodeBackfillLimit))
+			return
+		}
+		args.Limit = limit
+	}
+
+	if !h.rateLimiter.Allow(r.RemoteAddr) {
+		middleware.SetRateLimitHeaders(w, h.rateLimiter, r.RemoteAddr)
+		TooManyRequests(w, r, "Geocode backfills are limited to once per hour. Please try again later.")
+		return
+	}
+
+	pending, err := h.listings.CountNeedingGeocode(r.Context())
+	if err != nil {
+		log.Printf("Count geocode candidates error: %v", err)
+		InternalError(w, r, "Failed to count listings missing coordinates")
+		return
+	}
+	if pending == 0 {
+		Success(w, r, map[string]interface{}{"status": "nothing_to_do", "queued": 0, "pending": 0})
+		return
+	}
+
+	result, err := h.queue.Insert(r.Context(), args, nil)
+	if err != nil {
+		log.Printf("Queue geocode backfill error: %v", err)
+		InternalError(w, r, "Failed to queue geocode backfill")
+		return
+	}
+
+	// A run with the same limit within the hour is reused, not repeated
+	status := "queued"
+	if result.UniqueSkippedAsDuplicate {
+		status = "already_queued"
+	}
+	Accepted(w, r, map[string]interface{}{
+		"status":  status,
+		"job_id":  result.Job.ID,
+		"queued":  min(pending, args.BatchSize()),
+		"pending": pending,
+	})
+}
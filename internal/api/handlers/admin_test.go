@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/repository"
+	"github.com/kbsch/trough/internal/scraper/jobs"
+)
+
+func TestGeocodeMissing(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	listings := repository.NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+	queue := &fakeJobQueue{}
+	h := NewAdminHandler(listings, queue, allowLimiter{})
+
+	post := func(h *AdminHandler, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.GeocodeMissing(rec, httptest.NewRequest("POST", "/api/v1/admin/geocode-missing"+query, nil))
+		return rec
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=lots", "?limit=100000"} {
+		if rec := post(h, query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+
+	// Only listings without coordinates are counted and queued
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings\s+WHERE is_active = true AND hidden = false\s+AND \(lat IS NULL OR lng IS NULL\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(40))
+	rec := post(h, "?limit=25")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["queued"] != float64(25) || body["pending"] != float64(40) || body["status"] != "queued" {
+		t.Errorf("body = %v, want 25 of 40 queued", body)
+	}
+	if len(queue.inserted) != 1 || queue.inserted[0] != (jobs.GeocodeBackfillJobArgs{Limit: 25}) {
+		t.Errorf("inserted %v, want one backfill limited to 25", queue.inserted)
+	}
+
+	// Nothing to geocode queues nothing
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	if rec := post(h, ""); rec.Code != http.StatusOK || len(queue.inserted) != 1 {
+		t.Errorf("status = %d with %d jobs, want 200 and no new job", rec.Code, len(queue.inserted))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if rec := post(NewAdminHandler(listings, queue, denyLimiter{}), ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("rate limited: status = %d, want 429", rec.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// SetSearchMaxAge sets how long clients and CDNs may cache search results
+// (SEARCH_CACHE_MAX_AGE, 1m by default); 0 makes them revalidate every time
+func (h *ListingHandler) SetSearchMaxAge(d time.Duration) {
+	h.searchMaxAge = d
+}
+
+// setPublicCache lets any cache store the response for maxAge
+func setPublicCache(w http.ResponseWriter, maxAge time.Duration) {
+	if maxAge <= 0 {
+		w.Header().Set("Cache-Control", "public, no-cache")
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+}
+
+// listingNotModified sets the caching headers of a listing's detail and, if
+// the client's copy is current, answers 304 Not Modified and returns true.
+// Scrapes and pushes set last_seen_at whenever they write a listing, and any
+// other update (hiding, deactivation, enrichment) sets updated_at, so a
+// client whose copy is no older than both can keep it; it revalidates on
+// every use.
+func listingNotModified(w http.ResponseWriter, r *http.Request, listing *domain.Listing) bool {
+	w.Header().Set("Cache-Control", "public, no-cache")
+	w.Header().Set("ETag", listingETag(listing))
+	lastModified := listing.LastSeenAt
+	if listing.UpdatedAt.After(lastModified) {
+		lastModified = listing.UpdatedAt
+	}
+	return notModified(w, r, lastModified)
+}
+
+// listingETag is a weak validator for a listing, changing with last_seen_at,
+// updated_at, is_active and hidden
+func listingETag(listing *domain.Listing) string {
+	return fmt.Sprintf(`W/"%s-%x-%x-%t-%t"`, listing.ID, listing.LastSeenAt.UnixNano(), listing.UpdatedAt.UnixNano(),
+		listing.IsActive, listing.Hidden)
+}
+
+// notModified sets Last-Modified and, if the request's If-Modified-Since is
+// no older than lastModified, answers 304 Not Modified and returns true. HTTP
+// dates have whole seconds, so lastModified is compared truncated to them.
+// If w already has an ETag, an If-None-Match header is checked against it
+// instead, as it takes precedence.
+func notModified(w http.ResponseWriter, r *http.Request, lastModified time.Time) bool {
+	if lastModified.IsZero() {
+		return false
+	}
+	lastModified = lastModified.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if etag := w.Header().Get("ETag"); etag != "" {
+			if !etagMatches(match, etag) {
+				return false
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified.After(since) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header names etag, comparing
+// weakly as RFC 9110 asks
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// headWriter drops the body of a response to a HEAD request, keeping its
+// status and headers; net/http does the same, but handlers tested with a
+// recorder would otherwise show one
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (w headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
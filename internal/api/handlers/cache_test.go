@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+)
+
+func TestNotModified(t *testing.T) {
+	lastSeen := time.Date(2026, 3, 14, 9, 30, 15, 500_000_000, time.UTC)
+
+	tests := []struct {
+		name   string
+		method string
+		since  string
+		want   bool
+	}{
+		{"no header", http.MethodGet, "", false},
+		{"same second", http.MethodGet, "Sat, 14 Mar 2026 09:30:15 GMT", true},
+		{"later", http.MethodHead, "Sat, 14 Mar 2026 10:00:00 GMT", true},
+		{"earlier", http.MethodGet, "Sat, 14 Mar 2026 09:30:14 GMT", false},
+		{"unparseable", http.MethodGet, "yesterday", false},
+		{"not a read", http.MethodPost, "Sat, 14 Mar 2026 10:00:00 GMT", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.since != "" {
+				req.Header.Set("If-Modified-Since", tt.since)
+			}
+			rec := httptest.NewRecorder()
+
+			if got := notModified(rec, req, lastSeen); got != tt.want {
+				t.Errorf("notModified = %v, want %v", got, tt.want)
+			}
+			if got := rec.Header().Get("Last-Modified"); got != "Sat, 14 Mar 2026 09:30:15 GMT" {
+				t.Errorf("Last-Modified = %q", got)
+			}
+			if tt.want && rec.Code != http.StatusNotModified {
+				t.Errorf("status = %d, want 304", rec.Code)
+			}
+		})
+	}
+}
+
+func TestListingValidators(t *testing.T) {
+	lastSeen := time.Date(2026, 3, 14, 9, 30, 15, 0, time.UTC)
+	base := domain.Listing{ID: uuid.New(), LastSeenAt: lastSeen, UpdatedAt: lastSeen, IsActive: true}
+	etag := listingETag(&base)
+
+	for name, change := range map[string]func(*domain.Listing){
+		"updated":     func(l *domain.Listing) { l.UpdatedAt = l.UpdatedAt.Add(time.Minute) },
+		"seen":        func(l *domain.Listing) { l.LastSeenAt = l.LastSeenAt.Add(time.Minute) },
+		"deactivated": func(l *domain.Listing) { l.IsActive = false },
+		"hidden":      func(l *domain.Listing) { l.Hidden = true },
+	} {
+		listing := base
+		change(&listing)
+		if listingETag(&listing) == etag {
+			t.Errorf("%s: ETag unchanged", name)
+		}
+	}
+
+	// An update after the last scrape moves Last-Modified past a client's copy
+	listing := base
+	listing.UpdatedAt = lastSeen.Add(time.Hour)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-Modified-Since", lastSeen.Format(http.TimeFormat))
+	rec := httptest.NewRecorder()
+	if listingNotModified(rec, req, &listing) {
+		t.Error("304 for a listing updated since the client's copy")
+	}
+	if got := rec.Header().Get("Last-Modified"); got != "Sat, 14 Mar 2026 10:30:15 GMT" {
+		t.Errorf("Last-Modified = %q, want updated_at", got)
+	}
+}
+
+func TestGetByIDConditional(t *testing.T) {
+	id := uuid.New()
+	lastSeen := time.Date(2026, 3, 14, 9, 30, 15, 0, time.UTC)
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	h := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+	router := chi.NewRouter()
+	router.Get("/api/v1/listings/{id}", h.GetByID)
+
+	listingRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "title", "is_active", "last_seen_at"}).
+			AddRow(id, "Coffee Shop", true, lastSeen)
+	}
+	get := func(since string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/listings/"+id.String(), nil)
+		if since != "" {
+			req.Header.Set("If-Modified-Since", since)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Unchanged since the client's copy: 304 without fetching the rest
+	mock.ExpectQuery(`FROM listings l`).WithArgs(id).WillReturnRows(listingRows())
+	rec := get(lastSeen.Format(http.TimeFormat))
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("status = %d with %d bytes, want an empty 304", rec.Code, rec.Body.Len())
+	}
+
+	// Changed since: the full listing
+	mock.ExpectQuery(`FROM listings l`).WithArgs(id).WillReturnRows(listingRows())
+	mock.ExpectQuery(`FROM listing_locations`).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_primary"}))
+	rec = get(lastSeen.Add(-time.Hour).Format(http.TimeFormat))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Last-Modified"); got != "Sat, 14 Mar 2026 09:30:15 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, no-cache" {
+		t.Errorf("Cache-Control = %q, want public, no-cache", got)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSearchCacheControl(t *testing.T) {
+	tests := []struct {
+		maxAge time.Duration
+		want   string
+	}{
+		{0, "public, no-cache"},
+		{90 * time.Second, "public, max-age=90"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+			db := sqlx.NewDb(mockDB, "postgres")
+			h := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+			h.SetSearchMaxAge(tt.maxAge)
+
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l`).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+			rec := httptest.NewRecorder()
+			h.Search(rec, httptest.NewRequest(http.MethodGet, "/api/v1/listings?count_only=true", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+			if got := rec.Header().Get("X-Total-Count"); got != "3" {
+				t.Errorf("X-Total-Count = %q, want 3", got)
+			}
+		})
+	}
+
+	// Failed searches aren't cached
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	h := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+	h.SetSearchMaxAge(time.Minute)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l`).WillReturnError(sqlmock.ErrCancelled)
+	rec := httptest.NewRecorder()
+	h.Search(rec, httptest.NewRequest(http.MethodGet, "/api/v1/listings?count_only=true", nil))
+	if got := rec.Header().Get("Cache-Control"); rec.Code != http.StatusInternalServerError || got != "" {
+		t.Errorf("status = %d, Cache-Control = %q; want 500 without caching", rec.Code, got)
+	}
+}
+
+func TestHeadListings(t *testing.T) {
+	id := uuid.New()
+	lastSeen := time.Date(2026, 3, 14, 9, 30, 15, 0, time.UTC)
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	h := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+	router := chi.NewRouter()
+	router.Head("/api/v1/listings", h.SearchHead)
+	router.Head("/api/v1/listings/{id}", h.GetByIDHead)
+	head := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodHead, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Found: the detail's headers, without fetching locations or a body
+	mock.ExpectQuery(`FROM listings l`).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_active", "last_seen_at"}).
+			AddRow(id, "Coffee Shop", true, lastSeen))
+	rec := head("/api/v1/listings/" + id.String())
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("found: status = %d with %d bytes, want an empty 200", rec.Code, rec.Body.Len())
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Error("found: no ETag")
+	}
+	if got := rec.Header().Get("Last-Modified"); got != "Sat, 14 Mar 2026 09:30:15 GMT" {
+		t.Errorf("found: Last-Modified = %q", got)
+	}
+
+	// The ETag revalidates
+	mock.ExpectQuery(`FROM listings l`).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_active", "last_seen_at"}).
+			AddRow(id, "Coffee Shop", true, lastSeen))
+	rec = head("/api/v1/listings/"+id.String(), "If-None-Match", etag)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: status = %d, want 304", rec.Code)
+	}
+
+	// Missing
+	missing := uuid.New()
+	mock.ExpectQuery(`FROM listings l`).WithArgs(missing).WillReturnError(sql.ErrNoRows)
+	rec = head("/api/v1/listings/" + missing.String())
+	if rec.Code != http.StatusNotFound || rec.Body.Len() != 0 {
+		t.Errorf("missing: status = %d with %d bytes, want an empty 404", rec.Code, rec.Body.Len())
+	}
+
+	// Search: only the count runs
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+	rec = head("/api/v1/listings?state=TX&facets=industry")
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("search: status = %d with %d bytes, want an empty 200", rec.Code, rec.Body.Len())
+	}
+	if got := rec.Header().Get("X-Total-Count"); got != "42" {
+		t.Errorf("search: X-Total-Count = %q, want 42", got)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	etag := `W/"abc-1"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`W/"abc-1"`, true},
+		{`"abc-1"`, true},
+		{`"xyz", W/"abc-1"`, true},
+		{`*`, true},
+		{`W/"abc-2"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
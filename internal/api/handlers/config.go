@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/kbsch/trough/internal/repository"
+)
+
+// PublicConfig is the server's limits and allowlists the frontend builds its
+// search and map UI from. It holds nothing sensitive.
+type PublicConfig struct {
+	PerPage PerPageLimits `json:"per_page"`
+	// MapMaxMarkers caps the listings a map response covers (SEARCH_MAX_ROWS)
+	MapMaxMarkers int                     `json:"map_max_markers"`
+	Sorts         []repository.SortOption `json:"sorts"`
+	DefaultSort   string                  `json:"default_sort"`
+	// Facets are the names the facets search param accepts
+	Facets []string `json:"facets"`
+	// Currency is the currency of every amount, given in cents
+	Currency string `json:"currency"`
+}
+
+// PerPageLimits bound the per_page search param
+type PerPageLimits struct {
+	Default int `json:"default"`
+	Max     int `json:"max"`
+}
+
+// Config returns the public runtime settings
+func (h *ListingHandler) Config(w http.ResponseWriter, r *http.Request) {
+	Success(w, r, h.publicConfig())
+}
+
+func (h *ListingHandler) publicConfig() PublicConfig {
+	return PublicConfig{
+		PerPage:       PerPageLimits{Default: defaultPerPage, Max: maxPerPage},
+		MapMaxMarkers: h.repo.MaxRows(),
+		Sorts:         h.repo.SortOptions(),
+		DefaultSort:   h.repo.DefaultSort(),
+		Facets:        repository.FacetNames(),
+		Currency:      "USD",
+	}
+}
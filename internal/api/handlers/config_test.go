@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/repository"
+)
+
+func TestConfigSortsMatchSearch(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	repo := repository.NewListingRepository(db)
+	if err := repo.ConfigureSorts("newest", map[string]repository.SearchSort{"revenue_desc": {Column: "revenue", Desc: true}}); err != nil {
+		t.Fatal(err)
+	}
+	repo.SetMaxRows(500)
+	h := NewListingHandler(repo, repository.NewSourceRepository(db))
+
+	rec := httptest.NewRecorder()
+	h.Config(rec, httptest.NewRequest("GET", "/api/v1/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var cfg PublicConfig
+	if err := json.NewDecoder(rec.Body).Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DefaultSort != "newest" || cfg.MapMaxMarkers != 500 || cfg.PerPage.Max != maxPerPage {
+		t.Errorf("config = %+v, want default sort newest, 500 map markers, per_page max %d", cfg, maxPerPage)
+	}
+
+	// Every advertised sort is applied as named by a search; anything else
+	// falls back to the advertised default
+	search := func(sort string) string {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		rec := httptest.NewRecorder()
+		h.Search(rec, httptest.NewRequest("GET", "/api/v1/listings?count_only=true&sort="+sort, nil))
+		var body struct {
+			Sort string `json:"sort"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("sort %s: %v", sort, err)
+		}
+		return body.Sort
+	}
+	names := map[string]bool{}
+	for _, opt := range cfg.Sorts {
+		names[opt.Name] = true
+		if got := search(opt.Name); got != opt.Name {
+			t.Errorf("advertised sort %s: search applied %q", opt.Name, got)
+		}
+	}
+	if !names["revenue_desc"] || !names[repository.SortRandom] || !names[repository.DefaultSearchSort] {
+		t.Errorf("sorts = %v, want the configured, random and built-in sorts", cfg.Sorts)
+	}
+	if got := search("bogus"); got != cfg.DefaultSort {
+		t.Errorf("unadvertised sort: search applied %q, want the default %q", got, cfg.DefaultSort)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfigMapMaxMarkersMatchesMapView(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	repo := repository.NewListingRepository(db)
+	repo.SetMaxRows(750)
+	h := NewListingHandler(repo, repository.NewSourceRepository(db))
+
+	rec := httptest.NewRecorder()
+	h.Config(rec, httptest.NewRequest("GET", "/api/v1/config", nil))
+	var cfg PublicConfig
+	if err := json.NewDecoder(rec.Body).Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// The map fetches as many listings as the config advertises markers
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`LIMIT \$1 OFFSET \$2`).
+		WithArgs(cfg.MapMaxMarkers, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	rec = httptest.NewRecorder()
+	h.MapView(rec, httptest.NewRequest("GET", "/api/v1/listings/map", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("map_max_markers = %d, not the map's row cap: %v", cfg.MapMaxMarkers, err)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kbsch/trough/internal/repository"
+)
+
+// FranchiseHandler serves franchises, which group the resales of one brand
+// across sources
+type FranchiseHandler struct {
+	repo     *repository.FranchiseRepository
+	listings *ListingHandler
+}
+
+// NewFranchiseHandler creates a franchise handler; a franchise's listings are
+// searched through listings
+func NewFranchiseHandler(repo *repository.FranchiseRepository, listings *ListingHandler) *FranchiseHandler {
+	return &FranchiseHandler{repo: repo, listings: listings}
+}
+
+// List returns the franchises with active listings and how many each has
+func (h *FranchiseHandler) List(w http.ResponseWriter, r *http.Request) {
+	franchises, err := h.repo.List(r.Context())
+	if err != nil {
+		log.Printf("List franchises error: %v", err)
+		InternalError(w, r, "Failed to fetch franchises")
+		return
+	}
+
+	Success(w, r, map[string]interface{}{
+		"franchises": franchises,
+	})
+}
+
+// Listings returns the active resales of the franchise named by slug, from
+// every source, taking the same search, pagination and sort parameters as
+// listing search
+func (h *FranchiseHandler) Listings(w http.ResponseWriter, r *http.Request) {
+	franchise, err := h.repo.GetBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			NotFound(w, r, "Franchise not found")
+			return
+		}
+		log.Printf("Get franchise error: %v", err)
+		InternalError(w, r, "Failed to fetch franchise")
+		return
+	}
+
+	params := parseSearchParams(r)
+	params.FranchiseID = &franchise.ID
+	h.listings.search(w, r, params)
+}
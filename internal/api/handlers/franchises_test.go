@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/repository"
+)
+
+func TestFranchiseRoutes(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	listings := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+	h := NewFranchiseHandler(repository.NewFranchiseRepository(db), listings)
+
+	router := chi.NewRouter()
+	router.Get("/api/v1/franchises", h.List)
+	router.Get("/api/v1/franchises/{slug}/listings", h.Listings)
+
+	columns := []string{"id", "slug", "name", "created_at", "listing_count"}
+	franchiseID := uuid.New()
+	mock.ExpectQuery(`SELECT f.id, f.slug, f.name, f.created_at, COUNT\(l.id\) AS listing_count`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(franchiseID, "subway", "Subway", time.Now(), 3))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/franchises", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var list struct {
+		Franchises []struct {
+			Slug         string `json:"slug"`
+			ListingCount int    `json:"listing_count"`
+		} `json:"franchises"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Franchises) != 1 || list.Franchises[0].Slug != "subway" || list.Franchises[0].ListingCount != 3 {
+		t.Errorf("franchises = %+v, want subway with 3 listings", list.Franchises)
+	}
+
+	// Unknown slug
+	mock.ExpectQuery(`FROM franchises f\s+WHERE f.slug = \$1`).
+		WithArgs("nope").
+		WillReturnError(sql.ErrNoRows)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/franchises/nope/listings", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown slug: status = %d, want 404", rec.Code)
+	}
+
+	// Known slug: the search is limited to the franchise's listings
+	mock.ExpectQuery(`FROM franchises f\s+WHERE f.slug = \$1`).
+		WithArgs("subway").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(franchiseID, "subway", "Subway", time.Now(), 3))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l WHERE l.is_active = true AND l.hidden = false AND l.franchise_id = \$1`).
+		WithArgs(franchiseID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/franchises/subway/listings?count_only=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
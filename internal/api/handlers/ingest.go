@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// maxIngestListings caps how many listings a single ingest request may push
+const maxIngestListings = 100
+
+// maxIngestBodyBytes bounds an ingest request body
+const maxIngestBodyBytes = 4 << 20
+
+// Per-listing outcomes of an ingest request
+const (
+	ingestCreated  = "created"
+	ingestUpdated  = "updated"
+	ingestRejected = "rejected"
+)
+
+// ingestResult is the outcome of one pushed listing; Index is its position
+// in the request
+type ingestResult struct {
+	Index      int    `json:"index"`
+	ExternalID string `json:"external_id,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Ingest upserts listings a partner pushes for a source, one listing object
+// or an array of them, through the same upsert as scraped listings
+// (authenticated). Each listing gets its own result; invalid ones are
+// rejected without failing the rest.
+func (h *ListingHandler) Ingest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	source, err := h.sources.GetBySlug(ctx, chi.URLParam(r, "slug"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			NotFound(w, r, "Source not found")
+			return
+		}
+		log.Printf("Get source error: %v", err)
+		InternalError(w, r, "Failed to fetch source")
+		return
+	}
+
+	items, err := decodeIngestBody(http.MaxBytesReader(w, r.Body, maxIngestBodyBytes))
+	if err != nil {
+		BadRequest(w, r, err.Error())
+		return
+	}
+
+	results := make([]ingestResult, len(items))
+	listings := make([]*domain.Listing, 0, len(items))
+	indexes := make(map[string]int, len(items))
+	now := time.Now()
+	for i, item := range items {
+		results[i] = ingestResult{Index: i, Status: ingestRejected}
+		listing, err := parseIngestListing(item)
+		if listing != nil {
+			results[i].ExternalID = listing.ExternalID
+		}
+		if err == nil {
+			if _, dup := indexes[listing.ExternalID]; dup {
+				err = fmt.Errorf("external_id is repeated in the request")
+			}
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		// Server-managed fields are set here, whatever the payload says
+		listing.ID = uuid.New()
+		listing.SourceID = source.ID
+		listing.FirstSeenAt = now
+		listing.LastSeenAt = now
+		listing.IsActive = true
+		listing.FranchiseID = nil
+		listing.RawData = item
+		indexes[listing.ExternalID] = i
+		listings = append(listings, listing)
+	}
+
+	if len(listings) > 0 {
+		if err := h.ingest(ctx, source.ID, listings, indexes, results); err != nil {
+			log.Printf("Ingest listings error: %v", err)
+			InternalError(w, r, "Failed to save listings")
+			return
+		}
+	}
+
+	counts := map[string]int{ingestCreated: 0, ingestUpdated: 0, ingestRejected: 0}
+	for _, res := range results {
+		counts[res.Status]++
+	}
+	Success(w, r, map[string]interface{}{
+		"results":  results,
+		"created":  counts[ingestCreated],
+		"updated":  counts[ingestUpdated],
+		"rejected": counts[ingestRejected],
+	})
+}
+
+// ingest upserts valid listings and records each one's result. If the batch
+// fails, listings are upserted one by one so a row the database rejects
+// doesn't fail the rest.
+func (h *ListingHandler) ingest(ctx context.Context, sourceID uuid.UUID, listings []*domain.Listing, indexes map[string]int, results []ingestResult) error {
+	externalIDs := make([]string, len(listings))
+	for i, l := range listings {
+		externalIDs[i] = l.ExternalID
+	}
+	existing, err := h.repo.ExistingExternalIDs(ctx, sourceID, externalIDs)
+	if err != nil {
+		return err
+	}
+
+	saved := func(l *domain.Listing) {
+		res := &results[indexes[l.ExternalID]]
+		res.Status = ingestCreated
+		if existing[l.ExternalID] {
+			res.Status = ingestUpdated
+		}
+	}
+
+	err = h.repo.UpsertBatch(ctx, listings)
+	if err == nil {
+		for _, l := range listings {
+			saved(l)
+		}
+		return nil
+	}
+	log.Printf("Ingest batch upsert failed, retrying listings one by one: %v", err)
+
+	for _, l := range listings {
+		if err := h.repo.Upsert(ctx, l); err != nil {
+			log.Printf("Ingest upsert of %s failed: %v", l.ExternalID, err)
+			results[indexes[l.ExternalID]].Error = "the database rejected the listing"
+			continue
+		}
+		saved(l)
+	}
+	return nil
+}
+
+// decodeIngestBody returns the listing objects of an ingest request body:
+// one object, or an array of at most maxIngestListings
+func decodeIngestBody(body io.Reader) ([]json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return nil, errors.New("invalid request body")
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '[' {
+		return []json.RawMessage{raw}, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, errors.New("invalid request body")
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("at least one listing is required")
+	}
+	if len(items) > maxIngestListings {
+		return nil, fmt.Errorf("at most %d listings per request", maxIngestListings)
+	}
+	return items, nil
+}
+
+// parseIngestListing decodes and validates one pushed listing. Unknown fields
+// are rejected so a misspelt one isn't silently dropped. The listing is
+// returned, if it decoded, even when invalid.
+func parseIngestListing(item json.RawMessage) (*domain.Listing, error) {
+	dec := json.NewDecoder(bytes.NewReader(item))
+	dec.DisallowUnknownFields()
+	var listing domain.Listing
+	if err := dec.Decode(&listing); err != nil {
+		return nil, fmt.Errorf("invalid listing: %w", err)
+	}
+	return &listing, listing.Validate()
+}
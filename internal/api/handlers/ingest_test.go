@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/repository"
+)
+
+// newIngestRouter returns a router serving Ingest backed by sqlmock
+func newIngestRouter(t *testing.T) (http.Handler, sqlmock.Sqlmock) {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+	db := sqlx.NewDb(mockDB, "postgres")
+	h := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+
+	router := chi.NewRouter()
+	router.Post("/api/v1/sources/{slug}/listings", h.Ingest)
+	return router, mock
+}
+
+func TestIngest(t *testing.T) {
+	router, mock := newIngestRouter(t)
+	sourceID := uuid.New()
+
+	mock.ExpectQuery(`SELECT \* FROM sources WHERE slug = \$1`).
+		WithArgs("partner").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "slug"}).AddRow(sourceID, "partner"))
+	mock.ExpectQuery(`SELECT external_id FROM listings WHERE source_id = \$1 AND external_id = ANY\(\$2\)`).
+		WithArgs(sourceID, `{"new","known"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"external_id"}).AddRow("known"))
+	mock.ExpectQuery(`INSERT INTO listings`).
+		WillReturnRows(sqlmock.NewRows([]string{"source_id", "external_id"}).
+			AddRow(sourceID, "new").
+			AddRow(sourceID, "known"))
+
+	body := `[
+		{"external_id": "new", "title": "Cafe", "url": "https://partner.example.com/1", "asking_price": 25000000},
+		{"external_id": "known", "title": "Bakery", "url": "https://partner.example.com/2"},
+		{"external_id": "untitled", "url": "https://partner.example.com/3"},
+		{"external_id": "typo", "title": "Gym", "url": "https://partner.example.com/4", "askingprice": 1},
+		{"external_id": "new", "title": "Cafe again", "url": "https://partner.example.com/1"}
+	]`
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/sources/partner/listings", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	var got struct {
+		Results  []ingestResult `json:"results"`
+		Created  int            `json:"created"`
+		Updated  int            `json:"updated"`
+		Rejected int            `json:"rejected"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Created != 1 || got.Updated != 1 || got.Rejected != 3 {
+		t.Errorf("created %d, updated %d, rejected %d; want 1, 1, 3", got.Created, got.Updated, got.Rejected)
+	}
+	want := []string{ingestCreated, ingestUpdated, ingestRejected, ingestRejected, ingestRejected}
+	for i, res := range got.Results {
+		if res.Index != i || res.Status != want[i] {
+			t.Errorf("result %d = %+v, want status %s", i, res, want[i])
+		}
+	}
+	if len(got.Results) == 5 && !strings.Contains(got.Results[2].Error, "title is required") {
+		t.Errorf("untitled listing error = %q", got.Results[2].Error)
+	}
+}
+
+func TestIngestSingleListing(t *testing.T) {
+	router, mock := newIngestRouter(t)
+	sourceID := uuid.New()
+
+	mock.ExpectQuery(`SELECT \* FROM sources WHERE slug = \$1`).
+		WithArgs("partner").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "slug"}).AddRow(sourceID, "partner"))
+	mock.ExpectQuery(`SELECT external_id FROM listings`).
+		WillReturnRows(sqlmock.NewRows([]string{"external_id"}))
+	mock.ExpectQuery(`INSERT INTO listings`).
+		WillReturnRows(sqlmock.NewRows([]string{"source_id", "external_id"}).AddRow(sourceID, "1"))
+
+	body := `{"external_id": "1", "title": "Cafe", "url": "https://partner.example.com/1"}`
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/sources/partner/listings", strings.NewReader(body)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"created":1`) {
+		t.Errorf("status = %d, body = %s; want 1 created", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIngestRejectsRequest(t *testing.T) {
+	tooMany := make([]string, maxIngestListings+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf(`{"external_id":"%d"}`, i)
+	}
+
+	tests := []struct {
+		name string
+		slug string
+		body string
+		want int
+	}{
+		{"unknown source", "nope", `{}`, http.StatusNotFound},
+		{"invalid json", "partner", `{`, http.StatusBadRequest},
+		{"empty batch", "partner", `[]`, http.StatusBadRequest},
+		{"too many listings", "partner", "[" + strings.Join(tooMany, ",") + "]", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newIngestRouter(t)
+			if tt.slug == "nope" {
+				mock.ExpectQuery(`SELECT \* FROM sources WHERE slug = \$1`).WillReturnError(sql.ErrNoRows)
+			} else {
+				mock.ExpectQuery(`SELECT \* FROM sources WHERE slug = \$1`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "slug"}).AddRow(uuid.New(), tt.slug))
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/sources/"+tt.slug+"/listings", strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
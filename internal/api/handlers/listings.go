@@ -1,38 +1,143 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
 
+	mw "github.com/kbsch/trough/internal/api/middleware"
 	"github.com/kbsch/trough/internal/domain"
 	"github.com/kbsch/trough/internal/repository"
 )
 
 type ListingHandler struct {
-	repo *repository.ListingRepository
+	repo    *repository.ListingRepository
+	sources *repository.SourceRepository
+
+	searchMaxAge time.Duration
+	scrapeWindow time.Duration
+
+	marketStats *marketStatsCache
+}
+
+func NewListingHandler(repo *repository.ListingRepository, sources *repository.SourceRepository) *ListingHandler {
+	return &ListingHandler{
+		repo:         repo,
+		sources:      sources,
+		scrapeWindow: domain.DefaultScrapeWindow,
+		marketStats:  newMarketStatsCache(marketStatsTTL),
+	}
 }
 
-func NewListingHandler(repo *repository.ListingRepository) *ListingHandler {
-	return &ListingHandler{repo: repo}
+// SetScrapeWindow sets the scrape window (SCRAPE_WINDOW) listings' staleness
+// is judged against
+func (h *ListingHandler) SetScrapeWindow(d time.Duration) {
+	h.scrapeWindow = d
 }
 
 func (h *ListingHandler) Search(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	h.search(w, r, parseSearchParams(r))
+}
+
+// SourceListings returns the active listings of the source named by slug,
+// taking the same search, pagination and sort parameters as Search
+func (h *ListingHandler) SourceListings(w http.ResponseWriter, r *http.Request) {
+	source, err := h.sources.GetBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			NotFound(w, r, "Source not found")
+			return
+		}
+		log.Printf("Get source error: %v", err)
+		InternalError(w, r, "Failed to fetch source")
+		return
+	}
+
 	params := parseSearchParams(r)
+	params.SourceID = &source.ID
+	h.search(w, r, params)
+}
 
-	result, err := h.repo.Search(ctx, params)
+func (h *ListingHandler) search(w http.ResponseWriter, r *http.Request, params domain.ListingSearchParams) {
+	result, ok := h.runSearch(w, r, params)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	for i := range result.Listings {
+		result.Listings[i].SetFreshness(now, h.scrapeWindow)
+	}
+
+	setPublicCache(w, h.searchMaxAge)
+	writeSearchResult(w, r, result)
+}
+
+// SearchHead answers HEAD with the headers Search would send, running only
+// the count
+func (h *ListingHandler) SearchHead(w http.ResponseWriter, r *http.Request) {
+	w = headWriter{w}
+	params := parseSearchParams(r)
+	params.PerPage = 0
+	params.Facets = nil
+	result, ok := h.runSearch(w, r, params)
+	if !ok {
+		return
+	}
+
+	setPublicCache(w, h.searchMaxAge)
+	setTotalCount(w, result.Total)
+	w.WriteHeader(http.StatusOK)
+}
+
+// runSearch runs the search, answering the request itself and returning false
+// if it fails
+func (h *ListingHandler) runSearch(w http.ResponseWriter, r *http.Request, params domain.ListingSearchParams) (*domain.ListingSearchResult, bool) {
+	result, err := h.repo.Search(r.Context(), params)
+	if errors.Is(err, repository.ErrInvalidSort) {
+		BadRequest(w, r, err.Error())
+		return nil, false
+	}
+	if QueryCanceled(w, r, err) {
+		return nil, false
+	}
 	if err != nil {
 		log.Printf("Search error: %v", err)
 		InternalError(w, r, "Failed to search listings")
-		return
+		return nil, false
 	}
+	return result, true
+}
 
-	JSON(w, http.StatusOK, result)
+// setTotalCount sets X-Total-Count, the number of listings a search matched
+func setTotalCount(w http.ResponseWriter, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+}
+
+// writeSearchResult writes search results; v2 moves pagination and facets into meta
+func writeSearchResult(w http.ResponseWriter, r *http.Request, result *domain.ListingSearchResult) {
+	setTotalCount(w, result.Total)
+	SuccessWithMeta(w, r, result.Listings, &Meta{
+		Total:      result.Total,
+		Page:       result.Page,
+		PerPage:    result.PerPage,
+		TotalPages: result.TotalPages,
+		Sort:       result.Sort,
+		Nulls:      result.Nulls,
+		Seed:       result.Seed,
+		Facets:     result.Facets,
+	}, result)
 }
 
 func (h *ListingHandler) GetByID(w http.ResponseWriter, r *http.Request) {
@@ -45,26 +150,320 @@ func (h *ListingHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	listing, err := h.repo.GetByID(ctx, id)
+	listing, err := h.repo.GetByIDWithOptions(ctx, id, includes(r, "source"))
+	if err != nil {
+		NotFound(w, r, "Listing not found")
+		return
+	}
+	if listingNotModified(w, r, listing) {
+		return
+	}
+	listing.BackOnMarket = listing.IsBackOnMarket(time.Now())
+	listing.SetFreshness(time.Now(), h.scrapeWindow)
+
+	// Locations and the requested sub-resources are fetched concurrently
+	detail := listingDetail{Listing: listing}
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		listing.Locations, err = h.repo.GetLocations(gctx, id)
+		return err
+	})
+	if includes(r, "price_history") {
+		g.Go(func() (err error) {
+			detail.PriceHistory, err = h.repo.GetPriceHistory(gctx, id)
+			return err
+		})
+	}
+	if includes(r, "similar") {
+		g.Go(func() (err error) {
+			detail.Similar, err = h.repo.Nearby(gctx, listing, defaultNearbyRadius, maxSimilarListings)
+			return err
+		})
+	}
+	if includes(r, "documents") {
+		g.Go(func() (err error) {
+			detail.Documents, err = h.repo.GetDocuments(gctx, id)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		log.Printf("Get listing detail error: %v", err)
+		InternalError(w, r, "Failed to fetch listing details")
+		return
+	}
+
+	Success(w, r, detail)
+}
+
+// GetByIDHead answers HEAD with the headers GetByID would send, checking only
+// that the listing exists
+func (h *ListingHandler) GetByIDHead(w http.ResponseWriter, r *http.Request) {
+	w = headWriter{w}
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, r, "Invalid listing ID format")
+		return
+	}
+
+	listing, err := h.repo.GetByIDWithOptions(r.Context(), id, false)
+	if err != nil {
+		NotFound(w, r, "Listing not found")
+		return
+	}
+	if listingNotModified(w, r, listing) {
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// maxSimilarListings caps the similar listings embedded with include=similar
+const maxSimilarListings = 6
+
+// listingDetail is the detail response: the listing plus the sub-resources
+// requested with include, each omitted when empty
+type listingDetail struct {
+	*domain.Listing
+	PriceHistory []domain.PriceChange     `json:"price_history,omitempty"`
+	Similar      []domain.NearbyListing   `json:"similar,omitempty"`
+	Documents    []domain.ListingDocument `json:"documents,omitempty"`
+}
+
+// Documents returns the downloadable documents linked from a listing's detail
+// page. Listings without any return an empty list.
+func (h *ListingHandler) Documents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, r, "Invalid listing ID format")
+		return
+	}
+
+	if _, err := h.repo.GetByID(ctx, id); err != nil {
+		NotFound(w, r, "Listing not found")
+		return
+	}
+
+	documents, err := h.repo.GetDocuments(ctx, id)
+	if err != nil {
+		log.Printf("Get listing documents error: %v", err)
+		InternalError(w, r, "Failed to fetch listing documents")
+		return
+	}
+
+	Success(w, r, map[string]interface{}{
+		"documents": documents,
+	})
+}
+
+// History returns a listing's timeline: price drops and increases, when it
+// went inactive or was relisted, and other changes to its tracked fields,
+// oldest first
+func (h *ListingHandler) History(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
+		BadRequest(w, r, "Invalid listing ID format")
+		return
+	}
+
+	if _, err := h.repo.GetByID(ctx, id); err != nil {
 		NotFound(w, r, "Listing not found")
 		return
 	}
 
-	Success(w, listing)
+	changes, err := h.repo.GetChanges(ctx, id)
+	if err != nil {
+		log.Printf("Get listing history error: %v", err)
+		InternalError(w, r, "Failed to fetch listing history")
+		return
+	}
+
+	Success(w, r, map[string]interface{}{
+		"changes": changes,
+	})
+}
+
+// maxBatchIDs caps how many listings a single batch request may fetch
+const maxBatchIDs = 100
+
+type batchRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// Batch fetches several listings in one request, in the order requested, so
+// compare and favorites views avoid a round trip per listing
+func (h *ListingHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		BadRequest(w, r, "Invalid request body")
+		return
+	}
+
+	ids, err := parseBatchIDs(req.IDs)
+	if err != nil {
+		BadRequest(w, r, err.Error())
+		return
+	}
+
+	listings, err := h.repo.GetByIDs(r.Context(), ids)
+	if err != nil {
+		log.Printf("Batch get listings error: %v", err)
+		InternalError(w, r, "Failed to fetch listings")
+		return
+	}
+
+	Success(w, r, orderBatch(ids, listings))
+}
+
+// parseBatchIDs validates the requested IDs, dropping repeats
+func parseBatchIDs(raw []string) ([]uuid.UUID, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("ids is required")
+	}
+	if len(raw) > maxBatchIDs {
+		return nil, fmt.Errorf("at most %d ids per request", maxBatchIDs)
+	}
+
+	seen := make(map[uuid.UUID]bool, len(raw))
+	ids := make([]uuid.UUID, 0, len(raw))
+	for _, s := range raw {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listing ID: %q", s)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// orderBatch arranges fetched listings in the requested order and collects
+// the IDs that weren't found
+func orderBatch(ids []uuid.UUID, listings []domain.Listing) domain.ListingBatchResult {
+	byID := make(map[uuid.UUID]domain.Listing, len(listings))
+	for _, l := range listings {
+		byID[l.ID] = l
+	}
+
+	result := domain.ListingBatchResult{
+		Listings: make([]domain.Listing, 0, len(listings)),
+		NotFound: []uuid.UUID{},
+	}
+	for _, id := range ids {
+		if l, ok := byID[id]; ok {
+			result.Listings = append(result.Listings, l)
+		} else {
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+	return result
+}
+
+// GetRaw returns the scraped raw data and source provenance for a listing (debug, authenticated)
+func (h *ListingHandler) GetRaw(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		BadRequest(w, r, "Invalid listing ID format")
+		return
+	}
+
+	raw, err := h.repo.GetRawByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			NotFound(w, r, "Listing not found")
+			return
+		}
+		log.Printf("Get raw listing error: %v", err)
+		InternalError(w, r, "Failed to fetch listing raw data")
+		return
+	}
+
+	Success(w, r, raw)
+}
+
+// Hide hides a listing from search and detail responses (authenticated)
+func (h *ListingHandler) Hide(w http.ResponseWriter, r *http.Request) {
+	h.setHidden(w, r, true)
+}
+
+// Unhide restores a previously hidden listing (authenticated)
+func (h *ListingHandler) Unhide(w http.ResponseWriter, r *http.Request) {
+	h.setHidden(w, r, false)
+}
+
+func (h *ListingHandler) setHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		BadRequest(w, r, "Invalid listing ID format")
+		return
+	}
+
+	if err := h.repo.SetHidden(ctx, id, hidden); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			NotFound(w, r, "Listing not found")
+			return
+		}
+		log.Printf("Set hidden error: %v", err)
+		InternalError(w, r, "Failed to update listing")
+		return
+	}
+
+	Success(w, r, map[string]interface{}{
+		"id":     id,
+		"hidden": hidden,
+	})
 }
 
 func (h *ListingHandler) MapView(w http.ResponseWriter, r *http.Request) {
+	markers, ok := h.mapMarkers(w, r)
+	if !ok {
+		return
+	}
+	writeMapMarkers(w, r, markers)
+}
+
+// MapGeoJSON returns the MapView markers as a GeoJSON FeatureCollection of
+// points, which map libraries can use as a source directly
+func (h *ListingHandler) MapGeoJSON(w http.ResponseWriter, r *http.Request) {
+	markers, ok := h.mapMarkers(w, r)
+	if !ok {
+		return
+	}
+	writeMapGeoJSON(w, markers)
+}
+
+// mapMarkers searches with the request's filters and returns a marker for each
+// geocoded location of the results. On failure it writes the error response
+// and reports false.
+func (h *ListingHandler) mapMarkers(w http.ResponseWriter, r *http.Request) ([]MapMarker, bool) {
 	ctx := r.Context()
 	params := parseSearchParams(r)
 
-	// For map view, we want more results but less data per result
-	params.PerPage = 1000
+	// For map view, we want more results but less data per result: as many
+	// as SEARCH_MAX_ROWS allows
+	params.PerPage = h.repo.MaxRows()
 
 	result, err := h.repo.Search(ctx, params)
+	if errors.Is(err, repository.ErrInvalidSort) {
+		BadRequest(w, r, err.Error())
+		return nil, false
+	}
+	if QueryCanceled(w, r, err) {
+		return nil, false
+	}
 	if err != nil {
 		InternalError(w, r, "Failed to fetch map data")
-		return
+		return nil, false
 	}
 
 	// Transform to map markers (lighter weight)
@@ -90,14 +489,221 @@ func (h *ListingHandler) MapView(w http.ResponseWriter, r *http.Request) {
 			markers = append(markers, marker)
 		}
 	}
+	markers = append(markers, h.secondaryMarkers(r, result.Listings)...)
+	return markers, true
+}
+
+// mapFlushEvery is how many markers writeMapMarkers writes between flushes
+const mapFlushEvery = 100
+
+var jsonComma = []byte(",")
+
+// writeMapMarkers writes map markers; v2 moves the total and bounds into meta.
+// Markers are encoded one at a time and flushed as they go rather than
+// buffering the whole body, so the total and bounds come before the array.
+func writeMapMarkers(w http.ResponseWriter, r *http.Request, markers []MapMarker) {
+	bounds := calculateBounds(markers)
+
+	var head string
+	if mw.ResponseVersion(r.Context()) < 2 {
+		boundsJSON, err := json.Marshal(bounds)
+		if err != nil {
+			InternalError(w, r, "Failed to encode map data")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		head = fmt.Sprintf(`{"total":%d,"bounds":%s,"markers":[`, len(markers), boundsJSON)
+	} else {
+		metaJSON, err := json.Marshal(&Meta{Total: len(markers), Bounds: bounds})
+		if err != nil {
+			InternalError(w, r, "Failed to encode map data")
+			return
+		}
+		w.Header().Set("Content-Type", mw.MediaTypeV2)
+		head = fmt.Sprintf(`{"meta":%s,"data":[`, metaJSON)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, head)
+	flusher := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	for i := range markers {
+		if i > 0 {
+			w.Write(jsonComma)
+		}
+		if err := enc.Encode(&markers[i]); err != nil {
+			// The client went away; the status is already sent
+			return
+		}
+		if (i+1)%mapFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+	io.WriteString(w, "]}\n")
+}
+
+// MediaTypeGeoJSON is the content type of GeoJSON responses
+const MediaTypeGeoJSON = "application/geo+json"
+
+// geoJSONFeature is a map marker as a GeoJSON Point feature. Coordinates are
+// [longitude, latitude], per RFC 7946.
+type geoJSONFeature struct {
+	Type     string      `json:"type"`
+	Geometry geoJSONGeom `json:"geometry"`
+	// Properties are the marker without its coordinates
+	Properties mapMarkerProperties `json:"properties"`
+}
+
+type geoJSONGeom struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type mapMarkerProperties struct {
+	ID          uuid.UUID `json:"id"`
+	Title       string    `json:"title"`
+	AskingPrice *int64    `json:"asking_price,omitempty"`
+	Industry    string    `json:"industry,omitempty"`
+	City        string    `json:"city,omitempty"`
+	State       string    `json:"state,omitempty"`
+	Secondary   bool      `json:"secondary,omitempty"`
+}
+
+// writeMapGeoJSON writes markers as a GeoJSON FeatureCollection, streamed like
+// writeMapMarkers. The format is the same in every API version.
+func writeMapGeoJSON(w http.ResponseWriter, markers []MapMarker) {
+	w.Header().Set("Content-Type", MediaTypeGeoJSON)
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, `{"type":"FeatureCollection","features":[`)
+	flusher := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	for i, m := range markers {
+		if i > 0 {
+			w.Write(jsonComma)
+		}
+		feature := geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONGeom{Type: "Point", Coordinates: [2]float64{m.Lng, m.Lat}},
+			Properties: mapMarkerProperties{
+				ID:          m.ID,
+				Title:       m.Title,
+				AskingPrice: m.AskingPrice,
+				Industry:    m.Industry,
+				City:        m.City,
+				State:       m.State,
+				Secondary:   m.Secondary,
+			},
+		}
+		if err := enc.Encode(&feature); err != nil {
+			// The client went away; the status is already sent
+			return
+		}
+		if (i+1)%mapFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+	io.WriteString(w, "]}\n")
+}
+
+// secondaryMarkers returns a marker for each geocoded non-primary location of
+// multi-location listings. Failures only drop the extra markers.
+func (h *ListingHandler) secondaryMarkers(r *http.Request, listings []domain.Listing) []MapMarker {
+	ids := make([]uuid.UUID, len(listings))
+	for i, l := range listings {
+		ids[i] = l.ID
+	}
 
-	Success(w, map[string]interface{}{
-		"markers": markers,
-		"total":   len(markers),
-		"bounds":  calculateBounds(markers),
+	locations, err := h.repo.GetLocationsForListings(r.Context(), ids)
+	if err != nil {
+		log.Printf("Map locations error: %v", err)
+		return nil
+	}
+
+	var markers []MapMarker
+	for _, l := range listings {
+		for _, loc := range locations[l.ID] {
+			if loc.IsPrimary || loc.Lat == nil || loc.Lng == nil {
+				continue
+			}
+			marker := MapMarker{
+				ID:          l.ID,
+				Lat:         *loc.Lat,
+				Lng:         *loc.Lng,
+				Title:       l.Title,
+				AskingPrice: l.AskingPrice,
+				Secondary:   true,
+			}
+			if l.Industry != nil {
+				marker.Industry = *l.Industry
+			}
+			if loc.City != nil {
+				marker.City = *loc.City
+			}
+			if loc.State != nil {
+				marker.State = *loc.State
+			}
+			markers = append(markers, marker)
+		}
+	}
+	return markers
+}
+
+const (
+	// defaultNearbyRadius and maxNearbyRadius bound the nearby search, in miles
+	defaultNearbyRadius = 25.0
+	maxNearbyRadius     = 250.0
+	// maxNearbyListings caps how many nearby listings are returned
+	maxNearbyListings = 20
+)
+
+// Nearby returns active listings closest to the given one, or in the same city
+// when it has no coordinates
+func (h *ListingHandler) Nearby(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, r, "Invalid listing ID format")
+		return
+	}
+
+	radius, err := parseNearbyRadius(r.URL.Query().Get("radius"))
+	if err != nil {
+		BadRequest(w, r, err.Error())
+		return
+	}
+
+	listing, err := h.repo.GetByID(ctx, id)
+	if err != nil {
+		NotFound(w, r, "Listing not found")
+		return
+	}
+
+	nearby, err := h.repo.Nearby(ctx, listing, radius, maxNearbyListings)
+	if err != nil {
+		log.Printf("Nearby listings error: %v", err)
+		InternalError(w, r, "Failed to fetch nearby listings")
+		return
+	}
+
+	Success(w, r, map[string]interface{}{
+		"listings":     nearby,
+		"radius_miles": radius,
 	})
 }
 
+// parseNearbyRadius parses the optional radius param in miles
+func parseNearbyRadius(raw string) (float64, error) {
+	if raw == "" {
+		return defaultNearbyRadius, nil
+	}
+	radius, err := strconv.ParseFloat(raw, 64)
+	if err != nil || radius <= 0 || radius > maxNearbyRadius {
+		return 0, fmt.Errorf("radius must be a number of miles between 0 and %g", maxNearbyRadius)
+	}
+	return radius, nil
+}
+
 func (h *ListingHandler) GetFilters(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -107,7 +713,7 @@ func (h *ListingHandler) GetFilters(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	Success(w, filters)
+	Success(w, r, filters)
 }
 
 type MapMarker struct {
@@ -119,6 +725,8 @@ type MapMarker struct {
 	Industry    string    `json:"industry,omitempty"`
 	City        string    `json:"city,omitempty"`
 	State       string    `json:"state,omitempty"`
+	// Secondary marks an additional location of a multi-location listing
+	Secondary bool `json:"secondary,omitempty"`
 }
 
 type MapBounds struct {
@@ -158,14 +766,33 @@ func calculateBounds(markers []MapMarker) *MapBounds {
 	return bounds
 }
 
+// includes reports whether the comma-separated include param requests the given expansion
+func includes(r *http.Request, name string) bool {
+	for _, v := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if strings.TrimSpace(v) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPerPage and maxPerPage bound the per_page search param
+const (
+	defaultPerPage = 24
+	maxPerPage     = 100
+)
+
 func parseSearchParams(r *http.Request) domain.ListingSearchParams {
 	q := r.URL.Query()
 
 	params := domain.ListingSearchParams{
-		Query:   q.Get("q"),
-		Sort:    q.Get("sort"),
-		Page:    1,
-		PerPage: 24,
+		Query:         q.Get("q"),
+		Sort:          q.Get("sort"),
+		Nulls:         q.Get("nulls"),
+		Seed:          q.Get("seed"),
+		IncludeSource: includes(r, "source"),
+		Page:          1,
+		PerPage:       defaultPerPage,
 	}
 
 	if v := q.Get("page"); v != "" {
@@ -174,11 +801,15 @@ func parseSearchParams(r *http.Request) domain.ListingSearchParams {
 		}
 	}
 
+	// per_page=0 (or count_only=true) returns just the total
 	if v := q.Get("per_page"); v != "" {
-		if p, err := strconv.Atoi(v); err == nil && p > 0 && p <= 100 {
+		if p, err := strconv.Atoi(v); err == nil && p >= 0 && p <= maxPerPage {
 			params.PerPage = p
 		}
 	}
+	if q.Get("count_only") == "true" {
+		params.PerPage = 0
+	}
 
 	if v := q.Get("price_min"); v != "" {
 		if p, err := strconv.ParseInt(v, 10, 64); err == nil {
@@ -204,6 +835,12 @@ func parseSearchParams(r *http.Request) domain.ListingSearchParams {
 		}
 	}
 
+	if v := q.Get("min_score"); v != "" {
+		if p, err := strconv.Atoi(v); err == nil && p >= 0 && p <= 100 {
+			params.MinScore = &p
+		}
+	}
+
 	if v := q.Get("state"); v != "" {
 		params.States = strings.Split(v, ",")
 	}
@@ -212,6 +849,33 @@ func parseSearchParams(r *http.Request) domain.ListingSearchParams {
 		params.Industries = strings.Split(v, ",")
 	}
 
+	if v := q.Get("business_type"); v != "" {
+		params.BusinessTypes = strings.Split(v, ",")
+	}
+
+	if v := q.Get("category"); v != "" {
+		params.Categories = strings.Split(v, ",")
+	}
+
+	// tags=home-based,seller-financing matches listings with any of the tags;
+	// tags_match=all those with every one
+	if v := q.Get("tags"); v != "" {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+				params.Tags = append(params.Tags, tag)
+			}
+		}
+		params.TagsMatchAll = q.Get("tags_match") == "all"
+	}
+
+	if v := q.Get("facets"); v != "" {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				params.Facets = append(params.Facets, f)
+			}
+		}
+	}
+
 	if v := q.Get("franchise"); v != "" {
 		b := v == "true"
 		params.Franchise = &b
@@ -222,6 +886,21 @@ func parseSearchParams(r *http.Request) domain.ListingSearchParams {
 		params.RealEstate = &b
 	}
 
+	if v := q.Get("price_on_request"); v != "" {
+		b := v == "true"
+		params.PriceOnRequest = &b
+	}
+
+	if v := q.Get("featured_only"); v != "" {
+		b := v == "true"
+		params.FeaturedOnly = &b
+	}
+
+	if v := q.Get("relisted"); v != "" {
+		b := v == "true"
+		params.Relisted = &b
+	}
+
 	if v := q.Get("bounds"); v != "" {
 		parts := strings.Split(v, ",")
 		if len(parts) == 4 {
@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+)
+
+func TestParseSearchParamsInclude(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"/api/v1/listings", false},
+		{"/api/v1/listings?include=source", true},
+		{"/api/v1/listings?include=foo,source", true},
+		{"/api/v1/listings?include=sources", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.query, nil)
+		if got := parseSearchParams(r).IncludeSource; got != tt.want {
+			t.Errorf("%s: IncludeSource = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchParamsFacets(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1/listings?q=restaurant&facets=state,%20industry,,", nil)
+	got := parseSearchParams(r).Facets
+	if len(got) != 2 || got[0] != "state" || got[1] != "industry" {
+		t.Errorf("Facets = %v, want [state industry]", got)
+	}
+
+	r = httptest.NewRequest("GET", "/api/v1/listings", nil)
+	if got := parseSearchParams(r).Facets; got != nil {
+		t.Errorf("Facets = %v, want nil", got)
+	}
+}
+
+func TestParseSearchParamsBusinessTypeAndCategory(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1/listings?business_type=Asset%20Sale,Stock%20Sale&category=Food", nil)
+	got := parseSearchParams(r)
+
+	if len(got.BusinessTypes) != 2 || got.BusinessTypes[0] != "Asset Sale" || got.BusinessTypes[1] != "Stock Sale" {
+		t.Errorf("BusinessTypes = %v, want [Asset Sale Stock Sale]", got.BusinessTypes)
+	}
+	if len(got.Categories) != 1 || got.Categories[0] != "Food" {
+		t.Errorf("Categories = %v, want [Food]", got.Categories)
+	}
+}
+
+func TestParseSearchParamsFeaturedOnly(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *bool
+	}{
+		{"/api/v1/listings", nil},
+		{"/api/v1/listings?featured_only=true", domain.BoolPtr(true)},
+		{"/api/v1/listings?featured_only=false", domain.BoolPtr(false)},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.query, nil)
+		got := parseSearchParams(r).FeaturedOnly
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%s: FeaturedOnly = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchParamsRelisted(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *bool
+	}{
+		{"/api/v1/listings", nil},
+		{"/api/v1/listings?relisted=true", domain.BoolPtr(true)},
+		{"/api/v1/listings?relisted=false", domain.BoolPtr(false)},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.query, nil)
+		got := parseSearchParams(r).Relisted
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%s: Relisted = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchParamsPriceOnRequest(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *bool
+	}{
+		{"/api/v1/listings", nil},
+		{"/api/v1/listings?price_on_request=true", domain.BoolPtr(true)},
+		{"/api/v1/listings?price_on_request=false", domain.BoolPtr(false)},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.query, nil)
+		got := parseSearchParams(r).PriceOnRequest
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%s: PriceOnRequest = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchParamsMinScore(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *int
+	}{
+		{"/api/v1/listings", nil},
+		{"/api/v1/listings?min_score=60", domain.Ptr(60)},
+		{"/api/v1/listings?min_score=0", domain.Ptr(0)},
+		{"/api/v1/listings?min_score=101", nil},
+		{"/api/v1/listings?min_score=-5", nil},
+		{"/api/v1/listings?min_score=high", nil},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.query, nil)
+		got := parseSearchParams(r).MinScore
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%s: MinScore = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchParamsSortNulls(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/listings?sort=price_asc&nulls=first", nil)
+	params := parseSearchParams(req)
+	if params.Sort != "price_asc" || params.Nulls != "first" {
+		t.Errorf("sort = %q, nulls = %q; want price_asc, first", params.Sort, params.Nulls)
+	}
+}
+
+func TestParseSearchParamsCountOnly(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"/api/v1/listings", 24},
+		{"/api/v1/listings?per_page=50", 50},
+		{"/api/v1/listings?per_page=0", 0},
+		{"/api/v1/listings?per_page=-1", 24},
+		{"/api/v1/listings?per_page=500", 24},
+		{"/api/v1/listings?per_page=100000", 24},
+		{"/api/v1/listings?per_page=50&count_only=true", 0},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.query, nil)
+		if got := parseSearchParams(r).PerPage; got != tt.want {
+			t.Errorf("%s: PerPage = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseBatchIDs(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	tooMany := make([]string, maxBatchIDs+1)
+	for i := range tooMany {
+		tooMany[i] = uuid.NewString()
+	}
+
+	tests := []struct {
+		name    string
+		raw     []string
+		want    []uuid.UUID
+		wantErr bool
+	}{
+		{"ordered", []string{b.String(), a.String()}, []uuid.UUID{b, a}, false},
+		{"repeats dropped", []string{a.String(), b.String(), a.String()}, []uuid.UUID{a, b}, false},
+		{"empty", nil, nil, true},
+		{"invalid", []string{a.String(), "not-a-uuid"}, nil, true},
+		{"over the cap", tooMany, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBatchIDs(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderBatch(t *testing.T) {
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+
+	// The repository returns rows in no particular order and skips c
+	got := orderBatch([]uuid.UUID{c, b, a}, []domain.Listing{{ID: a}, {ID: b}})
+
+	if len(got.Listings) != 2 || got.Listings[0].ID != b || got.Listings[1].ID != a {
+		t.Errorf("listings = %v, want [%s %s]", got.Listings, b, a)
+	}
+	if len(got.NotFound) != 1 || got.NotFound[0] != c {
+		t.Errorf("not_found = %v, want [%s]", got.NotFound, c)
+	}
+
+	empty := orderBatch([]uuid.UUID{a}, []domain.Listing{{ID: a}})
+	if empty.NotFound == nil {
+		t.Error("not_found is nil, want an empty array in JSON")
+	}
+}
+
+func TestParseNearbyRadius(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    float64
+		wantErr bool
+	}{
+		{"", defaultNearbyRadius, false},
+		{"10", 10, false},
+		{"2.5", 2.5, false},
+		{"250", 250, false},
+		{"0", 0, true},
+		{"-5", 0, true},
+		{"251", 0, true},
+		{"far", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseNearbyRadius(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseNearbyRadius(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseNearbyRadius(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestSourceListings(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	h := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+
+	router := chi.NewRouter()
+	router.Get("/api/v1/sources/{slug}/listings", h.SourceListings)
+
+	// Unknown slug
+	mock.ExpectQuery(`SELECT \* FROM sources WHERE slug = \$1`).
+		WithArgs("nope").
+		WillReturnError(sql.ErrNoRows)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/sources/nope/listings", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown slug: status = %d, want 404", rec.Code)
+	}
+
+	// Known slug: the search is limited to the source's ID
+	sourceID := uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM sources WHERE slug = \$1`).
+		WithArgs("bizbuysell").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "slug"}).AddRow(sourceID, "bizbuysell"))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l WHERE l.is_active = true AND l.hidden = false AND l.source_id = \$1`).
+		WithArgs(sourceID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/sources/bizbuysell/listings?count_only=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Total int `json:"total"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Total != 7 {
+		t.Errorf("total = %d, want 7", body.Total)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetByIDIncludes(t *testing.T) {
+	id := uuid.New()
+	price := int64(50000000)
+
+	tests := []struct {
+		name    string
+		include string
+		// empty makes every sub-resource query return no rows
+		empty bool
+		want  []string // keys of the included sub-resources in the response
+	}{
+		{"bare listing", "", false, nil},
+		{"price history", "price_history", false, []string{"price_history"}},
+		{"similar", "similar", false, []string{"similar"}},
+		{"documents", "documents", false, []string{"documents"}},
+		{"source", "source", false, []string{"source"}},
+		{"all", "price_history,similar,source,documents", false, []string{"price_history", "similar", "source", "documents"}},
+		{"all empty", "price_history,similar,documents", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+			// The sub-resources are fetched concurrently
+			mock.MatchExpectationsInOrder(false)
+			db := sqlx.NewDb(mockDB, "postgres")
+			h := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+
+			included := func(name string) bool { return slices.Contains(strings.Split(tt.include, ","), name) }
+			rows := func(columns []string, values ...driver.Value) *sqlmock.Rows {
+				r := sqlmock.NewRows(columns)
+				if !tt.empty {
+					r.AddRow(values...)
+				}
+				return r
+			}
+
+			columns := []string{"id", "title", "city", "state", "is_active"}
+			values := []driver.Value{id, "Coffee Shop", "Austin", "TX", true}
+			if included("source") {
+				columns, values = append(columns, "source.slug"), append(values, "bizbuysell")
+			}
+			mock.ExpectQuery(`FROM listings l`).WithArgs(id).
+				WillReturnRows(sqlmock.NewRows(columns).AddRow(values...))
+			mock.ExpectQuery(`FROM listing_locations`).WithArgs(id).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "is_primary"}))
+			if included("price_history") {
+				mock.ExpectQuery(`FROM listing_price_history`).WithArgs(id).
+					WillReturnRows(rows([]string{"asking_price", "recorded_at"}, price, time.Now()))
+			}
+			if included("similar") {
+				mock.ExpectQuery(`lower\(l.city\) = lower\(\$2\)`).WithArgs(id, "Austin", "TX", maxSimilarListings).
+					WillReturnRows(rows([]string{"id", "title"}, uuid.New(), "Bakery"))
+			}
+			if included("documents") {
+				mock.ExpectQuery(`FROM listing_documents`).WithArgs(id).
+					WillReturnRows(rows([]string{"id", "type", "url"}, uuid.New(), domain.DocumentTypeCIM, "https://example.com/cim.pdf"))
+			}
+
+			router := chi.NewRouter()
+			router.Get("/api/v1/listings/{id}", h.GetByID)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/listings/"+id.String()+"?include="+tt.include, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+
+			var body map[string]any
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body["id"] != id.String() || body["title"] != "Coffee Shop" {
+				t.Errorf("body = %v, want the listing", body)
+			}
+			for _, key := range []string{"price_history", "similar", "source", "documents"} {
+				if _, got := body[key]; got != slices.Contains(tt.want, key) {
+					t.Errorf("%s in response = %v, want %v", key, got, !got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSearchParamsTags(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1/listings?tags=Home-Based,%20seller-financing,,", nil)
+	got := parseSearchParams(r)
+	if len(got.Tags) != 2 || got.Tags[0] != "home-based" || got.Tags[1] != "seller-financing" {
+		t.Errorf("Tags = %v, want [home-based seller-financing]", got.Tags)
+	}
+	if got.TagsMatchAll {
+		t.Error("TagsMatchAll set without tags_match=all")
+	}
+
+	r = httptest.NewRequest("GET", "/api/v1/listings?tags=turnkey&tags_match=all", nil)
+	if got := parseSearchParams(r); !got.TagsMatchAll {
+		t.Error("TagsMatchAll not set by tags_match=all")
+	}
+}
+
+func TestQueriesCanceled(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	h := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+		want int
+	}{
+		{"client gone", canceled, StatusClientClosedRequest},
+		{"timed out", expired, http.StatusServiceUnavailable},
+	} {
+		for path, handler := range map[string]http.HandlerFunc{
+			"/api/v1/listings":                    h.Search,
+			"/api/v1/market/stats?group_by=state": h.MarketStats,
+			"/api/v1/admin/data-quality/export":   h.DataQualityExport,
+		} {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, path, nil).WithContext(tt.ctx))
+			if rec.Code != tt.want {
+				t.Errorf("%s %s: status = %d, want %d", tt.name, path, rec.Code, tt.want)
+			}
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMapViewUsesConfiguredMaxRows(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	repo := repository.NewListingRepository(db)
+	repo.SetMaxRows(2500)
+	h := NewListingHandler(repo, repository.NewSourceRepository(db))
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`LIMIT \$1 OFFSET \$2`).
+		WithArgs(2500, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	rec := httptest.NewRecorder()
+	h.MapView(rec, httptest.NewRequest(http.MethodGet, "/api/v1/listings/map", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+
+	mw "github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func testMarkers(n int) []MapMarker {
+	markers := make([]MapMarker, n)
+	for i := range markers {
+		markers[i] = MapMarker{
+			ID:       uuid.New(),
+			Lat:      30 + float64(i)/1000,
+			Lng:      -97 - float64(i)/1000,
+			Title:    "Listing",
+			Industry: "Restaurants",
+			City:     "Austin",
+			State:    "TX",
+		}
+	}
+	return markers
+}
+
+func TestWriteMapMarkersStreams(t *testing.T) {
+	markers := testMarkers(250)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		writeMapMarkers(w, r, markers)
+	}
+
+	rec, v1 := serveVersion(t, 1, handler)
+	if !rec.Flushed {
+		t.Error("markers were not flushed while streaming")
+	}
+	if got, _ := v1["markers"].([]any); len(got) != 250 || v1["total"] != float64(250) {
+		t.Errorf("v1 has %d markers, total %v; want 250", len(got), v1["total"])
+	}
+	bounds, _ := v1["bounds"].(map[string]any)
+	if bounds["north"] != 30.249 || bounds["west"] != -97.249 {
+		t.Errorf("v1 bounds = %v", bounds)
+	}
+
+	_, v2 := serveVersion(t, 2, handler)
+	if got, _ := v2["data"].([]any); len(got) != 250 {
+		t.Errorf("v2 has %d markers, want 250", len(got))
+	}
+}
+
+func TestWriteMapMarkersGzip(t *testing.T) {
+	handler := middleware.Compress(5, "application/json", mw.MediaTypeV2)(
+		mw.APIVersion(2)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeMapMarkers(w, r, testMarkers(250))
+		})),
+	)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", enc)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body APIResponse
+	if err := json.NewDecoder(zr).Decode(&body); err != nil {
+		t.Fatalf("decode gzipped body: %v", err)
+	}
+	if body.Meta == nil || body.Meta.Total != 250 {
+		t.Errorf("meta = %+v, want total 250", body.Meta)
+	}
+}
+
+func TestWriteMapGeoJSON(t *testing.T) {
+	markers := testMarkers(150)
+	markers[1].AskingPrice = domain.Ptr(int64(250_000_00))
+	markers[2].Secondary = true
+
+	rec := httptest.NewRecorder()
+	writeMapGeoJSON(rec, markers)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/geo+json" {
+		t.Errorf("Content-Type = %q, want application/geo+json", ct)
+	}
+	if !rec.Flushed {
+		t.Error("features were not flushed while streaming")
+	}
+
+	var body struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Type     string `json:"type"`
+			Geometry struct {
+				Type        string    `json:"type"`
+				Coordinates []float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Type != "FeatureCollection" || len(body.Features) != 150 {
+		t.Fatalf("type = %q with %d features, want FeatureCollection with 150", body.Type, len(body.Features))
+	}
+
+	f := body.Features[1]
+	if f.Type != "Feature" || f.Geometry.Type != "Point" {
+		t.Errorf("feature type = %q, geometry type = %q; want Feature, Point", f.Type, f.Geometry.Type)
+	}
+	// GeoJSON puts longitude first
+	if len(f.Geometry.Coordinates) != 2 || f.Geometry.Coordinates[0] != markers[1].Lng || f.Geometry.Coordinates[1] != markers[1].Lat {
+		t.Errorf("coordinates = %v, want [%v %v]", f.Geometry.Coordinates, markers[1].Lng, markers[1].Lat)
+	}
+	if f.Properties["id"] != markers[1].ID.String() || f.Properties["title"] != "Listing" ||
+		f.Properties["asking_price"] != float64(250_000_00) || f.Properties["industry"] != "Restaurants" {
+		t.Errorf("properties = %v", f.Properties)
+	}
+	if _, ok := f.Properties["lat"]; ok {
+		t.Error("properties repeat the coordinates")
+	}
+	if body.Features[2].Properties["secondary"] != true {
+		t.Errorf("secondary location properties = %v, want secondary", body.Features[2].Properties)
+	}
+}
+
+func TestWriteMapGeoJSONEmpty(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeMapGeoJSON(rec, nil)
+
+	if got := rec.Body.String(); got != `{"type":"FeatureCollection","features":[]}`+"\n" {
+		t.Errorf("body = %q, want an empty FeatureCollection", got)
+	}
+}
+
+// discardWriter is a ResponseWriter that drops the body, keeping only the
+// largest single write: how much of the body the handler built up at once
+type discardWriter struct {
+	header   http.Header
+	maxWrite int
+}
+
+func (w *discardWriter) Header() http.Header { return w.header }
+func (w *discardWriter) WriteHeader(int)     {}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	w.maxWrite = max(w.maxWrite, len(b))
+	return len(b), nil
+}
+
+// BenchmarkMapMarkers compares encoding 1000 markers as one buffered value
+// with writeMapMarkers' streaming. max-write-B is the largest chunk of body
+// held before writing.
+func BenchmarkMapMarkers(b *testing.B) {
+	markers := testMarkers(1000)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		w := &discardWriter{header: http.Header{}}
+		for i := 0; i < b.N; i++ {
+			bounds := calculateBounds(markers)
+			SuccessWithMeta(w, req, markers, &Meta{Total: len(markers), Bounds: bounds},
+				map[string]interface{}{"markers": markers, "total": len(markers), "bounds": bounds})
+		}
+		b.ReportMetric(float64(w.maxWrite), "max-write-B")
+	})
+	b.Run("streamed", func(b *testing.B) {
+		b.ReportAllocs()
+		w := &discardWriter{header: http.Header{}}
+		for i := 0; i < b.N; i++ {
+			writeMapMarkers(w, req, markers)
+		}
+		b.ReportMetric(float64(w.maxWrite), "max-write-B")
+	})
+}
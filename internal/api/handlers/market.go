@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+)
+
+// marketStatsTTL is how long market stats are reused, by the server and by
+// clients: the percentiles scan every matching listing, and the market
+// doesn't move in minutes
+const marketStatsTTL = 5 * time.Minute
+
+// marketStatsCacheSize bounds how many filter combinations are cached
+const marketStatsCacheSize = 256
+
+// MarketStats returns asking price statistics for the active listings
+// matching the search filters, per combination of ?group_by= fields
+// (industry, state, category, business_type), e.g. the median asking price of
+// restaurants in TX
+func (h *ListingHandler) MarketStats(w http.ResponseWriter, r *http.Request) {
+	var groupBy []string
+	if v := r.URL.Query().Get("group_by"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				groupBy = append(groupBy, field)
+			}
+		}
+	}
+
+	// Query().Encode sorts the parameters, so the same filters share an entry
+	key := r.URL.Query().Encode()
+	stats, ok := h.marketStats.get(key, time.Now())
+	if !ok {
+		var err error
+		stats, err = h.repo.MarketStats(r.Context(), parseSearchParams(r), groupBy)
+		if errors.Is(err, repository.ErrInvalidGroupBy) {
+			BadRequest(w, r, err.Error())
+			return
+		}
+		if QueryCanceled(w, r, err) {
+			return
+		}
+		if err != nil {
+			log.Printf("Market stats error: %v", err)
+			InternalError(w, r, "Failed to compute market stats")
+			return
+		}
+		h.marketStats.set(key, stats, time.Now())
+	}
+
+	setPublicCache(w, marketStatsTTL)
+	Success(w, r, map[string]interface{}{
+		"group_by":     groupBy,
+		"min_listings": domain.MarketStatsMinListings,
+		"stats":        stats,
+	})
+}
+
+// marketStatsCache keeps computed market stats for ttl, per query
+type marketStatsCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]marketStatsEntry
+}
+
+type marketStatsEntry struct {
+	stats   []domain.MarketStat
+	expires time.Time
+}
+
+func newMarketStatsCache(ttl time.Duration) *marketStatsCache {
+	return &marketStatsCache{ttl: ttl, entries: make(map[string]marketStatsEntry)}
+}
+
+func (c *marketStatsCache) get(key string, now time.Time) ([]domain.MarketStat, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		return nil, false
+	}
+	return entry.stats, true
+}
+
+// set stores stats for key. A full cache first drops expired entries, and
+// everything if none had expired.
+func (c *marketStatsCache) set(key string, stats []domain.MarketStat, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= marketStatsCacheSize {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= marketStatsCacheSize {
+			clear(c.entries)
+		}
+	}
+	c.entries[key] = marketStatsEntry{stats: stats, expires: now.Add(c.ttl)}
+}
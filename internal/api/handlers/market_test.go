@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+)
+
+func TestMarketStats(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	h := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.MarketStats(rec, httptest.NewRequest("GET", "/api/v1/market-stats"+query, nil))
+		return rec
+	}
+
+	if rec := get("?group_by=city"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown group_by: status = %d, want 400", rec.Code)
+	}
+
+	// Computed once; the same filters in another order come from the cache
+	mock.ExpectQuery(`SELECT l.industry, l.state, COUNT\(\*\)`).
+		WithArgs("TX").
+		WillReturnRows(sqlmock.NewRows([]string{"industry", "state", "count", "p", "a", "pn", "c", "cn", "m", "mn"}).
+			AddRow("Restaurants", "TX", 12, 30000000.0, 35000000.0, 12, 8000000.0, 12, 0.8, 12))
+	for _, query := range []string{"?group_by=industry,state&state=TX", "?state=TX&group_by=industry,state"} {
+		rec := get(query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200: %s", query, rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "public, max-age=300" {
+			t.Errorf("Cache-Control = %q, want public, max-age=300", got)
+		}
+		var body struct {
+			GroupBy     []string            `json:"group_by"`
+			MinListings int                 `json:"min_listings"`
+			Stats       []domain.MarketStat `json:"stats"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Stats) != 1 || body.Stats[0].Count != 12 || *body.Stats[0].Group["state"] != "TX" || body.MinListings != 5 {
+			t.Errorf("%s: body = %+v", query, body)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMarketStatsCacheExpiry(t *testing.T) {
+	c := newMarketStatsCache(time.Minute)
+	now := time.Now()
+	c.set("state=TX", []domain.MarketStat{{Count: 3}}, now)
+
+	if stats, ok := c.get("state=TX", now.Add(59*time.Second)); !ok || stats[0].Count != 3 {
+		t.Errorf("get before expiry = %v, %v", stats, ok)
+	}
+	if _, ok := c.get("state=TX", now.Add(time.Minute)); ok {
+		t.Error("entry served after its TTL")
+	}
+
+	// A full cache makes room for new entries
+	for i := 0; i < marketStatsCacheSize+1; i++ {
+		c.set(fmt.Sprintf("page=%d", i), nil, now)
+	}
+	if len(c.entries) > marketStatsCacheSize {
+		t.Errorf("cache holds %d entries, want at most %d", len(c.entries), marketStatsCacheSize)
+	}
+}
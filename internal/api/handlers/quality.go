@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+)
+
+// DataQuality counts the active listings with missing or suspect fields per
+// data-quality check and source, showing which scrapers need fixing
+func (h *ListingHandler) DataQuality(w http.ResponseWriter, r *http.Request) {
+	issues, err := h.repo.DataQuality(r.Context())
+	if QueryCanceled(w, r, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Data quality error: %v", err)
+		InternalError(w, r, "Failed to check data quality")
+		return
+	}
+	Success(w, r, map[string]interface{}{"issues": issues})
+}
+
+// DataQualityExport downloads the listings failing the ?issue= check, or
+// every check without one, as CSV for triage. X-Truncated-Issues lists the
+// checks with more failing listings than the export holds.
+func (h *ListingHandler) DataQualityExport(w http.ResponseWriter, r *http.Request) {
+	issue := r.URL.Query().Get("issue")
+	listings, truncated, err := h.repo.QualityListings(r.Context(), issue)
+	if errors.Is(err, repository.ErrUnknownQualityCheck) {
+		BadRequest(w, r, err.Error())
+		return
+	}
+	if QueryCanceled(w, r, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Data quality export error: %v", err)
+		InternalError(w, r, "Failed to export data quality issues")
+		return
+	}
+
+	filename := "data-quality.csv"
+	if issue != "" {
+		filename = "data-quality-" + issue + ".csv"
+	}
+	if len(truncated) > 0 {
+		w.Header().Set("X-Truncated-Issues", strings.Join(truncated, ","))
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := writeQualityCSV(w, listings); err != nil {
+		log.Printf("Data quality export write error: %v", err)
+	}
+}
+
+// qualityCSVHeader names the columns writeQualityCSV writes
+var qualityCSVHeader = []string{
+	"issue", "source", "id", "external_id", "url", "title",
+	"asking_price_cents", "city", "state", "last_seen_at",
+}
+
+// writeQualityCSV writes one row per listing and issue; missing values are
+// empty. Scraped values are escaped with csvText, since the file is opened
+// in spreadsheets.
+func writeQualityCSV(w io.Writer, listings []domain.DataQualityListing) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(qualityCSVHeader); err != nil {
+		return err
+	}
+	for _, l := range listings {
+		price := ""
+		if l.AskingPrice != nil {
+			price = strconv.FormatInt(*l.AskingPrice, 10)
+		}
+		if err := cw.Write([]string{
+			l.Issue, l.Source, l.ID.String(), csvText(l.ExternalID), csvText(l.URL), csvText(l.Title),
+			price, csvText(stringOrEmpty(l.City)), csvText(stringOrEmpty(l.State)), l.LastSeenAt.UTC().Format(time.RFC3339),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText keeps a spreadsheet from running a cell as a formula (CSV
+// injection) by quoting values starting with =, +, -, @, tab or CR with a '
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
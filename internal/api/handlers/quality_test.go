@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+)
+
+func TestDataQualityExport(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := sqlx.NewDb(mockDB, "postgres")
+	h := NewListingHandler(repository.NewListingRepository(db), repository.NewSourceRepository(db))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.DataQualityExport(rec, httptest.NewRequest("GET", "/api/v1/data-quality/export"+query, nil))
+		return rec
+	}
+
+	if rec := get("?issue=no_title"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown issue: status = %d, want 400", rec.Code)
+	}
+
+	seen := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM listings l`).
+		WithArgs("price_below_floor", repository.DefaultMaxRows+1).
+		WillReturnRows(sqlmock.NewRows([]string{"issue", "source", "id", "external_id", "url", "title", "asking_price", "city", "state", "last_seen_at"}).
+			AddRow("price_below_floor", "bizquest", "8d9e6f5a-1b2c-4d3e-8f4a-5b6c7d8e9f00", "17", "https://example.com/17", "Bakery, \"Downtown\"", 500, nil, "FL", seen))
+
+	rec := get("?issue=price_below_floor")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="data-quality-price_below_floor.csv"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if got := rec.Header().Get("X-Truncated-Issues"); got != "" {
+		t.Errorf("X-Truncated-Issues = %q, want none", got)
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"price_below_floor", "bizquest", "8d9e6f5a-1b2c-4d3e-8f4a-5b6c7d8e9f00", "17", "https://example.com/17",
+		"Bakery, \"Downtown\"", "500", "", "FL", "2024-06-01T12:00:00Z"}
+	if len(records) != 2 || len(records[1]) != len(want) {
+		t.Fatalf("records = %q, want a header and one row", records)
+	}
+	for i, v := range want {
+		if records[1][i] != v {
+			t.Errorf("%s = %q, want %q", records[0][i], records[1][i], v)
+		}
+	}
+}
+
+func TestWriteQualityCSVEscapesFormulas(t *testing.T) {
+	var b strings.Builder
+	err := writeQualityCSV(&b, []domain.DataQualityListing{{
+		Issue:      "no_price",
+		Source:     "bizquest",
+		ExternalID: "@SUM(1+1)",
+		URL:        "https://example.com/1",
+		Title:      "=HYPERLINK(\"https://evil.example\")",
+		City:       domain.StrPtr("-Tampa"),
+		State:      domain.StrPtr("+FL"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := records[1]
+	for i, want := range map[int]string{3: "'@SUM(1+1)", 4: "https://example.com/1", 5: "'=HYPERLINK(\"https://evil.example\")", 7: "'-Tampa", 8: "'+FL"} {
+		if row[i] != want {
+			t.Errorf("%s = %q, want %q", records[0][i], row[i], want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+	"github.com/kbsch/trough/internal/scraper/jobs"
+)
+
+const (
+	// maxReportNoteLength caps the free-text note on a listing report, in characters
+	maxReportNoteLength = 1000
+	// defaultReportsLimit is how many reports the admin review lists without ?limit=
+	defaultReportsLimit = 100
+)
+
+// ReportHandler takes users' corrections to listings
+type ReportHandler struct {
+	listings      *repository.ListingRepository
+	queue         JobQueue
+	rateLimiter   middleware.Limiter
+	soldThreshold int
+	soldAction    string
+}
+
+// NewReportHandler creates a report handler that queues verifications on
+// queue. The rate limiter caps reports per IP; if nil, an in-memory limiter
+// allowing 10 reports per hour is used. Listings aren't acted on however
+// many times they are reported sold until SetSoldThreshold is called.
+func NewReportHandler(listings *repository.ListingRepository, queue JobQueue, rateLimiter middleware.Limiter) *ReportHandler {
+	if rateLimiter == nil {
+		rateLimiter = middleware.NewRateLimiter(10, time.Hour)
+	}
+	return &ReportHandler{listings: listings, queue: queue, rateLimiter: rateLimiter}
+}
+
+// SetSoldThreshold makes the first report that brings a listing's "sold"
+// reports to n distinct IPs apply action: domain.ReportActionHide hides the
+// listing, and domain.ReportActionVerify queues a re-fetch of its detail
+// page. n = 0 disables this.
+//
+// Reporters are told apart, and rate limited, by the IP the RealIP middleware
+// gives the request, so forwarded headers must only be trusted from our own
+// proxies (TRUSTED_PROXIES); otherwise one client could claim any number of
+// IPs.
+func (h *ReportHandler) SetSoldThreshold(n int, action string) {
+	h.soldThreshold = n
+	h.soldAction = action
+}
+
+type reportRequest struct {
+	Reason string `json:"reason"`
+	Note   string `json:"note"`
+}
+
+// Submit saves a user's report of a listing's bad data
+func (h *ReportHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, r, "Invalid listing ID format")
+		return
+	}
+
+	var req reportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+		BadRequest(w, r, "Invalid request body")
+		return
+	}
+	if !domain.ValidReportReason(req.Reason) {
+		BadRequest(w, r, fmt.Sprintf("reason must be one of: %s", strings.Join(domain.ReportReasons, ", ")))
+		return
+	}
+	note := strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(note) > maxReportNoteLength {
+		BadRequest(w, r, fmt.Sprintf("note must be at most %d characters", maxReportNoteLength))
+		return
+	}
+
+	if !h.rateLimiter.Allow(r.RemoteAddr) {
+		middleware.SetRateLimitHeaders(w, h.rateLimiter, r.RemoteAddr)
+		TooManyRequests(w, r, "Too many reports. Please try again later.")
+		return
+	}
+
+	report := &domain.ListingReport{ListingID: id, Reason: req.Reason, ReporterIP: middleware.ClientIP(r)}
+	if note != "" {
+		report.Note = &note
+	}
+	if err := h.listings.CreateReport(ctx, report); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			NotFound(w, r, "Listing not found")
+			return
+		}
+		log.Printf("Create report error: %v", err)
+		InternalError(w, r, "Failed to save report")
+		return
+	}
+
+	if report.Reason == domain.ReportReasonSold && h.soldThreshold > 0 {
+		h.actOnSold(r, id)
+	}
+
+	// Reporters' IPs are for admins only
+	report.ReporterIP = ""
+	Created(w, r, report)
+}
+
+// actOnSold applies the sold action once as many distinct IPs as the
+// threshold have reported a listing sold. Failures are logged, not returned:
+// the report itself was saved.
+func (h *ReportHandler) actOnSold(r *http.Request, id uuid.UUID) {
+	ctx := r.Context()
+	count, err := h.listings.CountReports(ctx, id, domain.ReportReasonSold)
+	if err != nil {
+		log.Printf("Count reports error: %v", err)
+		return
+	}
+	if count < h.soldThreshold {
+		return
+	}
+	// The action is applied once per listing, so a listing an admin unhides
+	// isn't hidden again by the next report
+	claimed, err := h.listings.ClaimReportAction(ctx, id, domain.ReportReasonSold)
+	if err != nil {
+		log.Printf("Claim report action error: %v", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	switch h.soldAction {
+	case domain.ReportActionVerify:
+		if _, err := h.queue.Insert(ctx, jobs.EnrichListingJobArgs{ListingID: id}, nil); err != nil {
+			log.Printf("Queue report verification error: %v", err)
+		}
+	default:
+		if err := h.listings.SetHidden(ctx, id, true); err != nil {
+			log.Printf("Hide reported listing error: %v", err)
+		}
+	}
+}
+
+// Reports lists users' listing reports for review, newest first, up to
+// ?limit= (default 100)
+func (h *AdminHandler) Reports(w http.ResponseWriter, r *http.Request) {
+	limit := defaultReportsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			BadRequest(w, r, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	reports, err := h.listings.ListReports(r.Context(), limit)
+	if err != nil {
+		log.Printf("List reports error: %v", err)
+		InternalError(w, r, "Failed to fetch reports")
+		return
+	}
+	Success(w, r, reports)
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+	"github.com/kbsch/trough/internal/scraper/jobs"
+)
+
+// newReportRouter routes report submissions to h, backed by sqlmock
+func newReportRouter(t *testing.T, queue JobQueue, limiter middleware.Limiter) (*ReportHandler, http.Handler, sqlmock.Sqlmock) {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+	h := NewReportHandler(repository.NewListingRepository(sqlx.NewDb(mockDB, "postgres")), queue, limiter)
+	router := chi.NewRouter()
+	router.Post("/api/v1/listings/{id}/report", h.Submit)
+	return h, router, mock
+}
+
+func postReport(router http.Handler, id, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/listings/"+id+"/report", strings.NewReader(body)))
+	return rec
+}
+
+func TestSubmitReport(t *testing.T) {
+	_, router, mock := newReportRouter(t, &fakeJobQueue{}, allowLimiter{})
+	id := uuid.New()
+
+	invalid := []struct {
+		name, id, body string
+	}{
+		{"bad id", "nope", `{"reason":"sold"}`},
+		{"bad body", id.String(), `{"reason":`},
+		{"unknown reason", id.String(), `{"reason":"rude"}`},
+		{"long note", id.String(), `{"reason":"other","note":"` + strings.Repeat("x", maxReportNoteLength+1) + `"}`},
+	}
+	for _, tt := range invalid {
+		if rec := postReport(router, tt.id, tt.body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tt.name, rec.Code)
+		}
+	}
+
+	// A listing that isn't shown can't be reported
+	mock.ExpectQuery(`INSERT INTO listing_reports`).
+		WithArgs(id, domain.ReportReasonWrongPrice, nil, "192.0.2.1").
+		WillReturnError(sql.ErrNoRows)
+	if rec := postReport(router, id.String(), `{"reason":"wrong_price"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("missing listing: status = %d, want 404", rec.Code)
+	}
+
+	// Other reasons than sold don't count towards the threshold
+	mock.ExpectQuery(`INSERT INTO listing_reports`).
+		WithArgs(id, domain.ReportReasonWrongLocation, "It's in Ohio", "192.0.2.1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, time.Now()))
+	rec := postReport(router, id.String(), `{"reason":"wrong_location","note":"  It's in Ohio "}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+	var report domain.ListingReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.ID != 7 || report.ListingID != id || report.Note == nil || *report.Note != "It's in Ohio" {
+		t.Errorf("report = %+v, want report 7 with the trimmed note", report)
+	}
+	if report.ReporterIP != "" {
+		t.Errorf("reporter_ip = %q, want it left out", report.ReporterIP)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSubmitReportRateLimited(t *testing.T) {
+	_, router, _ := newReportRouter(t, &fakeJobQueue{}, denyLimiter{})
+	rec := postReport(router, uuid.NewString(), `{"reason":"sold"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+}
+
+func TestSubmitReportSoldThreshold(t *testing.T) {
+	id := uuid.New()
+
+	tests := []struct {
+		name      string
+		action    string
+		threshold int
+		count     int
+		// acted is whether the listing's sold reports were already acted on
+		acted    bool
+		hidden   bool
+		verified bool
+	}{
+		{"below threshold", domain.ReportActionHide, 3, 2, false, false, false},
+		{"reaches threshold hides", domain.ReportActionHide, 3, 3, false, true, false},
+		{"reaches threshold verifies", domain.ReportActionVerify, 3, 3, false, false, true},
+		// Concurrent reports may both count past the threshold
+		{"past threshold first", domain.ReportActionHide, 3, 4, false, true, false},
+		// An admin may have unhidden it since it reached the threshold
+		{"already acted", domain.ReportActionHide, 3, 4, true, false, false},
+		{"disabled", domain.ReportActionHide, 0, 3, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := &fakeJobQueue{}
+			h, router, mock := newReportRouter(t, queue, allowLimiter{})
+			h.SetSoldThreshold(tt.threshold, tt.action)
+
+			mock.ExpectQuery(`INSERT INTO listing_reports`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+			if tt.threshold > 0 {
+				mock.ExpectQuery(`SELECT COUNT\(DISTINCT reporter_ip\) FROM listing_reports WHERE listing_id = \$1 AND reason = \$2`).
+					WithArgs(id, domain.ReportReasonSold).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.count))
+			}
+			if tt.count >= tt.threshold && tt.threshold > 0 {
+				claimed := int64(1)
+				if tt.acted {
+					claimed = 0
+				}
+				mock.ExpectExec(`INSERT INTO listing_report_actions \(listing_id, reason\) VALUES \(\$1, \$2\)\s+ON CONFLICT DO NOTHING`).
+					WithArgs(id, domain.ReportReasonSold).
+					WillReturnResult(sqlmock.NewResult(0, claimed))
+			}
+			if tt.hidden {
+				mock.ExpectExec(`UPDATE listings SET hidden = \$2 WHERE id = \$1`).
+					WithArgs(id, true).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			if rec := postReport(router, id.String(), `{"reason":"sold"}`); rec.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if tt.verified {
+				if len(queue.inserted) != 1 || queue.inserted[0] != (jobs.EnrichListingJobArgs{ListingID: id}) {
+					t.Errorf("inserted %v, want one detail fetch of the listing", queue.inserted)
+				}
+			} else if len(queue.inserted) != 0 {
+				t.Errorf("inserted %v, want none", queue.inserted)
+			}
+		})
+	}
+}
+
+func TestSubmitReportIgnoresSpoofedForwardedFor(t *testing.T) {
+	h, _, mock := newReportRouter(t, &fakeJobQueue{}, middleware.NewRateLimiter(2, time.Hour))
+	h.SetSoldThreshold(2, domain.ReportActionHide)
+	// No trusted proxies, as when clients reach the API directly
+	router := chi.NewRouter()
+	router.Use(middleware.RealIP(nil))
+	router.Post("/api/v1/listings/{id}/report", h.Submit)
+	id := uuid.New()
+
+	// Each report claims another client, but all are from the peer's IP, so
+	// the threshold of 2 reporters isn't reached
+	for i := 1; i <= 2; i++ {
+		mock.ExpectQuery(`INSERT INTO listing_reports`).
+			WithArgs(id, domain.ReportReasonSold, nil, "192.0.2.1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(i, time.Now()))
+		mock.ExpectQuery(`SELECT COUNT\(DISTINCT reporter_ip\) FROM listing_reports`).
+			WithArgs(id, domain.ReportReasonSold).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	}
+	for i := 1; i <= 3; i++ {
+		r := httptest.NewRequest("POST", "/api/v1/listings/"+id.String()+"/report", strings.NewReader(`{"reason":"sold"}`))
+		r.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+
+		// Nor do they get around the rate limit
+		want := http.StatusCreated
+		if i == 3 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Errorf("report %d: status = %d, want %d", i, rec.Code, want)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdminReports(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	h := NewAdminHandler(repository.NewListingRepository(sqlx.NewDb(mockDB, "postgres")), &fakeJobQueue{}, allowLimiter{})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Reports(rec, httptest.NewRequest("GET", "/api/v1/admin/reports"+query, nil))
+		return rec
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=all"} {
+		if rec := get(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+
+	id := uuid.New()
+	mock.ExpectQuery(`SELECT r.id, .* FROM listing_reports r\s+JOIN listings l ON l.id = r.listing_id\s+ORDER BY r.created_at DESC, r.id DESC\s+LIMIT \$1`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "listing_id", "reason", "note", "reporter_ip", "created_at", "listing_title"}).
+			AddRow(2, id, "sold", nil, "192.0.2.1", time.Now(), "Corner Cafe").
+			AddRow(1, id, "wrong_price", "Asking is $90k", "192.0.2.2", time.Now(), "Corner Cafe"))
+	rec := get("?limit=5")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var reports []domain.ListingReport
+	if err := json.NewDecoder(rec.Body).Decode(&reports); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || reports[0].ID != 2 || reports[0].ListingTitle != "Corner Cafe" || reports[1].ReporterIP != "192.0.2.2" {
+		t.Errorf("reports = %+v, want both, newest first, with titles and IPs", reports)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5/middleware"
+
+	mw "github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
 )
 
 // APIError represents an error response
@@ -15,18 +21,28 @@ type APIError struct {
 	RequestID string `json:"request_id,omitempty"`
 }
 
-// APIResponse is a generic success response wrapper
+// APIResponse is the v2 success envelope
 type APIResponse struct {
-	Data any    `json:"data,omitempty"`
-	Meta *Meta  `json:"meta,omitempty"`
+	Data any   `json:"data"`
+	Meta *Meta `json:"meta,omitempty"`
 }
 
 // Meta contains pagination and other metadata
 type Meta struct {
-	Total      int `json:"total,omitempty"`
+	Total      int `json:"total"`
 	Page       int `json:"page,omitempty"`
 	PerPage    int `json:"per_page,omitempty"`
 	TotalPages int `json:"total_pages,omitempty"`
+
+	// Sort, Nulls and Seed are the search ordering applied, to repeat when paging
+	Sort  string `json:"sort,omitempty"`
+	Nulls string `json:"nulls,omitempty"`
+	Seed  string `json:"seed,omitempty"`
+
+	// Facets holds search facet counts, keyed by facet name
+	Facets map[string][]domain.FilterOption `json:"facets,omitempty"`
+	// Bounds is the bounding box of map markers
+	Bounds *MapBounds `json:"bounds,omitempty"`
 }
 
 // JSON writes a JSON response
@@ -38,24 +54,36 @@ func JSON(w http.ResponseWriter, status int, data any) {
 	}
 }
 
-// Success writes a success response
-func Success(w http.ResponseWriter, data any) {
-	JSON(w, http.StatusOK, data)
+// respond writes v1Body for v1 requests, or data and meta in the v2 envelope
+func respond(w http.ResponseWriter, r *http.Request, status int, v1Body, data any, meta *Meta) {
+	if mw.ResponseVersion(r.Context()) < 2 {
+		JSON(w, status, v1Body)
+		return
+	}
+	w.Header().Set("Content-Type", mw.MediaTypeV2)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIResponse{Data: data, Meta: meta})
+}
+
+// Success writes a success response, wrapped in the envelope for v2 requests
+func Success(w http.ResponseWriter, r *http.Request, data any) {
+	respond(w, r, http.StatusOK, data, data, nil)
 }
 
-// SuccessWithMeta writes a success response with metadata
-func SuccessWithMeta(w http.ResponseWriter, data any, meta *Meta) {
-	JSON(w, http.StatusOK, APIResponse{Data: data, Meta: meta})
+// SuccessWithMeta writes data and meta in the envelope for v2 requests, and
+// v1Body, the endpoint's v1 shape, otherwise
+func SuccessWithMeta(w http.ResponseWriter, r *http.Request, data any, meta *Meta, v1Body any) {
+	respond(w, r, http.StatusOK, v1Body, data, meta)
 }
 
-// Created writes a 201 response
-func Created(w http.ResponseWriter, data any) {
-	JSON(w, http.StatusCreated, data)
+// Created writes a 201 response, wrapped in the envelope for v2 requests
+func Created(w http.ResponseWriter, r *http.Request, data any) {
+	respond(w, r, http.StatusCreated, data, data, nil)
 }
 
-// Accepted writes a 202 response
-func Accepted(w http.ResponseWriter, data any) {
-	JSON(w, http.StatusAccepted, data)
+// Accepted writes a 202 response, wrapped in the envelope for v2 requests
+func Accepted(w http.ResponseWriter, r *http.Request, data any) {
+	respond(w, r, http.StatusAccepted, data, data, nil)
 }
 
 // NoContent writes a 204 response
@@ -69,6 +97,12 @@ func Error(w http.ResponseWriter, r *http.Request, status int, message string) {
 	JSON(w, status, APIError{Error: message, RequestID: requestID})
 }
 
+// ErrorWithDetails writes an error response with a machine-readable code and details
+func ErrorWithDetails(w http.ResponseWriter, r *http.Request, status int, code, message string, details any) {
+	requestID := middleware.GetReqID(r.Context())
+	JSON(w, status, APIError{Error: message, Code: code, Details: details, RequestID: requestID})
+}
+
 // ErrorSimple writes an error response without request (for backwards compatibility)
 func ErrorSimple(w http.ResponseWriter, status int, message string) {
 	JSON(w, status, APIError{Error: message})
@@ -107,3 +141,30 @@ func TooManyRequests(w http.ResponseWriter, r *http.Request, message string) {
 	}
 	Error(w, r, http.StatusTooManyRequests, message)
 }
+
+// ServiceUnavailable writes a 503 response
+func ServiceUnavailable(w http.ResponseWriter, r *http.Request, message string) {
+	if message == "" {
+		message = "Service unavailable"
+	}
+	Error(w, r, http.StatusServiceUnavailable, message)
+}
+
+// StatusClientClosedRequest is the nginx convention for a request the client
+// gave up on before the response
+const StatusClientClosedRequest = 499
+
+// QueryCanceled answers a repository.ErrCanceled error and returns true: 503
+// if the request timed out, 499 if the client went away. Other errors are
+// left to the caller.
+func QueryCanceled(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, repository.ErrCanceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		ServiceUnavailable(w, r, "Request timed out")
+		return true
+	}
+	Error(w, r, StatusClientClosedRequest, "Request canceled")
+	return true
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	mw "github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// serveVersion runs handler behind the APIVersion middleware and decodes its body
+func serveVersion(t *testing.T, version int, handler http.HandlerFunc) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mw.APIVersion(version)(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body %q: %v", rec.Body.String(), err)
+	}
+	return rec, body
+}
+
+func keys(m map[string]any) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+func hasKeys(t *testing.T, name string, m map[string]any, want ...string) {
+	t.Helper()
+	for _, k := range want {
+		if _, ok := m[k]; !ok {
+			t.Errorf("%s missing %q, has %v", name, k, keys(m))
+		}
+	}
+	if len(m) != len(want) {
+		t.Errorf("%s has keys %v, want %v", name, keys(m), want)
+	}
+}
+
+func TestSuccessContract(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		Success(w, r, map[string]any{"sources": []string{"bizquest"}})
+	}
+
+	rec, v1 := serveVersion(t, 1, handler)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("v1 Content-Type = %q", ct)
+	}
+	hasKeys(t, "v1 body", v1, "sources")
+
+	rec, v2 := serveVersion(t, 2, handler)
+	if ct := rec.Header().Get("Content-Type"); ct != mw.MediaTypeV2 {
+		t.Errorf("v2 Content-Type = %q", ct)
+	}
+	hasKeys(t, "v2 body", v2, "data")
+	if data, _ := v2["data"].(map[string]any); !reflect.DeepEqual(data, v1) {
+		t.Errorf("v2 data = %v, want the v1 body %v", v2["data"], v1)
+	}
+}
+
+func TestSearchResultContract(t *testing.T) {
+	result := &domain.ListingSearchResult{
+		Listings:   []domain.Listing{{ID: uuid.New(), Title: "Cafe"}},
+		Total:      41,
+		Page:       3,
+		PerPage:    20,
+		TotalPages: 3,
+		Sort:       "price_asc",
+		Nulls:      "first",
+		Facets:     map[string][]domain.FilterOption{"state": {{Value: "TX", Count: 41}}},
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		writeSearchResult(w, r, result)
+	}
+
+	_, v1 := serveVersion(t, 1, handler)
+	hasKeys(t, "v1 body", v1, "listings", "total", "page", "per_page", "total_pages", "sort", "nulls", "facets")
+
+	_, v2 := serveVersion(t, 2, handler)
+	hasKeys(t, "v2 body", v2, "data", "meta")
+	if data, ok := v2["data"].([]any); !ok || len(data) != 1 {
+		t.Errorf("v2 data = %v, want the listings array", v2["data"])
+	}
+	meta, _ := v2["meta"].(map[string]any)
+	hasKeys(t, "v2 meta", meta, "total", "page", "per_page", "total_pages", "sort", "nulls", "facets")
+	if meta["total"] != float64(41) || meta["page"] != float64(3) {
+		t.Errorf("v2 meta = %v", meta)
+	}
+}
+
+func TestMapMarkersContract(t *testing.T) {
+	markers := []MapMarker{{ID: uuid.New(), Lat: 30.27, Lng: -97.74, Title: "Cafe"}}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		writeMapMarkers(w, r, markers)
+	}
+
+	_, v1 := serveVersion(t, 1, handler)
+	hasKeys(t, "v1 body", v1, "markers", "total", "bounds")
+
+	_, v2 := serveVersion(t, 2, handler)
+	hasKeys(t, "v2 body", v2, "data", "meta")
+	meta, _ := v2["meta"].(map[string]any)
+	hasKeys(t, "v2 meta", meta, "total", "bounds")
+
+	// An empty map still reports its total in both versions
+	empty := func(w http.ResponseWriter, r *http.Request) {
+		writeMapMarkers(w, r, []MapMarker{})
+	}
+	_, v2 = serveVersion(t, 2, empty)
+	if meta, _ := v2["meta"].(map[string]any); meta["total"] != float64(0) {
+		t.Errorf("empty v2 meta = %v, want total 0", v2["meta"])
+	}
+}
+
+func TestErrorContractUnchangedInV2(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		NotFound(w, r, "Listing not found")
+	}
+
+	for _, version := range []int{1, 2} {
+		rec, body := serveVersion(t, version, handler)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("v%d status = %d", version, rec.Code)
+		}
+		hasKeys(t, "error body", body, "error")
+	}
+}
@@ -2,29 +2,73 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
 	"github.com/riverqueue/river"
-	"github.com/riverqueue/river/riverdriver/riverpgxv5"
+	"github.com/riverqueue/river/rivertype"
 
 	"github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/domain"
 	"github.com/kbsch/trough/internal/repository"
 	"github.com/kbsch/trough/internal/scraper/jobs"
 )
 
 type SourceHandler struct {
 	repo        *repository.SourceRepository
-	dbURL       string
-	rateLimiter *middleware.RateLimiter
+	queue       JobQueue
+	rateLimiter middleware.Limiter
+	idempotency middleware.IdempotencyStore
 }
 
-func NewSourceHandler(repo *repository.SourceRepository, dbURL string) *SourceHandler {
+// errRefreshRateLimited is returned by the refresh enqueue when the caller is over the limit
+var errRefreshRateLimited = errors.New("refresh rate limited")
+
+// UnknownSourceError is returned for a source slug that names no active
+// source. Valid lists the active slugs.
+type UnknownSourceError struct {
+	Slug  string
+	Valid []string
+}
+
+func (e *UnknownSourceError) Error() string {
+	return fmt.Sprintf("unknown source %q; valid sources: %s", e.Slug, strings.Join(e.Valid, ", "))
+}
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// JobQueue inserts and looks up River jobs. The API shares one insert-only
+// *river.Client[pgx.Tx] across requests.
+type JobQueue interface {
+	Insert(ctx context.Context, args river.JobArgs, opts *river.InsertOpts) (*rivertype.JobInsertResult, error)
+	JobGet(ctx context.Context, id int64) (*rivertype.JobRow, error)
+}
+
+// NewSourceHandler creates a source handler that queues refreshes on queue. The rate
+// limiter guards TriggerRefresh; if nil, an in-memory limiter allowing 1 request per
+// hour is used. The idempotency store remembers Idempotency-Key headers; if nil, keys
+// are kept in memory for 24 hours.
+func NewSourceHandler(repo *repository.SourceRepository, queue JobQueue, rateLimiter middleware.Limiter, idempotency middleware.IdempotencyStore) *SourceHandler {
+	if rateLimiter == nil {
+		rateLimiter = middleware.NewRateLimiter(1, time.Hour)
+	}
+	if idempotency == nil {
+		idempotency = middleware.NewMemoryIdempotencyStore(24 * time.Hour)
+	}
 	return &SourceHandler{
 		repo:        repo,
-		dbURL:       dbURL,
-		rateLimiter: middleware.NewRateLimiter(1, time.Hour), // 1 request per hour
+		queue:       queue,
+		rateLimiter: rateLimiter,
+		idempotency: idempotency,
 	}
 }
 
@@ -59,76 +103,250 @@ func (h *SourceHandler) List(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	Success(w, map[string]interface{}{
+	Success(w, r, map[string]interface{}{
 		"sources": result,
 	})
 }
 
-func (h *SourceHandler) TriggerRefresh(w http.ResponseWriter, r *http.Request) {
-	// Rate limit: 1 refresh per hour per IP
-	clientIP := r.RemoteAddr
-	if !h.rateLimiter.Allow(clientIP) {
-		TooManyRequests(w, r, "Refresh is limited to once per hour. Please try again later.")
+// Health returns each active source's latest scrape job and, for sources with
+// max_requests_per_day set, how much of today's request budget is left
+func (h *SourceHandler) Health(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	sources, err := h.repo.ListActive(ctx)
+	if err != nil {
+		InternalError(w, r, "Failed to fetch sources")
+		return
+	}
+	jobs, err := h.repo.LatestScrapeJobs(ctx)
+	if err != nil {
+		InternalError(w, r, "Failed to fetch scrape jobs")
+		return
+	}
+	usage, err := h.repo.ListRequestBudgetUsage(ctx)
+	if err != nil {
+		InternalError(w, r, "Failed to fetch request budgets")
 		return
 	}
 
+	Success(w, r, map[string]interface{}{
+		"sources": sourceHealth(sources, jobs, usage, time.Now()),
+	})
+}
+
+// sourceHealth combines sources with their latest job and today's request count
+func sourceHealth(sources []domain.Source, jobs map[uuid.UUID]domain.ScrapeJob, usage map[uuid.UUID]int, now time.Time) []domain.SourceHealth {
+	result := make([]domain.SourceHealth, len(sources))
+	for i, s := range sources {
+		result[i] = domain.SourceHealth{Slug: s.Slug, Name: s.Name}
+		if s.Quarantined(now) {
+			result[i].QuarantinedUntil = s.QuarantinedUntil
+		}
+		if job, ok := jobs[s.ID]; ok {
+			result[i].LastJob = &job
+		}
+
+		// An invalid config fails the source's scrapes, which shows in its last job
+		cfg, err := domain.ParseSourceConfig(s.Config)
+		if err == nil && cfg.MaxRequestsPerDay > 0 {
+			budget := domain.NewRequestBudget(cfg.MaxRequestsPerDay, usage[s.ID], now)
+			result[i].Budget = &budget
+		}
+	}
+	return result
+}
+
+// ClearQuarantine lets a source quarantined after repeated blocked runs be
+// scraped again before its cooldown passes (authenticated)
+func (h *SourceHandler) ClearQuarantine(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+
+	if err := h.repo.ClearQuarantine(r.Context(), slug); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			NotFound(w, r, "Source not found")
+			return
+		}
+		log.Printf("Clear quarantine error: %v", err)
+		InternalError(w, r, "Failed to clear quarantine")
+		return
+	}
+
+	Success(w, r, map[string]interface{}{
+		"slug":        slug,
+		"quarantined": false,
+	})
+}
+
+// TriggerRefresh queues a scrape job. Requests carrying an Idempotency-Key header
+// are enqueued once per client IP; repeats return the original job and its
+// current state.
+func (h *SourceHandler) TriggerRefresh(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// Parse request body for optional source filter
 	sourceSlug := r.URL.Query().Get("source")
 
-	// Queue the scrape job
-	if err := h.queueScrapeJob(ctx, sourceSlug); err != nil {
+	key := r.Header.Get("Idempotency-Key")
+	if len(key) > maxIdempotencyKeyLength {
+		BadRequest(w, r, "Idempotency-Key is too long")
+		return
+	}
+
+	// Checked before the rate limit, so a mistyped slug doesn't use up the refresh
+	if sourceSlug != "" {
+		var unknown *UnknownSourceError
+		err := h.checkSource(ctx, sourceSlug)
+		switch {
+		case errors.As(err, &unknown):
+			ErrorWithDetails(w, r, http.StatusBadRequest, "unknown_source", unknown.Error(),
+				map[string]interface{}{"valid_sources": unknown.Valid})
+			return
+		case err != nil:
+			InternalError(w, r, "Failed to fetch source")
+			return
+		}
+	}
+
+	enqueue := func() (int64, error) {
+		// Rate limit: 1 refresh per hour per IP. Replays don't count against it.
+		if !h.rateLimiter.Allow(r.RemoteAddr) {
+			return 0, errRefreshRateLimited
+		}
+		return h.queueScrapeJob(ctx, sourceSlug)
+	}
+
+	var jobID int64
+	var replayed bool
+	var err error
+	if key == "" {
+		jobID, err = enqueue()
+	} else {
+		jobID, replayed, err = h.idempotency.Do(middleware.IdempotencyKey(r, key), sourceSlug, enqueue)
+	}
+
+	switch {
+	case errors.Is(err, errRefreshRateLimited):
+		middleware.SetRateLimitHeaders(w, h.rateLimiter, r.RemoteAddr)
+		TooManyRequests(w, r, "Refresh is limited to once per hour. Please try again later.")
+		return
+	case errors.Is(err, middleware.ErrIdempotencyMismatch):
+		Error(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different refresh")
+		return
+	case err != nil:
 		InternalError(w, r, "Failed to queue refresh job")
 		return
 	}
 
+	state := string(rivertype.JobStateAvailable)
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+		if state, err = h.jobState(ctx, jobID); err != nil {
+			InternalError(w, r, "Failed to fetch refresh job")
+			return
+		}
+	}
+
 	message := "Refresh job queued for all sources"
 	if sourceSlug != "" {
 		message = "Refresh job queued for " + sourceSlug
 	}
 
-	Accepted(w, map[string]interface{}{
-		"message": message,
-		"status":  "queued",
+	Accepted(w, r, map[string]interface{}{
+		"message":   message,
+		"status":    "queued",
+		"job_id":    jobID,
+		"job_state": state,
 	})
 }
 
-func (h *SourceHandler) queueScrapeJob(ctx context.Context, sourceSlug string) error {
-	pool, err := pgxpool.New(ctx, h.dbURL)
-	if err != nil {
+// checkSource returns an *UnknownSourceError unless slug names an active source
+func (h *SourceHandler) checkSource(ctx context.Context, slug string) error {
+	source, err := h.repo.GetBySlug(ctx, slug)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
-	defer pool.Close()
+	if err == nil && source.IsActive {
+		return nil
+	}
 
-	client, err := river.NewClient(riverpgxv5.New(pool), &river.Config{})
+	active, err := h.repo.ListActive(ctx)
 	if err != nil {
 		return err
 	}
+	valid := make([]string, len(active))
+	for i, s := range active {
+		valid[i] = s.Slug
+	}
+	return &UnknownSourceError{Slug: slug, Valid: valid}
+}
 
-	if sourceSlug == "" {
-		_, err = client.Insert(ctx, jobs.ScrapeAllJobArgs{}, nil)
-	} else {
-		_, err = client.Insert(ctx, jobs.ScrapeJobArgs{
+func (h *SourceHandler) queueScrapeJob(ctx context.Context, sourceSlug string) (int64, error) {
+	// The request's ID goes with the job so its logs can be traced to the request
+	requestID := chimw.GetReqID(ctx)
+	var args river.JobArgs = jobs.ScrapeAllJobArgs{Trigger: domain.ScrapeTriggerAPI, RequestID: requestID}
+	if sourceSlug != "" {
+		args = jobs.ScrapeJobArgs{
 			SourceSlug: sourceSlug,
 			FullScrape: false, // Incremental for on-demand
-		}, nil)
+			Trigger:    domain.ScrapeTriggerAPI,
+			RequestID:  requestID,
+		}
+	}
+
+	result, err := h.queue.Insert(ctx, args, nil)
+	if err != nil {
+		return 0, err
 	}
+	return result.Job.ID, nil
+}
 
-	return err
+// jobState returns the River state of a queued job (available, running, completed, ...)
+func (h *SourceHandler) jobState(ctx context.Context, jobID int64) (string, error) {
+	job, err := h.queue.JobGet(ctx, jobID)
+	if err != nil {
+		return "", err
+	}
+	return string(job.State), nil
 }
 
-// GetScrapeJobs returns recent scrape job history
+// GetScrapeJobs returns recent scrape job history, filtered by ?trigger=
 func (h *SourceHandler) GetScrapeJobs(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	jobs, err := h.repo.GetRecentScrapeJobs(ctx, 20)
+	trigger := r.URL.Query().Get("trigger")
+	if trigger != "" && !domain.ValidScrapeTrigger(trigger) {
+		BadRequest(w, r, "trigger must be one of periodic, manual, api, cli, retry")
+		return
+	}
+
+	jobs, err := h.repo.GetRecentScrapeJobs(ctx, trigger, 20)
 	if err != nil {
 		InternalError(w, r, "Failed to fetch scrape jobs")
 		return
 	}
 
-	Success(w, map[string]interface{}{
+	Success(w, r, map[string]interface{}{
 		"jobs": jobs,
 	})
 }
+
+// GetScrapeJobRequests returns the pages fetched by a scrape job and their HTTP status
+func (h *SourceHandler) GetScrapeJobRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		BadRequest(w, r, "Invalid scrape job ID format")
+		return
+	}
+
+	requests, err := h.repo.GetScrapeJobRequests(ctx, jobID)
+	if err != nil {
+		InternalError(w, r, "Failed to fetch scrape job requests")
+		return
+	}
+
+	Success(w, r, map[string]interface{}{
+		"requests": requests,
+	})
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+
+	"github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+	"github.com/kbsch/trough/internal/scraper/jobs"
+)
+
+type denyLimiter struct{}
+
+func (denyLimiter) Allow(key string) bool               { return false }
+func (denyLimiter) Limit() int                          { return 1 }
+func (denyLimiter) RetryAfter(key string) time.Duration { return 30 * time.Minute }
+
+type allowLimiter struct{}
+
+func (allowLimiter) Allow(key string) bool               { return true }
+func (allowLimiter) Limit() int                          { return 1 }
+func (allowLimiter) RetryAfter(key string) time.Duration { return 0 }
+
+// fakeJobQueue records the jobs inserted through it
+type fakeJobQueue struct {
+	inserted []river.JobArgs
+	gets     int
+}
+
+func (q *fakeJobQueue) Insert(ctx context.Context, args river.JobArgs, opts *river.InsertOpts) (*rivertype.JobInsertResult, error) {
+	q.inserted = append(q.inserted, args)
+	job := &rivertype.JobRow{ID: int64(len(q.inserted)), Kind: args.Kind(), State: rivertype.JobStateAvailable}
+	return &rivertype.JobInsertResult{Job: job}, nil
+}
+
+func (q *fakeJobQueue) JobGet(ctx context.Context, id int64) (*rivertype.JobRow, error) {
+	q.gets++
+	return &rivertype.JobRow{ID: id, State: rivertype.JobStateRunning}, nil
+}
+
+// newMockSourceRepo returns a source repository backed by sqlmock
+func newMockSourceRepo(t *testing.T) (*repository.SourceRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+	return repository.NewSourceRepository(sqlx.NewDb(mockDB, "postgres")), mock
+}
+
+func TestTriggerRefreshReusesInjectedQueue(t *testing.T) {
+	queue := &fakeJobQueue{}
+	repo, mock := newMockSourceRepo(t)
+	h := NewSourceHandler(repo, queue, allowLimiter{}, nil)
+
+	// The slug is checked on every request, replays included
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT \* FROM sources WHERE slug = \$1`).
+			WithArgs("bizbuysell").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "slug", "is_active"}).AddRow(uuid.New(), "bizbuysell", true))
+	}
+
+	refresh := func(query, key string) map[string]interface{} {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/api/v1/refresh"+query, nil)
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.TriggerRefresh(rec, r)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	refresh("", "")
+	refresh("?source=bizbuysell", "k1")
+	replay := refresh("?source=bizbuysell", "k1")
+
+	if len(queue.inserted) != 2 {
+		t.Fatalf("inserted %d jobs, want 2", len(queue.inserted))
+	}
+	if args, ok := queue.inserted[0].(jobs.ScrapeAllJobArgs); !ok || args.Trigger != domain.ScrapeTriggerAPI {
+		t.Errorf("first job = %+v, want ScrapeAllJobArgs triggered by the API", queue.inserted[0])
+	}
+	if args, ok := queue.inserted[1].(jobs.ScrapeJobArgs); !ok || args.SourceSlug != "bizbuysell" || args.Trigger != domain.ScrapeTriggerAPI {
+		t.Errorf("second job = %+v, want a bizbuysell ScrapeJobArgs triggered by the API", queue.inserted[1])
+	}
+
+	// The replay looks up the job's state through the same queue
+	if queue.gets != 1 {
+		t.Errorf("JobGet called %d times, want 1", queue.gets)
+	}
+	if replay["job_state"] != string(rivertype.JobStateRunning) || replay["job_id"] != float64(2) {
+		t.Errorf("replay = %v, want job 2 running", replay)
+	}
+}
+
+func TestTriggerRefreshPassesRequestID(t *testing.T) {
+	queue := &fakeJobQueue{}
+	repo, mock := newMockSourceRepo(t)
+	h := NewSourceHandler(repo, queue, allowLimiter{}, nil)
+	mock.ExpectQuery(`SELECT \* FROM sources WHERE slug = \$1`).
+		WithArgs("bizbuysell").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "slug", "is_active"}).AddRow(uuid.New(), "bizbuysell", true))
+
+	handler := chimw.RequestID(http.HandlerFunc(h.TriggerRefresh))
+	for _, query := range []string{"", "?source=bizbuysell"} {
+		r := httptest.NewRequest("POST", "/api/v1/refresh"+query, nil)
+		r.Header.Set(chimw.RequestIDHeader, "trace-"+query)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+		}
+	}
+
+	if len(queue.inserted) != 2 {
+		t.Fatalf("inserted %d jobs, want 2", len(queue.inserted))
+	}
+	if args, ok := queue.inserted[0].(jobs.ScrapeAllJobArgs); !ok || args.RequestID != "trace-" {
+		t.Errorf("first job = %+v, want request ID trace-", queue.inserted[0])
+	}
+	if args, ok := queue.inserted[1].(jobs.ScrapeJobArgs); !ok || args.RequestID != "trace-?source=bizbuysell" {
+		t.Errorf("second job = %+v, want request ID trace-?source=bizbuysell", queue.inserted[1])
+	}
+}
+
+func TestTriggerRefreshRejectsUnknownSource(t *testing.T) {
+	queue := &fakeJobQueue{}
+	repo, mock := newMockSourceRepo(t)
+	h := NewSourceHandler(repo, queue, allowLimiter{}, nil)
+
+	mock.ExpectQuery(`SELECT \* FROM sources WHERE slug = \$1`).
+		WithArgs("bizbuysel").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT \* FROM sources WHERE is_active = true`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "slug", "is_active"}).
+			AddRow(uuid.New(), "bizbuysell", true).
+			AddRow(uuid.New(), "bizquest", true))
+
+	rec := httptest.NewRecorder()
+	h.TriggerRefresh(rec, httptest.NewRequest("POST", "/api/v1/refresh?source=bizbuysel", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(queue.inserted) != 0 {
+		t.Errorf("inserted %d jobs for an unknown source, want 0", len(queue.inserted))
+	}
+
+	var body APIError
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	details, _ := body.Details.(map[string]any)
+	valid, _ := details["valid_sources"].([]any)
+	if body.Code != "unknown_source" || len(valid) != 2 || valid[0] != "bizbuysell" {
+		t.Errorf("body = %+v, want unknown_source listing the 2 valid sources", body)
+	}
+}
+
+func TestTriggerRefreshIdempotencyKeyPerClient(t *testing.T) {
+	queue := &fakeJobQueue{}
+	h := NewSourceHandler(nil, queue, allowLimiter{}, nil)
+
+	refresh := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/v1/refresh", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Idempotency-Key", "k1")
+		rec := httptest.NewRecorder()
+		h.TriggerRefresh(rec, r)
+		return rec
+	}
+
+	refresh("192.0.2.1:1234")
+	// The same client on a new connection replays its job
+	if rec := refresh("192.0.2.1:5678"); rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("same client's retry was not replayed")
+	}
+	// Another client's key is its own
+	if rec := refresh("198.51.100.7:1234"); rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("another client's request replayed the first client's job")
+	}
+	if len(queue.inserted) != 2 {
+		t.Errorf("inserted %d jobs, want one per client", len(queue.inserted))
+	}
+}
+
+func TestTriggerRefreshRejectsLongIdempotencyKey(t *testing.T) {
+	h := NewSourceHandler(nil, nil, denyLimiter{}, nil)
+
+	r := httptest.NewRequest("POST", "/api/v1/refresh", nil)
+	r.Header.Set("Idempotency-Key", strings.Repeat("k", maxIdempotencyKeyLength+1))
+	rec := httptest.NewRecorder()
+	h.TriggerRefresh(rec, r)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestTriggerRefreshRateLimitedNotStored(t *testing.T) {
+	store := middleware.NewMemoryIdempotencyStore(time.Hour)
+	h := NewSourceHandler(nil, nil, denyLimiter{}, store)
+
+	// A new key still goes through the rate limiter
+	r := httptest.NewRequest("POST", "/api/v1/refresh", nil)
+	r.Header.Set("Idempotency-Key", "abc")
+	rec := httptest.NewRecorder()
+	h.TriggerRefresh(rec, r)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1800" {
+		t.Errorf("Retry-After = %q, want 1800", got)
+	}
+
+	// A rate-limited attempt isn't stored, so the same key is still unused
+	if _, replayed, _ := store.Do(middleware.IdempotencyKey(r, "abc"), "", func() (int64, error) { return 1, nil }); replayed {
+		t.Error("rate-limited request was stored under its idempotency key")
+	}
+}
+
+func TestGetScrapeJobsRejectsUnknownTrigger(t *testing.T) {
+	h := NewSourceHandler(nil, nil, allowLimiter{}, nil)
+
+	rec := httptest.NewRecorder()
+	h.GetScrapeJobs(rec, httptest.NewRequest("GET", "/api/v1/scrape-jobs?trigger=cron", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestSourceHealth(t *testing.T) {
+	now := time.Date(2024, 5, 10, 15, 0, 0, 0, time.UTC)
+	capped := domain.Source{ID: uuid.New(), Slug: "capped", Config: json.RawMessage(`{"max_requests_per_day":500}`)}
+	uncapped := domain.Source{ID: uuid.New(), Slug: "uncapped"}
+	idle := domain.Source{ID: uuid.New(), Slug: "idle", Config: json.RawMessage(`{"max_requests_per_day":100}`)}
+
+	jobs := map[uuid.UUID]domain.ScrapeJob{
+		capped.ID: {SourceID: capped.ID, Status: domain.ScrapeJobStatusBudgetExhausted},
+	}
+	usage := map[uuid.UUID]int{capped.ID: 500, uncapped.ID: 42}
+
+	got := sourceHealth([]domain.Source{capped, uncapped, idle}, jobs, usage, now)
+	if len(got) != 3 {
+		t.Fatalf("got %d sources, want 3", len(got))
+	}
+
+	if got[0].LastJob == nil || got[0].LastJob.Status != domain.ScrapeJobStatusBudgetExhausted {
+		t.Errorf("capped last job = %+v", got[0].LastJob)
+	}
+	if b := got[0].Budget; b == nil || b.Limit != 500 || b.Used != 500 || b.Remaining != 0 {
+		t.Errorf("capped budget = %+v, want 500 used of 500", b)
+	} else if want := time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC); !b.ResetsAt.Equal(want) {
+		t.Errorf("capped budget resets at %v, want %v", b.ResetsAt, want)
+	}
+
+	if got[1].Budget != nil {
+		t.Errorf("uncapped budget = %+v, want none", got[1].Budget)
+	}
+	if got[1].LastJob != nil {
+		t.Errorf("uncapped last job = %+v, want none", got[1].LastJob)
+	}
+
+	if b := got[2].Budget; b == nil || b.Used != 0 || b.Remaining != 100 {
+		t.Errorf("idle budget = %+v, want all 100 remaining", b)
+	}
+}
+
+func TestSourceHealthQuarantine(t *testing.T) {
+	now := time.Date(2024, 5, 10, 15, 0, 0, 0, time.UTC)
+	until, expired := now.Add(time.Hour), now.Add(-time.Hour)
+	quarantined := domain.Source{ID: uuid.New(), Slug: "quarantined", QuarantinedUntil: &until}
+	cooledDown := domain.Source{ID: uuid.New(), Slug: "cooled_down", QuarantinedUntil: &expired}
+
+	got := sourceHealth([]domain.Source{quarantined, cooledDown}, nil, nil, now)
+	if got[0].QuarantinedUntil == nil || !got[0].QuarantinedUntil.Equal(until) {
+		t.Errorf("quarantined until %v, want %v", got[0].QuarantinedUntil, until)
+	}
+	if got[1].QuarantinedUntil != nil {
+		t.Errorf("cooled down source quarantined until %v, want not quarantined", got[1].QuarantinedUntil)
+	}
+}
+
+func TestClearQuarantine(t *testing.T) {
+	repo, mock := newMockSourceRepo(t)
+	h := NewSourceHandler(repo, nil, allowLimiter{}, nil)
+
+	mock.ExpectExec(`UPDATE sources SET consecutive_blocks = 0, quarantined_until = NULL WHERE slug = \$1`).
+		WithArgs("bizbuysell").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE sources SET consecutive_blocks = 0`).
+		WithArgs("nope").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	router := chi.NewRouter()
+	router.Delete("/api/v1/sources/{slug}/quarantine", h.ClearQuarantine)
+
+	for _, tt := range []struct {
+		slug string
+		want int
+	}{
+		{"bizbuysell", http.StatusOK},
+		{"nope", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("DELETE", "/api/v1/sources/"+tt.slug+"/quarantine", nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.slug, rec.Code, tt.want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// APIKeyAuth returns a middleware that requires a valid API key on every request.
+// The key is read from the X-API-Key header or an "Authorization: Bearer" header.
+// If no keys are configured, all requests are rejected.
+func APIKeyAuth(keys []string) func(http.Handler) http.Handler {
+	var valid [][]byte
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k != "" {
+			valid = append(valid, []byte(k))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := requestAPIKey(r)
+			if key == "" || !matchAPIKey(valid, key) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="trough"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"Unauthorized","code":"unauthorized"}`))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestAPIKey extracts the API key from the request headers
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// matchAPIKey compares the key against each configured key in constant time
+func matchAPIKey(valid [][]byte, key string) bool {
+	matched := false
+	for _, v := range valid {
+		if subtle.ConstantTimeCompare(v, []byte(key)) == 1 {
+			matched = true
+		}
+	}
+	return matched
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		keys   []string
+		header string
+		value  string
+		want   int
+	}{
+		{"missing key", []string{"secret"}, "", "", http.StatusUnauthorized},
+		{"wrong key", []string{"secret"}, "X-API-Key", "nope", http.StatusUnauthorized},
+		{"x-api-key header", []string{"secret"}, "X-API-Key", "secret", http.StatusOK},
+		{"bearer token", []string{"other", "secret"}, "Authorization", "Bearer secret", http.StatusOK},
+		{"no keys configured", nil, "X-API-Key", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+
+			APIKeyAuth(tt.keys)(ok).ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package middleware
+
+import "net/http"
+
+// NoStore marks every response as private and not to be stored, for
+// authenticated endpoints whose responses no shared cache may keep
+func NoStore(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, no-store")
+		next.ServeHTTP(w, r)
+	})
+}
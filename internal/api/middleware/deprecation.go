@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Deprecation describes a deprecated route
+type Deprecation struct {
+	// Since is when the route was deprecated; zero sends "Deprecation: true"
+	Since time.Time
+	// Sunset, if set, is when the route stops being served (RFC 8594)
+	Sunset time.Time
+	// Successor is the URL or path of the route replacing it
+	Successor string
+	// Message is the Warning header's text
+	Message string
+}
+
+// Deprecated marks responses from deprecated routes of routes, keyed by
+// method and pattern as in "GET /listings", with Deprecation, Sunset, Warning
+// and Link rel="successor-version" headers. Use it on the router the routes
+// are registered on; patterns are relative to it.
+func Deprecated(routes chi.Routes, deprecations map[string]Deprecation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(deprecations) > 0 {
+				path := r.URL.Path
+				if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+					path = rctx.RoutePath
+				}
+				pattern := routes.Find(chi.NewRouteContext(), r.Method, path)
+				if d, ok := deprecations[r.Method+" "+pattern]; ok && pattern != "" {
+					d.setHeaders(w.Header())
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (d Deprecation) setHeaders(h http.Header) {
+	// RFC 9745: the Unix time it was deprecated
+	if d.Since.IsZero() {
+		h.Set("Deprecation", "true")
+	} else {
+		h.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	}
+	if !d.Sunset.IsZero() {
+		h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+
+	message := d.Message
+	if message == "" {
+		message = "This endpoint is deprecated"
+	}
+	if d.Successor != "" {
+		h.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, d.Successor))
+	}
+	// 299 is a persistent miscellaneous warning; the text is a quoted-string
+	h.Add("Warning", fmt.Sprintf(`299 - "%s"`, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(message)))
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDeprecated(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	router := chi.NewRouter()
+	router.Route("/api/v1", func(r chi.Router) {
+		r.Use(Deprecated(r, map[string]Deprecation{
+			"GET /listings": {
+				Since:     time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC),
+				Sunset:    time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC),
+				Successor: "/api/v2/listings",
+				Message:   `Use /api/v2/listings, which returns the "data" envelope`,
+			},
+			"GET /listings/{id}/nearby": {},
+		}))
+		r.Get("/listings", ok)
+		r.Post("/listings/batch", ok)
+		r.Get("/listings/{id}", ok)
+		r.Get("/listings/{id}/nearby", ok)
+	})
+
+	get := func(method, path string) http.Header {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status = %d", method, path, rec.Code)
+		}
+		return rec.Header()
+	}
+
+	h := get(http.MethodGet, "/api/v1/listings?page=2")
+	for name, want := range map[string]string{
+		"Deprecation": "@1780272000",
+		"Sunset":      "Tue, 01 Dec 2026 00:00:00 GMT",
+		"Link":        `</api/v2/listings>; rel="successor-version"`,
+		"Warning":     `299 - "Use /api/v2/listings, which returns the \"data\" envelope"`,
+	} {
+		if got := h.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	// Without details, only that it is deprecated
+	h = get(http.MethodGet, "/api/v1/listings/42/nearby")
+	if h.Get("Deprecation") != "true" || h.Get("Warning") != `299 - "This endpoint is deprecated"` || h.Get("Sunset") != "" || h.Get("Link") != "" {
+		t.Errorf("headers = %v, want Deprecation and a default Warning only", h)
+	}
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/listings/42"},
+		{http.MethodPost, "/api/v1/listings/batch"},
+	} {
+		h := get(req.method, req.path)
+		for _, name := range []string{"Deprecation", "Sunset", "Warning", "Link"} {
+			if got := h.Get(name); got != "" {
+				t.Errorf("%s %s: %s = %q on a route that isn't deprecated", req.method, req.path, name, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrIdempotencyMismatch is returned when an idempotency key is reused for a different request
+var ErrIdempotencyMismatch = errors.New("idempotency key reused with different parameters")
+
+// ClientIP returns the IP of the client making r: its RemoteAddr, set by the
+// RealIP middleware, without the port
+func ClientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// IdempotencyKey scopes an Idempotency-Key header to the client sending it,
+// so two clients reusing a key don't get each other's jobs
+func IdempotencyKey(r *http.Request, key string) string {
+	return ClientIP(r) + " " + key
+}
+
+// IdempotencyStore remembers the job enqueued for an Idempotency-Key
+type IdempotencyStore interface {
+	// Do returns the job ID stored for key, or calls enqueue and stores its result.
+	// fingerprint identifies the request parameters; a stored key with a different
+	// fingerprint returns ErrIdempotencyMismatch. Failed enqueues are not stored.
+	Do(key, fingerprint string, enqueue func() (int64, error)) (jobID int64, replayed bool, err error)
+}
+
+type idempotencyEntry struct {
+	jobID       int64
+	fingerprint string
+	expiresAt   time.Time
+	// pending is closed once the key's enqueue returns; until then the entry
+	// holds no job ID
+	pending chan struct{}
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore with a fixed TTL
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	ttl     time.Duration
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemoryIdempotencyStore creates a store that forgets keys after ttl.
+// Close stops its cleanup of expired keys.
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	s := &MemoryIdempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		ttl:     ttl,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go cleanupEvery(time.Minute, s.stop, s.done, s.cleanup)
+	return s
+}
+
+// Close stops the periodic cleanup. Calling it more than once is a no-op.
+func (s *MemoryIdempotencyStore) Close() error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.done
+	return nil
+}
+
+// Do marks key pending while enqueue runs, without holding the store lock, so
+// concurrent retries with the same key wait for it rather than enqueue twice
+func (s *MemoryIdempotencyStore) Do(key, fingerprint string, enqueue func() (int64, error)) (int64, bool, error) {
+	for {
+		s.mu.Lock()
+		entry, ok := s.entries[key]
+		if ok && entry.pending == nil && !time.Now().Before(entry.expiresAt) {
+			ok = false
+		}
+		if !ok {
+			break
+		}
+		jobID, pending := entry.jobID, entry.pending
+		s.mu.Unlock()
+
+		if entry.fingerprint != fingerprint {
+			return 0, false, ErrIdempotencyMismatch
+		}
+		if pending == nil {
+			return jobID, true, nil
+		}
+		// Wait for the first request's enqueue, then look again: it may
+		// have failed and left the key free
+		<-pending
+	}
+
+	entry := &idempotencyEntry{fingerprint: fingerprint, pending: make(chan struct{})}
+	s.entries[key] = entry
+	s.mu.Unlock()
+
+	jobID, err := enqueue()
+
+	s.mu.Lock()
+	if err != nil {
+		delete(s.entries, key)
+	} else {
+		entry.jobID = jobID
+		entry.expiresAt = time.Now().Add(s.ttl)
+	}
+	pending := entry.pending
+	entry.pending = nil
+	s.mu.Unlock()
+	close(pending)
+
+	if err != nil {
+		return 0, false, err
+	}
+	return jobID, false, nil
+}
+
+func (s *MemoryIdempotencyStore) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range s.entries {
+		if entry.pending == nil && now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
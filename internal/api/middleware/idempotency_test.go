@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Hour)
+	calls := 0
+	enqueue := func() (int64, error) {
+		calls++
+		return int64(100 + calls), nil
+	}
+
+	id, replayed, err := store.Do("key-1", "bizbuysell", enqueue)
+	if err != nil || replayed || id != 101 {
+		t.Fatalf("first Do = (%d, %v, %v), want (101, false, nil)", id, replayed, err)
+	}
+
+	id, replayed, err = store.Do("key-1", "bizbuysell", enqueue)
+	if err != nil || !replayed || id != 101 {
+		t.Fatalf("repeat Do = (%d, %v, %v), want (101, true, nil)", id, replayed, err)
+	}
+	if calls != 1 {
+		t.Errorf("enqueue called %d times, want 1", calls)
+	}
+
+	if _, _, err := store.Do("key-1", "bizquest", enqueue); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Errorf("different fingerprint: err = %v, want ErrIdempotencyMismatch", err)
+	}
+
+	id, replayed, err = store.Do("key-2", "bizbuysell", enqueue)
+	if err != nil || replayed || id != 102 {
+		t.Errorf("new key Do = (%d, %v, %v), want (102, false, nil)", id, replayed, err)
+	}
+}
+
+func TestMemoryIdempotencyStoreDoesNotStoreFailures(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Hour)
+	boom := errors.New("boom")
+
+	if _, _, err := store.Do("key", "", func() (int64, error) { return 0, boom }); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want boom", err)
+	}
+
+	id, replayed, err := store.Do("key", "", func() (int64, error) { return 7, nil })
+	if err != nil || replayed || id != 7 {
+		t.Errorf("retry after failure = (%d, %v, %v), want (7, false, nil)", id, replayed, err)
+	}
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	store := NewMemoryIdempotencyStore(10 * time.Millisecond)
+	store.Do("key", "", func() (int64, error) { return 1, nil })
+
+	time.Sleep(20 * time.Millisecond)
+
+	id, replayed, _ := store.Do("key", "", func() (int64, error) { return 2, nil })
+	if replayed || id != 2 {
+		t.Errorf("after TTL = (%d, %v), want (2, false)", id, replayed)
+	}
+}
+
+func TestMemoryIdempotencyStoreConcurrent(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Hour)
+	var calls atomic.Int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Do("key", "", func() (int64, error) {
+				calls.Add(1)
+				time.Sleep(time.Millisecond)
+				return 1, nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("enqueue called %d times for concurrent retries, want 1", n)
+	}
+}
+
+func TestMemoryIdempotencyStoreEnqueueOutsideLock(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Hour)
+	defer store.Close()
+
+	release := make(chan struct{})
+	first := make(chan error, 1)
+	started := make(chan struct{})
+	go func() {
+		_, _, err := store.Do("slow", "", func() (int64, error) {
+			close(started)
+			<-release
+			return 0, errors.New("boom")
+		})
+		first <- err
+	}()
+	<-started
+
+	// Other keys don't wait on a slow enqueue
+	done := make(chan struct{})
+	go func() {
+		store.Do("other", "", func() (int64, error) { return 2, nil })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Do of another key blocked behind a slow enqueue")
+	}
+
+	// A retry of the slow key waits for it, then enqueues itself once it failed
+	retry := make(chan int64, 1)
+	go func() {
+		id, _, _ := store.Do("slow", "", func() (int64, error) { return 3, nil })
+		retry <- id
+	}()
+	close(release)
+	if err := <-first; err == nil {
+		t.Error("first Do succeeded, want its enqueue error")
+	}
+	if id := <-retry; id != 3 {
+		t.Errorf("retry job = %d, want 3 from its own enqueue", id)
+	}
+}
@@ -1,27 +1,13 @@
 package middleware
 
 import (
-	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-// RequestLog represents a structured log entry for HTTP requests
-type RequestLog struct {
-	Timestamp   string `json:"timestamp"`
-	RequestID   string `json:"request_id"`
-	Method      string `json:"method"`
-	Path        string `json:"path"`
-	RemoteAddr  string `json:"remote_addr"`
-	UserAgent   string `json:"user_agent"`
-	StatusCode  int    `json:"status_code"`
-	Bytes       int    `json:"bytes"`
-	DurationMs  int64  `json:"duration_ms"`
-}
-
 // responseWriter wraps http.ResponseWriter to capture status code and bytes
 type responseWriter struct {
 	http.ResponseWriter
@@ -40,46 +26,49 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
-// StructuredLogger is a middleware that logs requests in JSON format
-func StructuredLogger(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		// Wrap response writer to capture status and bytes
-		wrapped := &responseWriter{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK,
-		}
+// Flush passes flushes through so streamed responses aren't held back
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
 
-		// Process request
-		next.ServeHTTP(wrapped, r)
+// Unwrap exposes the wrapped writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
 
-		// Calculate duration
-		duration := time.Since(start)
+// StructuredLogger logs each request to logger, in the same JSON format as the
+// scraper worker. Server errors are logged at error level.
+func StructuredLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
 
-		// Get request ID from context
-		requestID := middleware.GetReqID(r.Context())
+			// Wrap response writer to capture status and bytes
+			wrapped := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
 
-		// Create log entry
-		entry := RequestLog{
-			Timestamp:   time.Now().UTC().Format(time.RFC3339),
-			RequestID:   requestID,
-			Method:      r.Method,
-			Path:        r.URL.Path,
-			RemoteAddr:  r.RemoteAddr,
-			UserAgent:   r.UserAgent(),
-			StatusCode:  wrapped.statusCode,
-			Bytes:       wrapped.bytes,
-			DurationMs:  duration.Milliseconds(),
-		}
+			// Process request
+			next.ServeHTTP(wrapped, r)
 
-		// Log as JSON
-		logBytes, err := json.Marshal(entry)
-		if err != nil {
-			log.Printf("Error marshaling log entry: %v", err)
-			return
-		}
+			level := slog.LevelInfo
+			if wrapped.statusCode >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
 
-		log.Println(string(logBytes))
-	})
+			logger.LogAttrs(r.Context(), level, "request",
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("user_agent", r.UserAgent()),
+				slog.Int("status_code", wrapped.statusCode),
+				slog.Int("bytes", wrapped.bytes),
+				slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+			)
+		})
+	}
 }
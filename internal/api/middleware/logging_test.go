@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestStructuredLogger(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantLevel string
+	}{
+		{http.StatusOK, "INFO"},
+		{http.StatusInternalServerError, "ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+			handler := middleware.RequestID(StructuredLogger(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte("hello"))
+			})))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/listings", nil))
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("log is not a JSON object: %v: %s", err, buf.String())
+			}
+			if entry["level"] != tt.wantLevel {
+				t.Errorf("level = %v, want %s", entry["level"], tt.wantLevel)
+			}
+			if entry["path"] != "/api/v1/listings" || entry["status_code"] != float64(tt.status) || entry["bytes"] != float64(5) {
+				t.Errorf("entry = %v", entry)
+			}
+			if id, _ := entry["request_id"].(string); id == "" {
+				t.Error("request_id missing")
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -12,25 +14,47 @@ type RateLimiter struct {
 	mu       sync.RWMutex
 	limit    int
 	window   time.Duration
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-// NewRateLimiter creates a new rate limiter
+// NewRateLimiter creates a new rate limiter. Close stops its cleanup of old
+// entries.
 func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
 	rl := &RateLimiter{
 		requests: make(map[string][]time.Time),
 		limit:    limit,
 		window:   window,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
 	}
+	go cleanupEvery(time.Minute, rl.stop, rl.done, rl.cleanup)
+	return rl
+}
 
-	// Cleanup old entries periodically
-	go func() {
-		ticker := time.NewTicker(time.Minute)
-		for range ticker.C {
-			rl.cleanup()
-		}
-	}()
+// Close stops the periodic cleanup. Calling it more than once is a no-op.
+func (rl *RateLimiter) Close() error {
+	rl.closeOnce.Do(func() { close(rl.stop) })
+	<-rl.done
+	return nil
+}
 
-	return rl
+// cleanupEvery calls cleanup every interval until stop is closed, then
+// closes done
+func cleanupEvery(interval time.Duration, stop <-chan struct{}, done chan<- struct{}, cleanup func()) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			cleanup()
+		}
+	}
 }
 
 // Allow checks if a request is allowed for the given key
@@ -64,6 +88,34 @@ func (rl *RateLimiter) Allow(key string) bool {
 	return true
 }
 
+// Limit returns the number of requests allowed per window
+func (rl *RateLimiter) Limit() int {
+	return rl.limit
+}
+
+// RetryAfter returns how long the key must wait before its next request is
+// allowed, or zero if it is under the limit
+func (rl *RateLimiter) RetryAfter(key string) time.Duration {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	now := time.Now()
+	windowStart := now.Add(-rl.window)
+
+	var valid []time.Time
+	for _, t := range rl.requests[key] {
+		if t.After(windowStart) {
+			valid = append(valid, t)
+		}
+	}
+	if len(valid) < rl.limit {
+		return 0
+	}
+
+	// A slot frees up once the request that put the key at the limit ages out
+	return valid[len(valid)-rl.limit].Add(rl.window).Sub(now)
+}
+
 // cleanup removes old entries
 func (rl *RateLimiter) cleanup() {
 	rl.mu.Lock()
@@ -90,12 +142,12 @@ func (rl *RateLimiter) cleanup() {
 // Middleware returns an HTTP middleware that rate limits requests
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Use IP as key (in production, consider X-Forwarded-For)
+		// The client's IP, as set by RealIP
 		key := r.RemoteAddr
 
 		if !rl.Allow(key) {
+			SetRateLimitHeaders(w, rl, key)
 			w.Header().Set("Content-Type", "application/json")
-			w.Header().Set("Retry-After", "60")
 			w.WriteHeader(http.StatusTooManyRequests)
 			w.Write([]byte(`{"error":"Too many requests","code":"rate_limited"}`))
 			return
@@ -104,3 +156,19 @@ func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// SetRateLimitHeaders sets Retry-After and the X-RateLimit-* headers on a
+// rate-limited response for key. X-RateLimit-Reset is a Unix timestamp.
+func SetRateLimitHeaders(w http.ResponseWriter, l Limiter, key string) {
+	wait := l.RetryAfter(key)
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	h := w.Header()
+	h.Set("Retry-After", strconv.Itoa(seconds))
+	h.Set("X-RateLimit-Limit", strconv.Itoa(l.Limit()))
+	h.Set("X-RateLimit-Remaining", "0")
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Duration(seconds)*time.Second).Unix(), 10))
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Limiter decides whether a request identified by key may proceed
+type Limiter interface {
+	Allow(key string) bool
+	// Limit returns the number of requests allowed per window
+	Limit() int
+	// RetryAfter returns how long key must wait before its next request is
+	// allowed, or zero if it is under the limit
+	RetryAfter(key string) time.Duration
+}
+
+// PGRateLimiter implements a fixed-window rate limiter backed by the
+// rate_limits table, so the limit holds across multiple API replicas
+type PGRateLimiter struct {
+	db     *sqlx.DB
+	name   string
+	limit  int
+	window time.Duration
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPGRateLimiter creates a Postgres-backed rate limiter. The name namespaces
+// keys so several limiters can share the table. Close stops its cleanup of
+// expired buckets.
+func NewPGRateLimiter(db *sqlx.DB, name string, limit int, window time.Duration) *PGRateLimiter {
+	rl := &PGRateLimiter{
+		db:     db,
+		name:   name,
+		limit:  limit,
+		window: window,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go cleanupEvery(time.Minute, rl.stop, rl.done, rl.cleanup)
+	return rl
+}
+
+// Close stops the periodic cleanup, waiting for a running one to finish.
+// Calling it more than once is a no-op.
+func (rl *PGRateLimiter) Close() error {
+	rl.closeOnce.Do(func() { close(rl.stop) })
+	<-rl.done
+	return nil
+}
+
+// Allow checks if a request is allowed for the given key. If the database
+// is unavailable the request is denied, since the limited operations are expensive.
+func (rl *PGRateLimiter) Allow(key string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// Start a new window if the current one has expired, otherwise count the hit
+	var count int
+	err := rl.db.GetContext(ctx, &count, `
+		INSERT INTO rate_limits (key, window_start, count) VALUES ($1, NOW(), 1)
+		ON CONFLICT (key) DO UPDATE SET
+			window_start = CASE WHEN rate_limits.window_start <= NOW() - make_interval(secs => $2)
+				THEN NOW() ELSE rate_limits.window_start END,
+			count = CASE WHEN rate_limits.window_start <= NOW() - make_interval(secs => $2)
+				THEN 1 ELSE rate_limits.count + 1 END
+		RETURNING count
+	`, rl.name+":"+key, rl.window.Seconds())
+	if err != nil {
+		log.Printf("Rate limiter error for %s: %v", rl.name, err)
+		return false
+	}
+
+	return count <= rl.limit
+}
+
+// Limit returns the number of requests allowed per window
+func (rl *PGRateLimiter) Limit() int {
+	return rl.limit
+}
+
+// RetryAfter returns how long the key must wait for its window to reset, or
+// zero if it is under the limit. If the database is unavailable the full
+// window is assumed.
+func (rl *PGRateLimiter) RetryAfter(key string) time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var seconds float64
+	err := rl.db.GetContext(ctx, &seconds, `
+		SELECT GREATEST(EXTRACT(EPOCH FROM window_start + make_interval(secs => $2) - NOW()), 0)
+		FROM rate_limits
+		WHERE key = $1 AND count >= $3
+	`, rl.name+":"+key, rl.window.Seconds(), rl.limit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0
+	}
+	if err != nil {
+		log.Printf("Rate limiter retry-after error for %s: %v", rl.name, err)
+		return rl.window
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// cleanup removes expired buckets
+func (rl *PGRateLimiter) cleanup() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := rl.db.ExecContext(ctx, `
+		DELETE FROM rate_limits
+		WHERE key LIKE $1 AND window_start <= NOW() - make_interval(secs => $2)
+	`, rl.name+":%", rl.window.Seconds())
+	if err != nil {
+		log.Printf("Rate limiter cleanup error for %s: %v", rl.name, err)
+	}
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+func TestPGRateLimiterSharedAcrossInstances(t *testing.T) {
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sqlx.Connect("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	defer db.Close()
+
+	name := "test-" + uuid.NewString()
+	defer db.Exec("DELETE FROM rate_limits WHERE key LIKE $1", name+":%")
+
+	// Two limiters with the same name simulate two API replicas
+	a := NewPGRateLimiter(db, name, 2, time.Hour)
+	b := NewPGRateLimiter(db, name, 2, time.Hour)
+
+	if !a.Allow("1.2.3.4") {
+		t.Fatal("first request denied")
+	}
+	if !b.Allow("1.2.3.4") {
+		t.Fatal("second request denied")
+	}
+	if a.Allow("1.2.3.4") || b.Allow("1.2.3.4") {
+		t.Error("requests over the limit were allowed")
+	}
+	if !a.Allow("5.6.7.8") {
+		t.Error("different key was denied")
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	rl := NewRateLimiter(1, time.Hour)
+
+	if !rl.Allow("a") {
+		t.Fatal("first request denied")
+	}
+	if rl.Allow("a") {
+		t.Error("second request allowed")
+	}
+	if !rl.Allow("b") {
+		t.Error("different key denied")
+	}
+}
+
+func TestRateLimiterRetryAfter(t *testing.T) {
+	rl := NewRateLimiter(2, time.Hour)
+
+	rl.Allow("a")
+	if wait := rl.RetryAfter("a"); wait != 0 {
+		t.Errorf("RetryAfter under the limit = %v, want 0", wait)
+	}
+	rl.Allow("a")
+	if wait := rl.RetryAfter("a"); wait <= 59*time.Minute || wait > time.Hour {
+		t.Errorf("RetryAfter at the limit = %v, want about 1h", wait)
+	}
+}
+
+func TestRateLimiterMiddlewareHeaders(t *testing.T) {
+	rl := NewRateLimiter(1, 10*time.Minute)
+	h := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "600" {
+		t.Errorf("Retry-After = %q, want 600", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("X-RateLimit-Limit = %q, want 1", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", got)
+	}
+	reset, err := strconv.ParseInt(rec.Header().Get("X-RateLimit-Reset"), 10, 64)
+	if want := time.Now().Add(10 * time.Minute).Unix(); err != nil || reset < want-2 || reset > want+2 {
+		t.Errorf("X-RateLimit-Reset = %q, want about %d", rec.Header().Get("X-RateLimit-Reset"), want)
+	}
+}
+
+func TestRateLimiterCloseStopsCleanup(t *testing.T) {
+	for name, rl := range map[string]io.Closer{
+		"memory":   NewRateLimiter(1, time.Hour),
+		"postgres": NewPGRateLimiter(nil, "test", 1, time.Hour),
+	} {
+		closed := make(chan struct{})
+		go func() {
+			rl.Close()
+			// A second Close is a no-op
+			rl.Close()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Errorf("%s: Close did not return", name)
+		}
+	}
+}
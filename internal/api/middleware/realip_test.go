@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct", "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"spoofed forwarded for", "192.0.2.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.9"}, "192.0.2.1"},
+		{"spoofed real ip", "192.0.2.1:1234", map[string]string{"X-Real-IP": "198.51.100.9"}, "192.0.2.1"},
+		{"proxy real ip", "10.0.0.2:5678", map[string]string{"X-Real-IP": "198.51.100.9"}, "198.51.100.9"},
+		// The client can prepend anything; the proxy appends what it saw
+		{"proxy forwarded for", "10.0.0.2:5678", map[string]string{"X-Forwarded-For": "203.0.113.5, 198.51.100.9"}, "198.51.100.9"},
+		{"proxy chain", "10.0.0.2:5678", map[string]string{"X-Forwarded-For": "198.51.100.9, 10.0.0.3"}, "198.51.100.9"},
+		{"proxy without headers", "10.0.0.2:5678", nil, "10.0.0.2"},
+		{"proxy with garbage", "10.0.0.2:5678", map[string]string{"X-Forwarded-For": "unknown"}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+			r := httptest.NewRequest("GET", "/api/v1/listings", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := ParseTrustedProxies([]string{"10.1.2.3/8", "192.0.2.7", "::1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+	want := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.7/32"), netip.MustParsePrefix("::1/128")}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("prefix %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"nginx", "10.0.0.0/33"} {
+		if _, err := ParseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded, want an error", bad)
+		}
+	}
+}
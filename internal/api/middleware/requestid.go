@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader is the response header carrying the request's ID
+const RequestIDHeader = "X-Request-ID"
+
+// EchoRequestID sends the ID chi's RequestID middleware gave the request back
+// in the X-Request-ID header, so clients can quote it and it can be traced
+// through logs and the jobs the request queued. It must run after RequestID.
+func EchoRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestEchoRequestID(t *testing.T) {
+	var seen string
+	handler := middleware.RequestID(EchoRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middleware.GetReqID(r.Context())
+	})))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/listings", nil))
+	if got := rec.Header().Get(RequestIDHeader); got == "" || got != seen {
+		t.Errorf("X-Request-ID = %q, want the generated ID %q", got, seen)
+	}
+
+	// A client's own ID is kept
+	r := httptest.NewRequest("GET", "/api/v1/listings", nil)
+	r.Header.Set("X-Request-ID", "client-7f3a")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if got := rec.Header().Get(RequestIDHeader); got != "client-7f3a" || seen != "client-7f3a" {
+		t.Errorf("X-Request-ID = %q, handler saw %q; want client-7f3a for both", got, seen)
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MediaTypeV2 is the Accept header value that selects v2 responses on /api/v1 routes
+const MediaTypeV2 = "application/vnd.trough.v2+json"
+
+type versionKey struct{}
+
+// APIVersion returns a middleware that records the response version handlers
+// should write. Requests use version, or 2 when they accept MediaTypeV2.
+func APIVersion(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			v := version
+			if acceptsMediaType(r.Header.Get("Accept"), MediaTypeV2) {
+				v = 2
+			}
+			if version < 2 {
+				// The response shape depends on Accept, so caches must key on it
+				w.Header().Add("Vary", "Accept")
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, v)))
+		})
+	}
+}
+
+// ResponseVersion returns the response version set by APIVersion, 1 if unset
+func ResponseVersion(ctx context.Context) int {
+	if v, ok := ctx.Value(versionKey{}).(int); ok {
+		return v
+	}
+	return 1
+}
+
+// acceptsMediaType reports whether the Accept header lists the media type
+func acceptsMediaType(accept, mediaType string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mt != mediaType {
+			continue
+		}
+		// q=0 means the client refuses the type
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
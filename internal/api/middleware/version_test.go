@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		accept  string
+		want    int
+	}{
+		{"v1 default", 1, "", 1},
+		{"v1 plain json", 1, "application/json", 1},
+		{"v1 accepts v2", 1, MediaTypeV2, 2},
+		{"v1 accepts v2 among others", 1, "application/json;q=0.5, " + MediaTypeV2 + ";q=0.9", 2},
+		{"v1 refuses v2", 1, MediaTypeV2 + ";q=0", 1},
+		{"v2 prefix", 2, "application/json", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got int
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ResponseVersion(r.Context())
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+
+			APIVersion(tt.version)(next).ServeHTTP(rec, req)
+
+			if got != tt.want {
+				t.Errorf("ResponseVersion = %d, want %d", got, tt.want)
+			}
+			if vary := rec.Header().Get("Vary"); (vary == "Accept") != (tt.version == 1) {
+				t.Errorf("Vary = %q", vary)
+			}
+		})
+	}
+}
+
+func TestResponseVersionDefault(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if v := ResponseVersion(req.Context()); v != 1 {
+		t.Errorf("ResponseVersion without middleware = %d, want 1", v)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// recoverer turns a handler panic into a JSON 500 carrying the request ID.
+// The stack goes to the log, never to the client. It must sit inside the
+// metrics and logging middleware so they still see the 500.
+func recoverer(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// net/http's sentinel for aborting a response; let the server handle it
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				requestID := middleware.GetReqID(r.Context())
+				logger.Error("panic recovered",
+					"panic", fmt.Sprint(rec),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"request_id", requestID,
+					"stack", string(debug.Stack()),
+				)
+
+				// Once the handler has started the response the status can't change
+				if ww.Status() != 0 {
+					return
+				}
+				WriteError(ww, NewAPIError(http.StatusInternalServerError, "Internal server error"), requestID)
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
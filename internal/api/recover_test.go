@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+
+	mw "github.com/kbsch/trough/internal/api/middleware"
+)
+
+func TestRecovererWritesJSON(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	// Same order as setupRoutes
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(mw.Metrics)
+	r.Use(mw.StructuredLogger(logger))
+	r.Use(recoverer(logger))
+	r.Get("/test/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	before := requestsTotal(t, "/test/panic", "500")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test/panic", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var body APIError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v\n%s", err, rec.Body.String())
+	}
+	if body.Message != "Internal server error" || body.RequestID == "" {
+		t.Errorf("body = %+v, want the internal error with a request ID", body)
+	}
+	if strings.Contains(rec.Body.String(), "goroutine") || strings.Contains(rec.Body.String(), "boom") {
+		t.Errorf("body leaks panic details: %s", rec.Body.String())
+	}
+
+	if !strings.Contains(logs.String(), `"msg":"panic recovered"`) || !strings.Contains(logs.String(), "goroutine") {
+		t.Errorf("panic and stack not logged: %s", logs.String())
+	}
+	if got := requestsTotal(t, "/test/panic", "500"); got != before+1 {
+		t.Errorf("500s recorded = %v, want %v", got, before+1)
+	}
+}
+
+func TestRecovererAfterResponseStarted(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+	h := recoverer(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// The status is already sent; the body must not get an error appended
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+		t.Errorf("got %d %q, want the original response untouched", rec.Code, rec.Body.String())
+	}
+}
+
+// requestsTotal reads trough_http_requests_total for a GET route and status
+func requestsTotal(t *testing.T, path, status string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "trough_http_requests_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["method"] == http.MethodGet && labels["path"] == path && labels["status"] == status {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	mw "github.com/kbsch/trough/internal/api/middleware"
+	"github.com/kbsch/trough/internal/config"
+)
+
+func TestAPIVersionRoutes(t *testing.T) {
+	s, err := NewServer(config.Defaults(), nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		accept   string
+		wantVary bool
+	}{
+		{"/api/v1/listings/not-a-uuid", "", true},
+		{"/api/v1/listings/not-a-uuid", mw.MediaTypeV2, true},
+		{"/api/v2/listings/not-a-uuid", "", false},
+	}
+
+	// Invalid IDs are rejected before touching the database, so both prefixes
+	// must route to the same handler without one
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if vary := slices.Contains(rec.Header().Values("Vary"), "Accept"); vary != tt.wantVary {
+				t.Errorf("Vary: Accept = %v, want %v", vary, tt.wantVary)
+			}
+		})
+	}
+}
+
+func TestAuthenticatedRoutesNoStore(t *testing.T) {
+	s, err := NewServer(config.Defaults(), nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rejected for the missing key before touching the database
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/listings/not-a-uuid/raw", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "private, no-store" {
+		t.Errorf("Cache-Control = %q, want private, no-store", got)
+	}
+}
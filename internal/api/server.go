@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ServerConfig tunes the http.Server ListenAndServe runs
+type ServerConfig struct {
+	// ReadHeaderTimeout bounds reading a request's headers, so slow clients
+	// (slowloris) can't hold connections open; ReadTimeout bounds the whole
+	// request and WriteTimeout the response
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	// IdleTimeout closes keep-alive connections idle this long
+	IdleTimeout time.Duration
+	// ShutdownTimeout is how long in-flight requests get to finish after
+	// SIGINT or SIGTERM
+	ShutdownTimeout time.Duration
+
+	// TLSCertFile and TLSKeyFile, if set, serve HTTPS with TLS 1.2 or later
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// DefaultServerConfig is the ServerConfig the API runs with unless its
+// HTTP_* variables say otherwise
+var DefaultServerConfig = ServerConfig{
+	ReadHeaderTimeout: 5 * time.Second,
+	ReadTimeout:       15 * time.Second,
+	WriteTimeout:      15 * time.Second,
+	IdleTimeout:       60 * time.Second,
+	ShutdownTimeout:   30 * time.Second,
+}
+
+// httpServer returns the http.Server serving s on addr with cfg's timeouts
+func (s *Server) httpServer(addr string, cfg ServerConfig) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if cfg.TLSCertFile != "" {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return srv
+}
+
+// ListenAndServe serves the API on addr until SIGINT or SIGTERM, then shuts
+// down gracefully, giving in-flight requests cfg.ShutdownTimeout to finish
+func (s *Server) ListenAndServe(addr string, cfg ServerConfig) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(ctx, ln, cfg)
+}
+
+// serve serves the API on ln until ctx is done, then shuts down
+func (s *Server) serve(ctx context.Context, ln net.Listener, cfg ServerConfig) error {
+	srv := s.httpServer(ln.Addr().String(), cfg)
+
+	errc := make(chan error, 1)
+	go func() {
+		s.logger.Info("starting server", "addr", ln.Addr().String(), "tls", cfg.TLSCertFile != "")
+		if cfg.TLSCertFile != "" {
+			errc <- srv.ServeTLS(ln, cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			errc <- srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	s.logger.Info("server stopped")
+	return nil
+}
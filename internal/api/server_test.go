@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kbsch/trough/internal/config"
+)
+
+func TestHTTPServerTimeouts(t *testing.T) {
+	s, err := NewServer(config.Defaults(), nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := s.httpServer(":8080", DefaultServerConfig)
+	if srv.ReadHeaderTimeout != 5*time.Second || srv.ReadTimeout != 15*time.Second ||
+		srv.WriteTimeout != 15*time.Second || srv.IdleTimeout != 60*time.Second {
+		t.Errorf("timeouts: read header %v, read %v, write %v, idle %v",
+			srv.ReadHeaderTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+	if srv.Handler != s || srv.TLSConfig != nil {
+		t.Errorf("handler = %v, TLS config = %v; want the server and no TLS", srv.Handler, srv.TLSConfig)
+	}
+
+	cfg := DefaultServerConfig
+	cfg.ReadHeaderTimeout = 2 * time.Second
+	cfg.TLSCertFile, cfg.TLSKeyFile = "cert.pem", "key.pem"
+	srv = s.httpServer(":8443", cfg)
+	if srv.ReadHeaderTimeout != 2*time.Second {
+		t.Errorf("ReadHeaderTimeout = %v, want 2s", srv.ReadHeaderTimeout)
+	}
+	if srv.TLSConfig == nil || srv.TLSConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("TLS config = %+v, want TLS 1.2 or later", srv.TLSConfig)
+	}
+}
+
+func TestServeShutsDown(t *testing.T) {
+	s, err := NewServer(config.Defaults(), nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.serve(ctx, ln, DefaultServerConfig) }()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// A signal cancels the context; serve returns once shut down
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve = %v, want nil after shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve didn't return after shutdown")
+	}
+}
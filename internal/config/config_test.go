@@ -0,0 +1,223 @@
+package config
+
+import (
+	"errors"
+	"log/slog"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kbsch/trough/internal/database"
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// env returns a getenv reading from vars
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, Defaults()) {
+		t.Errorf("got %+v, want the defaults %+v", cfg, Defaults())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := load(env(map[string]string{
+		"DATABASE_URL":             "postgres://u:p@db:5432/trough",
+		"DATABASE_REPLICA_URLS":    "postgres://u:p@replica1:5432/trough, postgres://u:p@replica2:5432/trough",
+		"DB_MAX_OPEN_CONNS":        "50",
+		"DB_MAX_IDLE_CONNS":        " 10 ",
+		"DB_CONN_MAX_LIFETIME":     "30m",
+		"LOG_LEVEL":                "debug",
+		"PORT":                     "9000",
+		"API_KEYS":                 "k1, ,k2",
+		"CORS_ALLOWED_ORIGINS":     " https://a.example.com, ,https://b.example.com ",
+		"SEARCH_SORTS":             "revenue_desc:revenue:desc",
+		"DEFAULT_SORT":             "revenue_desc",
+		"SEARCH_MAX_ROWS":          "500",
+		"MAX_DESCRIPTION_LENGTH":   "4000",
+		"SEARCH_CACHE_MAX_AGE":     "5m",
+		"HTTP_READ_HEADER_TIMEOUT": "2s",
+		"HTTP_SHUTDOWN_TIMEOUT":    "10s",
+		"TLS_CERT_FILE":            "/etc/trough/tls.crt",
+		"TLS_KEY_FILE":             "/etc/trough/tls.key",
+		"RATE_LIMIT_BACKEND":       "postgres",
+		"TRUSTED_PROXIES":          "10.0.0.0/8, 192.0.2.7",
+		"REPORT_RATE_LIMIT":        "5",
+		"REPORT_SOLD_THRESHOLD":    "0",
+		"REPORT_SOLD_ACTION":       "hide",
+		"SCRAPER_METRICS_PORT":     "9191",
+		"SCRAPE_WINDOW":            "12h",
+		"SCRAPE_CONCURRENCY":       "3",
+		"SCRAPE_GLOBAL_RPS":        "0.5",
+		"LISTING_METRICS_INTERVAL": "1m",
+		"SCRAPE_USER_AGENTS":       "Mozilla/5.0 (Macintosh; rv:133.0) Firefox/133.0 | Mozilla/5.0 (X11; Linux x86_64) Chrome/131.0",
+		"ROD_BROWSER_PATH":         "/usr/bin/chromium",
+		"SCRAPER_COOKIE_DIR":       "/var/lib/trough/cookies",
+		"ROD_PAGE_RECYCLE_AFTER":   "25",
+		"ALERT_WEBHOOK_URL":        "https://hooks.example.com/scrapes",
+		"ALERT_EMAIL_TO":           "ops@example.com, data@example.com",
+		"ALERT_EMAIL_FROM":         "trough@example.com",
+		"SMTP_ADDR":                "smtp.example.com:587",
+		"ALERT_THROTTLE":           "6h",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.DatabaseURL != "postgres://u:p@db:5432/trough" {
+		t.Errorf("DatabaseURL = %q", cfg.DatabaseURL)
+	}
+	if !reflect.DeepEqual(cfg.DatabaseReplicaURLs, []string{"postgres://u:p@replica1:5432/trough", "postgres://u:p@replica2:5432/trough"}) {
+		t.Errorf("DatabaseReplicaURLs = %q", cfg.DatabaseReplicaURLs)
+	}
+	if want := (database.PoolConfig{MaxOpenConns: 50, MaxIdleConns: 10, ConnMaxLifetime: 30 * time.Minute}); cfg.DBPool != want {
+		t.Errorf("DBPool = %+v, want %+v", cfg.DBPool, want)
+	}
+	if cfg.LogLevel != slog.LevelDebug || cfg.Port != "9000" || cfg.MetricsPort != "9191" {
+		t.Errorf("LogLevel = %v, Port = %q, MetricsPort = %q", cfg.LogLevel, cfg.Port, cfg.MetricsPort)
+	}
+	if !reflect.DeepEqual(cfg.APIKeys, []string{"k1", "k2"}) {
+		t.Errorf("APIKeys = %v, want [k1 k2]", cfg.APIKeys)
+	}
+	if !reflect.DeepEqual(cfg.CORSOrigins, []string{"https://a.example.com", "https://b.example.com"}) {
+		t.Errorf("CORSOrigins = %v, want the two trimmed origins", cfg.CORSOrigins)
+	}
+	if cfg.DefaultSort != "revenue_desc" || len(cfg.SearchSorts) != 1 {
+		t.Errorf("DefaultSort = %q, SearchSorts = %v", cfg.DefaultSort, cfg.SearchSorts)
+	}
+	if cfg.SearchMaxRows != 500 || cfg.SearchCacheMaxAge != 5*time.Minute {
+		t.Errorf("SearchMaxRows = %d, SearchCacheMaxAge = %v; want 500, 5m", cfg.SearchMaxRows, cfg.SearchCacheMaxAge)
+	}
+	if cfg.MaxDescriptionLen != 4000 {
+		t.Errorf("MaxDescriptionLen = %d, want 4000", cfg.MaxDescriptionLen)
+	}
+	if cfg.HTTPReadHeaderTimeout != 2*time.Second || cfg.HTTPShutdownTimeout != 10*time.Second || cfg.HTTPWriteTimeout != 0 {
+		t.Errorf("HTTPReadHeaderTimeout = %v, HTTPShutdownTimeout = %v, HTTPWriteTimeout = %v; want 2s, 10s, unset",
+			cfg.HTTPReadHeaderTimeout, cfg.HTTPShutdownTimeout, cfg.HTTPWriteTimeout)
+	}
+	if cfg.TLSCertFile != "/etc/trough/tls.crt" || cfg.TLSKeyFile != "/etc/trough/tls.key" {
+		t.Errorf("TLSCertFile = %q, TLSKeyFile = %q", cfg.TLSCertFile, cfg.TLSKeyFile)
+	}
+	if cfg.RateLimitBackend != RateLimitPostgres {
+		t.Errorf("RateLimitBackend = %q, want postgres", cfg.RateLimitBackend)
+	}
+	if want := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.7/32")}; !reflect.DeepEqual(cfg.TrustedProxies, want) {
+		t.Errorf("TrustedProxies = %v, want %v", cfg.TrustedProxies, want)
+	}
+	if cfg.ReportRateLimit != 5 || cfg.ReportSoldThreshold != 0 || cfg.ReportSoldAction != domain.ReportActionHide {
+		t.Errorf("ReportRateLimit = %d, ReportSoldThreshold = %d, ReportSoldAction = %q; want 5, 0, hide",
+			cfg.ReportRateLimit, cfg.ReportSoldThreshold, cfg.ReportSoldAction)
+	}
+	if cfg.ScrapeWindow != 12*time.Hour || cfg.ScrapeConcurrency != 3 || cfg.ScrapeGlobalRPS != 0.5 {
+		t.Errorf("ScrapeWindow = %v, ScrapeConcurrency = %d, ScrapeGlobalRPS = %v; want 12h, 3, 0.5", cfg.ScrapeWindow, cfg.ScrapeConcurrency, cfg.ScrapeGlobalRPS)
+	}
+	if cfg.ListingMetricsInterval != time.Minute {
+		t.Errorf("ListingMetricsInterval = %v, want 1m", cfg.ListingMetricsInterval)
+	}
+	// User agents contain commas, so the list is "|"-separated
+	if len(cfg.UserAgents) != 2 || !strings.HasSuffix(cfg.UserAgents[0], "Firefox/133.0") {
+		t.Errorf("UserAgents = %q", cfg.UserAgents)
+	}
+	if cfg.BrowserPath != "/usr/bin/chromium" || cfg.CookieDir != "/var/lib/trough/cookies" {
+		t.Errorf("BrowserPath = %q, CookieDir = %q", cfg.BrowserPath, cfg.CookieDir)
+	}
+	if cfg.PageRecycleAfter != 25 {
+		t.Errorf("PageRecycleAfter = %d, want 25", cfg.PageRecycleAfter)
+	}
+	if cfg.AlertWebhookURL != "https://hooks.example.com/scrapes" || len(cfg.AlertEmailTo) != 2 ||
+		cfg.SMTPAddr != "smtp.example.com:587" || cfg.AlertThrottle != 6*time.Hour {
+		t.Errorf("AlertWebhookURL = %q, AlertEmailTo = %q, SMTPAddr = %q, AlertThrottle = %v",
+			cfg.AlertWebhookURL, cfg.AlertEmailTo, cfg.SMTPAddr, cfg.AlertThrottle)
+	}
+}
+
+func TestLoadStealthProfilesFile(t *testing.T) {
+	cfg, err := load(env(map[string]string{"SCRAPE_STEALTH_PROFILES": " /etc/trough/stealth.json "}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StealthProfilesFile != "/etc/trough/stealth.json" {
+		t.Errorf("StealthProfilesFile = %q", cfg.StealthProfilesFile)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]string
+		want string // the reported problem starts with this
+	}{
+		{"database url", map[string]string{"DATABASE_URL": "postgres://db:notaport/trough"}, "DATABASE_URL:"},
+		{"replica url", map[string]string{"DATABASE_REPLICA_URLS": "postgres://replica:5432/trough,postgres://db:notaport/trough"}, "DATABASE_REPLICA_URLS:"},
+		{"negative pool size", map[string]string{"DB_MAX_IDLE_CONNS": "-1"}, "DB_MAX_IDLE_CONNS:"},
+		{"pool size not a number", map[string]string{"DB_MAX_OPEN_CONNS": "lots"}, "DB_MAX_OPEN_CONNS:"},
+		{"lifetime without unit", map[string]string{"DB_CONN_MAX_LIFETIME": "5"}, "DB_CONN_MAX_LIFETIME:"},
+		{"log level", map[string]string{"LOG_LEVEL": "verbose"}, "LOG_LEVEL:"},
+		{"port", map[string]string{"PORT": "http"}, "PORT:"},
+		{"port out of range", map[string]string{"SCRAPER_METRICS_PORT": "70000"}, "SCRAPER_METRICS_PORT:"},
+		{"wildcard origin", map[string]string{"CORS_ALLOWED_ORIGINS": "https://ok.example.com,http://localhost:*"}, "CORS_ALLOWED_ORIGINS:"},
+		{"search sort", map[string]string{"SEARCH_SORTS": "by_title:title:asc"}, "SEARCH_SORTS:"},
+		{"default sort", map[string]string{"DEFAULT_SORT": "nope"}, "DEFAULT_SORT:"},
+		{"zero max rows", map[string]string{"SEARCH_MAX_ROWS": "0"}, "SEARCH_MAX_ROWS:"},
+		{"zero max description", map[string]string{"MAX_DESCRIPTION_LENGTH": "0"}, "MAX_DESCRIPTION_LENGTH:"},
+		{"cache max age without unit", map[string]string{"SEARCH_CACHE_MAX_AGE": "60"}, "SEARCH_CACHE_MAX_AGE:"},
+		{"short scrape window", map[string]string{"SCRAPE_WINDOW": "30s"}, "SCRAPE_WINDOW:"},
+		{"zero scrape concurrency", map[string]string{"SCRAPE_CONCURRENCY": "0"}, "SCRAPE_CONCURRENCY:"},
+		{"negative global rps", map[string]string{"SCRAPE_GLOBAL_RPS": "-1"}, "SCRAPE_GLOBAL_RPS:"},
+		{"global rps not a number", map[string]string{"SCRAPE_GLOBAL_RPS": "fast"}, "SCRAPE_GLOBAL_RPS:"},
+		{"rate limit backend", map[string]string{"RATE_LIMIT_BACKEND": "redis"}, "RATE_LIMIT_BACKEND:"},
+		{"trusted proxy", map[string]string{"TRUSTED_PROXIES": "nginx"}, "TRUSTED_PROXIES:"},
+		{"zero report rate limit", map[string]string{"REPORT_RATE_LIMIT": "0"}, "REPORT_RATE_LIMIT:"},
+		{"report sold action", map[string]string{"REPORT_SOLD_ACTION": "delete"}, "REPORT_SOLD_ACTION:"},
+		{"timeout without unit", map[string]string{"HTTP_READ_HEADER_TIMEOUT": "5"}, "HTTP_READ_HEADER_TIMEOUT:"},
+		{"tls cert without key", map[string]string{"TLS_CERT_FILE": "/etc/trough/tls.crt"}, "TLS_CERT_FILE, TLS_KEY_FILE:"},
+		{"alert webhook url", map[string]string{"ALERT_WEBHOOK_URL": "hooks.example.com/scrapes"}, "ALERT_WEBHOOK_URL:"},
+		{"alert email without smtp", map[string]string{"ALERT_EMAIL_TO": "ops@example.com"}, "ALERT_EMAIL_TO:"},
+		{"smtp addr without port", map[string]string{"SMTP_ADDR": "smtp.example.com"}, "SMTP_ADDR:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(env(tt.vars))
+			if cfg != nil {
+				t.Errorf("got config %+v, want nil", cfg)
+			}
+			var cfgErr *Error
+			if !errors.As(err, &cfgErr) {
+				t.Fatalf("error = %v, want *Error", err)
+			}
+			if len(cfgErr.Problems) != 1 || !strings.HasPrefix(cfgErr.Problems[0], tt.want) {
+				t.Errorf("problems = %q, want one starting with %q", cfgErr.Problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	_, err := load(env(map[string]string{
+		"PORT":               "0",
+		"LOG_LEVEL":          "loud",
+		"RATE_LIMIT_BACKEND": "redis",
+	}))
+	var cfgErr *Error
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	if len(cfgErr.Problems) != 3 {
+		t.Errorf("got %d problems, want 3: %v", len(cfgErr.Problems), cfgErr.Problems)
+	}
+	msg := err.Error()
+	for _, name := range []string{"PORT", "LOG_LEVEL", "RATE_LIMIT_BACKEND"} {
+		if !strings.Contains(msg, name) {
+			t.Errorf("error %q does not mention %s", msg, name)
+		}
+	}
+}
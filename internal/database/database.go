@@ -0,0 +1,65 @@
+// Package database opens the Postgres connection pools shared by the API, the
+// scraper worker and the CLI: sqlx for the repositories and pgx for River.
+package database
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// PoolConfig sizes a process's connection pools. Each pool gets its own
+// MaxOpenConns, so a process holds at most twice that many connections.
+type PoolConfig struct {
+	// MaxOpenConns caps open connections; 0 means unlimited for sqlx and the
+	// pgx default for the River pool
+	MaxOpenConns int
+	// MaxIdleConns is how many idle sqlx connections are kept for reuse
+	MaxIdleConns int
+	// ConnMaxLifetime closes connections older than this; 0 keeps them forever
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultPoolConfig is used for settings left unset in the environment; see
+// config.Load
+var DefaultPoolConfig = PoolConfig{
+	MaxOpenConns:    25,
+	MaxIdleConns:    5,
+	ConnMaxLifetime: 5 * time.Minute,
+}
+
+// Connect opens and pings the sqlx database with cfg applied
+func Connect(dbURL string, cfg PoolConfig) (*sqlx.DB, error) {
+	db, err := sqlx.Connect("postgres", dbURL)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
+
+// NewPgxPool creates the pgx pool for River with cfg applied. A process
+// should create one and share it; the pool connects lazily.
+func NewPgxPool(ctx context.Context, dbURL string, cfg PoolConfig) (*pgxpool.Pool, error) {
+	poolCfg, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	applyPgxConfig(poolCfg, cfg)
+	return pgxpool.NewWithConfig(ctx, poolCfg)
+}
+
+func applyPgxConfig(poolCfg *pgxpool.Config, cfg PoolConfig) {
+	if cfg.MaxOpenConns > 0 {
+		poolCfg.MaxConns = int32(min(cfg.MaxOpenConns, math.MaxInt32))
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.ConnMaxLifetime
+	}
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestApplyPgxConfig(t *testing.T) {
+	poolCfg, err := pgxpool.ParseConfig("postgres://trough@localhost:5432/trough")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultMax := poolCfg.MaxConns
+
+	// Zero values keep pgx's defaults
+	applyPgxConfig(poolCfg, PoolConfig{})
+	if poolCfg.MaxConns != defaultMax {
+		t.Errorf("MaxConns = %d, want default %d", poolCfg.MaxConns, defaultMax)
+	}
+
+	applyPgxConfig(poolCfg, PoolConfig{MaxOpenConns: 40, ConnMaxLifetime: 10 * time.Minute})
+	if poolCfg.MaxConns != 40 {
+		t.Errorf("MaxConns = %d, want 40", poolCfg.MaxConns)
+	}
+	if poolCfg.MaxConnLifetime != 10*time.Minute {
+		t.Errorf("MaxConnLifetime = %v, want 10m", poolCfg.MaxConnLifetime)
+	}
+}
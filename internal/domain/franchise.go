@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Franchise groups the resales of one franchise brand across sources
+type Franchise struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	Slug      string    `json:"slug" db:"slug"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+
+	// ListingCount is the number of active listings of the franchise
+	ListingCount int `json:"listing_count" db:"listing_count"`
+}
+
+var (
+	// franchiseLocationSuffix starts the location or other detail brokers
+	// append to a brand: "Subway - Dallas, TX", "Subway (Dallas)",
+	// "Subway in Dallas", "Subway, Dallas TX"
+	franchiseLocationSuffix = regexp.MustCompile(`(?i)\s+[-–—|]\s+|\s*[(,]|\s+(in|near)\s+`)
+	// franchiseNoise are words that don't tell brands apart
+	franchiseNoise = regexp.MustCompile(`(?i)\b(franchisee?s?|resales?|for\s+sale)\b`)
+	// franchiseUnitNumber is a store number: "#1234", "No. 12", "Unit 7", or
+	// a number ending the name
+	franchiseUnitNumber = regexp.MustCompile(`(?i)#\s*\d+|\b(no\.?|unit)\s*#?\s*\d+|\s\d+$`)
+	nonSlugChars        = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// NormalizeFranchiseName reduces a listing's franchise name to its brand,
+// dropping "Franchise" and the like, store numbers and a trailing location,
+// so resales of the same brand group together. slug identifies the brand;
+// both are empty if nothing is left.
+func NormalizeFranchiseName(raw string) (name, slug string) {
+	name = raw
+	if loc := franchiseLocationSuffix.FindStringIndex(name); loc != nil && loc[0] > 0 {
+		name = name[:loc[0]]
+	}
+	name = franchiseNoise.ReplaceAllString(name, " ")
+	name = franchiseUnitNumber.ReplaceAllString(name, " ")
+	name = strings.Trim(strings.Join(strings.Fields(name), " "), " -–—|:.,")
+
+	slug = strings.NewReplacer("'", "", "’", "", "&", " and ").Replace(strings.ToLower(name))
+	slug = strings.Trim(nonSlugChars.ReplaceAllString(slug, "-"), "-")
+	// "The UPS Store" and "UPS Store" are the same brand
+	slug = strings.TrimPrefix(slug, "the-")
+	if slug == "" {
+		return "", ""
+	}
+	return name, slug
+}
+
+// FranchiseKey returns the normalized brand a franchise resale is grouped
+// under; empty for listings that aren't franchises or name none
+func (l *Listing) FranchiseKey() (name, slug string) {
+	if l.FranchiseName == nil || (l.IsFranchise != nil && !*l.IsFranchise) {
+		return "", ""
+	}
+	return NormalizeFranchiseName(*l.FranchiseName)
+}
@@ -0,0 +1,48 @@
+package domain
+
+import "testing"
+
+func TestNormalizeFranchiseName(t *testing.T) {
+	tests := []struct {
+		raw, name, slug string
+	}{
+		{"Subway", "Subway", "subway"},
+		{"Subway Franchise - Dallas, TX", "Subway", "subway"},
+		{"SUBWAY #4521", "SUBWAY", "subway"},
+		{"Subway in Plano", "Subway", "subway"},
+		{"The UPS Store #1234", "The UPS Store", "ups-store"},
+		{"UPS Store", "UPS Store", "ups-store"},
+		{"McDonald's (Austin, TX)", "McDonald's", "mcdonalds"},
+		{"Great Clips Resale, Unit 12", "Great Clips", "great-clips"},
+		{"Baskin-Robbins & Dunkin' for sale", "Baskin-Robbins & Dunkin'", "baskin-robbins-and-dunkin"},
+		{"7-Eleven", "7-Eleven", "7-eleven"},
+		{"Franchise", "", ""},
+		{"  ", "", ""},
+	}
+	for _, tt := range tests {
+		name, slug := NormalizeFranchiseName(tt.raw)
+		if name != tt.name || slug != tt.slug {
+			t.Errorf("NormalizeFranchiseName(%q) = %q, %q; want %q, %q", tt.raw, name, slug, tt.name, tt.slug)
+		}
+	}
+}
+
+func TestListingFranchiseKey(t *testing.T) {
+	tests := []struct {
+		desc          string
+		isFranchise   *bool
+		franchiseName *string
+		want          string
+	}{
+		{"franchise resale", Ptr(true), StrPtr("Subway - Dallas"), "subway"},
+		{"franchise status unknown", nil, StrPtr("Subway"), "subway"},
+		{"not a franchise", Ptr(false), StrPtr("Subway"), ""},
+		{"no franchise name", Ptr(true), nil, ""},
+	}
+	for _, tt := range tests {
+		l := &Listing{IsFranchise: tt.isFranchise, FranchiseName: tt.franchiseName}
+		if _, slug := l.FranchiseKey(); slug != tt.want {
+			t.Errorf("%s: slug = %q, want %q", tt.desc, slug, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"strconv"
+	"time"
+)
+
+// Kinds of ListingChange events
+const (
+	ChangeEventPriceDrop     = "price_drop"
+	ChangeEventPriceIncrease = "price_increase"
+	ChangeEventPriceChange   = "price_change"
+	ChangeEventDeactivated   = "deactivated"
+	ChangeEventRelisted      = "relisted"
+	ChangeEventUpdated       = "updated"
+)
+
+// ListingChange is a change to one of a listing's tracked fields: its asking
+// price and range, revenue, cash flow, title, or whether it is active. Values
+// are the database's text form, nil when the field was empty.
+type ListingChange struct {
+	Field     string    `json:"field" db:"field"`
+	OldValue  *string   `json:"old_value" db:"old_value"`
+	NewValue  *string   `json:"new_value" db:"new_value"`
+	ChangedAt time.Time `json:"changed_at" db:"changed_at"`
+
+	// Event classifies the change for timelines; see SetEvent
+	Event string `json:"event" db:"-"`
+}
+
+// SetEvent classifies the change: an asking price that went down or up, one
+// set or cleared, a listing that went inactive or came back, or any other
+// update
+func (c *ListingChange) SetEvent() {
+	switch c.Field {
+	case "asking_price":
+		c.Event = ChangeEventPriceChange
+		oldPrice, oldErr := parseChangeValue(c.OldValue)
+		newPrice, newErr := parseChangeValue(c.NewValue)
+		if oldErr == nil && newErr == nil {
+			if newPrice < oldPrice {
+				c.Event = ChangeEventPriceDrop
+			} else if newPrice > oldPrice {
+				c.Event = ChangeEventPriceIncrease
+			}
+		}
+	case "is_active":
+		if c.NewValue != nil && *c.NewValue == "true" {
+			c.Event = ChangeEventRelisted
+		} else {
+			c.Event = ChangeEventDeactivated
+		}
+	default:
+		c.Event = ChangeEventUpdated
+	}
+}
+
+func parseChangeValue(v *string) (int64, error) {
+	if v == nil {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseInt(*v, 10, 64)
+}
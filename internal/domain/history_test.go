@@ -0,0 +1,27 @@
+package domain
+
+import "testing"
+
+func TestListingChangeSetEvent(t *testing.T) {
+	tests := []struct {
+		field    string
+		old, new *string
+		want     string
+	}{
+		{"asking_price", StrPtr("50000000"), StrPtr("45000000"), ChangeEventPriceDrop},
+		{"asking_price", StrPtr("45000000"), StrPtr("50000000"), ChangeEventPriceIncrease},
+		{"asking_price", nil, StrPtr("45000000"), ChangeEventPriceChange},
+		{"asking_price", StrPtr("45000000"), nil, ChangeEventPriceChange},
+		{"is_active", StrPtr("true"), StrPtr("false"), ChangeEventDeactivated},
+		{"is_active", StrPtr("false"), StrPtr("true"), ChangeEventRelisted},
+		{"title", StrPtr("Bakery"), StrPtr("Bakery & Cafe"), ChangeEventUpdated},
+		{"revenue", StrPtr("100"), StrPtr("90"), ChangeEventUpdated},
+	}
+	for _, tt := range tests {
+		c := ListingChange{Field: tt.field, OldValue: tt.old, NewValue: tt.new}
+		c.SetEvent()
+		if c.Event != tt.want {
+			t.Errorf("%s %v -> %v: event = %q, want %q", tt.field, tt.old, tt.new, c.Event, tt.want)
+		}
+	}
+}
@@ -2,15 +2,18 @@ package domain
 
 import (
 	"encoding/json"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // Pointer helpers for nullable fields
-func Ptr[T any](v T) *T { return &v }
+func Ptr[T any](v T) *T       { return &v }
 func StrPtr(s string) *string { return &s }
-func BoolPtr(b bool) *bool { return &b }
+func BoolPtr(b bool) *bool    { return &b }
 
 type Listing struct {
 	ID         uuid.UUID `json:"id" db:"id"`
@@ -27,6 +30,25 @@ type Listing struct {
 	EBITDA      *int64  `json:"ebitda,omitempty" db:"ebitda"`             // cents
 	Inventory   *int64  `json:"inventory_value,omitempty" db:"inventory_value"`
 
+	// High ends of figures given as a range, whose low end is in the field
+	// above; nil for a single or open-ended ("$500K+") value
+	AskingPriceMax *int64 `json:"asking_price_max,omitempty" db:"asking_price_max"`
+	RevenueMax     *int64 `json:"revenue_max,omitempty" db:"revenue_max"`
+	CashFlowMax    *int64 `json:"cash_flow_max,omitempty" db:"cash_flow_max"`
+
+	// PriceOnRequest is set when the source withholds the asking price on
+	// purpose ("Call for price", "Not disclosed"). A listing whose price
+	// simply wasn't found has neither it nor AskingPrice.
+	PriceOnRequest bool `json:"price_on_request" db:"price_on_request"`
+
+	// DescriptionTruncated is set when the stored description was cut to
+	// the configured maximum length; the source has the rest
+	DescriptionTruncated bool `json:"description_truncated,omitempty" db:"description_truncated"`
+
+	// FinancialScore rates the financials from 0 to 100 (see
+	// scoring.FinancialScore); nil when there are too few figures to rate
+	FinancialScore *int `json:"financial_score" db:"financial_score"`
+
 	// Real estate
 	RealEstateIncluded *bool  `json:"real_estate_included" db:"real_estate_included"`
 	RealEstateValue    *int64 `json:"real_estate_value,omitempty" db:"real_estate_value"`
@@ -47,6 +69,10 @@ type Listing struct {
 	Employees        *int    `json:"employees,omitempty" db:"employees"`
 	ReasonForSale    *string `json:"reason_for_sale,omitempty" db:"reason_for_sale"`
 
+	// Tags are normalized tags such as "home-based" or "seller-financing",
+	// extracted from the title and description on every upsert
+	Tags pq.StringArray `json:"tags" db:"tags"`
+
 	// Lease
 	LeaseExpiration *time.Time `json:"lease_expiration,omitempty" db:"lease_expiration"`
 	MonthlyRent     *int64     `json:"monthly_rent,omitempty" db:"monthly_rent"`
@@ -54,30 +80,271 @@ type Listing struct {
 	// Franchise
 	IsFranchise   *bool   `json:"is_franchise" db:"is_franchise"`
 	FranchiseName *string `json:"franchise_name,omitempty" db:"franchise_name"`
+	// FranchiseID links a franchise resale to the Franchise of its brand,
+	// set after upsert from FranchiseKey
+	FranchiseID *uuid.UUID `json:"franchise_id,omitempty" db:"franchise_id"`
+
+	// IsFeatured is a paid featured/promoted placement on the source site,
+	// refreshed on every scrape
+	IsFeatured bool `json:"is_featured" db:"is_featured"`
 
-	// Raw data
-	RawData json.RawMessage `json:"raw_data,omitempty" db:"raw_data"`
+	// Broker contact, filled in from the detail page by the enrichment job
+	BrokerName  *string `json:"broker_name,omitempty" db:"broker_name"`
+	BrokerPhone *string `json:"broker_phone,omitempty" db:"broker_phone"`
+
+	// Raw data (internal, exposed only via the authenticated raw endpoint)
+	RawData json.RawMessage `json:"-" db:"raw_data"`
 
 	// Metadata
-	FirstSeenAt time.Time `json:"first_seen_at" db:"first_seen_at"`
-	LastSeenAt  time.Time `json:"last_seen_at" db:"last_seen_at"`
-	IsActive    bool      `json:"is_active" db:"is_active"`
+	FirstSeenAt time.Time  `json:"first_seen_at" db:"first_seen_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	IsActive    bool       `json:"is_active" db:"is_active"`
+	EnrichedAt  *time.Time `json:"enriched_at,omitempty" db:"enriched_at"`
+	// UpdatedAt is when the row last changed in any way, hiding included
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Hidden    bool      `json:"-" db:"hidden"`
+
+	// RelistedAt is when the listing last came back after being marked
+	// inactive, and RelistCount how many times it has
+	RelistedAt  *time.Time `json:"relisted_at,omitempty" db:"relisted_at"`
+	RelistCount int        `json:"relist_count" db:"relist_count"`
+	// BackOnMarket is set on the detail response for listings relisted within
+	// BackOnMarketWindow
+	BackOnMarket bool `json:"back_on_market,omitempty" db:"-"`
+
+	// LastVerifiedAt (last_seen_at) and Stale are set on search and detail
+	// responses; see SetFreshness. SourceScrapeWeight is the scrape_weight of
+	// the listing's source, selected to work them out.
+	LastVerifiedAt     *time.Time `json:"last_verified_at,omitempty" db:"-"`
+	Stale              bool       `json:"stale,omitempty" db:"-"`
+	SourceScrapeWeight *int       `json:"-" db:"source_scrape_weight"`
+
+	// SitemapLastMod is the <lastmod> of the sitemap entry the listing was last
+	// fetched from, for sources crawled from their sitemap
+	SitemapLastMod *time.Time `json:"-" db:"sitemap_lastmod"`
+
+	// ParsedByVersion is the version of the scraper that parsed the listing,
+	// or enriched it since; see engine.Versioned
+	ParsedByVersion int `json:"-" db:"parsed_by_version"`
+
+	// ContentHash is the hash of the scraped fields as of the last upsert
+	// that rewrote the listing; an upsert with the same hash only marks it seen
+	ContentHash *string `json:"-" db:"content_hash"`
+
+	// Source is embedded only when requested with include=source
+	Source *ListingSource `json:"source,omitempty" db:"source"`
+
+	// Locations lists every location of a multi-unit listing, including the
+	// primary one above. Empty for single-location listings.
+	Locations []ListingLocation `json:"locations,omitempty" db:"-"`
+
+	// Documents are the downloadable documents linked from the detail page,
+	// served separately from the listing
+	Documents []ListingDocument `json:"-" db:"-"`
+}
+
+// BackOnMarketWindow is how long after being relisted a listing is shown as
+// back on the market
+const BackOnMarketWindow = 30 * 24 * time.Hour
+
+// IsBackOnMarket reports whether the listing was relisted within
+// BackOnMarketWindow of now
+func (l *Listing) IsBackOnMarket(now time.Time) bool {
+	return l.RelistedAt != nil && now.Sub(*l.RelistedAt) < BackOnMarketWindow
+}
+
+// DefaultScrapeWindow is how often a source with no scrape_weight is
+// scraped unless SCRAPE_WINDOW says otherwise
+const DefaultScrapeWindow = 24 * time.Hour
+
+// StaleAfterIntervals is how many of its source's scrape intervals may pass
+// without a scrape seeing a listing before it is flagged stale
+const StaleAfterIntervals = 2
+
+// ScrapeInterval returns how often the listing's source is scraped: window
+// split between its scrape_weight runs, or the whole window without a weight
+func (l *Listing) ScrapeInterval(window time.Duration) time.Duration {
+	if l.SourceScrapeWeight == nil || *l.SourceScrapeWeight <= 0 {
+		return window
+	}
+	return window / time.Duration(*l.SourceScrapeWeight)
+}
+
+// SetFreshness sets LastVerifiedAt and, for listings no scrape has seen for
+// over StaleAfterIntervals of their source's interval as of now, Stale
+func (l *Listing) SetFreshness(now time.Time, window time.Duration) {
+	verified := l.LastSeenAt
+	l.LastVerifiedAt = &verified
+	l.Stale = now.Sub(l.LastSeenAt) > StaleAfterIntervals*l.ScrapeInterval(window)
+}
+
+// ListingValidationError lists every problem Validate found with a listing
+type ListingValidationError struct {
+	Problems []string
+}
+
+func (e *ListingValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the fields a source must provide and the ranges of the
+// rest, returning a *ListingValidationError listing every problem
+func (l *Listing) Validate() error {
+	var problems []string
+	if strings.TrimSpace(l.ExternalID) == "" {
+		problems = append(problems, "external_id is required")
+	}
+	if strings.TrimSpace(l.Title) == "" {
+		problems = append(problems, "title is required")
+	}
+	if u, err := url.Parse(l.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "url must be an absolute http(s) URL")
+	}
+
+	for _, f := range []struct {
+		name      string
+		low, high *int64
+	}{
+		{"asking_price", l.AskingPrice, l.AskingPriceMax},
+		{"revenue", l.Revenue, l.RevenueMax},
+		{"cash_flow", l.CashFlow, l.CashFlowMax},
+	} {
+		switch {
+		case f.low != nil && *f.low < 0:
+			problems = append(problems, f.name+" must not be negative")
+		case f.high != nil && f.low == nil:
+			problems = append(problems, f.name+"_max requires "+f.name)
+		case f.high != nil && *f.high < *f.low:
+			problems = append(problems, f.name+"_max must not be below "+f.name)
+		}
+	}
+	if l.PriceOnRequest && l.AskingPrice != nil {
+		problems = append(problems, "asking_price must be empty when price_on_request is set")
+	}
+	// EBITDA may be negative, for a business running at a loss
+	for _, f := range []struct {
+		name  string
+		value *int64
+	}{
+		{"inventory_value", l.Inventory},
+		{"real_estate_value", l.RealEstateValue},
+		{"monthly_rent", l.MonthlyRent},
+	} {
+		if f.value != nil && *f.value < 0 {
+			problems = append(problems, f.name+" must not be negative")
+		}
+	}
+
+	if (l.Lat == nil) != (l.Lng == nil) {
+		problems = append(problems, "lat and lng must be given together")
+	} else if l.Lat != nil && (*l.Lat < -90 || *l.Lat > 90 || *l.Lng < -180 || *l.Lng > 180) {
+		problems = append(problems, "lat and lng must be valid coordinates")
+	}
+	if l.YearEstablished != nil && (*l.YearEstablished < 1600 || *l.YearEstablished > time.Now().Year()) {
+		problems = append(problems, "year_established is out of range")
+	}
+	if l.Employees != nil && *l.Employees < 0 {
+		problems = append(problems, "employees must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return &ListingValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ListingLocation is one location of a multi-unit or multi-state listing
+type ListingLocation struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	ListingID uuid.UUID `json:"-" db:"listing_id"`
+	City      *string   `json:"city,omitempty" db:"city"`
+	State     *string   `json:"state,omitempty" db:"state"`
+	ZipCode   *string   `json:"zip_code,omitempty" db:"zip_code"`
+	Lat       *float64  `json:"lat,omitempty" db:"lat"`
+	Lng       *float64  `json:"lng,omitempty" db:"lng"`
+	IsPrimary bool      `json:"is_primary" db:"is_primary"`
+}
+
+// Listing document types
+const (
+	DocumentTypeCIM        = "cim"
+	DocumentTypeFinancials = "financials"
+	DocumentTypeOther      = "other"
+)
+
+// ListingDocument is a document such as a CIM or financial summary linked from
+// a listing's detail page. Only the URL is stored; the file stays on the source.
+type ListingDocument struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	ListingID uuid.UUID `json:"-" db:"listing_id"`
+	Type      string    `json:"type" db:"type"`
+	URL       string    `json:"url" db:"url"`
+	Title     *string   `json:"title,omitempty" db:"title"`
+}
+
+// PriceChange is an asking price a listing had from RecordedAt until the next change
+type PriceChange struct {
+	AskingPrice    *int64    `json:"asking_price" db:"asking_price"`
+	AskingPriceMax *int64    `json:"asking_price_max,omitempty" db:"asking_price_max"`
+	RecordedAt     time.Time `json:"recorded_at" db:"recorded_at"`
+}
+
+// ListingSource is the compact source embedded in a listing response
+type ListingSource struct {
+	ID      uuid.UUID `json:"id" db:"id"`
+	Name    string    `json:"name" db:"name"`
+	Slug    string    `json:"slug" db:"slug"`
+	BaseURL string    `json:"base_url" db:"base_url"`
+}
+
+// ListingRaw is the scraped payload for a listing along with its provenance
+type ListingRaw struct {
+	ListingID  uuid.UUID       `json:"listing_id" db:"id"`
+	ExternalID string          `json:"external_id" db:"external_id"`
+	URL        string          `json:"url" db:"url"`
+	SourceName string          `json:"source_name" db:"source_name"`
+	SourceSlug string          `json:"source_slug" db:"source_slug"`
+	RawData    json.RawMessage `json:"raw_data" db:"raw_data"`
+	ScrapedAt  time.Time       `json:"scraped_at" db:"last_seen_at"`
+	IsActive   bool            `json:"is_active" db:"is_active"`
+}
+
+// GeocodeCandidate is a listing location awaiting coordinates
+type GeocodeCandidate struct {
+	ID      uuid.UUID `db:"id"`
+	City    *string   `db:"city"`
+	State   string    `db:"state"`
+	Country *string   `db:"country"`
 }
 
 type ListingSearchParams struct {
-	Query       string   `json:"q"`
-	PriceMin    *int64   `json:"price_min"`
-	PriceMax    *int64   `json:"price_max"`
-	RevenueMin  *int64   `json:"revenue_min"`
-	CashFlowMin *int64   `json:"cash_flow_min"`
-	States      []string `json:"states"`
-	Industries  []string `json:"industries"`
-	Franchise   *bool    `json:"franchise"`
-	RealEstate  *bool    `json:"real_estate"`
-	Bounds      *GeoBounds `json:"bounds"`
-	Sort        string   `json:"sort"`
-	Page        int      `json:"page"`
-	PerPage     int      `json:"per_page"`
+	Query          string     `json:"q"`
+	SourceID       *uuid.UUID `json:"source_id"`
+	FranchiseID    *uuid.UUID `json:"franchise_id"`
+	PriceMin       *int64     `json:"price_min"`
+	PriceMax       *int64     `json:"price_max"`
+	RevenueMin     *int64     `json:"revenue_min"`
+	CashFlowMin    *int64     `json:"cash_flow_min"`
+	MinScore       *int       `json:"min_score"`
+	States         []string   `json:"states"`
+	Industries     []string   `json:"industries"`
+	BusinessTypes  []string   `json:"business_types"`
+	Categories     []string   `json:"categories"`
+	Tags           []string   `json:"tags"`
+	TagsMatchAll   bool       `json:"tags_match_all"` // listings need every tag, not any
+	Franchise      *bool      `json:"franchise"`
+	RealEstate     *bool      `json:"real_estate"`
+	PriceOnRequest *bool      `json:"price_on_request"`
+	FeaturedOnly   *bool      `json:"featured_only"`
+	Relisted       *bool      `json:"relisted"`
+	Bounds         *GeoBounds `json:"bounds"`
+	Sort           string     `json:"sort"`
+	Nulls          string     `json:"nulls"`
+	Seed           string     `json:"seed"` // for sort=random; defaults to today's date
+	IncludeSource  bool       `json:"include_source"`
+	Facets         []string   `json:"facets"`
+	Page           int        `json:"page"`
+	PerPage        int        `json:"per_page"` // 0 counts matches without fetching them
 }
 
 type GeoBounds struct {
@@ -93,12 +360,37 @@ type ListingSearchResult struct {
 	Page       int       `json:"page"`
 	PerPage    int       `json:"per_page"`
 	TotalPages int       `json:"total_pages"`
+
+	// Sort, Nulls and Seed are the ordering applied, to repeat when paging
+	Sort  string `json:"sort"`
+	Nulls string `json:"nulls,omitempty"`
+	Seed  string `json:"seed,omitempty"`
+
+	// Facets holds per-value counts within the current search, keyed by facet name
+	Facets map[string][]FilterOption `json:"facets,omitempty"`
+}
+
+// ListingBatchResult holds listings fetched by ID, in the order requested
+type ListingBatchResult struct {
+	Listings []Listing `json:"listings"`
+	// NotFound lists requested IDs that don't exist or aren't active
+	NotFound []uuid.UUID `json:"not_found"`
+}
+
+// NearbyListing is a listing near another one. DistanceMiles is nil for
+// same-city matches of a listing without coordinates.
+type NearbyListing struct {
+	Listing
+	DistanceMiles *float64 `json:"distance_miles" db:"distance_miles"`
 }
 
 type FilterOptions struct {
-	Industries []FilterOption `json:"industries"`
-	States     []FilterOption `json:"states"`
-	PriceRange PriceRange     `json:"price_range"`
+	Industries    []FilterOption `json:"industries"`
+	States        []FilterOption `json:"states"`
+	BusinessTypes []FilterOption `json:"business_types"`
+	Categories    []FilterOption `json:"categories"`
+	Tags          []FilterOption `json:"tags"`
+	PriceRange    PriceRange     `json:"price_range"`
 }
 
 type FilterOption struct {
@@ -111,3 +403,50 @@ type PriceRange struct {
 	Min int64 `json:"min"`
 	Max int64 `json:"max"`
 }
+
+// FailedUpsert is a scraped listing the database rejected, kept with the error
+// so it can be replayed once the cause is fixed
+type FailedUpsert struct {
+	SourceID      uuid.UUID       `json:"source_id" db:"source_id"`
+	SourceSlug    string          `json:"source_slug" db:"source_slug"`
+	ExternalID    string          `json:"external_id" db:"external_id"`
+	Listing       json.RawMessage `json:"listing" db:"listing"`
+	Error         string          `json:"error" db:"error"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	FirstFailedAt time.Time       `json:"first_failed_at" db:"first_failed_at"`
+	LastFailedAt  time.Time       `json:"last_failed_at" db:"last_failed_at"`
+}
+
+// failedListingJSON adds the listing fields kept out of API responses, so a
+// replayed listing is upserted exactly as it was scraped
+type failedListingJSON struct {
+	*Listing
+	RawData         json.RawMessage `json:"raw_data,omitempty"`
+	SitemapLastMod  *time.Time      `json:"sitemap_lastmod,omitempty"`
+	ParsedByVersion int             `json:"parsed_by_version,omitempty"`
+}
+
+// EncodeFailedListing serializes a listing for FailedUpsert.Listing
+func EncodeFailedListing(l *Listing) (json.RawMessage, error) {
+	return json.Marshal(failedListingJSON{Listing: l, RawData: l.RawData, SitemapLastMod: l.SitemapLastMod, ParsedByVersion: l.ParsedByVersion})
+}
+
+// DecodeListing returns the listing as it was when its upsert failed
+func (f FailedUpsert) DecodeListing() (*Listing, error) {
+	decoded := failedListingJSON{Listing: &Listing{}}
+	if err := json.Unmarshal(f.Listing, &decoded); err != nil {
+		return nil, err
+	}
+	decoded.Listing.RawData = decoded.RawData
+	decoded.Listing.SitemapLastMod = decoded.SitemapLastMod
+	decoded.Listing.ParsedByVersion = decoded.ParsedByVersion
+	return decoded.Listing, nil
+}
+
+// SourceListingCount is the number of a source's listings that are active,
+// or inactive
+type SourceListingCount struct {
+	Source string `db:"source"`
+	Active bool   `db:"active"`
+	Count  int    `db:"count"`
+}
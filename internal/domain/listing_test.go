@@ -0,0 +1,146 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailedListingRoundTrip(t *testing.T) {
+	lastMod := time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC)
+	price := int64(250000)
+	l := &Listing{
+		ExternalID:      "123",
+		Title:           "Coffee Shop",
+		AskingPrice:     &price,
+		RawData:         json.RawMessage(`{"price":"$250,000"}`),
+		SitemapLastMod:  &lastMod,
+		ParsedByVersion: 3,
+	}
+
+	data, err := EncodeFailedListing(l)
+	if err != nil {
+		t.Fatalf("EncodeFailedListing failed: %v", err)
+	}
+	got, err := FailedUpsert{Listing: data}.DecodeListing()
+	if err != nil {
+		t.Fatalf("DecodeListing failed: %v", err)
+	}
+
+	if got.ExternalID != "123" || got.Title != "Coffee Shop" {
+		t.Errorf("got %s %q, want 123 %q", got.ExternalID, got.Title, "Coffee Shop")
+	}
+	if got.AskingPrice == nil || *got.AskingPrice != 250000 {
+		t.Errorf("AskingPrice = %v, want 250000", got.AskingPrice)
+	}
+	// Fields hidden from the API must survive too
+	if string(got.RawData) != `{"price":"$250,000"}` {
+		t.Errorf("RawData = %s", got.RawData)
+	}
+	if got.SitemapLastMod == nil || !got.SitemapLastMod.Equal(lastMod) {
+		t.Errorf("SitemapLastMod = %v, want %v", got.SitemapLastMod, lastMod)
+	}
+	if got.ParsedByVersion != 3 {
+		t.Errorf("ParsedByVersion = %d, want 3", got.ParsedByVersion)
+	}
+}
+
+func TestIsBackOnMarket(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		relistedAt *time.Time
+		want       bool
+	}{
+		{"never relisted", nil, false},
+		{"relisted yesterday", Ptr(now.Add(-24 * time.Hour)), true},
+		{"relisted long ago", Ptr(now.Add(-BackOnMarketWindow - time.Hour)), false},
+	}
+	for _, tt := range tests {
+		l := &Listing{RelistedAt: tt.relistedAt}
+		if got := l.IsBackOnMarket(now); got != tt.want {
+			t.Errorf("%s: IsBackOnMarket = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetFreshness(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	window := 24 * time.Hour
+	tests := []struct {
+		name     string
+		weight   *int
+		lastSeen time.Time
+		want     bool
+	}{
+		{"seen today", nil, now.Add(-time.Hour), false},
+		{"exactly two windows", nil, now.Add(-48 * time.Hour), false},
+		{"just over two windows", nil, now.Add(-48*time.Hour - time.Second), true},
+		{"weight 3, exactly two intervals", Ptr(3), now.Add(-16 * time.Hour), false},
+		{"weight 3, just over two intervals", Ptr(3), now.Add(-16*time.Hour - time.Second), true},
+		{"zero weight uses the window", Ptr(0), now.Add(-30 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		l := &Listing{LastSeenAt: tt.lastSeen, SourceScrapeWeight: tt.weight}
+		l.SetFreshness(now, window)
+		if l.Stale != tt.want {
+			t.Errorf("%s: Stale = %v, want %v", tt.name, l.Stale, tt.want)
+		}
+		if l.LastVerifiedAt == nil || !l.LastVerifiedAt.Equal(tt.lastSeen) {
+			t.Errorf("%s: LastVerifiedAt = %v, want %v", tt.name, l.LastVerifiedAt, tt.lastSeen)
+		}
+	}
+}
+
+func TestListingValidate(t *testing.T) {
+	valid := func() *Listing {
+		return &Listing{ExternalID: "1", Title: "Coffee Shop", URL: "https://example.com/listing/1"}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(l *Listing)
+		want   string // a reported problem contains this; empty for valid
+	}{
+		{"valid", func(l *Listing) {}, ""},
+		{"loss-making", func(l *Listing) { l.EBITDA = Ptr(int64(-500000)) }, ""},
+		{"price range", func(l *Listing) { l.AskingPrice, l.AskingPriceMax = Ptr(int64(100)), Ptr(int64(200)) }, ""},
+		{"no external id", func(l *Listing) { l.ExternalID = " " }, "external_id is required"},
+		{"no title", func(l *Listing) { l.Title = "" }, "title is required"},
+		{"relative url", func(l *Listing) { l.URL = "/listing/1" }, "url must be"},
+		{"ftp url", func(l *Listing) { l.URL = "ftp://example.com/1" }, "url must be"},
+		{"negative price", func(l *Listing) { l.AskingPrice = Ptr(int64(-1)) }, "asking_price must not be negative"},
+		{"inverted range", func(l *Listing) { l.Revenue, l.RevenueMax = Ptr(int64(200)), Ptr(int64(100)) }, "revenue_max must not be below"},
+		{"range without low end", func(l *Listing) { l.CashFlowMax = Ptr(int64(100)) }, "cash_flow_max requires cash_flow"},
+		{"priced on request", func(l *Listing) { l.PriceOnRequest, l.AskingPrice = true, Ptr(int64(100)) }, "price_on_request"},
+		{"negative rent", func(l *Listing) { l.MonthlyRent = Ptr(int64(-1)) }, "monthly_rent must not be negative"},
+		{"lat without lng", func(l *Listing) { l.Lat = Ptr(40.0) }, "given together"},
+		{"bad coordinates", func(l *Listing) { l.Lat, l.Lng = Ptr(91.0), Ptr(0.0) }, "valid coordinates"},
+		{"future year", func(l *Listing) { l.YearEstablished = Ptr(time.Now().Year() + 1) }, "year_established"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := valid()
+			tt.modify(l)
+			err := l.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want a problem containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// Every problem is reported
+	var verr *ListingValidationError
+	if err := (&Listing{}).Validate(); !errors.As(err, &verr) || len(verr.Problems) != 3 {
+		t.Errorf("empty listing: %v, want 3 problems", err)
+	}
+}
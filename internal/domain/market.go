@@ -0,0 +1,25 @@
+package domain
+
+// MarketStatsMinListings is the fewest listings a market stats group needs
+// for its price statistics; smaller groups report only their count, since a
+// median of one or two listings says little about a market
+const MarketStatsMinListings = 5
+
+// MarketStat summarizes the asking prices of one group of active listings.
+// Money is in cents; statistics are nil when fewer than MarketStatsMinListings
+// listings in the group have the figure, or when the group is Suppressed.
+type MarketStat struct {
+	// Group holds each group_by field's value, nil for listings without one
+	Group map[string]*string `json:"group"`
+	Count int                `json:"count"`
+
+	MedianAskingPrice *int64 `json:"median_asking_price"`
+	AvgAskingPrice    *int64 `json:"avg_asking_price"`
+	MedianCashFlow    *int64 `json:"median_cash_flow"`
+	// MedianRevenueMultiple is the median of asking price over annual revenue
+	MedianRevenueMultiple *float64 `json:"median_revenue_multiple"`
+
+	// Suppressed is set for groups with fewer than MarketStatsMinListings
+	// listings, whose statistics are left out
+	Suppressed bool `json:"suppressed,omitempty"`
+}
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DataQualityIssue counts the active listings failing one data-quality
+// check, in total and per source
+type DataQualityIssue struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Count       int    `json:"count"`
+	// Sources maps source slugs to their count; sources with none are left out
+	Sources map[string]int `json:"sources"`
+}
+
+// DataQualityListing is a listing failing a data-quality check, exported for
+// triage. AskingPrice is in cents.
+type DataQualityListing struct {
+	Issue       string    `db:"issue"`
+	Source      string    `db:"source"`
+	ID          uuid.UUID `db:"id"`
+	ExternalID  string    `db:"external_id"`
+	URL         string    `db:"url"`
+	Title       string    `db:"title"`
+	AskingPrice *int64    `db:"asking_price"`
+	City        *string   `db:"city"`
+	State       *string   `db:"state"`
+	LastSeenAt  time.Time `db:"last_seen_at"`
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reasons a user can report a listing for
+const (
+	// ReportReasonSold is a listing that is sold or otherwise gone
+	ReportReasonSold          = "sold"
+	ReportReasonWrongLocation = "wrong_location"
+	ReportReasonWrongPrice    = "wrong_price"
+	ReportReasonDuplicate     = "duplicate"
+	ReportReasonOther         = "other"
+)
+
+// ReportReasons are the reasons a ListingReport may give
+var ReportReasons = []string{
+	ReportReasonSold,
+	ReportReasonWrongLocation,
+	ReportReasonWrongPrice,
+	ReportReasonDuplicate,
+	ReportReasonOther,
+}
+
+// ValidReportReason reports whether reason is one of ReportReasons
+func ValidReportReason(reason string) bool {
+	return slices.Contains(ReportReasons, reason)
+}
+
+// What to do with a listing once enough users report it sold
+const (
+	// ReportActionHide hides the listing until an admin unhides it
+	ReportActionHide = "hide"
+	// ReportActionVerify re-fetches the listing's detail page
+	ReportActionVerify = "verify"
+)
+
+// ListingReport is a correction a user submitted for a listing
+type ListingReport struct {
+	ID        int64     `json:"id" db:"id"`
+	ListingID uuid.UUID `json:"listing_id" db:"listing_id"`
+	Reason    string    `json:"reason" db:"reason"`
+	Note      *string   `json:"note,omitempty" db:"note"`
+	// ReporterIP is only shown to admins
+	ReporterIP string    `json:"reporter_ip,omitempty" db:"reporter_ip"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+
+	// ListingTitle is filled in when reports are listed for review
+	ListingTitle string `json:"listing_title,omitempty" db:"listing_title"`
+}
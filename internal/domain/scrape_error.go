@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Scrape error kinds
+const (
+	ScrapeErrorBlocked = "blocked" // the source refused us (403/429, bot challenge)
+	ScrapeErrorRequest = "request" // any other failed fetch
+)
+
+// ScrapeError is a classified failure sent on a scraper's error channel
+type ScrapeError struct {
+	Source string
+	Kind   string
+	URL    string
+	Status int
+	Err    error
+}
+
+func (e *ScrapeError) Error() string {
+	return fmt.Sprintf("%s: %s error %d: %s - %v", e.Source, e.Kind, e.Status, e.URL, e.Err)
+}
+
+func (e *ScrapeError) Unwrap() error { return e.Err }
+
+// IsBlocked reports whether err is a ScrapeError of kind ScrapeErrorBlocked
+func IsBlocked(err error) bool {
+	var se *ScrapeError
+	return errors.As(err, &se) && se.Kind == ScrapeErrorBlocked
+}
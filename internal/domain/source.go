@@ -1,7 +1,15 @@
 package domain
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,28 +25,468 @@ type Source struct {
 	Config      json.RawMessage `json:"config" db:"config"`
 	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
+
+	// ConsecutiveBlocks counts the source's blocked runs since its last
+	// unblocked one; enough of them quarantine it until QuarantinedUntil
+	ConsecutiveBlocks int        `json:"consecutive_blocks" db:"consecutive_blocks"`
+	QuarantinedUntil  *time.Time `json:"quarantined_until,omitempty" db:"quarantined_until"`
+}
+
+// Quarantined reports whether the source's scrapes are skipped at now
+func (s *Source) Quarantined(now time.Time) bool {
+	return s.QuarantinedUntil != nil && now.Before(*s.QuarantinedUntil)
+}
+
+// SourceConfig is the scraper configuration stored in Source.Config
+type SourceConfig struct {
+	// Auth, if set, logs in before crawling (rod scrapers only)
+	Auth *SourceAuthConfig `json:"auth,omitempty"`
+	// StartPath, if set, replaces the scraper's default path of the first
+	// search results page, relative to the source's base_url
+	StartPath string `json:"start_path,omitempty"`
+	// Segments, if set, are search results paths, relative to base_url, that
+	// a search crawl visits in turn in place of StartPath, each to its
+	// pagination limit, e.g. one per state or industry category
+	// ("/businesses-for-sale/california/", "/businesses-for-sale/?industry=restaurants"),
+	// to reach listings past how deep one search can be paged
+	Segments []string `json:"segments,omitempty"`
+	// MaxRequestsPerDay caps the search and detail pages fetched from the
+	// source per UTC day; 0 means no cap
+	MaxRequestsPerDay int `json:"max_requests_per_day,omitempty"`
+	// CrawlStrategy is how listings are discovered: CrawlStrategySearch (the
+	// default), CrawlStrategySitemap, which requires Sitemap, or
+	// CrawlStrategyAPI, which requires API
+	CrawlStrategy string               `json:"crawl_strategy,omitempty"`
+	Sitemap       *SourceSitemapConfig `json:"sitemap,omitempty"`
+	API           *SourceAPIConfig     `json:"api,omitempty"`
+	// BlockSignatures are case-insensitive regexps matching the source's block
+	// or challenge pages, replacing browser.DefaultBlockSignatures
+	BlockSignatures []string `json:"block_signatures,omitempty"`
+	// ScrapeWeight is how many periodic scrapes the source gets per
+	// SCRAPE_WINDOW; defaults to 1
+	ScrapeWeight int `json:"scrape_weight,omitempty"`
+	// WaitSelector, if set, is the CSS selector of the content rod scrapers
+	// wait for after loading a page, replacing the scraper's own selector
+	WaitSelector string `json:"wait_selector,omitempty"`
+	// WaitTimeoutSeconds caps that wait; the page is parsed as it is once it
+	// passes. 0 uses the scraper's default.
+	WaitTimeoutSeconds int `json:"wait_timeout_seconds,omitempty"`
+	// TitleRules are case-insensitive regexps whose matches are removed from
+	// the source's listing titles, after the scrapers' default rules
+	TitleRules []string `json:"title_rules,omitempty"`
+	// SkipPatterns are case-insensitive regexps matching absolute URLs the
+	// scrapers neither follow nor keep listings for, such as ads, "contact a
+	// broker" pages and off-topic categories
+	SkipPatterns []string `json:"skip_patterns,omitempty"`
+	// Headers are sent with every request to the source, after the browser
+	// headers the scrapers send by default; an empty value drops a default
+	// header
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+const (
+	// CrawlStrategySearch paginates the source's search results with its scraper
+	CrawlStrategySearch = "search"
+	// CrawlStrategySitemap reads listing URLs from the source's sitemap and
+	// parses each detail page
+	CrawlStrategySitemap = "sitemap"
+	// CrawlStrategyAPI pages through the JSON or XML search API behind the
+	// source's site, mapping its results onto listings
+	CrawlStrategyAPI = "api"
+)
+
+// SourceSitemapConfig locates a source's sitemap and its listing URLs
+type SourceSitemapConfig struct {
+	// Path is the sitemap or sitemap index, relative to base_url; defaults to /sitemap.xml
+	Path string `json:"path,omitempty"`
+	// ListingPattern is a regexp matching listing URLs. Its first capture
+	// group, if any, is the listing's external ID.
+	ListingPattern string `json:"listing_pattern"`
+}
+
+// SitemapPath returns the sitemap path, defaulting to /sitemap.xml
+func (c *SourceSitemapConfig) SitemapPath() string {
+	if c.Path == "" {
+		return "/sitemap.xml"
+	}
+	return c.Path
+}
+
+// SourceAPIConfig locates a source's search API and maps its results onto
+// listings. Paths are dot-separated keys with optional [n] array indexes,
+// e.g. "hits" or "location.city"; a leading "$." is allowed.
+type SourceAPIConfig struct {
+	// Preset fills in the unset keys of a known API; APIPresetAlgolia
+	Preset string `json:"preset,omitempty"`
+	// Endpoint is the API's URL, absolute or a path relative to base_url
+	Endpoint string `json:"endpoint"`
+	// Format is APIFormatJSON (the default) or APIFormatXML
+	Format string `json:"format,omitempty"`
+	// Params are query parameters sent with every request
+	Params map[string]string `json:"params,omitempty"`
+	// Results is the path of the array of results in a response
+	Results string `json:"results"`
+	// Fields maps listing fields, named as in APIFields, to paths within a
+	// result. external_id and title are required.
+	Fields map[string]string `json:"fields"`
+	// URLTemplate builds a listing's URL, relative to base_url or absolute,
+	// from its external ID in place of "{external_id}", for APIs whose
+	// results don't carry one; the url field takes precedence
+	URLTemplate string               `json:"url_template,omitempty"`
+	Pagination  *SourceAPIPagination `json:"pagination,omitempty"`
+}
+
+// SourceAPIPagination is how a source's API pages through results. Without
+// it only the first page is fetched.
+type SourceAPIPagination struct {
+	// Type is APIPageNumber, APIPageOffset or APIPageCursor
+	Type string `json:"type"`
+	// Param is the query parameter carrying the page number, offset or cursor
+	Param string `json:"param"`
+	// Start is the first page number or offset; defaults to 1 for page
+	// numbers and 0 for offsets
+	Start *int `json:"start,omitempty"`
+	// SizeParam, if set, requests Size results per page. A shorter page is
+	// taken as the last.
+	SizeParam string `json:"size_param,omitempty"`
+	Size      int    `json:"size,omitempty"`
+	// CursorPath is the path of the next page's cursor in a response; a
+	// missing or empty cursor ends the crawl
+	CursorPath string `json:"cursor_path,omitempty"`
+	// TotalPagesPath, if set, is the path of the number of pages in a response
+	TotalPagesPath string `json:"total_pages_path,omitempty"`
+}
+
+// Source API response formats
+const (
+	APIFormatJSON = "json"
+	APIFormatXML  = "xml"
+)
+
+// Source API pagination types
+const (
+	APIPageNumber = "page"
+	APIPageOffset = "offset"
+	APIPageCursor = "cursor"
+)
+
+// APIPresetAlgolia reads an Algolia index through its query API, e.g. an
+// endpoint of "https://<app id>-dsn.algolia.net/1/indexes/<index>" with
+// x-algolia-application-id and x-algolia-api-key (the site's public search
+// key) in params. Results are "hits", paged by the zero-based "page" param
+// up to "nbPages", "hitsPerPage" at a time, and external IDs default to
+// each hit's objectID.
+const APIPresetAlgolia = "algolia"
+
+// APIFields are the listing fields a source API config may map. Figures are
+// read as dollars if they are numbers, and parsed like scraped text if they
+// are strings.
+var APIFields = []string{
+	"external_id", "url", "title", "description",
+	"asking_price", "revenue", "cash_flow", "ebitda", "inventory_value",
+	"city", "state", "zip_code", "lat", "lng",
+	"industry", "year_established", "employees",
+	"is_franchise", "franchise_name", "real_estate_included",
+}
+
+// applyPreset fills in the keys of c its preset sets that c leaves unset
+func (c *SourceAPIConfig) applyPreset() error {
+	switch c.Preset {
+	case "":
+	case APIPresetAlgolia:
+		if c.Results == "" {
+			c.Results = "hits"
+		}
+		if c.Fields == nil {
+			c.Fields = map[string]string{}
+		}
+		if c.Fields["external_id"] == "" {
+			c.Fields["external_id"] = "objectID"
+		}
+		if c.Pagination == nil {
+			start := 0
+			c.Pagination = &SourceAPIPagination{
+				Type: APIPageNumber, Param: "page", Start: &start,
+				SizeParam: "hitsPerPage", Size: 100, TotalPagesPath: "nbPages",
+			}
+		}
+	default:
+		return fmt.Errorf("unknown api.preset %q", c.Preset)
+	}
+	return nil
+}
+
+// validate checks c once its preset is applied
+func (c *SourceAPIConfig) validate() error {
+	if c.Endpoint == "" {
+		return fmt.Errorf("crawl_strategy api requires api.endpoint")
+	}
+	if !strings.HasPrefix(c.Endpoint, "/") && !strings.HasPrefix(c.Endpoint, "http://") && !strings.HasPrefix(c.Endpoint, "https://") {
+		return fmt.Errorf("api.endpoint must be an absolute URL or begin with /")
+	}
+	if c.Format != APIFormatJSON && c.Format != APIFormatXML {
+		return fmt.Errorf("unknown api.format %q", c.Format)
+	}
+	if c.Results == "" {
+		return fmt.Errorf("crawl_strategy api requires api.results")
+	}
+	for field, path := range c.Fields {
+		if !slices.Contains(APIFields, field) {
+			return fmt.Errorf("api.fields: unknown listing field %q", field)
+		}
+		if path == "" {
+			return fmt.Errorf("api.fields.%s: empty path", field)
+		}
+	}
+	if c.Fields["external_id"] == "" || c.Fields["title"] == "" {
+		return fmt.Errorf("api.fields requires external_id and title")
+	}
+	if c.Fields["url"] == "" && !strings.Contains(c.URLTemplate, "{external_id}") {
+		return fmt.Errorf("api requires fields.url or a url_template with {external_id}")
+	}
+	if p := c.Pagination; p != nil {
+		switch p.Type {
+		case APIPageNumber, APIPageOffset:
+		case APIPageCursor:
+			if p.CursorPath == "" {
+				return fmt.Errorf("api.pagination type cursor requires cursor_path")
+			}
+		default:
+			return fmt.Errorf("unknown api.pagination.type %q", p.Type)
+		}
+		if p.Param == "" {
+			return fmt.Errorf("api.pagination requires param")
+		}
+		if p.Size < 0 || (p.SizeParam != "" && p.Size == 0) {
+			return fmt.Errorf("api.pagination.size_param requires a positive size")
+		}
+	}
+	return nil
+}
+
+// SourceAuthConfig describes a login form. Credentials are never stored in the
+// config; UsernameEnv and PasswordEnv name the environment variables holding them.
+type SourceAuthConfig struct {
+	LoginURL         string `json:"login_url"`
+	UsernameEnv      string `json:"username_env"`
+	PasswordEnv      string `json:"password_env"`
+	UsernameSelector string `json:"username_selector"`
+	PasswordSelector string `json:"password_selector"`
+	SubmitSelector   string `json:"submit_selector"`
+	// LoggedInSelector, if set, must be present after submitting the form
+	LoggedInSelector string `json:"logged_in_selector,omitempty"`
+}
+
+// headerNameRe matches a valid HTTP header name (an RFC 9110 token)
+var headerNameRe = regexp.MustCompile("^[-!#$%&'*+.^_`|~0-9A-Za-z]+$")
+
+// ParseSourceConfig decodes and validates a source's config, filling in the
+// defaults of unset keys. Unknown keys are rejected, so a misspelt one fails
+// the source instead of being ignored.
+func ParseSourceConfig(raw json.RawMessage) (SourceConfig, error) {
+	var cfg SourceConfig
+	if len(raw) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return cfg, fmt.Errorf("invalid source config: %w", err)
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return cfg, fmt.Errorf("invalid source config: unexpected data after the config object")
+		}
+	}
+	if cfg.CrawlStrategy == "" {
+		cfg.CrawlStrategy = CrawlStrategySearch
+	}
+	if cfg.ScrapeWeight == 0 {
+		cfg.ScrapeWeight = 1
+	}
+	if cfg.Sitemap != nil && cfg.Sitemap.Path == "" {
+		cfg.Sitemap.Path = cfg.Sitemap.SitemapPath()
+	}
+	if cfg.API != nil {
+		if cfg.API.Format == "" {
+			cfg.API.Format = APIFormatJSON
+		}
+		if err := cfg.API.applyPreset(); err != nil {
+			return cfg, fmt.Errorf("invalid source config: %w", err)
+		}
+	}
+	if cfg.StartPath != "" && !strings.HasPrefix(cfg.StartPath, "/") {
+		return cfg, fmt.Errorf("invalid source config: start_path must begin with /")
+	}
+	for _, segment := range cfg.Segments {
+		if !strings.HasPrefix(segment, "/") {
+			return cfg, fmt.Errorf("invalid source config: segments must begin with /, got %q", segment)
+		}
+	}
+	if cfg.MaxRequestsPerDay < 0 {
+		return cfg, fmt.Errorf("invalid source config: max_requests_per_day must not be negative")
+	}
+	if cfg.ScrapeWeight < 0 {
+		return cfg, fmt.Errorf("invalid source config: scrape_weight must not be negative")
+	}
+	if cfg.WaitTimeoutSeconds < 0 {
+		return cfg, fmt.Errorf("invalid source config: wait_timeout_seconds must not be negative")
+	}
+	switch cfg.CrawlStrategy {
+	case CrawlStrategySearch:
+	case CrawlStrategySitemap:
+		if cfg.Sitemap == nil || cfg.Sitemap.ListingPattern == "" {
+			return cfg, fmt.Errorf("invalid source config: crawl_strategy sitemap requires sitemap.listing_pattern")
+		}
+		if _, err := regexp.Compile(cfg.Sitemap.ListingPattern); err != nil {
+			return cfg, fmt.Errorf("invalid source config: sitemap.listing_pattern: %w", err)
+		}
+		if p := cfg.Sitemap.Path; p != "" && !strings.HasPrefix(p, "/") {
+			return cfg, fmt.Errorf("invalid source config: sitemap.path must begin with /")
+		}
+	case CrawlStrategyAPI:
+		if cfg.API == nil {
+			return cfg, fmt.Errorf("invalid source config: crawl_strategy api requires api")
+		}
+		if err := cfg.API.validate(); err != nil {
+			return cfg, fmt.Errorf("invalid source config: %w", err)
+		}
+	default:
+		return cfg, fmt.Errorf("invalid source config: unknown crawl_strategy %q", cfg.CrawlStrategy)
+	}
+	for i, sig := range cfg.BlockSignatures {
+		if _, err := regexp.Compile("(?i)" + sig); err != nil {
+			return cfg, fmt.Errorf("invalid source config: block_signatures[%d]: %w", i, err)
+		}
+	}
+	for i, rule := range cfg.TitleRules {
+		if _, err := regexp.Compile("(?i)" + rule); err != nil {
+			return cfg, fmt.Errorf("invalid source config: title_rules[%d]: %w", i, err)
+		}
+	}
+	for name, value := range cfg.Headers {
+		if !headerNameRe.MatchString(name) {
+			return cfg, fmt.Errorf("invalid source config: headers: invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return cfg, fmt.Errorf("invalid source config: headers[%s] must be a single line", name)
+		}
+	}
+	for i, pattern := range cfg.SkipPatterns {
+		if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+			return cfg, fmt.Errorf("invalid source config: skip_patterns[%d]: %w", i, err)
+		}
+	}
+	if a := cfg.Auth; a != nil {
+		if a.LoginURL == "" || a.UsernameEnv == "" || a.PasswordEnv == "" ||
+			a.UsernameSelector == "" || a.PasswordSelector == "" || a.SubmitSelector == "" {
+			return cfg, fmt.Errorf("invalid source config: auth requires login_url, username_env, password_env and username/password/submit selectors")
+		}
+	}
+	return cfg, nil
+}
+
+// Credentials resolves the username and password from the environment
+func (a *SourceAuthConfig) Credentials() (username, password string, err error) {
+	username, password = os.Getenv(a.UsernameEnv), os.Getenv(a.PasswordEnv)
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("credentials not set: %s and %s must both be set", a.UsernameEnv, a.PasswordEnv)
+	}
+	return username, password, nil
 }
 
 type ScrapeJob struct {
 	ID              uuid.UUID  `json:"id" db:"id"`
 	SourceID        uuid.UUID  `json:"source_id" db:"source_id"`
-	Status          string     `json:"status" db:"status"` // pending, running, completed, failed
+	Status          string     `json:"status" db:"status"` // pending, running, completed, failed, skipped_locked, budget_exhausted
 	StartedAt       *time.Time `json:"started_at,omitempty" db:"started_at"`
 	CompletedAt     *time.Time `json:"completed_at,omitempty" db:"completed_at"`
 	ListingsFound   int        `json:"listings_found" db:"listings_found"`
 	ListingsNew     int        `json:"listings_new" db:"listings_new"`
 	ListingsUpdated int        `json:"listings_updated" db:"listings_updated"`
 	ErrorMessage    string     `json:"error_message,omitempty" db:"error_message"`
+	FallbackUsed    bool       `json:"fallback_used" db:"fallback_used"`
+	Trigger         string     `json:"trigger" db:"trigger"` // periodic, manual, api, cli, retry
 	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 }
 
+// ScrapeJobRequest is a single page fetched during a scrape job.
+// Status is 0 when the fetcher could not observe the HTTP status (e.g. headless browser).
+type ScrapeJobRequest struct {
+	JobID     uuid.UUID `json:"job_id" db:"job_id"`
+	URL       string    `json:"url" db:"url"`
+	Status    int       `json:"status" db:"status"`
+	Error     *string   `json:"error,omitempty" db:"error"`
+	FetchedAt time.Time `json:"fetched_at" db:"fetched_at"`
+}
+
 const (
 	ScrapeJobStatusPending   = "pending"
 	ScrapeJobStatusRunning   = "running"
 	ScrapeJobStatusCompleted = "completed"
 	ScrapeJobStatusFailed    = "failed"
+	// ScrapeJobStatusSkippedLocked marks a run skipped because another run of
+	// the same source was in progress
+	ScrapeJobStatusSkippedLocked = "skipped_locked"
+	// ScrapeJobStatusBudgetExhausted marks a run stopped, or never started,
+	// because the source's daily request budget ran out
+	ScrapeJobStatusBudgetExhausted = "budget_exhausted"
+	// ScrapeJobStatusSkippedQuarantined marks a run skipped because the
+	// source is quarantined after repeated blocked runs
+	ScrapeJobStatusSkippedQuarantined = "skipped_quarantined"
 )
 
+// Scrape job triggers record what started a run
+const (
+	ScrapeTriggerPeriodic = "periodic"
+	// ScrapeTriggerManual covers runs queued without a trigger, e.g. by hand
+	ScrapeTriggerManual = "manual"
+	ScrapeTriggerAPI    = "api"
+	ScrapeTriggerCLI    = "cli"
+	// ScrapeTriggerRetry marks River's retries of a failed run
+	ScrapeTriggerRetry = "retry"
+)
+
+// ValidScrapeTrigger reports whether trigger is one of the scrape job triggers
+func ValidScrapeTrigger(trigger string) bool {
+	switch trigger {
+	case ScrapeTriggerPeriodic, ScrapeTriggerManual, ScrapeTriggerAPI, ScrapeTriggerCLI, ScrapeTriggerRetry:
+		return true
+	}
+	return false
+}
+
+// RequestBudget is a source's daily request budget and how much of it is used
+type RequestBudget struct {
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// NewRequestBudget reports a budget of limit requests with used spent as of now
+func NewRequestBudget(limit, used int, now time.Time) RequestBudget {
+	return RequestBudget{
+		Limit:     limit,
+		Used:      used,
+		Remaining: max(limit-used, 0),
+		ResetsAt:  NextBudgetReset(now),
+	}
+}
+
+// NextBudgetReset returns the start of the next UTC day, when request budgets reset
+func NextBudgetReset(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// SourceHealth summarizes a source's latest scrape and its request budget
+type SourceHealth struct {
+	Slug    string         `json:"slug"`
+	Name    string         `json:"name"`
+	LastJob *ScrapeJob     `json:"last_job"`
+	Budget  *RequestBudget `json:"budget"` // nil when the source has no daily cap
+	// QuarantinedUntil is set while the source's scrapes are skipped
+	QuarantinedUntil *time.Time `json:"quarantined_until,omitempty"`
+}
+
 const (
 	ScraperTypeColly = "colly"
 	ScraperTypeRod   = "rod"
@@ -50,4 +498,70 @@ type ScrapeOptions struct {
 	MaxListings  int
 	RateLimit    time.Duration
 	LastScrapeAt time.Time
+
+	// MaxPages, if set, caps the result pages a scraper fetches, start page included
+	MaxPages int
+
+	// BaseURL and StartPath, if set, replace the scraper's built-in site and
+	// first results page; the engine fills them from the source row
+	BaseURL   string
+	StartPath string
+
+	// SourceConfig is the source's raw Config, for scrapers that need per-source settings
+	SourceConfig json.RawMessage
+
+	// RecordRequest, if set, is called for every page the scraper fetches
+	RecordRequest func(url string, status int, err error)
+
+	// AcquireRequest, if set, must return nil before the scraper sends a
+	// request; it blocks while the process-wide request rate is spent and
+	// returns an error if ctx is done first
+	AcquireRequest func(ctx context.Context) error
+
+	// KnownListings, set for incremental runs of scrapers that can tell which
+	// listings changed, holds the source's listings by external ID. Listings
+	// skipped as unchanged must be reported to MarkUnchanged so they stay fresh.
+	KnownListings map[string]ListingFreshness
+	MarkUnchanged func(externalID string)
+
+	// MatchCard, if set, is called with the selector group of every listing
+	// card a scraper finds, whether or not the card parses
+	MatchCard func(selector string)
+}
+
+// ListingFreshness is when a listing was last scraped and, for sitemap-crawled
+// sources, the sitemap <lastmod> it was fetched at
+type ListingFreshness struct {
+	LastSeenAt     time.Time  `db:"last_seen_at"`
+	SitemapLastMod *time.Time `db:"sitemap_lastmod"`
+}
+
+// Unchanged reports a skipped listing to MarkUnchanged if one is configured
+func (o ScrapeOptions) Unchanged(externalID string) {
+	if o.MarkUnchanged != nil {
+		o.MarkUnchanged(externalID)
+	}
+}
+
+// MatchedCard reports a found listing card to MatchCard if one is configured
+func (o ScrapeOptions) MatchedCard(selector string) {
+	if o.MatchCard != nil {
+		o.MatchCard(selector)
+	}
+}
+
+// Acquire waits on AcquireRequest if one is configured; without one it only
+// checks ctx
+func (o ScrapeOptions) Acquire(ctx context.Context) error {
+	if o.AcquireRequest != nil {
+		return o.AcquireRequest(ctx)
+	}
+	return ctx.Err()
+}
+
+// Record reports a fetched page to RecordRequest if one is configured
+func (o ScrapeOptions) Record(url string, status int, err error) {
+	if o.RecordRequest != nil {
+		o.RecordRequest(url, status, err)
+	}
 }
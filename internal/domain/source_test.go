@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSourceConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		wantAuth bool
+		wantErr  bool
+	}{
+		{"empty", "", false, false},
+		{"no auth", `{}`, false, false},
+		{"auth", `{"auth":{"login_url":"https://example.com/login","username_env":"EX_USER","password_env":"EX_PASS",
+			"username_selector":"#email","password_selector":"#password","submit_selector":"button[type=submit]"}}`, true, false},
+		{"incomplete auth", `{"auth":{"login_url":"https://example.com/login"}}`, false, true},
+		{"start path", `{"start_path":"/search/businesses/"}`, false, false},
+		{"relative start path", `{"start_path":"search/businesses/"}`, false, true},
+		{"segments", `{"segments":["/businesses-for-sale/texas/","/businesses-for-sale/?industry=restaurants"]}`, false, false},
+		{"relative segment", `{"segments":["/businesses-for-sale/texas/","florida/"]}`, false, true},
+		{"request budget", `{"max_requests_per_day":500}`, false, false},
+		{"negative request budget", `{"max_requests_per_day":-1}`, false, true},
+		{"scrape weight", `{"scrape_weight":3}`, false, false},
+		{"negative scrape weight", `{"scrape_weight":-1}`, false, true},
+		{"search strategy", `{"crawl_strategy":"search"}`, false, false},
+		{"sitemap strategy", `{"crawl_strategy":"sitemap","sitemap":{"listing_pattern":"/listing/(\\d+)"}}`, false, false},
+		{"sitemap without pattern", `{"crawl_strategy":"sitemap"}`, false, true},
+		{"sitemap invalid pattern", `{"crawl_strategy":"sitemap","sitemap":{"listing_pattern":"(["}}`, false, true},
+		{"sitemap relative path", `{"crawl_strategy":"sitemap","sitemap":{"path":"sitemap.xml","listing_pattern":"/listing/"}}`, false, true},
+		{"unknown strategy", `{"crawl_strategy":"rss"}`, false, true},
+		{"api strategy", `{"crawl_strategy":"api","api":{"endpoint":"/api/search","results":"data.items",
+			"fields":{"external_id":"id","title":"name","url":"link"},"pagination":{"type":"offset","param":"offset","size_param":"limit","size":50}}}`, false, false},
+		{"api url template", `{"crawl_strategy":"api","api":{"endpoint":"https://api.example.com/search","format":"xml","results":"listing",
+			"fields":{"external_id":"@id","title":"name"},"url_template":"/listing/{external_id}"}}`, false, false},
+		{"api algolia preset", `{"crawl_strategy":"api","api":{"preset":"algolia","endpoint":"https://x-dsn.algolia.net/1/indexes/listings",
+			"fields":{"title":"title","url":"url"}}}`, false, false},
+		{"api without config", `{"crawl_strategy":"api"}`, false, true},
+		{"api without endpoint", `{"crawl_strategy":"api","api":{"results":"hits","fields":{"external_id":"id","title":"name","url":"link"}}}`, false, true},
+		{"api relative endpoint", `{"crawl_strategy":"api","api":{"endpoint":"api/search","results":"hits","fields":{"external_id":"id","title":"name","url":"link"}}}`, false, true},
+		{"api without results", `{"crawl_strategy":"api","api":{"endpoint":"/api","fields":{"external_id":"id","title":"name","url":"link"}}}`, false, true},
+		{"api without title", `{"crawl_strategy":"api","api":{"endpoint":"/api","results":"hits","fields":{"external_id":"id","url":"link"}}}`, false, true},
+		{"api without url", `{"crawl_strategy":"api","api":{"endpoint":"/api","results":"hits","fields":{"external_id":"id","title":"name"}}}`, false, true},
+		{"api unknown field", `{"crawl_strategy":"api","api":{"endpoint":"/api","results":"hits","fields":{"external_id":"id","title":"name","url":"link","owner":"o"}}}`, false, true},
+		{"api unknown format", `{"crawl_strategy":"api","api":{"endpoint":"/api","format":"csv","results":"hits","fields":{"external_id":"id","title":"name","url":"link"}}}`, false, true},
+		{"api unknown preset", `{"crawl_strategy":"api","api":{"preset":"elastic","endpoint":"/api","results":"hits","fields":{"external_id":"id","title":"name","url":"link"}}}`, false, true},
+		{"api cursor without path", `{"crawl_strategy":"api","api":{"endpoint":"/api","results":"hits","fields":{"external_id":"id","title":"name","url":"link"},
+			"pagination":{"type":"cursor","param":"after"}}}`, false, true},
+		{"api size param without size", `{"crawl_strategy":"api","api":{"endpoint":"/api","results":"hits","fields":{"external_id":"id","title":"name","url":"link"},
+			"pagination":{"type":"page","param":"p","size_param":"n"}}}`, false, true},
+		{"block signatures", `{"block_signatures":["px-captcha","press\\s+and\\s+hold"]}`, false, false},
+		{"invalid block signature", `{"block_signatures":["(unclosed"]}`, false, true},
+		{"wait selector", `{"wait_selector":"div.result-card","wait_timeout_seconds":20}`, false, false},
+		{"negative wait timeout", `{"wait_timeout_seconds":-5}`, false, true},
+		{"title rules", `{"title_rules":["\\s+-\\s+sunbelt$"]}`, false, false},
+		{"invalid title rule", `{"title_rules":["[unclosed"]}`, false, true},
+		{"skip patterns", `{"skip_patterns":["/sponsored/","[?&]category=startup"]}`, false, false},
+		{"invalid skip pattern", `{"skip_patterns":["/ads/","(?P<bad"]}`, false, true},
+		{"headers", `{"headers":{"Sec-CH-UA-Platform":"\"Windows\"","DNT":"1","Sec-Fetch-User":""}}`, false, false},
+		{"invalid header name", `{"headers":{"X Forwarded":"1"}}`, false, true},
+		{"multi-line header value", `{"headers":{"Referer":"https://example.com/\r\nX-Injected: 1"}}`, false, true},
+		{"invalid json", `{`, false, true},
+		{"unknown key", `{"ratelimit":5}`, false, true},
+		{"misspelt key", `{"max_request_per_day":500}`, false, true},
+		{"unknown nested key", `{"crawl_strategy":"sitemap","sitemap":{"listing_pattern":"/listing/","pattern":"x"}}`, false, true},
+		{"trailing data", `{} {}`, false, true},
+		{"null", `null`, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseSourceConfig([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (cfg.Auth != nil) != tt.wantAuth {
+				t.Errorf("Auth = %+v, wantAuth %v", cfg.Auth, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestParseSourceConfigDefaults(t *testing.T) {
+	cfg, err := ParseSourceConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CrawlStrategy != CrawlStrategySearch || cfg.ScrapeWeight != 1 || cfg.MaxRequestsPerDay != 0 {
+		t.Errorf("defaults = %+v, want search strategy, weight 1, no request cap", cfg)
+	}
+
+	cfg, err = ParseSourceConfig([]byte(`{"crawl_strategy":"sitemap","sitemap":{"listing_pattern":"/listing/"},"scrape_weight":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Sitemap.Path != "/sitemap.xml" || cfg.ScrapeWeight != 3 {
+		t.Errorf("sitemap path = %q, weight = %d; want /sitemap.xml, 3", cfg.Sitemap.Path, cfg.ScrapeWeight)
+	}
+
+	cfg, err = ParseSourceConfig([]byte(`{"crawl_strategy":"api","api":{"preset":"algolia","endpoint":"/1/indexes/listings","fields":{"title":"name","url":"url"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := cfg.API
+	if api.Format != APIFormatJSON || api.Results != "hits" || api.Fields["external_id"] != "objectID" {
+		t.Errorf("algolia api = %+v, want json hits keyed by objectID", api)
+	}
+	if p := api.Pagination; p == nil || p.Type != APIPageNumber || p.Param != "page" || *p.Start != 0 || p.TotalPagesPath != "nbPages" {
+		t.Errorf("algolia pagination = %+v, want zero-based pages up to nbPages", p)
+	}
+}
+
+func TestSourceAuthCredentials(t *testing.T) {
+	auth := &SourceAuthConfig{UsernameEnv: "TROUGH_TEST_USER", PasswordEnv: "TROUGH_TEST_PASS"}
+
+	t.Setenv("TROUGH_TEST_USER", "buyer@example.com")
+	t.Setenv("TROUGH_TEST_PASS", "")
+	_, _, err := auth.Credentials()
+	if err == nil {
+		t.Fatal("expected error with password unset")
+	}
+	if strings.Contains(err.Error(), "buyer@example.com") {
+		t.Error("error message leaks the username")
+	}
+
+	t.Setenv("TROUGH_TEST_PASS", "s3cret")
+	user, pass, err := auth.Credentials()
+	if err != nil || user != "buyer@example.com" || pass != "s3cret" {
+		t.Errorf("Credentials = (%q, %q, %v)", user, pass, err)
+	}
+}
+
+func TestNewRequestBudget(t *testing.T) {
+	now := time.Date(2024, 3, 31, 22, 30, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	b := NewRequestBudget(100, 40, now)
+	if b.Remaining != 60 {
+		t.Errorf("Remaining = %d, want 60", b.Remaining)
+	}
+	// 22:30 EST is 03:30 UTC on April 1st, so the budget resets at the start of April 2nd
+	if want := time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC); !b.ResetsAt.Equal(want) {
+		t.Errorf("ResetsAt = %v, want %v", b.ResetsAt, want)
+	}
+
+	// Requests in flight when the budget ran out can push usage past the limit
+	if b := NewRequestBudget(100, 103, now); b.Remaining != 0 {
+		t.Errorf("Remaining = %d, want 0 when over budget", b.Remaining)
+	}
+}
@@ -0,0 +1,79 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const censusURL = "https://geocoding.geo.census.gov/geocoder/locations/onelineaddress"
+
+// Census geocodes US locations with the US Census Bureau geocoder
+type Census struct {
+	client   *http.Client
+	baseURL  string
+	throttle *throttle
+}
+
+func NewCensus() *Census {
+	return &Census{
+		client:   &http.Client{Timeout: 15 * time.Second},
+		baseURL:  censusURL,
+		throttle: &throttle{interval: time.Second},
+	}
+}
+
+func (c *Census) Name() string { return "census" }
+
+func (c *Census) Geocode(ctx context.Context, loc Location) (*Result, error) {
+	if loc.Country != "" && !strings.EqualFold(loc.Country, "US") && !strings.EqualFold(loc.Country, "USA") {
+		return nil, ErrNotFound
+	}
+	if err := c.throttle.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	q := url.Values{}
+	q.Set("address", Location{City: loc.City, State: loc.State}.String())
+	q.Set("benchmark", "Public_AR_Current")
+	q.Set("format", "json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Result struct {
+			AddressMatches []struct {
+				Coordinates struct {
+					X float64 `json:"x"`
+					Y float64 `json:"y"`
+				} `json:"coordinates"`
+			} `json:"addressMatches"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	if len(body.Result.AddressMatches) == 0 {
+		return nil, ErrNotFound
+	}
+
+	coords := body.Result.AddressMatches[0].Coordinates
+	return &Result{Lat: coords.Y, Lng: coords.X, Provider: c.Name()}, nil
+}
@@ -0,0 +1,94 @@
+// Package geocode resolves listing locations (city/state) to coordinates
+package geocode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a provider has no result for a location
+var ErrNotFound = errors.New("location not found")
+
+// Location is a place to geocode
+type Location struct {
+	City    string
+	State   string
+	Country string
+}
+
+func (l Location) String() string {
+	parts := make([]string, 0, 3)
+	for _, p := range []string{l.City, l.State, l.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Result is a resolved coordinate
+type Result struct {
+	Lat      float64
+	Lng      float64
+	Provider string
+}
+
+// Geocoder resolves a location to coordinates
+type Geocoder interface {
+	Name() string
+	Geocode(ctx context.Context, loc Location) (*Result, error)
+}
+
+// Chain tries each geocoder in order and returns the first result.
+// It returns ErrNotFound only if every provider reported not found.
+type Chain []Geocoder
+
+func (c Chain) Name() string { return "chain" }
+
+func (c Chain) Geocode(ctx context.Context, loc Location) (*Result, error) {
+	var errs []error
+	for _, g := range c {
+		result, err := g.Geocode(ctx, loc)
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, ErrNotFound) {
+			errs = append(errs, fmt.Errorf("%s: %w", g.Name(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return nil, ErrNotFound
+}
+
+// throttle spaces calls at least interval apart
+type throttle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     time.Time
+}
+
+func (t *throttle) wait(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if d := t.interval - time.Since(t.last); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	t.last = time.Now()
+	return nil
+}
@@ -0,0 +1,170 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeGeocoder struct {
+	name   string
+	result *Result
+	err    error
+	calls  int
+}
+
+func (f *fakeGeocoder) Name() string { return f.name }
+
+func (f *fakeGeocoder) Geocode(ctx context.Context, loc Location) (*Result, error) {
+	f.calls++
+	return f.result, f.err
+}
+
+func TestChain(t *testing.T) {
+	loc := Location{City: "Austin", State: "TX", Country: "US"}
+
+	tests := []struct {
+		name      string
+		primary   *fakeGeocoder
+		fallback  *fakeGeocoder
+		wantErr   error
+		wantFrom  string
+		wantCalls int
+	}{
+		{
+			name:      "primary succeeds",
+			primary:   &fakeGeocoder{name: "a", result: &Result{Provider: "a"}},
+			fallback:  &fakeGeocoder{name: "b", result: &Result{Provider: "b"}},
+			wantFrom:  "a",
+			wantCalls: 0,
+		},
+		{
+			name:      "falls back on not found",
+			primary:   &fakeGeocoder{name: "a", err: ErrNotFound},
+			fallback:  &fakeGeocoder{name: "b", result: &Result{Provider: "b"}},
+			wantFrom:  "b",
+			wantCalls: 1,
+		},
+		{
+			name:      "falls back on error",
+			primary:   &fakeGeocoder{name: "a", err: errors.New("boom")},
+			fallback:  &fakeGeocoder{name: "b", result: &Result{Provider: "b"}},
+			wantFrom:  "b",
+			wantCalls: 1,
+		},
+		{
+			name:      "all not found",
+			primary:   &fakeGeocoder{name: "a", err: ErrNotFound},
+			fallback:  &fakeGeocoder{name: "b", err: ErrNotFound},
+			wantErr:   ErrNotFound,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Chain{tt.primary, tt.fallback}.Geocode(context.Background(), loc)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if result.Provider != tt.wantFrom {
+				t.Errorf("provider = %q, want %q", result.Provider, tt.wantFrom)
+			}
+			if tt.fallback.calls != tt.wantCalls {
+				t.Errorf("fallback calls = %d, want %d", tt.fallback.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestChainTransientErrorIsNotNotFound(t *testing.T) {
+	chain := Chain{
+		&fakeGeocoder{name: "a", err: errors.New("timeout")},
+		&fakeGeocoder{name: "b", err: ErrNotFound},
+	}
+	_, err := chain.Geocode(context.Background(), Location{State: "TX"})
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want a non-ErrNotFound error", err)
+	}
+}
+
+func TestNominatim(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") == "" {
+			t.Error("missing User-Agent")
+		}
+		if r.URL.Query().Get("city") == "Nowhere" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`[{"lat":"30.2672","lon":"-97.7431"}]`))
+	}))
+	defer srv.Close()
+
+	n := NewNominatim("")
+	n.baseURL = srv.URL
+	n.throttle.interval = 0
+
+	result, err := n.Geocode(context.Background(), Location{City: "Austin", State: "TX", Country: "US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Lat != 30.2672 || result.Lng != -97.7431 {
+		t.Errorf("got (%v, %v), want (30.2672, -97.7431)", result.Lat, result.Lng)
+	}
+
+	if _, err := n.Geocode(context.Background(), Location{City: "Nowhere", State: "TX"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCensus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("address"); got != "Austin, TX" {
+			t.Errorf("address = %q, want %q", got, "Austin, TX")
+		}
+		w.Write([]byte(`{"result":{"addressMatches":[{"coordinates":{"x":-97.74,"y":30.26}}]}}`))
+	}))
+	defer srv.Close()
+
+	c := NewCensus()
+	c.baseURL = srv.URL
+	c.throttle.interval = 0
+
+	result, err := c.Geocode(context.Background(), Location{City: "Austin", State: "TX", Country: "US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Lat != 30.26 || result.Lng != -97.74 {
+		t.Errorf("got (%v, %v), want (30.26, -97.74)", result.Lat, result.Lng)
+	}
+
+	if _, err := c.Geocode(context.Background(), Location{City: "Toronto", State: "ON", Country: "CA"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("non-US: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	th := &throttle{interval: 20 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := th.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 calls took %v, want at least 40ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := th.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
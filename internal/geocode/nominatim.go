@@ -0,0 +1,95 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	nominatimURL = "https://nominatim.openstreetmap.org/search"
+	// DefaultUserAgent identifies us to Nominatim, whose usage policy requires it
+	DefaultUserAgent = "trough-geocoder (+https://github.com/kbsch/trough)"
+)
+
+// Nominatim geocodes with OpenStreetMap's Nominatim, limited to 1 request per second
+type Nominatim struct {
+	client    *http.Client
+	baseURL   string
+	userAgent string
+	throttle  *throttle
+}
+
+func NewNominatim(userAgent string) *Nominatim {
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	return &Nominatim{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		baseURL:   nominatimURL,
+		userAgent: userAgent,
+		throttle:  &throttle{interval: time.Second},
+	}
+}
+
+func (n *Nominatim) Name() string { return "nominatim" }
+
+func (n *Nominatim) Geocode(ctx context.Context, loc Location) (*Result, error) {
+	if err := n.throttle.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	q := url.Values{}
+	q.Set("format", "jsonv2")
+	q.Set("limit", "1")
+	if loc.City != "" {
+		q.Set("city", loc.City)
+	}
+	if loc.State != "" {
+		q.Set("state", loc.State)
+	}
+	if loc.Country != "" {
+		q.Set("country", loc.Country)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.baseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", n.userAgent)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var places []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&places); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	if len(places) == 0 {
+		return nil, ErrNotFound
+	}
+
+	lat, err := strconv.ParseFloat(places[0].Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parsing lat %q: %w", places[0].Lat, err)
+	}
+	lng, err := strconv.ParseFloat(places[0].Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parsing lon %q: %w", places[0].Lon, err)
+	}
+	return &Result{Lat: lat, Lng: lng, Provider: n.Name()}, nil
+}
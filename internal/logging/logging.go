@@ -0,0 +1,39 @@
+// Package logging builds the JSON slog logger shared by the API, the scraper
+// worker and the CLI.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// ParseLevel parses debug, info, warn or error, case-insensitively.
+// An empty string is info.
+func ParseLevel(s string) (slog.Level, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("LOG_LEVEL: unknown level %q (want debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// New returns a JSON logger writing records at or above level to w
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// Init builds a JSON logger on stderr at level and makes it the slog default,
+// so the standard log package writes through it too
+func Init(level slog.Level) *slog.Logger {
+	logger := New(os.Stderr, level)
+	slog.SetDefault(logger)
+	return logger
+}
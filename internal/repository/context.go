@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrCanceled is returned by methods running several queries when the
+// request's context is done before or during one of them; it wraps
+// context.Canceled or context.DeadlineExceeded
+var ErrCanceled = errors.New("query canceled")
+
+// checkContext returns ErrCanceled if ctx is done, so a method running
+// several queries stops before sending the next one
+func checkContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrCanceled, err)
+	}
+	return nil
+}
+
+// queryError returns ErrCanceled for a query that failed because ctx is
+// done, and err otherwise
+func queryError(ctx context.Context, err error) error {
+	if ctxErr := checkContext(ctx); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestQueriesSkippedOnDoneContext(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	for _, tt := range []struct {
+		name  string
+		ctx   context.Context
+		cause error
+	}{
+		{"canceled", canceled, context.Canceled},
+		{"deadline", expired, context.DeadlineExceeded},
+	} {
+		_, err := repo.Search(tt.ctx, domain.ListingSearchParams{Page: 1, PerPage: 10, Facets: []string{"state"}})
+		if !errors.Is(err, ErrCanceled) || !errors.Is(err, tt.cause) {
+			t.Errorf("%s: Search err = %v, want ErrCanceled wrapping %v", tt.name, err, tt.cause)
+		}
+		if _, err := repo.DataQuality(tt.ctx); !errors.Is(err, ErrCanceled) || !errors.Is(err, tt.cause) {
+			t.Errorf("%s: DataQuality err = %v, want ErrCanceled wrapping %v", tt.name, err, tt.cause)
+		}
+		if _, _, err := repo.QualityListings(tt.ctx, ""); !errors.Is(err, ErrCanceled) || !errors.Is(err, tt.cause) {
+			t.Errorf("%s: QualityListings err = %v, want ErrCanceled wrapping %v", tt.name, err, tt.cause)
+		}
+		if _, err := repo.MarketStats(tt.ctx, domain.ListingSearchParams{}, []string{"state"}); !errors.Is(err, ErrCanceled) || !errors.Is(err, tt.cause) {
+			t.Errorf("%s: MarketStats err = %v, want ErrCanceled wrapping %v", tt.name, err, tt.cause)
+		}
+	}
+
+	// No query expected: any sent would fail as unexpected
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSearchStopsAfterCanceledCount(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+
+	// The request times out while the count runs; the main query isn't sent
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12)).
+		WillDelayFor(50 * time.Millisecond)
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err = repo.Search(ctx, domain.ListingSearchParams{Page: 1, PerPage: 10})
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want ErrCanceled wrapping context.Canceled", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
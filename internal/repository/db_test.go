@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// openTestDB connects to the database in TEST_DATABASE_URL, which must already
+// have the migrations applied. Tests needing a database are skipped without it.
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sqlx.Connect("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTestSource inserts a throwaway source and removes it (and its listings) after the test
+func createTestSource(t *testing.T, db *sqlx.DB) *domain.Source {
+	t.Helper()
+
+	id := uuid.New()
+	source := &domain.Source{
+		ID:          id,
+		Name:        "Test " + id.String()[:8],
+		Slug:        "test-" + id.String()[:8],
+		BaseURL:     "https://example.com",
+		ScraperType: domain.ScraperTypeColly,
+		IsActive:    true,
+		Config:      []byte("{}"),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if _, err := NewSourceRepository(db).Upsert(context.Background(), source); err != nil {
+		t.Fatalf("failed to create test source: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM sources WHERE id = $1", id)
+	})
+	return source
+}
+
+// newTestListing returns an active listing for the source with the given external ID
+func newTestListing(source *domain.Source, externalID string) *domain.Listing {
+	now := time.Now()
+	return &domain.Listing{
+		ID:          uuid.New(),
+		SourceID:    source.ID,
+		ExternalID:  externalID,
+		URL:         "https://example.com/listing/" + externalID,
+		Title:       "Listing " + externalID,
+		Country:     domain.StrPtr("US"),
+		RawData:     []byte("{}"),
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+		IsActive:    true,
+	}
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// DefaultMaxDescriptionLength is the default cap, in characters, on the
+// description stored with a listing
+const DefaultMaxDescriptionLength = 10000
+
+// maxFullDescriptionBytes caps the full text of a truncated description kept
+// in raw_data; longer ones are only stored truncated
+const maxFullDescriptionBytes = 64 << 10
+
+// fullDescriptionKey is the raw_data key a truncated description's full text
+// is kept under. The search vector trigger indexes it in place of the
+// stored description.
+const fullDescriptionKey = "full_description"
+
+// SetMaxDescriptionLength caps the description Upsert and UpsertBatch store,
+// in characters; longer ones are cut on a word boundary and flagged
+// description_truncated. n <= 0 keeps DefaultMaxDescriptionLength.
+func (r *ListingRepository) SetMaxDescriptionLength(n int) {
+	if n <= 0 {
+		n = DefaultMaxDescriptionLength
+	}
+	r.maxDescription = n
+}
+
+// limitDescription returns listing as it is stored: if its description is
+// longer than max, a copy with it truncated and flagged, its full text kept in
+// raw_data if that is a JSON object and the text is no longer than
+// maxFullDescriptionBytes
+func limitDescription(listing *domain.Listing, max int) *domain.Listing {
+	if listing.Description == nil {
+		return listing
+	}
+	short, truncated := truncateDescription(*listing.Description, max)
+	if !truncated {
+		return listing
+	}
+
+	stored := *listing
+	stored.Description = &short
+	stored.DescriptionTruncated = true
+	if len(*listing.Description) <= maxFullDescriptionBytes {
+		stored.RawData = withRawField(listing.RawData, fullDescriptionKey, *listing.Description)
+	}
+	return &stored
+}
+
+// truncateDescription cuts text to at most max characters, at the last space
+// before the cut unless that would drop more than half of it, and reports
+// whether it cut anything
+func truncateDescription(text string, max int) (string, bool) {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return text, false
+	}
+
+	// end is the byte offset of the max'th character's end
+	end := 0
+	for i := 0; i < max; i++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	next, _ := utf8.DecodeRuneInString(text[end:])
+	cut := text[:end]
+	if !unicode.IsSpace(next) {
+		if i := strings.LastIndexFunc(cut, unicode.IsSpace); i >= len(cut)/2 {
+			cut = cut[:i]
+		}
+	}
+	return strings.TrimRightFunc(cut, unicode.IsSpace), true
+}
+
+// withRawField returns raw with key set to value, or raw unchanged if it is
+// neither empty nor a JSON object
+func withRawField(raw json.RawMessage, key, value string) json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+			return raw
+		}
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return raw
+	}
+	fields[key] = encoded
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return raw
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestTruncateDescription(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want string
+		cut  bool
+	}{
+		{"short enough", "Profitable cafe", 20, "Profitable cafe", false},
+		{"exactly max", "Profitable cafe", 15, "Profitable cafe", false},
+		{"mid word", "Profitable cafe downtown", 18, "Profitable cafe", true},
+		{"at a space", "Profitable cafe downtown", 15, "Profitable cafe", true},
+		{"just past a space", "Profitable cafe downtown", 16, "Profitable cafe", true},
+		{"trailing punctuation kept", "Great location. Owner retiring", 20, "Great location.", true},
+		{"one long word", "Supercalifragilistic cafe", 10, "Supercalif", true},
+		{"space too early", "A cafeteriarestaurant", 12, "A cafeteriar", true},
+		{"multibyte", "Café crème brûlée shop", 12, "Café crème", true},
+		{"newline boundary", "Owner retiring\nFull staff", 18, "Owner retiring", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cut := truncateDescription(tt.text, tt.max)
+			if got != tt.want || cut != tt.cut {
+				t.Errorf("truncateDescription(%q, %d) = %q, %v; want %q, %v", tt.text, tt.max, got, cut, tt.want, tt.cut)
+			}
+		})
+	}
+}
+
+func TestLimitDescription(t *testing.T) {
+	full := "Profitable cafe downtown with loyal customers"
+	listing := &domain.Listing{Title: "Cafe", Description: &full, RawData: json.RawMessage(`{"html":"<p>"}`)}
+
+	stored := limitDescription(listing, 20)
+	if stored == listing {
+		t.Fatal("truncated listing wasn't copied")
+	}
+	if *stored.Description != "Profitable cafe" || !stored.DescriptionTruncated {
+		t.Errorf("stored description = %q, truncated = %v", *stored.Description, stored.DescriptionTruncated)
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(stored.RawData, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw["full_description"] != full || raw["html"] != "<p>" {
+		t.Errorf("raw_data = %s, want the full text beside the original fields", stored.RawData)
+	}
+	if *listing.Description != full || listing.DescriptionTruncated {
+		t.Error("the caller's listing was changed")
+	}
+
+	if limitDescription(listing, 100) != listing {
+		t.Error("a description under the cap was copied")
+	}
+
+	// Too long, or raw data that isn't an object: the full text isn't kept
+	huge := strings.Repeat("word ", maxFullDescriptionBytes/5+1)
+	stored = limitDescription(&domain.Listing{Description: &huge, RawData: json.RawMessage(`{}`)}, 20)
+	if !stored.DescriptionTruncated || string(stored.RawData) != `{}` {
+		t.Errorf("huge description: truncated = %v, raw_data = %s", stored.DescriptionTruncated, stored.RawData)
+	}
+	stored = limitDescription(&domain.Listing{Description: &full, RawData: json.RawMessage(`[1]`)}, 20)
+	if string(stored.RawData) != `[1]` {
+		t.Errorf("raw_data = %s, want the array left alone", stored.RawData)
+	}
+	stored = limitDescription(&domain.Listing{Description: &full}, 20)
+	if string(stored.RawData) != `{"full_description":"`+full+`"}` {
+		t.Errorf("raw_data = %s, want the full text", stored.RawData)
+	}
+}
+
+func TestUpsertBatchTruncatesDescription(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+	repo.SetMaxDescriptionLength(20)
+
+	full := "Profitable cafe downtown with loyal customers"
+	listing := &domain.Listing{ID: uuid.New(), SourceID: uuid.New(), ExternalID: "1", Title: "Cafe", Description: &full}
+	// The description is stored cut and flagged
+	args := make([]driver.Value, upsertColumnCount)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[upsertColumnIndex(t, "description")] = "Profitable cafe"
+	args[upsertColumnIndex(t, "description_truncated")] = true
+
+	mock.ExpectQuery(`INSERT INTO listings .*'full_description'`).WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows([]string{"source_id", "external_id"}).AddRow(listing.SourceID, "1"))
+	if err := repo.UpsertBatch(context.Background(), []*domain.Listing{listing}); err != nil {
+		t.Fatalf("UpsertBatch failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// upsertColumnIndex returns the argument index of column in upsertColumns
+func upsertColumnIndex(t *testing.T, column string) int {
+	t.Helper()
+	for i, c := range strings.Split(upsertColumns, ",") {
+		if strings.TrimSpace(c) == column {
+			return i
+		}
+	}
+	t.Fatalf("%s isn't an upsert column", column)
+	return -1
+}
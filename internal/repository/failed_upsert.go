@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// RecordFailedUpsert saves a listing the database rejected along with the
+// error, and returns how many times its upsert has now failed. A listing that
+// fails again replaces the saved copy.
+func (r *ListingRepository) RecordFailedUpsert(ctx context.Context, listing *domain.Listing, upsertErr error) (int, error) {
+	data, err := domain.EncodeFailedListing(listing)
+	if err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	err = r.db.GetContext(ctx, &attempts, `
+		INSERT INTO failed_upserts (source_id, external_id, listing, error)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (source_id, external_id) DO UPDATE SET
+			listing = EXCLUDED.listing,
+			error = EXCLUDED.error,
+			attempts = failed_upserts.attempts + 1,
+			last_failed_at = NOW()
+		RETURNING attempts
+	`, listing.SourceID, listing.ExternalID, data, upsertErr.Error())
+	return attempts, err
+}
+
+// FailedUpsertAttempts returns the failed upsert count of each of a source's
+// saved listings, keyed by external ID
+func (r *ListingRepository) FailedUpsertAttempts(ctx context.Context, sourceID uuid.UUID) (map[string]int, error) {
+	rows := []struct {
+		ExternalID string `db:"external_id"`
+		Attempts   int    `db:"attempts"`
+	}{}
+	err := r.db.SelectContext(ctx, &rows, `SELECT external_id, attempts FROM failed_upserts WHERE source_id = $1`, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		attempts[row.ExternalID] = row.Attempts
+	}
+	return attempts, nil
+}
+
+// ClearFailedUpserts removes saved listings that have since been upserted
+func (r *ListingRepository) ClearFailedUpserts(ctx context.Context, sourceID uuid.UUID, externalIDs []string) error {
+	if len(externalIDs) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM failed_upserts WHERE source_id = $1 AND external_id = ANY($2)
+	`, sourceID, pq.Array(externalIDs))
+	return err
+}
+
+// ListFailedUpserts returns saved listings, oldest failure first, optionally
+// only those of one source
+func (r *ListingRepository) ListFailedUpserts(ctx context.Context, sourceSlug string, limit int) ([]domain.FailedUpsert, error) {
+	failed := []domain.FailedUpsert{}
+	err := r.db.SelectContext(ctx, &failed, `
+		SELECT f.source_id, s.slug AS source_slug, f.external_id, f.listing, f.error,
+			f.attempts, f.first_failed_at, f.last_failed_at
+		FROM failed_upserts f
+		JOIN sources s ON s.id = f.source_id
+		WHERE $1 = '' OR s.slug = $1
+		ORDER BY f.first_failed_at, f.external_id
+		LIMIT $2
+	`, sourceSlug, limit)
+	if err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
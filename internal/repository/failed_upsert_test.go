@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFailedUpserts(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	l := newTestListing(source, "rejected")
+	for want := 1; want <= 2; want++ {
+		attempts, err := repo.RecordFailedUpsert(ctx, l, errors.New("value too long"))
+		if err != nil {
+			t.Fatalf("RecordFailedUpsert failed: %v", err)
+		}
+		if attempts != want {
+			t.Errorf("attempts = %d, want %d", attempts, want)
+		}
+	}
+
+	counts, err := repo.FailedUpsertAttempts(ctx, source.ID)
+	if err != nil {
+		t.Fatalf("FailedUpsertAttempts failed: %v", err)
+	}
+	if counts["rejected"] != 2 {
+		t.Errorf("attempts[rejected] = %d, want 2", counts["rejected"])
+	}
+
+	failed, err := repo.ListFailedUpserts(ctx, source.Slug, 10)
+	if err != nil {
+		t.Fatalf("ListFailedUpserts failed: %v", err)
+	}
+	if len(failed) != 1 {
+		t.Fatalf("got %d failed upserts, want 1", len(failed))
+	}
+	if failed[0].SourceSlug != source.Slug || failed[0].Error != "value too long" {
+		t.Errorf("failed upsert = %+v", failed[0])
+	}
+
+	// The stored listing replays as scraped
+	replayed, err := failed[0].DecodeListing()
+	if err != nil {
+		t.Fatalf("DecodeListing failed: %v", err)
+	}
+	if err := repo.Upsert(ctx, replayed); err != nil {
+		t.Fatalf("Upsert of replayed listing failed: %v", err)
+	}
+
+	if err := repo.ClearFailedUpserts(ctx, source.ID, []string{"rejected"}); err != nil {
+		t.Fatalf("ClearFailedUpserts failed: %v", err)
+	}
+	counts, err = repo.FailedUpsertAttempts(ctx, source.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 0 {
+		t.Errorf("got %d failed upserts after clear, want 0", len(counts))
+	}
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+type FranchiseRepository struct {
+	db *sqlx.DB
+}
+
+func NewFranchiseRepository(db *sqlx.DB) *FranchiseRepository {
+	return &FranchiseRepository{db: db}
+}
+
+// List returns the franchises with active listings, with how many each has,
+// most listings first
+func (r *FranchiseRepository) List(ctx context.Context) ([]domain.Franchise, error) {
+	franchises := []domain.Franchise{}
+	err := r.db.SelectContext(ctx, &franchises, `
+		SELECT f.id, f.slug, f.name, f.created_at, COUNT(l.id) AS listing_count
+		FROM franchises f
+		JOIN listings l ON l.franchise_id = f.id AND l.is_active = true AND l.hidden = false
+		GROUP BY f.id
+		ORDER BY listing_count DESC, f.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return franchises, nil
+}
+
+// GetBySlug returns a franchise, or sql.ErrNoRows if there is none
+func (r *FranchiseRepository) GetBySlug(ctx context.Context, slug string) (*domain.Franchise, error) {
+	var franchise domain.Franchise
+	err := r.db.GetContext(ctx, &franchise, `
+		SELECT f.id, f.slug, f.name, f.created_at,
+			(SELECT COUNT(*) FROM listings l WHERE l.franchise_id = f.id AND l.is_active = true AND l.hidden = false) AS listing_count
+		FROM franchises f
+		WHERE f.slug = $1
+	`, slug)
+	if err != nil {
+		return nil, err
+	}
+	return &franchise, nil
+}
+
+// linkFranchises links the franchise resales among listings to the franchise
+// of their brand (domain.Listing.FranchiseKey), creating franchises seen for
+// the first time. Listings already linked are left alone, so unchanged
+// listings skipped by the upsert cost nothing once linked.
+func (r *ListingRepository) linkFranchises(ctx context.Context, listings []*domain.Listing) error {
+	var sourceIDs, externalIDs, slugs []string
+	names := make(map[string]string)
+	for _, l := range listings {
+		name, slug := l.FranchiseKey()
+		if slug == "" {
+			continue
+		}
+		if _, ok := names[slug]; !ok {
+			names[slug] = name
+		}
+		sourceIDs = append(sourceIDs, l.SourceID.String())
+		externalIDs = append(externalIDs, l.ExternalID)
+		slugs = append(slugs, slug)
+	}
+	if len(slugs) == 0 {
+		return nil
+	}
+
+	// A franchise keeps the name it was first seen with
+	newSlugs := make([]string, 0, len(names))
+	newNames := make([]string, 0, len(names))
+	for slug, name := range names {
+		newSlugs = append(newSlugs, slug)
+		newNames = append(newNames, name)
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO franchises (slug, name)
+		SELECT * FROM unnest($1::text[], $2::text[])
+		ON CONFLICT (slug) DO NOTHING
+	`, pq.Array(newSlugs), pq.Array(newNames))
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE listings l SET franchise_id = f.id
+		FROM unnest($1::uuid[], $2::text[], $3::text[]) AS u(source_id, external_id, slug)
+		JOIN franchises f ON f.slug = u.slug
+		WHERE l.source_id = u.source_id AND l.external_id = u.external_id
+			AND l.franchise_id IS DISTINCT FROM f.id
+	`, pq.Array(sourceIDs), pq.Array(externalIDs), pq.Array(slugs))
+	return err
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestFranchiseGrouping(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	other := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	franchises := NewFranchiseRepository(db)
+	ctx := context.Background()
+
+	// A brand no other test uses, so the franchise's counts are this test's
+	brand := "Testbrand" + uuid.New().String()[:8]
+	_, slug := domain.NormalizeFranchiseName(brand)
+	t.Cleanup(func() { db.Exec("DELETE FROM franchises WHERE slug = $1", slug) })
+
+	first := newTestListing(source, "franchise-1")
+	first.IsFranchise = domain.Ptr(true)
+	first.FranchiseName = domain.StrPtr(brand + " Franchise - Dallas, TX")
+	second := newTestListing(other, "franchise-2")
+	second.FranchiseName = domain.StrPtr(brand + " #12")
+	notFranchise := newTestListing(source, "franchise-3")
+	notFranchise.IsFranchise = domain.Ptr(false)
+	notFranchise.FranchiseName = domain.StrPtr(brand)
+	if err := repo.UpsertBatch(ctx, []*domain.Listing{first, notFranchise}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+
+	franchise, err := franchises.GetBySlug(ctx, slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if franchise.Name != brand || franchise.ListingCount != 2 {
+		t.Errorf("franchise = %q with %d listings, want %q with 2", franchise.Name, franchise.ListingCount, brand)
+	}
+
+	result, err := repo.Search(ctx, domain.ListingSearchParams{FranchiseID: &franchise.ID, Page: 1, PerPage: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 2 {
+		t.Errorf("franchise search found %d listings, want 2", result.Total)
+	}
+	got, err := repo.GetByID(ctx, notFranchise.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FranchiseID != nil {
+		t.Error("listing marked not a franchise was linked to a franchise")
+	}
+
+	// Renamed to another brand, the listing leaves the franchise
+	first.FranchiseName = domain.StrPtr("Other" + brand)
+	t.Cleanup(func() { db.Exec("DELETE FROM franchises WHERE slug = $1", "other"+slug) })
+	if err := repo.Upsert(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if franchise, err = franchises.GetBySlug(ctx, slug); err != nil {
+		t.Fatal(err)
+	}
+	if franchise.ListingCount != 1 {
+		t.Errorf("franchise has %d listings after a rename, want 1", franchise.ListingCount)
+	}
+}
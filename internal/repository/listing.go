@@ -2,149 +2,451 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 
 	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/scoring"
+	"github.com/kbsch/trough/internal/taxonomy"
 )
 
+// DefaultMaxRows is the default cap on the rows one listing query returns
+const DefaultMaxRows = 1000
+
 type ListingRepository struct {
-	db *sqlx.DB
+	// db is the primary, which takes every write and the reads that must see
+	// them; replicas take Search, GetByID and GetFilterOptions
+	db       *sqlx.DB
+	replicas []*sqlx.DB
+	next     atomic.Uint64
+	sorts    searchSorts
+	maxRows  int
+	// maxDescription caps the stored description; see SetMaxDescriptionLength
+	maxDescription int
 }
 
 func NewListingRepository(db *sqlx.DB) *ListingRepository {
-	return &ListingRepository{db: db}
+	return NewListingRepositoryWithReplicas(db)
+}
+
+// NewListingRepositoryWithReplicas returns a repository writing to primary
+// and spreading search, detail and filter reads across replicas in turn.
+// Without replicas every query goes to primary.
+func NewListingRepositoryWithReplicas(primary *sqlx.DB, replicas ...*sqlx.DB) *ListingRepository {
+	return &ListingRepository{
+		db:             primary,
+		replicas:       replicas,
+		sorts:          newSearchSorts(),
+		maxRows:        DefaultMaxRows,
+		maxDescription: DefaultMaxDescriptionLength,
+	}
+}
+
+// readDB returns the database for a read that may lag behind writes: the
+// next replica, or the primary if there are none
+func (r *ListingRepository) readDB() *sqlx.DB {
+	if len(r.replicas) == 0 {
+		return r.db
+	}
+	return r.replicas[(r.next.Add(1)-1)%uint64(len(r.replicas))]
+}
+
+// SetMaxRows caps the rows a single Search or Nearby query returns, whatever
+// the caller asks for, so no request can pull the whole table into memory.
+// Callers needing more must page through the results. n <= 0 keeps
+// DefaultMaxRows.
+func (r *ListingRepository) SetMaxRows(n int) {
+	if n <= 0 {
+		n = DefaultMaxRows
+	}
+	r.maxRows = n
+}
+
+// MaxRows returns the cap set by SetMaxRows
+func (r *ListingRepository) MaxRows() int {
+	return r.maxRows
+}
+
+// clampRows limits a requested row count to the configured cap
+func (r *ListingRepository) clampRows(n int) int {
+	return min(n, r.maxRows)
 }
 
 const listingColumns = `id, source_id, external_id, url, title, description,
 	asking_price, revenue, cash_flow, ebitda, inventory_value,
+	asking_price_max, revenue_max, cash_flow_max,
 	real_estate_included, real_estate_value,
 	city, state, zip_code, country, lat, lng,
 	industry, industry_category, business_type, year_established, employees, reason_for_sale,
-	lease_expiration, monthly_rent, is_franchise, franchise_name,
-	raw_data, first_seen_at, last_seen_at, is_active`
+	lease_expiration, monthly_rent, is_franchise, franchise_name, is_featured,
+	broker_name, broker_phone,
+	raw_data, first_seen_at, last_seen_at, is_active, enriched_at, updated_at, hidden,
+	relisted_at, relist_count, content_hash, franchise_id, tags, description_truncated,
+	financial_score, price_on_request`
+
+// sourceScrapeWeightColumn is the scrape_weight of a listing's source, which
+// its freshness is worked out from; NULL unless it is a positive integer
+const sourceScrapeWeightColumn = `CASE WHEN s.config->>'scrape_weight' ~ '^[1-9][0-9]{0,5}$'
+		THEN (s.config->>'scrape_weight')::int END AS source_scrape_weight`
+
+// listingSelect returns the SELECT list and FROM clause for listings aliased as "l"
+// joined with their source as "s", embedding the Source when includeSource is set
+func listingSelect(includeSource bool) (columns, from string) {
+	parts := strings.Split(listingColumns, ",")
+	for i, c := range parts {
+		parts[i] = "l." + strings.TrimSpace(c)
+	}
+	columns = strings.Join(parts, ", ") + ", " + sourceScrapeWeightColumn
+	from = "listings l JOIN sources s ON s.id = l.source_id"
+
+	if includeSource {
+		columns += `, s.id AS "source.id", s.name AS "source.name", s.slug AS "source.slug", s.base_url AS "source.base_url"`
+	}
+	return columns, from
+}
 
 func (r *ListingRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Listing, error) {
+	return r.GetByIDWithOptions(ctx, id, false)
+}
+
+// GetByIDWithOptions fetches an active listing, optionally embedding its source
+func (r *ListingRepository) GetByIDWithOptions(ctx context.Context, id uuid.UUID, includeSource bool) (*domain.Listing, error) {
 	var listing domain.Listing
-	query := fmt.Sprintf(`SELECT %s FROM listings WHERE id = $1 AND is_active = true`, listingColumns)
-	err := r.db.GetContext(ctx, &listing, query, id)
+	columns, from := listingSelect(includeSource)
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE l.id = $1 AND l.is_active = true AND l.hidden = false`, columns, from)
+	err := r.readDB().GetContext(ctx, &listing, query, id)
 	if err != nil {
 		return nil, err
 	}
 	return &listing, nil
 }
 
-func (r *ListingRepository) Search(ctx context.Context, params domain.ListingSearchParams) (*domain.ListingSearchResult, error) {
-	var conditions []string
+// GetByIDs fetches active listings by ID in a single query. IDs that don't
+// exist, are inactive or hidden are left out; rows come back in no particular order.
+func (r *ListingRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.Listing, error) {
+	listings := []domain.Listing{}
+	if len(ids) == 0 {
+		return listings, nil
+	}
+
+	idStrs := make([]string, len(ids))
+	for i, id := range ids {
+		idStrs[i] = id.String()
+	}
+
+	columns, from := listingSelect(false)
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE l.id = ANY($1::uuid[]) AND l.is_active = true AND l.hidden = false`, columns, from)
+	if err := r.db.SelectContext(ctx, &listings, query, pq.Array(idStrs)); err != nil {
+		return nil, err
+	}
+	return listings, nil
+}
+
+// metersPerMile converts PostGIS geography distances to miles
+const metersPerMile = 1609.344
+
+// distanceMilesSQL is the great-circle distance in miles between a listing and
+// the point ($lng, $lat) at the given argument positions
+func distanceMilesSQL(lngArg, latArg int) string {
+	return fmt.Sprintf("ST_Distance(ST_MakePoint(l.lng, l.lat)::geography, ST_MakePoint($%d, $%d)::geography) / %g", lngArg, latArg, metersPerMile)
+}
+
+// Nearby returns up to limit other active listings near the given one, closest
+// first. Listings without coordinates match on city and state instead, with no
+// distance; listings with neither get an empty result.
+func (r *ListingRepository) Nearby(ctx context.Context, listing *domain.Listing, radiusMiles float64, limit int) ([]domain.NearbyListing, error) {
+	nearby := []domain.NearbyListing{}
+	columns, from := listingSelect(false)
+	limit = r.clampRows(limit)
+
+	var query string
 	var args []interface{}
+	switch {
+	case listing.Lat != nil && listing.Lng != nil:
+		// The latitude band lets Postgres use idx_listings_location before the exact distance check
+		distance := distanceMilesSQL(2, 3)
+		query = fmt.Sprintf(`
+			SELECT %s, %s AS distance_miles FROM %s
+			WHERE l.id <> $1 AND l.is_active = true AND l.hidden = false
+				AND l.lat BETWEEN $3::float8 - $5::float8 AND $3::float8 + $5::float8 AND l.lng IS NOT NULL
+				AND ST_DWithin(ST_MakePoint(l.lng, l.lat)::geography, ST_MakePoint($2, $3)::geography, $4::float8)
+			ORDER BY distance_miles, l.id
+			LIMIT $6`, columns, distance, from)
+		args = []interface{}{listing.ID, *listing.Lng, *listing.Lat, radiusMiles * metersPerMile, radiusMiles / 69.0, limit}
+	case listing.City != nil && listing.State != nil:
+		query = fmt.Sprintf(`
+			SELECT %s, NULL::float8 AS distance_miles FROM %s
+			WHERE l.id <> $1 AND l.is_active = true AND l.hidden = false
+				AND lower(l.city) = lower($2) AND l.state = $3
+			ORDER BY l.is_featured DESC, l.last_seen_at DESC, l.id
+			LIMIT $4`, columns, from)
+		args = []interface{}{listing.ID, *listing.City, *listing.State, limit}
+	default:
+		return nearby, nil
+	}
+
+	if err := r.db.SelectContext(ctx, &nearby, query, args...); err != nil {
+		return nil, err
+	}
+	return nearby, nil
+}
+
+// GetRawByID returns the scraped raw data for a listing, including inactive ones
+func (r *ListingRepository) GetRawByID(ctx context.Context, id uuid.UUID) (*domain.ListingRaw, error) {
+	var raw domain.ListingRaw
+	err := r.db.GetContext(ctx, &raw, `
+		SELECT l.id, l.external_id, l.url, COALESCE(l.raw_data, '{}') as raw_data,
+			l.last_seen_at, l.is_active, s.name as source_name, s.slug as source_slug
+		FROM listings l
+		JOIN sources s ON s.id = l.source_id
+		WHERE l.id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+// searchConditions returns the WHERE conditions and their args for the
+// filters in params, and the index of each facetable filter's condition
+func searchConditions(params domain.ListingSearchParams) (conditions []string, args []interface{}, facetConditions map[string]int) {
 	argIdx := 1
 
-	conditions = append(conditions, "is_active = true")
+	conditions = append(conditions, "l.is_active = true", "l.hidden = false")
+
+	if params.SourceID != nil {
+		conditions = append(conditions, fmt.Sprintf("l.source_id = $%d", argIdx))
+		args = append(args, *params.SourceID)
+		argIdx++
+	}
+
+	if params.FranchiseID != nil {
+		conditions = append(conditions, fmt.Sprintf("l.franchise_id = $%d", argIdx))
+		args = append(args, *params.FranchiseID)
+		argIdx++
+	}
 
 	if params.Query != "" {
-		conditions = append(conditions, fmt.Sprintf("search_vector @@ plainto_tsquery('english', $%d)", argIdx))
+		conditions = append(conditions, fmt.Sprintf("l.search_vector @@ plainto_tsquery('english', $%d)", argIdx))
 		args = append(args, params.Query)
 		argIdx++
 	}
 
+	// Ranged figures match a filter they overlap: minimums compare with the
+	// high end, the price maximum with the low end
 	if params.PriceMin != nil {
-		conditions = append(conditions, fmt.Sprintf("asking_price >= $%d", argIdx))
+		conditions = append(conditions, fmt.Sprintf("COALESCE(l.asking_price_max, l.asking_price) >= $%d", argIdx))
 		args = append(args, *params.PriceMin)
 		argIdx++
 	}
 
 	if params.PriceMax != nil {
-		conditions = append(conditions, fmt.Sprintf("asking_price <= $%d", argIdx))
+		conditions = append(conditions, fmt.Sprintf("l.asking_price <= $%d", argIdx))
 		args = append(args, *params.PriceMax)
 		argIdx++
 	}
 
 	if params.RevenueMin != nil {
-		conditions = append(conditions, fmt.Sprintf("revenue >= $%d", argIdx))
+		conditions = append(conditions, fmt.Sprintf("COALESCE(l.revenue_max, l.revenue) >= $%d", argIdx))
 		args = append(args, *params.RevenueMin)
 		argIdx++
 	}
 
 	if params.CashFlowMin != nil {
-		conditions = append(conditions, fmt.Sprintf("cash_flow >= $%d", argIdx))
+		conditions = append(conditions, fmt.Sprintf("COALESCE(l.cash_flow_max, l.cash_flow) >= $%d", argIdx))
 		args = append(args, *params.CashFlowMin)
 		argIdx++
 	}
 
+	if params.MinScore != nil {
+		conditions = append(conditions, fmt.Sprintf("l.financial_score >= $%d", argIdx))
+		args = append(args, *params.MinScore)
+		argIdx++
+	}
+
+	// Index of each facetable filter's condition, so facet counts can drop it
+	facetConditions = make(map[string]int)
+
 	if len(params.States) > 0 {
+		facetConditions["state"] = len(conditions)
 		placeholders := make([]string, len(params.States))
 		for i, s := range params.States {
 			placeholders[i] = fmt.Sprintf("$%d", argIdx)
 			args = append(args, s)
 			argIdx++
 		}
-		conditions = append(conditions, fmt.Sprintf("state IN (%s)", strings.Join(placeholders, ",")))
+		conditions = append(conditions, fmt.Sprintf("l.state IN (%s)", strings.Join(placeholders, ",")))
 	}
 
 	if len(params.Industries) > 0 {
+		facetConditions["industry"] = len(conditions)
 		placeholders := make([]string, len(params.Industries))
 		for i, s := range params.Industries {
 			placeholders[i] = fmt.Sprintf("$%d", argIdx)
 			args = append(args, s)
 			argIdx++
 		}
-		conditions = append(conditions, fmt.Sprintf("industry IN (%s)", strings.Join(placeholders, ",")))
+		conditions = append(conditions, fmt.Sprintf("l.industry IN (%s)", strings.Join(placeholders, ",")))
+	}
+
+	if len(params.BusinessTypes) > 0 {
+		facetConditions["business_type"] = len(conditions)
+		placeholders := make([]string, len(params.BusinessTypes))
+		for i, s := range params.BusinessTypes {
+			placeholders[i] = fmt.Sprintf("$%d", argIdx)
+			args = append(args, s)
+			argIdx++
+		}
+		conditions = append(conditions, fmt.Sprintf("l.business_type IN (%s)", strings.Join(placeholders, ",")))
+	}
+
+	if len(params.Categories) > 0 {
+		facetConditions["category"] = len(conditions)
+		placeholders := make([]string, len(params.Categories))
+		for i, s := range params.Categories {
+			placeholders[i] = fmt.Sprintf("$%d", argIdx)
+			args = append(args, s)
+			argIdx++
+		}
+		conditions = append(conditions, fmt.Sprintf("l.industry_category IN (%s)", strings.Join(placeholders, ",")))
+	}
+
+	if len(params.Tags) > 0 {
+		facetConditions["tags"] = len(conditions)
+		// && matches listings with any of the tags, @> those with all of them
+		op := "&&"
+		if params.TagsMatchAll {
+			op = "@>"
+		}
+		conditions = append(conditions, fmt.Sprintf("l.tags %s $%d::text[]", op, argIdx))
+		args = append(args, pq.Array(params.Tags))
+		argIdx++
 	}
 
 	if params.Franchise != nil && *params.Franchise {
-		conditions = append(conditions, "is_franchise = true")
+		conditions = append(conditions, "l.is_franchise = true")
 	}
 
 	if params.RealEstate != nil && *params.RealEstate {
-		conditions = append(conditions, "real_estate_included = true")
+		conditions = append(conditions, "l.real_estate_included = true")
+	}
+
+	if params.PriceOnRequest != nil {
+		conditions = append(conditions, fmt.Sprintf("l.price_on_request = $%d", argIdx))
+		args = append(args, *params.PriceOnRequest)
+		argIdx++
+	}
+
+	if params.FeaturedOnly != nil && *params.FeaturedOnly {
+		conditions = append(conditions, "l.is_featured = true")
+	}
+
+	if params.Relisted != nil && *params.Relisted {
+		conditions = append(conditions, "l.relisted_at IS NOT NULL")
 	}
 
 	if params.Bounds != nil {
 		conditions = append(conditions, fmt.Sprintf(
-			"lat BETWEEN $%d AND $%d AND lng BETWEEN $%d AND $%d",
+			"l.lat BETWEEN $%d AND $%d AND l.lng BETWEEN $%d AND $%d",
 			argIdx, argIdx+1, argIdx+2, argIdx+3,
 		))
 		args = append(args, params.Bounds.SouthLat, params.Bounds.NorthLat, params.Bounds.WestLng, params.Bounds.EastLng)
 		argIdx += 4
 	}
 
+	return conditions, args, facetConditions
+}
+
+func (r *ListingRepository) Search(ctx context.Context, params domain.ListingSearchParams) (*domain.ListingSearchResult, error) {
+	conditions, args, facetConditions := searchConditions(params)
+	argIdx := len(args) + 1
 	whereClause := strings.Join(conditions, " AND ")
 
-	// Order by
-	orderBy := "last_seen_at DESC"
-	switch params.Sort {
-	case "price_asc":
-		orderBy = "asking_price ASC NULLS LAST"
-	case "price_desc":
-		orderBy = "asking_price DESC NULLS LAST"
-	case "newest":
-		orderBy = "first_seen_at DESC"
+	// Order by, with id as a tiebreaker so rows sharing a sort value keep a
+	// stable order and LIMIT/OFFSET pages neither repeat nor skip them
+	order, err := r.sorts.resolve(params.Sort, params.Nulls)
+	if err != nil {
+		return nil, err
+	}
+	var seed string
+	if order.random {
+		if seed, err = searchSeed(params.Seed, time.Now()); err != nil {
+			return nil, err
+		}
 	}
 
-	// Count query
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM listings WHERE %s", whereClause)
-	var total int
-	if err := r.db.GetContext(ctx, &total, countQuery, args...); err != nil {
+	// The count, facet and main queries run in turn, on the same replica;
+	// each checks the request's context first so a timed-out request stops
+	// at once
+	db := r.readDB()
+	if err := checkContext(ctx); err != nil {
 		return nil, err
 	}
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM listings l WHERE %s", whereClause)
+	var total int
+	if err := db.GetContext(ctx, &total, countQuery, args...); err != nil {
+		return nil, queryError(ctx, err)
+	}
+
+	var facets map[string][]domain.FilterOption
+	if len(params.Facets) > 0 {
+		var err error
+		facets, err = searchFacets(ctx, db, params.Facets, conditions, facetConditions, args)
+		if err != nil {
+			return nil, queryError(ctx, err)
+		}
+	}
+
+	// PerPage 0 asks only for the count, so the main query is skipped
+	if params.PerPage == 0 {
+		return &domain.ListingSearchResult{
+			Listings: []domain.Listing{},
+			Total:    total,
+			Page:     1,
+			Sort:     order.sort,
+			Nulls:    order.nulls,
+			Seed:     seed,
+			Facets:   facets,
+		}, nil
+	}
 
-	// Main query with pagination
+	// Main query with pagination, capped however many rows were asked for
+	params.PerPage = r.clampRows(params.PerPage)
+	params.Page = max(params.Page, 1)
 	offset := (params.Page - 1) * params.PerPage
+	orderBy := order.orderBy
+	if order.random {
+		orderBy = randomOrderBy(argIdx)
+		args = append(args, seed)
+		argIdx++
+	}
+	columns, from := listingSelect(params.IncludeSource)
 	query := fmt.Sprintf(`
-		SELECT %s FROM listings
+		SELECT %s FROM %s
 		WHERE %s
 		ORDER BY %s
 		LIMIT $%d OFFSET $%d
-	`, listingColumns, whereClause, orderBy, argIdx, argIdx+1)
+	`, columns, from, whereClause, orderBy, argIdx, argIdx+1)
 	args = append(args, params.PerPage, offset)
 
-	var listings []domain.Listing
-	if err := r.db.SelectContext(ctx, &listings, query, args...); err != nil {
+	if err := checkContext(ctx); err != nil {
 		return nil, err
 	}
+	var listings []domain.Listing
+	if err := db.SelectContext(ctx, &listings, query, args...); err != nil {
+		return nil, queryError(ctx, err)
+	}
 
 	totalPages := (total + params.PerPage - 1) / params.PerPage
 
@@ -154,108 +456,238 @@ func (r *ListingRepository) Search(ctx context.Context, params domain.ListingSea
 		Page:       params.Page,
 		PerPage:    params.PerPage,
 		TotalPages: totalPages,
+		Sort:       order.sort,
+		Nulls:      order.nulls,
+		Seed:       seed,
+		Facets:     facets,
 	}, nil
 }
 
+// facetColumns maps the facet names accepted by Search to their columns
+var facetColumns = map[string]string{
+	"state":         "l.state",
+	"industry":      "l.industry",
+	"business_type": "l.business_type",
+	"category":      "l.industry_category",
+	"tags":          "t.tag",
+}
+
+// FacetNames returns the facet names Search accepts, sorted
+func FacetNames() []string {
+	names := make([]string, 0, len(facetColumns))
+	for name := range facetColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// facetJoins are the FROM items a facet's column comes from besides listings
+var facetJoins = map[string]string{
+	"tags": "CROSS JOIN LATERAL unnest(l.tags) AS t(tag)",
+}
+
+// facetLimit caps the number of values returned per facet
+const facetLimit = 50
+
+// searchFacets counts matching listings per value of each requested facet, using
+// the search's own conditions and args. A facet's own filter is neutralized (OR
+// true) rather than removed, so its placeholders stay bound and args can be reused.
+func searchFacets(ctx context.Context, db *sqlx.DB, names []string, conditions []string, facetConditions map[string]int, args []interface{}) (map[string][]domain.FilterOption, error) {
+	facets := make(map[string][]domain.FilterOption)
+	for _, name := range names {
+		column, ok := facetColumns[name]
+		if !ok {
+			continue
+		}
+		if _, done := facets[name]; done {
+			continue
+		}
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+
+		conds := append([]string(nil), conditions...)
+		if i, ok := facetConditions[name]; ok {
+			conds[i] = fmt.Sprintf("(%s OR true)", conds[i])
+		}
+		conds = append(conds, fmt.Sprintf("%s IS NOT NULL AND %s != ''", column, column))
+
+		query := fmt.Sprintf(`
+			SELECT %s AS value, %s AS label, COUNT(*) AS count
+			FROM listings l %s
+			WHERE %s
+			GROUP BY %s
+			ORDER BY count DESC, value
+			LIMIT %d
+		`, column, column, facetJoins[name], strings.Join(conds, " AND "), column, facetLimit)
+
+		options := []domain.FilterOption{}
+		if err := db.SelectContext(ctx, &options, query, args...); err != nil {
+			return nil, fmt.Errorf("facet %s: %w", name, err)
+		}
+		facets[name] = options
+	}
+	return facets, nil
+}
+
 func (r *ListingRepository) GetFilterOptions(ctx context.Context) (*domain.FilterOptions, error) {
-	var industries []domain.FilterOption
-	err := r.db.SelectContext(ctx, &industries, `
-		SELECT industry as value, industry as label, COUNT(*) as count
-		FROM listings
-		WHERE is_active = true AND industry IS NOT NULL AND industry != ''
-		GROUP BY industry
-		ORDER BY count DESC
-		LIMIT 50
-	`)
+	db := r.readDB()
+	industries, err := filterOptions(ctx, db, "industry", 50)
 	if err != nil {
 		return nil, err
 	}
 
-	var states []domain.FilterOption
-	err = r.db.SelectContext(ctx, &states, `
-		SELECT state as value, state as label, COUNT(*) as count
-		FROM listings
-		WHERE is_active = true AND state IS NOT NULL AND state != ''
-		GROUP BY state
+	states, err := filterOptions(ctx, db, "state", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	businessTypes, err := filterOptions(ctx, db, "business_type", 50)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := filterOptions(ctx, db, "industry_category", 50)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []domain.FilterOption{}
+	err = db.SelectContext(ctx, &tags, `
+		SELECT tag as value, tag as label, COUNT(*) as count
+		FROM listings, unnest(tags) AS tag
+		WHERE is_active = true AND hidden = false
+		GROUP BY tag
 		ORDER BY count DESC
 	`)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("filter options for tags: %w", err)
 	}
 
 	var priceRange domain.PriceRange
-	err = r.db.GetContext(ctx, &priceRange, `
+	err = db.GetContext(ctx, &priceRange, `
 		SELECT COALESCE(MIN(asking_price), 0) as min, COALESCE(MAX(asking_price), 0) as max
 		FROM listings
-		WHERE is_active = true AND asking_price IS NOT NULL
+		WHERE is_active = true AND hidden = false AND asking_price IS NOT NULL
 	`)
 	if err != nil {
 		return nil, err
 	}
 
 	return &domain.FilterOptions{
-		Industries: industries,
-		States:     states,
-		PriceRange: priceRange,
+		Industries:    industries,
+		States:        states,
+		BusinessTypes: businessTypes,
+		Categories:    categories,
+		Tags:          tags,
+		PriceRange:    priceRange,
 	}, nil
 }
 
-func (r *ListingRepository) Upsert(ctx context.Context, listing *domain.Listing) error {
-	query := `
-		INSERT INTO listings (
-			id, source_id, external_id, url, title, description,
-			asking_price, revenue, cash_flow, ebitda, inventory_value,
-			real_estate_included, real_estate_value,
-			city, state, zip_code, country, lat, lng,
-			industry, industry_category, business_type, year_established, employees, reason_for_sale,
-			lease_expiration, monthly_rent,
-			is_franchise, franchise_name,
-			raw_data, first_seen_at, last_seen_at, is_active,
-			search_vector
-		) VALUES (
-			$1, $2, $3, $4, $5, $6,
-			$7, $8, $9, $10, $11,
-			$12, $13,
-			$14, $15, $16, $17, $18, $19,
-			$20, $21, $22, $23, $24, $25,
-			$26, $27,
-			$28, $29,
-			$30, $31, $32, $33,
-			to_tsvector('english', COALESCE($5, '') || ' ' || COALESCE($6, '') || ' ' || COALESCE($20, ''))
-		)
-		ON CONFLICT (source_id, external_id) DO UPDATE SET
-			url = EXCLUDED.url,
-			title = EXCLUDED.title,
-			description = EXCLUDED.description,
-			asking_price = EXCLUDED.asking_price,
-			revenue = EXCLUDED.revenue,
-			cash_flow = EXCLUDED.cash_flow,
-			ebitda = EXCLUDED.ebitda,
-			inventory_value = EXCLUDED.inventory_value,
-			real_estate_included = EXCLUDED.real_estate_included,
-			real_estate_value = EXCLUDED.real_estate_value,
-			city = EXCLUDED.city,
-			state = EXCLUDED.state,
-			zip_code = EXCLUDED.zip_code,
-			lat = EXCLUDED.lat,
-			lng = EXCLUDED.lng,
-			industry = EXCLUDED.industry,
-			industry_category = EXCLUDED.industry_category,
-			business_type = EXCLUDED.business_type,
-			year_established = EXCLUDED.year_established,
-			employees = EXCLUDED.employees,
-			reason_for_sale = EXCLUDED.reason_for_sale,
-			lease_expiration = EXCLUDED.lease_expiration,
-			monthly_rent = EXCLUDED.monthly_rent,
-			is_franchise = EXCLUDED.is_franchise,
-			franchise_name = EXCLUDED.franchise_name,
-			raw_data = EXCLUDED.raw_data,
-			last_seen_at = EXCLUDED.last_seen_at,
-			is_active = true,
-			search_vector = to_tsvector('english', COALESCE(EXCLUDED.title, '') || ' ' || COALESCE(EXCLUDED.description, '') || ' ' || COALESCE(EXCLUDED.industry, ''))
-	`
-
-	_, err := r.db.ExecContext(ctx, query,
+// filterOptions counts visible listings per non-empty value of column, most
+// common first. A limit of 0 returns every value.
+func filterOptions(ctx context.Context, db *sqlx.DB, column string, limit int) ([]domain.FilterOption, error) {
+	query := fmt.Sprintf(`
+		SELECT %[1]s as value, %[1]s as label, COUNT(*) as count
+		FROM listings
+		WHERE is_active = true AND hidden = false AND %[1]s IS NOT NULL AND %[1]s != ''
+		GROUP BY %[1]s
+		ORDER BY count DESC
+	`, column)
+	if limit > 0 {
+		query += fmt.Sprintf("LIMIT %d", limit)
+	}
+
+	options := []domain.FilterOption{}
+	if err := db.SelectContext(ctx, &options, query); err != nil {
+		return nil, fmt.Errorf("filter options for %s: %w", column, err)
+	}
+	return options, nil
+}
+
+// upsertColumns are the columns written by Upsert/UpsertBatch, in argument order
+const upsertColumns = `id, source_id, external_id, url, title, description,
+	asking_price, revenue, cash_flow, ebitda, inventory_value,
+	real_estate_included, real_estate_value,
+	city, state, zip_code, country, lat, lng,
+	industry, industry_category, business_type, year_established, employees, reason_for_sale,
+	lease_expiration, monthly_rent,
+	is_franchise, franchise_name,
+	raw_data, first_seen_at, last_seen_at, is_active, is_featured, sitemap_lastmod,
+	asking_price_max, revenue_max, cash_flow_max, content_hash, tags, description_truncated,
+	parsed_by_version, financial_score, price_on_request`
+
+// upsertColumnCount is the number of placeholders per row in upsertColumns
+const upsertColumnCount = 44
+
+const upsertConflictClause = `
+	ON CONFLICT (source_id, external_id) DO UPDATE SET
+		url = EXCLUDED.url,
+		title = EXCLUDED.title,
+		description = EXCLUDED.description,
+		description_truncated = EXCLUDED.description_truncated,
+		asking_price = EXCLUDED.asking_price,
+		asking_price_max = EXCLUDED.asking_price_max,
+		price_on_request = EXCLUDED.price_on_request,
+		-- financials may have been filled in by enrichment; a card without them keeps them
+		revenue = COALESCE(EXCLUDED.revenue, listings.revenue),
+		revenue_max = CASE WHEN EXCLUDED.revenue IS NULL THEN listings.revenue_max ELSE EXCLUDED.revenue_max END,
+		cash_flow = COALESCE(EXCLUDED.cash_flow, listings.cash_flow),
+		cash_flow_max = CASE WHEN EXCLUDED.cash_flow IS NULL THEN listings.cash_flow_max ELSE EXCLUDED.cash_flow_max END,
+		ebitda = COALESCE(EXCLUDED.ebitda, listings.ebitda),
+		inventory_value = COALESCE(EXCLUDED.inventory_value, listings.inventory_value),
+		real_estate_included = EXCLUDED.real_estate_included,
+		real_estate_value = EXCLUDED.real_estate_value,
+		city = EXCLUDED.city,
+		state = EXCLUDED.state,
+		zip_code = EXCLUDED.zip_code,
+		-- cards rarely carry coordinates; keep ones filled in by the geocode backfill
+		lat = COALESCE(EXCLUDED.lat, listings.lat),
+		lng = COALESCE(EXCLUDED.lng, listings.lng),
+		industry = EXCLUDED.industry,
+		industry_category = EXCLUDED.industry_category,
+		business_type = EXCLUDED.business_type,
+		year_established = COALESCE(EXCLUDED.year_established, listings.year_established),
+		employees = COALESCE(EXCLUDED.employees, listings.employees),
+		reason_for_sale = EXCLUDED.reason_for_sale,
+		lease_expiration = EXCLUDED.lease_expiration,
+		monthly_rent = EXCLUDED.monthly_rent,
+		is_franchise = EXCLUDED.is_franchise,
+		franchise_name = EXCLUDED.franchise_name,
+		raw_data = EXCLUDED.raw_data,
+		last_seen_at = EXCLUDED.last_seen_at,
+		-- a listing MarkStale deactivated that shows up again is relisted
+		relisted_at = CASE WHEN listings.is_active THEN listings.relisted_at ELSE EXCLUDED.last_seen_at END,
+		relist_count = listings.relist_count + CASE WHEN listings.is_active THEN 0 ELSE 1 END,
+		is_active = true,
+		-- featured placement is bought for a period, so each scrape replaces it
+		is_featured = EXCLUDED.is_featured,
+		-- only sitemap crawls know it; a search crawl keeps the last one seen
+		sitemap_lastmod = COALESCE(EXCLUDED.sitemap_lastmod, listings.sitemap_lastmod),
+		search_vector = to_tsvector('english', COALESCE(EXCLUDED.title, '') || ' ' || COALESCE(EXCLUDED.raw_data->>'full_description', EXCLUDED.description, '') || ' ' || COALESCE(EXCLUDED.industry, '')),
+		content_hash = EXCLUDED.content_hash,
+		tags = EXCLUDED.tags,
+		parsed_by_version = EXCLUDED.parsed_by_version,
+		-- scored from the listing as scraped; one whose financials were kept
+		-- above keeps the score ApplyEnrichment gave them
+		financial_score = CASE WHEN (EXCLUDED.revenue IS NULL AND listings.revenue IS NOT NULL)
+			OR (EXCLUDED.cash_flow IS NULL AND listings.cash_flow IS NOT NULL)
+			OR (EXCLUDED.ebitda IS NULL AND listings.ebitda IS NOT NULL)
+			OR (EXCLUDED.year_established IS NULL AND listings.year_established IS NOT NULL)
+			OR (EXCLUDED.employees IS NULL AND listings.employees IS NOT NULL)
+			THEN listings.financial_score ELSE EXCLUDED.financial_score END,
+		-- relinked by linkFranchises after the upsert if the name still names one
+		franchise_id = CASE WHEN listings.franchise_name IS NOT DISTINCT FROM EXCLUDED.franchise_name
+			AND listings.is_franchise IS NOT DISTINCT FROM EXCLUDED.is_franchise THEN listings.franchise_id END
+	-- an active listing scraped unchanged is left alone; UpsertBatch marks it seen
+	WHERE listings.content_hash IS DISTINCT FROM EXCLUDED.content_hash OR NOT listings.is_active
+	RETURNING source_id, external_id
+`
+
+// upsertArgs are the arguments for upsertColumns, with hash as content_hash
+func upsertArgs(listing *domain.Listing, hash string) []interface{} {
+	return []interface{}{
 		listing.ID, listing.SourceID, listing.ExternalID, listing.URL, listing.Title, listing.Description,
 		listing.AskingPrice, listing.Revenue, listing.CashFlow, listing.EBITDA, listing.Inventory,
 		listing.RealEstateIncluded, listing.RealEstateValue,
@@ -263,8 +695,331 @@ func (r *ListingRepository) Upsert(ctx context.Context, listing *domain.Listing)
 		listing.Industry, listing.IndustryCategory, listing.BusinessType, listing.YearEstablished, listing.Employees, listing.ReasonForSale,
 		listing.LeaseExpiration, listing.MonthlyRent,
 		listing.IsFranchise, listing.FranchiseName,
-		listing.RawData, listing.FirstSeenAt, listing.LastSeenAt, listing.IsActive,
-	)
+		listing.RawData, listing.FirstSeenAt, listing.LastSeenAt, listing.IsActive, listing.IsFeatured,
+		listing.SitemapLastMod,
+		listing.AskingPriceMax, listing.RevenueMax, listing.CashFlowMax, hash,
+		listing.Tags, listing.DescriptionTruncated,
+		listing.ParsedByVersion, listing.FinancialScore, listing.PriceOnRequest,
+	}
+}
+
+// contentHash hashes the fields an upsert writes, except the listing's
+// identity, when it was seen, and its raw data, which can differ between
+// scrapes of the same content. Tags and the financial score are included so
+// listings are retagged and rescored when the dictionary or formula changes,
+// and the scraper version so a new one records itself on listings it parses
+// the same.
+func contentHash(listing *domain.Listing) string {
+	content, _ := json.Marshal([]interface{}{
+		listing.URL, listing.Title, listing.Description,
+		listing.AskingPrice, listing.Revenue, listing.CashFlow, listing.EBITDA, listing.Inventory,
+		listing.RealEstateIncluded, listing.RealEstateValue,
+		listing.City, listing.State, listing.ZipCode, listing.Country, listing.Lat, listing.Lng,
+		listing.Industry, listing.IndustryCategory, listing.BusinessType, listing.YearEstablished, listing.Employees, listing.ReasonForSale,
+		listing.LeaseExpiration, listing.MonthlyRent,
+		listing.IsFranchise, listing.FranchiseName, listing.IsFeatured, listing.SitemapLastMod,
+		listing.AskingPriceMax, listing.RevenueMax, listing.CashFlowMax, listing.Tags,
+		listing.ParsedByVersion, listing.FinancialScore, listing.PriceOnRequest,
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *ListingRepository) Upsert(ctx context.Context, listing *domain.Listing) error {
+	return r.UpsertBatch(ctx, []*domain.Listing{listing})
+}
+
+// UpsertBatch inserts or updates listings in a single multi-row statement.
+// Duplicate (source_id, external_id) pairs are collapsed to the last one seen,
+// since Postgres refuses to update the same row twice in one ON CONFLICT.
+// Active listings whose content hash is unchanged are only marked as seen, so
+// re-scraping a mostly unchanged source rewrites few rows. Each listing is
+// tagged from its title and full description and scored from its figures
+// first, and franchise resales are linked to the franchise of their brand
+// after. Descriptions are stored cut to the SetMaxDescriptionLength cap, but
+// hashed and indexed in full.
+func (r *ListingRepository) UpsertBatch(ctx context.Context, listings []*domain.Listing) error {
+	listings = DedupeListings(listings)
+	if len(listings) == 0 {
+		return nil
+	}
+
+	rows := make([]string, len(listings))
+	args := make([]interface{}, 0, len(listings)*upsertColumnCount)
+	for i, listing := range listings {
+		listing.Tags = taxonomy.ListingTags(listing.Title, listing.Description)
+		listing.FinancialScore = scoring.FinancialScore(listing)
+		base := i * upsertColumnCount
+		placeholders := make([]string, upsertColumnCount)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", base+j+1)
+		}
+		// search_vector from title ($5), the full description kept in raw_data
+		// ($30) or the description ($6), and industry ($20)
+		rows[i] = fmt.Sprintf("(%s, to_tsvector('english', COALESCE($%d, '') || ' ' || COALESCE($%d::jsonb->>'%s', $%d, '') || ' ' || COALESCE($%d, '')))",
+			strings.Join(placeholders, ", "), base+5, base+30, fullDescriptionKey, base+6, base+20)
+		args = append(args, upsertArgs(limitDescription(listing, r.maxDescription), contentHash(listing))...)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO listings (%s, search_vector) VALUES %s %s`,
+		upsertColumns, strings.Join(rows, ",\n"), upsertConflictClause)
+
+	var written []upsertedKey
+	if err := r.db.SelectContext(ctx, &written, query, args...); err != nil {
+		return err
+	}
+	if len(written) < len(listings) {
+		if err := r.touchUnchanged(ctx, listings, written); err != nil {
+			return err
+		}
+	}
+	return r.linkFranchises(ctx, listings)
+}
+
+// upsertedKey identifies a listing the upsert wrote
+type upsertedKey struct {
+	SourceID   uuid.UUID `db:"source_id"`
+	ExternalID string    `db:"external_id"`
+}
+
+// touchUnchanged marks the listings the upsert left alone, those not in
+// written, as seen
+func (r *ListingRepository) touchUnchanged(ctx context.Context, listings []*domain.Listing, written []upsertedKey) error {
+	wrote := make(map[upsertedKey]bool, len(written))
+	for _, w := range written {
+		wrote[w] = true
+	}
+	var sourceIDs, externalIDs, seenAt []string
+	for _, l := range listings {
+		if !wrote[upsertedKey{l.SourceID, l.ExternalID}] {
+			sourceIDs = append(sourceIDs, l.SourceID.String())
+			externalIDs = append(externalIDs, l.ExternalID)
+			seenAt = append(seenAt, l.LastSeenAt.Format(time.RFC3339Nano))
+		}
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE listings l SET last_seen_at = u.last_seen_at
+		FROM unnest($1::uuid[], $2::text[], $3::timestamptz[]) AS u(source_id, external_id, last_seen_at)
+		WHERE l.source_id = u.source_id AND l.external_id = u.external_id
+	`, pq.Array(sourceIDs), pq.Array(externalIDs), pq.Array(seenAt))
+	return err
+}
+
+// DedupeListings collapses listings sharing a (source_id, external_id) pair,
+// keeping the last-seen version in the position of the first occurrence.
+func DedupeListings(listings []*domain.Listing) []*domain.Listing {
+	type key struct {
+		sourceID   uuid.UUID
+		externalID string
+	}
+
+	index := make(map[key]int, len(listings))
+	result := make([]*domain.Listing, 0, len(listings))
+	for _, l := range listings {
+		if l == nil {
+			continue
+		}
+		k := key{l.SourceID, l.ExternalID}
+		if i, ok := index[k]; ok {
+			result[i] = l
+			continue
+		}
+		index[k] = len(result)
+		result = append(result, l)
+	}
+	return result
+}
+
+// SetHidden hides or un-hides a listing. The flag is never touched by Upsert,
+// so it persists across re-scrapes.
+func (r *ListingRepository) SetHidden(ctx context.Context, id uuid.UUID, hidden bool) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE listings SET hidden = $2 WHERE id = $1`, id, hidden)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListNeedingEnrichment returns active listings missing cash flow, revenue or
+// broker details that have never been enriched, most recently seen first
+func (r *ListingRepository) ListNeedingEnrichment(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.SelectContext(ctx, &ids, `
+		SELECT id FROM listings
+		WHERE is_active = true AND hidden = false AND enriched_at IS NULL
+			AND (cash_flow IS NULL OR revenue IS NULL OR broker_name IS NULL)
+		ORDER BY last_seen_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ListOutdated returns the active listings of a source parsed by a scraper
+// version older than version, most recently seen first
+func (r *ListingRepository) ListOutdated(ctx context.Context, sourceID uuid.UUID, version, limit int) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.SelectContext(ctx, &ids, `
+		SELECT id FROM listings
+		WHERE source_id = $1 AND parsed_by_version < $2 AND is_active = true AND hidden = false
+		ORDER BY last_seen_at DESC
+		LIMIT $3
+	`, sourceID, version, limit)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ApplyEnrichment fills in financial and broker fields that are still empty
+// from a detail-page fetch; a listing given an asking price is no longer
+// price on request. A detail with a ParsedByVersion newer than the listing's
+// was parsed by a newer scraper, so its values overwrite the listing's
+// instead, wherever it found one, and the version is recorded on the
+// listing. Otherwise existing values are never overwritten. The listing is
+// rescored from its figures as written.
+// Returns sql.ErrNoRows if the listing no longer exists.
+func (r *ListingRepository) ApplyEnrichment(ctx context.Context, id uuid.UUID, detail *domain.Listing) error {
+	var figures domain.Listing
+	// $11 > parsed_by_version compares with the row before the update
+	err := r.db.GetContext(ctx, &figures, `
+		UPDATE listings SET
+			asking_price = CASE WHEN $11 > parsed_by_version THEN COALESCE($2, asking_price) ELSE COALESCE(asking_price, $2) END,
+			price_on_request = price_on_request AND COALESCE(asking_price, $2) IS NULL,
+			revenue = CASE WHEN $11 > parsed_by_version THEN COALESCE($3, revenue) ELSE COALESCE(revenue, $3) END,
+			cash_flow = CASE WHEN $11 > parsed_by_version THEN COALESCE($4, cash_flow) ELSE COALESCE(cash_flow, $4) END,
+			ebitda = CASE WHEN $11 > parsed_by_version THEN COALESCE($5, ebitda) ELSE COALESCE(ebitda, $5) END,
+			year_established = CASE WHEN $11 > parsed_by_version THEN COALESCE($6, year_established) ELSE COALESCE(year_established, $6) END,
+			employees = CASE WHEN $11 > parsed_by_version THEN COALESCE($7, employees) ELSE COALESCE(employees, $7) END,
+			broker_name = CASE WHEN $11 > parsed_by_version THEN COALESCE($8, broker_name) ELSE COALESCE(broker_name, $8) END,
+			broker_phone = CASE WHEN $11 > parsed_by_version THEN COALESCE($9, broker_phone) ELSE COALESCE(broker_phone, $9) END,
+			inventory_value = CASE WHEN $11 > parsed_by_version THEN COALESCE($10, inventory_value) ELSE COALESCE(inventory_value, $10) END,
+			parsed_by_version = GREATEST(parsed_by_version, $11),
+			enriched_at = NOW()
+		WHERE id = $1
+		RETURNING asking_price, revenue, cash_flow, ebitda, year_established, employees
+	`, id, detail.AskingPrice, detail.Revenue, detail.CashFlow, detail.EBITDA,
+		detail.YearEstablished, detail.Employees, detail.BrokerName, detail.BrokerPhone, detail.Inventory,
+		detail.ParsedByVersion)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `UPDATE listings SET financial_score = $2 WHERE id = $1`,
+		id, scoring.FinancialScore(&figures))
+	return err
+}
+
+// geocodeCandidateWhere selects active listings with a state but no coordinates,
+// skipping ones that failed to geocode within the last 30 days
+const geocodeCandidateWhere = `
+	WHERE is_active = true AND hidden = false
+		AND (lat IS NULL OR lng IS NULL) AND state IS NOT NULL
+		AND (geocode_failed_at IS NULL OR geocode_failed_at < NOW() - INTERVAL '30 days')`
+
+// ListNeedingGeocode returns listings awaiting coordinates, most recently seen first
+func (r *ListingRepository) ListNeedingGeocode(ctx context.Context, limit int) ([]domain.GeocodeCandidate, error) {
+	var candidates []domain.GeocodeCandidate
+	err := r.db.SelectContext(ctx, &candidates,
+		`SELECT id, city, state, country FROM listings`+geocodeCandidateWhere+` ORDER BY last_seen_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// CountNeedingGeocode returns the number of listings awaiting coordinates
+func (r *ListingRepository) CountNeedingGeocode(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM listings`+geocodeCandidateWhere)
+	return count, err
+}
+
+// CountBySource counts each source's active and inactive listings in one
+// grouped query. Sources without listings are left out.
+func (r *ListingRepository) CountBySource(ctx context.Context) ([]domain.SourceListingCount, error) {
+	var counts []domain.SourceListingCount
+	err := r.db.SelectContext(ctx, &counts, `
+		SELECT s.slug AS source, l.is_active IS TRUE AS active, COUNT(*) AS count
+		FROM listings l
+		JOIN sources s ON s.id = l.source_id
+		GROUP BY s.slug, active
+		ORDER BY s.slug, active
+	`)
+	return counts, err
+}
+
+// SetCoordinates writes geocoded coordinates and clears any failure marker
+func (r *ListingRepository) SetCoordinates(ctx context.Context, id uuid.UUID, lat, lng float64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE listings SET lat = $2, lng = $3, geocode_failed_at = NULL WHERE id = $1
+	`, id, lat, lng)
+	return err
+}
+
+// MarkGeocodeFailed records that no geocoder could resolve the listing's location
+func (r *ListingRepository) MarkGeocodeFailed(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE listings SET geocode_failed_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+// ListingFreshness returns when each of a source's active listings was last
+// seen and its sitemap lastmod, keyed by external ID
+func (r *ListingRepository) ListingFreshness(ctx context.Context, sourceID uuid.UUID) (map[string]domain.ListingFreshness, error) {
+	var rows []struct {
+		ExternalID string `db:"external_id"`
+		domain.ListingFreshness
+	}
+	err := r.db.SelectContext(ctx, &rows, `
+		SELECT external_id, last_seen_at, sitemap_lastmod FROM listings
+		WHERE source_id = $1 AND is_active = true
+	`, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	freshness := make(map[string]domain.ListingFreshness, len(rows))
+	for _, row := range rows {
+		freshness[row.ExternalID] = row.ListingFreshness
+	}
+	return freshness, nil
+}
+
+// ExistingExternalIDs returns which of externalIDs a source already has a listing for
+func (r *ListingRepository) ExistingExternalIDs(ctx context.Context, sourceID uuid.UUID, externalIDs []string) (map[string]bool, error) {
+	var found []string
+	err := r.db.SelectContext(ctx, &found, `
+		SELECT external_id FROM listings WHERE source_id = $1 AND external_id = ANY($2)
+	`, sourceID, pq.Array(externalIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(found))
+	for _, id := range found {
+		existing[id] = true
+	}
+	return existing, nil
+}
+
+// TouchListings marks listings as seen without rewriting them, for listings an
+// incremental scrape found unchanged
+func (r *ListingRepository) TouchListings(ctx context.Context, sourceID uuid.UUID, externalIDs []string, seenAt time.Time) error {
+	if len(externalIDs) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE listings SET last_seen_at = $3
+		WHERE source_id = $1 AND external_id = ANY($2)
+	`, sourceID, pq.Array(externalIDs), seenAt)
 	return err
 }
 
@@ -278,3 +1033,189 @@ func (r *ListingRepository) MarkStale(ctx context.Context, sourceID uuid.UUID, b
 	}
 	return result.RowsAffected()
 }
+
+// ReplaceLocations replaces a listing's locations. An empty slice removes them,
+// leaving it a single-location listing.
+func (r *ListingRepository) ReplaceLocations(ctx context.Context, listingID uuid.UUID, locations []domain.ListingLocation) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM listing_locations WHERE listing_id = $1`, listingID); err != nil {
+		return err
+	}
+
+	for _, loc := range locations {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO listing_locations (listing_id, city, state, zip_code, lat, lng, is_primary)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, listingID, loc.City, loc.State, loc.ZipCode, loc.Lat, loc.Lng, loc.IsPrimary)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+const locationColumns = `id, listing_id, city, state, zip_code, lat, lng, is_primary`
+
+// GetLocations returns a listing's locations, primary first
+func (r *ListingRepository) GetLocations(ctx context.Context, listingID uuid.UUID) ([]domain.ListingLocation, error) {
+	locations := []domain.ListingLocation{}
+	err := r.db.SelectContext(ctx, &locations, `
+		SELECT `+locationColumns+` FROM listing_locations
+		WHERE listing_id = $1
+		ORDER BY is_primary DESC, state, city
+	`, listingID)
+	if err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// GetLocationsForListings returns the locations of any multi-location listings
+// among ids, keyed by listing ID
+func (r *ListingRepository) GetLocationsForListings(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID][]domain.ListingLocation, error) {
+	byListing := make(map[uuid.UUID][]domain.ListingLocation)
+	if len(ids) == 0 {
+		return byListing, nil
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT `+locationColumns+` FROM listing_locations
+		WHERE listing_id IN (?)
+		ORDER BY listing_id, is_primary DESC, state, city
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []domain.ListingLocation
+	if err := r.db.SelectContext(ctx, &locations, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, loc := range locations {
+		byListing[loc.ListingID] = append(byListing[loc.ListingID], loc)
+	}
+	return byListing, nil
+}
+
+// ReplaceDocuments sets a listing's documents to the ones on its detail page
+func (r *ListingRepository) ReplaceDocuments(ctx context.Context, listingID uuid.UUID, documents []domain.ListingDocument) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM listing_documents WHERE listing_id = $1`, listingID); err != nil {
+		return err
+	}
+
+	for _, doc := range documents {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO listing_documents (listing_id, type, url, title)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (listing_id, url) DO NOTHING
+		`, listingID, doc.Type, doc.URL, doc.Title)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetDocuments returns a listing's documents, CIMs first, then financials, then others
+func (r *ListingRepository) GetDocuments(ctx context.Context, listingID uuid.UUID) ([]domain.ListingDocument, error) {
+	documents := []domain.ListingDocument{}
+	err := r.db.SelectContext(ctx, &documents, `
+		SELECT id, listing_id, type, url, title FROM listing_documents
+		WHERE listing_id = $1
+		ORDER BY type, url
+	`, listingID)
+	if err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// locationGeocodeWhere selects locations of active listings that have a state
+// but no coordinates, with the same 30 day retry as listings
+const locationGeocodeWhere = `
+	FROM listing_locations ll
+	JOIN listings l ON l.id = ll.listing_id
+	WHERE l.is_active = true AND l.hidden = false
+		AND ll.lat IS NULL AND ll.state IS NOT NULL
+		AND (ll.geocode_failed_at IS NULL OR ll.geocode_failed_at < NOW() - INTERVAL '30 days')`
+
+// GetPriceHistory returns a listing's asking prices, oldest first
+func (r *ListingRepository) GetPriceHistory(ctx context.Context, listingID uuid.UUID) ([]domain.PriceChange, error) {
+	history := []domain.PriceChange{}
+	err := r.db.SelectContext(ctx, &history, `
+		SELECT asking_price, asking_price_max, recorded_at
+		FROM listing_price_history
+		WHERE listing_id = $1
+		ORDER BY recorded_at, id
+	`, listingID)
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// GetChanges returns the changes to a listing's tracked fields, oldest
+// first, each classified with SetEvent. Fields changed by the same update
+// share a timestamp.
+func (r *ListingRepository) GetChanges(ctx context.Context, listingID uuid.UUID) ([]domain.ListingChange, error) {
+	changes := []domain.ListingChange{}
+	err := r.db.SelectContext(ctx, &changes, `
+		SELECT field, old_value, new_value, changed_at
+		FROM listing_changes
+		WHERE listing_id = $1
+		ORDER BY changed_at, id
+	`, listingID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range changes {
+		changes[i].SetEvent()
+	}
+	return changes, nil
+}
+
+// ListLocationsNeedingGeocode returns listing locations awaiting coordinates.
+// Candidate IDs are location IDs.
+func (r *ListingRepository) ListLocationsNeedingGeocode(ctx context.Context, limit int) ([]domain.GeocodeCandidate, error) {
+	var candidates []domain.GeocodeCandidate
+	err := r.db.SelectContext(ctx, &candidates,
+		`SELECT ll.id, ll.city, ll.state, l.country`+locationGeocodeWhere+` ORDER BY l.last_seen_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// CountLocationsNeedingGeocode returns the number of listing locations awaiting coordinates
+func (r *ListingRepository) CountLocationsNeedingGeocode(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, `SELECT COUNT(*)`+locationGeocodeWhere)
+	return count, err
+}
+
+// SetLocationCoordinates writes geocoded coordinates for a listing location
+func (r *ListingRepository) SetLocationCoordinates(ctx context.Context, id uuid.UUID, lat, lng float64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE listing_locations SET lat = $2, lng = $3, geocode_failed_at = NULL WHERE id = $1
+	`, id, lat, lng)
+	return err
+}
+
+// MarkLocationGeocodeFailed records that no geocoder could resolve a listing location
+func (r *ListingRepository) MarkLocationGeocodeFailed(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE listing_locations SET geocode_failed_at = NOW() WHERE id = $1`, id)
+	return err
+}
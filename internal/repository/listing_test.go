@@ -0,0 +1,1231 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestDedupeListings(t *testing.T) {
+	sourceA, sourceB := uuid.New(), uuid.New()
+	first := &domain.Listing{SourceID: sourceA, ExternalID: "1", Title: "first"}
+	other := &domain.Listing{SourceID: sourceA, ExternalID: "2", Title: "other"}
+	last := &domain.Listing{SourceID: sourceA, ExternalID: "1", Title: "last"}
+	otherSource := &domain.Listing{SourceID: sourceB, ExternalID: "1", Title: "other source"}
+
+	got := DedupeListings([]*domain.Listing{first, other, last, otherSource})
+
+	if len(got) != 3 {
+		t.Fatalf("len = %d, want 3", len(got))
+	}
+	if got[0] != last {
+		t.Errorf("got[0] = %q, want last-seen duplicate", got[0].Title)
+	}
+	if got[1] != other || got[2] != otherSource {
+		t.Errorf("unexpected order: %q, %q", got[1].Title, got[2].Title)
+	}
+}
+
+func TestUpsertBatchDuplicates(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	first := newTestListing(source, "dup-1")
+	second := newTestListing(source, "dup-1")
+	second.Title = "Updated title"
+
+	if err := repo.UpsertBatch(ctx, []*domain.Listing{first, second}); err != nil {
+		t.Fatalf("UpsertBatch returned error: %v", err)
+	}
+
+	var count int
+	if err := db.GetContext(ctx, &count, "SELECT COUNT(*) FROM listings WHERE source_id = $1", source.ID); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("rows = %d, want 1", count)
+	}
+
+	var title string
+	if err := db.GetContext(ctx, &title, "SELECT title FROM listings WHERE source_id = $1 AND external_id = 'dup-1'", source.ID); err != nil {
+		t.Fatal(err)
+	}
+	if title != "Updated title" {
+		t.Errorf("title = %q, want last-seen version", title)
+	}
+}
+
+func TestSetHiddenPersistsAcrossUpsert(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	listing := newTestListing(source, "hidden-1")
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := repo.SetHidden(ctx, listing.ID, true); err != nil {
+		t.Fatalf("SetHidden: %v", err)
+	}
+
+	// Re-scrape of the same listing
+	rescraped := newTestListing(source, "hidden-1")
+	rescraped.Title = "Rescraped"
+	if err := repo.Upsert(ctx, rescraped); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	var hidden bool
+	if err := db.GetContext(ctx, &hidden, "SELECT hidden FROM listings WHERE id = $1", listing.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !hidden {
+		t.Error("hidden was reset by upsert")
+	}
+
+	if _, err := repo.GetByID(ctx, listing.ID); err == nil {
+		t.Error("GetByID returned a hidden listing")
+	}
+
+	result, err := repo.Search(ctx, domain.ListingSearchParams{Query: "Rescraped", Page: 1, PerPage: 100})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	for _, l := range result.Listings {
+		if l.ID == listing.ID {
+			t.Error("Search returned a hidden listing")
+		}
+	}
+
+	if err := repo.SetHidden(ctx, listing.ID, false); err != nil {
+		t.Fatalf("SetHidden(false): %v", err)
+	}
+	if _, err := repo.GetByID(ctx, listing.ID); err != nil {
+		t.Errorf("GetByID after unhide: %v", err)
+	}
+}
+
+func TestSetHiddenUnknownID(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewListingRepository(db)
+
+	if err := repo.SetHidden(context.Background(), uuid.New(), true); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestIncludeSource(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	listing := newTestListing(source, "include-1")
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	without, err := repo.GetByID(ctx, listing.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if without.Source != nil {
+		t.Error("source embedded without include")
+	}
+
+	with, err := repo.GetByIDWithOptions(ctx, listing.ID, true)
+	if err != nil {
+		t.Fatalf("GetByIDWithOptions: %v", err)
+	}
+	if with.Source == nil || with.Source.ID != source.ID || with.Source.Slug != source.Slug || with.Source.BaseURL != source.BaseURL {
+		t.Errorf("unexpected embedded source: %+v", with.Source)
+	}
+
+	for _, include := range []bool{false, true} {
+		result, err := repo.Search(ctx, domain.ListingSearchParams{
+			Query: listing.Title, IncludeSource: include, Page: 1, PerPage: 100,
+		})
+		if err != nil {
+			t.Fatalf("Search(include=%v): %v", include, err)
+		}
+		for _, l := range result.Listings {
+			if l.ID != listing.ID {
+				continue
+			}
+			if include && (l.Source == nil || l.Source.Name != source.Name) {
+				t.Errorf("Search with include: source = %+v", l.Source)
+			}
+			if !include && l.Source != nil {
+				t.Error("Search without include embedded source")
+			}
+		}
+	}
+}
+
+func TestApplyEnrichmentFillsOnlyMissingFields(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	listing := newTestListing(source, "enrich-1")
+	listing.AskingPrice = domain.Ptr(int64(50000000))
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+
+	detail := &domain.Listing{
+		AskingPrice: domain.Ptr(int64(1)),
+		CashFlow:    domain.Ptr(int64(12000000)),
+		BrokerName:  domain.StrPtr("Jane Broker"),
+	}
+	if err := repo.ApplyEnrichment(ctx, listing.ID, detail); err != nil {
+		t.Fatalf("ApplyEnrichment returned error: %v", err)
+	}
+
+	// A later card scrape without financials must not wipe the enriched values
+	if err := repo.Upsert(ctx, newTestListing(source, "enrich-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetByID(ctx, listing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AskingPrice == nil || *got.AskingPrice != 50000000 {
+		t.Errorf("asking_price = %v, want existing value kept", got.AskingPrice)
+	}
+	if got.CashFlow == nil || *got.CashFlow != 12000000 {
+		t.Errorf("cash_flow = %v, want enriched value", got.CashFlow)
+	}
+	if got.BrokerName == nil || *got.BrokerName != "Jane Broker" {
+		t.Errorf("broker_name = %v, want enriched value", got.BrokerName)
+	}
+	if got.EnrichedAt == nil {
+		t.Error("enriched_at not set")
+	}
+	// Scored once enrichment filled in the cash flow, and kept by the card scrape
+	if got.FinancialScore == nil {
+		t.Error("financial_score not set from the enriched figures")
+	}
+
+	if err := repo.ApplyEnrichment(ctx, uuid.New(), detail); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown id: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	// Unique industry names keep counts independent of other data in the database
+	food, retail := "Food "+source.Slug, "Retail "+source.Slug
+	seed := []struct {
+		id, state, industry string
+	}{
+		{"f-1", "TX", food},
+		{"f-2", "TX", food},
+		{"f-3", "CA", food},
+		{"f-4", "CA", retail},
+	}
+	for _, s := range seed {
+		l := newTestListing(source, s.id)
+		l.State = domain.StrPtr(s.state)
+		l.Industry = domain.StrPtr(s.industry)
+		if err := repo.Upsert(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := repo.Search(ctx, domain.ListingSearchParams{
+		Industries: []string{food},
+		States:     []string{"TX"},
+		Facets:     []string{"state", "industry", "unknown"},
+		Page:       1,
+		PerPage:    10,
+	})
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if result.Total != 2 {
+		t.Errorf("Total = %d, want 2", result.Total)
+	}
+	if _, ok := result.Facets["unknown"]; ok {
+		t.Error("unknown facet should be ignored")
+	}
+
+	counts := func(options []domain.FilterOption) map[string]int {
+		m := make(map[string]int)
+		for _, o := range options {
+			m[o.Value] = o.Count
+		}
+		return m
+	}
+
+	// State facet drops the state filter but keeps the industry filter
+	states := counts(result.Facets["state"])
+	if states["TX"] != 2 || states["CA"] != 1 {
+		t.Errorf("state facet = %v, want TX=2 and CA=1 within the industry filter", states)
+	}
+
+	// Industry facet drops the industry filter but keeps the state filter
+	industries := counts(result.Facets["industry"])
+	if industries[food] != 2 {
+		t.Errorf("industry facet[%s] = %d, want 2", food, industries[food])
+	}
+	if _, ok := industries[retail]; ok {
+		t.Errorf("industry facet includes %s, which only exists outside the state filter", retail)
+	}
+}
+
+func TestUpsertTagsListings(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	homeBased := newTestListing(source, "tags-1")
+	homeBased.Title = "Home-Based Bookkeeping " + source.Slug
+	homeBased.Description = domain.StrPtr("Seller financing available")
+	turnkey := newTestListing(source, "tags-2")
+	turnkey.Title = "Turnkey Bakery " + source.Slug
+	if err := repo.UpsertBatch(ctx, []*domain.Listing{homeBased, turnkey}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetByID(ctx, homeBased.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"home-based", "seller-financing"}; !reflect.DeepEqual([]string(got.Tags), want) {
+		t.Errorf("tags = %v, want %v", got.Tags, want)
+	}
+
+	search := func(tags []string, all bool) int {
+		t.Helper()
+		result, err := repo.Search(ctx, domain.ListingSearchParams{SourceID: &source.ID, Tags: tags, TagsMatchAll: all})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Total
+	}
+	if n := search([]string{"home-based", "turnkey"}, false); n != 2 {
+		t.Errorf("any of home-based, turnkey: %d listings, want 2", n)
+	}
+	if n := search([]string{"home-based", "turnkey"}, true); n != 0 {
+		t.Errorf("all of home-based, turnkey: %d listings, want 0", n)
+	}
+	if n := search([]string{"home-based", "seller-financing"}, true); n != 1 {
+		t.Errorf("all of home-based, seller-financing: %d listings, want 1", n)
+	}
+}
+
+func TestSearchPagingWithTiedSortValues(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	// Every listing shares last_seen_at, first_seen_at and asking_price, so only
+	// the id tiebreaker orders them
+	industry := "Paging " + source.Slug
+	seenAt := time.Now().Truncate(time.Second)
+	const n = 23
+	batch := make([]*domain.Listing, n)
+	for i := range batch {
+		l := newTestListing(source, fmt.Sprintf("page-%d", i))
+		l.Industry = domain.StrPtr(industry)
+		l.AskingPrice = domain.Ptr(int64(10000000))
+		l.FirstSeenAt, l.LastSeenAt = seenAt, seenAt
+		batch[i] = l
+	}
+	if err := repo.UpsertBatch(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sort := range []string{"", "price_asc", "price_desc", "newest", "score_desc", SortRandom} {
+		t.Run("sort="+sort, func(t *testing.T) {
+			seen := make(map[uuid.UUID]int)
+			for page := 1; ; page++ {
+				result, err := repo.Search(ctx, domain.ListingSearchParams{
+					Industries: []string{industry},
+					Sort:       sort,
+					Page:       page,
+					PerPage:    5,
+				})
+				if err != nil {
+					t.Fatalf("page %d: %v", page, err)
+				}
+				for _, l := range result.Listings {
+					seen[l.ID]++
+				}
+				if page >= result.TotalPages {
+					break
+				}
+			}
+
+			if len(seen) != n {
+				t.Errorf("saw %d distinct listings across pages, want %d", len(seen), n)
+			}
+			for id, count := range seen {
+				if count != 1 {
+					t.Errorf("listing %s appeared on %d pages", id, count)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchRandomSeed(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	industry := "Random " + source.Slug
+	batch := make([]*domain.Listing, 20)
+	for i := range batch {
+		batch[i] = newTestListing(source, fmt.Sprintf("random-%d", i))
+		batch[i].Industry = domain.StrPtr(industry)
+	}
+	if err := repo.UpsertBatch(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	order := func(seed string) []uuid.UUID {
+		t.Helper()
+		result, err := repo.Search(ctx, domain.ListingSearchParams{
+			Industries: []string{industry}, Sort: SortRandom, Seed: seed, Page: 1, PerPage: 20,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]uuid.UUID, len(result.Listings))
+		for i, l := range result.Listings {
+			ids[i] = l.ID
+		}
+		return ids
+	}
+
+	first := order("seed-a")
+	if again := order("seed-a"); !reflect.DeepEqual(again, first) {
+		t.Error("the same seed returned a different order")
+	}
+	// 20! orders make a collision all but impossible
+	if other := order("seed-b"); reflect.DeepEqual(other, first) {
+		t.Error("a different seed returned the same order")
+	}
+}
+
+func TestReplaceLocations(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	multi := newTestListing(source, "locations-multi")
+	single := newTestListing(source, "locations-single")
+	if err := repo.UpsertBatch(ctx, []*domain.Listing{multi, single}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := repo.ReplaceLocations(ctx, multi.ID, []domain.ListingLocation{
+		{City: domain.StrPtr("Dallas"), State: domain.StrPtr("TX")},
+		{City: domain.StrPtr("Austin"), State: domain.StrPtr("TX"), Lat: domain.Ptr(30.27), Lng: domain.Ptr(-97.74), IsPrimary: true},
+	})
+	if err != nil {
+		t.Fatalf("ReplaceLocations returned error: %v", err)
+	}
+
+	got, err := repo.GetLocations(ctx, multi.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[0].IsPrimary || *got[0].City != "Austin" {
+		t.Fatalf("locations = %+v, want primary Austin first then Dallas", got)
+	}
+
+	byListing, err := repo.GetLocationsForListings(ctx, []uuid.UUID{multi.ID, single.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byListing[multi.ID]) != 2 {
+		t.Errorf("multi-location listing has %d locations, want 2", len(byListing[multi.ID]))
+	}
+	if _, ok := byListing[single.ID]; ok {
+		t.Error("single-location listing should have no location rows")
+	}
+
+	// Replacing with nothing reverts to a single-location listing
+	if err := repo.ReplaceLocations(ctx, multi.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.GetLocations(ctx, multi.ID); err != nil || len(got) != 0 {
+		t.Errorf("locations after clearing = %v, %v; want none", got, err)
+	}
+}
+
+func TestSearchBusinessTypeAndCategory(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	// Unique values keep counts independent of other data in the database
+	asset, stock := "Asset "+source.Slug, "Stock "+source.Slug
+	food := "Food " + source.Slug
+	seed := []struct {
+		id                     string
+		businessType, category *string
+	}{
+		{"bt-1", &asset, &food},
+		{"bt-2", &asset, nil},
+		{"bt-3", &stock, &food},
+		{"bt-4", domain.StrPtr(""), domain.StrPtr("")},
+	}
+	for _, s := range seed {
+		l := newTestListing(source, s.id)
+		l.BusinessType = s.businessType
+		l.IndustryCategory = s.category
+		if err := repo.Upsert(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := repo.Search(ctx, domain.ListingSearchParams{
+		BusinessTypes: []string{asset},
+		Categories:    []string{food},
+		Facets:        []string{"business_type", "category"},
+		Page:          1,
+		PerPage:       10,
+	})
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if result.Total != 1 {
+		t.Errorf("Total = %d, want 1", result.Total)
+	}
+
+	counts := func(options []domain.FilterOption) map[string]int {
+		m := make(map[string]int)
+		for _, o := range options {
+			m[o.Value] = o.Count
+		}
+		return m
+	}
+
+	// Each facet drops its own filter but keeps the other
+	if types := counts(result.Facets["business_type"]); types[asset] != 1 || types[stock] != 1 {
+		t.Errorf("business_type facet = %v, want %s=1 and %s=1", types, asset, stock)
+	}
+	if categories := counts(result.Facets["category"]); categories[food] != 1 {
+		t.Errorf("category facet = %v, want %s=1", categories, food)
+	}
+
+	options, err := repo.GetFilterOptions(ctx)
+	if err != nil {
+		t.Fatalf("GetFilterOptions returned error: %v", err)
+	}
+	types, categories := counts(options.BusinessTypes), counts(options.Categories)
+	if types[asset] != 2 || types[stock] != 1 {
+		t.Errorf("business types = %v, want %s=2 and %s=1", types, asset, stock)
+	}
+	if categories[food] != 2 {
+		t.Errorf("categories = %v, want %s=2", categories, food)
+	}
+	if _, ok := types[""]; ok {
+		t.Error("empty business type should be excluded")
+	}
+	if _, ok := categories[""]; ok {
+		t.Error("empty category should be excluded")
+	}
+}
+
+func TestSearchFeaturedBoost(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	industry := "Featured " + source.Slug
+	now := time.Now().Truncate(time.Second)
+	rows := []struct {
+		externalID string
+		featured   bool
+		seenAgo    time.Duration
+		price      int64
+	}{
+		{"plain-new", false, 0, 100},
+		{"featured-old", true, 3 * time.Hour, 400},
+		{"plain-old", false, 2 * time.Hour, 200},
+		{"featured-new", true, time.Hour, 300},
+	}
+	batch := make([]*domain.Listing, len(rows))
+	for i, row := range rows {
+		l := newTestListing(source, row.externalID)
+		l.Industry = domain.StrPtr(industry)
+		l.IsFeatured = row.featured
+		l.AskingPrice = domain.Ptr(row.price)
+		l.LastSeenAt = now.Add(-row.seenAgo)
+		batch[i] = l
+	}
+	if err := repo.UpsertBatch(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		sort     string
+		featured *bool
+		want     []string
+	}{
+		{"default sort boosts featured", "", nil, []string{"featured-new", "featured-old", "plain-new", "plain-old"}},
+		{"explicit sort ignores featured", "price_asc", nil, []string{"plain-new", "plain-old", "featured-new", "featured-old"}},
+		{"featured only", "", domain.BoolPtr(true), []string{"featured-new", "featured-old"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := repo.Search(ctx, domain.ListingSearchParams{
+				Industries:   []string{industry},
+				FeaturedOnly: tt.featured,
+				Sort:         tt.sort,
+				Page:         1,
+				PerPage:      10,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, l := range result.Listings {
+				got = append(got, l.ExternalID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpsertRefreshesFeatured(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	l := newTestListing(source, "featured-refresh")
+	l.IsFeatured = true
+	if err := repo.Upsert(ctx, l); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next scrape finds the placement has lapsed
+	again := newTestListing(source, "featured-refresh")
+	if err := repo.Upsert(ctx, again); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetByID(ctx, l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IsFeatured {
+		t.Error("IsFeatured still set after a scrape without the featured marker")
+	}
+}
+
+func TestGetByIDs(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	active := newTestListing(source, "batch-active")
+	hidden := newTestListing(source, "batch-hidden")
+	inactive := newTestListing(source, "batch-inactive")
+	inactive.IsActive = false
+	if err := repo.UpsertBatch(ctx, []*domain.Listing{active, hidden, inactive}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetHidden(ctx, hidden.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetByIDs(ctx, []uuid.UUID{hidden.ID, active.ID, inactive.ID, uuid.New()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != active.ID {
+		t.Errorf("got %d listings, want only the active one", len(got))
+	}
+
+	none, err := repo.GetByIDs(ctx, nil)
+	if err != nil || none == nil || len(none) != 0 {
+		t.Errorf("GetByIDs(nil) = %v, %v; want an empty slice", none, err)
+	}
+}
+
+func TestCountBySource(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	inactive := newTestListing(source, "count-inactive")
+	inactive.IsActive = false
+	listings := []*domain.Listing{newTestListing(source, "count-a"), newTestListing(source, "count-b"), inactive}
+	if err := repo.UpsertBatch(ctx, listings); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := repo.CountBySource(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[bool]int{}
+	for _, c := range counts {
+		if c.Source == source.Slug {
+			got[c.Active] = c.Count
+		}
+	}
+	if got[true] != 2 || got[false] != 1 {
+		t.Errorf("counts for the test source = %v, want 2 active and 1 inactive", got)
+	}
+}
+
+func TestListNeedingGeocode(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	missing := newTestListing(source, "geo-missing")
+	located := newTestListing(source, "geo-located")
+	noState := newTestListing(source, "geo-no-state")
+	missing.State, located.State = domain.StrPtr("TX"), domain.StrPtr("TX")
+	if err := repo.UpsertBatch(ctx, []*domain.Listing{missing, located, noState}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetCoordinates(ctx, located.ID, 30.27, -97.74); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates, err := repo.ListNeedingGeocode(ctx, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[uuid.UUID]bool{}
+	for _, c := range candidates {
+		found[c.ID] = true
+	}
+	// Only the listing without coordinates; one without a state can't be geocoded
+	if !found[missing.ID] || found[located.ID] || found[noState.ID] {
+		t.Errorf("candidates include missing %v, located %v, no state %v; want only missing",
+			found[missing.ID], found[located.ID], found[noState.ID])
+	}
+}
+
+func TestListingFreshnessAndTouch(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	lastMod := time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC)
+	l := newTestListing(source, "sitemap-fresh")
+	l.SitemapLastMod = &lastMod
+	if err := repo.Upsert(ctx, l); err != nil {
+		t.Fatal(err)
+	}
+
+	// A search crawl without a lastmod keeps the stored one
+	if err := repo.Upsert(ctx, newTestListing(source, "sitemap-fresh")); err != nil {
+		t.Fatal(err)
+	}
+
+	freshness, err := repo.ListingFreshness(ctx, source.ID)
+	if err != nil {
+		t.Fatalf("ListingFreshness failed: %v", err)
+	}
+	got, ok := freshness["sitemap-fresh"]
+	if !ok {
+		t.Fatal("listing missing from freshness")
+	}
+	if got.SitemapLastMod == nil || !got.SitemapLastMod.Equal(lastMod) {
+		t.Errorf("SitemapLastMod = %v, want %v", got.SitemapLastMod, lastMod)
+	}
+
+	seenAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	if err := repo.TouchListings(ctx, source.ID, []string{"sitemap-fresh"}, seenAt); err != nil {
+		t.Fatalf("TouchListings failed: %v", err)
+	}
+	freshness, err = repo.ListingFreshness(ctx, source.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !freshness["sitemap-fresh"].LastSeenAt.Equal(seenAt) {
+		t.Errorf("LastSeenAt = %v, want %v", freshness["sitemap-fresh"].LastSeenAt, seenAt)
+	}
+}
+
+func TestNearby(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	at := func(externalID string, lat, lng float64) *domain.Listing {
+		l := newTestListing(source, externalID)
+		l.Lat, l.Lng = &lat, &lng
+		l.City, l.State = domain.StrPtr("Austin"), domain.StrPtr("TX")
+		return l
+	}
+	origin := at("nearby-origin", 30.2672, -97.7431)
+	near := at("nearby-close", 30.2849, -97.7341)    // ~1.3 miles
+	closer := at("nearby-closer", 30.2700, -97.7400) // ~0.3 miles
+	far := at("nearby-far", 29.4241, -98.4936)       // San Antonio, ~75 miles
+	noCoords := newTestListing(source, "nearby-no-coords")
+	noCoords.City, noCoords.State = domain.StrPtr("austin"), domain.StrPtr("TX")
+	if err := repo.UpsertBatch(ctx, []*domain.Listing{origin, near, closer, far, noCoords}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.Nearby(ctx, origin, 25, 20)
+	if err != nil {
+		t.Fatalf("Nearby failed: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != closer.ID || got[1].ID != near.ID {
+		t.Fatalf("got %d listings, want closer then near", len(got))
+	}
+	if d := got[0].DistanceMiles; d == nil || *d <= 0 || *d > 1 {
+		t.Errorf("closer distance = %v, want under a mile", d)
+	}
+
+	// Without coordinates, same-city listings match without a distance
+	got, err = repo.Nearby(ctx, noCoords, 25, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("got %d same-city listings, want 4", len(got))
+	}
+	for _, l := range got {
+		if l.ID == noCoords.ID || l.DistanceMiles != nil {
+			t.Errorf("unexpected same-city result %s (distance %v)", l.ExternalID, l.DistanceMiles)
+		}
+	}
+
+	none, err := repo.Nearby(ctx, newTestListing(source, "nearby-nowhere"), 25, 20)
+	if err != nil || none == nil || len(none) != 0 {
+		t.Errorf("Nearby without location = %v, %v; want an empty slice", none, err)
+	}
+}
+
+func TestReplaceDocuments(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	l := newTestListing(source, "documents")
+	if err := repo.Upsert(ctx, l); err != nil {
+		t.Fatal(err)
+	}
+
+	none, err := repo.GetDocuments(ctx, l.ID)
+	if err != nil || none == nil || len(none) != 0 {
+		t.Fatalf("GetDocuments without documents = %v, %v; want an empty slice", none, err)
+	}
+
+	cim := domain.ListingDocument{Type: domain.DocumentTypeCIM, URL: "https://example.com/cim.pdf", Title: domain.StrPtr("CIM")}
+	pl := domain.ListingDocument{Type: domain.DocumentTypeFinancials, URL: "https://example.com/pl.pdf"}
+	if err := repo.ReplaceDocuments(ctx, l.ID, []domain.ListingDocument{cim, pl, cim}); err != nil {
+		t.Fatalf("ReplaceDocuments failed: %v", err)
+	}
+	got, err := repo.GetDocuments(ctx, l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].URL != cim.URL || got[1].Title != nil {
+		t.Errorf("documents = %+v, want the CIM then the untitled P&L", got)
+	}
+
+	// Re-enrichment replaces the set
+	if err := repo.ReplaceDocuments(ctx, l.ID, []domain.ListingDocument{pl}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = repo.GetDocuments(ctx, l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].URL != pl.URL {
+		t.Errorf("documents = %+v, want only the P&L", got)
+	}
+}
+
+func TestSearchPriceRanges(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	dollars := func(d int64) *int64 { c := d * 100; return &c }
+	industry := "Ranges " + source.Slug
+	seed := []struct {
+		id        string
+		low, high *int64
+	}{
+		{"single-300k", dollars(300000), nil},
+		{"range-100k-200k", dollars(100000), dollars(200000)},
+		{"range-400k-600k", dollars(400000), dollars(600000)},
+		{"open-800k", dollars(800000), nil},
+	}
+	for _, s := range seed {
+		l := newTestListing(source, s.id)
+		l.Industry = &industry
+		l.AskingPrice, l.AskingPriceMax = s.low, s.high
+		if err := repo.Upsert(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name               string
+		priceMin, priceMax *int64
+		want               []string
+	}{
+		{"overlapping range", dollars(350000), dollars(500000), []string{"range-400k-600k"}},
+		{"min reaches high end", dollars(150000), nil, []string{"open-800k", "range-100k-200k", "range-400k-600k", "single-300k"}},
+		{"max compares low end", nil, dollars(150000), []string{"range-100k-200k"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := repo.Search(ctx, domain.ListingSearchParams{
+				Industries: []string{industry},
+				PriceMin:   tt.priceMin,
+				PriceMax:   tt.priceMax,
+				Page:       1,
+				PerPage:    10,
+			})
+			if err != nil {
+				t.Fatalf("Search returned error: %v", err)
+			}
+			var got []string
+			for _, l := range result.Listings {
+				got = append(got, l.ExternalID)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpsertRelistsStaleListing(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	listing := newTestListing(source, "relist-1")
+	listing.Industry = domain.StrPtr("Relists " + source.Slug)
+	listing.LastSeenAt = time.Now().Add(-48 * time.Hour)
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+
+	// Seen again while active: not a relist
+	listing.LastSeenAt = time.Now().Add(-24 * time.Hour)
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetByID(ctx, listing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RelistedAt != nil || got.RelistCount != 0 {
+		t.Fatalf("active listing relisted_at = %v, relist_count = %d; want unset", got.RelistedAt, got.RelistCount)
+	}
+
+	stale, err := repo.MarkStale(ctx, source.ID, time.Now().Add(-time.Hour).Format(time.RFC3339))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale != 1 {
+		t.Fatalf("MarkStale deactivated %d listings, want 1", stale)
+	}
+
+	// Back on a later scrape
+	seenAt := time.Now().UTC().Truncate(time.Microsecond)
+	listing.LastSeenAt = seenAt
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+	got, err = repo.GetByID(ctx, listing.ID)
+	if err != nil {
+		t.Fatalf("relisted listing not active: %v", err)
+	}
+	if got.RelistedAt == nil || !got.RelistedAt.Equal(seenAt) {
+		t.Errorf("relisted_at = %v, want %v", got.RelistedAt, seenAt)
+	}
+	if got.RelistCount != 1 {
+		t.Errorf("relist_count = %d, want 1", got.RelistCount)
+	}
+	if !got.IsBackOnMarket(time.Now()) {
+		t.Error("relisted listing is not back on the market")
+	}
+
+	result, err := repo.Search(ctx, domain.ListingSearchParams{
+		Industries: []string{*listing.Industry},
+		Relisted:   domain.BoolPtr(true),
+		Page:       1,
+		PerPage:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Listings) != 1 || result.Listings[0].ID != listing.ID {
+		t.Errorf("relisted=true search returned %d listings, want the relisted one", len(result.Listings))
+	}
+}
+
+func TestSearchPriceOnRequest(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	priced := newTestListing(source, "priced")
+	priced.AskingPrice = domain.Ptr(int64(25000000))
+	onRequest := newTestListing(source, "on-request")
+	onRequest.PriceOnRequest = true
+	missing := newTestListing(source, "missing")
+	if err := repo.UpsertBatch(ctx, []*domain.Listing{priced, onRequest, missing}); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(v bool) []string {
+		t.Helper()
+		result, err := repo.Search(ctx, domain.ListingSearchParams{SourceID: &source.ID, PriceOnRequest: &v, Sort: "price_asc", Page: 1, PerPage: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, l := range result.Listings {
+			ids = append(ids, l.ExternalID)
+		}
+		return ids
+	}
+	if got := search(true); !reflect.DeepEqual(got, []string{"on-request"}) {
+		t.Errorf("price_on_request=true found %v, want [on-request]", got)
+	}
+	if got := search(false); !reflect.DeepEqual(got, []string{"priced", "missing"}) {
+		t.Errorf("price_on_request=false found %v, want [priced missing]", got)
+	}
+
+	// A price found by enrichment ends the listing being on request
+	if err := repo.ApplyEnrichment(ctx, onRequest.ID, &domain.Listing{AskingPrice: domain.Ptr(int64(30000000))}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetByID(ctx, onRequest.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PriceOnRequest || got.AskingPrice == nil {
+		t.Errorf("after enrichment price_on_request = %v, asking_price = %v", got.PriceOnRequest, got.AskingPrice)
+	}
+}
+
+func TestUpsertRecordsPriceHistory(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	listing := newTestListing(source, "price-history-1")
+	prices := []int64{50000000, 50000000, 45000000}
+	for i, price := range prices {
+		listing.AskingPrice = &price
+		listing.LastSeenAt = time.Now().Add(time.Duration(i-len(prices)) * time.Hour)
+		if err := repo.Upsert(ctx, listing); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The unchanged price in the second scrape isn't recorded again
+	history, err := repo.GetPriceHistory(ctx, listing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("got %d prices, want 2: %+v", len(history), history)
+	}
+	if *history[0].AskingPrice != 50000000 || *history[1].AskingPrice != 45000000 {
+		t.Errorf("prices = %d, %d; want 50000000, 45000000", *history[0].AskingPrice, *history[1].AskingPrice)
+	}
+}
+
+func TestUpsertUnchangedOnlyMarksSeen(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	listing := newTestListing(source, "unchanged-1")
+	listing.Description = domain.StrPtr("Scraped description")
+	listing.LastSeenAt = time.Now().Add(-time.Hour)
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+
+	// A field edited outside the upsert shows whether the next one rewrote the row
+	if _, err := db.ExecContext(ctx, `UPDATE listings SET description = 'edited' WHERE id = $1`, listing.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	seenAt := time.Now().UTC().Truncate(time.Microsecond)
+	listing.LastSeenAt = seenAt
+	listing.RawData = []byte(`{"fetched":"again"}`)
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetByID(ctx, listing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got.Description != "edited" {
+		t.Errorf("unchanged re-scrape rewrote the listing: description = %q", *got.Description)
+	}
+	if !got.LastSeenAt.Equal(seenAt) {
+		t.Errorf("last_seen_at = %v, want %v", got.LastSeenAt, seenAt)
+	}
+
+	// A changed price takes the full path
+	listing.AskingPrice = domain.Ptr(int64(30000000))
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = repo.GetByID(ctx, listing.ID); err != nil {
+		t.Fatal(err)
+	}
+	if *got.Description != "Scraped description" || got.AskingPrice == nil || *got.AskingPrice != 30000000 {
+		t.Errorf("changed re-scrape: description = %q, asking_price = %v", *got.Description, got.AskingPrice)
+	}
+}
+
+func TestUpsertRecordsChanges(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	// Scraped inactive, then relisted at a lower price
+	listing := newTestListing(source, "changes-1")
+	listing.AskingPrice = domain.Ptr(int64(50000000))
+	listing.IsActive = false
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+	listing.AskingPrice = domain.Ptr(int64(45000000))
+	listing.IsActive = true
+	listing.LastSeenAt = time.Now()
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := repo.GetChanges(ctx, listing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2: %+v", len(changes), changes)
+	}
+	events := map[string]domain.ListingChange{}
+	for _, c := range changes {
+		events[c.Event] = c
+	}
+	if c, ok := events[domain.ChangeEventPriceDrop]; !ok || *c.OldValue != "50000000" || *c.NewValue != "45000000" {
+		t.Errorf("price drop = %+v, want 50000000 -> 45000000", c)
+	}
+	if c, ok := events[domain.ChangeEventRelisted]; !ok || c.Field != "is_active" {
+		t.Errorf("relist = %+v, want is_active false -> true", c)
+	}
+}
+
+func TestListOutdated(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewListingRepository(db)
+	source := createTestSource(t, db)
+	ctx := context.Background()
+
+	old := newTestListing(source, "old")
+	old.ParsedByVersion = 1
+	old.AskingPrice = domain.Ptr(int64(40000000))
+	old.CashFlow = domain.Ptr(int64(8000000))
+	current := newTestListing(source, "current")
+	current.ParsedByVersion = 1
+	if err := repo.UpsertBatch(ctx, []*domain.Listing{old, current}); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := repo.ListOutdated(ctx, source.ID, 1, 10); err != nil || len(ids) != 0 {
+		t.Fatalf("ListOutdated at version 1 = %v, %v; want none", ids, err)
+	}
+
+	// The scraper is bumped to version 2 and re-scrapes one listing unchanged
+	current.ParsedByVersion = 2
+	current.LastSeenAt = time.Now()
+	if err := repo.Upsert(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := repo.ListOutdated(ctx, source.ID, 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != old.ID {
+		t.Errorf("ListOutdated at version 2 = %v, want only %s", ids, old.ID)
+	}
+
+	// Re-fetching its details brings the other up to date, the newer parse
+	// overwriting the values the older one found
+	if err := repo.ApplyEnrichment(ctx, old.ID, &domain.Listing{CashFlow: domain.Ptr(int64(9000000)), ParsedByVersion: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := repo.ListOutdated(ctx, source.ID, 2, 10); err != nil || len(ids) != 0 {
+		t.Errorf("ListOutdated after enrichment = %v, %v; want none", ids, err)
+	}
+	got, err := repo.GetByID(ctx, old.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CashFlow == nil || *got.CashFlow != 9000000 || got.AskingPrice == nil || *got.AskingPrice != *old.AskingPrice {
+		t.Errorf("cash_flow = %v, asking_price = %v; want the new cash flow and the price the new parse didn't find kept", got.CashFlow, got.AskingPrice)
+	}
+
+	// A fetch by the same version only fills in what's missing
+	if err := repo.ApplyEnrichment(ctx, old.ID, &domain.Listing{CashFlow: domain.Ptr(int64(1)), ParsedByVersion: 2}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = repo.GetByID(ctx, old.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CashFlow == nil || *got.CashFlow != 9000000 {
+		t.Errorf("cash_flow after a same-version fetch = %v, want 9000000 kept", got.CashFlow)
+	}
+}
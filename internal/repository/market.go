@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// ErrInvalidGroupBy is returned by MarketStats for a field it can't group by
+var ErrInvalidGroupBy = errors.New("invalid group_by")
+
+// marketGroupColumns maps the fields MarketStats groups by to their columns
+var marketGroupColumns = map[string]string{
+	"industry":      "l.industry",
+	"state":         "l.state",
+	"category":      "l.industry_category",
+	"business_type": "l.business_type",
+}
+
+// marketStatsLimit caps the number of groups returned, largest first
+const marketStatsLimit = 500
+
+// MarketStats summarizes the asking prices of the active listings matching
+// params' filters, per combination of the groupBy fields; no fields
+// summarizes the whole market. Groups smaller than
+// domain.MarketStatsMinListings are returned with only their count, and a
+// statistic is left out unless that many of the group's listings have the
+// figures it is computed from.
+func (r *ListingRepository) MarketStats(ctx context.Context, params domain.ListingSearchParams, groupBy []string) ([]domain.MarketStat, error) {
+	columns := make([]string, len(groupBy))
+	for i, field := range groupBy {
+		column, ok := marketGroupColumns[field]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %q; want industry, state, category or business_type", ErrInvalidGroupBy, field)
+		}
+		for _, other := range groupBy[:i] {
+			if other == field {
+				return nil, fmt.Errorf("%w: %s is repeated", ErrInvalidGroupBy, field)
+			}
+		}
+		columns[i] = column
+	}
+
+	conditions, args, _ := searchConditions(params)
+	selectGroup, groupClause, order := "", "", "COUNT(*) DESC"
+	if len(columns) > 0 {
+		selectGroup = strings.Join(columns, ", ") + ","
+		groupClause = "GROUP BY " + strings.Join(columns, ", ")
+		order += ", " + strings.Join(columns, ", ")
+	}
+	query := fmt.Sprintf(`
+		SELECT %s COUNT(*),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY l.asking_price),
+			AVG(l.asking_price)::float8,
+			COUNT(l.asking_price),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY l.cash_flow),
+			COUNT(l.cash_flow),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY l.asking_price::float8 / NULLIF(l.revenue, 0)),
+			COUNT(l.asking_price::float8 / NULLIF(l.revenue, 0))
+		FROM listings l
+		WHERE %s
+		%s
+		ORDER BY %s
+		LIMIT %d
+	`, selectGroup, strings.Join(conditions, " AND "), groupClause, order, marketStatsLimit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+	defer rows.Close()
+
+	stats := []domain.MarketStat{}
+	for rows.Next() {
+		groupValues := make([]sql.NullString, len(groupBy))
+		// Percentiles and averages skip nulls, so each is only as good as
+		// the number of listings with its figures
+		var count, prices, cashFlows, multiples int
+		var medianPrice, avgPrice, medianCashFlow, medianMultiple sql.NullFloat64
+		dest := make([]interface{}, 0, len(groupBy)+8)
+		for i := range groupValues {
+			dest = append(dest, &groupValues[i])
+		}
+		dest = append(dest, &count, &medianPrice, &avgPrice, &prices, &medianCashFlow, &cashFlows, &medianMultiple, &multiples)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, queryError(ctx, err)
+		}
+
+		stat := domain.MarketStat{Group: make(map[string]*string, len(groupBy)), Count: count}
+		for i, field := range groupBy {
+			if groupValues[i].Valid {
+				stat.Group[field] = &groupValues[i].String
+			} else {
+				stat.Group[field] = nil
+			}
+		}
+		if count < domain.MarketStatsMinListings {
+			stat.Suppressed = true
+		} else {
+			if prices >= domain.MarketStatsMinListings {
+				stat.MedianAskingPrice = cents(medianPrice)
+				stat.AvgAskingPrice = cents(avgPrice)
+			}
+			if cashFlows >= domain.MarketStatsMinListings {
+				stat.MedianCashFlow = cents(medianCashFlow)
+			}
+			if multiples >= domain.MarketStatsMinListings && medianMultiple.Valid {
+				multiple := math.Round(medianMultiple.Float64*100) / 100
+				stat.MedianRevenueMultiple = &multiple
+			}
+		}
+		stats = append(stats, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, err)
+	}
+	return stats, nil
+}
+
+// cents rounds a computed amount to whole cents, nil if there was none
+func cents(v sql.NullFloat64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	c := int64(math.Round(v.Float64))
+	return &c
+}
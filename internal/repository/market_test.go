@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestMarketStats(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	// A unique industry keeps the market to this test's listings
+	restaurants := "Restaurants " + source.Slug
+	seed := []struct {
+		id, state                string
+		price, cashFlow, revenue int64
+	}{
+		{"m-1", "TX", 100_000_00, 30_000_00, 200_000_00},
+		{"m-2", "TX", 200_000_00, 50_000_00, 400_000_00},
+		{"m-3", "TX", 300_000_00, 70_000_00, 300_000_00},
+		{"m-4", "TX", 400_000_00, 90_000_00, 400_000_00},
+		{"m-5", "TX", 1_000_000_00, 250_000_00, 500_000_00},
+		{"m-6", "CA", 500_000_00, 100_000_00, 1_000_000_00},
+		{"m-7", "CA", 700_000_00, 150_000_00, 700_000_00},
+	}
+	for _, s := range seed {
+		l := newTestListing(source, s.id)
+		l.State = domain.StrPtr(s.state)
+		l.Industry = domain.StrPtr(restaurants)
+		l.AskingPrice = domain.Ptr(s.price)
+		l.CashFlow = domain.Ptr(s.cashFlow)
+		l.Revenue = domain.Ptr(s.revenue)
+		if err := repo.Upsert(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := repo.MarketStats(ctx, domain.ListingSearchParams{Industries: []string{restaurants}}, []string{"industry", "state"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("got %d groups, want TX and CA", len(stats))
+	}
+
+	tx := stats[0]
+	if *tx.Group["state"] != "TX" || *tx.Group["industry"] != restaurants || tx.Count != 5 || tx.Suppressed {
+		t.Fatalf("largest group = %v with %d listings (suppressed %v), want TX with 5", tx.Group, tx.Count, tx.Suppressed)
+	}
+	if *tx.MedianAskingPrice != 300_000_00 || *tx.AvgAskingPrice != 400_000_00 || *tx.MedianCashFlow != 70_000_00 {
+		t.Errorf("TX median price %d, avg %d, median cash flow %d; want 30000000, 40000000, 7000000",
+			*tx.MedianAskingPrice, *tx.AvgAskingPrice, *tx.MedianCashFlow)
+	}
+	// Multiples are 0.5, 0.5, 1, 1, 2
+	if *tx.MedianRevenueMultiple != 1 {
+		t.Errorf("TX median revenue multiple = %v, want 1", *tx.MedianRevenueMultiple)
+	}
+
+	ca := stats[1]
+	if ca.Count != 2 || !ca.Suppressed || ca.MedianAskingPrice != nil || ca.AvgAskingPrice != nil || ca.MedianRevenueMultiple != nil {
+		t.Errorf("CA group = %+v, want 2 listings with statistics suppressed", ca)
+	}
+
+	// No group_by summarizes the whole filtered market
+	stats, err = repo.MarketStats(ctx, domain.ListingSearchParams{Industries: []string{restaurants}, States: []string{"TX"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Count != 5 || len(stats[0].Group) != 0 {
+		t.Errorf("ungrouped stats = %+v, want one group of 5", stats)
+	}
+}
+
+func TestMarketStatsGroupBy(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+	ctx := context.Background()
+
+	for _, groupBy := range [][]string{{"city"}, {"state", "state"}} {
+		if _, err := repo.MarketStats(ctx, domain.ListingSearchParams{}, groupBy); !errors.Is(err, ErrInvalidGroupBy) {
+			t.Errorf("group_by %v: err = %v, want ErrInvalidGroupBy", groupBy, err)
+		}
+	}
+
+	// Groups are filtered like searches; a null group value stays nil
+	mock.ExpectQuery(`SELECT l.industry_category, COUNT\(\*\),.* WHERE l.is_active = true AND l.hidden = false AND l.state IN \(\$1\)\s+GROUP BY l.industry_category\s+ORDER BY COUNT\(\*\) DESC, l.industry_category`).
+		WithArgs("TX").
+		WillReturnRows(sqlmock.NewRows([]string{"industry_category", "count", "p", "a", "pn", "c", "cn", "m", "mn"}).
+			AddRow("Food", 6, 25000000.4, 26000000.6, 6, 6000000.0, 5, 1.2345, 5).
+			AddRow("Retail", 10, 30000000.0, 30000000.0, 10, 9000000.0, 1, 0.5, 4).
+			AddRow(nil, 1, 100.0, 100.0, 1, nil, 0, nil, 0))
+
+	stats, err := repo.MarketStats(ctx, domain.ListingSearchParams{States: []string{"TX"}}, []string{"category"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(stats) != 3 {
+		t.Fatalf("got %d groups, want 3", len(stats))
+	}
+	food := stats[0]
+	if *food.Group["category"] != "Food" || *food.MedianAskingPrice != 25000000 || *food.AvgAskingPrice != 26000001 ||
+		food.MedianCashFlow == nil || *food.MedianRevenueMultiple != 1.23 {
+		t.Errorf("Food group = %+v", food)
+	}
+	// A median of the few listings with cash flow or revenue is left out
+	retail := stats[1]
+	if retail.Suppressed || retail.MedianAskingPrice == nil || retail.MedianCashFlow != nil || retail.MedianRevenueMultiple != nil {
+		t.Errorf("Retail group = %+v, want its price statistics only", retail)
+	}
+	if category, ok := stats[2].Group["category"]; !ok || category != nil || !stats[2].Suppressed {
+		t.Errorf("uncategorized group = %+v, want a nil category with statistics suppressed", stats[2])
+	}
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// ErrUnknownQualityCheck is returned by QualityListings for a check that
+// doesn't exist
+var ErrUnknownQualityCheck = errors.New("unknown data-quality check")
+
+// qualityCheck is a named data-quality check: condition is the SQL a listing
+// "l" fails it by
+type qualityCheck struct {
+	name        string
+	description string
+	condition   string
+}
+
+// qualityPriceFloor is the asking price, in cents, below which one is most
+// likely misparsed
+const qualityPriceFloor = 1_000_00
+
+// qualityChecks are the data-quality checks, in report order. A new check
+// only needs an entry here.
+var qualityChecks = []qualityCheck{
+	{
+		name:        "no_price",
+		description: "No asking price",
+		condition:   "l.asking_price IS NULL",
+	},
+	{
+		name:        "no_location",
+		description: "No city, state or ZIP code",
+		condition:   "NULLIF(l.city, '') IS NULL AND NULLIF(l.state, '') IS NULL AND NULLIF(l.zip_code, '') IS NULL",
+	},
+	{
+		name:        "navigation_title",
+		description: "Title looks like site navigation rather than a business",
+		// A link label, maybe with arrows around it, or no words at all
+		condition: `l.title ~* '^\W*(next|prev(ious)?|back|home|search|menu|log ?in|sign (in|up)|register|` +
+			`contact( us)?|about( us)?|view (details|listing|more)|read more|more info|learn more|(page )?\d+)?\W*$'`,
+	},
+	{
+		name:        "price_below_floor",
+		description: fmt.Sprintf("Asking price below $%d", qualityPriceFloor/100),
+		condition:   fmt.Sprintf("l.asking_price < %d", qualityPriceFloor),
+	},
+}
+
+// qualityCheckNamed returns the check called name
+func qualityCheckNamed(name string) (qualityCheck, bool) {
+	for _, check := range qualityChecks {
+		if check.name == name {
+			return check, true
+		}
+	}
+	return qualityCheck{}, false
+}
+
+// DataQuality counts the active listings failing each data-quality check, in
+// total and per source, with one query per check
+func (r *ListingRepository) DataQuality(ctx context.Context) ([]domain.DataQualityIssue, error) {
+	issues := make([]domain.DataQualityIssue, 0, len(qualityChecks))
+	for _, check := range qualityChecks {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		var counts []struct {
+			Source string `db:"source"`
+			Count  int    `db:"count"`
+		}
+		query := fmt.Sprintf(`
+			SELECT s.slug AS source, COUNT(*) AS count
+			FROM listings l
+			JOIN sources s ON s.id = l.source_id
+			WHERE l.is_active = true AND l.hidden = false AND (%s)
+			GROUP BY s.slug
+			ORDER BY count DESC, s.slug
+		`, check.condition)
+		if err := r.db.SelectContext(ctx, &counts, query); err != nil {
+			return nil, fmt.Errorf("check %s: %w", check.name, queryError(ctx, err))
+		}
+
+		issue := domain.DataQualityIssue{Name: check.name, Description: check.description, Sources: map[string]int{}}
+		for _, c := range counts {
+			issue.Count += c.Count
+			issue.Sources[c.Source] = c.Count
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// QualityListings returns the active listings failing the named check, or
+// every check if name is empty, by check, source and title. A listing is
+// returned once per check it fails. The rows are capped at SEARCH_MAX_ROWS,
+// shared equally between the checks so one with many failures doesn't crowd
+// out the rest; truncated names the checks that had more.
+func (r *ListingRepository) QualityListings(ctx context.Context, name string) (listings []domain.DataQualityListing, truncated []string, err error) {
+	checks := qualityChecks
+	if name != "" {
+		check, ok := qualityCheckNamed(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w %q", ErrUnknownQualityCheck, name)
+		}
+		checks = []qualityCheck{check}
+	}
+	perCheck := max(r.maxRows/len(checks), 1)
+
+	listings = []domain.DataQualityListing{}
+	for _, check := range checks {
+		if err := checkContext(ctx); err != nil {
+			return nil, nil, err
+		}
+		var rows []domain.DataQualityListing
+		query := fmt.Sprintf(`
+			SELECT $1::text AS issue, s.slug AS source, l.id, l.external_id, l.url, l.title,
+				l.asking_price, l.city, l.state, l.last_seen_at
+			FROM listings l
+			JOIN sources s ON s.id = l.source_id
+			WHERE l.is_active = true AND l.hidden = false AND (%s)
+			ORDER BY s.slug, l.title, l.id
+			LIMIT $2
+		`, check.condition)
+		// One row more than the share tells whether the check had more
+		if err := r.db.SelectContext(ctx, &rows, query, check.name, perCheck+1); err != nil {
+			return nil, nil, fmt.Errorf("check %s: %w", check.name, queryError(ctx, err))
+		}
+		if len(rows) > perCheck {
+			rows = rows[:perCheck]
+			truncated = append(truncated, check.name)
+		}
+		listings = append(listings, rows...)
+	}
+	return listings, truncated, nil
+}
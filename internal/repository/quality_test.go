@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestDataQuality(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	good := newTestListing(source, "q-good")
+	good.AskingPrice = domain.Ptr(int64(250_000_00))
+	good.City, good.State = domain.StrPtr("Austin"), domain.StrPtr("TX")
+
+	// Scraped a pagination link as a listing
+	nav := newTestListing(source, "q-nav")
+	nav.Title = "Next »"
+	nav.AskingPrice = domain.Ptr(int64(1_00))
+	nav.State = domain.StrPtr("TX")
+
+	for _, l := range []*domain.Listing{good, nav} {
+		if err := repo.Upsert(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issues, err := repo.DataQuality(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, issue := range issues {
+		got[issue.Name] = issue.Sources[source.Slug]
+	}
+	want := map[string]int{"no_price": 0, "no_location": 0, "navigation_title": 1, "price_below_floor": 1}
+	for name, count := range want {
+		if got[name] != count {
+			t.Errorf("%s: %d listings of the test source, want %d", name, got[name], count)
+		}
+	}
+
+	rows, _, err := repo.QualityListings(ctx, "navigation_title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, row := range rows {
+		found = found || (row.Source == source.Slug && row.ExternalID == "q-nav" && row.Issue == "navigation_title")
+	}
+	if !found {
+		t.Errorf("navigation_title export doesn't list q-nav: %+v", rows)
+	}
+}
+
+func TestQualityListings(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+	repo.SetMaxRows(8)
+	ctx := context.Background()
+
+	if _, _, err := repo.QualityListings(ctx, "no_title"); !errors.Is(err, ErrUnknownQualityCheck) {
+		t.Errorf("err = %v, want ErrUnknownQualityCheck", err)
+	}
+
+	// Each of the 4 checks gets 2 of the 8 rows, and is asked for one more
+	// to tell whether it has more
+	seen := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	columns := []string{"issue", "source", "id", "external_id", "url", "title", "asking_price", "city", "state", "last_seen_at"}
+	mock.ExpectQuery(`l.asking_price IS NULL\)\s+ORDER BY s.slug, l.title, l.id\s+LIMIT \$2`).
+		WithArgs("no_price", 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("no_price", "bizquest", "8d9e6f5a-1b2c-4d3e-8f4a-5b6c7d8e9f00", "1", "https://example.com/1", "Bakery", nil, "Tampa", "FL", seen).
+			AddRow("no_price", "bizquest", "8d9e6f5a-1b2c-4d3e-8f4a-5b6c7d8e9f01", "2", "https://example.com/2", "Cafe", nil, nil, nil, seen).
+			AddRow("no_price", "bizquest", "8d9e6f5a-1b2c-4d3e-8f4a-5b6c7d8e9f02", "3", "https://example.com/3", "Deli", nil, nil, nil, seen))
+	mock.ExpectQuery(`NULLIF\(l.city, ''\) IS NULL`).
+		WithArgs("no_location", 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("no_location", "bizquest", "8d9e6f5a-1b2c-4d3e-8f4a-5b6c7d8e9f01", "2", "https://example.com/2", "Cafe", nil, nil, nil, seen))
+	mock.ExpectQuery(`l.title ~\*`).
+		WithArgs("navigation_title", 3).
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery(`l.asking_price < `).
+		WithArgs("price_below_floor", 3).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	rows, truncated, err := repo.QualityListings(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(rows) != 3 || rows[2].Issue != "no_location" || rows[2].City != nil {
+		t.Errorf("rows = %+v, want two no_price and one no_location", rows)
+	}
+	if !reflect.DeepEqual(truncated, []string{"no_price"}) {
+		t.Errorf("truncated = %v, want [no_price]", truncated)
+	}
+}
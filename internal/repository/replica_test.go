@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestListingRepositoryReadsFromReplica(t *testing.T) {
+	writerDB, writer, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writerDB.Close()
+	readerDB, reader, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readerDB.Close()
+	repo := NewListingRepositoryWithReplicas(sqlx.NewDb(writerDB, "postgres"), sqlx.NewDb(readerDB, "postgres"))
+	ctx := context.Background()
+
+	// Each mock fails any query it wasn't told to expect, so a read sent to
+	// the writer or a write sent to the reader fails the call
+	reader.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l WHERE`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	if _, err := repo.Search(ctx, domain.ListingSearchParams{PerPage: 0}); err != nil {
+		t.Errorf("Search: %v", err)
+	}
+
+	id := uuid.New()
+	reader.ExpectQuery(`SELECT .* WHERE l.id = \$1`).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(id, "Cafe"))
+	if _, err := repo.GetByID(ctx, id); err != nil {
+		t.Errorf("GetByID: %v", err)
+	}
+
+	option := sqlmock.NewRows([]string{"value", "label", "count"}).AddRow("TX", "TX", 1)
+	for i := 0; i < 5; i++ { // industry, state, business type, category, tags
+		reader.ExpectQuery(`SELECT .* as value`).WillReturnRows(option)
+	}
+	reader.ExpectQuery(`SELECT COALESCE\(MIN\(asking_price\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(0, 0))
+	if _, err := repo.GetFilterOptions(ctx); err != nil {
+		t.Errorf("GetFilterOptions: %v", err)
+	}
+
+	sourceID := uuid.New()
+	writer.ExpectQuery(`INSERT INTO listings`).
+		WillReturnRows(sqlmock.NewRows([]string{"source_id", "external_id"}).AddRow(sourceID, "1"))
+	if err := repo.Upsert(ctx, &domain.Listing{ID: uuid.New(), SourceID: sourceID, ExternalID: "1"}); err != nil {
+		t.Errorf("Upsert: %v", err)
+	}
+
+	writer.ExpectExec(`UPDATE listings SET is_active = false`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	if _, err := repo.MarkStale(ctx, sourceID, "2024-05-10T00:00:00Z"); err != nil {
+		t.Errorf("MarkStale: %v", err)
+	}
+
+	if err := reader.ExpectationsWereMet(); err != nil {
+		t.Errorf("reader: %v", err)
+	}
+	if err := writer.ExpectationsWereMet(); err != nil {
+		t.Errorf("writer: %v", err)
+	}
+}
+
+func TestListingRepositoryReadDB(t *testing.T) {
+	primary, a, b := &sqlx.DB{}, &sqlx.DB{}, &sqlx.DB{}
+
+	if got := NewListingRepository(primary).readDB(); got != primary {
+		t.Error("without replicas, reads don't go to the primary")
+	}
+
+	repo := NewListingRepositoryWithReplicas(primary, a, b)
+	for i, want := range []*sqlx.DB{a, b, a} {
+		if got := repo.readDB(); got != want {
+			t.Errorf("read %d went to the wrong replica", i+1)
+		}
+	}
+}
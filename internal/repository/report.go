@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// CreateReport saves a user's report of a listing, setting its ID and
+// CreatedAt. It returns sql.ErrNoRows if the listing doesn't exist or isn't
+// shown, being inactive or hidden.
+func (r *ListingRepository) CreateReport(ctx context.Context, report *domain.ListingReport) error {
+	return r.db.QueryRowxContext(ctx, `
+		INSERT INTO listing_reports (listing_id, reason, note, reporter_ip)
+		SELECT id, $2, $3, $4 FROM listings
+		WHERE id = $1 AND is_active = true AND hidden = false
+		RETURNING id, created_at
+	`, report.ListingID, report.Reason, report.Note, report.ReporterIP).Scan(&report.ID, &report.CreatedAt)
+}
+
+// CountReports returns how many reporters, by IP, reported a listing for reason
+func (r *ListingRepository) CountReports(ctx context.Context, listingID uuid.UUID, reason string) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, `
+		SELECT COUNT(DISTINCT reporter_ip) FROM listing_reports WHERE listing_id = $1 AND reason = $2
+	`, listingID, reason)
+	return count, err
+}
+
+// ClaimReportAction records that a listing's reports for reason have been
+// acted on. It reports false if they already were, so of concurrent callers
+// only one acts.
+func (r *ListingRepository) ClaimReportAction(ctx context.Context, listingID uuid.UUID, reason string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO listing_report_actions (listing_id, reason) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, listingID, reason)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// ListReports returns the most recent reports, newest first, with their
+// listings' titles, up to limit (capped by SetMaxRows)
+func (r *ListingRepository) ListReports(ctx context.Context, limit int) ([]domain.ListingReport, error) {
+	reports := []domain.ListingReport{}
+	err := r.db.SelectContext(ctx, &reports, `
+		SELECT r.id, r.listing_id, r.reason, r.note, r.reporter_ip, r.created_at, l.title AS listing_title
+		FROM listing_reports r
+		JOIN listings l ON l.id = r.listing_id
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT $1
+	`, r.clampRows(limit))
+	return reports, err
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestListingReports(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	listing := newTestListing(source, "reported-1")
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	note := "Sign in the window says sold"
+	for _, report := range []*domain.ListingReport{
+		{ListingID: listing.ID, Reason: domain.ReportReasonSold, Note: &note, ReporterIP: "192.0.2.1"},
+		{ListingID: listing.ID, Reason: domain.ReportReasonSold, ReporterIP: "192.0.2.2"},
+		{ListingID: listing.ID, Reason: domain.ReportReasonSold, ReporterIP: "192.0.2.2"},
+		{ListingID: listing.ID, Reason: domain.ReportReasonWrongPrice, ReporterIP: "192.0.2.3"},
+	} {
+		if err := repo.CreateReport(ctx, report); err != nil {
+			t.Fatalf("CreateReport: %v", err)
+		}
+		if report.ID == 0 || report.CreatedAt.IsZero() {
+			t.Errorf("report = %+v, want its ID and CreatedAt set", report)
+		}
+	}
+
+	count, err := repo.CountReports(ctx, listing.ID, domain.ReportReasonSold)
+	if err != nil {
+		t.Fatalf("CountReports: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("sold reports = %d, want 2, one per IP", count)
+	}
+
+	for i, want := range []bool{true, false} {
+		claimed, err := repo.ClaimReportAction(ctx, listing.ID, domain.ReportReasonSold)
+		if err != nil {
+			t.Fatalf("ClaimReportAction: %v", err)
+		}
+		if claimed != want {
+			t.Errorf("claim %d = %v, want %v", i+1, claimed, want)
+		}
+	}
+
+	reports, err := repo.ListReports(ctx, 2)
+	if err != nil {
+		t.Fatalf("ListReports: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Reason != domain.ReportReasonWrongPrice || reports[0].ListingTitle != listing.Title {
+		t.Errorf("reports = %+v, want the 2 newest with the listing's title", reports)
+	}
+
+	// Hidden and unknown listings can't be reported
+	if err := repo.SetHidden(ctx, listing.ID, true); err != nil {
+		t.Fatalf("SetHidden: %v", err)
+	}
+	for _, id := range []uuid.UUID{listing.ID, uuid.New()} {
+		err := repo.CreateReport(ctx, &domain.ListingReport{ListingID: id, Reason: domain.ReportReasonOther})
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("CreateReport(%s) error = %v, want sql.ErrNoRows", id, err)
+		}
+	}
+}
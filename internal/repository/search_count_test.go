@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestSearchCountOnlySkipsMainQuery(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+
+	// Only the count is expected; any other query fails the search
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l WHERE`).
+		WithArgs("coffee").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+
+	result, err := repo.Search(context.Background(), domain.ListingSearchParams{Query: "coffee", Page: 3, PerPage: 0})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if result.Total != 42 || result.Page != 1 || result.PerPage != 0 || result.TotalPages != 0 {
+		t.Errorf("result = total %d page %d per_page %d total_pages %d; want 42 1 0 0",
+			result.Total, result.Page, result.PerPage, result.TotalPages)
+	}
+	if result.Listings == nil || len(result.Listings) != 0 {
+		t.Errorf("Listings = %v, want empty", result.Listings)
+	}
+}
+
+func TestSearchClampsPerPage(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxRows int
+		perPage int
+		want    int
+	}{
+		{"default cap", 0, 100000, DefaultMaxRows},
+		{"configured cap", 250, 100000, 250},
+		{"under the cap", 250, 50, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+			repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+			if tt.maxRows > 0 {
+				repo.SetMaxRows(tt.maxRows)
+			}
+
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l WHERE`).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(300000))
+			mock.ExpectQuery(`LIMIT \$1 OFFSET \$2`).
+				WithArgs(tt.want, tt.want).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			result, err := repo.Search(context.Background(), domain.ListingSearchParams{Page: 2, PerPage: tt.perPage})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if result.PerPage != tt.want || result.TotalPages != (300000+tt.want-1)/tt.want {
+				t.Errorf("per_page %d total_pages %d; want per_page %d", result.PerPage, result.TotalPages, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRandomBindsSeed(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+
+	// The seed is only bound to the main query, after the search's own args
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l WHERE`).
+		WithArgs("coffee").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(30))
+	mock.ExpectQuery(regexp.QuoteMeta(`ORDER BY md5(l.id::text || $2), l.id DESC
+		LIMIT $3 OFFSET $4`)).
+		WithArgs("coffee", "homepage", 10, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	result, err := repo.Search(context.Background(), domain.ListingSearchParams{
+		Query: "coffee", Sort: SortRandom, Seed: "homepage", Page: 2, PerPage: 10,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if result.Sort != SortRandom || result.Seed != "homepage" {
+		t.Errorf("sort %q seed %q, want random with seed homepage", result.Sort, result.Seed)
+	}
+}
+
+func TestSearchTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		matchAll bool
+		op       string
+	}{
+		{"any", false, "&&"},
+		{"all", true, "@>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+			repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM listings l WHERE .* AND l.tags ` + regexp.QuoteMeta(tt.op) + ` \$1::text\[\]`).
+				WithArgs(`{"home-based","turnkey"}`).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+			// The tags facet counts each tag, without the tags filter
+			mock.ExpectQuery(`SELECT t.tag AS value, t.tag AS label, COUNT\(\*\) AS count\s+FROM listings l CROSS JOIN LATERAL unnest\(l.tags\) AS t\(tag\)\s+WHERE .*\(l.tags ` + regexp.QuoteMeta(tt.op) + ` \$1::text\[\] OR true\)`).
+				WithArgs(`{"home-based","turnkey"}`).
+				WillReturnRows(sqlmock.NewRows([]string{"value", "label", "count"}).AddRow("home-based", "home-based", 5))
+
+			result, err := repo.Search(context.Background(), domain.ListingSearchParams{
+				Tags:         []string{"home-based", "turnkey"},
+				TagsMatchAll: tt.matchAll,
+				Facets:       []string{"tags"},
+			})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if tags := result.Facets["tags"]; len(tags) != 1 || tags[0].Count != 5 {
+				t.Errorf("tags facet = %v, want home-based=5", tags)
+			}
+		})
+	}
+}
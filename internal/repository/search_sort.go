@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSort is returned by Search for an unknown nulls option or one the
+// sort doesn't support
+var ErrInvalidSort = errors.New("invalid sort")
+
+// SearchSort orders Search results by a listings column, with the listing ID
+// as a tiebreaker
+type SearchSort struct {
+	Column string
+	Desc   bool
+	// FeaturedFirst lists featured listings ahead of the rest
+	FeaturedFirst bool
+}
+
+// DefaultSearchSort is the sort used when neither the request nor
+// ConfigureSorts picks one
+const DefaultSearchSort = "last_seen"
+
+// SortRandom shuffles results by a hash of each listing's ID and a seed, by
+// default today's UTC date, so the order holds for a day and pages with the
+// same seed never overlap. It can't be made the default sort.
+const SortRandom = "random"
+
+// maxSeedLength caps the seed of a random sort
+const maxSeedLength = 64
+
+// Placement of listings without a value for nullable sorts
+const (
+	NullsFirst = "first"
+	NullsLast  = "last"
+)
+
+// builtinSearchSorts are the sorts Search always accepts
+var builtinSearchSorts = map[string]SearchSort{
+	"last_seen":  {Column: "last_seen_at", Desc: true, FeaturedFirst: true},
+	"price_asc":  {Column: "asking_price"},
+	"price_desc": {Column: "asking_price", Desc: true},
+	"newest":     {Column: "first_seen_at", Desc: true},
+	"score_desc": {Column: "financial_score", Desc: true},
+}
+
+// sortableColumns are the columns a sort may use, mapped to whether the column
+// is nullable and so accepts nulls=first|last
+var sortableColumns = map[string]bool{
+	"asking_price":     true,
+	"revenue":          true,
+	"cash_flow":        true,
+	"ebitda":           true,
+	"year_established": true,
+	"employees":        true,
+	"financial_score":  true,
+	"first_seen_at":    false,
+	"last_seen_at":     false,
+}
+
+// searchSorts is the sort allowlist of a ListingRepository
+type searchSorts struct {
+	sorts       map[string]SearchSort
+	defaultSort string
+}
+
+func newSearchSorts() searchSorts {
+	sorts := make(map[string]SearchSort, len(builtinSearchSorts))
+	for name, s := range builtinSearchSorts {
+		sorts[name] = s
+	}
+	return searchSorts{sorts: sorts, defaultSort: DefaultSearchSort}
+}
+
+// searchOrder is the resolved ordering of a search
+type searchOrder struct {
+	sort    string
+	nulls   string
+	orderBy string
+	// random orders by the seed, bound as a query argument, instead of orderBy
+	random bool
+}
+
+// resolve picks the named sort, or the default for an empty or unknown name,
+// and builds its ORDER BY. Nullable sorts put nulls last unless asked otherwise.
+func (s searchSorts) resolve(name, nulls string) (searchOrder, error) {
+	if name == SortRandom {
+		if nulls != "" {
+			return searchOrder{}, fmt.Errorf("%w: nulls only applies to price and financial sorts, not %s", ErrInvalidSort, name)
+		}
+		return searchOrder{sort: name, random: true}, nil
+	}
+
+	sortSpec, ok := s.sorts[name]
+	if !ok {
+		name = s.defaultSort
+		sortSpec = s.sorts[name]
+	}
+
+	nullable := sortableColumns[sortSpec.Column]
+	switch {
+	case nulls != "" && nulls != NullsFirst && nulls != NullsLast:
+		return searchOrder{}, fmt.Errorf("%w: nulls must be %q or %q", ErrInvalidSort, NullsFirst, NullsLast)
+	case nulls != "" && !nullable:
+		return searchOrder{}, fmt.Errorf("%w: nulls only applies to price and financial sorts, not %s", ErrInvalidSort, name)
+	case nulls == "" && nullable:
+		nulls = NullsLast
+	}
+
+	var order []string
+	if sortSpec.FeaturedFirst {
+		order = append(order, "l.is_featured DESC")
+	}
+	column := "l." + sortSpec.Column
+	if sortSpec.Desc {
+		column += " DESC"
+	} else {
+		column += " ASC"
+	}
+	if nulls != "" {
+		column += " NULLS " + strings.ToUpper(nulls)
+	}
+	order = append(order, column, "l.id DESC")
+
+	return searchOrder{sort: name, nulls: nulls, orderBy: strings.Join(order, ", ")}, nil
+}
+
+// randomOrderBy orders by the hash of each ID and the seed bound to
+// placeholder argIdx, with the ID as a tiebreaker for the odd collision
+func randomOrderBy(argIdx int) string {
+	return fmt.Sprintf("md5(l.id::text || $%d), l.id DESC", argIdx)
+}
+
+// searchSeed is the seed a random sort uses: seed if set, otherwise now's UTC
+// date
+func searchSeed(seed string, now time.Time) (string, error) {
+	if len(seed) > maxSeedLength {
+		return "", fmt.Errorf("%w: seed is longer than %d characters", ErrInvalidSort, maxSeedLength)
+	}
+	if seed == "" {
+		seed = now.UTC().Format(time.DateOnly)
+	}
+	return seed, nil
+}
+
+// ConfigureSorts adds sorts to Search's allowlist, replacing built-in ones of
+// the same name, and sets the sort used when a search names none. An empty
+// defaultSort keeps DefaultSearchSort.
+func (r *ListingRepository) ConfigureSorts(defaultSort string, extra map[string]SearchSort) error {
+	sorts, err := buildSearchSorts(defaultSort, extra)
+	if err != nil {
+		return err
+	}
+	r.sorts = sorts
+	return nil
+}
+
+// ValidateSorts reports the error ConfigureSorts would return for these sorts
+func ValidateSorts(defaultSort string, extra map[string]SearchSort) error {
+	_, err := buildSearchSorts(defaultSort, extra)
+	return err
+}
+
+func buildSearchSorts(defaultSort string, extra map[string]SearchSort) (searchSorts, error) {
+	sorts := newSearchSorts()
+	for name, s := range extra {
+		if name == SortRandom {
+			return searchSorts{}, fmt.Errorf("sort %s: the name is reserved", name)
+		}
+		if _, ok := sortableColumns[s.Column]; !ok {
+			return searchSorts{}, fmt.Errorf("sort %s: column %q is not sortable", name, s.Column)
+		}
+		sorts.sorts[name] = s
+	}
+
+	if defaultSort != "" {
+		if _, ok := sorts.sorts[defaultSort]; !ok {
+			return searchSorts{}, fmt.Errorf("default sort %q is not a known sort (%s)", defaultSort, strings.Join(sorts.names(), ", "))
+		}
+		sorts.defaultSort = defaultSort
+	}
+	return sorts, nil
+}
+
+func (s searchSorts) names() []string {
+	names := make([]string, 0, len(s.sorts))
+	for name := range s.sorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SortOption is a sort Search accepts, as advertised to clients
+type SortOption struct {
+	Name string `json:"name"`
+	// Nullable sorts accept nulls=first|last
+	Nullable bool `json:"nullable"`
+}
+
+// SortOptions returns the sorts Search accepts by name, random included
+func (r *ListingRepository) SortOptions() []SortOption {
+	names := r.sorts.names()
+	options := make([]SortOption, 0, len(names)+1)
+	for _, name := range names {
+		options = append(options, SortOption{Name: name, Nullable: sortableColumns[r.sorts.sorts[name].Column]})
+	}
+	return append(options, SortOption{Name: SortRandom})
+}
+
+// DefaultSort returns the sort Search uses when the search names none
+func (r *ListingRepository) DefaultSort() string {
+	return r.sorts.defaultSort
+}
+
+// ParseSearchSorts parses comma-separated name:column:asc|desc sort definitions,
+// e.g. "revenue_desc:revenue:desc,cash_flow_desc:cash_flow:desc"
+func ParseSearchSorts(spec string) (map[string]SearchSort, error) {
+	sorts := make(map[string]SearchSort)
+	for _, def := range strings.Split(spec, ",") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+
+		parts := strings.Split(def, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("sort %q: want name:column:asc|desc", def)
+		}
+		name, column, direction := parts[0], parts[1], strings.ToLower(parts[2])
+		if _, ok := sortableColumns[column]; !ok {
+			return nil, fmt.Errorf("sort %s: column %q is not sortable", name, column)
+		}
+		if direction != "asc" && direction != "desc" {
+			return nil, fmt.Errorf("sort %s: direction must be asc or desc, got %q", name, parts[2])
+		}
+		sorts[name] = SearchSort{Column: column, Desc: direction == "desc"}
+	}
+	return sorts, nil
+}
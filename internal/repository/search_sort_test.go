@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchOrderBy(t *testing.T) {
+	sorts := newSearchSorts()
+
+	tests := []struct {
+		sort, nulls string
+		wantSort    string
+		wantNulls   string
+		want        string
+	}{
+		{"", "", "last_seen", "", "l.is_featured DESC, l.last_seen_at DESC, l.id DESC"},
+		{"bogus", "", "last_seen", "", "l.is_featured DESC, l.last_seen_at DESC, l.id DESC"},
+		{"newest", "", "newest", "", "l.first_seen_at DESC, l.id DESC"},
+		{"price_asc", "", "price_asc", "last", "l.asking_price ASC NULLS LAST, l.id DESC"},
+		{"price_asc", "first", "price_asc", "first", "l.asking_price ASC NULLS FIRST, l.id DESC"},
+		{"price_desc", "last", "price_desc", "last", "l.asking_price DESC NULLS LAST, l.id DESC"},
+		{"price_desc", "first", "price_desc", "first", "l.asking_price DESC NULLS FIRST, l.id DESC"},
+		{"score_desc", "", "score_desc", "last", "l.financial_score DESC NULLS LAST, l.id DESC"},
+	}
+
+	for _, tt := range tests {
+		got, err := sorts.resolve(tt.sort, tt.nulls)
+		if err != nil {
+			t.Errorf("resolve(%q, %q) error: %v", tt.sort, tt.nulls, err)
+			continue
+		}
+		if got.orderBy != tt.want || got.sort != tt.wantSort || got.nulls != tt.wantNulls {
+			t.Errorf("resolve(%q, %q) = %+v, want %q with sort %q nulls %q", tt.sort, tt.nulls, got, tt.want, tt.wantSort, tt.wantNulls)
+		}
+	}
+}
+
+func TestSearchOrderByRejectsInvalidNulls(t *testing.T) {
+	sorts := newSearchSorts()
+
+	for _, tt := range []struct{ sort, nulls string }{
+		{"price_asc", "middle"},
+		{"newest", "first"},
+		{"", "last"},
+	} {
+		if _, err := sorts.resolve(tt.sort, tt.nulls); !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("resolve(%q, %q) error = %v, want ErrInvalidSort", tt.sort, tt.nulls, err)
+		}
+	}
+}
+
+func TestConfigureSorts(t *testing.T) {
+	repo := NewListingRepository(nil)
+
+	extra, err := ParseSearchSorts("revenue_desc:revenue:desc, cash_flow_asc:cash_flow:ASC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]SearchSort{
+		"revenue_desc":  {Column: "revenue", Desc: true},
+		"cash_flow_asc": {Column: "cash_flow"},
+	}
+	if !reflect.DeepEqual(extra, want) {
+		t.Fatalf("ParseSearchSorts = %v, want %v", extra, want)
+	}
+
+	if err := repo.ConfigureSorts("revenue_desc", extra); err != nil {
+		t.Fatalf("ConfigureSorts failed: %v", err)
+	}
+	got, err := repo.sorts.resolve("", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.sort != "revenue_desc" || got.orderBy != "l.revenue DESC NULLS FIRST, l.id DESC" {
+		t.Errorf("default sort = %+v, want revenue_desc with nulls first", got)
+	}
+
+	if err := repo.ConfigureSorts("unknown", nil); err == nil {
+		t.Error("ConfigureSorts accepted an unknown default sort")
+	}
+	if err := repo.ConfigureSorts("", map[string]SearchSort{"x": {Column: "title; DROP TABLE listings"}}); err == nil {
+		t.Error("ConfigureSorts accepted an unsortable column")
+	}
+	if err := repo.ConfigureSorts(SortRandom, nil); err == nil {
+		t.Error("ConfigureSorts made random the default sort")
+	}
+	if err := repo.ConfigureSorts("", map[string]SearchSort{SortRandom: {Column: "revenue"}}); err == nil {
+		t.Error("ConfigureSorts replaced the random sort")
+	}
+}
+
+func TestSearchOrderRandom(t *testing.T) {
+	sorts := newSearchSorts()
+	got, err := sorts.resolve(SortRandom, "")
+	if err != nil || !got.random || got.sort != SortRandom {
+		t.Errorf("resolve(random) = %+v, %v", got, err)
+	}
+	if _, err := sorts.resolve(SortRandom, "last"); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("resolve(random, last) error = %v, want ErrInvalidSort", err)
+	}
+
+	now := time.Date(2026, 3, 9, 23, 30, 0, 0, time.FixedZone("CST", -6*3600))
+	if seed, err := searchSeed("", now); err != nil || seed != "2026-03-10" {
+		t.Errorf("default seed = %q, %v; want the UTC date 2026-03-10", seed, err)
+	}
+	if seed, err := searchSeed("homepage-a", now); err != nil || seed != "homepage-a" {
+		t.Errorf("explicit seed = %q, %v", seed, err)
+	}
+	if _, err := searchSeed(strings.Repeat("x", maxSeedLength+1), now); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("long seed error = %v, want ErrInvalidSort", err)
+	}
+}
+
+func TestParseSearchSortsInvalid(t *testing.T) {
+	for _, spec := range []string{"revenue", "r:revenue", "r:title:asc", "r:revenue:up", ":revenue:asc"} {
+		if _, err := ParseSearchSorts(spec); err == nil {
+			t.Errorf("ParseSearchSorts(%q) succeeded, want an error", spec)
+		}
+	}
+}
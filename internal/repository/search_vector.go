@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// searchVectorExpr builds a listing's search_vector from its own columns, as
+// UpsertBatch does from the listing it writes: title, the full description
+// kept in raw_data or the description, and industry
+const searchVectorExpr = `to_tsvector('english', COALESCE(title, '') || ' ' || COALESCE(raw_data->>'` + fullDescriptionKey + `', description, '') || ' ' || COALESCE(industry, ''))`
+
+// BackfillSearchVector builds the search_vector of up to batchSize listings
+// that have none, e.g. ones written by a path that didn't build it, and
+// returns how many it updated. Call it until it returns 0.
+func (r *ListingRepository) BackfillSearchVector(ctx context.Context, batchSize int) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE listings SET search_vector = `+searchVectorExpr+`
+		WHERE id IN (SELECT id FROM listings WHERE search_vector IS NULL LIMIT $1)
+	`, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("backfilling search vectors: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RebuildSearchVector rebuilds the search_vector of the batchSize listings
+// after the one with ID after, in ID order, whether or not they have one. It
+// returns the last ID it updated, to pass as after for the next batch, and how
+// many it updated; start with uuid.Nil and stop at 0.
+func (r *ListingRepository) RebuildSearchVector(ctx context.Context, after uuid.UUID, batchSize int) (uuid.UUID, int64, error) {
+	var ids []uuid.UUID
+	err := r.db.SelectContext(ctx, &ids, `
+		WITH batch AS (SELECT id FROM listings WHERE id > $1 ORDER BY id LIMIT $2)
+		UPDATE listings SET search_vector = `+searchVectorExpr+`
+		FROM batch WHERE listings.id = batch.id
+		RETURNING listings.id
+	`, after, batchSize)
+	if err != nil {
+		return after, 0, fmt.Errorf("rebuilding search vectors: %w", err)
+	}
+
+	// Postgres orders UUIDs bytewise, as bytes.Compare does
+	last := after
+	for _, id := range ids {
+		if bytes.Compare(id[:], last[:]) > 0 {
+			last = id
+		}
+	}
+	return last, int64(len(ids)), nil
+}
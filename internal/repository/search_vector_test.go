@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestBackfillSearchVectorMakesListingFindable(t *testing.T) {
+	db := openTestDB(t)
+	source := createTestSource(t, db)
+	repo := NewListingRepository(db)
+	ctx := context.Background()
+
+	listing := newTestListing(source, "backfill-1")
+	listing.Title = "Quixotic Kombucha Brewery"
+	if err := repo.Upsert(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+	// As written by a path that didn't build it
+	if _, err := db.ExecContext(ctx, `UPDATE listings SET search_vector = NULL WHERE id = $1`, listing.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func() int {
+		t.Helper()
+		result, err := repo.Search(ctx, domain.ListingSearchParams{Query: "kombucha", SourceID: &source.ID, Page: 1, PerPage: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(result.Listings)
+	}
+	if n := search(); n != 0 {
+		t.Fatalf("found %d listings without a search vector, want 0", n)
+	}
+
+	var total int64
+	for {
+		n, err := repo.BackfillSearchVector(ctx, 100)
+		if err != nil {
+			t.Fatalf("BackfillSearchVector failed: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+	}
+	if total < 1 {
+		t.Errorf("backfilled %d listings, want at least 1", total)
+	}
+	if n := search(); n != 1 {
+		t.Errorf("found %d listings after the backfill, want 1", n)
+	}
+}
+
+func TestRebuildSearchVectorReturnsLastID(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+
+	after := uuid.MustParse("10000000-0000-0000-0000-000000000000")
+	ids := []string{
+		"30000000-0000-0000-0000-000000000000",
+		"20000000-0000-0000-0000-000000000000",
+		"f0000000-0000-0000-0000-000000000000",
+	}
+	rows := sqlmock.NewRows([]string{"id"})
+	for _, id := range ids {
+		rows.AddRow(id)
+	}
+	mock.ExpectQuery(`WITH batch AS \(SELECT id FROM listings WHERE id > \$1 ORDER BY id LIMIT \$2\)`).
+		WithArgs(after, 3).WillReturnRows(rows)
+
+	last, n, err := repo.RebuildSearchVector(context.Background(), after, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || last.String() != ids[2] {
+		t.Errorf("RebuildSearchVector = %s, %d; want %s, 3", last, n, ids[2])
+	}
+
+	// An empty batch ends the rebuild where it was
+	mock.ExpectQuery(`WITH batch AS`).WithArgs(last, 3).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if next, n, err := repo.RebuildSearchVector(context.Background(), last, 3); err != nil || n != 0 || next != last {
+		t.Errorf("RebuildSearchVector at the end = %s, %d, %v; want %s, 0, nil", next, n, err, last)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,6 +2,12 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -44,25 +50,197 @@ func (r *SourceRepository) ListActive(ctx context.Context) ([]domain.Source, err
 	return sources, nil
 }
 
-func (r *SourceRepository) Create(ctx context.Context, source *domain.Source) error {
+// SourceUpsertOutcome is what Upsert did with a source
+type SourceUpsertOutcome string
+
+const (
+	SourceCreated   SourceUpsertOutcome = "created"
+	SourceUpdated   SourceUpsertOutcome = "updated"
+	SourceUnchanged SourceUpsertOutcome = "unchanged"
+)
+
+// Upsert inserts a source, or updates the name, base_url and scraper_type of
+// the one with its slug and merges source.Config's keys into its config, so
+// keys set by hand that source.Config lacks are kept. An existing source
+// keeps its ID, is_active and created_at, and its updated_at moves only if
+// something changed; source is filled in with the stored row. A config that
+// doesn't parse is refused so a bad key is caught when the source is added
+// rather than on its first scrape.
+func (r *SourceRepository) Upsert(ctx context.Context, source *domain.Source) (SourceUpsertOutcome, error) {
+	if _, err := domain.ParseSourceConfig(source.Config); err != nil {
+		return "", fmt.Errorf("source %s: %w", source.Slug, err)
+	}
+
 	query := `
 		INSERT INTO sources (id, name, slug, base_url, scraper_type, is_active, config, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (slug) DO UPDATE SET
+			name = EXCLUDED.name,
+			base_url = EXCLUDED.base_url,
+			scraper_type = EXCLUDED.scraper_type,
+			config = COALESCE(sources.config, '{}') || EXCLUDED.config,
+			updated_at = EXCLUDED.updated_at
+		WHERE (sources.name, sources.base_url, sources.scraper_type, sources.config)
+			IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.base_url, EXCLUDED.scraper_type, COALESCE(sources.config, '{}') || EXCLUDED.config)
+		-- xmax is 0 on a freshly inserted row
+		RETURNING *, xmax = 0 AS inserted
 	`
-	_, err := r.db.ExecContext(ctx, query,
+	var stored struct {
+		domain.Source
+		Inserted bool `db:"inserted"`
+	}
+	err := r.db.GetContext(ctx, &stored, query,
 		source.ID, source.Name, source.Slug, source.BaseURL,
 		source.ScraperType, source.IsActive, source.Config,
 		source.CreatedAt, source.UpdatedAt,
 	)
-	return err
+	if errors.Is(err, sql.ErrNoRows) {
+		// The source exists as given, so the update was skipped
+		existing, err := r.GetBySlug(ctx, source.Slug)
+		if err != nil {
+			return "", err
+		}
+		*source = *existing
+		return SourceUnchanged, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	*source = stored.Source
+	if stored.Inserted {
+		return SourceCreated, nil
+	}
+	return SourceUpdated, nil
+}
+
+// scrapeLockKey derives a source's advisory lock key from its ID
+const scrapeLockKey = `hashtext('scrape_source:' || $1)`
+
+// TryLockSource takes the session advisory lock that keeps one scrape per source
+// running across all processes. ok is false if another run holds it. Otherwise
+// the lock lives on a dedicated connection until unlock is called.
+func (r *SourceRepository) TryLockSource(ctx context.Context, sourceID uuid.UUID) (unlock func(), ok bool, err error) {
+	conn, err := r.db.Connx(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := conn.GetContext(ctx, &ok, `SELECT pg_try_advisory_lock(`+scrapeLockKey+`)`, sourceID.String()); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock = func() {
+		// Unlock even if the run's context was cancelled
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(`+scrapeLockKey+`)`, sourceID.String())
+		if err != nil {
+			// Don't return a session still holding the lock to the pool
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+	return unlock, true, nil
+}
+
+// budgetDay is the UTC day request budgets are counted against
+const budgetDay = `(NOW() AT TIME ZONE 'UTC')::date`
+
+// RequestBudgetUsed returns how many requests have been made to a source today
+func (r *SourceRepository) RequestBudgetUsed(ctx context.Context, sourceID uuid.UUID) (int, error) {
+	var used int
+	err := r.db.GetContext(ctx, &used, `
+		SELECT COALESCE(SUM(requests), 0) FROM scrape_budget
+		WHERE source_id = $1 AND day = `+budgetDay, sourceID)
+	return used, err
+}
+
+// SpendRequestBudget counts one request against a source's budget for today,
+// unless limit requests have already been made. ok is false if the budget is
+// spent; used is today's count after the request.
+func (r *SourceRepository) SpendRequestBudget(ctx context.Context, sourceID uuid.UUID, limit int) (used int, ok bool, err error) {
+	err = r.db.GetContext(ctx, &used, `
+		INSERT INTO scrape_budget (source_id, day, requests)
+		VALUES ($1, `+budgetDay+`, 1)
+		ON CONFLICT (source_id, day) DO UPDATE SET requests = scrape_budget.requests + 1
+		WHERE scrape_budget.requests < $2
+		RETURNING requests
+	`, sourceID, limit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return limit, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return used, true, nil
+}
+
+// ListRequestBudgetUsage returns today's request count for each source that made any
+func (r *SourceRepository) ListRequestBudgetUsage(ctx context.Context) (map[uuid.UUID]int, error) {
+	var rows []struct {
+		SourceID uuid.UUID `db:"source_id"`
+		Requests int       `db:"requests"`
+	}
+	err := r.db.SelectContext(ctx, &rows, `SELECT source_id, requests FROM scrape_budget WHERE day = `+budgetDay)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		usage[row.SourceID] = row.Requests
+	}
+	return usage, nil
+}
+
+// RecordScrapeOutcome counts a finished run towards the source's quarantine.
+// A blocked run adds to its consecutive blocks and, at threshold or more,
+// quarantines it for cooldown; an unblocked run resets both. It returns the
+// source's consecutive blocks and quarantine end afterwards.
+func (r *SourceRepository) RecordScrapeOutcome(ctx context.Context, sourceID uuid.UUID, blocked bool, threshold int, cooldown time.Duration) (blocks int, quarantinedUntil *time.Time, err error) {
+	row := r.db.QueryRowxContext(ctx, `
+		UPDATE sources SET
+			consecutive_blocks = CASE WHEN $2 THEN consecutive_blocks + 1 ELSE 0 END,
+			quarantined_until = CASE
+				WHEN NOT $2 THEN NULL
+				WHEN consecutive_blocks + 1 >= $3 THEN NOW() + make_interval(secs => $4)
+				ELSE quarantined_until
+			END
+		WHERE id = $1
+		RETURNING consecutive_blocks, quarantined_until
+	`, sourceID, blocked, threshold, cooldown.Seconds())
+	err = row.Scan(&blocks, &quarantinedUntil)
+	return blocks, quarantinedUntil, err
+}
+
+// ClearQuarantine lifts a source's quarantine and resets its consecutive
+// blocks. It returns sql.ErrNoRows if no source has the slug.
+func (r *SourceRepository) ClearQuarantine(ctx context.Context, slug string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE sources SET consecutive_blocks = 0, quarantined_until = NULL WHERE slug = $1
+	`, slug)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func (r *SourceRepository) CreateScrapeJob(ctx context.Context, job *domain.ScrapeJob) error {
 	query := `
-		INSERT INTO scrape_jobs (id, source_id, status, created_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO scrape_jobs (id, source_id, status, trigger, created_at)
+		VALUES ($1, $2, $3, $4, $5)
 	`
-	_, err := r.db.ExecContext(ctx, query, job.ID, job.SourceID, job.Status, job.CreatedAt)
+	_, err := r.db.ExecContext(ctx, query, job.ID, job.SourceID, job.Status, job.Trigger, job.CreatedAt)
 	return err
 }
 
@@ -75,28 +253,111 @@ func (r *SourceRepository) UpdateScrapeJob(ctx context.Context, job *domain.Scra
 			listings_found = $5,
 			listings_new = $6,
 			listings_updated = $7,
-			error_message = $8
+			error_message = $8,
+			fallback_used = $9
 		WHERE id = $1
 	`
 	_, err := r.db.ExecContext(ctx, query,
 		job.ID, job.Status, job.StartedAt, job.CompletedAt,
 		job.ListingsFound, job.ListingsNew, job.ListingsUpdated,
-		job.ErrorMessage,
+		job.ErrorMessage, job.FallbackUsed,
 	)
 	return err
 }
 
-func (r *SourceRepository) GetRecentScrapeJobs(ctx context.Context, limit int) ([]domain.ScrapeJob, error) {
-	var jobs []domain.ScrapeJob
+// GetRecentScrapeJobs returns the latest scrape jobs, newest first, only
+// those with the given trigger unless it is empty
+func (r *SourceRepository) GetRecentScrapeJobs(ctx context.Context, trigger string, limit int) ([]domain.ScrapeJob, error) {
+	jobs := []domain.ScrapeJob{}
 	err := r.db.SelectContext(ctx, &jobs, `
-		SELECT sj.*, s.name as source_name
-		FROM scrape_jobs sj
-		JOIN sources s ON s.id = sj.source_id
-		ORDER BY sj.created_at DESC
-		LIMIT $1
-	`, limit)
+		SELECT * FROM scrape_jobs
+		WHERE $1 = '' OR trigger = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, trigger, limit)
 	if err != nil {
 		return nil, err
 	}
 	return jobs, nil
 }
+
+// LatestScrapeJobs returns the most recent scrape job of each source, keyed by source ID
+func (r *SourceRepository) LatestScrapeJobs(ctx context.Context) (map[uuid.UUID]domain.ScrapeJob, error) {
+	var jobs []domain.ScrapeJob
+	err := r.db.SelectContext(ctx, &jobs, `
+		SELECT DISTINCT ON (source_id) *
+		FROM scrape_jobs
+		ORDER BY source_id, created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[uuid.UUID]domain.ScrapeJob, len(jobs))
+	for _, job := range jobs {
+		latest[job.SourceID] = job
+	}
+	return latest, nil
+}
+
+// LastSuccessfulScrapes returns when each source's latest completed scrape
+// job finished, keyed by slug. Sources that never completed one are left out.
+func (r *SourceRepository) LastSuccessfulScrapes(ctx context.Context) (map[string]time.Time, error) {
+	var rows []struct {
+		Slug        string    `db:"slug"`
+		CompletedAt time.Time `db:"completed_at"`
+	}
+	err := r.db.SelectContext(ctx, &rows, `
+		SELECT DISTINCT ON (j.source_id) s.slug, j.completed_at
+		FROM scrape_jobs j
+		JOIN sources s ON s.id = j.source_id
+		WHERE j.status = $1 AND j.completed_at IS NOT NULL
+		ORDER BY j.source_id, j.completed_at DESC
+	`, domain.ScrapeJobStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+
+	last := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		last[row.Slug] = row.CompletedAt
+	}
+	return last, nil
+}
+
+// InsertScrapeJobRequests records pages fetched by a scrape job in a single statement
+func (r *SourceRepository) InsertScrapeJobRequests(ctx context.Context, requests []domain.ScrapeJobRequest) error {
+	if len(requests) == 0 {
+		return nil
+	}
+
+	rows := make([]string, len(requests))
+	args := make([]interface{}, 0, len(requests)*5)
+	for i, req := range requests {
+		base := i * 5
+		rows[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", base+1, base+2, base+3, base+4, base+5)
+		args = append(args, req.JobID, req.URL, req.Status, req.Error, req.FetchedAt)
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO scrape_job_requests (job_id, url, status, error, fetched_at)
+		VALUES %s
+	`, strings.Join(rows, ", "))
+	_, err := r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetScrapeJobRequests returns the pages fetched by a scrape job in fetch order
+func (r *SourceRepository) GetScrapeJobRequests(ctx context.Context, jobID uuid.UUID) ([]domain.ScrapeJobRequest, error) {
+	requests := []domain.ScrapeJobRequest{}
+	err := r.db.SelectContext(ctx, &requests, `
+		SELECT job_id, url, status, error, fetched_at
+		FROM scrape_job_requests
+		WHERE job_id = $1
+		ORDER BY fetched_at, id
+	`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestTryLockSource(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewSourceRepository(db)
+	ctx := context.Background()
+	sourceID := uuid.New()
+
+	unlock, ok, err := repo.TryLockSource(ctx, sourceID)
+	if err != nil {
+		t.Fatalf("TryLockSource failed: %v", err)
+	}
+	if !ok {
+		t.Fatal("first lock was not acquired")
+	}
+
+	// The lock is per session, so a second attempt from another connection fails
+	if _, ok, err := repo.TryLockSource(ctx, sourceID); err != nil || ok {
+		t.Fatalf("second lock = %v, %v; want not acquired", ok, err)
+	}
+
+	// Other sources aren't affected
+	otherUnlock, ok, err := repo.TryLockSource(ctx, uuid.New())
+	if err != nil || !ok {
+		t.Fatalf("lock on another source = %v, %v; want acquired", ok, err)
+	}
+	otherUnlock()
+
+	unlock()
+	unlock, ok, err = repo.TryLockSource(ctx, sourceID)
+	if err != nil || !ok {
+		t.Fatalf("lock after unlock = %v, %v; want acquired", ok, err)
+	}
+	unlock()
+}
+
+func TestSpendRequestBudget(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewSourceRepository(db)
+	ctx := context.Background()
+	source := createTestSource(t, db)
+
+	for i := 1; i <= 2; i++ {
+		used, ok, err := repo.SpendRequestBudget(ctx, source.ID, 2)
+		if err != nil {
+			t.Fatalf("SpendRequestBudget failed: %v", err)
+		}
+		if !ok || used != i {
+			t.Errorf("request %d: used = %d, ok = %v; want %d, true", i, used, ok, i)
+		}
+	}
+
+	if _, ok, err := repo.SpendRequestBudget(ctx, source.ID, 2); err != nil || ok {
+		t.Errorf("request over budget: ok = %v, err = %v; want refused", ok, err)
+	}
+
+	used, err := repo.RequestBudgetUsed(ctx, source.ID)
+	if err != nil {
+		t.Fatalf("RequestBudgetUsed failed: %v", err)
+	}
+	if used != 2 {
+		t.Errorf("used = %d, want 2", used)
+	}
+
+	usage, err := repo.ListRequestBudgetUsage(ctx)
+	if err != nil {
+		t.Fatalf("ListRequestBudgetUsage failed: %v", err)
+	}
+	if usage[source.ID] != 2 {
+		t.Errorf("usage = %d, want 2", usage[source.ID])
+	}
+}
+
+func TestGetRecentScrapeJobsByTrigger(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewSourceRepository(db)
+	ctx := context.Background()
+	source := createTestSource(t, db)
+
+	created := map[string]uuid.UUID{}
+	for _, trigger := range []string{domain.ScrapeTriggerPeriodic, domain.ScrapeTriggerAPI} {
+		job := &domain.ScrapeJob{
+			ID:        uuid.New(),
+			SourceID:  source.ID,
+			Status:    domain.ScrapeJobStatusCompleted,
+			Trigger:   trigger,
+			CreatedAt: time.Now(),
+		}
+		if err := repo.CreateScrapeJob(ctx, job); err != nil {
+			t.Fatalf("CreateScrapeJob failed: %v", err)
+		}
+		created[trigger] = job.ID
+	}
+
+	jobs, err := repo.GetRecentScrapeJobs(ctx, domain.ScrapeTriggerAPI, 100)
+	if err != nil {
+		t.Fatalf("GetRecentScrapeJobs failed: %v", err)
+	}
+	found := false
+	for _, job := range jobs {
+		if job.Trigger != domain.ScrapeTriggerAPI {
+			t.Errorf("job %s has trigger %q, want api", job.ID, job.Trigger)
+		}
+		found = found || job.ID == created[domain.ScrapeTriggerAPI]
+	}
+	if !found {
+		t.Error("the api job was not returned")
+	}
+
+	all, err := repo.GetRecentScrapeJobs(ctx, "", 100)
+	if err != nil {
+		t.Fatalf("GetRecentScrapeJobs failed: %v", err)
+	}
+	if len(all) < 2 {
+		t.Errorf("got %d jobs without a filter, want at least 2", len(all))
+	}
+}
+
+func TestLastSuccessfulScrapes(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewSourceRepository(db)
+	ctx := context.Background()
+	source := createTestSource(t, db)
+
+	succeeded := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	for _, j := range []struct {
+		status      string
+		completedAt time.Time
+	}{
+		{domain.ScrapeJobStatusCompleted, succeeded.Add(-time.Hour)},
+		{domain.ScrapeJobStatusCompleted, succeeded},
+		{domain.ScrapeJobStatusFailed, succeeded.Add(time.Minute)},
+	} {
+		job := &domain.ScrapeJob{ID: uuid.New(), SourceID: source.ID, Status: j.status, Trigger: domain.ScrapeTriggerPeriodic, CreatedAt: j.completedAt}
+		if err := repo.CreateScrapeJob(ctx, job); err != nil {
+			t.Fatalf("CreateScrapeJob failed: %v", err)
+		}
+		job.CompletedAt = &j.completedAt
+		if err := repo.UpdateScrapeJob(ctx, job); err != nil {
+			t.Fatalf("UpdateScrapeJob failed: %v", err)
+		}
+	}
+
+	last, err := repo.LastSuccessfulScrapes(ctx)
+	if err != nil {
+		t.Fatalf("LastSuccessfulScrapes failed: %v", err)
+	}
+	if got := last[source.Slug]; !got.Equal(succeeded) {
+		t.Errorf("last success = %v, want %v, the latest completed job", got, succeeded)
+	}
+}
+
+func TestRecordScrapeOutcomeQuarantines(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewSourceRepository(db)
+	ctx := context.Background()
+	source := createTestSource(t, db)
+
+	for i := 1; i <= 3; i++ {
+		blocks, until, err := repo.RecordScrapeOutcome(ctx, source.ID, true, 3, time.Hour)
+		if err != nil {
+			t.Fatalf("RecordScrapeOutcome failed: %v", err)
+		}
+		if blocks != i || (until != nil) != (i == 3) {
+			t.Errorf("blocked run %d: blocks = %d, quarantined until %v", i, blocks, until)
+		}
+	}
+
+	got, err := repo.GetBySlug(ctx, source.Slug)
+	if err != nil {
+		t.Fatalf("GetBySlug failed: %v", err)
+	}
+	if !got.Quarantined(time.Now()) || got.Quarantined(time.Now().Add(2*time.Hour)) {
+		t.Errorf("quarantined until %v, want about an hour from now", got.QuarantinedUntil)
+	}
+
+	if err := repo.ClearQuarantine(ctx, source.Slug); err != nil {
+		t.Fatalf("ClearQuarantine failed: %v", err)
+	}
+	if got, _ = repo.GetBySlug(ctx, source.Slug); got.QuarantinedUntil != nil || got.ConsecutiveBlocks != 0 {
+		t.Errorf("after clearing: blocks = %d, quarantined until %v", got.ConsecutiveBlocks, got.QuarantinedUntil)
+	}
+
+	// An unblocked run resets the count
+	repo.RecordScrapeOutcome(ctx, source.ID, true, 3, time.Hour)
+	if blocks, _, err := repo.RecordScrapeOutcome(ctx, source.ID, false, 3, time.Hour); err != nil || blocks != 0 {
+		t.Errorf("after an unblocked run: blocks = %d, err = %v; want 0", blocks, err)
+	}
+}
+
+func TestUpsertUpdatesOnConflict(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewSourceRepository(db)
+	ctx := context.Background()
+
+	slug := "seed-" + uuid.New().String()[:8]
+	seed := func(baseURL string) (*domain.Source, SourceUpsertOutcome) {
+		t.Helper()
+		source := &domain.Source{
+			ID: uuid.New(), Name: "Seeded", Slug: slug, BaseURL: baseURL,
+			ScraperType: domain.ScraperTypeColly, IsActive: true, Config: []byte("{}"),
+			CreatedAt: time.Now(), UpdatedAt: time.Now(),
+		}
+		outcome, err := repo.Upsert(ctx, source)
+		if err != nil {
+			t.Fatalf("Upsert failed: %v", err)
+		}
+		return source, outcome
+	}
+	first, outcome := seed("https://old.example.com")
+	t.Cleanup(func() { db.Exec("DELETE FROM sources WHERE id = $1", first.ID) })
+	if outcome != SourceCreated {
+		t.Errorf("first seed = %s, want created", outcome)
+	}
+
+	// A source switched off by hand stays off when it is seeded again
+	if _, err := db.Exec("UPDATE sources SET is_active = false WHERE id = $1", first.ID); err != nil {
+		t.Fatal(err)
+	}
+	second, outcome := seed("https://new.example.com")
+	if outcome != SourceUpdated {
+		t.Errorf("second seed = %s, want updated", outcome)
+	}
+	got, err := repo.GetBySlug(ctx, slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BaseURL != "https://new.example.com" || got.ID != first.ID || got.IsActive {
+		t.Errorf("stored source = %+v, want the new base_url on the same inactive source", got)
+	}
+	if second.ID != first.ID || !second.CreatedAt.Equal(got.CreatedAt) {
+		t.Errorf("Upsert filled in ID %s created %v, want the stored row's", second.ID, second.CreatedAt)
+	}
+
+	if _, outcome := seed("https://new.example.com"); outcome != SourceUnchanged {
+		t.Errorf("third seed = %s, want unchanged", outcome)
+	}
+
+	// Config set by hand survives seeding, which supplies none
+	if _, err := db.Exec(`UPDATE sources SET config = '{"max_requests_per_day": 500}' WHERE id = $1`, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, outcome := seed("https://new.example.com"); outcome != SourceUnchanged {
+		t.Errorf("seed after a config edit = %s, want unchanged", outcome)
+	}
+	got, err = repo.GetBySlug(ctx, slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := domain.ParseSourceConfig(got.Config); err != nil || cfg.MaxRequestsPerDay != 500 {
+		t.Errorf("config = %s, want the edited max_requests_per_day kept", got.Config)
+	}
+}
+
+func TestUpsertRejectsInvalidConfig(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewSourceRepository(sqlx.NewDb(mockDB, "postgres"))
+
+	// No insert is expected
+	source := &domain.Source{ID: uuid.New(), Slug: "typo", Config: []byte(`{"max_request_per_day":500}`)}
+	if _, err := repo.Upsert(context.Background(), source); err == nil || !strings.Contains(err.Error(), "max_request_per_day") {
+		t.Errorf("Upsert = %v, want an error naming the unknown key", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
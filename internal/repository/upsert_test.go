@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestUpsertBatchTouchesUnchanged(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+
+	sourceID := uuid.New()
+	seenAt := time.Date(2024, 5, 10, 15, 0, 0, 0, time.UTC)
+	changed := &domain.Listing{ID: uuid.New(), SourceID: sourceID, ExternalID: "changed", LastSeenAt: seenAt}
+	unchanged := &domain.Listing{ID: uuid.New(), SourceID: sourceID, ExternalID: "unchanged", LastSeenAt: seenAt}
+
+	// The upsert only returns the row it wrote; the other is marked seen
+	mock.ExpectQuery(`INSERT INTO listings .* WHERE listings.content_hash IS DISTINCT FROM EXCLUDED.content_hash`).
+		WillReturnRows(sqlmock.NewRows([]string{"source_id", "external_id"}).AddRow(sourceID, "changed"))
+	mock.ExpectExec(`UPDATE listings l SET last_seen_at = u.last_seen_at`).
+		WithArgs(`{"`+sourceID.String()+`"}`, `{"unchanged"}`, `{"2024-05-10T15:00:00Z"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.UpsertBatch(context.Background(), []*domain.Listing{changed, unchanged}); err != nil {
+		t.Fatalf("UpsertBatch failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	listing := &domain.Listing{ExternalID: "1", Title: "Cafe", AskingPrice: domain.Ptr(int64(100))}
+	hash := contentHash(listing)
+
+	// Seen again later with different raw data: same content
+	again := *listing
+	again.LastSeenAt = time.Now()
+	again.RawData = []byte(`{"html":"..."}`)
+	if contentHash(&again) != hash {
+		t.Error("hash changed with last_seen_at and raw_data")
+	}
+
+	repriced := *listing
+	repriced.AskingPrice = domain.Ptr(int64(90))
+	if contentHash(&repriced) == hash {
+		t.Error("hash unchanged after the asking price changed")
+	}
+}
+
+func TestUpsertBatchLinksFranchises(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	repo := NewListingRepository(sqlx.NewDb(mockDB, "postgres"))
+
+	sourceID := uuid.New()
+	resale := &domain.Listing{ID: uuid.New(), SourceID: sourceID, ExternalID: "resale",
+		IsFranchise: domain.Ptr(true), FranchiseName: domain.StrPtr("Subway Franchise - Dallas, TX")}
+	independent := &domain.Listing{ID: uuid.New(), SourceID: sourceID, ExternalID: "independent",
+		IsFranchise: domain.Ptr(false), FranchiseName: domain.StrPtr("Joe's Diner")}
+
+	mock.ExpectQuery(`INSERT INTO listings`).
+		WillReturnRows(sqlmock.NewRows([]string{"source_id", "external_id"}).
+			AddRow(sourceID, "resale").AddRow(sourceID, "independent"))
+	// Only the franchise resale is grouped
+	mock.ExpectExec(`INSERT INTO franchises \(slug, name\)`).
+		WithArgs(`{"subway"}`, `{"Subway"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE listings l SET franchise_id = f.id`).
+		WithArgs(`{"`+sourceID.String()+`"}`, `{"resale"}`, `{"subway"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.UpsertBatch(context.Background(), []*domain.Listing{resale, independent}); err != nil {
+		t.Fatalf("UpsertBatch failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
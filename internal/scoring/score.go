@@ -0,0 +1,102 @@
+// Package scoring rates listings on the figures they were listed with.
+package scoring
+
+import (
+	"math"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// FinancialScore rates a listing's financials from 0 to 100 as a weighted
+// average of the components it has the figures for:
+//
+//   - yield, cash flow / asking price (weight 40): 0 at 0% or less, 100 at
+//     40% or more, linear in between. A business paying itself back in 2.5
+//     years or less scores full marks.
+//   - revenue multiple, asking price / revenue (weight 20): 100 at 1x or
+//     less, 0 at 3x or more, linear in between
+//   - margin, cash flow / revenue (weight 25): 0 at 0% or less, 100 at 30% or
+//     more, linear in between. A margin above 100% is taken as a data error
+//     and skipped.
+//   - completeness (weight 15): the share of asking price, revenue, cash
+//     flow, EBITDA, year established and employees the listing has
+//
+// The low end of a range is used, and a price or revenue of zero or less is
+// taken as missing. A listing with none of the three ratios has too little to
+// go on and gets nil, not 0, so it doesn't rank below every scored listing.
+func FinancialScore(listing *domain.Listing) *int {
+	price := positive(listing.AskingPrice)
+	revenue := positive(listing.Revenue)
+	cashFlow := listing.CashFlow
+
+	var total, weights float64
+	add := func(score, weight float64) {
+		total += score * weight
+		weights += weight
+	}
+	if price != nil && cashFlow != nil {
+		add(linear(float64(*cashFlow)/float64(*price), 0, 0.40), yieldWeight)
+	}
+	if price != nil && revenue != nil {
+		add(100-linear(float64(*price)/float64(*revenue), 1, 3), multipleWeight)
+	}
+	if revenue != nil && cashFlow != nil {
+		if margin := float64(*cashFlow) / float64(*revenue); margin <= 1 {
+			add(linear(margin, 0, 0.30), marginWeight)
+		}
+	}
+	if weights == 0 {
+		return nil
+	}
+	add(completeness(listing), completenessWeight)
+
+	score := int(math.Round(total / weights))
+	return &score
+}
+
+// Component weights of FinancialScore
+const (
+	yieldWeight        = 40
+	multipleWeight     = 20
+	marginWeight       = 25
+	completenessWeight = 15
+)
+
+// completeness is the percentage of the figures buyers look at first that
+// listing has
+func completeness(listing *domain.Listing) float64 {
+	present := []bool{
+		listing.AskingPrice != nil,
+		listing.Revenue != nil,
+		listing.CashFlow != nil,
+		listing.EBITDA != nil,
+		listing.YearEstablished != nil,
+		listing.Employees != nil,
+	}
+	n := 0
+	for _, p := range present {
+		if p {
+			n++
+		}
+	}
+	return 100 * float64(n) / float64(len(present))
+}
+
+// linear maps v onto 0-100, 0 at or below low and 100 at or above high
+func linear(v, low, high float64) float64 {
+	switch {
+	case v <= low:
+		return 0
+	case v >= high:
+		return 100
+	}
+	return 100 * (v - low) / (high - low)
+}
+
+// positive returns v if it is set and above zero, or nil
+func positive(v *int64) *int64 {
+	if v == nil || *v <= 0 {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,81 @@
+package scoring
+
+import (
+	"testing"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestFinancialScore(t *testing.T) {
+	dollars := func(n int64) *int64 { n *= 100; return &n }
+	year, employees := 2010, 10
+
+	tests := []struct {
+		name    string
+		listing domain.Listing
+		want    *int
+	}{
+		{
+			// yield 30% (75), 0.5x revenue (100), margin 15% (50), 5 of 6 figures
+			name:    "typical cafe",
+			listing: domain.Listing{AskingPrice: dollars(500000), Revenue: dollars(1000000), CashFlow: dollars(150000), YearEstablished: &year, Employees: &employees},
+			want:    domain.Ptr(75),
+		},
+		{
+			name:    "strong on every count",
+			listing: domain.Listing{AskingPrice: dollars(300000), Revenue: dollars(600000), CashFlow: dollars(200000), EBITDA: dollars(180000), YearEstablished: &year, Employees: &employees},
+			want:    domain.Ptr(100),
+		},
+		{
+			// yield 2% (5), 5x revenue (0), margin 10% (33.3), 3 of 6 figures
+			name:    "overpriced",
+			listing: domain.Listing{AskingPrice: dollars(5000000), Revenue: dollars(1000000), CashFlow: dollars(100000)},
+			want:    domain.Ptr(18),
+		},
+		{
+			// yield 20% (50) and 2 of 6 figures, weighted 40:15
+			name:    "price and cash flow only",
+			listing: domain.Listing{AskingPrice: dollars(1000000), CashFlow: dollars(200000)},
+			want:    domain.Ptr(45),
+		},
+		{
+			// yield and margin 0, 0.4x revenue (100), 3 of 6 figures
+			name:    "losing money",
+			listing: domain.Listing{AskingPrice: dollars(200000), Revenue: dollars(500000), CashFlow: dollars(-50000)},
+			want:    domain.Ptr(28),
+		},
+		{
+			// the 300% margin is skipped: yield 30% (75), 10x revenue (0), 3 of 6 figures
+			name:    "cash flow above revenue",
+			listing: domain.Listing{AskingPrice: dollars(1000000), Revenue: dollars(100000), CashFlow: dollars(300000)},
+			want:    domain.Ptr(50),
+		},
+		{name: "nothing", listing: domain.Listing{}},
+		{name: "price only", listing: domain.Listing{AskingPrice: dollars(250000), YearEstablished: &year, Employees: &employees}},
+		{name: "zero price", listing: domain.Listing{AskingPrice: dollars(0), CashFlow: dollars(50000)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FinancialScore(&tt.listing)
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("FinancialScore = %d, want nil", *got)
+			case tt.want != nil && got == nil:
+				t.Errorf("FinancialScore = nil, want %d", *tt.want)
+			case tt.want != nil && *got != *tt.want:
+				t.Errorf("FinancialScore = %d, want %d", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestFinancialScoreRange(t *testing.T) {
+	// Extreme figures stay within 0-100
+	for _, cashFlow := range []int64{-1 << 40, -1, 0, 1, 1 << 40} {
+		price, revenue := int64(100), int64(1)
+		listing := &domain.Listing{AskingPrice: &price, Revenue: &revenue, CashFlow: &cashFlow}
+		if got := FinancialScore(listing); got == nil || *got < 0 || *got > 100 {
+			t.Errorf("cash flow %d: score %v out of range", cashFlow, got)
+		}
+	}
+}
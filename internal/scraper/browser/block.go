@@ -0,0 +1,52 @@
+package browser
+
+import (
+	"regexp"
+	"sync"
+)
+
+// DefaultBlockSignatures match the block and bot-challenge pages seen across
+// sources. They're matched against pages that loaded fine too, so they avoid
+// words an ordinary page contains, like a reCAPTCHA widget or a Cloudflare CDN
+// link, or "blocked" in a listing description.
+var DefaultBlockSignatures = []string{
+	`access denied`,
+	`\bcaptcha\b`,
+	`<title>[^<]*\bblocked\b`,
+	`\b(request|you) (has been|have been|was) blocked\b`,
+	`cf-chl|challenge-platform|cf-browser-verification`,
+	`just a moment`,
+	`attention required`,
+}
+
+// blockPatterns caches compiled signatures, which are reused on every page
+var blockPatterns sync.Map
+
+// DetectBlock reports whether html looks like a block or challenge page and
+// which signature matched. Signatures are case-insensitive regexps; nil sigs
+// means DefaultBlockSignatures. Invalid signatures are skipped; source configs
+// with one are rejected by domain.ParseSourceConfig.
+func DetectBlock(html string, sigs []string) (blocked bool, matched string) {
+	if sigs == nil {
+		sigs = DefaultBlockSignatures
+	}
+	for _, sig := range sigs {
+		re := blockPattern(sig)
+		if re != nil && re.MatchString(html) {
+			return true, sig
+		}
+	}
+	return false, ""
+}
+
+func blockPattern(sig string) *regexp.Regexp {
+	if re, ok := blockPatterns.Load(sig); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile("(?i)" + sig)
+	if err != nil {
+		return nil
+	}
+	blockPatterns.Store(sig, re)
+	return re
+}
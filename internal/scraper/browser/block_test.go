@@ -0,0 +1,72 @@
+package browser
+
+import "testing"
+
+func TestDetectBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		sigs    []string
+		want    bool
+		matched string
+	}{
+		{
+			name:    "cloudflare challenge",
+			html:    `<html><head><title>Just a moment...</title></head><body><div id="challenge-platform"></div></body></html>`,
+			want:    true,
+			matched: `cf-chl|challenge-platform|cf-browser-verification`,
+		},
+		{
+			name:    "akamai access denied",
+			html:    `<html><head><title>Access Denied</title></head><body>You don't have permission to access this server.</body></html>`,
+			want:    true,
+			matched: `access denied`,
+		},
+		{
+			name:    "hcaptcha",
+			html:    `<html><body><p>Please complete the CAPTCHA to continue.</p><div class="h-captcha"></div></body></html>`,
+			want:    true,
+			matched: `\bcaptcha\b`,
+		},
+		{
+			name:    "request blocked",
+			html:    `<html><body><h1>Sorry, your request has been blocked.</h1></body></html>`,
+			want:    true,
+			matched: `\b(request|you) (has been|have been|was) blocked\b`,
+		},
+		{
+			name: "results page with recaptcha and cdn",
+			html: `<html><head><title>Businesses for Sale</title><script src="https://cdnjs.cloudflare.com/x.js"></script></head>
+				<body><div class="listing">Plumbing company, clears blocked drains</div><div class="g-recaptcha"></div></body></html>`,
+			want: false,
+		},
+		{
+			name:    "configured signature",
+			html:    `<html><body><div id="px-captcha-wrapper">Press &amp; Hold</div></body></html>`,
+			sigs:    []string{`press\s*&amp;\s*hold`},
+			want:    true,
+			matched: `press\s*&amp;\s*hold`,
+		},
+		{
+			name: "configured signatures replace defaults",
+			html: `<html><head><title>Just a moment...</title></head></html>`,
+			sigs: []string{`px-captcha`},
+			want: false,
+		},
+		{
+			name: "invalid signature skipped",
+			html: `<html><body>Access Denied</body></html>`,
+			sigs: []string{`(unclosed`, `access denied`},
+			want: true, matched: `access denied`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocked, matched := DetectBlock(tt.html, tt.sigs)
+			if blocked != tt.want || matched != tt.matched {
+				t.Errorf("DetectBlock = %v, %q; want %v, %q", blocked, matched, tt.want, tt.matched)
+			}
+		})
+	}
+}
@@ -1,7 +1,8 @@
 package browser
 
 import (
-	"os"
+	"context"
+	"math/rand/v2"
 	"sync"
 	"time"
 
@@ -13,12 +14,23 @@ import (
 
 // Pool manages a pool of browser instances
 type Pool struct {
-	browser *rod.Browser
-	mu      sync.Mutex
+	browser  *rod.Browser
+	profiles *profileRotation
+	mu       sync.Mutex
+
+	// newPage and closePage open and close the pages handed out by Acquire
+	newPage   func() (*rod.Page, error)
+	closePage func(*rod.Page) error
+	// inUse counts acquired pages; recycleAfter is the navigations a page
+	// serves before Navigate recycles it
+	inUse        int
+	recycleAfter int
 }
 
-// NewPool creates a new browser pool
-func NewPool() (*Pool, error) {
+// NewPool creates a new browser pool. binPath is the Chrome binary to launch
+// (ROD_BROWSER_PATH, for Docker); empty lets rod find or download one. Pages
+// rotate through profiles, or get DefaultStealthProfile if there are none.
+func NewPool(binPath string, profiles ...StealthProfile) (*Pool, error) {
 	// Launch browser with stealth settings
 	l := launcher.New().
 		Headless(true).
@@ -40,9 +52,8 @@ func NewPool() (*Pool, error) {
 		Set("no-sandbox").            // Required for Docker
 		Set("disable-dev-shm-usage")  // Required for Docker
 
-	// Use custom browser path if specified (for Docker)
-	if browserPath := os.Getenv("ROD_BROWSER_PATH"); browserPath != "" {
-		l = l.Bin(browserPath)
+	if binPath != "" {
+		l = l.Bin(binPath)
 	}
 
 	url, err := l.Launch()
@@ -58,10 +69,13 @@ func NewPool() (*Pool, error) {
 	// Set default timeouts
 	browser = browser.Timeout(60 * time.Second)
 
-	return &Pool{browser: browser}, nil
+	p := &Pool{browser: browser, profiles: newProfileRotation(profiles), recycleAfter: DefaultRecycleAfter}
+	p.newPage = p.GetPage
+	p.closePage = (*rod.Page).Close
+	return p, nil
 }
 
-// GetPage returns a new stealth page
+// GetPage returns a new stealth page with the next stealth profile
 func (p *Pool) GetPage() (*rod.Page, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -72,62 +86,12 @@ func (p *Pool) GetPage() (*rod.Page, error) {
 		return nil, err
 	}
 
-	// Set realistic viewport
-	if err := page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
-		Width:             1920,
-		Height:            1080,
-		DeviceScaleFactor: 1,
-		Mobile:            false,
-	}); err != nil {
+	// Fingerprint the page with the next profile in the rotation
+	if err := applyProfile(page, p.profiles.Next()); err != nil {
 		page.Close()
 		return nil, err
 	}
 
-	// Set user agent
-	if err := page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
-		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-		AcceptLanguage: "en-US,en;q=0.9",
-		Platform:       "Win32",
-	}); err != nil {
-		page.Close()
-		return nil, err
-	}
-
-	// Add extra evasion via JavaScript
-	_, _ = page.Evaluate(rod.Eval(`() => {
-		// Override webdriver property
-		Object.defineProperty(navigator, 'webdriver', {
-			get: () => undefined
-		});
-
-		// Override plugins
-		Object.defineProperty(navigator, 'plugins', {
-			get: () => [
-				{ name: 'Chrome PDF Plugin' },
-				{ name: 'Chrome PDF Viewer' },
-				{ name: 'Native Client' }
-			]
-		});
-
-		// Override languages
-		Object.defineProperty(navigator, 'languages', {
-			get: () => ['en-US', 'en']
-		});
-
-		// Chrome runtime
-		window.chrome = {
-			runtime: {}
-		};
-
-		// Permissions
-		const originalQuery = window.navigator.permissions.query;
-		window.navigator.permissions.query = (parameters) => (
-			parameters.name === 'notifications' ?
-				Promise.resolve({ state: Notification.permission }) :
-				originalQuery(parameters)
-		);
-	}`))
-
 	return page, nil
 }
 
@@ -166,6 +130,19 @@ func WaitAndClick(page *rod.Page, selector string, timeout time.Duration) error
 	return el.Click(proto.InputMouseButtonLeft, 1)
 }
 
+// WaitForSelector waits up to timeout for an element matching selector,
+// returning as soon as one is present
+func WaitForSelector(ctx context.Context, page *rod.Page, selector string, timeout time.Duration) error {
+	_, err := page.Context(ctx).Timeout(timeout).Element(selector)
+	return err
+}
+
+// WaitSettled waits up to timeout for the DOM to stop changing, e.g. while
+// lazy content loads after scrolling
+func WaitSettled(ctx context.Context, page *rod.Page, timeout time.Duration) error {
+	return page.Context(ctx).Timeout(timeout).WaitDOMStable(300*time.Millisecond, 0)
+}
+
 // GetText extracts text from a selector
 func GetText(page *rod.Page, selector string) string {
 	el, err := page.Element(selector)
@@ -213,6 +190,27 @@ func ScrollToBottom(page *rod.Page) error {
 
 // RandomDelay adds a random human-like delay
 func RandomDelay(min, max time.Duration) {
-	delay := min + time.Duration(float64(max-min)*0.5) // Simplified random
-	time.Sleep(delay)
+	RandomDelayCtx(context.Background(), min, max)
+}
+
+// RandomDelayCtx adds a random human-like delay, returning early with the
+// context's error if it is cancelled
+func RandomDelayCtx(ctx context.Context, min, max time.Duration) error {
+	timer := time.NewTimer(randomDuration(min, max))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// randomDuration returns a uniformly distributed duration in [min, max)
+func randomDuration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + rand.N(max-min)
 }
@@ -0,0 +1,152 @@
+package browser
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRandomDurationDistribution(t *testing.T) {
+	min, max := 2*time.Second, 5*time.Second
+	const samples = 1000
+
+	seen := make(map[time.Duration]bool)
+	var sum time.Duration
+	for i := 0; i < samples; i++ {
+		d := randomDuration(min, max)
+		if d < min || d >= max {
+			t.Fatalf("duration %v outside [%v, %v)", d, min, max)
+		}
+		seen[d] = true
+		sum += d
+	}
+
+	if len(seen) < samples/2 {
+		t.Errorf("only %d distinct delays in %d samples", len(seen), samples)
+	}
+
+	// Uniform mean is 3.5s; allow a generous margin
+	mean := sum / samples
+	if mean < 3200*time.Millisecond || mean > 3800*time.Millisecond {
+		t.Errorf("mean delay %v far from expected 3.5s", mean)
+	}
+}
+
+func TestRandomDurationDegenerate(t *testing.T) {
+	if d := randomDuration(time.Second, time.Second); d != time.Second {
+		t.Errorf("equal bounds = %v, want 1s", d)
+	}
+	if d := randomDuration(2*time.Second, time.Second); d != 2*time.Second {
+		t.Errorf("inverted bounds = %v, want min", d)
+	}
+}
+
+func TestRandomDelayCtxCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := RandomDelayCtx(ctx, time.Minute, 2*time.Minute); err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled delay took %v", elapsed)
+	}
+}
+
+func TestProfileRotation(t *testing.T) {
+	mac := StealthProfile{
+		Platform:     "MacIntel",
+		Languages:    []string{"en-GB", "en"},
+		Plugins:      []string{"PDF Viewer"},
+		Timezone:     "Europe/London",
+		ScreenWidth:  1440,
+		ScreenHeight: 900,
+	}
+	rotation := newProfileRotation([]StealthProfile{DefaultStealthProfile, mac})
+
+	// Consecutive pages get different profiles, and the rotation wraps
+	first, second := rotation.Next(), rotation.Next()
+	if reflect.DeepEqual(first, second) {
+		t.Errorf("two pages got the same profile %+v", first)
+	}
+	if third := rotation.Next(); !reflect.DeepEqual(third, first) {
+		t.Errorf("third page got %+v, want the first profile again", third)
+	}
+}
+
+func TestProfileRotationDefault(t *testing.T) {
+	rotation := newProfileRotation(nil)
+	for i := 0; i < 2; i++ {
+		if got := rotation.Next(); !reflect.DeepEqual(got, DefaultStealthProfile) {
+			t.Errorf("page %d got %+v, want the default profile", i, got)
+		}
+	}
+}
+
+func TestStealthProfileScript(t *testing.T) {
+	profile := StealthProfile{
+		Languages: []string{"de-DE", "de", "en"},
+		Plugins:   []string{"PDF Viewer", `Quote's "Plugin"`},
+	}
+
+	script := profile.script("Linux x86_64")
+	for _, want := range []string{
+		`get: () => ["de-DE","de","en"]`,
+		`get: () => [{"name":"PDF Viewer"},{"name":"Quote's \"Plugin\""}]`,
+		`get: () => "Linux x86_64"`,
+		`'webdriver'`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script does not contain %s:\n%s", want, script)
+		}
+	}
+
+	if got := profile.acceptLanguage(); got != "de-DE,de;q=0.9,en;q=0.8" {
+		t.Errorf("acceptLanguage = %q", got)
+	}
+	if got := DefaultStealthProfile.acceptLanguage(); got != "en-US,en;q=0.9" {
+		t.Errorf("default acceptLanguage = %q", got)
+	}
+}
+
+func TestLoadStealthProfiles(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "stealth.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	profiles, err := LoadStealthProfiles(write(t, `[
+		{"languages": ["en-US", "en"], "plugins": [], "screen_width": 1920, "screen_height": 1080},
+		{"platform": "MacIntel", "languages": ["en-GB"], "plugins": ["PDF Viewer"], "timezone": "Europe/London", "screen_width": 1440, "screen_height": 900}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || profiles[1].Timezone != "Europe/London" || profiles[1].ScreenWidth != 1440 {
+		t.Errorf("profiles = %+v", profiles)
+	}
+
+	for name, content := range map[string]string{
+		"not json":        `{`,
+		"empty":           `[]`,
+		"unknown field":   `[{"languages": ["en"], "screen_width": 1, "screen_height": 1, "webgl": "x"}]`,
+		"no languages":    `[{"screen_width": 1920, "screen_height": 1080}]`,
+		"no screen size":  `[{"languages": ["en"]}]`,
+		"unknown zone":    `[{"languages": ["en"], "timezone": "Mars/Olympus", "screen_width": 1, "screen_height": 1}]`,
+		"list in a value": `[{"languages": ["en,fr"], "screen_width": 1, "screen_height": 1}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadStealthProfiles(write(t, content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
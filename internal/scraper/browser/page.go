@@ -0,0 +1,112 @@
+package browser
+
+import (
+	"fmt"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// DefaultRecycleAfter is how many navigations a pooled page serves before it
+// is recycled, unless the pool is configured otherwise
+const DefaultRecycleAfter = 100
+
+// recycleHeapBytes is the JS heap size past which a page is recycled before
+// its next navigation, whatever its navigation count
+const recycleHeapBytes = 512 << 20
+
+// Page is a page acquired from a Pool. Chrome tabs leak memory over many
+// navigations, so Navigate recycles the page (closes it and opens a fresh
+// one with the next stealth profile) after the pool's recycle threshold or
+// once its heap grows too large. Cookies live in the browser, so a logged-in
+// session survives the recycle. Release the page when done.
+type Page struct {
+	pool        *Pool
+	page        *rod.Page
+	navigations int
+	// bloated is set when the page's heap passed recycleHeapBytes
+	bloated bool
+}
+
+// Acquire returns a new page counted as in use until it is released
+func (p *Pool) Acquire() (*Page, error) {
+	page, err := p.newPage()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.inUse++
+	p.mu.Unlock()
+	return &Page{pool: p, page: page}, nil
+}
+
+// SetRecycleAfter sets how many navigations a page serves before it is
+// recycled; 0 or less recycles only on heap size
+func (p *Pool) SetRecycleAfter(navigations int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recycleAfter = navigations
+}
+
+// InUse returns the number of acquired pages not yet released
+func (p *Pool) InUse() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inUse
+}
+
+// Rod returns the current underlying page. It changes when Navigate
+// recycles the page, so don't hold on to it across navigations.
+func (pg *Page) Rod() *rod.Page {
+	return pg.page
+}
+
+// Navigate navigates to url with NavigateWithRetry, first recycling the page
+// if it is due
+func (pg *Page) Navigate(url string, maxRetries int) error {
+	if err := pg.count(); err != nil {
+		return err
+	}
+	err := NavigateWithRetry(pg.page, url, maxRetries)
+	if heap, herr := (proto.RuntimeGetHeapUsage{}).Call(pg.page); herr == nil && heap.UsedSize > recycleHeapBytes {
+		pg.bloated = true
+	}
+	return err
+}
+
+// count counts a navigation, recycling the page first if it has served the
+// pool's threshold of navigations or its heap has grown too large
+func (pg *Page) count() error {
+	pg.pool.mu.Lock()
+	limit := pg.pool.recycleAfter
+	pg.pool.mu.Unlock()
+
+	if pg.bloated || (limit > 0 && pg.navigations >= limit) {
+		fresh, err := pg.pool.newPage()
+		if err != nil {
+			return fmt.Errorf("failed to recycle page: %w", err)
+		}
+		pg.pool.closePage(pg.page)
+		pg.page = fresh
+		pg.navigations = 0
+		pg.bloated = false
+	}
+	pg.navigations++
+	return nil
+}
+
+// Release closes the page and returns it to the pool's accounting. Releasing
+// twice is a no-op.
+func (pg *Page) Release() error {
+	if pg.page == nil {
+		return nil
+	}
+	err := pg.pool.closePage(pg.page)
+	pg.page = nil
+
+	pg.pool.mu.Lock()
+	pg.pool.inUse--
+	pg.pool.mu.Unlock()
+	return err
+}
@@ -0,0 +1,96 @@
+package browser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-rod/rod"
+)
+
+// fakePagePool returns a pool whose pages are placeholders, recording how
+// many were opened and closed
+func fakePagePool(recycleAfter int) (*Pool, *int, *int) {
+	var opened, closed int
+	p := &Pool{recycleAfter: recycleAfter}
+	p.newPage = func() (*rod.Page, error) {
+		opened++
+		return &rod.Page{}, nil
+	}
+	p.closePage = func(*rod.Page) error {
+		closed++
+		return nil
+	}
+	return p, &opened, &closed
+}
+
+func TestPageRecycledAfterThreshold(t *testing.T) {
+	p, opened, closed := fakePagePool(3)
+
+	page, err := p.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := page.Rod()
+
+	for i := 0; i < 3; i++ {
+		if err := page.count(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if page.Rod() != first || *opened != 1 {
+		t.Fatalf("page replaced within the threshold (%d opened)", *opened)
+	}
+
+	// The 4th navigation gets a fresh page
+	if err := page.count(); err != nil {
+		t.Fatal(err)
+	}
+	if page.Rod() == first || *opened != 2 || *closed != 1 {
+		t.Errorf("opened %d, closed %d pages, want the page recycled (2 opened, 1 closed)", *opened, *closed)
+	}
+	if page.navigations != 1 {
+		t.Errorf("navigations = %d after recycle, want 1", page.navigations)
+	}
+	if p.InUse() != 1 {
+		t.Errorf("InUse = %d through a recycle, want 1", p.InUse())
+	}
+
+	page.Release()
+	page.Release()
+	if p.InUse() != 0 || *closed != 2 {
+		t.Errorf("InUse = %d, closed %d after release, want 0, 2", p.InUse(), *closed)
+	}
+}
+
+func TestPageRecycledWhenBloated(t *testing.T) {
+	p, opened, _ := fakePagePool(0)
+
+	page, _ := p.Acquire()
+	page.count()
+	page.bloated = true
+	page.count()
+
+	if *opened != 2 || page.bloated {
+		t.Errorf("opened %d pages, bloated = %v; want the bloated page recycled", *opened, page.bloated)
+	}
+}
+
+func TestPageRecycleFailureKeepsPage(t *testing.T) {
+	p, _, closed := fakePagePool(1)
+
+	page, _ := p.Acquire()
+	page.count()
+	first := page.Rod()
+	p.newPage = func() (*rod.Page, error) { return nil, errors.New("browser gone") }
+
+	if err := page.count(); err == nil {
+		t.Fatal("expected the recycle error")
+	}
+	if page.Rod() != first || *closed != 0 {
+		t.Error("failed recycle closed the working page")
+	}
+	page.Release()
+	if p.InUse() != 0 {
+		t.Errorf("InUse = %d, want 0", p.InUse())
+	}
+}
@@ -0,0 +1,158 @@
+package browser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// CookieStore persists browser session cookies to disk, one file per source
+type CookieStore struct {
+	dir string
+}
+
+// NewCookieStore stores cookies under dir
+func NewCookieStore(dir string) *CookieStore {
+	return &CookieStore{dir: dir}
+}
+
+var unsafeFilename = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+func (s *CookieStore) path(source string) string {
+	return filepath.Join(s.dir, unsafeFilename.ReplaceAllString(source, "_")+".json")
+}
+
+// Load returns the saved cookies for a source, or nil if none are saved
+func (s *CookieStore) Load(source string) ([]*proto.NetworkCookieParam, error) {
+	data, err := os.ReadFile(s.path(source))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cookies []*proto.NetworkCookieParam
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return nil, fmt.Errorf("corrupt cookie file for %s: %w", source, err)
+	}
+	return cookies, nil
+}
+
+// Save writes a source's cookies, readable only by the current user
+func (s *CookieStore) Save(source string, cookies []*proto.NetworkCookieParam) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cookies)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(source), data, 0o600)
+}
+
+// Delete removes a source's saved cookies
+func (s *CookieStore) Delete(source string) error {
+	err := os.Remove(s.path(source))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// EnsureSession restores a source's saved cookies into the browser, logging in
+// if there are none
+func (p *Pool) EnsureSession(page *rod.Page, source string, auth *domain.SourceAuthConfig, store *CookieStore) error {
+	cookies, err := store.Load(source)
+	if err != nil {
+		return err
+	}
+	if len(cookies) > 0 {
+		return p.browser.SetCookies(cookies)
+	}
+	return p.Login(page, source, auth, store)
+}
+
+// Login submits the source's login form and saves the resulting session cookies.
+// Errors never include the credentials.
+func (p *Pool) Login(page *rod.Page, source string, auth *domain.SourceAuthConfig, store *CookieStore) error {
+	username, password, err := auth.Credentials()
+	if err != nil {
+		return fmt.Errorf("%s login: %w", source, err)
+	}
+
+	if err := NavigateWithRetry(page, auth.LoginURL, 3); err != nil {
+		return fmt.Errorf("%s login: failed to open login page: %w", source, err)
+	}
+
+	fields := []struct {
+		name, selector, value string
+	}{
+		{"username", auth.UsernameSelector, username},
+		{"password", auth.PasswordSelector, password},
+	}
+	for _, f := range fields {
+		el, err := page.Timeout(15 * time.Second).Element(f.selector)
+		if err != nil {
+			return fmt.Errorf("%s login: %s field %q not found", source, f.name, f.selector)
+		}
+		if err := el.Input(f.value); err != nil {
+			return fmt.Errorf("%s login: failed to fill %s field", source, f.name)
+		}
+	}
+
+	wait := page.WaitNavigation(proto.PageLifecycleEventNameNetworkAlmostIdle)
+	if err := WaitAndClick(page, auth.SubmitSelector, 15*time.Second); err != nil {
+		return fmt.Errorf("%s login: submit %q not found", source, auth.SubmitSelector)
+	}
+	wait()
+
+	if auth.LoggedInSelector != "" {
+		if _, err := page.Timeout(15 * time.Second).Element(auth.LoggedInSelector); err != nil {
+			return fmt.Errorf("%s login: logged-in marker %q not found after submit", source, auth.LoggedInSelector)
+		}
+	} else if IsLoginPage(page, auth) {
+		return fmt.Errorf("%s login: still on login page after submit, check credentials", source)
+	}
+
+	cookies, err := p.browser.GetCookies()
+	if err != nil {
+		return fmt.Errorf("%s login: failed to read session cookies: %w", source, err)
+	}
+	return store.Save(source, proto.CookiesToParams(cookies))
+}
+
+// IsLoginPage reports whether the page is on the source's login URL, which
+// after a navigation means the saved session has expired
+func IsLoginPage(page *rod.Page, auth *domain.SourceAuthConfig) bool {
+	info, err := page.Info()
+	if err != nil {
+		return false
+	}
+	return isLoginURL(info.URL, auth.LoginURL)
+}
+
+// isLoginURL compares host and path, ignoring query strings such as return URLs
+func isLoginURL(current, login string) bool {
+	c, err := url.Parse(current)
+	if err != nil {
+		return false
+	}
+	l, err := url.Parse(login)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(c.Host, l.Host) &&
+		strings.TrimSuffix(c.Path, "/") == strings.TrimSuffix(l.Path, "/")
+}
@@ -0,0 +1,77 @@
+package browser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+func TestCookieStoreRoundTrip(t *testing.T) {
+	store := NewCookieStore(filepath.Join(t.TempDir(), "cookies"))
+
+	cookies, err := store.Load("bizbuysell")
+	if err != nil || cookies != nil {
+		t.Fatalf("Load with no file = (%v, %v), want (nil, nil)", cookies, err)
+	}
+
+	want := []*proto.NetworkCookieParam{{Name: "session", Value: "abc", Domain: ".example.com", Path: "/"}}
+	if err := store.Save("bizbuysell", want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	info, err := os.Stat(store.path("bizbuysell"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("cookie file mode = %o, want 600", perm)
+	}
+
+	got, err := store.Load("bizbuysell")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "session" || got[0].Value != "abc" || got[0].Domain != ".example.com" {
+		t.Errorf("Load = %+v, want the saved cookie", got)
+	}
+
+	if err := store.Delete("bizbuysell"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got, _ := store.Load("bizbuysell"); got != nil {
+		t.Errorf("Load after Delete = %+v, want nil", got)
+	}
+	if err := store.Delete("bizbuysell"); err != nil {
+		t.Errorf("Delete of missing file: %v", err)
+	}
+}
+
+func TestCookieStorePathIsSanitized(t *testing.T) {
+	store := NewCookieStore("/tmp/cookies")
+	if got := store.path("../../etc/passwd"); filepath.Dir(got) != "/tmp/cookies" {
+		t.Errorf("path escaped the cookie dir: %s", got)
+	}
+}
+
+func TestIsLoginURL(t *testing.T) {
+	login := "https://portal.example.com/account/login"
+
+	tests := []struct {
+		current string
+		want    bool
+	}{
+		{"https://portal.example.com/account/login", true},
+		{"https://portal.example.com/account/login/?returnUrl=%2Flistings", true},
+		{"https://PORTAL.example.com/account/login", true},
+		{"https://portal.example.com/listings/2/", false},
+		{"https://other.example.com/account/login", false},
+	}
+
+	for _, tt := range tests {
+		if got := isLoginURL(tt.current, login); got != tt.want {
+			t.Errorf("isLoginURL(%q) = %v, want %v", tt.current, got, tt.want)
+		}
+	}
+}
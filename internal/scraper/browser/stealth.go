@@ -0,0 +1,200 @@
+package browser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+
+	"github.com/kbsch/trough/internal/scraper/useragents"
+)
+
+// StealthProfile is the browser fingerprint a page presents: the navigator
+// values the stealth script overrides, its timezone and screen size. The pool
+// rotates through its profiles per page so one blocked fingerprint doesn't
+// block every page.
+type StealthProfile struct {
+	Platform     string   `json:"platform,omitempty"` // navigator.platform; empty follows the user agent
+	Languages    []string `json:"languages"`          // navigator.languages, most preferred first
+	Plugins      []string `json:"plugins"`            // navigator.plugins names
+	Timezone     string   `json:"timezone,omitempty"` // IANA zone, e.g. America/Chicago; empty keeps the host's
+	ScreenWidth  int      `json:"screen_width"`
+	ScreenHeight int      `json:"screen_height"`
+}
+
+// DefaultStealthProfile is the profile pages get unless others are configured
+var DefaultStealthProfile = StealthProfile{
+	Languages:    []string{"en-US", "en"},
+	Plugins:      []string{"Chrome PDF Plugin", "Chrome PDF Viewer", "Native Client"},
+	ScreenWidth:  1920,
+	ScreenHeight: 1080,
+}
+
+// Validate reports the first problem with the profile
+func (p StealthProfile) Validate() error {
+	if len(p.Languages) == 0 {
+		return fmt.Errorf("at least one language is required")
+	}
+	for _, lang := range p.Languages {
+		if strings.TrimSpace(lang) == "" || strings.ContainsAny(lang, ",;") {
+			return fmt.Errorf("invalid language %q", lang)
+		}
+	}
+	if p.ScreenWidth <= 0 || p.ScreenHeight <= 0 {
+		return fmt.Errorf("screen size must be positive, got %dx%d", p.ScreenWidth, p.ScreenHeight)
+	}
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", p.Timezone)
+		}
+	}
+	return nil
+}
+
+// LoadStealthProfiles reads a JSON array of profiles from path
+// (SCRAPE_STEALTH_PROFILES), validating each
+func LoadStealthProfiles(path string) ([]StealthProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var profiles []StealthProfile
+	if err := dec.Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("invalid stealth profiles in %s: %w", path, err)
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no stealth profiles in %s", path)
+	}
+	for i, p := range profiles {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("stealth profile %d in %s: %w", i, path, err)
+		}
+	}
+	return profiles, nil
+}
+
+// acceptLanguage is the Accept-Language header matching the profile's
+// languages, e.g. "en-US,en;q=0.9"
+func (p StealthProfile) acceptLanguage() string {
+	parts := []string{p.Languages[0]}
+	for i, lang := range p.Languages[1:] {
+		parts = append(parts, fmt.Sprintf("%s;q=%.1f", lang, max(0.9-float64(i)/10, 0.1)))
+	}
+	return strings.Join(parts, ",")
+}
+
+// script is the stealth JavaScript applying the profile's navigator
+// overrides, run in every document before the page's own scripts
+func (p StealthProfile) script(platform string) string {
+	plugins := make([]map[string]string, len(p.Plugins))
+	for i, name := range p.Plugins {
+		plugins[i] = map[string]string{"name": name}
+	}
+	return fmt.Sprintf(`(() => {
+	// Override webdriver property
+	Object.defineProperty(navigator, 'webdriver', {
+		get: () => undefined
+	});
+
+	// Override plugins
+	Object.defineProperty(navigator, 'plugins', {
+		get: () => %s
+	});
+
+	// Override languages and platform
+	Object.defineProperty(navigator, 'languages', {
+		get: () => %s
+	});
+	Object.defineProperty(navigator, 'platform', {
+		get: () => %s
+	});
+
+	// Chrome runtime
+	window.chrome = {
+		runtime: {}
+	};
+
+	// Permissions
+	const originalQuery = window.navigator.permissions.query;
+	window.navigator.permissions.query = (parameters) => (
+		parameters.name === 'notifications' ?
+			Promise.resolve({ state: Notification.permission }) :
+			originalQuery(parameters)
+	);
+})();`, jsValue(plugins), jsValue(p.Languages), jsValue(platform))
+}
+
+// jsValue encodes v as a JavaScript literal
+func jsValue(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// profileRotation hands out profiles in round-robin order, starting at a
+// random one so separate workers don't all open with the same fingerprint
+type profileRotation struct {
+	profiles []StealthProfile
+	next     int
+}
+
+func newProfileRotation(profiles []StealthProfile) *profileRotation {
+	if len(profiles) == 0 {
+		profiles = []StealthProfile{DefaultStealthProfile}
+	}
+	return &profileRotation{profiles: profiles, next: rand.IntN(len(profiles))}
+}
+
+// Next returns the next profile; callers serialize access
+func (r *profileRotation) Next() StealthProfile {
+	p := r.profiles[r.next%len(r.profiles)]
+	r.next++
+	return p
+}
+
+// applyProfile gives a new page the profile's screen size, user agent,
+// timezone and navigator overrides
+func applyProfile(page *rod.Page, profile StealthProfile) error {
+	if err := page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
+		Width:             profile.ScreenWidth,
+		Height:            profile.ScreenHeight,
+		ScreenWidth:       &profile.ScreenWidth,
+		ScreenHeight:      &profile.ScreenHeight,
+		DeviceScaleFactor: 1,
+		Mobile:            false,
+	}); err != nil {
+		return err
+	}
+
+	// Set user agent, rotating per page
+	ua := useragents.Next()
+	platform := ua.Platform
+	if profile.Platform != "" {
+		platform = profile.Platform
+	}
+	if err := page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
+		UserAgent:      ua.UserAgent,
+		AcceptLanguage: profile.acceptLanguage(),
+		Platform:       platform,
+	}); err != nil {
+		return err
+	}
+
+	if profile.Timezone != "" {
+		if err := (proto.EmulationSetTimezoneOverride{TimezoneID: profile.Timezone}).Call(page); err != nil {
+			return err
+		}
+	}
+
+	// Registered for every new document, so the overrides survive navigation
+	_, err := page.EvalOnNewDocument(profile.script(platform))
+	return err
+}
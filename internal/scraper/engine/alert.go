@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of AlertEvent
+const (
+	// AlertDegraded is a run whose primary scraper was blocked but whose
+	// fallback scraper got through
+	AlertDegraded = "degraded"
+	// AlertBlocked is a run that ended blocked, fallback and all
+	AlertBlocked = "blocked"
+	// AlertQuarantined is a run whose blocked outcome quarantined its source
+	AlertQuarantined = "quarantined"
+	// AlertZeroYield is a run that completed without finding any listings
+	AlertZeroYield = "zero_yield"
+)
+
+// AlertEvent is something wrong with a source's scraping
+type AlertEvent struct {
+	Kind    string    `json:"kind"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+	Found   int       `json:"found"`
+	Time    time.Time `json:"time"`
+}
+
+// Alerter notifies operators of scraping problems. The engine calls it from
+// concurrent runs, so it must be safe for concurrent use.
+type Alerter interface {
+	Alert(ctx context.Context, event AlertEvent) error
+}
+
+// SetAlerter sets the alerter runs report degraded, blocked, quarantined and
+// zero-yield outcomes to; wrap it in a ThrottledAlerter so a source that stays
+// broken doesn't alert on every run
+func (e *Engine) SetAlerter(alerter Alerter) {
+	e.alerter = alerter
+}
+
+// alert sends event if an alerter is set. A failed alert is only logged.
+func (e *Engine) alert(ctx context.Context, kind, slug string, found int, message string) {
+	if e.alerter == nil {
+		return
+	}
+	event := AlertEvent{Kind: kind, Source: slug, Message: message, Found: found, Time: time.Now()}
+	if err := e.alerter.Alert(ctx, event); err != nil {
+		e.logger.Warn("failed to send scrape alert", "source", slug, "kind", kind, "error", err)
+	}
+}
+
+// DefaultAlertThrottle is how long a ThrottledAlerter holds back repeats
+const DefaultAlertThrottle = 24 * time.Hour
+
+// ThrottledAlerter passes on the first event of each kind for a source and
+// drops repeats until window has passed since it
+type ThrottledAlerter struct {
+	next   Alerter
+	window time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	sent map[[2]string]time.Time
+}
+
+// NewThrottledAlerter throttles next to one alert per source and kind per
+// window, or DefaultAlertThrottle if window <= 0
+func NewThrottledAlerter(next Alerter, window time.Duration) *ThrottledAlerter {
+	if window <= 0 {
+		window = DefaultAlertThrottle
+	}
+	return &ThrottledAlerter{next: next, window: window, now: time.Now, sent: make(map[[2]string]time.Time)}
+}
+
+func (t *ThrottledAlerter) Alert(ctx context.Context, event AlertEvent) error {
+	key := [2]string{event.Source, event.Kind}
+	now := t.now()
+
+	t.mu.Lock()
+	if last, ok := t.sent[key]; ok && now.Sub(last) < t.window {
+		t.mu.Unlock()
+		return nil
+	}
+	t.sent[key] = now
+	t.mu.Unlock()
+
+	if err := t.next.Alert(ctx, event); err != nil {
+		// Let the next run try again
+		t.mu.Lock()
+		delete(t.sent, key)
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// MultiAlerter sends every event to each of its alerters
+type MultiAlerter []Alerter
+
+func (m MultiAlerter) Alert(ctx context.Context, event AlertEvent) error {
+	var errs []error
+	for _, a := range m {
+		errs = append(errs, a.Alert(ctx, event))
+	}
+	return errors.Join(errs...)
+}
+
+// WebhookAlerter posts each event as JSON to a URL, such as a Slack-compatible
+// incoming webhook: the body carries a "text" summary besides the event fields
+type WebhookAlerter struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAlerter returns an alerter posting to url
+func NewWebhookAlerter(url string) *WebhookAlerter {
+	return &WebhookAlerter{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *WebhookAlerter) Alert(ctx context.Context, event AlertEvent) error {
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+		AlertEvent
+	}{alertSummary(event), event})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("alert webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPConfig is the mail server and addresses an EmailAlerter sends with.
+// Without a username it sends unauthenticated.
+type SMTPConfig struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// smtpTimeout bounds a whole email send, as alerts are sent from the scrape
+// run they report on
+const smtpTimeout = 30 * time.Second
+
+// EmailAlerter mails each event
+type EmailAlerter struct {
+	cfg  SMTPConfig
+	send func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmailAlerter returns an alerter mailing through cfg's server
+func NewEmailAlerter(cfg SMTPConfig) *EmailAlerter {
+	return &EmailAlerter{cfg: cfg, send: sendMail}
+}
+
+func (m *EmailAlerter) Alert(ctx context.Context, event AlertEvent) error {
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		host, _, _ := strings.Cut(m.cfg.Addr, ":")
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [trough] %s\r\n", alertSummary(event))
+	fmt.Fprintf(&msg, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "Source: %s\r\nKind: %s\r\nListings found: %d\r\n\r\n%s\r\n",
+		event.Source, event.Kind, event.Found, event.Message)
+
+	if err := m.send(ctx, m.cfg.Addr, auth, m.cfg.From, m.cfg.To, []byte(msg.String())); err != nil {
+		return fmt.Errorf("alert email: %w", err)
+	}
+	return nil
+}
+
+// sendMail is smtp.SendMail bounded by ctx and smtpTimeout, which the
+// connection's deadline applies to every command of
+func sendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	// Cancellation before the deadline unblocks the connection too
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// alertSummary is a one-line description of event
+func alertSummary(event AlertEvent) string {
+	return fmt.Sprintf("scrape %s: %s", strings.ReplaceAll(event.Kind, "_", " "), event.Source)
+}
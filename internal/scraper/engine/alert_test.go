@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// recordingAlerter keeps the events it is sent, failing while err is set
+type recordingAlerter struct {
+	mu     sync.Mutex
+	events []AlertEvent
+	err    error
+}
+
+func (a *recordingAlerter) Alert(ctx context.Context, event AlertEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	a.events = append(a.events, event)
+	return nil
+}
+
+func TestThrottledAlerter(t *testing.T) {
+	rec := &recordingAlerter{}
+	throttled := NewThrottledAlerter(rec, 24*time.Hour)
+	now := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	throttled.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	degraded := AlertEvent{Kind: AlertDegraded, Source: "bizbuysell"}
+	for i := 0; i < 3; i++ {
+		if err := throttled.Alert(ctx, degraded); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(4 * time.Hour)
+	}
+	if len(rec.events) != 1 {
+		t.Fatalf("sent %d alerts for repeated degraded runs, want 1", len(rec.events))
+	}
+
+	// Another kind or source isn't held back
+	throttled.Alert(ctx, AlertEvent{Kind: AlertBlocked, Source: "bizbuysell"})
+	throttled.Alert(ctx, AlertEvent{Kind: AlertDegraded, Source: "bizquest"})
+	if len(rec.events) != 3 {
+		t.Errorf("sent %d alerts, want 3", len(rec.events))
+	}
+
+	// Once the window has passed the source alerts again
+	now = now.Add(13 * time.Hour)
+	throttled.Alert(ctx, degraded)
+	if len(rec.events) != 4 {
+		t.Errorf("sent %d alerts after the window, want 4", len(rec.events))
+	}
+
+	// A failed alert is retried on the next event
+	rec.err = errors.New("webhook down")
+	zero := AlertEvent{Kind: AlertZeroYield, Source: "sunbelt"}
+	if err := throttled.Alert(ctx, zero); err == nil {
+		t.Error("failed alert returned no error")
+	}
+	rec.err = nil
+	throttled.Alert(ctx, zero)
+	if len(rec.events) != 5 || rec.events[4].Source != "sunbelt" {
+		t.Errorf("events = %+v, want the retried zero-yield alert last", rec.events)
+	}
+}
+
+func TestRunSourceAlertsZeroYield(t *testing.T) {
+	eng := NewEngine(newFakeSourceStore("empty", "full"), &fakeListingStore{}, nil)
+	rec := &recordingAlerter{}
+	eng.SetAlerter(rec)
+	eng.RegisterScraper("empty", &fakeScraper{})
+	eng.RegisterScraper("full", &fakeScraper{listings: []*domain.Listing{{ExternalID: "1", Title: "One"}}})
+
+	for _, slug := range []string{"empty", "full"} {
+		if err := eng.RunSource(context.Background(), slug, 0); err != nil {
+			t.Fatalf("RunSource %s: %v", slug, err)
+		}
+	}
+	if len(rec.events) != 1 || rec.events[0].Kind != AlertZeroYield || rec.events[0].Source != "empty" {
+		t.Errorf("events = %+v, want one zero_yield alert for empty", rec.events)
+	}
+}
+
+func TestWebhookAlerter(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	event := AlertEvent{Kind: AlertZeroYield, Source: "transworld", Message: "nothing found", Time: time.Now()}
+	if err := NewWebhookAlerter(srv.URL).Alert(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if got["text"] != "scrape zero yield: transworld" || got["kind"] != AlertZeroYield || got["source"] != "transworld" {
+		t.Errorf("body = %v", got)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := NewWebhookAlerter(failing.URL).Alert(context.Background(), event); err == nil {
+		t.Error("502 from the webhook returned no error")
+	}
+}
+
+func TestEmailAlerter(t *testing.T) {
+	alerter := NewEmailAlerter(SMTPConfig{
+		Addr: "smtp.example.com:587", Username: "trough", Password: "secret",
+		From: "trough@example.com", To: []string{"ops@example.com"},
+	})
+	var addr string
+	var auth smtp.Auth
+	var msg string
+	alerter.send = func(ctx context.Context, a string, au smtp.Auth, from string, to []string, m []byte) error {
+		addr, auth, msg = a, au, string(m)
+		return nil
+	}
+
+	event := AlertEvent{Kind: AlertBlocked, Source: "bizbuysell", Message: "blocked", Found: 3, Time: time.Now()}
+	if err := alerter.Alert(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if addr != "smtp.example.com:587" || auth == nil {
+		t.Errorf("sent to %q with auth %v", addr, auth)
+	}
+	for _, want := range []string{"To: ops@example.com\r\n", "Subject: [trough] scrape blocked: bizbuysell\r\n", "Listings found: 3"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSendMailTimesOut(t *testing.T) {
+	// A server that accepts but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = sendMail(ctx, ln.Addr().String(), nil, "trough@example.com", []string{"ops@example.com"}, []byte("hi"))
+	if err == nil {
+		t.Fatal("sendMail to a silent server returned no error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("sendMail took %v, want it stopped by ctx", elapsed)
+	}
+}
@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/geocode"
+)
+
+// States of a CircuitBreaker
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// CircuitBreaker stops calls to an external provider, such as a geocoder,
+// once it has failed threshold times in a row. After cooldown it lets one
+// trial call through: success closes the breaker, failure reopens it.
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker returns a closed breaker for the named provider that
+// opens after threshold consecutive failures (at least 1) for cooldown
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{name: name, threshold: threshold, cooldown: cooldown, now: time.Now, state: BreakerClosed}
+}
+
+// Allow reports whether a call may be made. Once the cooldown has passed an
+// open breaker turns half-open and allows a single trial call.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		// The trial call is still out
+		return false
+	}
+	return true
+}
+
+// Success records a successful call, closing the breaker
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+}
+
+// Abandon records a call given up on before it finished, e.g. because its
+// context was cancelled, which says nothing about the provider. An abandoned
+// trial call leaves no trial out, so the breaker reopens for a fresh
+// cooldown rather than staying half-open for good.
+func (b *CircuitBreaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Failure records a failed call and reports whether it tripped the breaker
+// open: the threshold-th failure in a row, or a failed trial call
+func (b *CircuitBreaker) Failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == BreakerOpen || (b.state == BreakerClosed && b.failures < b.threshold) {
+		return false
+	}
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	breakerTrips.WithLabelValues(b.name).Inc()
+	return true
+}
+
+// State returns the breaker's state: BreakerClosed, BreakerOpen or BreakerHalfOpen
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// BreakerProcessor runs a processor that calls an external provider behind a
+// CircuitBreaker. The provider being down degrades listings rather than
+// dropping them: a failed call, or one the open breaker skips, keeps the
+// listing as it was. Drops by the processor itself still apply.
+type BreakerProcessor struct {
+	next    ListingProcessor
+	breaker *CircuitBreaker
+	logger  *slog.Logger
+}
+
+// NewBreakerProcessor wraps next in breaker, logging to logger, or
+// slog.Default() if nil
+func NewBreakerProcessor(next ListingProcessor, breaker *CircuitBreaker, logger *slog.Logger) *BreakerProcessor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &BreakerProcessor{next: next, breaker: breaker, logger: logger}
+}
+
+func (p *BreakerProcessor) Process(ctx context.Context, listing *domain.Listing) (bool, error) {
+	if !p.breaker.Allow() {
+		return true, nil
+	}
+
+	keep, err := p.next.Process(ctx, listing)
+	if err != nil {
+		if ctx.Err() != nil {
+			p.breaker.Abandon()
+			return false, ctx.Err()
+		}
+		if p.breaker.Failure() {
+			p.logger.Warn("provider failing, circuit breaker open", "provider", p.breaker.name,
+				"cooldown", p.breaker.cooldown, "error", err)
+		} else {
+			p.logger.Debug("provider call failed, keeping listing unprocessed", "provider", p.breaker.name,
+				"external_id", listing.ExternalID, "error", err)
+		}
+		return true, nil
+	}
+
+	p.breaker.Success()
+	return keep, nil
+}
+
+// ErrBreakerOpen is returned by a BreakerGeocoder whose breaker is open
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+// BreakerGeocoder calls a geocoder behind a CircuitBreaker, so a provider
+// that is down isn't called for every remaining location. While the breaker
+// is open calls fail with ErrBreakerOpen without reaching the provider. A
+// not-found answer counts as a success, the provider having answered.
+type BreakerGeocoder struct {
+	next    geocode.Geocoder
+	breaker *CircuitBreaker
+	logger  *slog.Logger
+}
+
+// NewBreakerGeocoder wraps next in breaker, logging to logger, or
+// slog.Default() if nil
+func NewBreakerGeocoder(next geocode.Geocoder, breaker *CircuitBreaker, logger *slog.Logger) *BreakerGeocoder {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &BreakerGeocoder{next: next, breaker: breaker, logger: logger}
+}
+
+func (g *BreakerGeocoder) Name() string { return g.next.Name() }
+
+func (g *BreakerGeocoder) Geocode(ctx context.Context, loc geocode.Location) (*geocode.Result, error) {
+	if !g.breaker.Allow() {
+		return nil, fmt.Errorf("%s: %w", g.next.Name(), ErrBreakerOpen)
+	}
+
+	result, err := g.next.Geocode(ctx, loc)
+	switch {
+	case err == nil || errors.Is(err, geocode.ErrNotFound):
+		g.breaker.Success()
+	case ctx.Err() != nil:
+		g.breaker.Abandon()
+	case g.breaker.Failure():
+		g.logger.Warn("provider failing, circuit breaker open", "provider", g.breaker.name,
+			"cooldown", g.breaker.cooldown, "error", err)
+	}
+	return result, err
+}
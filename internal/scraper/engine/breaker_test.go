@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/geocode"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := NewCircuitBreaker("test-transitions", 3, time.Minute)
+	b.now = func() time.Time { return now }
+	trips := func() float64 { return testutil.ToFloat64(breakerTrips.WithLabelValues("test-transitions")) }
+
+	// A success resets the run of failures
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+	b.Failure()
+	if b.State() != BreakerClosed || !b.Allow() {
+		t.Fatalf("state = %s, want closed after 2 failures in a row", b.State())
+	}
+
+	if !b.Failure() || b.State() != BreakerOpen {
+		t.Fatalf("state = %s, want open after the 3rd failure in a row", b.State())
+	}
+	if trips() != 1 {
+		t.Errorf("trips = %v, want 1", trips())
+	}
+	if b.Allow() {
+		t.Error("open breaker allowed a call during the cooldown")
+	}
+
+	// After the cooldown one trial call goes through; its failure reopens
+	now = now.Add(time.Minute)
+	if !b.Allow() || b.State() != BreakerHalfOpen {
+		t.Fatalf("state = %s, want half_open allowing a trial after the cooldown", b.State())
+	}
+	if b.Allow() {
+		t.Error("half-open breaker allowed a second call")
+	}
+	if !b.Failure() || b.State() != BreakerOpen {
+		t.Fatalf("state = %s, want open after the trial failed", b.State())
+	}
+	if trips() != 2 {
+		t.Errorf("trips = %v, want 2", trips())
+	}
+
+	// A successful trial closes it
+	now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Fatal("breaker didn't allow a trial after the second cooldown")
+	}
+	b.Success()
+	if b.State() != BreakerClosed || !b.Allow() {
+		t.Errorf("state = %s, want closed after the trial succeeded", b.State())
+	}
+}
+
+func TestBreakerProcessorDegrades(t *testing.T) {
+	var calls int
+	down := ListingProcessorFunc(func(ctx context.Context, l *domain.Listing) (bool, error) {
+		calls++
+		return false, errors.New("geocoder unreachable")
+	})
+	p := NewBreakerProcessor(down, NewCircuitBreaker("test-degrades", 2, time.Hour), nil)
+
+	for i := 0; i < 5; i++ {
+		keep, err := p.Process(context.Background(), &domain.Listing{ExternalID: "1"})
+		if !keep || err != nil {
+			t.Fatalf("Process = %v, %v; want the listing kept", keep, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("provider called %d times, want 2 before the breaker opened", calls)
+	}
+}
+
+func TestBreakerProcessorCanceledTrialReopens(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := NewCircuitBreaker("test-canceled", 1, time.Minute)
+	b.now = func() time.Time { return now }
+	b.Failure()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	slow := ListingProcessorFunc(func(ctx context.Context, l *domain.Listing) (bool, error) {
+		cancel()
+		return false, ctx.Err()
+	})
+	p := NewBreakerProcessor(slow, b, nil)
+
+	// The trial call is cancelled partway
+	now = now.Add(time.Minute)
+	if _, err := p.Process(ctx, &domain.Listing{ExternalID: "1"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Process err = %v, want context.Canceled", err)
+	}
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s, want open again after the trial was abandoned", b.State())
+	}
+	if b.Allow() {
+		t.Error("breaker allowed a call before a fresh cooldown")
+	}
+	now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Error("breaker didn't allow a new trial after the fresh cooldown")
+	}
+}
+
+// fakeGeocoder answers with err, counting its calls
+type fakeGeocoder struct {
+	calls int
+	err   error
+}
+
+func (g *fakeGeocoder) Name() string { return "fake" }
+
+func (g *fakeGeocoder) Geocode(ctx context.Context, loc geocode.Location) (*geocode.Result, error) {
+	g.calls++
+	if g.err != nil {
+		return nil, g.err
+	}
+	return &geocode.Result{Lat: 32.78, Lng: -96.8}, nil
+}
+
+func TestBreakerGeocoder(t *testing.T) {
+	down := &fakeGeocoder{err: errors.New("nominatim unreachable")}
+	g := NewBreakerGeocoder(down, NewCircuitBreaker("test-geocoder", 2, time.Hour), nil)
+	loc := geocode.Location{City: "Dallas", State: "TX", Country: "US"}
+
+	for i := 0; i < 5; i++ {
+		_, err := g.Geocode(context.Background(), loc)
+		if err == nil {
+			t.Fatal("Geocode returned no error from a failing provider")
+		}
+		if open := i >= 2; errors.Is(err, ErrBreakerOpen) != open {
+			t.Errorf("call %d: err = %v, want ErrBreakerOpen %v", i, err, open)
+		}
+	}
+	if down.calls != 2 {
+		t.Errorf("provider called %d times, want 2 before the breaker opened", down.calls)
+	}
+
+	// Not-found answers don't count against the provider
+	notFound := &fakeGeocoder{err: geocode.ErrNotFound}
+	g = NewBreakerGeocoder(notFound, NewCircuitBreaker("test-geocoder-not-found", 2, time.Hour), nil)
+	for i := 0; i < 5; i++ {
+		if _, err := g.Geocode(context.Background(), loc); !errors.Is(err, geocode.ErrNotFound) {
+			t.Fatalf("call %d: err = %v, want ErrNotFound", i, err)
+		}
+	}
+	if notFound.calls != 5 {
+		t.Errorf("provider called %d times, want every call to reach it", notFound.calls)
+	}
+}
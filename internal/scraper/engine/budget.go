@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ErrBudgetExhausted is returned by RunSource when the source's daily request
+// budget ran out before or during the run. The run's job is recorded as
+// budget_exhausted; listings scraped before the budget ran out are kept.
+var ErrBudgetExhausted = errors.New("daily request budget exhausted")
+
+// budgetStore tracks each source's requests per day
+type budgetStore interface {
+	RequestBudgetUsed(ctx context.Context, sourceID uuid.UUID) (int, error)
+	SpendRequestBudget(ctx context.Context, sourceID uuid.UUID, limit int) (used int, ok bool, err error)
+}
+
+// requestBudget counts a run's requests against its source's daily budget and
+// closes Done once the budget is spent. A nil budget never runs out.
+type requestBudget struct {
+	ctx      context.Context
+	store    budgetStore
+	sourceID uuid.UUID
+	limit    int
+	logger   *slog.Logger
+	once     sync.Once
+	done     chan struct{}
+}
+
+// newRequestBudget returns the run's budget, nil if limit is 0, or
+// ErrBudgetExhausted if today's budget is already spent
+func newRequestBudget(ctx context.Context, store budgetStore, sourceID uuid.UUID, limit int, logger *slog.Logger) (*requestBudget, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	used, err := store.RequestBudgetUsed(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if used >= limit {
+		return nil, ErrBudgetExhausted
+	}
+
+	return &requestBudget{
+		ctx:      ctx,
+		store:    store,
+		sourceID: sourceID,
+		limit:    limit,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Spend counts a fetched page. Scrapers report pages after fetching them, so a
+// page in flight when the budget runs out is fetched but not counted.
+func (b *requestBudget) Spend() {
+	if b == nil {
+		return
+	}
+
+	used, ok, err := b.store.SpendRequestBudget(b.ctx, b.sourceID, b.limit)
+	if err != nil {
+		b.logger.Warn("failed to count request against budget", "source_id", b.sourceID, "error", err)
+		return
+	}
+	if !ok || used >= b.limit {
+		b.once.Do(func() { close(b.done) })
+	}
+}
+
+// Done is closed once the budget is spent
+func (b *requestBudget) Done() <-chan struct{} {
+	if b == nil {
+		return nil
+	}
+	return b.done
+}
+
+// Exhausted reports whether the budget was spent during the run
+func (b *requestBudget) Exhausted() bool {
+	select {
+	case <-b.Done():
+		return true
+	default:
+		return false
+	}
+}
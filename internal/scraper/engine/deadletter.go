@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/repository"
+)
+
+// maxUpsertAttempts is how many runs try to upsert a listing the database
+// keeps rejecting before later runs skip it. Skipped listings stay in
+// failed_upserts until `trough replay-failed` saves them.
+const maxUpsertAttempts = 3
+
+var listingUpsertFailuresTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "trough_listing_upsert_failures_total",
+		Help: "Scraped listings the database rejected, by source",
+	},
+	[]string{"source"},
+)
+
+// failedUpsertStore keeps listings that failed to upsert
+type failedUpsertStore interface {
+	RecordFailedUpsert(ctx context.Context, listing *domain.Listing, upsertErr error) (attempts int, err error)
+	FailedUpsertAttempts(ctx context.Context, sourceID uuid.UUID) (map[string]int, error)
+	ClearFailedUpserts(ctx context.Context, sourceID uuid.UUID, externalIDs []string) error
+}
+
+// loadFailedUpserts loads the run's previously failed listings so flushBatch
+// can skip the ones past the retry cap
+func (e *Engine) loadFailedUpserts(ctx context.Context, run *runState) {
+	failed, err := e.listingRepo.FailedUpsertAttempts(ctx, run.sourceID)
+	if err != nil {
+		// Without it every listing is retried, as before the cap
+		e.logger.Warn("failed to load failed upserts", "source", run.slug, "error", err)
+		return
+	}
+	run.failed = failed
+}
+
+// flushBatch writes the run's batch, falling back to row-by-row upserts if the
+// batch fails so one bad listing doesn't drop the rest. Listings that fail are
+// saved to failed_upserts; ones that already failed maxUpsertAttempts times
+// are skipped.
+func (e *Engine) flushBatch(ctx context.Context, run *runState) {
+	batch := make([]*domain.Listing, 0, len(run.batch))
+	for _, listing := range run.batch {
+		if run.failed[listing.ExternalID] >= maxUpsertAttempts {
+			run.deadLettered++
+			continue
+		}
+		batch = append(batch, listing)
+	}
+	run.batch = run.batch[:0]
+	if len(batch) == 0 {
+		return
+	}
+
+	err := e.listingRepo.UpsertBatch(ctx, batch)
+	if err == nil {
+		e.clearFailedUpserts(ctx, run, batch)
+		return
+	}
+	e.logger.Error("failed to upsert batch, retrying individually", "source", run.slug, "listings", len(batch), "error", err)
+
+	saved := make([]*domain.Listing, 0, len(batch))
+	for _, listing := range repository.DedupeListings(batch) {
+		if err := e.listingRepo.Upsert(ctx, listing); err != nil {
+			e.recordFailedUpsert(ctx, run, listing, err)
+			continue
+		}
+		saved = append(saved, listing)
+	}
+	e.clearFailedUpserts(ctx, run, saved)
+}
+
+// recordFailedUpsert saves a rejected listing and logs it on its first failure
+// and when it reaches the retry cap, not on every run in between
+func (e *Engine) recordFailedUpsert(ctx context.Context, run *runState, listing *domain.Listing, upsertErr error) {
+	listingUpsertFailuresTotal.WithLabelValues(run.slug).Inc()
+
+	attempts, err := e.listingRepo.RecordFailedUpsert(ctx, listing, upsertErr)
+	if err != nil {
+		e.logger.Error("failed to upsert listing", "source", run.slug, "external_id", listing.ExternalID, "error", upsertErr)
+		e.logger.Warn("failed to record failed upsert", "source", run.slug, "external_id", listing.ExternalID, "error", err)
+		return
+	}
+	if run.failed == nil {
+		run.failed = make(map[string]int)
+	}
+	run.failed[listing.ExternalID] = attempts
+
+	switch {
+	case attempts == 1:
+		e.logger.Error("failed to upsert listing", "source", run.slug, "external_id", listing.ExternalID, "error", upsertErr)
+	case attempts == maxUpsertAttempts:
+		e.logger.Error("failed to upsert listing, skipping it in later runs", "source", run.slug,
+			"external_id", listing.ExternalID, "attempts", attempts, "error", upsertErr)
+	default:
+		e.logger.Debug("failed to upsert listing again", "source", run.slug, "external_id", listing.ExternalID,
+			"attempts", attempts, "error", upsertErr)
+	}
+}
+
+// clearFailedUpserts drops saved listings that have now been upserted
+func (e *Engine) clearFailedUpserts(ctx context.Context, run *runState, saved []*domain.Listing) {
+	var recovered []string
+	for _, listing := range saved {
+		if _, ok := run.failed[listing.ExternalID]; ok {
+			recovered = append(recovered, listing.ExternalID)
+			delete(run.failed, listing.ExternalID)
+		}
+	}
+	if len(recovered) == 0 {
+		return
+	}
+	if err := e.listingRepo.ClearFailedUpserts(ctx, run.sourceID, recovered); err != nil {
+		e.logger.Warn("failed to clear recovered failed upserts", "source", run.slug, "listings", len(recovered), "error", err)
+	}
+}
@@ -2,41 +2,220 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/kbsch/trough/internal/domain"
-	"github.com/kbsch/trough/internal/repository"
 )
 
+// upsertBatchSize is the number of listings written per UpsertBatch call
+const upsertBatchSize = 50
+
+// DefaultRateLimit is the delay between requests to a source
+const DefaultRateLimit = 2 * time.Second
+
+// SourceStore is the subset of the source repository used by the engine
+type SourceStore interface {
+	GetBySlug(ctx context.Context, slug string) (*domain.Source, error)
+	ListActive(ctx context.Context) ([]domain.Source, error)
+	CreateScrapeJob(ctx context.Context, job *domain.ScrapeJob) error
+	UpdateScrapeJob(ctx context.Context, job *domain.ScrapeJob) error
+	InsertScrapeJobRequests(ctx context.Context, requests []domain.ScrapeJobRequest) error
+	TryLockSource(ctx context.Context, sourceID uuid.UUID) (unlock func(), ok bool, err error)
+	budgetStore
+	quarantineStore
+}
+
+// ErrSourceLocked is returned by RunSource when another run of the same source,
+// in this or another process, is in progress. The skipped run is recorded as
+// a skipped_locked scrape job.
+var ErrSourceLocked = errors.New("source is already being scraped")
+
+type triggerKey struct{}
+
+// WithTrigger returns a context whose scrape runs are recorded with trigger,
+// one of the domain.ScrapeTrigger values
+func WithTrigger(ctx context.Context, trigger string) context.Context {
+	return context.WithValue(ctx, triggerKey{}, trigger)
+}
+
+// triggerFrom returns the trigger set by WithTrigger, or manual if there is none
+func triggerFrom(ctx context.Context) string {
+	if trigger, ok := ctx.Value(triggerKey{}).(string); ok && trigger != "" {
+		return trigger
+	}
+	return domain.ScrapeTriggerManual
+}
+
+// ListingStore is the subset of the listing repository used by the engine
+type ListingStore interface {
+	Upsert(ctx context.Context, listing *domain.Listing) error
+	UpsertBatch(ctx context.Context, listings []*domain.Listing) error
+	ListingFreshness(ctx context.Context, sourceID uuid.UUID) (map[string]domain.ListingFreshness, error)
+	TouchListings(ctx context.Context, sourceID uuid.UUID, externalIDs []string, seenAt time.Time) error
+	failedUpsertStore
+}
+
 type Engine struct {
-	sourceRepo  *repository.SourceRepository
-	listingRepo *repository.ListingRepository
+	sourceRepo  SourceStore
+	listingRepo ListingStore
 	scrapers    map[string]Scraper
+	factories   map[string]ScraperFactory
+	fallbacks   map[string]ScraperFactory
+	sitemap     Scraper
+	api         Scraper
+	limiter     *GlobalLimiter
+	sinks       []Sink
+	processors  []ListingProcessor
+	alerter     Alerter
+	logger      *slog.Logger
 }
 
+// Scraper produces listings for a source. Scrapers holding resources
+// (e.g. a browser pool) may also implement io.Closer.
 type Scraper interface {
 	Name() string
 	Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error)
 }
 
-func NewEngine(sourceRepo *repository.SourceRepository, listingRepo *repository.ListingRepository) *Engine {
+// Versioned is implemented by scrapers that number their parsing. Listings
+// record the version of the scraper that parsed them as parsed_by_version.
+type Versioned interface {
+	Version() int
+}
+
+// ScraperVersion returns scraper's version, or 0 if it isn't Versioned
+func ScraperVersion(scraper Scraper) int {
+	if v, ok := scraper.(Versioned); ok {
+		return v.Version()
+	}
+	return 0
+}
+
+// ScraperFactory constructs a scraper for a single run
+type ScraperFactory func() (Scraper, error)
+
+// NewEngine creates an engine logging to logger, or slog.Default() if nil
+func NewEngine(sourceRepo SourceStore, listingRepo ListingStore, logger *slog.Logger) *Engine {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
 	e := &Engine{
 		sourceRepo:  sourceRepo,
 		listingRepo: listingRepo,
 		scrapers:    make(map[string]Scraper),
+		factories:   make(map[string]ScraperFactory),
+		fallbacks:   make(map[string]ScraperFactory),
+		logger:      logger,
 	}
 
 	return e
 }
 
+// RegisterScraper registers a long-lived scraper, shared across runs.
+// If it implements io.Closer it is closed by Engine.Close.
 func (e *Engine) RegisterScraper(name string, scraper Scraper) {
+	delete(e.factories, name)
 	e.scrapers[name] = scraper
 }
 
+// RegisterScraperFactory registers a scraper that is constructed at the start of
+// each run and, if it implements io.Closer, closed when the run finishes
+func (e *Engine) RegisterScraperFactory(name string, factory ScraperFactory) {
+	delete(e.scrapers, name)
+	e.factories[name] = factory
+}
+
+// RegisterFallbackScraperFactory registers a scraper (typically the rod variant) to
+// re-run a source with when its primary scraper reports a blocked ScrapeError.
+// The fallback is constructed only when needed and closed after the run.
+func (e *Engine) RegisterFallbackScraperFactory(name string, factory ScraperFactory) {
+	e.fallbacks[name] = factory
+}
+
+// SetSitemapScraper sets the scraper used for sources whose config selects
+// crawl_strategy "sitemap", in place of the scraper registered for their slug
+func (e *Engine) SetSitemapScraper(scraper Scraper) {
+	e.sitemap = scraper
+}
+
+// SetAPIScraper sets the scraper used for sources whose config selects
+// crawl_strategy "api", in place of the scraper registered for their slug
+func (e *Engine) SetAPIScraper(scraper Scraper) {
+	e.api = scraper
+}
+
+// SetGlobalLimiter sets the limiter every request of every run waits on, so
+// sources scraping in parallel share one process-wide rate
+func (e *Engine) SetGlobalLimiter(limiter *GlobalLimiter) {
+	e.limiter = limiter
+}
+
+// Close closes any registered long-lived scrapers and added sinks that hold resources
+func (e *Engine) Close() error {
+	var errs []error
+	for name, scraper := range e.scrapers {
+		if closer, ok := scraper.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("closing %s: %w", name, err))
+			}
+		}
+	}
+	for _, sink := range e.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("closing sink %T: %w", sink, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// acquireScraper returns the scraper for a slug and crawl strategy and a release
+// func to call after the run
+func (e *Engine) acquireScraper(slug, strategy string) (Scraper, func(), error) {
+	if strategy == domain.CrawlStrategySitemap {
+		if e.sitemap == nil {
+			return nil, nil, fmt.Errorf("no sitemap scraper registered for: %s", slug)
+		}
+		return e.sitemap, func() {}, nil
+	}
+	if strategy == domain.CrawlStrategyAPI {
+		if e.api == nil {
+			return nil, nil, fmt.Errorf("no api scraper registered for: %s", slug)
+		}
+		return e.api, func() {}, nil
+	}
+
+	if factory, ok := e.factories[slug]; ok {
+		scraper, err := factory()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create scraper for %s: %w", slug, err)
+		}
+		release := func() {
+			if closer, ok := scraper.(io.Closer); ok {
+				if err := closer.Close(); err != nil {
+					e.logger.Warn("failed to close scraper", "source", slug, "error", err)
+				}
+			}
+		}
+		return scraper, release, nil
+	}
+
+	if scraper, ok := e.scrapers[slug]; ok {
+		return scraper, func() {}, nil
+	}
+
+	return nil, nil, fmt.Errorf("no scraper registered for: %s", slug)
+}
+
 func (e *Engine) RunAll(ctx context.Context) error {
 	sources, err := e.sourceRepo.ListActive(ctx)
 	if err != nil {
@@ -44,96 +223,457 @@ func (e *Engine) RunAll(ctx context.Context) error {
 	}
 
 	for _, source := range sources {
-		if err := e.RunSource(ctx, source.Slug, 0); err != nil {
-			log.Printf("Error scraping %s: %v", source.Slug, err)
+		err := e.RunSource(ctx, source.Slug, 0)
+		if err != nil && !errors.Is(err, ErrSourceLocked) && !errors.Is(err, ErrBudgetExhausted) && !errors.Is(err, ErrSourceQuarantined) {
+			e.logger.Error("scrape failed", "source", source.Slug, "error", err)
 		}
 	}
 
 	return nil
 }
 
+// RunSource scrapes every listing of a source
 func (e *Engine) RunSource(ctx context.Context, slug string, limit int) error {
+	return e.runSource(ctx, slug, limit, true)
+}
+
+// RunSourceIncremental scrapes a source, letting scrapers that can tell which
+// listings changed (the sitemap strategy) skip the rest
+func (e *Engine) RunSourceIncremental(ctx context.Context, slug string, limit int) error {
+	return e.runSource(ctx, slug, limit, false)
+}
+
+func (e *Engine) runSource(ctx context.Context, slug string, limit int, full bool) error {
 	source, err := e.sourceRepo.GetBySlug(ctx, slug)
 	if err != nil {
 		return fmt.Errorf("source not found: %s", slug)
 	}
 
-	scraper, ok := e.scrapers[slug]
-	if !ok {
-		return fmt.Errorf("no scraper registered for: %s", slug)
+	cfg, err := domain.ParseSourceConfig(source.Config)
+	if err != nil {
+		return fmt.Errorf("%s: %w", slug, err)
+	}
+
+	if source.Quarantined(time.Now()) {
+		e.logger.Info("scrape skipped, source quarantined", "source", slug, "quarantined_until", source.QuarantinedUntil.UTC())
+		e.recordSkipped(ctx, source.ID, slug, domain.ScrapeJobStatusSkippedQuarantined)
+		return fmt.Errorf("%s: %w", slug, ErrSourceQuarantined)
 	}
 
+	// Overlapping runs double the load on the site and race on upserts
+	unlock, locked, err := e.sourceRepo.TryLockSource(ctx, source.ID)
+	if err != nil {
+		return fmt.Errorf("failed to lock source %s: %w", slug, err)
+	}
+	if !locked {
+		e.logger.Warn("scrape skipped, source already running", "source", slug)
+		e.recordSkipped(ctx, source.ID, slug, domain.ScrapeJobStatusSkippedLocked)
+		return fmt.Errorf("%s: %w", slug, ErrSourceLocked)
+	}
+	defer unlock()
+
+	budget, err := newRequestBudget(ctx, e.sourceRepo, source.ID, cfg.MaxRequestsPerDay, e.logger)
+	if errors.Is(err, ErrBudgetExhausted) {
+		e.logger.Info("scrape skipped, daily request budget spent", "source", slug, "limit", cfg.MaxRequestsPerDay)
+		e.recordSkipped(ctx, source.ID, slug, domain.ScrapeJobStatusBudgetExhausted)
+		return fmt.Errorf("%s: %w", slug, ErrBudgetExhausted)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load request budget for %s: %w", slug, err)
+	}
+
+	scraper, release, err := e.acquireScraper(slug, cfg.CrawlStrategy)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	// Create scrape job
 	job := &domain.ScrapeJob{
 		ID:        uuid.New(),
 		SourceID:  source.ID,
 		Status:    domain.ScrapeJobStatusRunning,
+		Trigger:   triggerFrom(ctx),
 		CreatedAt: time.Now(),
 	}
 	now := time.Now()
 	job.StartedAt = &now
 
 	if err := e.sourceRepo.CreateScrapeJob(ctx, job); err != nil {
-		log.Printf("Warning: failed to create scrape job: %v", err)
+		e.logger.Warn("failed to create scrape job", "source", slug, "error", err)
 	}
 
+	recorder := newRequestRecorder(ctx, e.sourceRepo, job.ID, e.logger)
+	defer recorder.Flush()
+
+	run := &runState{
+		sourceID: source.ID,
+		slug:     slug,
+		budget:   budget,
+		seen:     make(map[string]*domain.Listing),
+		batch:    make([]*domain.Listing, 0, upsertBatchSize),
+	}
+	run.sinks = e.newRunSinks(run)
+	e.loadFailedUpserts(ctx, run)
+
 	opts := domain.ScrapeOptions{
-		FullScrape:  true,
-		MaxListings: limit,
-		RateLimit:   2 * time.Second,
+		FullScrape:   full,
+		MaxListings:  limit,
+		RateLimit:    DefaultRateLimit,
+		BaseURL:      source.BaseURL,
+		StartPath:    cfg.StartPath,
+		SourceConfig: source.Config,
+		RecordRequest: func(url string, status int, err error) {
+			recorder.Record(url, status, err)
+			budget.Spend()
+		},
+	}
+	if e.limiter != nil {
+		opts.AcquireRequest = e.limiter.Wait
+	}
+	if !full && cfg.CrawlStrategy == domain.CrawlStrategySitemap {
+		known, err := e.listingRepo.ListingFreshness(ctx, source.ID)
+		if err != nil {
+			// Without it every listing is fetched, as in a full run
+			e.logger.Warn("failed to load known listings", "source", slug, "error", err)
+		} else {
+			opts.KnownListings = known
+			opts.MarkUnchanged = run.markUnchanged
+		}
+	}
+
+	if len(cfg.Segments) > 0 && cfg.CrawlStrategy == domain.CrawlStrategySearch {
+		job.FallbackUsed = e.crawlSegments(ctx, scraper, cfg.Segments, opts, run)
+	} else {
+		job.FallbackUsed = e.crawl(ctx, scraper, opts, run, 0)
+	}
+
+	sinkErr := e.flushSinks(ctx, run)
+	unchanged := e.touchUnchanged(ctx, slug, run)
+	recorder.Flush()
+
+	// Update job status
+	completedAt := time.Now()
+	job.Status = domain.ScrapeJobStatusCompleted
+	job.CompletedAt = &completedAt
+	job.ListingsFound = run.found
+	job.ListingsNew = run.created
+	job.ListingsUpdated = run.updated
+	if budget.Exhausted() {
+		job.Status = domain.ScrapeJobStatusBudgetExhausted
 	}
 
-	listings, errors := scraper.Scrape(ctx, opts)
+	if err := e.sourceRepo.UpdateScrapeJob(ctx, job); err != nil {
+		e.logger.Warn("failed to update scrape job", "source", slug, "error", err)
+	}
+	if quarantined := e.recordOutcome(ctx, run); !quarantined {
+		e.alertOutcome(ctx, run, job, unchanged)
+	}
+
+	if budget.Exhausted() {
+		e.logger.Info("scrape stopped, daily request budget spent", "source", slug, "found", run.found,
+			"new", run.created, "updated", run.updated, "limit", cfg.MaxRequestsPerDay)
+		return fmt.Errorf("%s: %w", slug, errors.Join(ErrBudgetExhausted, sinkErr))
+	}
+
+	if run.deadLettered > 0 {
+		e.logger.Info("skipped listings that repeatedly failed to upsert; run `trough replay-failed` after fixing them",
+			"source", slug, "listings", run.deadLettered)
+	}
+	e.logger.Info("scrape completed", "source", slug, "found", run.found, "new", run.created,
+		"updated", run.updated, "unchanged", unchanged, "skipped", run.skipped, "processor_errors", run.processorErrors,
+		"fallback", job.FallbackUsed)
+
+	if sinkErr != nil {
+		return fmt.Errorf("%s: %w", slug, sinkErr)
+	}
+	recordSuccess(slug, completedAt)
+	return nil
+}
+
+// alertOutcome alerts on a run that ended blocked, needed its fallback, or
+// completed without finding anything. A run stopped by the request budget
+// isn't alerted on, as it stopped early on purpose, nor one that quarantined
+// its source, which recordOutcome alerts on.
+func (e *Engine) alertOutcome(ctx context.Context, run *runState, job *domain.ScrapeJob, unchanged int) {
+	switch {
+	case job.Status == domain.ScrapeJobStatusBudgetExhausted:
+	case run.blocked:
+		e.alert(ctx, AlertBlocked, run.slug, run.found, "the source blocked the scraper; see the run's requests for the responses")
+	case job.FallbackUsed:
+		e.alert(ctx, AlertDegraded, run.slug, run.found, "the source blocked the primary scraper; the fallback scraper took over")
+	case run.found == 0 && unchanged == 0:
+		e.alert(ctx, AlertZeroYield, run.slug, 0, "the run completed without finding any listings; the site's markup may have changed")
+	}
+}
+
+// recordSkipped records a run that never started, with the reason as its status
+func (e *Engine) recordSkipped(ctx context.Context, sourceID uuid.UUID, slug, status string) {
+	now := time.Now()
+	job := &domain.ScrapeJob{
+		ID:          uuid.New(),
+		SourceID:    sourceID,
+		Status:      status,
+		Trigger:     triggerFrom(ctx),
+		StartedAt:   &now,
+		CompletedAt: &now,
+		CreatedAt:   now,
+	}
+	if err := e.sourceRepo.CreateScrapeJob(ctx, job); err != nil {
+		e.logger.Warn("failed to create scrape job", "source", slug, "error", err)
+		return
+	}
+	if err := e.sourceRepo.UpdateScrapeJob(ctx, job); err != nil {
+		e.logger.Warn("failed to update scrape job", "source", slug, "error", err)
+	}
+}
+
+// runState accumulates results across the primary and fallback scrapers of a run
+type runState struct {
+	sourceID                uuid.UUID
+	slug                    string
+	budget                  *requestBudget
+	found, created, updated int
+	seen                    map[string]*domain.Listing // first occurrence by external ID
+	batch                   []*domain.Listing
+	sinks                   []*runSink
+
+	// failed holds the failed upsert count of listings in failed_upserts,
+	// and deadLettered how many listings past the cap the run skipped
+	failed       map[string]int
+	deadLettered int
+
+	// skipped counts listings dropped by a ListingProcessor, and
+	// processorErrors the processor calls that failed
+	skipped         int
+	processorErrors int
+
+	// blocked is set if the last scraper to run reported a blocked ScrapeError
+	blocked bool
+	// version is the ScraperVersion of the scraper collected from
+	version int
+
+	// unchanged holds listings an incremental scraper skipped; scrapers
+	// report them from their own goroutine
+	mu        sync.Mutex
+	unchanged []string
+}
+
+func (run *runState) markUnchanged(externalID string) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.unchanged = append(run.unchanged, externalID)
+}
+
+// touchUnchanged marks the listings skipped as unchanged as seen in this run
+// and returns how many there were
+func (e *Engine) touchUnchanged(ctx context.Context, slug string, run *runState) int {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if len(run.unchanged) == 0 {
+		return 0
+	}
+	if err := e.listingRepo.TouchListings(ctx, run.sourceID, run.unchanged, time.Now()); err != nil {
+		e.logger.Error("failed to mark unchanged listings as seen", "source", slug, "listings", len(run.unchanged), "error", err)
+	}
+	return len(run.unchanged)
+}
+
+// collect consumes a scraper's output into run. If stopOnBlock is set it stops at
+// the first blocked ScrapeError and reports true, leaving the scraper to wind down.
+// It also stops, reporting false, once the run's request budget is spent.
+func (e *Engine) collect(ctx context.Context, scraper Scraper, opts domain.ScrapeOptions, run *runState, stopOnBlock bool) bool {
+	scrapeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	var found, created, updated int
+	run.version = ScraperVersion(scraper)
+	listings, errs := scraper.Scrape(scrapeCtx, opts)
 
 	for {
 		select {
 		case listing, ok := <-listings:
 			if !ok {
-				// Channel closed, done
-				goto done
+				return false
 			}
+			e.addListing(ctx, run, listing)
 
-			found++
-			listing.SourceID = source.ID
-			listing.LastSeenAt = time.Now()
-
-			if listing.ID == uuid.Nil {
-				listing.ID = uuid.New()
-				listing.FirstSeenAt = time.Now()
-				created++
-			} else {
-				updated++
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			e.logger.Error("scrape error", "source", scraper.Name(), "error", err)
+			if domain.IsBlocked(err) {
+				run.blocked = true
+			}
+			if stopOnBlock && domain.IsBlocked(err) {
+				cancel()
+				go drain(listings, errs)
+				return true
 			}
 
-			if err := e.listingRepo.Upsert(ctx, listing); err != nil {
-				log.Printf("Error upserting listing %s: %v", listing.ExternalID, err)
+		case <-run.budget.Done():
+			cancel()
+			go drain(listings, errs)
+			return false
+		}
+	}
+}
+
+// crawl collects a scraper's listings into run, switching to the source's
+// fallback scraper if it is blocked, and reports whether the fallback ran.
+// found is run.found before the crawl, which opts.MaxListings doesn't cover.
+func (e *Engine) crawl(ctx context.Context, scraper Scraper, opts domain.ScrapeOptions, run *runState, found int) bool {
+	_, hasFallback := e.fallbacks[run.slug]
+	if blocked := e.collect(ctx, scraper, opts, run, hasFallback); blocked {
+		return e.runFallback(ctx, run.slug, opts, run, found)
+	}
+	return false
+}
+
+// crawlSegments crawls each segment path as the start path in turn, sharing
+// opts.MaxListings across them. A listing found in several segments is
+// counted once. Once the source blocks, its fallback scraper is started,
+// once per run, and crawls the blocked segment and the rest. It stops early
+// once the source stays blocked, the request budget is spent or the limit is
+// reached, and reports whether the fallback scraper ran.
+func (e *Engine) crawlSegments(ctx context.Context, scraper Scraper, segments []string, opts domain.ScrapeOptions, run *runState) bool {
+	_, hasFallback := e.fallbacks[run.slug]
+	var fallback Scraper
+	for i, segment := range segments {
+		if ctx.Err() != nil || run.budget.Exhausted() {
+			break
+		}
+		segOpts := opts
+		segOpts.StartPath = segment
+		if opts.MaxListings > 0 {
+			if segOpts.MaxListings = opts.MaxListings - run.found; segOpts.MaxListings <= 0 {
+				break
 			}
+		}
 
-		case err, ok := <-errors:
+		e.logger.Info("crawling segment", "source", run.slug, "segment", segment, "n", i+1, "segments", len(segments))
+		if fallback != nil {
+			e.collect(ctx, fallback, segOpts, run, false)
+		} else if found := run.found; e.collect(ctx, scraper, segOpts, run, hasFallback) {
+			fallbackOpts, ok := remainingOpts(segOpts, run, found)
 			if !ok {
-				continue
+				break
+			}
+			var closeFallback func()
+			if fallback, closeFallback = e.newFallback(run.slug); fallback == nil {
+				break
 			}
-			log.Printf("Scrape error: %v", err)
+			defer closeFallback()
+			e.logger.Warn("scraper blocked, falling back for the remaining segments", "source", run.slug,
+				"listings", run.found, "fallback", fallback.Name(), "segments", len(segments)-i)
+			// The run counts as blocked only if the fallback is blocked too
+			run.blocked = false
+			e.collect(ctx, fallback, fallbackOpts, run, false)
+		}
+		if run.blocked {
+			e.logger.Warn("source blocked, skipping remaining segments", "source", run.slug, "skipped", len(segments)-i-1)
+			break
 		}
 	}
+	return fallback != nil
+}
 
-done:
-	// Update job status
-	completedAt := time.Now()
-	job.Status = domain.ScrapeJobStatusCompleted
-	job.CompletedAt = &completedAt
-	job.ListingsFound = found
-	job.ListingsNew = created
-	job.ListingsUpdated = updated
+// runFallback re-runs a blocked source with its fallback scraper, at most once per
+// crawl. Listings already collected since found are not counted again against
+// opts.MaxListings. Reports whether it ran.
+func (e *Engine) runFallback(ctx context.Context, slug string, opts domain.ScrapeOptions, run *runState, found int) bool {
+	opts, ok := remainingOpts(opts, run, found)
+	if !ok {
+		return false
+	}
 
-	if err := e.sourceRepo.UpdateScrapeJob(ctx, job); err != nil {
-		log.Printf("Warning: failed to update scrape job: %v", err)
+	fallback, closeFallback := e.newFallback(slug)
+	if fallback == nil {
+		return false
 	}
+	defer closeFallback()
 
-	log.Printf("Scrape completed for %s: found=%d, new=%d, updated=%d",
-		slug, found, created, updated)
+	e.logger.Warn("scraper blocked, falling back", "source", slug, "listings", run.found, "fallback", fallback.Name())
+	// The run counts as blocked only if the fallback is blocked too
+	run.blocked = false
+	e.collect(ctx, fallback, opts, run, false)
+	return true
+}
 
-	return nil
+// remainingOpts takes the listings collected since found off opts.MaxListings,
+// reporting false if that leaves none to collect
+func remainingOpts(opts domain.ScrapeOptions, run *runState, found int) (domain.ScrapeOptions, bool) {
+	if opts.MaxListings > 0 {
+		if opts.MaxListings -= run.found - found; opts.MaxListings <= 0 {
+			return opts, false
+		}
+	}
+	return opts, true
+}
+
+// newFallback constructs the source's fallback scraper, returned with a func
+// closing it, or nil if it couldn't be created
+func (e *Engine) newFallback(slug string) (Scraper, func()) {
+	fallback, err := e.fallbacks[slug]()
+	if err != nil {
+		e.logger.Error("failed to create fallback scraper", "source", slug, "error", err)
+		return nil, nil
+	}
+	closeFallback := func() {}
+	if closer, ok := fallback.(io.Closer); ok {
+		closeFallback = func() {
+			if err := closer.Close(); err != nil {
+				e.logger.Warn("failed to close fallback scraper", "source", slug, "error", err)
+			}
+		}
+	}
+	return fallback, closeFallback
+}
+
+// addListing runs a scraped listing through the processors, then counts it
+// and passes it to the run's sinks
+func (e *Engine) addListing(ctx context.Context, run *runState, listing *domain.Listing) {
+	listing.SourceID = run.sourceID
+	listing.LastSeenAt = time.Now()
+	listing.ParsedByVersion = run.version
+
+	if !e.process(ctx, run, listing) {
+		run.skipped++
+		return
+	}
+
+	// Scrapers can emit the same listing twice (overlapping selectors,
+	// re-fetched pages); only count it once and let the batch keep the latest,
+	// with the ID and first sighting given to the first
+	if first, ok := run.seen[listing.ExternalID]; ok {
+		e.logger.Debug("duplicate listing in run, keeping latest", "external_id", listing.ExternalID)
+		if listing.ID == uuid.Nil {
+			listing.ID = first.ID
+			listing.FirstSeenAt = first.FirstSeenAt
+		}
+	} else {
+		run.seen[listing.ExternalID] = listing
+		run.found++
+
+		if listing.ID == uuid.Nil {
+			listing.ID = uuid.New()
+			listing.FirstSeenAt = time.Now()
+			run.created++
+		} else {
+			run.updated++
+		}
+	}
+
+	e.writeSinks(ctx, run, listing)
+}
+
+// drain discards a cancelled scraper's remaining output so its goroutine can exit
+func drain(listings <-chan *domain.Listing, errs <-chan error) {
+	for range listings {
+	}
+	if errs != nil {
+		for range errs {
+		}
+	}
 }
@@ -0,0 +1,1050 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// fakeSourceStore is an in-memory SourceStore
+type fakeSourceStore struct {
+	fakeRequestStore
+	mu      sync.Mutex
+	sources map[string]*domain.Source
+	jobs    map[uuid.UUID]domain.ScrapeJob
+	locked  map[uuid.UUID]bool
+	// budget holds each source's requests today
+	budget map[uuid.UUID]int
+}
+
+func newFakeSourceStore(slugs ...string) *fakeSourceStore {
+	f := &fakeSourceStore{
+		sources: make(map[string]*domain.Source),
+		jobs:    make(map[uuid.UUID]domain.ScrapeJob),
+		locked:  make(map[uuid.UUID]bool),
+		budget:  make(map[uuid.UUID]int),
+	}
+	for _, slug := range slugs {
+		f.sources[slug] = &domain.Source{ID: uuid.New(), Slug: slug, Name: slug, IsActive: true}
+	}
+	return f
+}
+
+func (f *fakeSourceStore) GetBySlug(ctx context.Context, slug string) (*domain.Source, error) {
+	if s, ok := f.sources[slug]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("not found")
+}
+
+func (f *fakeSourceStore) ListActive(ctx context.Context) ([]domain.Source, error) {
+	var sources []domain.Source
+	for _, s := range f.sources {
+		sources = append(sources, *s)
+	}
+	return sources, nil
+}
+
+func (f *fakeSourceStore) CreateScrapeJob(ctx context.Context, job *domain.ScrapeJob) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobs[job.ID] = *job
+	return nil
+}
+
+func (f *fakeSourceStore) UpdateScrapeJob(ctx context.Context, job *domain.ScrapeJob) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobs[job.ID] = *job
+	return nil
+}
+
+func (f *fakeSourceStore) TryLockSource(ctx context.Context, sourceID uuid.UUID) (func(), bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.locked[sourceID] {
+		return nil, false, nil
+	}
+	f.locked[sourceID] = true
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.locked, sourceID)
+	}, true, nil
+}
+
+func (f *fakeSourceStore) RequestBudgetUsed(ctx context.Context, sourceID uuid.UUID) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.budget[sourceID], nil
+}
+
+func (f *fakeSourceStore) SpendRequestBudget(ctx context.Context, sourceID uuid.UUID, limit int) (int, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.budget[sourceID] >= limit {
+		return f.budget[sourceID], false, nil
+	}
+	f.budget[sourceID]++
+	return f.budget[sourceID], true, nil
+}
+
+func (f *fakeSourceStore) RecordScrapeOutcome(ctx context.Context, sourceID uuid.UUID, blocked bool, threshold int, cooldown time.Duration) (int, *time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.sources {
+		if s.ID != sourceID {
+			continue
+		}
+		if !blocked {
+			s.ConsecutiveBlocks, s.QuarantinedUntil = 0, nil
+			return 0, nil, nil
+		}
+		s.ConsecutiveBlocks++
+		if s.ConsecutiveBlocks >= threshold {
+			until := time.Now().Add(cooldown)
+			s.QuarantinedUntil = &until
+		}
+		return s.ConsecutiveBlocks, s.QuarantinedUntil, nil
+	}
+	return 0, nil, fmt.Errorf("not found")
+}
+
+// fakeListingStore records upserted and touched listings. Listings whose
+// external ID is in reject fail to upsert and are counted in failed.
+type fakeListingStore struct {
+	mu        sync.Mutex
+	upserted  []*domain.Listing
+	freshness map[string]domain.ListingFreshness
+	touched   []string
+	reject    map[string]bool
+	failed    map[string]int
+	attempted []string
+}
+
+func (f *fakeListingStore) Upsert(ctx context.Context, listing *domain.Listing) error {
+	return f.UpsertBatch(ctx, []*domain.Listing{listing})
+}
+
+func (f *fakeListingStore) UpsertBatch(ctx context.Context, listings []*domain.Listing) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, l := range listings {
+		f.attempted = append(f.attempted, l.ExternalID)
+		if f.reject[l.ExternalID] {
+			return fmt.Errorf("violates check constraint")
+		}
+	}
+	f.upserted = append(f.upserted, listings...)
+	return nil
+}
+
+func (f *fakeListingStore) RecordFailedUpsert(ctx context.Context, listing *domain.Listing, upsertErr error) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failed == nil {
+		f.failed = make(map[string]int)
+	}
+	f.failed[listing.ExternalID]++
+	return f.failed[listing.ExternalID], nil
+}
+
+func (f *fakeListingStore) FailedUpsertAttempts(ctx context.Context, sourceID uuid.UUID) (map[string]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attempts := make(map[string]int, len(f.failed))
+	for id, n := range f.failed {
+		attempts[id] = n
+	}
+	return attempts, nil
+}
+
+func (f *fakeListingStore) ClearFailedUpserts(ctx context.Context, sourceID uuid.UUID, externalIDs []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range externalIDs {
+		delete(f.failed, id)
+	}
+	return nil
+}
+
+func (f *fakeListingStore) ListingFreshness(ctx context.Context, sourceID uuid.UUID) (map[string]domain.ListingFreshness, error) {
+	return f.freshness, nil
+}
+
+func (f *fakeListingStore) TouchListings(ctx context.Context, sourceID uuid.UUID, externalIDs []string, seenAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.touched = append(f.touched, externalIDs...)
+	return nil
+}
+
+// fakeScraper emits a fixed set of listings, records its options and counts Close calls
+type fakeScraper struct {
+	listings []*domain.Listing
+	opts     domain.ScrapeOptions
+	closed   int
+}
+
+func (s *fakeScraper) Name() string { return "fake" }
+
+func (s *fakeScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
+	s.opts = opts
+	listings := make(chan *domain.Listing, len(s.listings))
+	errors := make(chan error)
+	for _, l := range s.listings {
+		listings <- l
+	}
+	close(listings)
+	close(errors)
+	return listings, errors
+}
+
+func (s *fakeScraper) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestRunSourceClosesFactoryScraper(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+
+	var created []*fakeScraper
+	eng.RegisterScraperFactory("fake", func() (Scraper, error) {
+		s := &fakeScraper{listings: []*domain.Listing{{ExternalID: "1", Title: "One"}}}
+		created = append(created, s)
+		return s, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+			t.Fatalf("RunSource: %v", err)
+		}
+	}
+
+	if len(created) != 2 {
+		t.Fatalf("factory called %d times, want 2", len(created))
+	}
+	for i, s := range created {
+		if s.closed != 1 {
+			t.Errorf("scraper %d closed %d times, want 1", i, s.closed)
+		}
+	}
+}
+
+func TestEngineCloseClosesRegisteredScrapers(t *testing.T) {
+	eng := NewEngine(newFakeSourceStore("fake"), &fakeListingStore{}, nil)
+	scraper := &fakeScraper{}
+	eng.RegisterScraper("fake", scraper)
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+	if scraper.closed != 0 {
+		t.Error("shared scraper closed after a single run")
+	}
+
+	if err := eng.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if scraper.closed != 1 {
+		t.Errorf("closed %d times, want 1", scraper.closed)
+	}
+}
+
+func TestRunSourcePassesSiteFromSource(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        string
+		wantStartPath string
+		wantErr       bool
+	}{
+		{"no config", "", "", false},
+		{"start path", `{"start_path":"/search/all/"}`, "/search/all/", false},
+		{"invalid config", `{"start_path":"search"}`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := newFakeSourceStore("fake")
+			sources.sources["fake"].BaseURL = "https://mirror.example.com"
+			sources.sources["fake"].Config = []byte(tt.config)
+
+			eng := NewEngine(sources, &fakeListingStore{}, nil)
+			scraper := &fakeScraper{}
+			eng.RegisterScraper("fake", scraper)
+
+			err := eng.RunSource(context.Background(), "fake", 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunSource err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if scraper.opts.BaseURL != "https://mirror.example.com" {
+				t.Errorf("BaseURL = %q, want the source's base_url", scraper.opts.BaseURL)
+			}
+			if scraper.opts.StartPath != tt.wantStartPath {
+				t.Errorf("StartPath = %q, want %q", scraper.opts.StartPath, tt.wantStartPath)
+			}
+		})
+	}
+}
+
+func TestRunSourceDuplicateListings(t *testing.T) {
+	listings := &fakeListingStore{}
+	eng := NewEngine(newFakeSourceStore("fake"), listings, nil)
+	eng.RegisterScraper("fake", &fakeScraper{listings: []*domain.Listing{
+		{ExternalID: "1", Title: "First"},
+		{ExternalID: "1", Title: "Second"},
+	}})
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	// The fake store doesn't dedupe, so the engine batch still holds both;
+	// the real repository collapses them. Job stats must count one listing.
+	for _, job := range eng.sourceRepo.(*fakeSourceStore).jobs {
+		if job.ListingsFound != 1 {
+			t.Errorf("ListingsFound = %d, want 1", job.ListingsFound)
+		}
+	}
+
+	// Whichever copy is kept is the listing first seen, ID and all
+	if len(listings.upserted) != 2 {
+		t.Fatalf("upserted %d listings, want 2", len(listings.upserted))
+	}
+	first, latest := listings.upserted[0], listings.upserted[1]
+	if latest.ID == uuid.Nil || latest.FirstSeenAt.IsZero() {
+		t.Errorf("kept duplicate has ID %s, first seen %v; want both set", latest.ID, latest.FirstSeenAt)
+	}
+	if latest.ID != first.ID || !latest.FirstSeenAt.Equal(first.FirstSeenAt) {
+		t.Errorf("duplicate has ID %s, first seen %v; want the first's %s, %v", latest.ID, latest.FirstSeenAt, first.ID, first.FirstSeenAt)
+	}
+}
+
+// versionedScraper is a fakeScraper numbering its parsing
+type versionedScraper struct {
+	*fakeScraper
+	version int
+}
+
+func (s *versionedScraper) Version() int { return s.version }
+
+func TestRunSourceRecordsScraperVersion(t *testing.T) {
+	listings := &fakeListingStore{}
+	eng := NewEngine(newFakeSourceStore("fake", "plain"), listings, nil)
+	eng.RegisterScraper("fake", &versionedScraper{&fakeScraper{listings: []*domain.Listing{{ExternalID: "1", Title: "Cafe"}}}, 2})
+	eng.RegisterScraper("plain", &fakeScraper{listings: []*domain.Listing{{ExternalID: "2", Title: "Deli"}}})
+
+	for _, slug := range []string{"fake", "plain"} {
+		if err := eng.RunSource(context.Background(), slug, 0); err != nil {
+			t.Fatalf("RunSource %s: %v", slug, err)
+		}
+	}
+	want := map[string]int{"1": 2, "2": 0}
+	for _, l := range listings.upserted {
+		if l.ParsedByVersion != want[l.ExternalID] {
+			t.Errorf("listing %s ParsedByVersion = %d, want %d", l.ExternalID, l.ParsedByVersion, want[l.ExternalID])
+		}
+	}
+}
+
+func TestRunSourceRecordsFailedUpserts(t *testing.T) {
+	listings := &fakeListingStore{reject: map[string]bool{"bad": true}}
+	eng := NewEngine(newFakeSourceStore("fake"), listings, nil)
+	eng.RegisterScraper("fake", &fakeScraper{listings: []*domain.Listing{
+		{ExternalID: "good", Title: "Good"},
+		{ExternalID: "bad", Title: "Bad"},
+	}})
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	if len(listings.upserted) != 1 || listings.upserted[0].ExternalID != "good" {
+		t.Errorf("upserted %d listings, want only good", len(listings.upserted))
+	}
+	if listings.failed["bad"] != 1 {
+		t.Errorf("bad failed %d times, want 1", listings.failed["bad"])
+	}
+}
+
+func TestRunSourceSkipsListingsPastRetryCap(t *testing.T) {
+	listings := &fakeListingStore{reject: map[string]bool{"bad": true}}
+	eng := NewEngine(newFakeSourceStore("fake"), listings, nil)
+	eng.RegisterScraper("fake", &fakeScraper{listings: []*domain.Listing{
+		{ExternalID: "bad", Title: "Bad"},
+	}})
+
+	for i := 0; i < maxUpsertAttempts+2; i++ {
+		if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+			t.Fatalf("RunSource: %v", err)
+		}
+	}
+
+	if listings.failed["bad"] != maxUpsertAttempts {
+		t.Errorf("bad failed %d times, want %d", listings.failed["bad"], maxUpsertAttempts)
+	}
+	// Each attempted run tries the batch, then the listing alone
+	if len(listings.attempted) != 2*maxUpsertAttempts {
+		t.Errorf("upsert attempted %d times, want %d", len(listings.attempted), 2*maxUpsertAttempts)
+	}
+}
+
+func TestRunSourceClearsRecoveredFailedUpserts(t *testing.T) {
+	listings := &fakeListingStore{failed: map[string]int{"fixed": 2}}
+	eng := NewEngine(newFakeSourceStore("fake"), listings, nil)
+	eng.RegisterScraper("fake", &fakeScraper{listings: []*domain.Listing{
+		{ExternalID: "fixed", Title: "Fixed"},
+	}})
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	if _, ok := listings.failed["fixed"]; ok {
+		t.Error("recovered listing still in failed upserts")
+	}
+}
+
+// blockedScraper emits its listings, then a blocked ScrapeError, and keeps its
+// channels open until the run is cancelled, like a colly crawl that got a 403
+type blockedScraper struct {
+	listings []*domain.Listing
+}
+
+func (s *blockedScraper) Name() string { return "blocked" }
+
+func (s *blockedScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
+	listings := make(chan *domain.Listing)
+	errs := make(chan error)
+	go func() {
+		defer close(listings)
+		defer close(errs)
+		for _, l := range s.listings {
+			select {
+			case listings <- l:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case errs <- &domain.ScrapeError{Source: "fake", Kind: domain.ScrapeErrorBlocked, Status: 403, Err: fmt.Errorf("Forbidden")}:
+		case <-ctx.Done():
+			return
+		}
+		<-ctx.Done()
+	}()
+	return listings, errs
+}
+
+func TestRunSourceFallsBackWhenBlocked(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	store := &fakeListingStore{}
+	eng := NewEngine(sources, store, nil)
+	eng.RegisterScraper("fake", &blockedScraper{listings: []*domain.Listing{{ExternalID: "1"}}})
+
+	var fallbacks []*fakeScraper
+	eng.RegisterFallbackScraperFactory("fake", func() (Scraper, error) {
+		s := &fakeScraper{listings: []*domain.Listing{{ExternalID: "1"}, {ExternalID: "2"}}}
+		fallbacks = append(fallbacks, s)
+		return s, nil
+	})
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	if len(fallbacks) != 1 {
+		t.Fatalf("fallback created %d times, want 1", len(fallbacks))
+	}
+	if fallbacks[0].closed != 1 {
+		t.Errorf("fallback closed %d times, want 1", fallbacks[0].closed)
+	}
+	for _, job := range sources.jobs {
+		if !job.FallbackUsed {
+			t.Error("FallbackUsed = false, want true")
+		}
+		if job.ListingsFound != 2 {
+			t.Errorf("ListingsFound = %d, want 2 (listing 1 counted once)", job.ListingsFound)
+		}
+	}
+	// The fallback got through, so the run doesn't count towards quarantine
+	if blocks := sources.sources["fake"].ConsecutiveBlocks; blocks != 0 {
+		t.Errorf("ConsecutiveBlocks = %d, want 0", blocks)
+	}
+}
+
+func TestRunSourceFallbackRunsOnce(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+	eng.RegisterScraper("fake", &blockedScraper{})
+
+	calls := 0
+	eng.RegisterFallbackScraperFactory("fake", func() (Scraper, error) {
+		calls++
+		return &blockedScraper{listings: []*domain.Listing{{ExternalID: "1"}}}, nil
+	})
+
+	// The fallback is blocked too and runs until cancelled; it must not fall back again
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := eng.RunSource(ctx, "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("fallback created %d times, want 1", calls)
+	}
+	for _, job := range sources.jobs {
+		if job.ListingsFound != 1 {
+			t.Errorf("ListingsFound = %d, want 1", job.ListingsFound)
+		}
+	}
+}
+
+func TestRunSourceBlockedWithoutFallback(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+	eng.RegisterScraper("fake", &blockedScraper{listings: []*domain.Listing{{ExternalID: "1"}}})
+
+	// Without a fallback the engine keeps consuming the blocked scraper until it ends
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := eng.RunSource(ctx, "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	for _, job := range sources.jobs {
+		if job.FallbackUsed {
+			t.Error("FallbackUsed = true without a registered fallback")
+		}
+		if job.ListingsFound != 1 {
+			t.Errorf("ListingsFound = %d, want 1", job.ListingsFound)
+		}
+	}
+}
+
+func TestRunSourceQuarantinesAfterRepeatedBlocks(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+	eng.RegisterScraper("fake", &blockedScraper{})
+
+	runBlocked := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return eng.RunSource(ctx, "fake", 0)
+	}
+
+	for i := 1; i <= quarantineThreshold; i++ {
+		if err := runBlocked(); err != nil {
+			t.Fatalf("blocked run %d: %v", i, err)
+		}
+		if quarantined := sources.sources["fake"].Quarantined(time.Now()); quarantined != (i == quarantineThreshold) {
+			t.Fatalf("after %d blocked runs quarantined = %v", i, quarantined)
+		}
+	}
+
+	until := sources.sources["fake"].QuarantinedUntil
+	if d := time.Until(*until); d < quarantineCooldown-time.Minute || d > quarantineCooldown {
+		t.Errorf("quarantined for %v, want %v", d, quarantineCooldown)
+	}
+
+	// Further runs are skipped and recorded as such
+	jobs := len(sources.jobs)
+	if err := runBlocked(); !errors.Is(err, ErrSourceQuarantined) {
+		t.Fatalf("RunSource = %v, want ErrSourceQuarantined", err)
+	}
+	if len(sources.jobs) != jobs+1 {
+		t.Fatalf("got %d new jobs, want 1", len(sources.jobs)-jobs)
+	}
+	skipped := 0
+	for _, job := range sources.jobs {
+		if job.Status == domain.ScrapeJobStatusSkippedQuarantined {
+			skipped++
+		}
+	}
+	if skipped != 1 {
+		t.Errorf("%d skipped_quarantined jobs, want 1", skipped)
+	}
+
+	// RunAll doesn't report a quarantined source as failed
+	if err := eng.RunAll(context.Background()); err != nil {
+		t.Errorf("RunAll: %v", err)
+	}
+}
+
+func TestRunSourceResetsBlocksAfterUnblockedRun(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	sources.sources["fake"].ConsecutiveBlocks = quarantineThreshold - 1
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+	eng.RegisterScraper("fake", &fakeScraper{listings: []*domain.Listing{{ExternalID: "1"}}})
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+	if blocks := sources.sources["fake"].ConsecutiveBlocks; blocks != 0 {
+		t.Errorf("ConsecutiveBlocks = %d, want 0", blocks)
+	}
+}
+
+// gatedScraper signals started when a run begins and holds it open until
+// release is closed
+type gatedScraper struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *gatedScraper) Name() string { return "gated" }
+
+func (s *gatedScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
+	listings := make(chan *domain.Listing)
+	errors := make(chan error)
+	go func() {
+		defer close(listings)
+		defer close(errors)
+		s.started <- struct{}{}
+		<-s.release
+	}()
+	return listings, errors
+}
+
+func TestRunSourceSkipsWhenLocked(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+	scraper := &gatedScraper{started: make(chan struct{}, 2), release: make(chan struct{})}
+	eng.RegisterScraper("fake", scraper)
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- eng.RunSource(context.Background(), "fake", 0)
+		}()
+	}
+
+	// Whichever run lost the race returns while the winner is still scraping
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrSourceLocked) {
+			t.Fatalf("first result = %v, want ErrSourceLocked", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("neither run was skipped")
+	}
+
+	close(scraper.release)
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("locked run failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("locked run did not finish")
+	}
+
+	if len(scraper.started) != 1 {
+		t.Errorf("scraper started %d times, want 1", len(scraper.started))
+	}
+
+	statuses := make(map[string]int)
+	for _, job := range sources.jobs {
+		statuses[job.Status]++
+	}
+	if statuses[domain.ScrapeJobStatusCompleted] != 1 || statuses[domain.ScrapeJobStatusSkippedLocked] != 1 {
+		t.Errorf("job statuses = %v, want one completed and one skipped_locked", statuses)
+	}
+
+	// The lock is released once the run finishes
+	if sources.locked[sources.sources["fake"].ID] {
+		t.Error("source still locked after the run finished")
+	}
+}
+
+// pagedScraper fetches pages, one listing each, until it runs out or the run is cancelled
+type pagedScraper struct {
+	pages int
+	runs  int
+}
+
+func (s *pagedScraper) Name() string { return "paged" }
+
+func (s *pagedScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
+	s.runs++
+	listings := make(chan *domain.Listing)
+	errors := make(chan error)
+	go func() {
+		defer close(listings)
+		defer close(errors)
+		for i := 1; i <= s.pages && ctx.Err() == nil; i++ {
+			opts.Record(fmt.Sprintf("https://example.com/page/%d", i), 200, nil)
+			select {
+			case listings <- &domain.Listing{ExternalID: fmt.Sprint(i)}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return listings, errors
+}
+
+func TestRunSourceStopsWhenBudgetSpent(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	source := sources.sources["fake"]
+	source.Config = json.RawMessage(`{"max_requests_per_day":3}`)
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+	scraper := &pagedScraper{pages: 10}
+	eng.RegisterScraper("fake", scraper)
+
+	err := eng.RunSource(context.Background(), "fake", 0)
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("RunSource = %v, want ErrBudgetExhausted", err)
+	}
+	if used := sources.budget[source.ID]; used != 3 {
+		t.Errorf("budget used = %d, want 3", used)
+	}
+
+	// Later runs the same day don't start the scraper
+	err = eng.RunSource(context.Background(), "fake", 0)
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("second RunSource = %v, want ErrBudgetExhausted", err)
+	}
+	if scraper.runs != 1 {
+		t.Errorf("scraper ran %d times, want 1", scraper.runs)
+	}
+
+	for _, job := range sources.jobs {
+		if job.Status != domain.ScrapeJobStatusBudgetExhausted {
+			t.Errorf("job status = %q, want %q", job.Status, domain.ScrapeJobStatusBudgetExhausted)
+		}
+	}
+	if len(sources.jobs) != 2 {
+		t.Errorf("recorded %d jobs, want 2", len(sources.jobs))
+	}
+}
+
+func TestRunSourceWithoutBudget(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+	eng.RegisterScraper("fake", &pagedScraper{pages: 10})
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource failed: %v", err)
+	}
+	if len(sources.budget) != 0 {
+		t.Errorf("requests counted without a budget: %v", sources.budget)
+	}
+}
+
+func TestRunSourceRecordsTrigger(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"api", WithTrigger(context.Background(), domain.ScrapeTriggerAPI), domain.ScrapeTriggerAPI},
+		{"none set", context.Background(), domain.ScrapeTriggerManual},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := newFakeSourceStore("fake")
+			eng := NewEngine(sources, &fakeListingStore{}, nil)
+			eng.RegisterScraper("fake", &pagedScraper{pages: 1})
+
+			if err := eng.RunSource(tt.ctx, "fake", 0); err != nil {
+				t.Fatalf("RunSource failed: %v", err)
+			}
+			for _, job := range sources.jobs {
+				if job.Trigger != tt.want {
+					t.Errorf("job trigger = %q, want %q", job.Trigger, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunSourceSitemapStrategy(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	sources.sources["fake"].Config = json.RawMessage(`{"crawl_strategy":"sitemap","sitemap":{"listing_pattern":"/listing/"}}`)
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+
+	search := &fakeScraper{}
+	eng.RegisterScraper("fake", search)
+
+	// Without a sitemap scraper the run fails rather than crawling search pages
+	if err := eng.RunSource(context.Background(), "fake", 0); err == nil {
+		t.Fatal("RunSource succeeded without a sitemap scraper")
+	}
+
+	sitemap := &fakeScraper{listings: []*domain.Listing{{ExternalID: "1"}}}
+	eng.SetSitemapScraper(sitemap)
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource failed: %v", err)
+	}
+	if string(sitemap.opts.SourceConfig) != string(sources.sources["fake"].Config) {
+		t.Error("sitemap scraper did not receive the source config")
+	}
+	if search.opts.SourceConfig != nil {
+		t.Error("search scraper ran for a sitemap source")
+	}
+}
+
+func TestRunSourceAPIStrategy(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	sources.sources["fake"].Config = json.RawMessage(`{"crawl_strategy":"api","api":{"endpoint":"/api/search","results":"items","fields":{"external_id":"id","title":"name","url":"link"}}}`)
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+
+	search := &fakeScraper{}
+	eng.RegisterScraper("fake", search)
+	if err := eng.RunSource(context.Background(), "fake", 0); err == nil {
+		t.Fatal("RunSource succeeded without an api scraper")
+	}
+
+	api := &fakeScraper{listings: []*domain.Listing{{ExternalID: "1"}}}
+	eng.SetAPIScraper(api)
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource failed: %v", err)
+	}
+	if string(api.opts.SourceConfig) != string(sources.sources["fake"].Config) {
+		t.Error("api scraper did not receive the source config")
+	}
+	if search.opts.SourceConfig != nil {
+		t.Error("search scraper ran for an api source")
+	}
+}
+
+// incrementalScraper skips the listings in KnownListings and emits the rest
+type incrementalScraper struct {
+	ids  []string
+	opts domain.ScrapeOptions
+}
+
+func (s *incrementalScraper) Name() string { return "incremental" }
+
+func (s *incrementalScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
+	s.opts = opts
+	listings := make(chan *domain.Listing, len(s.ids))
+	errors := make(chan error)
+	for _, id := range s.ids {
+		if _, ok := opts.KnownListings[id]; ok && !opts.FullScrape {
+			opts.Unchanged(id)
+			continue
+		}
+		listings <- &domain.Listing{ExternalID: id}
+	}
+	close(listings)
+	close(errors)
+	return listings, errors
+}
+
+func TestRunSourceIncrementalTouchesUnchanged(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	sources.sources["fake"].Config = json.RawMessage(`{"crawl_strategy":"sitemap","sitemap":{"listing_pattern":"/listing/"}}`)
+	listings := &fakeListingStore{freshness: map[string]domain.ListingFreshness{
+		"1": {LastSeenAt: time.Now().Add(-24 * time.Hour)},
+	}}
+	eng := NewEngine(sources, listings, nil)
+	scraper := &incrementalScraper{ids: []string{"1", "2"}}
+	eng.SetSitemapScraper(scraper)
+
+	if err := eng.RunSourceIncremental(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSourceIncremental failed: %v", err)
+	}
+	if scraper.opts.FullScrape {
+		t.Error("incremental run passed FullScrape")
+	}
+	if len(listings.upserted) != 1 || listings.upserted[0].ExternalID != "2" {
+		t.Errorf("upserted %v, want only the new listing", listings.upserted)
+	}
+	if len(listings.touched) != 1 || listings.touched[0] != "1" {
+		t.Errorf("touched %v, want the unchanged listing", listings.touched)
+	}
+
+	// A full run neither loads known listings nor skips any
+	listings.upserted, listings.touched = nil, nil
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource failed: %v", err)
+	}
+	if scraper.opts.KnownListings != nil {
+		t.Error("full run passed known listings")
+	}
+	if len(listings.upserted) != 2 || len(listings.touched) != 0 {
+		t.Errorf("full run upserted %d and touched %d, want 2 and 0", len(listings.upserted), len(listings.touched))
+	}
+}
+
+func TestRunSourceRecordsLastSuccess(t *testing.T) {
+	eng := NewEngine(newFakeSourceStore("fresh"), &fakeListingStore{}, nil)
+	eng.RegisterScraper("fresh", &fakeScraper{listings: []*domain.Listing{{ExternalID: "1", Title: "One"}}})
+
+	before := float64(time.Now().Unix())
+	if err := eng.RunSource(context.Background(), "fresh", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	got := testutil.ToFloat64(scrapeLastSuccess.WithLabelValues("fresh"))
+	if got < before || got > float64(time.Now().Unix()+1) {
+		t.Errorf("last success = %v, want about %v", got, before)
+	}
+
+	// Staleness is worked out when metrics are collected
+	recordSuccess("fresh", time.Now().Add(-time.Hour))
+	ch := make(chan prometheus.Metric, 16)
+	lastSuccess.Collect(ch)
+	close(ch)
+	var staleness float64
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if pb.GetLabel()[0].GetValue() == "fresh" {
+			staleness = pb.GetGauge().GetValue()
+		}
+	}
+	if staleness < time.Hour.Seconds() || staleness > time.Hour.Seconds()+60 {
+		t.Errorf("staleness = %vs, want about an hour", staleness)
+	}
+}
+
+func TestSeedLastSuccess(t *testing.T) {
+	now := time.Now()
+	recordSuccess("seeded-newer", now)
+	SeedLastSuccess(map[string]time.Time{
+		"seeded":       now.Add(-2 * time.Hour),
+		"seeded-newer": now.Add(-time.Hour),
+	})
+
+	lastSuccess.mu.Lock()
+	defer lastSuccess.mu.Unlock()
+	if got := lastSuccess.times["seeded"]; !got.Equal(now.Add(-2 * time.Hour)) {
+		t.Errorf("seeded = %v, want the seeded time", got)
+	}
+	if got := lastSuccess.times["seeded-newer"]; !got.Equal(now) {
+		t.Errorf("seeded-newer = %v, want the later recorded success kept", got)
+	}
+	want := float64(now.Add(-2*time.Hour).UnixNano()) / 1e9
+	if got := testutil.ToFloat64(scrapeLastSuccess.WithLabelValues("seeded")); got != want {
+		t.Errorf("last success gauge = %v, want %v", got, want)
+	}
+}
+
+// segmentScraper emits the listings configured for each start path and
+// records the paths it was run with
+type segmentScraper struct {
+	mu       sync.Mutex
+	segments map[string][]string
+	visited  []string
+}
+
+func (s *segmentScraper) Name() string { return "fake" }
+
+func (s *segmentScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
+	s.mu.Lock()
+	s.visited = append(s.visited, opts.StartPath)
+	ids := s.segments[opts.StartPath]
+	s.mu.Unlock()
+
+	listings := make(chan *domain.Listing, len(ids))
+	errs := make(chan error)
+	for i, id := range ids {
+		if opts.MaxListings > 0 && i >= opts.MaxListings {
+			break
+		}
+		listings <- &domain.Listing{ExternalID: id, Title: "Listing " + id}
+	}
+	close(listings)
+	close(errs)
+	return listings, errs
+}
+
+func TestRunSourceCrawlsSegments(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	sources.sources["fake"].Config = json.RawMessage(`{"segments":["/for-sale/texas/","/for-sale/?industry=restaurants","/for-sale/florida/"]}`)
+	listings := &fakeListingStore{}
+	eng := NewEngine(sources, listings, nil)
+	scraper := &segmentScraper{segments: map[string][]string{
+		"/for-sale/texas/":                {"1", "2"},
+		"/for-sale/?industry=restaurants": {"3", "2"},
+		"/for-sale/florida/":              {"4"},
+	}}
+	eng.RegisterScraper("fake", scraper)
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	want := []string{"/for-sale/texas/", "/for-sale/?industry=restaurants", "/for-sale/florida/"}
+	if !reflect.DeepEqual(scraper.visited, want) {
+		t.Errorf("visited %q, want %q", scraper.visited, want)
+	}
+	// Listing 2 is in two segments but counts once
+	for _, job := range sources.jobs {
+		if job.ListingsFound != 4 {
+			t.Errorf("found %d listings, want 4", job.ListingsFound)
+		}
+	}
+	upserted := map[string]bool{}
+	for _, l := range listings.upserted {
+		upserted[l.ExternalID] = true
+	}
+	if len(upserted) != 4 {
+		t.Errorf("upserted %d distinct listings, want 4", len(upserted))
+	}
+
+	// A limit is shared across segments
+	scraper.visited = nil
+	if err := eng.RunSource(context.Background(), "fake", 3); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+	if !reflect.DeepEqual(scraper.visited, want[:2]) {
+		t.Errorf("with a limit of 3 visited %q, want %q", scraper.visited, want[:2])
+	}
+}
+
+func TestRunSourceSegmentsFallBackOnce(t *testing.T) {
+	sources := newFakeSourceStore("fake")
+	sources.sources["fake"].Config = json.RawMessage(`{"segments":["/for-sale/texas/","/for-sale/?industry=restaurants","/for-sale/florida/"]}`)
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+	eng.RegisterScraper("fake", &blockedScraper{})
+
+	fallback := &segmentScraper{segments: map[string][]string{
+		"/for-sale/texas/":                {"1"},
+		"/for-sale/?industry=restaurants": {"2"},
+		"/for-sale/florida/":              {"3"},
+	}}
+	calls := 0
+	eng.RegisterFallbackScraperFactory("fake", func() (Scraper, error) {
+		calls++
+		return fallback, nil
+	})
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	// Blocked on the first segment, the fallback crawls it and the rest
+	if calls != 1 {
+		t.Errorf("fallback created %d times, want once per run", calls)
+	}
+	want := []string{"/for-sale/texas/", "/for-sale/?industry=restaurants", "/for-sale/florida/"}
+	if !reflect.DeepEqual(fallback.visited, want) {
+		t.Errorf("fallback visited %q, want %q", fallback.visited, want)
+	}
+	for _, job := range sources.jobs {
+		if !job.FallbackUsed || job.ListingsFound != 3 {
+			t.Errorf("FallbackUsed = %v, found = %d; want true, 3", job.FallbackUsed, job.ListingsFound)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// GlobalLimiter caps the requests the whole process sends, across every
+// source scraping at once. Per-source rate limits keep each site's load
+// polite, but sources scraped in parallel share one egress IP; the global
+// limit keeps their combined rate under what would get that IP banned.
+//
+// It is a token bucket holding one token, refilled at the configured rate:
+// an idle limiter lets one request through at once and spaces the rest
+// evenly. A nil GlobalLimiter never waits.
+type GlobalLimiter struct {
+	interval time.Duration
+
+	mu sync.Mutex
+	// next is when the next token is free
+	next time.Time
+}
+
+// NewGlobalLimiter returns a limiter allowing perSecond requests a second,
+// or nil, which never waits, if perSecond is 0 or less
+func NewGlobalLimiter(perSecond float64) *GlobalLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &GlobalLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait blocks until a request may be sent, or returns ctx's error if it is
+// done first. A token reserved by a cancelled wait is handed back when no
+// later wait has reserved one since.
+func (l *GlobalLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	at := time.Now()
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := time.Until(at)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		if l.next.Equal(at.Add(l.interval)) {
+			l.next = at
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
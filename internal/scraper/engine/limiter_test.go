@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestGlobalLimiterConcurrentWaits(t *testing.T) {
+	const perSecond = 50
+	limiter := NewGlobalLimiter(perSecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	var mu sync.Mutex
+	var sent []time.Duration
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for limiter.Wait(ctx) == nil {
+				mu.Lock()
+				sent = append(sent, time.Since(start))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// One token up front, then one per interval however many goroutines wait
+	elapsed := time.Since(start)
+	if max := 1 + int(elapsed.Seconds()*perSecond); len(sent) > max {
+		t.Errorf("%d requests in %v, want at most %d", len(sent), elapsed, max)
+	}
+	if len(sent) < 5 {
+		t.Errorf("%d requests in %v, want the limiter to let requests through", len(sent), elapsed)
+	}
+}
+
+func TestGlobalLimiterCancelledWait(t *testing.T) {
+	limiter := NewGlobalLimiter(1)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("first Wait = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The abandoned token is handed back rather than pushing later waits out
+	limiter.mu.Lock()
+	next := limiter.next
+	limiter.mu.Unlock()
+	if wait := time.Until(next); wait > time.Second {
+		t.Errorf("next token in %v, want at most 1s", wait)
+	}
+}
+
+func TestGlobalLimiterDisabled(t *testing.T) {
+	limiter := NewGlobalLimiter(0)
+	if limiter != nil {
+		t.Fatal("a rate of 0 made a limiter")
+	}
+	for range 100 {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait = %v, want nil", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait on a cancelled ctx = %v, want context.Canceled", err)
+	}
+}
+
+// requestingScraper acquires a request before each of its pages and records
+// when it was let through
+type requestingScraper struct {
+	pages int
+	mu    *sync.Mutex
+	sent  *[]time.Time
+}
+
+func (s *requestingScraper) Name() string { return "requesting" }
+
+func (s *requestingScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
+	listings := make(chan *domain.Listing)
+	errors := make(chan error)
+	go func() {
+		defer close(listings)
+		defer close(errors)
+		for i := 1; i <= s.pages; i++ {
+			if opts.Acquire(ctx) != nil {
+				return
+			}
+			s.mu.Lock()
+			*s.sent = append(*s.sent, time.Now())
+			s.mu.Unlock()
+			opts.Record(fmt.Sprintf("https://example.com/page/%d", i), 200, nil)
+			select {
+			case listings <- &domain.Listing{ExternalID: fmt.Sprint(i)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return listings, errors
+}
+
+func TestRunSourcesShareGlobalLimiter(t *testing.T) {
+	const perSecond, pages = 40, 6
+	sources := newFakeSourceStore("first", "second", "third")
+	eng := NewEngine(sources, &fakeListingStore{}, nil)
+	eng.SetGlobalLimiter(NewGlobalLimiter(perSecond))
+
+	var mu sync.Mutex
+	var sent []time.Time
+	for slug := range sources.sources {
+		eng.RegisterScraper(slug, &requestingScraper{pages: pages, mu: &mu, sent: &sent})
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for slug := range sources.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := eng.RunSource(context.Background(), slug, 0); err != nil {
+				t.Errorf("RunSource(%s) failed: %v", slug, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(sent) != 3*pages {
+		t.Fatalf("sent %d requests, want %d", len(sent), 3*pages)
+	}
+	// Run alone, each source would send its pages at once; together they
+	// are spaced out at the global rate
+	if min := time.Duration(3*pages-1) * time.Second / perSecond; time.Since(start) < min {
+		t.Errorf("%d requests took %v, want at least %v", len(sent), time.Since(start), min)
+	}
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var scrapeLastSuccess = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "trough_scrape_last_success_timestamp_seconds",
+		Help: "Unix time of each source's last successful scrape",
+	},
+	[]string{"source"},
+)
+
+var breakerTrips = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "trough_circuit_breaker_trips_total",
+		Help: "Times each provider's circuit breaker opened",
+	},
+	[]string{"breaker"},
+)
+
+// lastSuccess holds each source's last successful scrape, which the staleness
+// collector reads whenever metrics are scraped
+var lastSuccess = &successTimes{times: make(map[string]time.Time)}
+
+func init() {
+	prometheus.MustRegister(lastSuccess)
+}
+
+// successTimes is a prometheus.Collector reporting how long ago each source
+// last scraped successfully, so the gauge grows between runs without the
+// engine updating it. Sources appear once SeedLastSuccess or a successful
+// run has recorded them.
+type successTimes struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+var scrapeStalenessDesc = prometheus.NewDesc(
+	"trough_scrape_staleness_seconds",
+	"Seconds since each source's last successful scrape",
+	[]string{"source"}, nil,
+)
+
+// recordSuccess marks a source's run as succeeded at t
+func recordSuccess(slug string, t time.Time) {
+	scrapeLastSuccess.WithLabelValues(slug).Set(float64(t.UnixNano()) / 1e9)
+
+	lastSuccess.mu.Lock()
+	defer lastSuccess.mu.Unlock()
+	lastSuccess.times[slug] = t
+}
+
+// SeedLastSuccess records sources' earlier successful scrapes, keyed by slug,
+// so that their staleness is reported from process start rather than after
+// their next success. A later success already recorded is kept.
+func SeedLastSuccess(times map[string]time.Time) {
+	lastSuccess.mu.Lock()
+	defer lastSuccess.mu.Unlock()
+	for slug, t := range times {
+		if prev, ok := lastSuccess.times[slug]; ok && !t.After(prev) {
+			continue
+		}
+		lastSuccess.times[slug] = t
+		scrapeLastSuccess.WithLabelValues(slug).Set(float64(t.UnixNano()) / 1e9)
+	}
+}
+
+func (s *successTimes) Describe(ch chan<- *prometheus.Desc) {
+	ch <- scrapeStalenessDesc
+}
+
+func (s *successTimes) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for slug, t := range s.times {
+		ch <- prometheus.MustNewConstMetric(scrapeStalenessDesc, prometheus.GaugeValue, now.Sub(t).Seconds(), slug)
+	}
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/taxonomy"
+)
+
+// ListingProcessor runs on each scraped listing before it reaches the run's
+// sinks, e.g. to enrich, rewrite, or filter it. Returning keep=false drops the
+// listing from the run. An error is logged and counted, and the listing goes
+// on to the next processor as it was left, so a failing step degrades
+// listings rather than losing them. Processors are shared by concurrent runs,
+// so must be safe for concurrent use.
+type ListingProcessor interface {
+	Process(ctx context.Context, listing *domain.Listing) (keep bool, err error)
+}
+
+// ListingProcessorFunc adapts a function to a ListingProcessor
+type ListingProcessorFunc func(ctx context.Context, listing *domain.Listing) (bool, error)
+
+func (f ListingProcessorFunc) Process(ctx context.Context, listing *domain.Listing) (bool, error) {
+	return f(ctx, listing)
+}
+
+// AddProcessor appends a processor to the pipeline every scraped listing
+// passes through, in the order added
+func (e *Engine) AddProcessor(processor ListingProcessor) {
+	e.processors = append(e.processors, processor)
+}
+
+// process runs a listing through the engine's processors, stopping at the
+// first that drops it, and reports whether it was kept
+func (e *Engine) process(ctx context.Context, run *runState, listing *domain.Listing) bool {
+	for _, p := range e.processors {
+		keep, err := p.Process(ctx, listing)
+		if err != nil {
+			run.processorErrors++
+			e.logger.Warn("listing processor failed, keeping listing", "source", run.slug, "processor", processorName(p),
+				"external_id", listing.ExternalID, "error", err)
+			continue
+		}
+		if !keep {
+			e.logger.Debug("listing dropped by processor", "source", run.slug, "processor", processorName(p),
+				"external_id", listing.ExternalID)
+			return false
+		}
+	}
+	return true
+}
+
+// processorName names a processor for logs
+func processorName(p ListingProcessor) string {
+	return fmt.Sprintf("%T", p)
+}
+
+// ValidateProcessor drops listings failing domain.Listing.Validate, logging
+// their problems, so bad scraper output never reaches the sinks
+type ValidateProcessor struct {
+	logger *slog.Logger
+}
+
+// NewValidateProcessor returns a validator logging to logger, or
+// slog.Default() if nil
+func NewValidateProcessor(logger *slog.Logger) *ValidateProcessor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &ValidateProcessor{logger: logger}
+}
+
+func (p *ValidateProcessor) Process(ctx context.Context, listing *domain.Listing) (bool, error) {
+	err := listing.Validate()
+	var invalid *domain.ListingValidationError
+	if errors.As(err, &invalid) {
+		p.logger.Warn("dropping invalid listing", "external_id", listing.ExternalID, "problems", invalid.Problems)
+		return false, nil
+	}
+	return true, err
+}
+
+// TagListing tags a listing from its title and description, as the upsert
+// does, so sinks see the tags it will be stored with
+func TagListing(ctx context.Context, listing *domain.Listing) (bool, error) {
+	listing.Tags = taxonomy.ListingTags(listing.Title, listing.Description)
+	return true, nil
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/taxonomy"
+)
+
+func TestRunSourceProcessorsMutateAndDrop(t *testing.T) {
+	listings := &fakeListingStore{}
+	sink := &fakeSink{}
+	eng := NewEngine(newFakeSourceStore("fake"), listings, nil)
+	eng.AddSink(sink)
+	eng.AddProcessor(ListingProcessorFunc(func(ctx context.Context, l *domain.Listing) (bool, error) {
+		return l.ExternalID != "2", nil
+	}))
+	eng.AddProcessor(ListingProcessorFunc(func(ctx context.Context, l *domain.Listing) (bool, error) {
+		l.Title = strings.ToUpper(l.Title)
+		return true, nil
+	}))
+	eng.RegisterScraper("fake", &fakeScraper{listings: []*domain.Listing{
+		{ExternalID: "1", Title: "One"},
+		{ExternalID: "2", Title: "Two"},
+		{ExternalID: "3", Title: "Three"},
+	}})
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	if len(listings.upserted) != 2 {
+		t.Fatalf("upserted %d listings, want 2", len(listings.upserted))
+	}
+	if listings.upserted[0].Title != "ONE" || listings.upserted[1].Title != "THREE" {
+		t.Errorf("titles = %q, %q, want processed ONE, THREE", listings.upserted[0].Title, listings.upserted[1].Title)
+	}
+	if strings.Join(sink.written, ",") != "1,3" {
+		t.Errorf("sink got %v, want [1 3]", sink.written)
+	}
+}
+
+func TestProcessStopsAtFirstDrop(t *testing.T) {
+	eng := NewEngine(nil, nil, nil)
+	var calls int
+	count := ListingProcessorFunc(func(ctx context.Context, l *domain.Listing) (bool, error) {
+		calls++
+		return true, nil
+	})
+	eng.AddProcessor(count)
+	eng.AddProcessor(ListingProcessorFunc(func(ctx context.Context, l *domain.Listing) (bool, error) {
+		return false, nil
+	}))
+	eng.AddProcessor(count)
+
+	run := &runState{slug: "fake", seen: make(map[string]*domain.Listing)}
+	eng.addListing(context.Background(), run, &domain.Listing{ExternalID: "1"})
+
+	if calls != 1 {
+		t.Errorf("processors after the dropping one ran %d times, want 0", calls-1)
+	}
+	if run.skipped != 1 || run.found != 0 {
+		t.Errorf("skipped = %d, found = %d, want 1, 0", run.skipped, run.found)
+	}
+}
+
+func TestProcessKeepsListingOnError(t *testing.T) {
+	eng := NewEngine(nil, nil, nil)
+	var calls int
+	eng.AddProcessor(ListingProcessorFunc(func(ctx context.Context, l *domain.Listing) (bool, error) {
+		return false, errors.New("geocoder unavailable")
+	}))
+	eng.AddProcessor(ListingProcessorFunc(func(ctx context.Context, l *domain.Listing) (bool, error) {
+		calls++
+		return true, nil
+	}))
+
+	run := &runState{slug: "fake", seen: make(map[string]*domain.Listing)}
+	eng.addListing(context.Background(), run, &domain.Listing{ExternalID: "1"})
+
+	if calls != 1 {
+		t.Errorf("processors after the failing one ran %d times, want 1", calls)
+	}
+	if run.processorErrors != 1 || run.skipped != 0 || run.found != 1 {
+		t.Errorf("processor errors = %d, skipped = %d, found = %d; want 1, 0, 1", run.processorErrors, run.skipped, run.found)
+	}
+}
+
+func TestValidateProcessor(t *testing.T) {
+	p := NewValidateProcessor(nil)
+	valid := &domain.Listing{ExternalID: "1", Title: "Corner Cafe", URL: "https://example.com/1"}
+	if keep, err := p.Process(context.Background(), valid); !keep || err != nil {
+		t.Errorf("valid listing: Process = %v, %v; want kept", keep, err)
+	}
+	invalid := &domain.Listing{ExternalID: "2", Title: "Corner Cafe", URL: "/listing/2"}
+	if keep, err := p.Process(context.Background(), invalid); keep || err != nil {
+		t.Errorf("relative URL: Process = %v, %v; want dropped", keep, err)
+	}
+}
+
+func TestTagListing(t *testing.T) {
+	listing := &domain.Listing{Title: "Turn-key Cafe"}
+	if keep, err := TagListing(context.Background(), listing); !keep || err != nil {
+		t.Fatalf("TagListing = %v, %v; want kept", keep, err)
+	}
+	if len(listing.Tags) != 1 || listing.Tags[0] != taxonomy.TagTurnkey {
+		t.Errorf("tags = %v, want [%s] from the title", listing.Tags, taxonomy.TagTurnkey)
+	}
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// A source whose runs end blocked quarantineThreshold times in a row is
+// quarantined for quarantineCooldown: its runs are skipped until the cooldown
+// passes or `trough scrape unquarantine` clears it. Once the cooldown passes,
+// the next run ending blocked quarantines it again straight away.
+const (
+	quarantineThreshold = 3
+	quarantineCooldown  = 24 * time.Hour
+)
+
+// ErrSourceQuarantined is returned by RunSource when the source is quarantined
+// after repeated blocked runs. The skipped run is recorded as a
+// skipped_quarantined scrape job.
+var ErrSourceQuarantined = errors.New("source is quarantined after repeated blocked runs")
+
+var sourceQuarantinesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "trough_source_quarantines_total",
+		Help: "Sources quarantined after repeated blocked runs, by source",
+	},
+	[]string{"source"},
+)
+
+// quarantineStore counts each source's consecutive blocked runs
+type quarantineStore interface {
+	RecordScrapeOutcome(ctx context.Context, sourceID uuid.UUID, blocked bool, threshold int, cooldown time.Duration) (blocks int, quarantinedUntil *time.Time, err error)
+}
+
+// recordOutcome counts the run towards its source's quarantine, alerting and
+// reporting true when the run quarantines the source
+func (e *Engine) recordOutcome(ctx context.Context, run *runState) bool {
+	blocks, until, err := e.sourceRepo.RecordScrapeOutcome(ctx, run.sourceID, run.blocked, quarantineThreshold, quarantineCooldown)
+	if err != nil {
+		e.logger.Warn("failed to record scrape outcome", "source", run.slug, "error", err)
+		return false
+	}
+	if !run.blocked || blocks < quarantineThreshold || until == nil {
+		return false
+	}
+
+	sourceQuarantinesTotal.WithLabelValues(run.slug).Inc()
+	e.alert(ctx, AlertQuarantined, run.slug, run.found,
+		fmt.Sprintf("%d blocked runs in a row; scrapes are skipped until %s or `trough scrape unquarantine`", blocks, until.UTC().Format(time.RFC3339)))
+	e.logger.Error("source quarantined after repeated blocked runs; its scrapes are skipped until the cooldown passes or `trough scrape unquarantine` clears it",
+		"source", run.slug, "blocked_runs", blocks, "quarantined_until", until.UTC())
+	return true
+}
@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// requestFlushSize is the number of recorded requests buffered before writing
+const requestFlushSize = 25
+
+// requestStore persists the pages fetched by a scrape job
+type requestStore interface {
+	InsertScrapeJobRequests(ctx context.Context, requests []domain.ScrapeJobRequest) error
+}
+
+// requestRecorder buffers the pages fetched during a job and writes them in batches.
+// Scrapers may call Record from multiple goroutines.
+type requestRecorder struct {
+	ctx    context.Context
+	store  requestStore
+	jobID  uuid.UUID
+	logger *slog.Logger
+	mu     sync.Mutex
+	buffer []domain.ScrapeJobRequest
+}
+
+func newRequestRecorder(ctx context.Context, store requestStore, jobID uuid.UUID, logger *slog.Logger) *requestRecorder {
+	return &requestRecorder{
+		ctx:    ctx,
+		store:  store,
+		jobID:  jobID,
+		logger: logger,
+		buffer: make([]domain.ScrapeJobRequest, 0, requestFlushSize),
+	}
+}
+
+// Record buffers a fetched page, flushing once the buffer is full
+func (r *requestRecorder) Record(url string, status int, err error) {
+	req := domain.ScrapeJobRequest{
+		JobID:     r.jobID,
+		URL:       url,
+		Status:    status,
+		FetchedAt: time.Now(),
+	}
+	if err != nil {
+		msg := err.Error()
+		req.Error = &msg
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buffer = append(r.buffer, req)
+	if len(r.buffer) >= requestFlushSize {
+		r.flushLocked()
+	}
+}
+
+// Flush writes any buffered requests
+func (r *requestRecorder) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flushLocked()
+}
+
+func (r *requestRecorder) flushLocked() {
+	if len(r.buffer) == 0 {
+		return
+	}
+	if err := r.store.InsertScrapeJobRequests(r.ctx, r.buffer); err != nil {
+		r.logger.Warn("failed to record scrape requests", "job_id", r.jobID, "requests", len(r.buffer), "error", err)
+	}
+	r.buffer = r.buffer[:0]
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+type fakeRequestStore struct {
+	batchesMu sync.Mutex
+	batches   [][]domain.ScrapeJobRequest
+}
+
+func (f *fakeRequestStore) InsertScrapeJobRequests(ctx context.Context, requests []domain.ScrapeJobRequest) error {
+	batch := make([]domain.ScrapeJobRequest, len(requests))
+	copy(batch, requests)
+	f.batchesMu.Lock()
+	defer f.batchesMu.Unlock()
+	f.batches = append(f.batches, batch)
+	return nil
+}
+
+func TestRequestRecorderBatches(t *testing.T) {
+	store := &fakeRequestStore{}
+	jobID := uuid.New()
+	rec := newRequestRecorder(context.Background(), store, jobID, slog.Default())
+
+	for i := 0; i < requestFlushSize+3; i++ {
+		rec.Record(fmt.Sprintf("https://example.com/page/%d", i), 200, nil)
+	}
+	if len(store.batches) != 1 {
+		t.Fatalf("batches before flush = %d, want 1", len(store.batches))
+	}
+
+	rec.Record("https://example.com/blocked", 403, errors.New("Forbidden"))
+	rec.Flush()
+
+	if len(store.batches) != 2 {
+		t.Fatalf("batches = %d, want 2", len(store.batches))
+	}
+	last := store.batches[1][len(store.batches[1])-1]
+	if last.JobID != jobID || last.Status != 403 || last.Error == nil || *last.Error != "Forbidden" {
+		t.Errorf("unexpected last request: %+v", last)
+	}
+
+	rec.Flush()
+	if len(store.batches) != 2 {
+		t.Error("empty flush wrote a batch")
+	}
+}
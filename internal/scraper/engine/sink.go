@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// Sink receives every listing a run collects. The database is always the
+// first sink of a run; others are added with Engine.AddSink. Sinks are shared
+// by concurrent runs, so must be safe for concurrent use.
+type Sink interface {
+	Write(ctx context.Context, listing *domain.Listing) error
+	// Flush is called once at the end of each run
+	Flush(ctx context.Context) error
+}
+
+// ErrSinkFailed is returned by RunSource when an added sink failed to write or
+// flush the run's listings. The listings are still saved to the database.
+var ErrSinkFailed = errors.New("listing sink failed")
+
+// AddSink adds a sink that receives listings after the database. If it
+// implements io.Closer it is closed by Engine.Close.
+func (e *Engine) AddSink(sink Sink) {
+	e.sinks = append(e.sinks, sink)
+}
+
+// dbSink upserts a run's listings in batches. Failed listings are handled by
+// flushBatch, so it never reports an error.
+type dbSink struct {
+	engine *Engine
+	run    *runState
+}
+
+func (s *dbSink) Write(ctx context.Context, listing *domain.Listing) error {
+	s.run.batch = append(s.run.batch, listing)
+	if len(s.run.batch) >= upsertBatchSize {
+		s.engine.flushBatch(ctx, s.run)
+	}
+	return nil
+}
+
+func (s *dbSink) Flush(ctx context.Context) error {
+	s.engine.flushBatch(ctx, s.run)
+	return nil
+}
+
+// runSink is a sink as used by one run, keeping its first write error and the
+// number of failed writes so a broken sink reports once rather than per listing
+type runSink struct {
+	sink   Sink
+	failed int
+	err    error
+}
+
+// newRunSinks returns the run's sinks: the database, then the added ones
+func (e *Engine) newRunSinks(run *runState) []*runSink {
+	sinks := []*runSink{{sink: &dbSink{engine: e, run: run}}}
+	for _, s := range e.sinks {
+		sinks = append(sinks, &runSink{sink: s})
+	}
+	return sinks
+}
+
+// writeSinks passes a listing to each of the run's sinks
+func (e *Engine) writeSinks(ctx context.Context, run *runState, listing *domain.Listing) {
+	for _, s := range run.sinks {
+		if err := s.sink.Write(ctx, listing); err != nil {
+			s.failed++
+			if s.err == nil {
+				s.err = err
+				e.logger.Error("failed to write listing to sink", "source", run.slug, "sink", fmt.Sprintf("%T", s.sink),
+					"external_id", listing.ExternalID, "error", err)
+			}
+		}
+	}
+}
+
+// flushSinks flushes each of the run's sinks and returns their errors joined,
+// wrapped in ErrSinkFailed
+func (e *Engine) flushSinks(ctx context.Context, run *runState) error {
+	var errs []error
+	for _, s := range run.sinks {
+		name := fmt.Sprintf("%T", s.sink)
+		if s.err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %d listing(s) not written: %w", name, s.failed, s.err))
+		}
+		if err := s.sink.Flush(ctx); err != nil {
+			e.logger.Error("failed to flush sink", "source", run.slug, "sink", name, "error", err)
+			errs = append(errs, fmt.Errorf("sink %s: flush: %w", name, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrSinkFailed, errors.Join(errs...))
+}
+
+// JSONLSink writes listings to w as JSON lines, e.g. to export a live feed of
+// scraped listings. Output is buffered until each run's Flush.
+type JSONLSink struct {
+	mu     sync.Mutex
+	dest   io.Writer
+	buf    *bufio.Writer
+	encode *json.Encoder
+}
+
+// NewJSONLSink returns a sink writing to w. Close closes w if it is an io.Closer.
+func NewJSONLSink(w io.Writer) *JSONLSink {
+	buf := bufio.NewWriter(w)
+	return &JSONLSink{dest: w, buf: buf, encode: json.NewEncoder(buf)}
+}
+
+func (s *JSONLSink) Write(ctx context.Context, listing *domain.Listing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encode.Encode(listing)
+}
+
+func (s *JSONLSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Flush()
+}
+
+// Close flushes buffered listings and closes the underlying writer
+func (s *JSONLSink) Close() error {
+	err := s.Flush(context.Background())
+	if closer, ok := s.dest.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// fakeSink records written listings and flushes, failing writes if err is set
+type fakeSink struct {
+	mu      sync.Mutex
+	written []string
+	flushes int
+	err     error
+}
+
+func (s *fakeSink) Write(ctx context.Context, listing *domain.Listing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.written = append(s.written, listing.ExternalID)
+	return nil
+}
+
+func (s *fakeSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	return nil
+}
+
+func TestRunSourceWritesToSinks(t *testing.T) {
+	listings := &fakeListingStore{}
+	sink := &fakeSink{}
+	eng := NewEngine(newFakeSourceStore("fake"), listings, nil)
+	eng.AddSink(sink)
+	eng.RegisterScraper("fake", &fakeScraper{listings: []*domain.Listing{
+		{ExternalID: "1", Title: "One"},
+		{ExternalID: "2", Title: "Two"},
+	}})
+
+	if err := eng.RunSource(context.Background(), "fake", 0); err != nil {
+		t.Fatalf("RunSource: %v", err)
+	}
+
+	if len(listings.upserted) != 2 {
+		t.Errorf("upserted %d listings, want 2", len(listings.upserted))
+	}
+	if strings.Join(sink.written, ",") != "1,2" {
+		t.Errorf("sink got %v, want [1 2]", sink.written)
+	}
+	if sink.flushes != 1 {
+		t.Errorf("sink flushed %d times, want 1", sink.flushes)
+	}
+}
+
+func TestRunSourceReportsFailedSink(t *testing.T) {
+	listings := &fakeListingStore{}
+	eng := NewEngine(newFakeSourceStore("fake"), listings, nil)
+	eng.AddSink(&fakeSink{err: errors.New("broker unavailable")})
+	ok := &fakeSink{}
+	eng.AddSink(ok)
+	eng.RegisterScraper("fake", &fakeScraper{listings: []*domain.Listing{
+		{ExternalID: "1", Title: "One"},
+		{ExternalID: "2", Title: "Two"},
+	}})
+
+	err := eng.RunSource(context.Background(), "fake", 0)
+	if !errors.Is(err, ErrSinkFailed) {
+		t.Fatalf("RunSource error = %v, want ErrSinkFailed", err)
+	}
+	if !strings.Contains(err.Error(), "2 listing(s) not written: broker unavailable") {
+		t.Errorf("error %q doesn't report the failed writes", err)
+	}
+
+	// A failed sink doesn't stop the database or the other sinks
+	if len(listings.upserted) != 2 {
+		t.Errorf("upserted %d listings, want 2", len(listings.upserted))
+	}
+	if len(ok.written) != 2 {
+		t.Errorf("other sink got %d listings, want 2", len(ok.written))
+	}
+}
+
+func TestJSONLSink(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewJSONLSink(&out)
+	ctx := context.Background()
+
+	for _, id := range []string{"1", "2"} {
+		if err := sink.Write(ctx, &domain.Listing{ExternalID: id, Title: "Listing " + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out.Len() != 0 {
+		t.Error("listings written before Flush")
+	}
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var l domain.Listing
+	if err := json.Unmarshal([]byte(lines[1]), &l); err != nil {
+		t.Fatal(err)
+	}
+	if l.ExternalID != "2" || l.Title != "Listing 2" {
+		t.Errorf("line 2 = %s", lines[1])
+	}
+}
@@ -0,0 +1,251 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+const (
+	// enrichPriority runs enrichment after scrape jobs (River priorities are 1-4, 1 first)
+	enrichPriority = 4
+	// enrichBatchLimit caps how many enrichment jobs are queued after a scrape
+	enrichBatchLimit = 200
+	// enrichSpacing staggers queued enrichment jobs so detail fetches are spread out
+	enrichSpacing = 15 * time.Second
+)
+
+// EnrichListingJobArgs re-fetches a listing's detail page to fill in fields
+// missing from its search result card. Version, if set, is the scraper
+// version the detail page is parsed with: if newer than the listing's, the
+// parsed values overwrite the listing's and the version is recorded on it.
+type EnrichListingJobArgs struct {
+	ListingID uuid.UUID `json:"listing_id"`
+	Version   int       `json:"version,omitempty"`
+}
+
+func (EnrichListingJobArgs) Kind() string { return "enrich_listing" }
+
+func (EnrichListingJobArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Priority: enrichPriority,
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: 24 * time.Hour,
+		},
+	}
+}
+
+// EnrichStore is the subset of the listing repository used for enrichment
+type EnrichStore interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Listing, error)
+	ListNeedingEnrichment(ctx context.Context, limit int) ([]uuid.UUID, error)
+	ApplyEnrichment(ctx context.Context, id uuid.UUID, detail *domain.Listing) error
+	ReplaceLocations(ctx context.Context, listingID uuid.UUID, locations []domain.ListingLocation) error
+	ReplaceDocuments(ctx context.Context, listingID uuid.UUID, documents []domain.ListingDocument) error
+}
+
+// BudgetStore is the subset of the source repository used to count detail
+// fetches against each source's daily request budget
+type BudgetStore interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Source, error)
+	SpendRequestBudget(ctx context.Context, sourceID uuid.UUID, limit int) (used int, ok bool, err error)
+}
+
+// DetailFetcher fetches the fields available on a listing's detail page at
+// url, requested as the listing's source is scraped
+type DetailFetcher interface {
+	FetchDetail(ctx context.Context, source *domain.Source, url string) (*domain.Listing, error)
+}
+
+// EnrichListingWorker handles enrichment jobs
+type EnrichListingWorker struct {
+	river.WorkerDefaults[EnrichListingJobArgs]
+	listingRepo EnrichStore
+	sourceRepo  BudgetStore
+	fetcher     DetailFetcher
+}
+
+func NewEnrichListingWorker(listingRepo EnrichStore, sourceRepo BudgetStore, fetcher DetailFetcher) *EnrichListingWorker {
+	return &EnrichListingWorker{
+		listingRepo: listingRepo,
+		sourceRepo:  sourceRepo,
+		fetcher:     fetcher,
+	}
+}
+
+func (w *EnrichListingWorker) Timeout(*river.Job[EnrichListingJobArgs]) time.Duration {
+	return 2 * time.Minute
+}
+
+func (w *EnrichListingWorker) Work(ctx context.Context, job *river.Job[EnrichListingJobArgs]) error {
+	return w.enrich(ctx, job.Args.ListingID, job.Args.Version)
+}
+
+// enrich is a no-op if the listing has been removed, deactivated or hidden since it was queued
+func (w *EnrichListingWorker) enrich(ctx context.Context, id uuid.UUID, version int) error {
+	listing, err := w.listingRepo.GetByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Info("enrich: listing is gone, skipping", "listing_id", id)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load listing %s: %w", id, err)
+	}
+
+	source, err := w.sourceRepo.GetByID(ctx, listing.SourceID)
+	if err != nil {
+		return fmt.Errorf("failed to load source %s: %w", listing.SourceID, err)
+	}
+	if err := w.spendBudget(ctx, source); err != nil {
+		return err
+	}
+
+	detail, err := w.fetcher.FetchDetail(ctx, source, listing.URL)
+	if err != nil {
+		return err
+	}
+	detail.ParsedByVersion = version
+
+	err = w.listingRepo.ApplyEnrichment(ctx, id, detail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Single-location listings keep no location rows
+	if locations := withPrimaryLocation(listing, detail.Locations); len(locations) > 1 {
+		if err := w.listingRepo.ReplaceLocations(ctx, id, locations); err != nil {
+			return fmt.Errorf("failed to save locations for listing %s: %w", id, err)
+		}
+	}
+
+	// Documents are optional, so failing to save them doesn't retry the fetch
+	if err := w.listingRepo.ReplaceDocuments(ctx, id, detail.Documents); err != nil {
+		slog.Warn("enrich: failed to save documents", "listing_id", id, "error", err)
+	}
+	return nil
+}
+
+// spendBudget counts the detail fetch against the source's daily request
+// budget. If the budget is spent the job is snoozed until it resets.
+func (w *EnrichListingWorker) spendBudget(ctx context.Context, source *domain.Source) error {
+	cfg, err := domain.ParseSourceConfig(source.Config)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source.Slug, err)
+	}
+	if cfg.MaxRequestsPerDay == 0 {
+		return nil
+	}
+
+	_, ok, err := w.sourceRepo.SpendRequestBudget(ctx, source.ID, cfg.MaxRequestsPerDay)
+	if err != nil {
+		return fmt.Errorf("failed to count request against %s budget: %w", source.Slug, err)
+	}
+	if !ok {
+		resetsAt := domain.NextBudgetReset(time.Now())
+		slog.Info("enrich: daily request budget spent, snoozing", "source", source.Slug, "until", resetsAt)
+		return river.JobSnooze(time.Until(resetsAt))
+	}
+	return nil
+}
+
+// withPrimaryLocation marks the detail-page location matching the listing's own
+// city and state as primary, adding it first if the page didn't list it. The
+// primary location takes the listing's zip code and coordinates.
+func withPrimaryLocation(listing *domain.Listing, locations []domain.ListingLocation) []domain.ListingLocation {
+	if listing.State == nil || *listing.State == "" {
+		return locations
+	}
+
+	primary := domain.ListingLocation{
+		City:      listing.City,
+		State:     listing.State,
+		ZipCode:   listing.ZipCode,
+		Lat:       listing.Lat,
+		Lng:       listing.Lng,
+		IsPrimary: true,
+	}
+
+	result := make([]domain.ListingLocation, 0, len(locations)+1)
+	result = append(result, primary)
+	for _, loc := range locations {
+		if sameLocation(loc, primary) {
+			if primary.ZipCode == nil {
+				result[0].ZipCode = loc.ZipCode
+			}
+			continue
+		}
+		result = append(result, loc)
+	}
+	return result
+}
+
+func sameLocation(a, b domain.ListingLocation) bool {
+	str := func(p *string) string {
+		if p == nil {
+			return ""
+		}
+		return strings.ToLower(strings.TrimSpace(*p))
+	}
+	return str(a.City) == str(b.City) && str(a.State) == str(b.State)
+}
+
+// enqueueEnrichment queues enrichment jobs for listings missing financials or
+// broker details, staggered so they don't compete with the crawl for rate limits
+func enqueueEnrichment(ctx context.Context, listingRepo EnrichStore) {
+	client, err := river.ClientFromContextSafely[pgx.Tx](ctx)
+	if err != nil {
+		slog.Warn("cannot enqueue enrichment jobs", "error", err)
+		return
+	}
+
+	ids, err := listingRepo.ListNeedingEnrichment(ctx, enrichBatchLimit)
+	if err != nil {
+		slog.Warn("failed to list listings needing enrichment", "error", err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	params := enrichParams(ids, 0, time.Now())
+	if _, err := client.InsertMany(ctx, params); err != nil {
+		slog.Warn("failed to enqueue enrichment jobs", "error", err)
+		return
+	}
+	slog.Info("queued enrichment jobs", "count", len(ids))
+}
+
+// RescrapeParams queues detail fetches of listings parsed by an older
+// scraper version, recording version on each once it is enriched. They are
+// spaced like enrichment jobs.
+func RescrapeParams(ids []uuid.UUID, version int, start time.Time) []river.InsertManyParams {
+	return enrichParams(ids, version, start)
+}
+
+// enrichParams builds one insert per listing, scheduled enrichSpacing apart
+func enrichParams(ids []uuid.UUID, version int, start time.Time) []river.InsertManyParams {
+	params := make([]river.InsertManyParams, len(ids))
+	for i, id := range ids {
+		opts := EnrichListingJobArgs{}.InsertOpts()
+		opts.ScheduledAt = start.Add(time.Duration(i) * enrichSpacing)
+		params[i] = river.InsertManyParams{
+			Args:       EnrichListingJobArgs{ListingID: id, Version: version},
+			InsertOpts: &opts,
+		}
+	}
+	return params
+}
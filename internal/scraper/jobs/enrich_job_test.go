@@ -0,0 +1,296 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/riverqueue/river/rivertype"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+type fakeEnrichStore struct {
+	listings  map[uuid.UUID]*domain.Listing
+	applied   map[uuid.UUID]*domain.Listing
+	locations map[uuid.UUID][]domain.ListingLocation
+	documents map[uuid.UUID][]domain.ListingDocument
+	docsErr   error
+}
+
+func (s *fakeEnrichStore) GetByID(ctx context.Context, id uuid.UUID) (*domain.Listing, error) {
+	if l, ok := s.listings[id]; ok {
+		return l, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *fakeEnrichStore) ListNeedingEnrichment(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+func (s *fakeEnrichStore) ApplyEnrichment(ctx context.Context, id uuid.UUID, detail *domain.Listing) error {
+	if _, ok := s.listings[id]; !ok {
+		return sql.ErrNoRows
+	}
+	s.applied[id] = detail
+	return nil
+}
+
+func (s *fakeEnrichStore) ReplaceLocations(ctx context.Context, listingID uuid.UUID, locations []domain.ListingLocation) error {
+	s.locations[listingID] = locations
+	return nil
+}
+
+func (s *fakeEnrichStore) ReplaceDocuments(ctx context.Context, listingID uuid.UUID, documents []domain.ListingDocument) error {
+	if s.docsErr != nil {
+		return s.docsErr
+	}
+	if s.documents == nil {
+		s.documents = make(map[uuid.UUID][]domain.ListingDocument)
+	}
+	s.documents[listingID] = documents
+	return nil
+}
+
+// fakeBudgetStore gives every source a daily budget of limit requests, none if 0
+type fakeBudgetStore struct {
+	limit int
+	used  int
+}
+
+func (s *fakeBudgetStore) GetByID(ctx context.Context, id uuid.UUID) (*domain.Source, error) {
+	config := json.RawMessage(fmt.Sprintf(`{"max_requests_per_day":%d}`, s.limit))
+	return &domain.Source{ID: id, Slug: "fake", Config: config}, nil
+}
+
+func (s *fakeBudgetStore) SpendRequestBudget(ctx context.Context, sourceID uuid.UUID, limit int) (int, bool, error) {
+	if s.used >= limit {
+		return s.used, false, nil
+	}
+	s.used++
+	return s.used, true, nil
+}
+
+type fakeDetailFetcher struct {
+	urls []string
+	// locations and documents are returned on the detail
+	locations []domain.ListingLocation
+	documents []domain.ListingDocument
+}
+
+func (f *fakeDetailFetcher) FetchDetail(ctx context.Context, source *domain.Source, url string) (*domain.Listing, error) {
+	f.urls = append(f.urls, url)
+	return &domain.Listing{CashFlow: domain.Ptr(int64(100)), Locations: f.locations, Documents: f.documents}, nil
+}
+
+func TestEnrichListing(t *testing.T) {
+	id := uuid.New()
+	store := &fakeEnrichStore{
+		listings:  map[uuid.UUID]*domain.Listing{id: {ID: id, URL: "https://example.com/l/1"}},
+		applied:   make(map[uuid.UUID]*domain.Listing),
+		locations: make(map[uuid.UUID][]domain.ListingLocation),
+	}
+	fetcher := &fakeDetailFetcher{}
+	w := NewEnrichListingWorker(store, &fakeBudgetStore{}, fetcher)
+
+	if err := w.enrich(context.Background(), id, 0); err != nil {
+		t.Fatalf("enrich returned error: %v", err)
+	}
+	if len(fetcher.urls) != 1 || fetcher.urls[0] != "https://example.com/l/1" {
+		t.Errorf("fetched %v, want the listing URL", fetcher.urls)
+	}
+	if store.applied[id] == nil {
+		t.Error("enrichment not applied")
+	}
+}
+
+func TestEnrichListingGone(t *testing.T) {
+	store := &fakeEnrichStore{
+		listings:  map[uuid.UUID]*domain.Listing{},
+		applied:   make(map[uuid.UUID]*domain.Listing),
+		locations: make(map[uuid.UUID][]domain.ListingLocation),
+	}
+	fetcher := &fakeDetailFetcher{}
+	w := NewEnrichListingWorker(store, &fakeBudgetStore{}, fetcher)
+
+	if err := w.enrich(context.Background(), uuid.New(), 0); err != nil {
+		t.Fatalf("enrich of missing listing returned error: %v", err)
+	}
+	if len(fetcher.urls) != 0 {
+		t.Errorf("fetched %v for a missing listing", fetcher.urls)
+	}
+}
+
+func TestEnrichListingBudget(t *testing.T) {
+	id := uuid.New()
+	store := &fakeEnrichStore{
+		listings:  map[uuid.UUID]*domain.Listing{id: {ID: id, URL: "https://example.com/l/1"}},
+		applied:   make(map[uuid.UUID]*domain.Listing),
+		locations: make(map[uuid.UUID][]domain.ListingLocation),
+	}
+	budget := &fakeBudgetStore{limit: 1}
+	fetcher := &fakeDetailFetcher{}
+	w := NewEnrichListingWorker(store, budget, fetcher)
+
+	if err := w.enrich(context.Background(), id, 0); err != nil {
+		t.Fatalf("enrich within budget returned error: %v", err)
+	}
+	if budget.used != 1 {
+		t.Errorf("budget used = %d, want 1", budget.used)
+	}
+
+	// The budget is spent, so the job waits for it to reset instead of fetching
+	err := w.enrich(context.Background(), id, 0)
+	var snooze *rivertype.JobSnoozeError
+	if !errors.As(err, &snooze) {
+		t.Fatalf("enrich over budget returned %v, want a snooze", err)
+	}
+	if snooze.Duration <= 0 || snooze.Duration > 24*time.Hour {
+		t.Errorf("snoozed for %v, want until the next UTC day", snooze.Duration)
+	}
+	if len(fetcher.urls) != 1 {
+		t.Errorf("fetched %d pages, want 1", len(fetcher.urls))
+	}
+}
+
+func TestEnrichListingLocations(t *testing.T) {
+	austin := domain.ListingLocation{City: domain.StrPtr("austin"), State: domain.StrPtr("TX"), ZipCode: domain.StrPtr("78701")}
+	dallas := domain.ListingLocation{City: domain.StrPtr("Dallas"), State: domain.StrPtr("TX")}
+
+	tests := []struct {
+		name      string
+		locations []domain.ListingLocation
+		want      []string
+		wantZip   string
+	}{
+		{"primary listed on page", []domain.ListingLocation{dallas, austin}, []string{"Austin", "Dallas"}, "78701"},
+		{"primary missing from page", []domain.ListingLocation{dallas}, []string{"Austin", "Dallas"}, ""},
+		{"only the primary", []domain.ListingLocation{austin}, nil, ""},
+		{"no locations", nil, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := uuid.New()
+			store := &fakeEnrichStore{
+				listings: map[uuid.UUID]*domain.Listing{id: {
+					ID:    id,
+					URL:   "https://example.com/l/1",
+					City:  domain.StrPtr("Austin"),
+					State: domain.StrPtr("TX"),
+					Lat:   domain.Ptr(30.27),
+					Lng:   domain.Ptr(-97.74),
+				}},
+				applied:   make(map[uuid.UUID]*domain.Listing),
+				locations: make(map[uuid.UUID][]domain.ListingLocation),
+			}
+			w := NewEnrichListingWorker(store, &fakeBudgetStore{}, &fakeDetailFetcher{locations: tt.locations})
+
+			if err := w.enrich(context.Background(), id, 0); err != nil {
+				t.Fatalf("enrich returned error: %v", err)
+			}
+
+			var got []string
+			for _, loc := range store.locations[id] {
+				got = append(got, *loc.City)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("stored locations = %v, want %v", got, tt.want)
+			}
+			if len(got) == 0 {
+				return
+			}
+
+			primary := store.locations[id][0]
+			if !primary.IsPrimary || primary.Lat == nil || *primary.Lat != 30.27 {
+				t.Errorf("primary = %+v, want the listing's location with its coordinates", primary)
+			}
+			if tt.wantZip != "" && (primary.ZipCode == nil || *primary.ZipCode != tt.wantZip) {
+				t.Errorf("primary zip = %v, want %s from the page", primary.ZipCode, tt.wantZip)
+			}
+			for _, loc := range store.locations[id][1:] {
+				if loc.IsPrimary {
+					t.Errorf("secondary location %s marked primary", *loc.City)
+				}
+			}
+		})
+	}
+}
+
+func TestEnrichListingRecordsVersion(t *testing.T) {
+	id := uuid.New()
+	store := &fakeEnrichStore{
+		listings:  map[uuid.UUID]*domain.Listing{id: {ID: id, URL: "https://example.com/l/1", ParsedByVersion: 1}},
+		applied:   make(map[uuid.UUID]*domain.Listing),
+		locations: make(map[uuid.UUID][]domain.ListingLocation),
+	}
+	w := NewEnrichListingWorker(store, &fakeBudgetStore{}, &fakeDetailFetcher{})
+
+	if err := w.enrich(context.Background(), id, 2); err != nil {
+		t.Fatalf("enrich returned error: %v", err)
+	}
+	if got := store.applied[id].ParsedByVersion; got != 2 {
+		t.Errorf("applied ParsedByVersion = %d, want 2", got)
+	}
+
+	params := RescrapeParams([]uuid.UUID{id}, 2, time.Now())
+	if args := params[0].Args.(EnrichListingJobArgs); args.ListingID != id || args.Version != 2 {
+		t.Errorf("args = %+v, want the listing with version 2", args)
+	}
+}
+
+func TestEnrichParamsSpacing(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	params := enrichParams([]uuid.UUID{uuid.New(), uuid.New(), uuid.New()}, 0, start)
+
+	if len(params) != 3 {
+		t.Fatalf("len = %d, want 3", len(params))
+	}
+	for i, p := range params {
+		want := start.Add(time.Duration(i) * enrichSpacing)
+		if !p.InsertOpts.ScheduledAt.Equal(want) {
+			t.Errorf("params[%d].ScheduledAt = %v, want %v", i, p.InsertOpts.ScheduledAt, want)
+		}
+		if p.InsertOpts.Priority != enrichPriority {
+			t.Errorf("params[%d].Priority = %d, want %d", i, p.InsertOpts.Priority, enrichPriority)
+		}
+	}
+}
+
+func TestEnrichListingDocuments(t *testing.T) {
+	id := uuid.New()
+	newStore := func() *fakeEnrichStore {
+		return &fakeEnrichStore{
+			listings:  map[uuid.UUID]*domain.Listing{id: {ID: id, URL: "https://example.com/l/1"}},
+			applied:   make(map[uuid.UUID]*domain.Listing),
+			locations: make(map[uuid.UUID][]domain.ListingLocation),
+		}
+	}
+	cim := domain.ListingDocument{Type: domain.DocumentTypeCIM, URL: "https://example.com/cim.pdf"}
+
+	store := newStore()
+	fetcher := &fakeDetailFetcher{documents: []domain.ListingDocument{cim}}
+	if err := NewEnrichListingWorker(store, &fakeBudgetStore{}, fetcher).enrich(context.Background(), id, 0); err != nil {
+		t.Fatalf("enrich returned error: %v", err)
+	}
+	if got := store.documents[id]; len(got) != 1 || got[0] != cim {
+		t.Errorf("documents = %v, want the CIM", got)
+	}
+
+	// A listing without documents still enriches, and a failed save doesn't fail the job
+	store = newStore()
+	store.docsErr = errors.New("db down")
+	if err := NewEnrichListingWorker(store, &fakeBudgetStore{}, &fakeDetailFetcher{}).enrich(context.Background(), id, 0); err != nil {
+		t.Fatalf("enrich returned error: %v", err)
+	}
+	if store.applied[id] == nil {
+		t.Error("enrichment not applied")
+	}
+}
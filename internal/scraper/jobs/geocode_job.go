@@ -0,0 +1,224 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/riverqueue/river"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/geocode"
+	"github.com/kbsch/trough/internal/scraper/engine"
+)
+
+// geocodeBatchSize is the number of listings geocoded per job run. At Nominatim's
+// 1 req/sec this keeps a run to a few minutes.
+const geocodeBatchSize = 200
+
+var (
+	geocodeListingsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "trough_geocode_listings_total",
+			Help: "Listings processed by the geocode backfill by result",
+		},
+		[]string{"result"},
+	)
+
+	geocodeLocationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "trough_geocode_locations_total",
+			Help: "Locations of multi-location listings processed by the geocode backfill by result",
+		},
+		[]string{"result"},
+	)
+
+	geocodePending = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "trough_geocode_pending",
+			Help: "Active listings still awaiting coordinates",
+		},
+	)
+)
+
+// MaxGeocodeBackfillLimit caps the listings one run geocodes; at Nominatim's
+// 1 req/sec it keeps a run within the job's timeout
+const MaxGeocodeBackfillLimit = 1500
+
+// GeocodeBackfillJobArgs geocodes a batch of listings missing coordinates
+type GeocodeBackfillJobArgs struct {
+	// Limit, if set, replaces geocodeBatchSize, up to
+	// MaxGeocodeBackfillLimit; admins raise it to catch up after a fix
+	Limit int `json:"limit,omitempty"`
+}
+
+func (GeocodeBackfillJobArgs) Kind() string { return "geocode_backfill" }
+
+// InsertOpts makes a run unique per hour and limit, so an admin's run isn't
+// dropped for the scheduled one
+func (GeocodeBackfillJobArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		Priority:   enrichPriority,
+		UniqueOpts: river.UniqueOpts{ByArgs: true, ByPeriod: time.Hour},
+	}
+}
+
+// BatchSize is the most listings the run geocodes
+func (a GeocodeBackfillJobArgs) BatchSize() int {
+	if a.Limit <= 0 {
+		return geocodeBatchSize
+	}
+	return min(a.Limit, MaxGeocodeBackfillLimit)
+}
+
+// GeocodeStore is the subset of the listing repository used by the backfill
+type GeocodeStore interface {
+	ListNeedingGeocode(ctx context.Context, limit int) ([]domain.GeocodeCandidate, error)
+	CountNeedingGeocode(ctx context.Context) (int, error)
+	SetCoordinates(ctx context.Context, id uuid.UUID, lat, lng float64) error
+	MarkGeocodeFailed(ctx context.Context, id uuid.UUID) error
+	ListLocationsNeedingGeocode(ctx context.Context, limit int) ([]domain.GeocodeCandidate, error)
+	SetLocationCoordinates(ctx context.Context, id uuid.UUID, lat, lng float64) error
+	MarkLocationGeocodeFailed(ctx context.Context, id uuid.UUID) error
+}
+
+// GeocodeBackfillWorker fills in lat/lng for listings that have a city/state
+type GeocodeBackfillWorker struct {
+	river.WorkerDefaults[GeocodeBackfillJobArgs]
+	listingRepo GeocodeStore
+	geocoder    geocode.Geocoder
+}
+
+func NewGeocodeBackfillWorker(listingRepo GeocodeStore, geocoder geocode.Geocoder) *GeocodeBackfillWorker {
+	return &GeocodeBackfillWorker{
+		listingRepo: listingRepo,
+		geocoder:    geocoder,
+	}
+}
+
+func (w *GeocodeBackfillWorker) Timeout(*river.Job[GeocodeBackfillJobArgs]) time.Duration {
+	return 30 * time.Minute
+}
+
+func (w *GeocodeBackfillWorker) Work(ctx context.Context, job *river.Job[GeocodeBackfillJobArgs]) error {
+	return w.backfill(ctx, job.Args.BatchSize())
+}
+
+func (w *GeocodeBackfillWorker) backfill(ctx context.Context, limit int) error {
+	candidates, err := w.listingRepo.ListNeedingGeocode(ctx, limit)
+	if err != nil {
+		return fmt.Errorf("failed to list listings needing geocode: %w", err)
+	}
+	slog.Info("geocode backfill started", "listings", len(candidates))
+
+	// Many listings share a city; only ask the providers once per location
+	run := &geocodeRun{
+		cache:  make(map[geocode.Location]*geocode.Result),
+		failed: make(map[geocode.Location]bool),
+	}
+	resolved, notFound, errored := w.geocodeCandidates(ctx, run, candidates,
+		w.listingRepo.SetCoordinates, w.listingRepo.MarkGeocodeFailed, geocodeListingsTotal)
+
+	if pending, err := w.listingRepo.CountNeedingGeocode(ctx); err == nil {
+		geocodePending.Set(float64(pending))
+	}
+
+	slog.Info("geocode backfill completed", "resolved", resolved, "not_found", notFound, "errors", errored)
+
+	// Locations of multi-location listings share the rest of the batch
+	if remaining := limit - len(candidates); remaining > 0 && ctx.Err() == nil {
+		locations, err := w.listingRepo.ListLocationsNeedingGeocode(ctx, remaining)
+		if err != nil {
+			return fmt.Errorf("failed to list listing locations needing geocode: %w", err)
+		}
+		if len(locations) > 0 {
+			resolved, notFound, errored := w.geocodeCandidates(ctx, run, locations,
+				w.listingRepo.SetLocationCoordinates, w.listingRepo.MarkLocationGeocodeFailed, geocodeLocationsTotal)
+			slog.Info("geocode backfill locations completed",
+				"resolved", resolved, "not_found", notFound, "errors", errored)
+		}
+	}
+
+	return ctx.Err()
+}
+
+// geocodeRun caches provider results across all candidates of one backfill run
+type geocodeRun struct {
+	cache  map[geocode.Location]*geocode.Result
+	failed map[geocode.Location]bool
+}
+
+// geocodeCandidates resolves each candidate, saving coordinates with set and
+// recording unresolvable ones with markFailed
+func (w *GeocodeBackfillWorker) geocodeCandidates(
+	ctx context.Context,
+	run *geocodeRun,
+	candidates []domain.GeocodeCandidate,
+	set func(ctx context.Context, id uuid.UUID, lat, lng float64) error,
+	markFailed func(ctx context.Context, id uuid.UUID) error,
+	total *prometheus.CounterVec,
+) (resolved, notFound, errored int) {
+	for _, c := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+
+		loc := candidateLocation(c)
+		result, ok := run.cache[loc]
+		if !ok && !run.failed[loc] {
+			var err error
+			result, err = w.geocoder.Geocode(ctx, loc)
+			switch {
+			case err == nil:
+				run.cache[loc] = result
+			case errors.Is(err, geocode.ErrNotFound):
+				run.failed[loc] = true
+			case errors.Is(err, engine.ErrBreakerOpen):
+				// The failure that opened the breaker was logged
+				slog.Debug("geocode skipped, provider unavailable", "id", c.ID, "location", loc.String(), "error", err)
+				total.WithLabelValues("error").Inc()
+				errored++
+				continue
+			default:
+				// Provider errors are transient; leave the candidate for the next run
+				slog.Error("geocode error", "id", c.ID, "location", loc.String(), "error", err)
+				total.WithLabelValues("error").Inc()
+				errored++
+				continue
+			}
+		}
+
+		if run.failed[loc] {
+			if err := markFailed(ctx, c.ID); err != nil {
+				slog.Warn("failed to mark geocode failure", "id", c.ID, "error", err)
+			}
+			total.WithLabelValues("not_found").Inc()
+			notFound++
+			continue
+		}
+
+		if err := set(ctx, c.ID, result.Lat, result.Lng); err != nil {
+			slog.Warn("failed to save coordinates", "id", c.ID, "error", err)
+			continue
+		}
+		total.WithLabelValues("success").Inc()
+		resolved++
+	}
+	return resolved, notFound, errored
+}
+
+func candidateLocation(c domain.GeocodeCandidate) geocode.Location {
+	loc := geocode.Location{State: c.State, Country: "US"}
+	if c.City != nil {
+		loc.City = *c.City
+	}
+	if c.Country != nil && *c.Country != "" {
+		loc.Country = *c.Country
+	}
+	return loc
+}
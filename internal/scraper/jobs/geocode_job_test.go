@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/geocode"
+)
+
+type fakeGeocodeStore struct {
+	candidates []domain.GeocodeCandidate
+	locations  []domain.GeocodeCandidate
+	coords     map[uuid.UUID][2]float64
+	failed     map[uuid.UUID]bool
+	// locationLimit is the limit passed to ListLocationsNeedingGeocode
+	locationLimit int
+}
+
+func (s *fakeGeocodeStore) ListNeedingGeocode(ctx context.Context, limit int) ([]domain.GeocodeCandidate, error) {
+	return s.candidates, nil
+}
+
+func (s *fakeGeocodeStore) CountNeedingGeocode(ctx context.Context) (int, error) {
+	return len(s.candidates) - len(s.coords) - len(s.failed), nil
+}
+
+func (s *fakeGeocodeStore) SetCoordinates(ctx context.Context, id uuid.UUID, lat, lng float64) error {
+	s.coords[id] = [2]float64{lat, lng}
+	return nil
+}
+
+func (s *fakeGeocodeStore) MarkGeocodeFailed(ctx context.Context, id uuid.UUID) error {
+	s.failed[id] = true
+	return nil
+}
+
+func (s *fakeGeocodeStore) ListLocationsNeedingGeocode(ctx context.Context, limit int) ([]domain.GeocodeCandidate, error) {
+	s.locationLimit = limit
+	return s.locations, nil
+}
+
+func (s *fakeGeocodeStore) SetLocationCoordinates(ctx context.Context, id uuid.UUID, lat, lng float64) error {
+	return s.SetCoordinates(ctx, id, lat, lng)
+}
+
+func (s *fakeGeocodeStore) MarkLocationGeocodeFailed(ctx context.Context, id uuid.UUID) error {
+	return s.MarkGeocodeFailed(ctx, id)
+}
+
+type fakeGeocoder struct {
+	calls map[geocode.Location]int
+}
+
+func (g *fakeGeocoder) Name() string { return "fake" }
+
+func (g *fakeGeocoder) Geocode(ctx context.Context, loc geocode.Location) (*geocode.Result, error) {
+	g.calls[loc]++
+	switch loc.City {
+	case "Austin":
+		return &geocode.Result{Lat: 30.27, Lng: -97.74}, nil
+	case "Nowhere":
+		return nil, geocode.ErrNotFound
+	default:
+		return nil, errors.New("provider unavailable")
+	}
+}
+
+func TestGeocodeBackfill(t *testing.T) {
+	austin1, austin2, nowhere, flaky := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	store := &fakeGeocodeStore{
+		candidates: []domain.GeocodeCandidate{
+			{ID: austin1, City: domain.StrPtr("Austin"), State: "TX"},
+			{ID: austin2, City: domain.StrPtr("Austin"), State: "TX"},
+			{ID: nowhere, City: domain.StrPtr("Nowhere"), State: "TX"},
+			{ID: flaky, City: domain.StrPtr("Flaky"), State: "TX"},
+		},
+		coords: make(map[uuid.UUID][2]float64),
+		failed: make(map[uuid.UUID]bool),
+	}
+	geocoder := &fakeGeocoder{calls: make(map[geocode.Location]int)}
+	w := NewGeocodeBackfillWorker(store, geocoder)
+
+	if err := w.backfill(context.Background(), 10); err != nil {
+		t.Fatalf("backfill returned error: %v", err)
+	}
+
+	for _, id := range []uuid.UUID{austin1, austin2} {
+		if got, ok := store.coords[id]; !ok || got != [2]float64{30.27, -97.74} {
+			t.Errorf("coords[%s] = %v, want Austin", id, got)
+		}
+	}
+	if calls := geocoder.calls[geocode.Location{City: "Austin", State: "TX", Country: "US"}]; calls != 1 {
+		t.Errorf("Austin geocoded %d times, want 1 (cached)", calls)
+	}
+	if !store.failed[nowhere] {
+		t.Error("not-found listing was not marked failed")
+	}
+	if store.failed[flaky] {
+		t.Error("listing with a transient provider error was marked failed")
+	}
+	if _, ok := store.coords[flaky]; ok {
+		t.Error("listing with a transient provider error got coordinates")
+	}
+}
+
+func TestGeocodeBackfillLocations(t *testing.T) {
+	listing, branch, lost := uuid.New(), uuid.New(), uuid.New()
+	store := &fakeGeocodeStore{
+		candidates: []domain.GeocodeCandidate{
+			{ID: listing, City: domain.StrPtr("Austin"), State: "TX"},
+		},
+		locations: []domain.GeocodeCandidate{
+			{ID: branch, City: domain.StrPtr("Austin"), State: "TX"},
+			{ID: lost, City: domain.StrPtr("Nowhere"), State: "TX"},
+		},
+		coords: make(map[uuid.UUID][2]float64),
+		failed: make(map[uuid.UUID]bool),
+	}
+	geocoder := &fakeGeocoder{calls: make(map[geocode.Location]int)}
+	w := NewGeocodeBackfillWorker(store, geocoder)
+
+	if err := w.backfill(context.Background(), 10); err != nil {
+		t.Fatalf("backfill returned error: %v", err)
+	}
+
+	if store.locationLimit != 9 {
+		t.Errorf("locations limit = %d, want the 9 left in the batch", store.locationLimit)
+	}
+	if _, ok := store.coords[branch]; !ok {
+		t.Error("location was not geocoded")
+	}
+	if calls := geocoder.calls[geocode.Location{City: "Austin", State: "TX", Country: "US"}]; calls != 1 {
+		t.Errorf("Austin geocoded %d times, want 1 (cached across listings and locations)", calls)
+	}
+	if !store.failed[lost] {
+		t.Error("not-found location was not marked failed")
+	}
+}
+
+func TestGeocodeBackfillBatchSize(t *testing.T) {
+	tests := []struct {
+		limit, want int
+	}{
+		{0, geocodeBatchSize},
+		{25, 25},
+		{MaxGeocodeBackfillLimit + 1, MaxGeocodeBackfillLimit},
+	}
+	for _, tt := range tests {
+		if got := (GeocodeBackfillJobArgs{Limit: tt.limit}).BatchSize(); got != tt.want {
+			t.Errorf("BatchSize with limit %d = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
@@ -4,20 +4,23 @@ import (
 	"time"
 
 	"github.com/riverqueue/river"
+
+	"github.com/kbsch/trough/internal/domain"
 )
 
-// GetPeriodicJobs returns the periodic jobs to schedule
-func GetPeriodicJobs() []*river.PeriodicJob {
-	return []*river.PeriodicJob{
-		// Run full scrape daily at 2 AM UTC
+// GetPeriodicJobs returns the periodic jobs to schedule: the sources' scrapes,
+// staggered by the scheduler, and the geocode backfill
+func GetPeriodicJobs(scheduler StaggeredScheduler, sources []domain.Source) []*river.PeriodicJob {
+	return append(scheduler.PeriodicJobs(sources),
+		// Fill in coordinates for new listings a batch at a time
 		river.NewPeriodicJob(
-			river.PeriodicInterval(24*time.Hour),
+			river.PeriodicInterval(time.Hour),
 			func() (river.JobArgs, *river.InsertOpts) {
-				return ScrapeAllJobArgs{}, nil
+				return GeocodeBackfillJobArgs{}, nil
 			},
 			&river.PeriodicJobOpts{
-				RunOnStart: false,
+				RunOnStart: true,
 			},
 		),
-	}
+	)
 }
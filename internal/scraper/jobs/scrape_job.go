@@ -2,8 +2,9 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,10 +20,19 @@ type ScrapeJobArgs struct {
 	SourceSlug  string `json:"source_slug"`
 	MaxListings int    `json:"max_listings"`
 	FullScrape  bool   `json:"full_scrape"`
+	// Trigger records what queued the job, one of the domain.ScrapeTrigger values
+	Trigger string `json:"trigger,omitempty"`
+	// RequestID is the ID of the API request that queued the job, if any,
+	// logged with the job so a refresh can be traced to its scrape
+	RequestID string `json:"request_id,omitempty"`
 }
 
 func (ScrapeJobArgs) Kind() string { return "scrape" }
 
+func (ScrapeJobArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: QueueScrape}
+}
+
 // ScrapeJobWorker handles scraping jobs
 type ScrapeJobWorker struct {
 	river.WorkerDefaults[ScrapeJobArgs]
@@ -41,7 +51,10 @@ func NewScrapeJobWorker(eng *engine.Engine, sourceRepo *repository.SourceReposit
 
 func (w *ScrapeJobWorker) Work(ctx context.Context, job *river.Job[ScrapeJobArgs]) error {
 	args := job.Args
-	log.Printf("Starting scrape job for source: %s", args.SourceSlug)
+	trigger := scrapeTrigger(args.Trigger, job.Attempt)
+	ctx = engine.WithTrigger(ctx, trigger)
+	logger := jobLogger(job.ID, args.RequestID).With("source", args.SourceSlug)
+	logger.Info("starting scrape job", "trigger", trigger)
 
 	source, err := w.sourceRepo.GetBySlug(ctx, args.SourceSlug)
 	if err != nil {
@@ -53,40 +66,76 @@ func (w *ScrapeJobWorker) Work(ctx context.Context, job *river.Job[ScrapeJobArgs
 		ID:        uuid.New(),
 		SourceID:  source.ID,
 		Status:    domain.ScrapeJobStatusRunning,
+		Trigger:   trigger,
 		CreatedAt: time.Now(),
 	}
 	now := time.Now()
 	scrapeJob.StartedAt = &now
 
 	if err := w.sourceRepo.CreateScrapeJob(ctx, scrapeJob); err != nil {
-		log.Printf("Warning: failed to create scrape job record: %v", err)
+		logger.Warn("failed to create scrape job record", "error", err)
 	}
 
 	// Run the scraper
-	err = w.engine.RunSource(ctx, args.SourceSlug, args.MaxListings)
+	if args.FullScrape {
+		err = w.engine.RunSource(ctx, args.SourceSlug, args.MaxListings)
+	} else {
+		err = w.engine.RunSourceIncremental(ctx, args.SourceSlug, args.MaxListings)
+	}
 
 	// Update job status
 	completedAt := time.Now()
 	scrapeJob.CompletedAt = &completedAt
-	if err != nil {
+	// Skipped runs aren't retried: another run has the source covered, the
+	// budget resets tomorrow, or the quarantine outlasts River's retries, and
+	// the next scheduled run picks up from there
+	skipped := false
+	switch {
+	case errors.Is(err, engine.ErrSourceLocked):
+		scrapeJob.Status = domain.ScrapeJobStatusSkippedLocked
+		skipped, err = true, nil
+	case errors.Is(err, engine.ErrBudgetExhausted):
+		scrapeJob.Status = domain.ScrapeJobStatusBudgetExhausted
+		skipped, err = true, nil
+	case errors.Is(err, engine.ErrSourceQuarantined):
+		scrapeJob.Status = domain.ScrapeJobStatusSkippedQuarantined
+		skipped, err = true, nil
+	case errors.Is(err, engine.ErrSinkFailed):
+		// The listings were saved; re-scraping the source won't fix an export
+		scrapeJob.Status = domain.ScrapeJobStatusCompleted
+		scrapeJob.ErrorMessage = err.Error()
+		err = nil
+	case err != nil:
 		scrapeJob.Status = domain.ScrapeJobStatusFailed
 		scrapeJob.ErrorMessage = err.Error()
-	} else {
+	default:
 		scrapeJob.Status = domain.ScrapeJobStatusCompleted
 	}
 
 	if updateErr := w.sourceRepo.UpdateScrapeJob(ctx, scrapeJob); updateErr != nil {
-		log.Printf("Warning: failed to update scrape job record: %v", updateErr)
+		logger.Warn("failed to update scrape job record", "error", updateErr)
+	}
+	logger.Info("scrape job finished", "status", scrapeJob.Status)
+
+	if err == nil && !skipped {
+		enqueueEnrichment(ctx, w.listingRepo)
 	}
 
 	return err
 }
 
 // ScrapeAllJobArgs triggers scraping all active sources
-type ScrapeAllJobArgs struct{}
+type ScrapeAllJobArgs struct {
+	Trigger   string `json:"trigger,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
 
 func (ScrapeAllJobArgs) Kind() string { return "scrape_all" }
 
+func (ScrapeAllJobArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{Queue: QueueScrape}
+}
+
 type ScrapeAllJobWorker struct {
 	river.WorkerDefaults[ScrapeAllJobArgs]
 	engine      *engine.Engine
@@ -103,8 +152,38 @@ func NewScrapeAllJobWorker(eng *engine.Engine, sourceRepo *repository.SourceRepo
 }
 
 func (w *ScrapeAllJobWorker) Work(ctx context.Context, job *river.Job[ScrapeAllJobArgs]) error {
-	log.Println("Starting scrape all job - running all scrapers sequentially")
+	trigger := scrapeTrigger(job.Args.Trigger, job.Attempt)
+	logger := jobLogger(job.ID, job.Args.RequestID)
+	logger.Info("starting scrape all job, running all scrapers sequentially", "trigger", trigger)
 
 	// Instead of queuing individual jobs, just run them all directly
-	return w.engine.RunAll(ctx)
+	if err := w.engine.RunAll(engine.WithTrigger(ctx, trigger)); err != nil {
+		return err
+	}
+
+	logger.Info("scrape all job finished")
+	enqueueEnrichment(ctx, w.listingRepo)
+	return nil
+}
+
+// jobLogger is the default logger with the River job's ID and, for jobs
+// queued by an API request, the request's ID
+func jobLogger(jobID int64, requestID string) *slog.Logger {
+	logger := slog.With("job_id", jobID)
+	if requestID != "" {
+		logger = logger.With("request_id", requestID)
+	}
+	return logger
+}
+
+// scrapeTrigger returns the trigger recorded for a job's runs: retry once
+// River has retried the job, else the one it was queued with
+func scrapeTrigger(queuedWith string, attempt int) string {
+	switch {
+	case attempt > 1:
+		return domain.ScrapeTriggerRetry
+	case queuedWith == "":
+		return domain.ScrapeTriggerManual
+	}
+	return queuedWith
 }
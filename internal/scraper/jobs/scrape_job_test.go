@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestScrapeTrigger(t *testing.T) {
+	tests := []struct {
+		queuedWith string
+		attempt    int
+		want       string
+	}{
+		{domain.ScrapeTriggerPeriodic, 1, domain.ScrapeTriggerPeriodic},
+		{domain.ScrapeTriggerAPI, 1, domain.ScrapeTriggerAPI},
+		{"", 1, domain.ScrapeTriggerManual},
+		{domain.ScrapeTriggerAPI, 2, domain.ScrapeTriggerRetry},
+		{"", 3, domain.ScrapeTriggerRetry},
+	}
+
+	for _, tt := range tests {
+		if got := scrapeTrigger(tt.queuedWith, tt.attempt); got != tt.want {
+			t.Errorf("scrapeTrigger(%q, %d) = %q, want %q", tt.queuedWith, tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/riverqueue/river"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// QueueScrape is the queue scrape jobs run on. The worker gives it
+// StaggeredScheduler.Concurrency workers, so no more sources than that
+// scrape at once however their runs were queued.
+const QueueScrape = "scrape"
+
+// StaggeredScheduler spreads the periodic scrapes of sources across Window
+// instead of starting them all at once. A source with scrape_weight w runs w
+// times per window; runs are interleaved by smooth weighted round-robin and
+// started in slots of at most Concurrency runs.
+type StaggeredScheduler struct {
+	Window      time.Duration
+	Concurrency int
+}
+
+// staggeredRun is one scheduled scrape: slug, Offset into each window
+type staggeredRun struct {
+	Slug   string
+	Offset time.Duration
+}
+
+// PeriodicJobs returns a periodic scrape job for every run of the sources
+func (s StaggeredScheduler) PeriodicJobs(sources []domain.Source) []*river.PeriodicJob {
+	runs := s.plan(sources)
+	periodic := make([]*river.PeriodicJob, len(runs))
+	for i, run := range runs {
+		slug := run.Slug
+		periodic[i] = river.NewPeriodicJob(
+			staggeredSchedule{window: s.Window, offset: run.Offset},
+			func() (river.JobArgs, *river.InsertOpts) {
+				return ScrapeJobArgs{SourceSlug: slug, FullScrape: true, Trigger: domain.ScrapeTriggerPeriodic}, nil
+			},
+			nil,
+		)
+	}
+	return periodic
+}
+
+// plan orders the sources' runs by smooth weighted round-robin, which keeps
+// a heavy source's runs apart, and assigns every Concurrency consecutive runs
+// to the next of the window's equal slots
+func (s StaggeredScheduler) plan(sources []domain.Source) []staggeredRun {
+	weights := make([]int, len(sources))
+	total := 0
+	for i, source := range sources {
+		weights[i] = 1
+		// An invalid config fails the source's scrapes; schedule it once
+		if cfg, err := domain.ParseSourceConfig(source.Config); err == nil && cfg.ScrapeWeight > 0 {
+			weights[i] = cfg.ScrapeWeight
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		return nil
+	}
+
+	concurrency := max(s.Concurrency, 1)
+	slots := (total + concurrency - 1) / concurrency
+	slotLength := s.Window / time.Duration(slots)
+
+	runs := make([]staggeredRun, 0, total)
+	current := make([]int, len(sources))
+	for n := 0; n < total; n++ {
+		best := 0
+		for i, w := range weights {
+			current[i] += w
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		runs = append(runs, staggeredRun{
+			Slug:   sources[best].Slug,
+			Offset: time.Duration(n/concurrency) * slotLength,
+		})
+	}
+	return runs
+}
+
+// staggeredSchedule fires at offset into every window, counting windows from
+// the zero time so runs land at the same times of day across restarts
+type staggeredSchedule struct {
+	window time.Duration
+	offset time.Duration
+}
+
+func (s staggeredSchedule) Next(current time.Time) time.Time {
+	next := current.UTC().Truncate(s.window).Add(s.offset)
+	if !next.After(current) {
+		next = next.Add(s.window)
+	}
+	return next
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func testSources(configs ...string) []domain.Source {
+	sources := make([]domain.Source, len(configs))
+	for i, cfg := range configs {
+		sources[i] = domain.Source{Slug: string(rune('a' + i)), Config: []byte(cfg)}
+	}
+	return sources
+}
+
+func TestStaggeredSchedulerPlan(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		sources     []domain.Source
+		want        []staggeredRun
+	}{
+		{
+			name:        "even spread, two at a time",
+			concurrency: 2,
+			sources:     testSources("{}", "{}", "{}", "{}", "{}", "{}"),
+			want: []staggeredRun{
+				{"a", 0}, {"b", 0},
+				{"c", 8 * time.Hour}, {"d", 8 * time.Hour},
+				{"e", 16 * time.Hour}, {"f", 16 * time.Hour},
+			},
+		},
+		{
+			name:        "weighted runs kept apart",
+			concurrency: 1,
+			sources:     testSources(`{"scrape_weight":2}`, "{}", "{}"),
+			want: []staggeredRun{
+				{"a", 0}, {"b", 6 * time.Hour}, {"c", 12 * time.Hour}, {"a", 18 * time.Hour},
+			},
+		},
+		{
+			name:        "invalid config scheduled once",
+			concurrency: 0,
+			sources:     testSources(`{"crawl_strategy":"nope","scrape_weight":5}`, "{}"),
+			want:        []staggeredRun{{"a", 0}, {"b", 12 * time.Hour}},
+		},
+		{
+			name:        "no sources",
+			concurrency: 2,
+			want:        nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := StaggeredScheduler{Window: 24 * time.Hour, Concurrency: tt.concurrency}
+			got := s.plan(tt.sources)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d runs %v, want %v", len(got), got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("run %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+			if jobs := s.PeriodicJobs(tt.sources); len(jobs) != len(tt.want) {
+				t.Errorf("got %d periodic jobs, want %d", len(jobs), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestStaggeredScheduleNext(t *testing.T) {
+	schedule := staggeredSchedule{window: 24 * time.Hour, offset: 6 * time.Hour}
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		current time.Time
+		want    time.Time
+	}{
+		{day.Add(5 * time.Hour), day.Add(6 * time.Hour)},
+		{day.Add(6 * time.Hour), day.Add(30 * time.Hour)},
+		{day.Add(7 * time.Hour), day.Add(30 * time.Hour)},
+		// Other zones get the same instant
+		{day.Add(5 * time.Hour).In(time.FixedZone("CDT", -5*3600)), day.Add(6 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		if got := schedule.Next(tt.current); !got.Equal(tt.want) {
+			t.Errorf("Next(%v) = %v, want %v", tt.current, got, tt.want)
+		}
+	}
+}
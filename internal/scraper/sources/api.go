@@ -0,0 +1,506 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// apiMaxBytes caps a single API response
+const apiMaxBytes = 20 << 20
+
+// APIScraper reads listings from the JSON or XML search API behind a source's
+// site, which holds up far better than its HTML. Sources opt in with
+// crawl_strategy "api"; the endpoint, the paths of each listing field in its
+// results and how it pages all come from the source config, so no Go code is
+// needed per source.
+type APIScraper struct {
+	logger *slog.Logger
+	client *http.Client
+}
+
+func NewAPIScraper(logger *slog.Logger) *APIScraper {
+	return &APIScraper{
+		logger: scraperLogger(logger, "api"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *APIScraper) Name() string {
+	return "api"
+}
+
+func (s *APIScraper) Version() int {
+	return apiVersion
+}
+
+// Scrape pages through the API until a page comes back empty or short, the
+// cursor runs out, or the run's page or listing cap is reached
+func (s *APIScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
+	listings := make(chan *domain.Listing, 100)
+	errors := make(chan error, 10)
+
+	go func() {
+		defer close(listings)
+		defer close(errors)
+
+		cfg, err := domain.ParseSourceConfig(opts.SourceConfig)
+		if err != nil {
+			errors <- err
+			return
+		}
+		if cfg.API == nil || opts.BaseURL == "" {
+			errors <- fmt.Errorf("api: source needs a base_url and an api config")
+			return
+		}
+		api := cfg.API
+		site := newSite(strings.TrimRight(opts.BaseURL, "/"), "", nil).forRun(opts)
+
+		accept := "application/json"
+		if api.Format == domain.APIFormatXML {
+			accept = "application/xml, text/xml"
+		}
+		f := &pageFetcher{
+			source: s.Name(), client: s.client, logger: s.logger,
+			opts: opts, errors: errors, maxBytes: apiMaxBytes, accept: accept,
+			headers: site.headers,
+		}
+		pages := newAPIPager(api.Pagination)
+		maxPages := maxFollowedPages(opts) + 1
+
+		count := 0
+		for page := 0; page < maxPages && ctx.Err() == nil; page++ {
+			pageURL, err := apiPageURL(site.absURL(api.Endpoint), api.Params, pages)
+			if err != nil {
+				errors <- err
+				return
+			}
+			body, err := f.fetch(ctx, pageURL)
+			if err != nil {
+				f.sendError(err)
+				return
+			}
+			doc, err := decodeAPIResponse(body, api.Format)
+			if err != nil {
+				f.sendError(fmt.Errorf("api %s: %w", pageURL, err))
+				return
+			}
+
+			results := apiResults(doc, api.Results)
+			for _, result := range results {
+				if opts.MaxListings > 0 && count >= opts.MaxListings {
+					return
+				}
+				listing, err := parseAPIListing(result, api, site)
+				if err != nil {
+					f.sendError(fmt.Errorf("api %s: %w", pageURL, err))
+					continue
+				}
+				if site.skips(listing.URL) {
+					continue
+				}
+				select {
+				case listings <- listing:
+					count++
+				case <-ctx.Done():
+					return
+				}
+			}
+			s.logger.Debug("scraped api page", "page", page+1, "results", len(results))
+
+			if !pages.next(doc, len(results)) {
+				break
+			}
+		}
+	}()
+
+	return listings, errors
+}
+
+// apiPager tracks the page, offset or cursor of the next request
+type apiPager struct {
+	cfg *domain.SourceAPIPagination
+	// fetched is the number of pages fetched so far
+	fetched int
+	// position is the next page number or offset
+	position int
+	cursor   string
+}
+
+func newAPIPager(cfg *domain.SourceAPIPagination) *apiPager {
+	p := &apiPager{cfg: cfg}
+	if cfg != nil {
+		if cfg.Type == domain.APIPageNumber {
+			p.position = 1
+		}
+		if cfg.Start != nil {
+			p.position = *cfg.Start
+		}
+	}
+	return p
+}
+
+// params sets the pagination params of the next request
+func (p *apiPager) params(q url.Values) {
+	if p.cfg == nil {
+		return
+	}
+	if p.cfg.SizeParam != "" {
+		q.Set(p.cfg.SizeParam, strconv.Itoa(p.cfg.Size))
+	}
+	if p.cfg.Type == domain.APIPageCursor {
+		// The first page is requested without one
+		if p.cursor != "" {
+			q.Set(p.cfg.Param, p.cursor)
+		}
+		return
+	}
+	q.Set(p.cfg.Param, strconv.Itoa(p.position))
+}
+
+// next moves past a page of n results in doc, reporting whether there may be
+// another
+func (p *apiPager) next(doc interface{}, n int) bool {
+	p.fetched++
+	if p.cfg == nil || n == 0 || (p.cfg.SizeParam != "" && n < p.cfg.Size) {
+		return false
+	}
+	if p.cfg.TotalPagesPath != "" {
+		if total, ok := apiInt(lookupPath(doc, p.cfg.TotalPagesPath)); ok && p.fetched >= total {
+			return false
+		}
+	}
+
+	switch p.cfg.Type {
+	case domain.APIPageCursor:
+		cursor, _ := apiString(lookupPath(doc, p.cfg.CursorPath))
+		if cursor == "" || cursor == p.cursor {
+			return false
+		}
+		p.cursor = cursor
+	case domain.APIPageOffset:
+		p.position += n
+	default:
+		p.position++
+	}
+	return true
+}
+
+// apiPageURL is endpoint with params and the pager's params added to its query
+func apiPageURL(endpoint string, params map[string]string, pages *apiPager) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("api endpoint: %w", err)
+	}
+	q := u.Query()
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	pages.params(q)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// decodeAPIResponse decodes a response into maps, slices and scalars.
+// JSON numbers are kept as json.Number; see decodeXMLTree for XML.
+func decodeAPIResponse(body []byte, format string) (interface{}, error) {
+	if format == domain.APIFormatXML {
+		return decodeXMLTree(body)
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// decodeXMLTree decodes an XML document into nested maps keyed by element
+// name, with attributes under "@name" and an element's text under "#text".
+// An element with neither children nor attributes is just its text, and
+// repeated children become a slice. The root element is a key of the result.
+func decodeXMLTree(body []byte) (interface{}, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	type frame struct {
+		name   string
+		fields map[string]interface{}
+		text   strings.Builder
+	}
+	root := &frame{fields: map[string]interface{}{}}
+	stack := []*frame{root}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el := &frame{name: t.Name.Local, fields: map[string]interface{}{}}
+			for _, attr := range t.Attr {
+				el.fields["@"+attr.Name.Local] = attr.Value
+			}
+			stack = append(stack, el)
+		case xml.CharData:
+			stack[len(stack)-1].text.Write(t)
+		case xml.EndElement:
+			el := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			var value interface{} = el.fields
+			text := strings.TrimSpace(el.text.String())
+			if len(el.fields) == 0 {
+				value = text
+			} else if text != "" {
+				el.fields["#text"] = text
+			}
+			parent := stack[len(stack)-1].fields
+			switch existing := parent[el.name].(type) {
+			case nil:
+				parent[el.name] = value
+			case []interface{}:
+				parent[el.name] = append(existing, value)
+			default:
+				parent[el.name] = []interface{}{existing, value}
+			}
+		}
+	}
+	if len(root.fields) == 0 {
+		return nil, fmt.Errorf("no root element")
+	}
+	return root.fields, nil
+}
+
+// apiResults returns the results at path in doc. A single object, as XML gives
+// for one repeated element, is a page of one.
+func apiResults(doc interface{}, path string) []interface{} {
+	switch v := lookupPath(doc, path).(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		return []interface{}{v}
+	}
+	return nil
+}
+
+// lookupPath returns the value at a path like "$.data.items[0].name" in a
+// decoded response, or nil if there is none
+func lookupPath(v interface{}, path string) interface{} {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return v
+	}
+	for _, part := range strings.Split(path, ".") {
+		key, indexes, _ := strings.Cut(part, "[")
+		if key != "" {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			v = m[key]
+		}
+		if indexes == "" {
+			continue
+		}
+		for _, index := range strings.Split(strings.TrimSuffix(indexes, "]"), "][") {
+			i, err := strconv.Atoi(index)
+			list, ok := v.([]interface{})
+			if err != nil || !ok || i < 0 || i >= len(list) {
+				return nil
+			}
+			v = list[i]
+		}
+	}
+	return v
+}
+
+// parseAPIListing maps one API result onto a listing
+func parseAPIListing(result interface{}, api *domain.SourceAPIConfig, site siteConfig) (*domain.Listing, error) {
+	field := func(name string) interface{} {
+		path, ok := api.Fields[name]
+		if !ok {
+			return nil
+		}
+		return lookupPath(result, path)
+	}
+	str := func(name string) *string {
+		if s, ok := apiString(field(name)); ok && s != "" {
+			return &s
+		}
+		return nil
+	}
+
+	externalID, _ := apiString(field("external_id"))
+	if externalID == "" {
+		return nil, fmt.Errorf("result without an external ID")
+	}
+	rawTitle, _ := apiString(field("title"))
+	title := site.cleanTitle(rawTitle)
+	if title == "" {
+		return nil, fmt.Errorf("result %s without a title", externalID)
+	}
+
+	link, _ := apiString(field("url"))
+	if link == "" {
+		link = strings.ReplaceAll(api.URLTemplate, "{external_id}", url.PathEscape(externalID))
+	}
+	if !strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "http") {
+		link = "/" + link
+	}
+
+	listing := &domain.Listing{
+		ID:          uuid.New(),
+		ExternalID:  externalID,
+		URL:         site.absURL(link),
+		Title:       title,
+		Description: str("description"),
+		City:        str("city"),
+		State:       str("state"),
+		ZipCode:     str("zip_code"),
+		Industry:    str("industry"),
+		Country:     domain.StrPtr("US"),
+		IsActive:    true,
+	}
+	texts := make(priceTexts)
+	for name, dst := range map[string]**int64{
+		finAskingPrice: &listing.AskingPrice,
+		finRevenue:     &listing.Revenue,
+		finCashFlow:    &listing.CashFlow,
+		finEBITDA:      &listing.EBITDA,
+		finInventory:   &listing.Inventory,
+	} {
+		v := field(name)
+		if text, ok := v.(string); ok {
+			texts.set(name, text)
+		}
+		*dst = apiMoney(v)
+	}
+	if text, ok := field(finAskingPrice).(string); ok && listing.AskingPrice == nil {
+		_, _, listing.PriceOnRequest = parsePriceRange(text)
+	}
+	if v, ok := apiFloat(field("lat")); ok {
+		listing.Lat = &v
+	}
+	if v, ok := apiFloat(field("lng")); ok {
+		listing.Lng = &v
+	}
+	if v, ok := apiInt(field("year_established")); ok && v >= minYearEstablished && v <= time.Now().Year() {
+		listing.YearEstablished = &v
+	}
+	if v, ok := apiInt(field("employees")); ok && v > 0 && v <= maxEmployees {
+		listing.Employees = &v
+	}
+	if v, ok := apiBool(field("is_franchise")); ok {
+		listing.IsFranchise = &v
+	}
+	listing.FranchiseName = str("franchise_name")
+	if v, ok := apiBool(field("real_estate_included")); ok {
+		listing.RealEstateIncluded = &v
+	}
+
+	rawData := map[string]interface{}{
+		"source_url": listing.URL,
+		"title":      rawTitle,
+		"discovery":  domain.CrawlStrategyAPI,
+		"result":     result,
+		"scraped_at": time.Now().Format(time.RFC3339),
+	}
+	texts.addTo(rawData)
+	if jsonBytes, err := json.Marshal(rawData); err == nil {
+		listing.RawData = jsonBytes
+	}
+	return listing, nil
+}
+
+// apiString returns a string or number result value as a trimmed string
+func apiString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v), true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// apiFloat returns a number, or a string holding one
+func apiFloat(v interface{}) (float64, bool) {
+	s, ok := apiString(v)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// apiInt returns a whole number, or a string holding one
+func apiInt(v interface{}) (int, bool) {
+	f, ok := apiFloat(v)
+	if !ok || f != math.Trunc(f) || math.Abs(f) > math.MaxInt32 {
+		return 0, false
+	}
+	return int(f), true
+}
+
+// apiBool returns a boolean, or a string or number reading as one
+func apiBool(v interface{}) (bool, bool) {
+	s, ok := apiString(v)
+	if !ok {
+		return false, false
+	}
+	switch strings.ToLower(s) {
+	case "true", "yes", "y", "1":
+		return true, true
+	case "false", "no", "n", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// apiMoney returns a figure in cents: a number is taken as dollars, and text
+// such as "$1.2M" is parsed like scraped figures. Zero and missing figures
+// are nil.
+func apiMoney(v interface{}) *int64 {
+	var cents int64
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil || math.Abs(f) > math.MaxInt64/100 {
+			return nil
+		}
+		cents = int64(math.Round(f * 100))
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && math.Abs(f) <= math.MaxInt64/100 {
+			cents = int64(math.Round(f * 100))
+		} else {
+			cents = parsePrice(v)
+		}
+	default:
+		return nil
+	}
+	if cents == 0 {
+		return nil
+	}
+	return &cents
+}
@@ -0,0 +1,247 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// algoliaTestConfig maps the recorded Algolia hits in testdata
+const algoliaTestConfig = `{"crawl_strategy":"api","api":{
+	"preset":"algolia",
+	"endpoint":"/1/indexes/listings",
+	"params":{"x-algolia-application-id":"TESTAPP","x-algolia-api-key":"search-only-key"},
+	"fields":{
+		"title":"title","url":"slug","description":"summary",
+		"asking_price":"financials.askingPrice","revenue":"financials.grossRevenue",
+		"cash_flow":"financials.cashFlow","ebitda":"financials.ebitda",
+		"city":"location.city","state":"location.state","zip_code":"location.zip",
+		"lat":"location._geoloc.lat","lng":"location._geoloc.lng","industry":"category",
+		"year_established":"yearEstablished","employees":"employees",
+		"is_franchise":"franchise","franchise_name":"franchiseName","real_estate_included":"realEstate"
+	},
+	"pagination":{"type":"page","param":"page","start":0,"size_param":"hitsPerPage","size":2,"total_pages_path":"nbPages"}
+}}`
+
+// algoliaServer serves the recorded Algolia pages by their page param
+func algoliaServer(t *testing.T) (*httptest.Server, *[]url.Values) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var queries []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+
+		if r.URL.Path != "/1/indexes/listings" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeFile(w, r, filepath.Join("testdata", fmt.Sprintf("api_algolia_page%s.json", r.URL.Query().Get("page"))))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &queries
+}
+
+func scrapeAPI(t *testing.T, opts domain.ScrapeOptions) []*domain.Listing {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	listingsCh, errCh := NewAPIScraper(nil).Scrape(ctx, opts)
+
+	var listings []*domain.Listing
+	for l := range listingsCh {
+		listings = append(listings, l)
+	}
+	for err := range errCh {
+		t.Errorf("scrape error: %v", err)
+	}
+	return listings
+}
+
+func TestAPIScraperAlgolia(t *testing.T) {
+	srv, queries := algoliaServer(t)
+
+	got := scrapeAPI(t, domain.ScrapeOptions{
+		FullScrape:   true,
+		BaseURL:      srv.URL,
+		SourceConfig: json.RawMessage(algoliaTestConfig),
+	})
+
+	var ids []string
+	for _, l := range got {
+		ids = append(ids, l.ExternalID)
+	}
+	if want := "ls-20931,ls-20987,ls-21004"; strings.Join(ids, ",") != want {
+		t.Fatalf("external IDs = %v, want %s", ids, want)
+	}
+
+	// Two pages, then nbPages ends the crawl
+	if len(*queries) != 2 {
+		t.Fatalf("made %d requests, want 2", len(*queries))
+	}
+	for i, q := range *queries {
+		if q.Get("page") != fmt.Sprint(i) || q.Get("hitsPerPage") != "2" || q.Get("x-algolia-api-key") != "search-only-key" {
+			t.Errorf("request %d query = %v", i, q)
+		}
+	}
+
+	hvac := got[0]
+	if hvac.URL != srv.URL+"/listing/established-hvac-company/20931" {
+		t.Errorf("URL = %q", hvac.URL)
+	}
+	if hvac.Title != "Established HVAC Company" {
+		t.Errorf("title = %q, want the cleaned title", hvac.Title)
+	}
+	if hvac.AskingPrice == nil || *hvac.AskingPrice != 125000000 || hvac.Revenue == nil || *hvac.Revenue != 340000000 {
+		t.Errorf("asking price = %v, revenue = %v; want 125000000, 340000000", hvac.AskingPrice, hvac.Revenue)
+	}
+	if hvac.EBITDA != nil {
+		t.Errorf("ebitda = %v, want nil for null", *hvac.EBITDA)
+	}
+	if hvac.City == nil || *hvac.City != "Tampa" || hvac.ZipCode == nil || *hvac.ZipCode != "33602" {
+		t.Errorf("location = %v, %v", hvac.City, hvac.ZipCode)
+	}
+	if hvac.Lat == nil || *hvac.Lat != 27.9506 || hvac.Lng == nil || *hvac.Lng != -82.4572 {
+		t.Errorf("coordinates = %v, %v", hvac.Lat, hvac.Lng)
+	}
+	if hvac.YearEstablished == nil || *hvac.YearEstablished != 2004 || hvac.Employees == nil || *hvac.Employees != 18 {
+		t.Errorf("year = %v, employees = %v; want 2004, 18", hvac.YearEstablished, hvac.Employees)
+	}
+	if hvac.IsFranchise == nil || *hvac.IsFranchise || hvac.RealEstateIncluded == nil || *hvac.RealEstateIncluded {
+		t.Errorf("franchise = %v, real estate = %v; want false, false", hvac.IsFranchise, hvac.RealEstateIncluded)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(hvac.RawData, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw["discovery"] != domain.CrawlStrategyAPI || raw["result"] == nil || raw["title"] != "For Sale: Established HVAC Company" {
+		t.Errorf("raw_data = %s", hvac.RawData)
+	}
+
+	// Figures given as text are parsed like scraped ones, and the text kept
+	coffee := got[1]
+	if coffee.AskingPrice == nil || *coffee.AskingPrice != 29500000 || coffee.CashFlow == nil || *coffee.CashFlow != 11850000 {
+		t.Errorf("asking price = %v, cash flow = %v; want 29500000, 11850000", coffee.AskingPrice, coffee.CashFlow)
+	}
+	if coffee.IsFranchise == nil || !*coffee.IsFranchise || coffee.FranchiseName == nil || *coffee.FranchiseName != "Dutch Bros" {
+		t.Errorf("franchise = %v, %v", coffee.IsFranchise, coffee.FranchiseName)
+	}
+	raw = nil
+	json.Unmarshal(coffee.RawData, &raw)
+	if raw["price_text"] != "$295K" {
+		t.Errorf("price_text = %v, want $295K", raw["price_text"])
+	}
+}
+
+func TestAPIScraperMaxListings(t *testing.T) {
+	srv, queries := algoliaServer(t)
+
+	got := scrapeAPI(t, domain.ScrapeOptions{
+		FullScrape:   true,
+		MaxListings:  1,
+		BaseURL:      srv.URL,
+		SourceConfig: json.RawMessage(algoliaTestConfig),
+	})
+	if len(got) != 1 || len(*queries) != 1 {
+		t.Errorf("got %d listings from %d requests, want 1 from 1", len(got), len(*queries))
+	}
+}
+
+func TestAPIScraperXMLCursor(t *testing.T) {
+	pages := map[string]string{
+		"": `<?xml version="1.0"?>
+<response><next>abc</next><listings>
+  <listing id="7"><name>Auto Repair Shop</name><price>$350,000</price><city>Reno</city></listing>
+  <listing id="8"><name>Dog Grooming Salon</name><price>190000</price></listing>
+</listings></response>`,
+		"abc": `<?xml version="1.0"?>
+<response><next></next><listings>
+  <listing id="9"><name>Print Shop</name></listing>
+</listings></response>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), "xml") {
+			t.Errorf("Accept = %q, want xml", r.Header.Get("Accept"))
+		}
+		fmt.Fprint(w, pages[r.URL.Query().Get("after")])
+	}))
+	defer srv.Close()
+
+	config := `{"crawl_strategy":"api","api":{"endpoint":"/feed.xml","format":"xml",
+		"results":"response.listings.listing","url_template":"/business/{external_id}",
+		"fields":{"external_id":"@id","title":"name","asking_price":"price","city":"city"},
+		"pagination":{"type":"cursor","param":"after","cursor_path":"response.next"}}}`
+	got := scrapeAPI(t, domain.ScrapeOptions{FullScrape: true, BaseURL: srv.URL, SourceConfig: json.RawMessage(config)})
+
+	if len(got) != 3 {
+		t.Fatalf("got %d listings, want 3", len(got))
+	}
+	first := got[0]
+	if first.ExternalID != "7" || first.URL != srv.URL+"/business/7" || first.Title != "Auto Repair Shop" {
+		t.Errorf("first = %q %q %q", first.ExternalID, first.URL, first.Title)
+	}
+	if first.AskingPrice == nil || *first.AskingPrice != 35000000 || got[1].AskingPrice == nil || *got[1].AskingPrice != 19000000 {
+		t.Errorf("asking prices = %v, %v", first.AskingPrice, got[1].AskingPrice)
+	}
+	// A page of one element is still a page
+	if got[2].ExternalID != "9" {
+		t.Errorf("last external ID = %q, want 9", got[2].ExternalID)
+	}
+}
+
+func TestAPIPagerOffset(t *testing.T) {
+	pager := newAPIPager(&domain.SourceAPIPagination{Type: domain.APIPageOffset, Param: "offset", SizeParam: "limit", Size: 50})
+	var offsets []string
+	more := true
+	for _, n := range []int{50, 50, 20} {
+		q := url.Values{}
+		pager.params(q)
+		offsets = append(offsets, q.Get("offset"))
+		more = pager.next(nil, n)
+	}
+	if want := []string{"0", "50", "100"}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("offsets = %v, want %v", offsets, want)
+	}
+	if more {
+		t.Error("a short page wasn't the last")
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	doc, err := decodeAPIResponse([]byte(`{"data":{"items":[{"name":"a","tags":[["x","y"]]},{"name":"b"}]}}`), domain.APIFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"data.items[1].name", "b"},
+		{"$.data.items[0].name", "a"},
+		{"data.items[0].tags[0][1]", "y"},
+		{"data.items[2].name", nil},
+		{"data.missing.name", nil},
+		{"data.items.name", nil},
+	}
+	for _, tt := range tests {
+		if got := lookupPath(doc, tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lookupPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
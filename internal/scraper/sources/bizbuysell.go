@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"regexp"
 	"strconv"
 	"strings"
@@ -16,16 +16,37 @@ import (
 	"github.com/kbsch/trough/internal/domain"
 )
 
-type BizBuySellScraper struct{}
+// Listing card selectors, reported to ScrapeOptions.MatchCard
+const (
+	bizBuySellCardSelector    = "div.listing, div.listing-card, div.diamond-listing, article.listing"
+	bizBuySellAltCardSelector = "div[data-listing-id]"
+)
 
-func NewBizBuySellScraper() *BizBuySellScraper {
-	return &BizBuySellScraper{}
+type BizBuySellScraper struct {
+	logger *slog.Logger
+	site   siteConfig
+}
+
+func NewBizBuySellScraper(logger *slog.Logger, opts ...Option) *BizBuySellScraper {
+	return &BizBuySellScraper{
+		logger: scraperLogger(logger, "bizbuysell"),
+		site:   newSite("https://www.bizbuysell.com", "/businesses-for-sale/", opts),
+	}
 }
 
 func (s *BizBuySellScraper) Name() string {
 	return "bizbuysell"
 }
 
+func (s *BizBuySellScraper) Version() int {
+	return bizBuySellVersion
+}
+
+// CardSelectors returns the selector groups that find listing cards
+func (s *BizBuySellScraper) CardSelectors() []string {
+	return []string{bizBuySellCardSelector, bizBuySellAltCardSelector}
+}
+
 func (s *BizBuySellScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
 	listings := make(chan *domain.Listing, 100)
 	errors := make(chan error, 10)
@@ -34,14 +55,15 @@ func (s *BizBuySellScraper) Scrape(ctx context.Context, opts domain.ScrapeOption
 		defer close(listings)
 		defer close(errors)
 
+		site := s.site.forRun(opts)
+
 		c := colly.NewCollector(
-			colly.AllowedDomains("www.bizbuysell.com", "bizbuysell.com"),
-			colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"),
+			colly.AllowedDomains(site.allowedDomains()...),
 			colly.MaxDepth(2),
 		)
 
 		c.Limit(&colly.LimitRule{
-			DomainGlob:  "*bizbuysell.com*",
+			DomainGlob:  site.domainGlob(),
 			Delay:       opts.RateLimit,
 			RandomDelay: 1 * time.Second,
 			Parallelism: 1,
@@ -49,25 +71,23 @@ func (s *BizBuySellScraper) Scrape(ctx context.Context, opts domain.ScrapeOption
 
 		count := 0
 		pageCount := 0
-		maxPages := 50 // Default max pages
-		if opts.MaxListings > 0 {
-			maxPages = (opts.MaxListings / 20) + 1
-		}
+		maxPages := maxFollowedPages(opts)
 
 		// Parse listing cards from search results
 		// BizBuySell uses .listing-card or similar for each listing
-		c.OnHTML("div.listing, div.listing-card, article.listing", func(e *colly.HTMLElement) {
+		c.OnHTML(bizBuySellCardSelector, func(e *colly.HTMLElement) {
+			opts.MatchedCard(bizBuySellCardSelector)
 			if opts.MaxListings > 0 && count >= opts.MaxListings {
 				return
 			}
 
-			listing := s.parseListingCard(e)
-			if listing != nil {
+			listing := s.parseListingCard(e, site)
+			if listing != nil && !site.skips(listing.URL) {
 				select {
 				case listings <- listing:
 					count++
 					if count%10 == 0 {
-						log.Printf("BizBuySell: scraped %d listings", count)
+						s.logger.Debug("scraped listings", "count", count)
 					}
 				case <-ctx.Done():
 					return
@@ -76,13 +96,29 @@ func (s *BizBuySellScraper) Scrape(ctx context.Context, opts domain.ScrapeOption
 		})
 
 		// Alternative selector for newer BizBuySell layout
-		c.OnHTML("div[data-listing-id]", func(e *colly.HTMLElement) {
+		c.OnHTML(bizBuySellAltCardSelector, func(e *colly.HTMLElement) {
+			opts.MatchedCard(bizBuySellAltCardSelector)
 			if opts.MaxListings > 0 && count >= opts.MaxListings {
 				return
 			}
 
-			listing := s.parseDataListing(e)
-			if listing != nil {
+			listing := s.parseDataListing(e, site)
+			if listing != nil && !site.skips(listing.URL) {
+				select {
+				case listings <- listing:
+					count++
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+
+		// Structured data, for pages the card selectors miss
+		c.OnHTML("html", func(e *colly.HTMLElement) {
+			for _, listing := range parseJSONLD(pageJSONLD(e, s.CardSelectors()), site, extractBizBuySellID) {
+				if opts.MaxListings > 0 && count >= opts.MaxListings {
+					return
+				}
 				select {
 				case listings <- listing:
 					count++
@@ -100,48 +136,57 @@ func (s *BizBuySellScraper) Scrape(ctx context.Context, opts domain.ScrapeOption
 			if pageCount >= maxPages {
 				return
 			}
-			pageCount++
 
 			nextURL := e.Attr("href")
-			if nextURL != "" && !strings.HasPrefix(nextURL, "javascript:") {
-				if !strings.HasPrefix(nextURL, "http") {
-					nextURL = "https://www.bizbuysell.com" + nextURL
+			if nextURL == "" || strings.HasPrefix(nextURL, "javascript:") {
+				return
+			}
+			nextURL = site.absURL(nextURL)
+			if site.skips(nextURL) {
+				return
+			}
+			pageCount++
+			s.logger.Debug("following page", "page", pageCount, "url", nextURL)
+			e.Request.Visit(nextURL)
+		})
+
+		c.OnResponse(func(r *colly.Response) {
+			err := blockedPageError(s.Name(), r, site)
+			opts.Record(r.Request.URL.String(), r.StatusCode, err)
+			if err != nil {
+				select {
+				case errors <- err:
+				default:
 				}
-				log.Printf("BizBuySell: following page %d: %s", pageCount, nextURL)
-				e.Request.Visit(nextURL)
 			}
 		})
 
 		c.OnError(func(r *colly.Response, err error) {
+			opts.Record(r.Request.URL.String(), r.StatusCode, err)
 			select {
-			case errors <- fmt.Errorf("request error %d: %s - %v", r.StatusCode, r.Request.URL, err):
+			case errors <- requestError(s.Name(), r, err):
 			default:
 			}
 		})
 
-		c.OnRequest(func(r *colly.Request) {
-			// Add headers to appear more like a browser
-			r.Headers.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-			r.Headers.Set("Accept-Language", "en-US,en;q=0.5")
-			r.Headers.Set("Connection", "keep-alive")
-		})
+		c.OnRequest(site.onRequest(ctx, opts))
 
 		// Start with main search page
-		startURL := "https://www.bizbuysell.com/businesses-for-sale/"
-		log.Printf("BizBuySell: starting scrape from %s", startURL)
+		startURL := site.startURL()
+		s.logger.Info("starting scrape", "url", startURL)
 
 		if err := c.Visit(startURL); err != nil {
 			errors <- fmt.Errorf("failed to start scrape: %w", err)
 		}
 
 		c.Wait()
-		log.Printf("BizBuySell: scrape completed with %d listings", count)
+		s.logger.Info("scrape completed", "listings", count)
 	}()
 
 	return listings, errors
 }
 
-func (s *BizBuySellScraper) parseListingCard(e *colly.HTMLElement) *domain.Listing {
+func (s *BizBuySellScraper) parseListingCard(e *colly.HTMLElement, site siteConfig) *domain.Listing {
 	// Try multiple selectors for the URL
 	url := e.ChildAttr("a.title", "href")
 	if url == "" {
@@ -176,12 +221,14 @@ func (s *BizBuySellScraper) parseListingCard(e *colly.HTMLElement) *domain.Listi
 	if title == "" {
 		return nil
 	}
-
-	fullURL := url
-	if !strings.HasPrefix(url, "http") {
-		fullURL = "https://www.bizbuysell.com" + url
+	// Boilerplate is stripped from the title; the raw one is kept in raw_data
+	rawTitle := title
+	if title = site.cleanTitle(title); title == "" {
+		return nil
 	}
 
+	fullURL := site.absURL(url)
+
 	listing := &domain.Listing{
 		ID:         uuid.New(),
 		ExternalID: externalID,
@@ -189,7 +236,9 @@ func (s *BizBuySellScraper) parseListingCard(e *colly.HTMLElement) *domain.Listi
 		Title:      title,
 		Country:    domain.StrPtr("US"),
 		IsActive:   true,
+		IsFeatured: isFeaturedCard(e.Attr("class")),
 	}
+	texts := make(priceTexts)
 
 	// Parse description
 	desc := strings.TrimSpace(e.ChildText(".listing-description, .description, p.desc"))
@@ -199,21 +248,21 @@ func (s *BizBuySellScraper) parseListingCard(e *colly.HTMLElement) *domain.Listi
 
 	// Parse price - try multiple selectors
 	priceText := e.ChildText(".price, .asking-price, .listing-price, span[data-price]")
-	if price := parsePrice(priceText); price > 0 {
-		listing.AskingPrice = &price
-	}
+	texts.setAskingPrice(listing, priceText)
 
 	// Parse cash flow
 	cashFlowText := e.ChildText(".cash-flow, .cashflow, [data-cashflow]")
-	if cf := parsePrice(cashFlowText); cf > 0 {
-		listing.CashFlow = &cf
-	}
+	texts.setPriceRange(finCashFlow, cashFlowText, &listing.CashFlow, &listing.CashFlowMax)
 
 	// Parse revenue
 	revenueText := e.ChildText(".revenue, .gross-revenue, [data-revenue]")
-	if rev := parsePrice(revenueText); rev > 0 {
-		listing.Revenue = &rev
-	}
+	texts.setPriceRange(finRevenue, revenueText, &listing.Revenue, &listing.RevenueMax)
+
+	// EBITDA, FF&E and figures the selectors missed, and the founding year
+	// and head count, found by their labels
+	cardText := pageText(e.DOM)
+	texts.merge(applyLabeledFinancials(listing, cardText))
+	applyBusinessDetails(listing, cardText)
 
 	// Parse location
 	location := strings.TrimSpace(e.ChildText(".location, .listing-location, .city-state"))
@@ -247,8 +296,10 @@ func (s *BizBuySellScraper) parseListingCard(e *colly.HTMLElement) *domain.Listi
 	// Store raw HTML for debugging
 	rawData := map[string]interface{}{
 		"source_url": url,
+		"title":      rawTitle,
 		"scraped_at": time.Now().Format(time.RFC3339),
 	}
+	texts.addTo(rawData)
 	if jsonBytes, err := json.Marshal(rawData); err == nil {
 		listing.RawData = jsonBytes
 	}
@@ -256,7 +307,7 @@ func (s *BizBuySellScraper) parseListingCard(e *colly.HTMLElement) *domain.Listi
 	return listing
 }
 
-func (s *BizBuySellScraper) parseDataListing(e *colly.HTMLElement) *domain.Listing {
+func (s *BizBuySellScraper) parseDataListing(e *colly.HTMLElement, site siteConfig) *domain.Listing {
 	listingID := e.Attr("data-listing-id")
 	if listingID == "" {
 		return nil
@@ -271,12 +322,14 @@ func (s *BizBuySellScraper) parseDataListing(e *colly.HTMLElement) *domain.Listi
 	if title == "" {
 		return nil
 	}
-
-	fullURL := url
-	if !strings.HasPrefix(url, "http") {
-		fullURL = "https://www.bizbuysell.com" + url
+	// Boilerplate is stripped from the title; the raw one is kept in raw_data
+	rawTitle := title
+	if title = site.cleanTitle(title); title == "" {
+		return nil
 	}
 
+	fullURL := site.absURL(url)
+
 	listing := &domain.Listing{
 		ID:         uuid.New(),
 		ExternalID: listingID,
@@ -284,19 +337,17 @@ func (s *BizBuySellScraper) parseDataListing(e *colly.HTMLElement) *domain.Listi
 		Title:      title,
 		Country:    domain.StrPtr("US"),
 		IsActive:   true,
+		IsFeatured: isFeaturedCard(e.Attr("class")),
 	}
+	texts := make(priceTexts)
 
 	// Parse other fields from data attributes if available
 	if price := e.Attr("data-price"); price != "" {
-		if p := parsePrice(price); p > 0 {
-			listing.AskingPrice = &p
-		}
+		texts.setAskingPrice(listing, price)
 	}
 
 	if cashflow := e.Attr("data-cashflow"); cashflow != "" {
-		if cf := parsePrice(cashflow); cf > 0 {
-			listing.CashFlow = &cf
-		}
+		texts.setPriceRange(finCashFlow, cashflow, &listing.CashFlow, &listing.CashFlowMax)
 	}
 
 	if loc := e.Attr("data-location"); loc != "" {
@@ -313,6 +364,17 @@ func (s *BizBuySellScraper) parseDataListing(e *colly.HTMLElement) *domain.Listi
 		listing.Industry = &industry
 	}
 
+	// Store raw data
+	rawData := map[string]interface{}{
+		"source_url": url,
+		"title":      rawTitle,
+		"scraped_at": time.Now().Format(time.RFC3339),
+	}
+	texts.addTo(rawData)
+	if jsonBytes, err := json.Marshal(rawData); err == nil {
+		listing.RawData = jsonBytes
+	}
+
 	return listing
 }
 
@@ -337,9 +399,27 @@ func extractBizBuySellID(url string) string {
 	return ""
 }
 
+// priceRangeSepRe splits ranges like "$100,000 - $200,000" or "$1M to $2M"
+var priceRangeSepRe = regexp.MustCompile(`\s*(?:-|–|—|\bto\b)\s*`)
+
+// priceOnRequestRe matches figures deliberately withheld, such as "Call for
+// price", "Contact broker", "Price on request" or "Not disclosed"
+var priceOnRequestRe = regexp.MustCompile(`contact|call|(?:on|upon|by)\s+request|disclosed`)
+
+// parsePrice parses a price or financial figure in cents, taking the low end
+// of a range
 func parsePrice(text string) int64 {
+	low, _, _ := parsePriceRange(text)
+	return low
+}
+
+// parsePriceRange parses a price or financial figure in cents. For a range it
+// returns both ends; for a single value or an open-ended "$500K+" high is 0.
+// Text withholding the figure on purpose, e.g. "Call for price", parses to 0
+// with onRequest set, unlike blank or unparseable text.
+func parsePriceRange(text string) (low, high int64, onRequest bool) {
 	if text == "" {
-		return 0
+		return 0, 0, false
 	}
 
 	// Remove currency symbols, commas, whitespace, and common words
@@ -351,39 +431,89 @@ func parsePrice(text string) int64 {
 	text = strings.ReplaceAll(text, "revenue", "")
 	text = strings.TrimSpace(text)
 
-	// Handle ranges like "$100,000 - $200,000" - take the first value
-	if strings.Contains(text, "-") {
-		parts := strings.Split(text, "-")
-		text = strings.TrimSpace(parts[0])
+	if priceOnRequestRe.MatchString(text) {
+		return 0, 0, true
+	}
+	if strings.Contains(text, "n/a") {
+		return 0, 0, false
 	}
 
-	// Handle "not disclosed", "call", etc.
-	if strings.Contains(text, "disclosed") || strings.Contains(text, "call") ||
-		strings.Contains(text, "contact") || strings.Contains(text, "n/a") {
-		return 0
+	parts := priceRangeSepRe.Split(text, 2)
+	lowVal, lowMult := parseAmount(parts[0])
+	if len(parts) == 1 || lowVal == 0 {
+		// Not a range, e.g. "up to 500k"
+		val, mult := parseAmount(text)
+		return toCents(val * mult), 0, false
 	}
 
-	// Extract first number found
-	re := regexp.MustCompile(`[\d.]+`)
-	match := re.FindString(text)
+	highVal, highMult := parseAmount(parts[1])
+	// "$1-2M": the low end shares the high end's unit
+	if lowMult == 1 && highMult > 1 && lowVal <= highVal {
+		lowMult = highMult
+	}
+	low, high = toCents(lowVal*lowMult), toCents(highVal*highMult)
+	if high <= low {
+		high = 0
+	}
+	return low, high, false
+}
+
+var amountRe = regexp.MustCompile(`[\d.]+`)
+
+// parseAmount returns the first number in text and the multiplier of its
+// million or thousand abbreviation, 1 if none
+func parseAmount(text string) (value, multiplier float64) {
+	match := amountRe.FindString(text)
 	if match == "" {
-		return 0
+		return 0, 1
 	}
 
 	val, err := strconv.ParseFloat(match, 64)
 	if err != nil {
-		return 0
+		return 0, 1
 	}
 
 	// Handle millions/thousands abbreviations
 	if strings.Contains(text, "m") || strings.Contains(text, "mil") {
-		val *= 1000000
+		return val, 1000000
 	} else if strings.Contains(text, "k") {
-		val *= 1000
+		return val, 1000
+	}
+	return val, 1
+}
+
+func toCents(dollars float64) int64 {
+	return int64(dollars * 100)
+}
+
+// setPriceRange parses text into a financial field and, for ranges, its
+// matching _max field. Reports whether a value was found.
+func setPriceRange(text string, low, high **int64) bool {
+	l, h, _ := parsePriceRange(text)
+	if l <= 0 {
+		return false
 	}
+	*low = &l
+	if h > 0 {
+		*high = &h
+	}
+	return true
+}
 
-	// Convert to cents
-	return int64(val * 100)
+// featuredClasses are card classes broker sites use for paid placements
+var featuredClasses = []string{"diamond", "featured", "premium", "showcase", "spotlight"}
+
+// isFeaturedCard reports whether a listing card's class attribute marks it as
+// featured, e.g. "diamond-listing" or "listing-card featured"
+func isFeaturedCard(class string) bool {
+	for _, c := range strings.Fields(strings.ToLower(class)) {
+		for _, f := range featuredClasses {
+			if c == f || strings.HasPrefix(c, f+"-") || strings.HasSuffix(c, "-"+f) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func parseLocation(text string) (city, state string) {
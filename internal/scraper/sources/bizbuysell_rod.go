@@ -4,8 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"regexp"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -18,21 +17,66 @@ import (
 
 // BizBuySellRodScraper uses headless Chrome for scraping
 type BizBuySellRodScraper struct {
-	pool *browser.Pool
+	pool    *browser.Pool
+	cookies *browser.CookieStore
+	logger  *slog.Logger
+	site    siteConfig
 }
 
-func NewBizBuySellRodScraper() (*BizBuySellRodScraper, error) {
-	pool, err := browser.NewPool()
+// RodConfig configures the headless Chrome scrapers
+type RodConfig struct {
+	BrowserPath string // Chrome binary; empty lets rod find or download one
+	CookieDir   string // where login session cookies are saved, one file per source
+	// StealthProfiles are the fingerprints pages rotate through; empty uses
+	// browser.DefaultStealthProfile
+	StealthProfiles []browser.StealthProfile
+	// PageRecycleAfter is how many navigations a page serves before it is
+	// replaced; 0 uses browser.DefaultRecycleAfter
+	PageRecycleAfter int
+}
+
+// bizBuySellCardSelectors match BizBuySell's listing cards, tried in order
+var bizBuySellCardSelectors = []string{
+	"div.listing",
+	"div.diamond-listing",
+	"article.listing",
+	"div[class*='listing-card']",
+	"div[class*='ListingCard']",
+}
+
+// bizBuySellWaitSelector matches the first listing card or listing link to
+// render, whichever markup the page uses
+var bizBuySellWaitSelector = strings.Join(bizBuySellCardSelectors, ", ") + ", a[href*='/Business-Opportunity/']"
+
+// settleTimeout bounds the wait for lazy content after scrolling
+const settleTimeout = 5 * time.Second
+
+func NewBizBuySellRodScraper(logger *slog.Logger, cfg RodConfig, opts ...Option) (*BizBuySellRodScraper, error) {
+	pool, err := browser.NewPool(cfg.BrowserPath, cfg.StealthProfiles...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create browser pool: %w", err)
 	}
-	return &BizBuySellRodScraper{pool: pool}, nil
+	if cfg.PageRecycleAfter > 0 {
+		pool.SetRecycleAfter(cfg.PageRecycleAfter)
+	}
+	site := newSite("https://www.bizbuysell.com", "/businesses-for-sale/", opts)
+	site.waitSelector = bizBuySellWaitSelector
+	return &BizBuySellRodScraper{
+		pool:    pool,
+		cookies: browser.NewCookieStore(cfg.CookieDir),
+		logger:  scraperLogger(logger, "bizbuysell"),
+		site:    site,
+	}, nil
 }
 
 func (s *BizBuySellRodScraper) Name() string {
 	return "bizbuysell"
 }
 
+func (s *BizBuySellRodScraper) Version() int {
+	return bizBuySellVersion
+}
+
 func (s *BizBuySellRodScraper) Close() error {
 	if s.pool != nil {
 		return s.pool.Close()
@@ -48,40 +92,84 @@ func (s *BizBuySellRodScraper) Scrape(ctx context.Context, opts domain.ScrapeOpt
 		defer close(listings)
 		defer close(errors)
 
-		page, err := s.pool.GetPage()
+		pooled, err := s.pool.Acquire()
 		if err != nil {
 			errors <- fmt.Errorf("failed to get page: %w", err)
 			return
 		}
-		defer page.Close()
+		defer pooled.Release()
+		page := pooled.Rod()
+
+		// Gated sources log in first and reuse the saved session across runs
+		cfg, err := domain.ParseSourceConfig(opts.SourceConfig)
+		if err != nil {
+			errors <- err
+			return
+		}
+		if cfg.Auth != nil {
+			if err := s.pool.EnsureSession(page, s.Name(), cfg.Auth, s.cookies); err != nil {
+				errors <- err
+				return
+			}
+		}
+		relogged := false
 
 		count := 0
 		pageNum := 1
 		maxPages := 50
-		if opts.MaxListings > 0 {
+		if opts.MaxPages > 0 {
+			maxPages = opts.MaxPages
+		} else if opts.MaxListings > 0 {
 			maxPages = (opts.MaxListings / 20) + 1
 		}
 
-		baseURL := "https://www.bizbuysell.com/businesses-for-sale/"
+		site := s.site.forRun(opts)
 
-		for pageNum <= maxPages {
-			var url string
-			if pageNum == 1 {
-				url = baseURL
-			} else {
-				url = fmt.Sprintf("%s%d/", baseURL, pageNum)
-			}
+		for pageNum <= maxPages && ctx.Err() == nil {
+			url := site.pageURL(pageNum)
 
-			log.Printf("BizBuySell: scraping page %d: %s", pageNum, url)
+			s.logger.Debug("scraping page", "page", pageNum, "url", url)
+
+			if err := opts.Acquire(ctx); err != nil {
+				break
+			}
 
 			// Navigate to page
-			if err := browser.NavigateWithRetry(page, url, 3); err != nil {
+			// The page may be recycled on the way
+			err := pooled.Navigate(url, 3)
+			page = pooled.Rod()
+			if err != nil {
+				opts.Record(url, 0, err)
 				errors <- fmt.Errorf("failed to navigate to page %d: %w", pageNum, err)
 				break
 			}
 
-			// Wait for listings to load
-			time.Sleep(2 * time.Second)
+			// A redirect to the login page means the saved session expired; log in once more
+			if cfg.Auth != nil && browser.IsLoginPage(page, cfg.Auth) {
+				if relogged {
+					errors <- fmt.Errorf("%s: redirected to login again after re-login on page %d", s.Name(), pageNum)
+					break
+				}
+				relogged = true
+				s.logger.Info("session expired, logging in again")
+				s.cookies.Delete(s.Name())
+				if err := s.pool.Login(page, s.Name(), cfg.Auth, s.cookies); err != nil {
+					errors <- err
+					break
+				}
+				continue
+			}
+
+			// Wait for the first listing to render. Past the timeout the page is
+			// parsed as it is: a block page or an empty results page never
+			// renders one, and both are handled below.
+			if err := browser.WaitForSelector(ctx, page, site.waitSelector, site.waitTimeout); err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				s.logger.Debug("listings did not render in time, parsing the page as is",
+					"page", pageNum, "selector", site.waitSelector, "timeout", site.waitTimeout)
+			}
 
 			// Check if we got blocked
 			html, err := page.HTML()
@@ -92,37 +180,42 @@ func (s *BizBuySellRodScraper) Scrape(ctx context.Context, opts domain.ScrapeOpt
 
 			// Debug: log page title and part of HTML
 			title := browser.GetText(page, "title")
-			log.Printf("BizBuySell: page title: %s", title)
-
-			htmlLower := strings.ToLower(html)
-			if strings.Contains(htmlLower, "access denied") ||
-			   strings.Contains(htmlLower, "captcha") ||
-			   strings.Contains(htmlLower, "blocked") ||
-			   strings.Contains(htmlLower, "cloudflare") ||
-			   strings.Contains(htmlLower, "just a moment") {
+			s.logger.Debug("page loaded", "page", pageNum, "title", title)
+
+			if blocked, matched := browser.DetectBlock(html, site.blockSignatures); blocked {
 				// Save debug info
 				previewLen := 500
 				if len(html) < previewLen {
 					previewLen = len(html)
 				}
-				log.Printf("BizBuySell: blocked - HTML preview: %s", html[:previewLen])
-				errors <- fmt.Errorf("access blocked on page %d (title: %s)", pageNum, title)
+				s.logger.Error("blocked", "page", pageNum, "title", title, "signature", matched, "html_preview", html[:previewLen])
+				blockErr := fmt.Errorf("access blocked on page %d (title: %s, matched %q)", pageNum, title, matched)
+				opts.Record(url, 0, blockErr)
+				errors <- &domain.ScrapeError{
+					Source: s.Name(),
+					Kind:   domain.ScrapeErrorBlocked,
+					URL:    url,
+					Err:    blockErr,
+				}
 				break
 			}
+			opts.Record(url, 0, nil)
 
 			// Scroll to load lazy content
 			browser.ScrollToBottom(page)
-			time.Sleep(1 * time.Second)
+			if err := browser.WaitSettled(ctx, page, settleTimeout); err != nil && ctx.Err() != nil {
+				break
+			}
 
 			// Parse listings
-			pageListings, err := s.parseListingsFromPage(page)
+			pageListings, err := s.parseListingsFromPage(page, site)
 			if err != nil {
 				errors <- fmt.Errorf("failed to parse page %d: %w", pageNum, err)
 				break
 			}
 
 			if len(pageListings) == 0 {
-				log.Printf("BizBuySell: no listings found on page %d, stopping", pageNum)
+				s.logger.Info("no listings found, stopping", "page", pageNum)
 				break
 			}
 
@@ -135,7 +228,7 @@ func (s *BizBuySellRodScraper) Scrape(ctx context.Context, opts domain.ScrapeOpt
 				case listings <- listing:
 					count++
 					if count%10 == 0 {
-						log.Printf("BizBuySell: scraped %d listings", count)
+						s.logger.Debug("scraped listings", "count", count)
 					}
 				case <-ctx.Done():
 					return
@@ -145,45 +238,39 @@ func (s *BizBuySellRodScraper) Scrape(ctx context.Context, opts domain.ScrapeOpt
 			pageNum++
 
 			// Random delay between pages
-			browser.RandomDelay(2*time.Second, 5*time.Second)
+			if err := browser.RandomDelayCtx(ctx, 2*time.Second, 5*time.Second); err != nil {
+				return
+			}
 		}
 
-		log.Printf("BizBuySell: scrape completed with %d listings", count)
+		s.logger.Info("scrape completed", "listings", count)
 	}()
 
 	return listings, errors
 }
 
-func (s *BizBuySellRodScraper) parseListingsFromPage(page *rod.Page) ([]*domain.Listing, error) {
+func (s *BizBuySellRodScraper) parseListingsFromPage(page *rod.Page, site siteConfig) ([]*domain.Listing, error) {
 	var listings []*domain.Listing
 
 	// Find all listing cards - try multiple selectors
-	selectors := []string{
-		"div.listing",
-		"div.diamond-listing",
-		"article.listing",
-		"div[class*='listing-card']",
-		"div[class*='ListingCard']",
-	}
-
 	var elements rod.Elements
-	for _, selector := range selectors {
+	for _, selector := range bizBuySellCardSelectors {
 		els, err := page.Elements(selector)
 		if err == nil && len(els) > 0 {
 			elements = els
-			log.Printf("BizBuySell: found %d elements with selector: %s", len(els), selector)
+			s.logger.Debug("found listing elements", "count", len(els), "selector", selector)
 			break
 		}
 	}
 
 	if len(elements) == 0 {
 		// Try to extract from page data/JSON
-		return s.parseFromPageData(page)
+		return s.parseFromPageData(page, site)
 	}
 
 	for _, el := range elements {
-		listing := s.parseListingElement(el)
-		if listing != nil {
+		listing := s.parseListingElement(el, site)
+		if listing != nil && !site.skips(listing.URL) {
 			listings = append(listings, listing)
 		}
 	}
@@ -191,7 +278,7 @@ func (s *BizBuySellRodScraper) parseListingsFromPage(page *rod.Page) ([]*domain.
 	return listings, nil
 }
 
-func (s *BizBuySellRodScraper) parseListingElement(el *rod.Element) *domain.Listing {
+func (s *BizBuySellRodScraper) parseListingElement(el *rod.Element, site siteConfig) *domain.Listing {
 	// Extract URL
 	linkEl, err := el.Element("a")
 	if err != nil {
@@ -203,10 +290,7 @@ func (s *BizBuySellRodScraper) parseListingElement(el *rod.Element) *domain.List
 		return nil
 	}
 
-	url := *href
-	if !strings.HasPrefix(url, "http") {
-		url = "https://www.bizbuysell.com" + url
-	}
+	url := site.absURL(*href)
 
 	externalID := extractBizBuySellID(url)
 	if externalID == "" {
@@ -235,6 +319,11 @@ func (s *BizBuySellRodScraper) parseListingElement(el *rod.Element) *domain.List
 	if title == "" {
 		return nil
 	}
+	// Boilerplate is stripped from the title; the raw one is kept in raw_data
+	rawTitle := title
+	if title = site.cleanTitle(title); title == "" {
+		return nil
+	}
 
 	listing := &domain.Listing{
 		ID:         uuid.New(),
@@ -245,6 +334,13 @@ func (s *BizBuySellRodScraper) parseListingElement(el *rod.Element) *domain.List
 		IsActive:   true,
 	}
 
+	texts := make(priceTexts)
+
+	// Diamond and other paid placements
+	if class, err := el.Attribute("class"); err == nil && class != nil {
+		listing.IsFeatured = isFeaturedCard(*class)
+	}
+
 	// Extract description
 	descSelectors := []string{".description", ".listing-description", "p.desc", "p"}
 	for _, sel := range descSelectors {
@@ -262,8 +358,7 @@ func (s *BizBuySellRodScraper) parseListingElement(el *rod.Element) *domain.List
 	for _, sel := range priceSelectors {
 		if priceEl, err := el.Element(sel); err == nil {
 			if priceText, err := priceEl.Text(); err == nil {
-				if price := parsePrice(priceText); price > 0 {
-					listing.AskingPrice = &price
+				if texts.setAskingPrice(listing, priceText) {
 					break
 				}
 			}
@@ -275,14 +370,20 @@ func (s *BizBuySellRodScraper) parseListingElement(el *rod.Element) *domain.List
 	for _, sel := range cfSelectors {
 		if cfEl, err := el.Element(sel); err == nil {
 			if cfText, err := cfEl.Text(); err == nil {
-				if cf := parsePrice(cfText); cf > 0 {
-					listing.CashFlow = &cf
+				if texts.setPriceRange(finCashFlow, cfText, &listing.CashFlow, &listing.CashFlowMax) {
 					break
 				}
 			}
 		}
 	}
 
+	// Revenue, EBITDA, FF&E and figures the selectors missed, and the founding
+	// year and head count, found by their labels
+	if cardText, err := el.Text(); err == nil {
+		texts.merge(applyLabeledFinancials(listing, cardText))
+		applyBusinessDetails(listing, cardText)
+	}
+
 	// Extract location
 	locSelectors := []string{".location", ".city-state", "[class*='location']"}
 	for _, sel := range locSelectors {
@@ -325,52 +426,51 @@ func (s *BizBuySellRodScraper) parseListingElement(el *rod.Element) *domain.List
 	}
 
 	// Store raw data
+	listing.RawData = rodRawData(url, rawTitle, texts)
+
+	return listing
+}
+
+// rodRawData is the raw data kept with a listing the rod scraper found: where
+// and when, and its title and figures as written
+func rodRawData(url, rawTitle string, texts priceTexts) json.RawMessage {
 	rawData := map[string]interface{}{
 		"source_url": url,
+		"title":      rawTitle,
 		"scraped_at": time.Now().Format(time.RFC3339),
 		"method":     "rod",
 	}
-	if jsonBytes, err := json.Marshal(rawData); err == nil {
-		listing.RawData = jsonBytes
-	}
-
-	return listing
+	texts.addTo(rawData)
+	jsonBytes, _ := json.Marshal(rawData)
+	return jsonBytes
 }
 
-func (s *BizBuySellRodScraper) parseFromPageData(page *rod.Page) ([]*domain.Listing, error) {
+func (s *BizBuySellRodScraper) parseFromPageData(page *rod.Page, site siteConfig) ([]*domain.Listing, error) {
 	// Try to find listing data in script tags or data attributes
 	var listings []*domain.Listing
 
-	// Look for JSON data in script tags
-	scripts, err := page.Elements("script[type='application/ld+json']")
+	// Look for structured data in JSON-LD scripts
+	scripts, err := page.Elements(jsonLDSelector)
 	if err == nil {
+		var contents []string
 		for _, script := range scripts {
-			content, err := script.Text()
-			if err != nil {
-				continue
-			}
-
-			// Try to parse as listing data
-			var data map[string]interface{}
-			if err := json.Unmarshal([]byte(content), &data); err == nil {
-				// Check if it's an ItemList with listings
-				if items, ok := data["itemListElement"].([]interface{}); ok {
-					for _, item := range items {
-						if listing := s.parseJSONListing(item); listing != nil {
-							listings = append(listings, listing)
-						}
-					}
-				}
+			if content, err := script.Text(); err == nil {
+				contents = append(contents, content)
 			}
 		}
+		listings = parseJSONLD(contents, site, extractBizBuySellID)
 	}
 
 	// Also try to extract from visible links/cards
 	links, _ := page.Elements("a[href*='/Business-Opportunity/']")
 	if len(links) > 0 {
-		log.Printf("BizBuySell: found %d listing links", len(links))
+		s.logger.Debug("found listing links", "count", len(links))
 
+		// Listings the structured data already gave aren't repeated
 		seenIDs := make(map[string]bool)
+		for _, l := range listings {
+			seenIDs[l.ExternalID] = true
+		}
 		for _, link := range links {
 			href, err := link.Attribute("href")
 			if err != nil || href == nil {
@@ -383,15 +483,15 @@ func (s *BizBuySellRodScraper) parseFromPageData(page *rod.Page) ([]*domain.List
 			}
 			seenIDs[externalID] = true
 
-			title, _ := link.Text()
-			title = strings.TrimSpace(title)
+			rawTitle, _ := link.Text()
+			title := site.cleanTitle(rawTitle)
 			if title == "" || len(title) < 5 {
 				continue
 			}
 
-			url := *href
-			if !strings.HasPrefix(url, "http") {
-				url = "https://www.bizbuysell.com" + url
+			url := site.absURL(*href)
+			if site.skips(url) {
+				continue
 			}
 
 			listing := &domain.Listing{
@@ -401,6 +501,7 @@ func (s *BizBuySellRodScraper) parseFromPageData(page *rod.Page) ([]*domain.List
 				Title:      title,
 				Country:    domain.StrPtr("US"),
 				IsActive:   true,
+				RawData:    rodRawData(url, rawTitle, nil),
 			}
 			listings = append(listings, listing)
 		}
@@ -408,42 +509,3 @@ func (s *BizBuySellRodScraper) parseFromPageData(page *rod.Page) ([]*domain.List
 
 	return listings, nil
 }
-
-func (s *BizBuySellRodScraper) parseJSONListing(item interface{}) *domain.Listing {
-	data, ok := item.(map[string]interface{})
-	if !ok {
-		return nil
-	}
-
-	url, _ := data["url"].(string)
-	if url == "" {
-		return nil
-	}
-
-	name, _ := data["name"].(string)
-	if name == "" {
-		return nil
-	}
-
-	externalID := extractBizBuySellID(url)
-	if externalID == "" {
-		// Generate from URL
-		re := regexp.MustCompile(`[^a-zA-Z0-9]+`)
-		externalID = re.ReplaceAllString(url, "-")
-	}
-
-	listing := &domain.Listing{
-		ID:         uuid.New(),
-		ExternalID: externalID,
-		URL:        url,
-		Title:      name,
-		Country:    domain.StrPtr("US"),
-		IsActive:   true,
-	}
-
-	if desc, ok := data["description"].(string); ok && desc != "" {
-		listing.Description = &desc
-	}
-
-	return listing
-}
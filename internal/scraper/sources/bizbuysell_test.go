@@ -0,0 +1,110 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestParsePriceRange(t *testing.T) {
+	tests := []struct {
+		text      string
+		low, high int64
+		onRequest bool
+	}{
+		{"$250,000", 25000000, 0, false},
+		{"Asking Price: $1.2M", 120000000, 0, false},
+		{"$450K", 45000000, 0, false},
+		{"$100,000 - $200,000", 10000000, 20000000, false},
+		{"$100K to $200K", 10000000, 20000000, false},
+		{"$1 – 2M", 100000000, 200000000, false},
+		{"$500,000 - $1M", 50000000, 100000000, false},
+		{"$500k+", 50000000, 0, false},
+		{"Up to $500K", 50000000, 0, false},
+		{"$200,000 - $100,000", 20000000, 0, false},
+		{"$300,000 - $300,000", 30000000, 0, false},
+		// Withheld on purpose
+		{"Not Disclosed", 0, 0, true},
+		{"Undisclosed", 0, 0, true},
+		{"Call for Price", 0, 0, true},
+		{"Contact Broker", 0, 0, true},
+		{"Price on Request", 0, 0, true},
+		{"Available upon request", 0, 0, true},
+		// Simply missing
+		{"", 0, 0, false},
+		{"N/A", 0, 0, false},
+		{"TBD", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		low, high, onRequest := parsePriceRange(tt.text)
+		if low != tt.low || high != tt.high || onRequest != tt.onRequest {
+			t.Errorf("parsePriceRange(%q) = %d, %d, %v; want %d, %d, %v", tt.text, low, high, onRequest, tt.low, tt.high, tt.onRequest)
+		}
+		if got := parsePrice(tt.text); got != tt.low {
+			t.Errorf("parsePrice(%q) = %d, want %d", tt.text, got, tt.low)
+		}
+	}
+}
+
+func TestSetPriceRange(t *testing.T) {
+	var price, priceMax *int64
+	if !setPriceRange("$1M - $2M", &price, &priceMax) {
+		t.Fatal("setPriceRange found no value")
+	}
+	if price == nil || *price != 100000000 || priceMax == nil || *priceMax != 200000000 {
+		t.Errorf("got %v, %v; want $1M, $2M", price, priceMax)
+	}
+
+	price, priceMax = nil, nil
+	if !setPriceRange("$750K", &price, &priceMax) || priceMax != nil {
+		t.Errorf("single value set max %v", priceMax)
+	}
+	if setPriceRange("Call for price", &price, &priceMax) {
+		t.Error("setPriceRange found a value in undisclosed text")
+	}
+}
+
+func TestSetAskingPrice(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		price     *int64
+		onRequest bool
+	}{
+		{"numeric", "Asking Price: $450,000", domain.Ptr(int64(45000000)), false},
+		{"on request", "Call for Price", nil, true},
+		{"absent", "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listing := &domain.Listing{}
+			texts := make(priceTexts)
+			found := texts.setAskingPrice(listing, tt.text)
+			if found != (tt.price != nil) {
+				t.Errorf("setAskingPrice = %v", found)
+			}
+			if (listing.AskingPrice == nil) != (tt.price == nil) || (tt.price != nil && *listing.AskingPrice != *tt.price) {
+				t.Errorf("asking price = %v, want %v", listing.AskingPrice, tt.price)
+			}
+			if listing.PriceOnRequest != tt.onRequest {
+				t.Errorf("price on request = %v, want %v", listing.PriceOnRequest, tt.onRequest)
+			}
+		})
+	}
+
+	// A price found after all, by a later selector or label, clears the flag
+	listing := &domain.Listing{}
+	texts := make(priceTexts)
+	texts.setAskingPrice(listing, "Contact Broker")
+	texts.setAskingPrice(listing, "$300K")
+	if listing.PriceOnRequest || listing.AskingPrice == nil {
+		t.Errorf("after a price: on request = %v, asking price = %v", listing.PriceOnRequest, listing.AskingPrice)
+	}
+	listing = &domain.Listing{}
+	texts.setAskingPrice(listing, "Not Disclosed")
+	applyLabeledFinancials(listing, "Asking Price:\n$275,000")
+	if listing.PriceOnRequest || listing.AskingPrice == nil {
+		t.Errorf("after a labelled price: on request = %v, asking price = %v", listing.PriceOnRequest, listing.AskingPrice)
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"regexp"
 	"strings"
 	"time"
@@ -15,16 +15,36 @@ import (
 	"github.com/kbsch/trough/internal/domain"
 )
 
-type BizQuestScraper struct{}
+// Listing card selectors, reported to ScrapeOptions.MatchCard
+const (
+	bizQuestCardSelector = "div.listing-item, article.listing, div.search-result-item"
+)
 
-func NewBizQuestScraper() *BizQuestScraper {
-	return &BizQuestScraper{}
+type BizQuestScraper struct {
+	logger *slog.Logger
+	site   siteConfig
+}
+
+func NewBizQuestScraper(logger *slog.Logger, opts ...Option) *BizQuestScraper {
+	return &BizQuestScraper{
+		logger: scraperLogger(logger, "bizquest"),
+		site:   newSite("https://www.bizquest.com", "/businesses-for-sale/", opts),
+	}
 }
 
 func (s *BizQuestScraper) Name() string {
 	return "bizquest"
 }
 
+func (s *BizQuestScraper) Version() int {
+	return bizQuestVersion
+}
+
+// CardSelectors returns the selector groups that find listing cards
+func (s *BizQuestScraper) CardSelectors() []string {
+	return []string{bizQuestCardSelector}
+}
+
 func (s *BizQuestScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
 	listings := make(chan *domain.Listing, 100)
 	errors := make(chan error, 10)
@@ -33,14 +53,15 @@ func (s *BizQuestScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions)
 		defer close(listings)
 		defer close(errors)
 
+		site := s.site.forRun(opts)
+
 		c := colly.NewCollector(
-			colly.AllowedDomains("www.bizquest.com", "bizquest.com"),
-			colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"),
+			colly.AllowedDomains(site.allowedDomains()...),
 			colly.MaxDepth(2),
 		)
 
 		c.Limit(&colly.LimitRule{
-			DomainGlob:  "*bizquest.com*",
+			DomainGlob:  site.domainGlob(),
 			Delay:       opts.RateLimit,
 			RandomDelay: 1 * time.Second,
 			Parallelism: 1,
@@ -48,24 +69,22 @@ func (s *BizQuestScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions)
 
 		count := 0
 		pageCount := 0
-		maxPages := 50
-		if opts.MaxListings > 0 {
-			maxPages = (opts.MaxListings / 20) + 1
-		}
+		maxPages := maxFollowedPages(opts)
 
 		// BizQuest listing cards
-		c.OnHTML("div.listing-item, article.listing, div.search-result-item", func(e *colly.HTMLElement) {
+		c.OnHTML(bizQuestCardSelector, func(e *colly.HTMLElement) {
+			opts.MatchedCard(bizQuestCardSelector)
 			if opts.MaxListings > 0 && count >= opts.MaxListings {
 				return
 			}
 
-			listing := s.parseListingCard(e)
-			if listing != nil {
+			listing := s.parseListingCard(e, site)
+			if listing != nil && !site.skips(listing.URL) {
 				select {
 				case listings <- listing:
 					count++
 					if count%10 == 0 {
-						log.Printf("BizQuest: scraped %d listings", count)
+						s.logger.Debug("scraped listings", "count", count)
 					}
 				case <-ctx.Done():
 					return
@@ -73,6 +92,21 @@ func (s *BizQuestScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions)
 			}
 		})
 
+		// Structured data, for pages the card selectors miss
+		c.OnHTML("html", func(e *colly.HTMLElement) {
+			for _, listing := range parseJSONLD(pageJSONLD(e, s.CardSelectors()), site, extractBizQuestID) {
+				if opts.MaxListings > 0 && count >= opts.MaxListings {
+					return
+				}
+				select {
+				case listings <- listing:
+					count++
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+
 		// Pagination
 		c.OnHTML("a.next, a[rel='next'], .pagination a:last-child", func(e *colly.HTMLElement) {
 			if opts.MaxListings > 0 && count >= opts.MaxListings {
@@ -84,42 +118,52 @@ func (s *BizQuestScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions)
 
 			nextURL := e.Attr("href")
 			if nextURL != "" && !strings.HasPrefix(nextURL, "javascript:") && !strings.Contains(e.Text, "Previous") {
-				pageCount++
-				if !strings.HasPrefix(nextURL, "http") {
-					nextURL = "https://www.bizquest.com" + nextURL
+				nextURL = site.absURL(nextURL)
+				if site.skips(nextURL) {
+					return
 				}
-				log.Printf("BizQuest: following page %d", pageCount)
+				pageCount++
+				s.logger.Debug("following page", "page", pageCount)
 				e.Request.Visit(nextURL)
 			}
 		})
 
+		c.OnResponse(func(r *colly.Response) {
+			err := blockedPageError(s.Name(), r, site)
+			opts.Record(r.Request.URL.String(), r.StatusCode, err)
+			if err != nil {
+				select {
+				case errors <- err:
+				default:
+				}
+			}
+		})
+
 		c.OnError(func(r *colly.Response, err error) {
+			opts.Record(r.Request.URL.String(), r.StatusCode, err)
 			select {
-			case errors <- fmt.Errorf("BizQuest request error %d: %s - %v", r.StatusCode, r.Request.URL, err):
+			case errors <- requestError(s.Name(), r, err):
 			default:
 			}
 		})
 
-		c.OnRequest(func(r *colly.Request) {
-			r.Headers.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-			r.Headers.Set("Accept-Language", "en-US,en;q=0.5")
-		})
+		c.OnRequest(site.onRequest(ctx, opts))
 
-		startURL := "https://www.bizquest.com/businesses-for-sale/"
-		log.Printf("BizQuest: starting scrape from %s", startURL)
+		startURL := site.startURL()
+		s.logger.Info("starting scrape", "url", startURL)
 
 		if err := c.Visit(startURL); err != nil {
 			errors <- fmt.Errorf("BizQuest failed to start: %w", err)
 		}
 
 		c.Wait()
-		log.Printf("BizQuest: scrape completed with %d listings", count)
+		s.logger.Info("scrape completed", "listings", count)
 	}()
 
 	return listings, errors
 }
 
-func (s *BizQuestScraper) parseListingCard(e *colly.HTMLElement) *domain.Listing {
+func (s *BizQuestScraper) parseListingCard(e *colly.HTMLElement, site siteConfig) *domain.Listing {
 	// Try to find the listing URL
 	url := e.ChildAttr("a.listing-title", "href")
 	if url == "" {
@@ -141,12 +185,14 @@ func (s *BizQuestScraper) parseListingCard(e *colly.HTMLElement) *domain.Listing
 	if title == "" {
 		return nil
 	}
-
-	fullURL := url
-	if !strings.HasPrefix(url, "http") {
-		fullURL = "https://www.bizquest.com" + url
+	// Boilerplate is stripped from the title; the raw one is kept in raw_data
+	rawTitle := title
+	if title = site.cleanTitle(title); title == "" {
+		return nil
 	}
 
+	fullURL := site.absURL(url)
+
 	listing := &domain.Listing{
 		ID:         uuid.New(),
 		ExternalID: externalID,
@@ -154,7 +200,9 @@ func (s *BizQuestScraper) parseListingCard(e *colly.HTMLElement) *domain.Listing
 		Title:      title,
 		Country:    domain.StrPtr("US"),
 		IsActive:   true,
+		IsFeatured: isFeaturedCard(e.Attr("class")),
 	}
+	texts := make(priceTexts)
 
 	// Description
 	if desc := strings.TrimSpace(e.ChildText(".listing-description, .description, p")); desc != "" {
@@ -163,21 +211,21 @@ func (s *BizQuestScraper) parseListingCard(e *colly.HTMLElement) *domain.Listing
 
 	// Price
 	priceText := e.ChildText(".price, .asking-price, .listing-price")
-	if price := parsePrice(priceText); price > 0 {
-		listing.AskingPrice = &price
-	}
+	texts.setAskingPrice(listing, priceText)
 
 	// Cash flow
 	cfText := e.ChildText(".cash-flow, .cashflow")
-	if cf := parsePrice(cfText); cf > 0 {
-		listing.CashFlow = &cf
-	}
+	texts.setPriceRange(finCashFlow, cfText, &listing.CashFlow, &listing.CashFlowMax)
 
 	// Revenue
 	revText := e.ChildText(".revenue, .gross-revenue")
-	if rev := parsePrice(revText); rev > 0 {
-		listing.Revenue = &rev
-	}
+	texts.setPriceRange(finRevenue, revText, &listing.Revenue, &listing.RevenueMax)
+
+	// EBITDA, FF&E and figures the selectors missed, and the founding year
+	// and head count, found by their labels
+	cardText := pageText(e.DOM)
+	texts.merge(applyLabeledFinancials(listing, cardText))
+	applyBusinessDetails(listing, cardText)
 
 	// Location
 	location := strings.TrimSpace(e.ChildText(".location, .city-state"))
@@ -208,8 +256,10 @@ func (s *BizQuestScraper) parseListingCard(e *colly.HTMLElement) *domain.Listing
 
 	rawData := map[string]interface{}{
 		"source_url": url,
+		"title":      rawTitle,
 		"scraped_at": time.Now().Format(time.RFC3339),
 	}
+	texts.addTo(rawData)
 	if jsonBytes, err := json.Marshal(rawData); err == nil {
 		listing.RawData = jsonBytes
 	}
@@ -0,0 +1,61 @@
+package sources
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/scraper/browser"
+)
+
+// requestError classifies a failed colly response as a ScrapeError, marking
+// refusals and bot challenges as blocked so the engine can fall back
+func requestError(source string, r *colly.Response, err error) error {
+	kind := domain.ScrapeErrorRequest
+	if isBlockedResponse(r.StatusCode, r.Headers, r.Body) {
+		kind = domain.ScrapeErrorBlocked
+	}
+	return &domain.ScrapeError{
+		Source: source,
+		Kind:   kind,
+		URL:    r.Request.URL.String(),
+		Status: r.StatusCode,
+		Err:    err,
+	}
+}
+
+// isBlockedResponse reports whether a response looks like the source refusing us
+func isBlockedResponse(status int, headers *http.Header, body []byte) bool {
+	switch status {
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		if headers != nil {
+			if headers.Get("cf-mitigated") != "" || strings.EqualFold(headers.Get("Server"), "cloudflare") {
+				return true
+			}
+		}
+		blocked, _ := browser.DetectBlock(string(body), nil)
+		return blocked
+	}
+	return false
+}
+
+// blockedPageError returns a blocked ScrapeError, naming the signature that
+// matched, if a page that loaded fine is actually a block or challenge page
+func blockedPageError(source string, r *colly.Response, site siteConfig) error {
+	blocked, matched := browser.DetectBlock(string(r.Body), site.blockSignatures)
+	if !blocked {
+		return nil
+	}
+	return &domain.ScrapeError{
+		Source: source,
+		Kind:   domain.ScrapeErrorBlocked,
+		URL:    r.Request.URL.String(),
+		Status: r.StatusCode,
+		Err:    fmt.Errorf("block page (matched %q)", matched),
+	}
+}
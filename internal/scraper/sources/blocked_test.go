@@ -0,0 +1,86 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestIsBlockedResponse(t *testing.T) {
+	cloudflare := http.Header{}
+	cloudflare.Set("Server", "cloudflare")
+
+	tests := []struct {
+		name    string
+		status  int
+		headers *http.Header
+		body    string
+		want    bool
+	}{
+		{"forbidden", 403, nil, "", true},
+		{"too many requests", 429, nil, "", true},
+		{"cloudflare 503", 503, &cloudflare, "", true},
+		{"challenge page 503", 503, &http.Header{}, "<title>Just a moment...</title>", true},
+		{"plain 503", 503, &http.Header{}, "maintenance", false},
+		{"not found", 404, nil, "", false},
+		{"server error", 500, nil, "captcha", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBlockedResponse(tt.status, tt.headers, []byte(tt.body)); got != tt.want {
+				t.Errorf("isBlockedResponse(%d) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockPageOnSuccessfulResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    string
+		config  string
+		matched string
+	}{
+		{"default signature", `<html><head><title>Just a moment...</title></head><body><div id="cf-chl-widget"></div></body></html>`,
+			"", `cf-chl|challenge-platform|cf-browser-verification`},
+		{"configured signature", `<html><body><div id="px-captcha-wrapper">Press &amp; Hold</div></body></html>`,
+			`{"block_signatures":["px-captcha"]}`, `px-captcha`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Write([]byte(tt.page))
+			}))
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			listingsCh, errCh := NewBizQuestScraper(nil, WithBaseURL(srv.URL)).Scrape(ctx, domain.ScrapeOptions{
+				SourceConfig: []byte(tt.config),
+			})
+			for range listingsCh {
+			}
+
+			var errs []error
+			for err := range errCh {
+				errs = append(errs, err)
+			}
+			if len(errs) != 1 || !domain.IsBlocked(errs[0]) {
+				t.Fatalf("errors = %v, want one blocked ScrapeError", errs)
+			}
+			if !strings.Contains(errs[0].Error(), fmt.Sprintf("%q", tt.matched)) {
+				t.Errorf("error %q doesn't name signature %q", errs[0], tt.matched)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package sources
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// minYearEstablished is the earliest founding year taken as plausible
+const minYearEstablished = 1800
+
+// maxEmployees is the largest head count taken as plausible for a business
+// listed for sale; larger numbers are usually something else
+const maxEmployees = 100000
+
+var (
+	// yearEstablishedRe matches a founding year after its label: "Established
+	// 1998", "Year Established: 1998", "Founded in 1998", "In Business
+	// Since\n2005". The bare "Est." and "Since" count only starting a line or
+	// before a colon, so prose like "est. 2015 revenue" isn't taken.
+	yearEstablishedRe = regexp.MustCompile(`(?im)(?:\b(?:year\s+established|established|founded(?:\s+in)?|in\s+business\s+since)\s*:?|^[ \t]*(?:est\.|since)\s*:?|\b(?:est\.|since)\s*:)\s*\n?\s*(\d{4})\b`)
+
+	// employeeCount is a head count or range: "12", "1,200", "10-15", "10 to 15"
+	employeeCount = `(\d[\d,]*)(?:\s*(?:-|–|to)\s*(\d[\d,]*))?`
+	// employeesLabeledRe matches a count after its label: "Employees: 12",
+	// "Number of Employees\n10-15", "FTEs: 8"
+	employeesLabeledRe = regexp.MustCompile(`(?i)\b(?:number\s+of\s+employees|employees|ftes?|staff)\s*:?\s*\n?\s*` + employeeCount + `\b`)
+	// employeesTrailingRe matches a count before its noun: "12 employees",
+	// "10-15 FTE", "8 full-time staff", "20+ employees"
+	employeesTrailingRe = regexp.MustCompile(`(?i)\b` + employeeCount + `\+?\s*(?:(?:full|part)[\s-]time\s+)?(?:employees|ftes?|staff|workers)\b`)
+)
+
+// parseYearEstablished returns the first labelled founding year in text
+// between minYearEstablished and this year, or nil
+func parseYearEstablished(text string) *int {
+	thisYear := time.Now().Year()
+	for _, m := range yearEstablishedRe.FindAllStringSubmatch(text, -1) {
+		year, err := strconv.Atoi(m[1])
+		if err == nil && year >= minYearEstablished && year <= thisYear {
+			return &year
+		}
+	}
+	return nil
+}
+
+// parseEmployees returns the first head count in text, labelled or followed
+// by "employees", "FTE" or the like; for a range, its midpoint rounded down.
+// Counts that are zero, above maxEmployees, or ranges running backwards are
+// skipped.
+func parseEmployees(text string) *int {
+	for _, re := range []*regexp.Regexp{employeesLabeledRe, employeesTrailingRe} {
+		for _, m := range re.FindAllStringSubmatch(text, -1) {
+			if n, ok := employeeRange(m[1], m[2]); ok {
+				return &n
+			}
+		}
+	}
+	return nil
+}
+
+// employeeRange parses a count, or the midpoint of low and high if high is set
+func employeeRange(low, high string) (int, bool) {
+	lo, err := strconv.Atoi(strings.ReplaceAll(low, ",", ""))
+	if err != nil || lo <= 0 || lo > maxEmployees {
+		return 0, false
+	}
+	if high == "" {
+		return lo, true
+	}
+	hi, err := strconv.Atoi(strings.ReplaceAll(high, ",", ""))
+	if err != nil || hi < lo || hi > maxEmployees {
+		return 0, false
+	}
+	return (lo + hi) / 2, true
+}
+
+// applyBusinessDetails fills the listing's founding year and head count from
+// text if they are still empty
+func applyBusinessDetails(listing *domain.Listing, text string) {
+	if listing.YearEstablished == nil {
+		listing.YearEstablished = parseYearEstablished(text)
+	}
+	if listing.Employees == nil {
+		listing.Employees = parseEmployees(text)
+	}
+}
@@ -0,0 +1,95 @@
+package sources
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestParseYearEstablished(t *testing.T) {
+	nextYear := fmt.Sprint(time.Now().Year() + 1)
+	tests := []struct {
+		text string
+		want *int
+	}{
+		{"Established 1998", domain.Ptr(1998)},
+		{"Year Established: 2004", domain.Ptr(2004)},
+		{"Year Established\n2011\nEmployees\n6", domain.Ptr(2011)},
+		{"Family owned\nSince 2005", domain.Ptr(2005)},
+		{"Family owned, since: 2005", domain.Ptr(2005)},
+		{"In Business Since: 1987", domain.Ptr(1987)},
+		{"Est. 1972 - third generation bakery", domain.Ptr(1972)},
+		{"Founded in 2015", domain.Ptr(2015)},
+		{"ESTABLISHED 1999", domain.Ptr(1999)},
+		// Implausible years are skipped for the next one
+		{"Established " + nextYear, nil},
+		{"Established 1492; in business since 1990", domain.Ptr(1990)},
+		// Years without a label aren't founding years
+		{"Updated 2023, revenue up 2022", nil},
+		{"Established brand with 12 locations", nil},
+		// Bare "since" and "est." in prose aren't labels
+		{"Kitchen remodeled since 1998 renovations", nil},
+		{"Strong growth, est. 2015 revenue of $1.2M", nil},
+		{"Established: 98", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := parseYearEstablished(tt.text); !equalIntPtr(got, tt.want) {
+			t.Errorf("parseYearEstablished(%q) = %v, want %v", tt.text, fmtIntPtr(got), fmtIntPtr(tt.want))
+		}
+	}
+}
+
+func TestParseEmployees(t *testing.T) {
+	tests := []struct {
+		text string
+		want *int
+	}{
+		{"12 employees", domain.Ptr(12)},
+		{"Employees: 8", domain.Ptr(8)},
+		{"Number of Employees\n1,200", domain.Ptr(1200)},
+		{"10-15 FTE", domain.Ptr(12)},
+		{"10 to 20 employees", domain.Ptr(15)},
+		{"FTEs: 4 – 6", domain.Ptr(5)},
+		{"Run by 3 full-time staff", domain.Ptr(3)},
+		{"20+ employees", domain.Ptr(20)},
+		{"Employees: 6 (2 part-time)", domain.Ptr(6)},
+		// Implausible counts are skipped
+		{"0 employees", nil},
+		{"Employees: 15-10", nil},
+		{"Employees: 250000", nil},
+		{"Employees: -3", nil},
+		{"Employees: Owner operated", nil},
+		{"Established 1998 with loyal customers", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := parseEmployees(tt.text); !equalIntPtr(got, tt.want) {
+			t.Errorf("parseEmployees(%q) = %v, want %v", tt.text, fmtIntPtr(got), fmtIntPtr(tt.want))
+		}
+	}
+}
+
+func TestApplyBusinessDetailsKeepsSetFields(t *testing.T) {
+	listing := &domain.Listing{YearEstablished: domain.Ptr(2001)}
+	applyBusinessDetails(listing, "Established 1998\n9 employees")
+	if *listing.YearEstablished != 2001 {
+		t.Errorf("YearEstablished = %d, want the 2001 already set", *listing.YearEstablished)
+	}
+	if listing.Employees == nil || *listing.Employees != 9 {
+		t.Errorf("Employees = %v, want 9", fmtIntPtr(listing.Employees))
+	}
+}
+
+func equalIntPtr(a, b *int) bool {
+	return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
+
+func fmtIntPtr(p *int) string {
+	if p == nil {
+		return "nil"
+	}
+	return fmt.Sprint(*p)
+}
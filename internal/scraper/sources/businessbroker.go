@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"regexp"
 	"strings"
 	"time"
@@ -15,16 +15,36 @@ import (
 	"github.com/kbsch/trough/internal/domain"
 )
 
-type BusinessBrokerScraper struct{}
+// Listing card selectors, reported to ScrapeOptions.MatchCard
+const (
+	businessBrokerCardSelector = "div.listing, article.listing-card, .search-result"
+)
 
-func NewBusinessBrokerScraper() *BusinessBrokerScraper {
-	return &BusinessBrokerScraper{}
+type BusinessBrokerScraper struct {
+	logger *slog.Logger
+	site   siteConfig
+}
+
+func NewBusinessBrokerScraper(logger *slog.Logger, opts ...Option) *BusinessBrokerScraper {
+	return &BusinessBrokerScraper{
+		logger: scraperLogger(logger, "businessbroker"),
+		site:   newSite("https://www.businessbroker.net", "/businesses-for-sale", opts),
+	}
 }
 
 func (s *BusinessBrokerScraper) Name() string {
 	return "businessbroker"
 }
 
+func (s *BusinessBrokerScraper) Version() int {
+	return businessBrokerVersion
+}
+
+// CardSelectors returns the selector groups that find listing cards
+func (s *BusinessBrokerScraper) CardSelectors() []string {
+	return []string{businessBrokerCardSelector}
+}
+
 func (s *BusinessBrokerScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
 	listings := make(chan *domain.Listing, 100)
 	errors := make(chan error, 10)
@@ -33,14 +53,15 @@ func (s *BusinessBrokerScraper) Scrape(ctx context.Context, opts domain.ScrapeOp
 		defer close(listings)
 		defer close(errors)
 
+		site := s.site.forRun(opts)
+
 		c := colly.NewCollector(
-			colly.AllowedDomains("www.businessbroker.net", "businessbroker.net"),
-			colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"),
+			colly.AllowedDomains(site.allowedDomains()...),
 			colly.MaxDepth(2),
 		)
 
 		c.Limit(&colly.LimitRule{
-			DomainGlob:  "*businessbroker.net*",
+			DomainGlob:  site.domainGlob(),
 			Delay:       opts.RateLimit,
 			RandomDelay: 1 * time.Second,
 			Parallelism: 1,
@@ -48,24 +69,22 @@ func (s *BusinessBrokerScraper) Scrape(ctx context.Context, opts domain.ScrapeOp
 
 		count := 0
 		pageCount := 0
-		maxPages := 50
-		if opts.MaxListings > 0 {
-			maxPages = (opts.MaxListings / 20) + 1
-		}
+		maxPages := maxFollowedPages(opts)
 
 		// BusinessBroker.net listing cards
-		c.OnHTML("div.listing, article.listing-card, .search-result", func(e *colly.HTMLElement) {
+		c.OnHTML(businessBrokerCardSelector, func(e *colly.HTMLElement) {
+			opts.MatchedCard(businessBrokerCardSelector)
 			if opts.MaxListings > 0 && count >= opts.MaxListings {
 				return
 			}
 
-			listing := s.parseListingCard(e)
-			if listing != nil {
+			listing := s.parseListingCard(e, site)
+			if listing != nil && !site.skips(listing.URL) {
 				select {
 				case listings <- listing:
 					count++
 					if count%10 == 0 {
-						log.Printf("BusinessBroker.net: scraped %d listings", count)
+						s.logger.Debug("scraped listings", "count", count)
 					}
 				case <-ctx.Done():
 					return
@@ -73,6 +92,21 @@ func (s *BusinessBrokerScraper) Scrape(ctx context.Context, opts domain.ScrapeOp
 			}
 		})
 
+		// Structured data, for pages the card selectors miss
+		c.OnHTML("html", func(e *colly.HTMLElement) {
+			for _, listing := range parseJSONLD(pageJSONLD(e, s.CardSelectors()), site, extractBusinessBrokerID) {
+				if opts.MaxListings > 0 && count >= opts.MaxListings {
+					return
+				}
+				select {
+				case listings <- listing:
+					count++
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+
 		// Pagination
 		c.OnHTML("a.next, a[rel='next'], .pagination-next a", func(e *colly.HTMLElement) {
 			if opts.MaxListings > 0 && count >= opts.MaxListings {
@@ -84,42 +118,52 @@ func (s *BusinessBrokerScraper) Scrape(ctx context.Context, opts domain.ScrapeOp
 
 			nextURL := e.Attr("href")
 			if nextURL != "" && !strings.HasPrefix(nextURL, "javascript:") {
-				pageCount++
-				if !strings.HasPrefix(nextURL, "http") {
-					nextURL = "https://www.businessbroker.net" + nextURL
+				nextURL = site.absURL(nextURL)
+				if site.skips(nextURL) {
+					return
 				}
-				log.Printf("BusinessBroker.net: following page %d", pageCount)
+				pageCount++
+				s.logger.Debug("following page", "page", pageCount)
 				e.Request.Visit(nextURL)
 			}
 		})
 
+		c.OnResponse(func(r *colly.Response) {
+			err := blockedPageError(s.Name(), r, site)
+			opts.Record(r.Request.URL.String(), r.StatusCode, err)
+			if err != nil {
+				select {
+				case errors <- err:
+				default:
+				}
+			}
+		})
+
 		c.OnError(func(r *colly.Response, err error) {
+			opts.Record(r.Request.URL.String(), r.StatusCode, err)
 			select {
-			case errors <- fmt.Errorf("BusinessBroker.net request error %d: %s - %v", r.StatusCode, r.Request.URL, err):
+			case errors <- requestError(s.Name(), r, err):
 			default:
 			}
 		})
 
-		c.OnRequest(func(r *colly.Request) {
-			r.Headers.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-			r.Headers.Set("Accept-Language", "en-US,en;q=0.5")
-		})
+		c.OnRequest(site.onRequest(ctx, opts))
 
-		startURL := "https://www.businessbroker.net/businesses-for-sale"
-		log.Printf("BusinessBroker.net: starting scrape from %s", startURL)
+		startURL := site.startURL()
+		s.logger.Info("starting scrape", "url", startURL)
 
 		if err := c.Visit(startURL); err != nil {
 			errors <- fmt.Errorf("BusinessBroker.net failed to start: %w", err)
 		}
 
 		c.Wait()
-		log.Printf("BusinessBroker.net: scrape completed with %d listings", count)
+		s.logger.Info("scrape completed", "listings", count)
 	}()
 
 	return listings, errors
 }
 
-func (s *BusinessBrokerScraper) parseListingCard(e *colly.HTMLElement) *domain.Listing {
+func (s *BusinessBrokerScraper) parseListingCard(e *colly.HTMLElement, site siteConfig) *domain.Listing {
 	url := e.ChildAttr("a.title", "href")
 	if url == "" {
 		url = e.ChildAttr("h3 a", "href")
@@ -140,12 +184,14 @@ func (s *BusinessBrokerScraper) parseListingCard(e *colly.HTMLElement) *domain.L
 	if title == "" {
 		return nil
 	}
-
-	fullURL := url
-	if !strings.HasPrefix(url, "http") {
-		fullURL = "https://www.businessbroker.net" + url
+	// Boilerplate is stripped from the title; the raw one is kept in raw_data
+	rawTitle := title
+	if title = site.cleanTitle(title); title == "" {
+		return nil
 	}
 
+	fullURL := site.absURL(url)
+
 	listing := &domain.Listing{
 		ID:         uuid.New(),
 		ExternalID: externalID,
@@ -153,7 +199,9 @@ func (s *BusinessBrokerScraper) parseListingCard(e *colly.HTMLElement) *domain.L
 		Title:      title,
 		Country:    domain.StrPtr("US"),
 		IsActive:   true,
+		IsFeatured: isFeaturedCard(e.Attr("class")),
 	}
+	texts := make(priceTexts)
 
 	// Description
 	if desc := strings.TrimSpace(e.ChildText(".description, .listing-description, p")); desc != "" {
@@ -162,21 +210,21 @@ func (s *BusinessBrokerScraper) parseListingCard(e *colly.HTMLElement) *domain.L
 
 	// Price
 	priceText := e.ChildText(".price, .asking-price")
-	if price := parsePrice(priceText); price > 0 {
-		listing.AskingPrice = &price
-	}
+	texts.setAskingPrice(listing, priceText)
 
 	// Cash flow
 	cfText := e.ChildText(".cash-flow, .cashflow")
-	if cf := parsePrice(cfText); cf > 0 {
-		listing.CashFlow = &cf
-	}
+	texts.setPriceRange(finCashFlow, cfText, &listing.CashFlow, &listing.CashFlowMax)
 
 	// Revenue
 	revText := e.ChildText(".revenue")
-	if rev := parsePrice(revText); rev > 0 {
-		listing.Revenue = &rev
-	}
+	texts.setPriceRange(finRevenue, revText, &listing.Revenue, &listing.RevenueMax)
+
+	// EBITDA, FF&E and figures the selectors missed, and the founding year
+	// and head count, found by their labels
+	cardText := pageText(e.DOM)
+	texts.merge(applyLabeledFinancials(listing, cardText))
+	applyBusinessDetails(listing, cardText)
 
 	// Location
 	location := strings.TrimSpace(e.ChildText(".location, .city-state"))
@@ -207,8 +255,10 @@ func (s *BusinessBrokerScraper) parseListingCard(e *colly.HTMLElement) *domain.L
 
 	rawData := map[string]interface{}{
 		"source_url": url,
+		"title":      rawTitle,
 		"scraped_at": time.Now().Format(time.RFC3339),
 	}
+	texts.addTo(rawData)
 	if jsonBytes, err := json.Marshal(rawData); err == nil {
 		listing.RawData = jsonBytes
 	}
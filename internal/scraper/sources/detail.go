@@ -0,0 +1,269 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// DetailFetcher fetches a single listing detail page and extracts the
+// financial and broker fields that search result cards usually omit
+type DetailFetcher struct {
+	timeout time.Duration
+	acquire func(ctx context.Context) error
+}
+
+func NewDetailFetcher() *DetailFetcher {
+	return &DetailFetcher{timeout: 30 * time.Second}
+}
+
+// SetAcquireRequest sets a func each detail request waits on before it is
+// sent, as ScrapeOptions.AcquireRequest does for scrapes
+func (f *DetailFetcher) SetAcquireRequest(acquire func(ctx context.Context) error) {
+	f.acquire = acquire
+}
+
+// FetchDetail visits the listing URL of source and returns the fields found
+// on the page. Only fields present on the page are set. The request carries
+// the source's configured headers and, as Referer, its search page.
+func (f *DetailFetcher) FetchDetail(ctx context.Context, source *domain.Source, url string) (*domain.Listing, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.acquire != nil {
+		if err := f.acquire(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	c := colly.NewCollector()
+	c.SetRequestTimeout(f.timeout)
+
+	site := detailSite(source)
+	c.OnRequest(func(r *colly.Request) {
+		site.setHeaders(*r.Headers, site.startURL())
+	})
+
+	var detail *domain.Listing
+	c.OnHTML("body", func(e *colly.HTMLElement) {
+		detail = parseDetailText(pageText(e.DOM))
+		detail.Documents = parseDetailDocuments(e.DOM, e.Request.AbsoluteURL)
+	})
+
+	if err := c.Visit(url); err != nil {
+		return nil, fmt.Errorf("fetching detail page %s: %w", url, err)
+	}
+	c.Wait()
+
+	if detail == nil {
+		return nil, fmt.Errorf("no content on detail page %s", url)
+	}
+	return detail, nil
+}
+
+// detailSite returns the site of source its detail pages are fetched as
+// followed from: its start_path, or its home page without one. A nil source
+// has no site, and its detail requests no Referer.
+func detailSite(source *domain.Source) siteConfig {
+	if source == nil || source.BaseURL == "" {
+		return siteConfig{}
+	}
+	opts := domain.ScrapeOptions{BaseURL: source.BaseURL, SourceConfig: source.Config}
+	if cfg, err := domain.ParseSourceConfig(source.Config); err == nil {
+		opts.StartPath = cfg.StartPath
+	}
+	return newSite(strings.TrimRight(source.BaseURL, "/"), "/", nil).forRun(opts)
+}
+
+// pageText flattens the page into one line per leaf element so labels and
+// values stay near each other regardless of markup
+func pageText(sel *goquery.Selection) string {
+	var b strings.Builder
+	sel.Find("*").Not("script, style, noscript").Each(func(_ int, s *goquery.Selection) {
+		if s.Children().Length() > 0 {
+			return
+		}
+		if text := strings.TrimSpace(s.Text()); text != "" {
+			b.WriteString(text)
+			b.WriteString("\n")
+		}
+	})
+	return b.String()
+}
+
+var (
+	detailBrokerRe = regexp.MustCompile(`(?i)\b(?:business listed by|listed by|broker name|broker)\s*:\s*\n?\s*([^\n]+)`)
+	detailPhoneRe  = regexp.MustCompile(`\(?\b\d{3}\)?[\s.-]\d{3}[\s.-]\d{4}\b`)
+
+	detailDocumentCIMRe        = regexp.MustCompile(`(?i)\bcim\b|memorandum`)
+	detailDocumentDownloadRe   = regexp.MustCompile(`(?i)\bdownload\b|\bpdf\b`)
+	detailDocumentFinancialsRe = regexp.MustCompile(`(?i)financial|p\s*&\s*l\b|profit\s+(?:and|&)\s+loss|tax\s+returns?|balance\s+sheet`)
+
+	detailLocationsLabelRe = regexp.MustCompile(`(?i)^(?:additional |other |all )?locations\s*:?\s*(.*)$`)
+	detailCityStateRe      = regexp.MustCompile(`^([A-Za-z][A-Za-z .'-]*?)\s*,\s*([A-Za-z]{2})(?:\s+(\d{5}))?$`)
+)
+
+// parseDetailText extracts labelled values from detail page text.
+// The first value found for each field wins.
+func parseDetailText(text string) *domain.Listing {
+	detail, _ := parseDetail(text)
+	return detail
+}
+
+// parseDetail is parseDetailText, also returning the text of the financial
+// figures found
+func parseDetail(text string) (*domain.Listing, priceTexts) {
+	detail := &domain.Listing{}
+
+	texts := applyLabeledFinancials(detail, text)
+
+	applyBusinessDetails(detail, text)
+
+	if m := detailBrokerRe.FindStringSubmatchIndex(text); m != nil {
+		name := strings.TrimSpace(detailPhoneRe.ReplaceAllString(text[m[2]:m[3]], ""))
+		if name != "" && len(name) <= 100 {
+			detail.BrokerName = &name
+		}
+
+		// Only a phone in the broker block is the broker's; others on the
+		// page are usually the site's own support line
+		if phone := detailPhoneRe.FindString(brokerBlock(text[m[0]:])); phone != "" {
+			detail.BrokerPhone = &phone
+		}
+	}
+
+	detail.Locations = parseDetailLocations(text)
+
+	return detail, texts
+}
+
+// brokerBlockLines is how many lines after its label a broker block spans
+const brokerBlockLines = 4
+
+// brokerBlock returns the broker label's line of text and the
+// brokerBlockLines lines after it
+func brokerBlock(text string) string {
+	lines := strings.SplitN(text, "\n", brokerBlockLines+2)
+	return strings.Join(lines[:min(len(lines), brokerBlockLines+1)], "\n")
+}
+
+// parseDetailLocations reads a "Locations:" block listing "City, ST" entries,
+// either inline separated by ; or | or one per line. Duplicates are dropped.
+func parseDetailLocations(text string) []domain.ListingLocation {
+	lines := strings.Split(text, "\n")
+
+	for i, line := range lines {
+		m := detailLocationsLabelRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+
+		var locations []domain.ListingLocation
+		seen := make(map[string]bool)
+		add := func(entries []domain.ListingLocation) {
+			for _, loc := range entries {
+				key := strings.ToLower(*loc.City) + "|" + *loc.State
+				if !seen[key] {
+					seen[key] = true
+					locations = append(locations, loc)
+				}
+			}
+		}
+
+		add(parseCityStates(m[1]))
+		for _, next := range lines[i+1:] {
+			entries := parseCityStates(next)
+			if len(entries) == 0 {
+				break
+			}
+			add(entries)
+		}
+		if len(locations) > 0 {
+			return locations
+		}
+	}
+	return nil
+}
+
+// parseCityStates parses a line of "City, ST [ZIP]" entries. It returns nil
+// unless every entry on the line is a location.
+func parseCityStates(line string) []domain.ListingLocation {
+	var locations []domain.ListingLocation
+	for _, part := range strings.FieldsFunc(line, func(r rune) bool { return r == ';' || r == '|' }) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		m := detailCityStateRe.FindStringSubmatch(part)
+		if m == nil {
+			return nil
+		}
+		loc := domain.ListingLocation{
+			City:  domain.StrPtr(m[1]),
+			State: domain.StrPtr(strings.ToUpper(m[2])),
+		}
+		if m[3] != "" {
+			loc.ZipCode = domain.StrPtr(m[3])
+		}
+		locations = append(locations, loc)
+	}
+	return locations
+}
+
+// parseDetailDocuments finds links to CIMs, financial summaries and other PDFs.
+// Links are resolved with absURL; duplicates are dropped.
+func parseDetailDocuments(sel *goquery.Selection, absURL func(string) string) []domain.ListingDocument {
+	var documents []domain.ListingDocument
+	seen := make(map[string]bool)
+
+	sel.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		title := strings.Join(strings.Fields(a.Text()), " ")
+
+		docType := detailDocumentType(href, title)
+		if docType == "" {
+			return
+		}
+		link := absURL(href)
+		if link == "" || seen[link] {
+			return
+		}
+		seen[link] = true
+
+		doc := domain.ListingDocument{Type: docType, URL: link}
+		if title != "" {
+			doc.Title = &title
+		}
+		documents = append(documents, doc)
+	})
+	return documents
+}
+
+// detailDocumentType classifies a link by its text and URL, returning "" for
+// links that aren't documents. A link is a document if it points at a PDF, is
+// labelled as a download, or names a CIM; "Financial Services" category links
+// and the like are not.
+func detailDocumentType(href, title string) string {
+	path := strings.ToLower(href)
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	text := title + " " + path
+
+	switch {
+	case detailDocumentCIMRe.MatchString(text):
+		return domain.DocumentTypeCIM
+	case !strings.HasSuffix(path, ".pdf") && !detailDocumentDownloadRe.MatchString(title):
+		return ""
+	case detailDocumentFinancialsRe.MatchString(text):
+		return domain.DocumentTypeFinancials
+	}
+	return domain.DocumentTypeOther
+}
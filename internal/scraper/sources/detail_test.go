@@ -0,0 +1,173 @@
+package sources
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestParseDetailText(t *testing.T) {
+	text := `Asking Price:
+$1,250,000
+Cash Flow: $310,000
+Gross Revenue:
+$1.2M
+EBITDA: Not Disclosed
+Established: 1998
+Employees: 12
+Business Listed By:
+Jane Broker
+Phone: (555) 123-4567
+Asking Price: $9
+`
+
+	got := parseDetailText(text)
+
+	checkInt64 := func(name string, p *int64, want int64) {
+		t.Helper()
+		if p == nil {
+			t.Errorf("%s = nil, want %d", name, want)
+		} else if *p != want {
+			t.Errorf("%s = %d, want %d", name, *p, want)
+		}
+	}
+	checkInt64("AskingPrice", got.AskingPrice, 125000000)
+	checkInt64("CashFlow", got.CashFlow, 31000000)
+	checkInt64("Revenue", got.Revenue, 120000000)
+
+	if got.EBITDA != nil {
+		t.Errorf("EBITDA = %d, want nil for undisclosed", *got.EBITDA)
+	}
+	if got.YearEstablished == nil || *got.YearEstablished != 1998 {
+		t.Errorf("YearEstablished = %v, want 1998", got.YearEstablished)
+	}
+	if got.Employees == nil || *got.Employees != 12 {
+		t.Errorf("Employees = %v, want 12", got.Employees)
+	}
+	if got.BrokerName == nil || *got.BrokerName != "Jane Broker" {
+		t.Errorf("BrokerName = %v, want Jane Broker", got.BrokerName)
+	}
+	if got.BrokerPhone == nil || *got.BrokerPhone != "(555) 123-4567" {
+		t.Errorf("BrokerPhone = %v, want (555) 123-4567", got.BrokerPhone)
+	}
+}
+
+func TestParseDetailTextBrokerPhone(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"in broker block", "Support: 800-555-0100\nBroker: Jane Broker\nCall (555) 123-4567\n", "(555) 123-4567"},
+		{"on broker line", "Listed By: Jane Broker 555.123.4567\n", "555.123.4567"},
+		{"site support line only", "Questions? Call 800-555-0100\nBroker: Jane Broker\nEmail jane@example.com\n", ""},
+		{"far below broker", "Broker: Jane Broker\na\nb\nc\nd\nFooter 800-555-0100\n", ""},
+		{"no broker", "Call 800-555-0100 for help\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseDetailText(tt.text).BrokerPhone
+			if (got == nil && tt.want != "") || (got != nil && *got != tt.want) {
+				t.Errorf("BrokerPhone = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDetailTextEmpty(t *testing.T) {
+	got := parseDetailText("Contact the seller for details")
+	if got.AskingPrice != nil || got.CashFlow != nil || got.Revenue != nil ||
+		got.BrokerName != nil || got.BrokerPhone != nil {
+		t.Errorf("expected no fields, got %+v", got)
+	}
+}
+
+func TestParseDetailLocations(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "one per line",
+			text: "Locations:\nAustin, TX 78701\nDallas, tx\nHouston, TX\nAsking Price: $1,000,000\n",
+			want: []string{"Austin, TX 78701", "Dallas, TX", "Houston, TX"},
+		},
+		{
+			name: "inline",
+			text: "Additional Locations: Reno, NV; Boise, ID | Reno, NV\nEmployees: 4\n",
+			want: []string{"Reno, NV", "Boise, ID"},
+		},
+		{
+			name: "no block",
+			text: "Location: Austin, TX\nAsking Price: $1,000,000\n",
+			want: nil,
+		},
+		{
+			name: "label without entries",
+			text: "Locations\nCall for details\n",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, loc := range parseDetailText(tt.text).Locations {
+				s := *loc.City + ", " + *loc.State
+				if loc.ZipCode != nil {
+					s += " " + *loc.ZipCode
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("locations = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDetailDocuments(t *testing.T) {
+	html := `<html><body>
+<a href="/industries/financial-services">Financial Services</a>
+<a href="/docs/cim.pdf">Confidential Information Memorandum</a>
+<a href="/docs/cim.pdf">CIM (PDF)</a>
+<a href="/docs/cim.pdf?v=2">Download CIM</a>
+<a href="https://files.example.com/2023-pl.pdf">2023 P&amp;L</a>
+<a href="/request-financials">Download Financial Summary</a>
+<a href="/docs/floorplan.PDF#page=1">Floor plan</a>
+<a href="/listing/123">Similar listing</a>
+</body></html>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatal(err)
+	}
+	absURL := func(href string) string {
+		if strings.HasPrefix(href, "/") {
+			return "https://broker.example.com" + href
+		}
+		return href
+	}
+
+	got := parseDetailDocuments(doc.Selection, absURL)
+
+	want := []struct{ docType, url, title string }{
+		{domain.DocumentTypeCIM, "https://broker.example.com/docs/cim.pdf", "Confidential Information Memorandum"},
+		{domain.DocumentTypeCIM, "https://broker.example.com/docs/cim.pdf?v=2", "Download CIM"},
+		{domain.DocumentTypeFinancials, "https://files.example.com/2023-pl.pdf", "2023 P&L"},
+		{domain.DocumentTypeFinancials, "https://broker.example.com/request-financials", "Download Financial Summary"},
+		{domain.DocumentTypeOther, "https://broker.example.com/docs/floorplan.PDF#page=1", "Floor plan"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d documents %+v, want %d", len(got), got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Type != w.docType || got[i].URL != w.url || got[i].Title == nil || *got[i].Title != w.title {
+			t.Errorf("[%d] = %s %s %v, want %s %s %q", i, got[i].Type, got[i].URL, got[i].Title, w.docType, w.url, w.title)
+		}
+	}
+}
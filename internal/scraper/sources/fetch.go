@@ -0,0 +1,88 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/scraper/useragents"
+)
+
+// pageFetcher fetches one run's pages in sequence with net/http,
+// opts.RateLimit apart, for scrapers that don't crawl with colly
+type pageFetcher struct {
+	source string
+	client *http.Client
+	logger *slog.Logger
+	opts   domain.ScrapeOptions
+	errors chan<- error
+	last   time.Time
+	// maxBytes caps a response body; the rest is dropped
+	maxBytes int64
+	// accept, if set, is sent as the Accept header
+	accept string
+	// headers are the source's configured request headers, sent last
+	headers map[string]string
+}
+
+// fetch GETs url after waiting out the rate limit and the process-wide one,
+// recording the request
+func (f *pageFetcher) fetch(ctx context.Context, url string) ([]byte, error) {
+	if wait := f.opts.RateLimit - time.Since(f.last); !f.last.IsZero() && wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err := f.opts.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	f.last = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	ua := useragents.Next()
+	req.Header.Set("User-Agent", ua.UserAgent)
+	req.Header.Set("Accept-Language", ua.AcceptLanguage)
+	if f.accept != "" {
+		req.Header.Set("Accept", f.accept)
+	}
+	setConfiguredHeaders(req.Header, f.headers)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		f.opts.Record(url, 0, err)
+		return nil, &domain.ScrapeError{Source: f.source, Kind: domain.ScrapeErrorRequest, URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes))
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	f.opts.Record(url, resp.StatusCode, err)
+	if err != nil {
+		kind := domain.ScrapeErrorRequest
+		if isBlockedResponse(resp.StatusCode, &resp.Header, body) {
+			kind = domain.ScrapeErrorBlocked
+		}
+		return nil, &domain.ScrapeError{Source: f.source, Kind: kind, URL: url, Status: resp.StatusCode, Err: err}
+	}
+	return body, nil
+}
+
+// sendError reports a non-fatal error without blocking the crawl
+func (f *pageFetcher) sendError(err error) {
+	select {
+	case f.errors <- err:
+	default:
+		f.logger.Warn("dropped scrape error", "error", err)
+	}
+}
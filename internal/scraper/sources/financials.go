@@ -0,0 +1,110 @@
+package sources
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// Keys of parseLabeledFinancials, named after the listing columns they fill
+const (
+	finAskingPrice = "asking_price"
+	finRevenue     = "revenue"
+	finCashFlow    = "cash_flow"
+	finEBITDA      = "ebitda"
+	finInventory   = "inventory_value"
+)
+
+// financialLabels are the labels brokers print next to a figure, by the field
+// it belongs in. SDE is reported as cash flow; FF&E and inventory share
+// inventory_value. Longer labels come first so "gross revenue" isn't read as
+// "revenue".
+var financialLabels = []struct {
+	field   string
+	pattern string
+}{
+	{finAskingPrice, `asking\s+price|listing\s+price|price`},
+	{finRevenue, `gross\s+revenue|annual\s+revenue|revenue|gross\s+sales|sales`},
+	{finCashFlow, `cash\s+flow|seller['’]?s?\s+discretionary\s+earnings|discretionary\s+earnings|sde`},
+	{finEBITDA, `adjusted\s+ebitda|ebitda`},
+	{finInventory, `ff\s*&\s*e|ffe|furniture,?\s+fixtures,?\s+(?:and|&)\s+equipment|inventory`},
+}
+
+// labeledFigureRe matches a financial label followed by a dollar figure, e.g.
+// "Cash Flow (SDE): $250K" or "EBITDA\n$1.2 million". Each label group is its
+// own submatch; the figure is the last.
+var labeledFigureRe = func() *regexp.Regexp {
+	groups := make([]string, len(financialLabels))
+	for i, l := range financialLabels {
+		groups[i] = "(" + l.pattern + ")"
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(groups, "|") + `)\b` +
+		`(?:\s*\([^)\n]*\))?\s*[:\-–]?\s*\$\s*([\d,]*\d(?:\.\d+)?(?:\s*(?:million|mil|mm|[km])\b)?)`)
+}()
+
+// labeledFigure is a labelled figure found in text: its value in cents and
+// the label and figure as written, e.g. "Cash Flow (SDE): $250K"
+type labeledFigure struct {
+	value int64
+	text  string
+}
+
+// findLabeledFigures scans text for labelled figures, keyed by field. The
+// first figure for each field wins; for a range it is the low end.
+func findLabeledFigures(text string) map[string]labeledFigure {
+	figures := make(map[string]labeledFigure)
+	for _, m := range labeledFigureRe.FindAllStringSubmatch(text, -1) {
+		var field string
+		for i, l := range financialLabels {
+			if m[i+1] != "" {
+				field = l.field
+				break
+			}
+		}
+		if _, seen := figures[field]; seen {
+			continue
+		}
+		if value := parsePrice(m[len(m)-1]); value > 0 {
+			figures[field] = labeledFigure{value: value, text: m[0]}
+		}
+	}
+	return figures
+}
+
+// parseLabeledFinancials scans text for labelled figures and returns them in
+// cents keyed by field: asking_price, revenue, cash_flow, ebitda and
+// inventory_value. The first figure for each field wins; for a range it is
+// the low end. Text should keep labels and values apart, as pageText does.
+func parseLabeledFinancials(text string) map[string]int64 {
+	values := make(map[string]int64)
+	for field, figure := range findLabeledFigures(text) {
+		values[field] = figure.value
+	}
+	return values
+}
+
+// applyLabeledFinancials fills the listing's financial fields that are still
+// empty from the labelled figures in text, and returns the text of the
+// figures it used. A listing given an asking price is no longer on request.
+func applyLabeledFinancials(listing *domain.Listing, text string) priceTexts {
+	figures := findLabeledFigures(text)
+	texts := make(priceTexts)
+	for field, dst := range map[string]**int64{
+		finAskingPrice: &listing.AskingPrice,
+		finRevenue:     &listing.Revenue,
+		finCashFlow:    &listing.CashFlow,
+		finEBITDA:      &listing.EBITDA,
+		finInventory:   &listing.Inventory,
+	} {
+		if figure, ok := figures[field]; ok && *dst == nil {
+			value := figure.value
+			*dst = &value
+			texts.set(field, figure.text)
+		}
+	}
+	if listing.AskingPrice != nil {
+		listing.PriceOnRequest = false
+	}
+	return texts
+}
@@ -0,0 +1,118 @@
+package sources
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestParseLabeledFinancials(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]int64
+	}{
+		{
+			name: "card with SDE and EBITDA",
+			text: `Profitable HVAC Company
+Dallas, TX
+Asking Price: $2,400,000
+Gross Revenue: $3.1M
+Cash Flow (SDE): $640,000
+EBITDA: $480,000
+FF&E: $125,000`,
+			want: map[string]int64{
+				"asking_price":    240000000,
+				"revenue":         310000000,
+				"cash_flow":       64000000,
+				"ebitda":          48000000,
+				"inventory_value": 12500000,
+			},
+		},
+		{
+			name: "labels and values on separate lines",
+			text: "Price\n$850K\nSeller's Discretionary Earnings\n$210K\nAdjusted EBITDA\n$1.2 million\nInventory\n$40,000\n",
+			want: map[string]int64{
+				"asking_price":    85000000,
+				"cash_flow":       21000000,
+				"ebitda":          120000000,
+				"inventory_value": 4000000,
+			},
+		},
+		{
+			name: "SDE without cash flow label",
+			text: "Gross Sales: $1,500,000 | SDE: $300,000 | Furniture, Fixtures & Equipment: $75,000",
+			want: map[string]int64{
+				"revenue":         150000000,
+				"cash_flow":       30000000,
+				"inventory_value": 7500000,
+			},
+		},
+		{
+			name: "undisclosed and first figure wins",
+			text: "Asking Price: $500,000\nCash Flow: Not Disclosed\nEBITDA: N/A\nRevenue: $1M - $1.5M\nAsking Price: $9",
+			want: map[string]int64{
+				"asking_price": 50000000,
+				"revenue":      100000000,
+			},
+		},
+		{
+			name: "figures without labels",
+			text: "Established 1998, 12 employees. Call $555 for details? No: call (555) 123-4567.",
+			want: map[string]int64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLabeledFinancials(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyLabeledFinancialsKeepsSelectorValues(t *testing.T) {
+	html := `<div class="listing">
+		<span class="price">$1M - $1.25M</span>
+		<ul>
+			<li><b>Cash Flow:</b> <span>$300,000</span></li>
+			<li><b>EBITDA:</b> <span>$220,000</span></li>
+			<li><b>Inventory:</b> <span>$60,000</span></li>
+		</ul>
+	</div>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listing := &domain.Listing{}
+	setPriceRange("$1M - $1.25M", &listing.AskingPrice, &listing.AskingPriceMax)
+	texts := applyLabeledFinancials(listing, pageText(doc.Selection))
+
+	// The range from the price selector is kept
+	if *listing.AskingPrice != 100000000 || listing.AskingPriceMax == nil || *listing.AskingPriceMax != 125000000 {
+		t.Errorf("asking price = %d-%v, want the selector's range", *listing.AskingPrice, listing.AskingPriceMax)
+	}
+	for name, got := range map[string]*int64{"CashFlow": listing.CashFlow, "EBITDA": listing.EBITDA, "Inventory": listing.Inventory} {
+		if got == nil {
+			t.Errorf("%s not filled from its label", name)
+		}
+	}
+	if listing.EBITDA != nil && *listing.EBITDA != 22000000 {
+		t.Errorf("EBITDA = %d, want 22000000", *listing.EBITDA)
+	}
+	if listing.Revenue != nil {
+		t.Errorf("Revenue = %d, want nil", *listing.Revenue)
+	}
+
+	// Only the figures it filled have their text returned
+	wantTexts := priceTexts{"cashflow_text": "Cash Flow:\n$300,000", "ebitda_text": "EBITDA:\n$220,000", "inventory_text": "Inventory:\n$60,000"}
+	if !reflect.DeepEqual(texts, wantTexts) {
+		t.Errorf("texts = %q, want %q", texts, wantTexts)
+	}
+}
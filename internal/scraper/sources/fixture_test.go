@@ -0,0 +1,450 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// fixtureScraper is the part of engine.Scraper the harness needs
+type fixtureScraper interface {
+	Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error)
+}
+
+// scrapeFixture serves testdata/<fixture> for every path, runs the scraper
+// returned by newScraper against it and returns the emitted listings sorted
+// by external ID, along with the server's base URL.
+func scrapeFixture(t *testing.T, fixture string, newScraper func(baseURL string) fixtureScraper) ([]*domain.Listing, string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", fixture)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, path)
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	listingsCh, errCh := newScraper(srv.URL).Scrape(ctx, domain.ScrapeOptions{})
+
+	var listings []*domain.Listing
+	for l := range listingsCh {
+		listings = append(listings, l)
+	}
+	for err := range errCh {
+		t.Errorf("scrape error: %v", err)
+	}
+
+	sort.Slice(listings, func(i, j int) bool {
+		return listings[i].ExternalID < listings[j].ExternalID
+	})
+	return listings, srv.URL
+}
+
+type fixtureListing struct {
+	externalID string
+	path       string
+	title      string
+	price      int64
+	city       string
+	state      string
+	featured   bool
+}
+
+func TestCollyScraperFixtures(t *testing.T) {
+	tests := []struct {
+		name       string
+		fixture    string
+		newScraper func(baseURL string) fixtureScraper
+		want       []fixtureListing
+	}{
+		{
+			name:    "bizbuysell",
+			fixture: "bizbuysell.html",
+			newScraper: func(baseURL string) fixtureScraper {
+				return NewBizBuySellScraper(nil, WithBaseURL(baseURL))
+			},
+			want: []fixtureListing{
+				{"2214567", "/Business-Opportunity/established-coffee-shop-downtown-2214567.aspx", "Established Coffee Shop Downtown", 45000000, "Austin", "TX", true},
+				{"2230981", "/Business-Opportunity/profitable-hvac-company/listing-2230981", "Profitable HVAC Company", 120000000, "Denver", "CO", false},
+			},
+		},
+		{
+			name:    "bizquest",
+			fixture: "bizquest.html",
+			newScraper: func(baseURL string) fixtureScraper {
+				return NewBizQuestScraper(nil, WithBaseURL(baseURL))
+			},
+			want: []fixtureListing{
+				{"1789012", "/business-for-sale/detail/1789012/", "Family Pizza Restaurant", 32500000, "Tampa", "FL", false},
+				{"1790455", "/business-for-sale/detail/1790455/", "Landscaping Business with Equipment", 61000000, "Raleigh", "NC", false},
+			},
+		},
+		{
+			name:    "businessbroker",
+			fixture: "businessbroker.html",
+			newScraper: func(baseURL string) fixtureScraper {
+				return NewBusinessBrokerScraper(nil, WithBaseURL(baseURL))
+			},
+			want: []fixtureListing{
+				{"445566", "/listing/445566", "Auto Repair Shop", 28000000, "Phoenix", "AZ", false},
+				{"445601", "/listing/445601", "Dry Cleaner - Two Locations", 19900000, "Columbus", "OH", false},
+			},
+		},
+		{
+			name:    "firstchoice",
+			fixture: "firstchoice.html",
+			newScraper: func(baseURL string) fixtureScraper {
+				return NewFirstChoiceScraper(nil, WithBaseURL(baseURL))
+			},
+			want: []fixtureListing{
+				{"fc-88231", "/listing/88231/", "Boutique Fitness Studio", 27500000, "Las Vegas", "NV", true},
+				{"fc-88310", "/listing/88310/", "Liquor Store with Real Estate", 54000000, "Reno", "NV", false},
+			},
+		},
+		{
+			name:    "sunbelt",
+			fixture: "sunbelt.html",
+			newScraper: func(baseURL string) fixtureScraper {
+				return NewSunbeltScraper(nil, WithBaseURL(baseURL))
+			},
+			want: []fixtureListing{
+				{"30477", "/business/30477/", "Bagel Bakery", 18500000, "Atlanta", "GA", false},
+				{"sunbelt-30412", "/business/30412/", "Commercial Cleaning Company", 75000000, "Charlotte", "NC", false},
+			},
+		},
+		{
+			name:    "transworld",
+			fixture: "transworld.html",
+			newScraper: func(baseURL string) fixtureScraper {
+				return NewTransworldScraper(nil, WithBaseURL(baseURL))
+			},
+			want: []fixtureListing{
+				{"tw-51234", "/listing/51234/pet-grooming-salon", "Pet Grooming Salon", 16500000, "Orlando", "FL", false},
+				{"tw-51290", "/listing/51290/", "Precision Machining Company", 240000000, "Houston", "TX", false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, baseURL := scrapeFixture(t, tt.fixture, tt.newScraper)
+			if len(got) != len(tt.want) {
+				t.Fatalf("scraped %d listings, want %d", len(got), len(tt.want))
+			}
+
+			for i, want := range tt.want {
+				l := got[i]
+				if l.ExternalID != want.externalID {
+					t.Errorf("[%d] external ID = %q, want %q", i, l.ExternalID, want.externalID)
+				}
+				if l.URL != baseURL+want.path {
+					t.Errorf("[%d] URL = %q, want %q", i, l.URL, baseURL+want.path)
+				}
+				if l.Title != want.title {
+					t.Errorf("[%d] title = %q, want %q", i, l.Title, want.title)
+				}
+				if l.AskingPrice == nil || *l.AskingPrice != want.price {
+					t.Errorf("[%d] asking price = %v, want %d", i, l.AskingPrice, want.price)
+				}
+				if l.City == nil || *l.City != want.city {
+					t.Errorf("[%d] city = %v, want %s", i, l.City, want.city)
+				}
+				if l.State == nil || *l.State != want.state {
+					t.Errorf("[%d] state = %v, want %s", i, l.State, want.state)
+				}
+				if l.IsFeatured != want.featured {
+					t.Errorf("[%d] featured = %v, want %v", i, l.IsFeatured, want.featured)
+				}
+			}
+		})
+	}
+}
+
+func TestPriceTextsInRawData(t *testing.T) {
+	got, _ := scrapeFixture(t, "bizbuysell.html", func(baseURL string) fixtureScraper {
+		return NewBizBuySellScraper(nil, WithBaseURL(baseURL))
+	})
+	if len(got) != 2 {
+		t.Fatalf("scraped %d listings, want 2", len(got))
+	}
+
+	want := []map[string]string{
+		{"price_text": "Asking Price: $450,000", "cashflow_text": "Cash Flow: $120,000"},
+		{"price_text": "$1.2M"},
+	}
+	for i, l := range got {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(l.RawData, &raw); err != nil {
+			t.Fatalf("[%d] raw data: %v", i, err)
+		}
+		for key, text := range want[i] {
+			if raw[key] != text {
+				t.Errorf("[%d] raw_data %s = %v, want %q", i, key, raw[key], text)
+			}
+		}
+	}
+}
+
+func TestScrapeOptionsOverrideSite(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path != "/mirror/search/" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", "bizquest.html"))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The constructor defaults point at the live site; the source row wins
+	listingsCh, errCh := NewBizQuestScraper(nil).Scrape(ctx, domain.ScrapeOptions{
+		BaseURL:   srv.URL + "/",
+		StartPath: "/mirror/search/",
+	})
+
+	var got []*domain.Listing
+	for l := range listingsCh {
+		got = append(got, l)
+	}
+	for err := range errCh {
+		t.Errorf("scrape error: %v", err)
+	}
+
+	if len(paths) != 1 || paths[0] != "/mirror/search/" {
+		t.Errorf("requested %v, want only /mirror/search/", paths)
+	}
+	if len(got) != 2 {
+		t.Fatalf("scraped %d listings, want 2", len(got))
+	}
+	for _, l := range got {
+		if !strings.HasPrefix(l.URL, srv.URL+"/business-for-sale/") {
+			t.Errorf("URL = %q, want it resolved against the source's base_url", l.URL)
+		}
+	}
+}
+
+func TestIsFeaturedCard(t *testing.T) {
+	tests := []struct {
+		class string
+		want  bool
+	}{
+		{"listing diamond-listing", true},
+		{"listing-card featured", true},
+		{"business-listing listing-featured", true},
+		{"Listing Showcase", true},
+		{"listing", false},
+		{"listing-card unfeatured", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isFeaturedCard(tt.class); got != tt.want {
+			t.Errorf("isFeaturedCard(%q) = %v, want %v", tt.class, got, tt.want)
+		}
+	}
+}
+
+func TestSiteOptions(t *testing.T) {
+	s := newSite("https://www.example.com", "/businesses-for-sale/", nil)
+	if got := s.startURL(); got != "https://www.example.com/businesses-for-sale/" {
+		t.Errorf("default startURL = %q", got)
+	}
+	if got := s.allowedDomains(); len(got) != 2 || got[0] != "www.example.com" || got[1] != "example.com" {
+		t.Errorf("allowedDomains = %v", got)
+	}
+
+	s = newSite("https://www.example.com", "/businesses-for-sale/", []Option{
+		WithBaseURL("http://127.0.0.1:8080/"),
+		WithStartPath("/search?page=1"),
+	})
+	if got := s.startURL(); got != "http://127.0.0.1:8080/search?page=1" {
+		t.Errorf("startURL = %q", got)
+	}
+	if got := s.absURL("/listing/1"); got != "http://127.0.0.1:8080/listing/1" {
+		t.Errorf("absURL(relative) = %q", got)
+	}
+	if got := s.absURL("https://other.example.com/listing/1"); got != "https://other.example.com/listing/1" {
+		t.Errorf("absURL(absolute) = %q", got)
+	}
+}
+
+func TestSitePageURL(t *testing.T) {
+	tests := []struct {
+		startPath string
+		page      int
+		want      string
+	}{
+		{"/businesses-for-sale/", 1, "https://www.example.com/businesses-for-sale/"},
+		{"/businesses-for-sale/", 2, "https://www.example.com/businesses-for-sale/2/"},
+		{"/businesses-for-sale/texas", 3, "https://www.example.com/businesses-for-sale/texas/3/"},
+		{"/businesses-for-sale/?industry=restaurants", 1, "https://www.example.com/businesses-for-sale/?industry=restaurants"},
+		{"/businesses-for-sale/?industry=restaurants", 2, "https://www.example.com/businesses-for-sale/2/?industry=restaurants"},
+	}
+	for _, tt := range tests {
+		s := newSite("https://www.example.com", tt.startPath, nil)
+		if got := s.pageURL(tt.page); got != tt.want {
+			t.Errorf("pageURL(%d) from %q = %q, want %q", tt.page, tt.startPath, got, tt.want)
+		}
+	}
+}
+
+func TestSiteContentWait(t *testing.T) {
+	s := newSite("https://www.example.com", "/businesses-for-sale/", nil)
+	s.waitSelector = "div.listing"
+
+	if got := s.forRun(domain.ScrapeOptions{}); got.waitSelector != "div.listing" || got.waitTimeout != defaultWaitTimeout {
+		t.Errorf("default wait = %q for %v", got.waitSelector, got.waitTimeout)
+	}
+
+	got := s.forRun(domain.ScrapeOptions{SourceConfig: []byte(`{"wait_selector":"li.result","wait_timeout_seconds":40}`)})
+	if got.waitSelector != "li.result" || got.waitTimeout != 40*time.Second {
+		t.Errorf("configured wait = %q for %v, want li.result for 40s", got.waitSelector, got.waitTimeout)
+	}
+}
+
+func TestMaxPagesStopsAfterStartPage(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "bizquest.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every page links to another, so only MaxPages ends the crawl
+	page := strings.Replace(string(fixture), "</body>", `<a class="next" href="/page/next/">Next</a></body>`, 1)
+
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	matched := map[string]int{}
+	listingsCh, errCh := NewBizQuestScraper(nil, WithBaseURL(srv.URL)).Scrape(ctx, domain.ScrapeOptions{
+		MaxPages:  1,
+		MatchCard: func(selector string) { matched[selector]++ },
+	})
+
+	var got []*domain.Listing
+	for l := range listingsCh {
+		got = append(got, l)
+	}
+	for err := range errCh {
+		t.Errorf("scrape error: %v", err)
+	}
+
+	if len(paths) != 1 {
+		t.Errorf("requested %v, want only the start page", paths)
+	}
+	if len(got) != 2 || matched[bizQuestCardSelector] != 2 {
+		t.Errorf("scraped %d listings from %v matched cards, want 2 of 2", len(got), matched)
+	}
+}
+
+func TestShouldSkipURL(t *testing.T) {
+	site := newSite("https://www.bizquest.com", "/", nil).forRun(domain.ScrapeOptions{
+		SourceConfig: []byte(`{"skip_patterns":["/sponsored/","[?&]category=(?:franchise|startup)\\b"]}`),
+	})
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://www.bizquest.com/sponsored/featured-broker/", true},
+		{"https://www.bizquest.com/SPONSORED/ad-1/", true},
+		{"https://www.bizquest.com/search/?page=2&category=franchise", true},
+		{"https://www.bizquest.com/business-for-sale/detail/1789012/", false},
+		{"https://www.bizquest.com/search/?category=franchises-wanted", false},
+	}
+	for _, tt := range tests {
+		if got := site.skips(tt.url); got != tt.want {
+			t.Errorf("skips(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+
+	if newSite("https://www.bizquest.com", "/", nil).skips("https://www.bizquest.com/sponsored/") {
+		t.Error("a site without skip_patterns skipped a URL")
+	}
+}
+
+func TestSkipPatternsDuringCrawl(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "bizquest.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The only next page is a "contact a broker" interstitial
+	page := strings.Replace(string(fixture), "</body>", `<a class="next" href="/contact-a-broker/?next=2">Next</a></body>`, 1)
+
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	listingsCh, errCh := NewBizQuestScraper(nil, WithBaseURL(srv.URL)).Scrape(ctx, domain.ScrapeOptions{
+		SourceConfig: []byte(`{"skip_patterns":["/contact-a-broker/","/detail/1790455/"]}`),
+	})
+
+	var got []*domain.Listing
+	for l := range listingsCh {
+		got = append(got, l)
+	}
+	for err := range errCh {
+		t.Errorf("scrape error: %v", err)
+	}
+
+	if len(paths) != 1 {
+		t.Errorf("requested %v, want only the start page", paths)
+	}
+	if len(got) != 1 || got[0].ExternalID != "1789012" {
+		t.Errorf("scraped %d listings, want only 1789012", len(got))
+	}
+}
+
+func TestMaxFollowedPages(t *testing.T) {
+	tests := []struct {
+		opts domain.ScrapeOptions
+		want int
+	}{
+		{domain.ScrapeOptions{}, 50},
+		{domain.ScrapeOptions{MaxListings: 45}, 3},
+		{domain.ScrapeOptions{MaxPages: 1}, 0},
+		{domain.ScrapeOptions{MaxPages: 3, MaxListings: 1000}, 2},
+	}
+	for _, tt := range tests {
+		if got := maxFollowedPages(tt.opts); got != tt.want {
+			t.Errorf("maxFollowedPages(%+v) = %d, want %d", tt.opts, got, tt.want)
+		}
+	}
+}
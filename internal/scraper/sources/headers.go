@@ -0,0 +1,79 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gocolly/colly/v2"
+
+	"github.com/kbsch/trough/internal/domain"
+	"github.com/kbsch/trough/internal/scraper/useragents"
+)
+
+// browserHeaders are sent with every page request, as a desktop browser
+// navigating to the page would send them. Sec-Fetch-Site and Referer depend
+// on the request and are set by setHeaders.
+var browserHeaders = map[string]string{
+	"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+	"Upgrade-Insecure-Requests": "1",
+	"Sec-Fetch-Dest":            "document",
+	"Sec-Fetch-Mode":            "navigate",
+	"Sec-Fetch-User":            "?1",
+}
+
+// setHeaders sets the headers of a page request: a user agent from the pool
+// and its language, browserHeaders, and referer, if not empty, as the page
+// the request was followed from. The source's configured headers go last,
+// replacing any of the same name; an empty one drops the header.
+func (s siteConfig) setHeaders(h http.Header, referer string) {
+	ua := useragents.Next()
+	h.Set("User-Agent", ua.UserAgent)
+	h.Set("Accept-Language", ua.AcceptLanguage)
+	for name, value := range browserHeaders {
+		h.Set(name, value)
+	}
+	if referer != "" {
+		h.Set("Referer", referer)
+		h.Set("Sec-Fetch-Site", "same-origin")
+	} else {
+		h.Set("Sec-Fetch-Site", "none")
+	}
+	setConfiguredHeaders(h, s.headers)
+}
+
+// setConfiguredHeaders sets headers from a source's config on h, removing
+// those configured empty
+func setConfiguredHeaders(h http.Header, headers map[string]string) {
+	for name, value := range headers {
+		if value == "" {
+			h.Del(name)
+		} else {
+			h.Set(name, value)
+		}
+	}
+}
+
+// onRequest returns the OnRequest callback of a colly crawl of the site. It
+// aborts requests once ctx is done, e.g. when the source's request budget is
+// spent, waits for the process-wide request rate, and sets the request's
+// headers. Requests after the start page are sent as if followed from it.
+func (s siteConfig) onRequest(ctx context.Context, opts domain.ScrapeOptions) colly.RequestCallback {
+	start := s.startURL()
+	return func(r *colly.Request) {
+		if ctx.Err() != nil {
+			r.Abort()
+			return
+		}
+		// Fails only once ctx is done
+		if err := opts.Acquire(ctx); err != nil {
+			r.Abort()
+			return
+		}
+
+		var referer string
+		if u := r.URL.String(); u != start {
+			referer = start
+		}
+		s.setHeaders(*r.Headers, referer)
+	}
+}
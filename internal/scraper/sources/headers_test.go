@@ -0,0 +1,143 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// headerServer serves the bizquest fixture with a link to a second page and
+// records the headers of every request
+func headerServer(t *testing.T) (*httptest.Server, func() []http.Header) {
+	t.Helper()
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "bizquest.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := strings.Replace(string(fixture), "</body>", `<a class="next" href="/page/2/">Next</a></body>`, 1)
+
+	var mu sync.Mutex
+	var headers []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return headers
+	}
+}
+
+func scrapeHeaders(t *testing.T, config string) ([]http.Header, string) {
+	t.Helper()
+
+	srv, headers := headerServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	listingsCh, errCh := NewBizQuestScraper(nil, WithBaseURL(srv.URL)).Scrape(ctx, domain.ScrapeOptions{
+		MaxPages:     2,
+		SourceConfig: json.RawMessage(config),
+	})
+	for range listingsCh {
+	}
+	for err := range errCh {
+		t.Errorf("scrape error: %v", err)
+	}
+
+	got := headers()
+	if len(got) != 2 {
+		t.Fatalf("made %d requests, want 2", len(got))
+	}
+	return got, srv.URL
+}
+
+func TestCollyDefaultHeaders(t *testing.T) {
+	got, baseURL := scrapeHeaders(t, `{}`)
+
+	for i, h := range got {
+		if h.Get("User-Agent") == "" || h.Get("Accept-Language") == "" {
+			t.Errorf("[%d] user agent = %q, language = %q", i, h.Get("User-Agent"), h.Get("Accept-Language"))
+		}
+		for name, want := range browserHeaders {
+			if h.Get(name) != want {
+				t.Errorf("[%d] %s = %q, want %q", i, name, h.Get(name), want)
+			}
+		}
+	}
+
+	// The start page is opened directly, the next page from it
+	if start := got[0]; start.Get("Referer") != "" || start.Get("Sec-Fetch-Site") != "none" {
+		t.Errorf("start page Referer = %q, Sec-Fetch-Site = %q; want none", start.Get("Referer"), start.Get("Sec-Fetch-Site"))
+	}
+	if next := got[1]; next.Get("Referer") != baseURL+"/businesses-for-sale/" || next.Get("Sec-Fetch-Site") != "same-origin" {
+		t.Errorf("next page Referer = %q, Sec-Fetch-Site = %q; want the search page, same-origin", next.Get("Referer"), next.Get("Sec-Fetch-Site"))
+	}
+}
+
+func TestCollyConfiguredHeaders(t *testing.T) {
+	got, _ := scrapeHeaders(t, `{"headers":{"DNT":"1","Sec-CH-UA-Platform":"\"Windows\"","Accept":"text/html","Sec-Fetch-User":""}}`)
+
+	for i, h := range got {
+		if h.Get("DNT") != "1" || h.Get("Sec-Ch-Ua-Platform") != `"Windows"` {
+			t.Errorf("[%d] DNT = %q, Sec-CH-UA-Platform = %q; want the configured values", i, h.Get("DNT"), h.Get("Sec-Ch-Ua-Platform"))
+		}
+		if h.Get("Accept") != "text/html" {
+			t.Errorf("[%d] Accept = %q, want the configured value over the default", i, h.Get("Accept"))
+		}
+		if _, ok := h["Sec-Fetch-User"]; ok {
+			t.Errorf("[%d] Sec-Fetch-User sent, want it dropped by its empty value", i)
+		}
+		if h.Get("Sec-Fetch-Mode") != "navigate" {
+			t.Errorf("[%d] Sec-Fetch-Mode = %q, want the default kept", i, h.Get("Sec-Fetch-Mode"))
+		}
+	}
+}
+
+func TestDetailFetcherHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><p>Cash Flow:</p><p>$120,000</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	source := &domain.Source{
+		ID:      uuid.New(),
+		BaseURL: srv.URL,
+		Config:  json.RawMessage(`{"start_path":"/search/","headers":{"DNT":"1"}}`),
+	}
+	if _, err := NewDetailFetcher().FetchDetail(context.Background(), source, srv.URL+"/listing/1"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Referer") != srv.URL+"/search/" || got.Get("DNT") != "1" || got.Get("Sec-Fetch-Dest") != "document" {
+		t.Errorf("Referer = %q, DNT = %q, Sec-Fetch-Dest = %q", got.Get("Referer"), got.Get("DNT"), got.Get("Sec-Fetch-Dest"))
+	}
+
+	// Without a source there is no search page to come from
+	if _, err := NewDetailFetcher().FetchDetail(context.Background(), nil, srv.URL+"/listing/2"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Referer") != "" || got.Get("Sec-Fetch-Site") != "none" {
+		t.Errorf("without a source Referer = %q, Sec-Fetch-Site = %q", got.Get("Referer"), got.Get("Sec-Fetch-Site"))
+	}
+}
@@ -0,0 +1,230 @@
+package sources
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// jsonLDSelector finds a page's schema.org structured data
+const jsonLDSelector = "script[type='application/ld+json']"
+
+// jsonLDListingTypes are the schema.org types read as a listing wherever they
+// appear. Inside an ItemList any element with a url and name is one.
+var jsonLDListingTypes = map[string]bool{
+	"Product":           true,
+	"IndividualProduct": true,
+	"Offer":             true,
+	"Service":           true,
+}
+
+var nonIDChars = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// parseJSONLD returns the listings in the contents of a page's JSON-LD
+// scripts: the elements of ItemLists, Products and Offers, also inside
+// arrays and @graph containers. externalID extracts the source's ID from a
+// listing URL; without one the URL itself is the ID. Scripts that aren't
+// valid JSON are skipped, and a listing appearing twice is returned once.
+func parseJSONLD(scripts []string, site siteConfig, externalID func(url string) string) []*domain.Listing {
+	p := jsonLDParser{site: site, externalID: externalID, seen: make(map[string]bool)}
+	for _, content := range scripts {
+		var data interface{}
+		if err := json.Unmarshal([]byte(content), &data); err != nil {
+			continue
+		}
+		p.walk(data, false)
+	}
+	return p.listings
+}
+
+type jsonLDParser struct {
+	site       siteConfig
+	externalID func(url string) string
+	seen       map[string]bool
+	listings   []*domain.Listing
+}
+
+// walk collects the listings in a JSON-LD node. inList is set for the
+// elements of an ItemList, which are listings whatever their type.
+func (p *jsonLDParser) walk(node interface{}, inList bool) {
+	switch v := node.(type) {
+	case []interface{}:
+		for _, item := range v {
+			p.walk(item, inList)
+		}
+	case map[string]interface{}:
+		if graph, ok := v["@graph"]; ok {
+			p.walk(graph, false)
+		}
+		types := jsonLDTypes(v)
+		switch {
+		case types["ItemList"]:
+			p.walk(v["itemListElement"], true)
+		case types["ListItem"] && v["item"] != nil:
+			// A ListItem wraps the listing, or is one itself
+			if _, ok := v["item"].(map[string]interface{}); ok {
+				p.walk(v["item"], true)
+			} else {
+				p.add(v)
+			}
+		case inList || isListingType(types):
+			p.add(v)
+		}
+	}
+}
+
+// isListingType reports whether any of a node's types is a listing type
+func isListingType(types map[string]bool) bool {
+	for t := range types {
+		if jsonLDListingTypes[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonLDTypes returns a node's @type, which may be a string or an array
+func jsonLDTypes(node map[string]interface{}) map[string]bool {
+	types := make(map[string]bool)
+	switch t := node["@type"].(type) {
+	case string:
+		types[t] = true
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok {
+				types[s] = true
+			}
+		}
+	}
+	return types
+}
+
+// add turns a node into a listing if it has a url and a title left after cleanup
+func (p *jsonLDParser) add(node map[string]interface{}) {
+	href, _ := node["url"].(string)
+	rawTitle, _ := node["name"].(string)
+	if href == "" {
+		return
+	}
+	title := p.site.cleanTitle(rawTitle)
+	if title == "" {
+		return
+	}
+
+	url := p.site.absURL(href)
+	if p.site.skips(url) {
+		return
+	}
+	externalID := p.externalID(url)
+	if externalID == "" {
+		externalID = strings.Trim(nonIDChars.ReplaceAllString(url, "-"), "-")
+	}
+	if p.seen[externalID] {
+		return
+	}
+	p.seen[externalID] = true
+
+	listing := &domain.Listing{
+		ID:         uuid.New(),
+		ExternalID: externalID,
+		URL:        url,
+		Title:      title,
+		Country:    domain.StrPtr("US"),
+		IsActive:   true,
+	}
+
+	if desc, ok := node["description"].(string); ok && strings.TrimSpace(desc) != "" {
+		desc = strings.TrimSpace(desc)
+		listing.Description = &desc
+	}
+
+	// An Offer carries its own price; a Product has it in its offers
+	offer := node
+	switch offers := node["offers"].(type) {
+	case map[string]interface{}:
+		offer = offers
+	case []interface{}:
+		if len(offers) > 0 {
+			offer, _ = offers[0].(map[string]interface{})
+		}
+	}
+	texts := make(priceTexts)
+	var currency string
+	if offer != nil {
+		if price := jsonLDAmount(offer["price"]); price > 0 {
+			listing.AskingPrice = &price
+			texts.set(finAskingPrice, jsonLDText(offer["price"]))
+		} else if low := jsonLDAmount(offer["lowPrice"]); low > 0 {
+			listing.AskingPrice = &low
+			priceText := jsonLDText(offer["lowPrice"])
+			if high := jsonLDAmount(offer["highPrice"]); high > low {
+				listing.AskingPriceMax = &high
+				priceText += " - " + jsonLDText(offer["highPrice"])
+			}
+			texts.set(finAskingPrice, priceText)
+		}
+		currency, _ = offer["priceCurrency"].(string)
+	}
+
+	rawData := map[string]interface{}{
+		"source_url": url,
+		"title":      rawTitle,
+		"scraped_at": time.Now().Format(time.RFC3339),
+		"method":     "json-ld",
+	}
+	texts.addTo(rawData)
+	if currency = strings.TrimSpace(currency); currency != "" {
+		rawData["currency"] = currency
+	}
+	if jsonBytes, err := json.Marshal(rawData); err == nil {
+		listing.RawData = jsonBytes
+	}
+
+	p.listings = append(p.listings, listing)
+}
+
+// jsonLDAmount parses a schema.org price, a number or a string such as
+// "450000.00" or "$1.2M", in cents
+func jsonLDAmount(v interface{}) int64 {
+	switch amount := v.(type) {
+	case float64:
+		return toCents(amount)
+	case string:
+		return parsePrice(amount)
+	}
+	return 0
+}
+
+// jsonLDText is a schema.org price as written: a string as is, a number
+// without trailing zeros
+func jsonLDText(v interface{}) string {
+	switch amount := v.(type) {
+	case float64:
+		return strconv.FormatFloat(amount, 'f', -1, 64)
+	case string:
+		return amount
+	}
+	return ""
+}
+
+// pageJSONLD returns the contents of a colly page's JSON-LD scripts if none
+// of cardSelectors match on it, so structured data only stands in for cards
+// the selectors miss
+func pageJSONLD(e *colly.HTMLElement, cardSelectors []string) []string {
+	if e.DOM.Find(strings.Join(cardSelectors, ", ")).Length() > 0 {
+		return nil
+	}
+	var scripts []string
+	e.DOM.Find(jsonLDSelector).Each(func(_ int, s *goquery.Selection) {
+		scripts = append(scripts, s.Text())
+	})
+	return scripts
+}
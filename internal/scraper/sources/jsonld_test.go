@@ -0,0 +1,167 @@
+package sources
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestParseJSONLD(t *testing.T) {
+	site := newSite("https://www.bizbuysell.com", "/", nil).forRun(domain.ScrapeOptions{})
+
+	tests := []struct {
+		name    string
+		scripts []string
+		want    []fixtureListing
+	}{
+		{
+			name: "item list",
+			scripts: []string{`{
+				"@context": "https://schema.org",
+				"@type": "ItemList",
+				"itemListElement": [
+					{"@type": "ListItem", "position": 1, "item": {
+						"@type": "Product",
+						"name": "For Sale: Established Coffee Shop",
+						"url": "/Business-Opportunity/established-coffee-shop-2214567.aspx",
+						"offers": {"@type": "Offer", "price": 450000, "priceCurrency": "USD"}
+					}},
+					{"@type": "ListItem", "position": 2,
+						"name": "Profitable HVAC Company", "url": "https://www.bizbuysell.com/Business-Opportunity/hvac/listing-2230981"}
+				]
+			}`},
+			want: []fixtureListing{
+				{externalID: "2214567", path: "/Business-Opportunity/established-coffee-shop-2214567.aspx", title: "Established Coffee Shop", price: 45000000},
+				{externalID: "2230981", path: "/Business-Opportunity/hvac/listing-2230981", title: "Profitable HVAC Company"},
+			},
+		},
+		{
+			name: "product",
+			scripts: []string{`{
+				"@context": "https://schema.org",
+				"@type": "Product",
+				"name": "Auto Repair Shop",
+				"url": "https://www.bizbuysell.com/Business-Opportunity/auto-repair/listing-445566",
+				"description": "Six bays, long-term lease",
+				"offers": [{"@type": "AggregateOffer", "lowPrice": "250000", "highPrice": "$300,000"}]
+			}`},
+			want: []fixtureListing{
+				{externalID: "445566", path: "/Business-Opportunity/auto-repair/listing-445566", title: "Auto Repair Shop", price: 25000000},
+			},
+		},
+		{
+			name: "graph",
+			scripts: []string{`{
+				"@context": "https://schema.org",
+				"@graph": [
+					{"@type": "WebSite", "name": "BizBuySell", "url": "https://www.bizbuysell.com/"},
+					{"@type": "BreadcrumbList", "itemListElement": []},
+					{"@type": ["Product", "Thing"], "name": "Bagel Bakery", "url": "/Business-Opportunity/bagel-bakery/listing-30477",
+						"offers": {"price": "185000.00"}},
+					{"@type": "ItemList", "itemListElement": [
+						{"@type": "Offer", "name": "Pet Grooming Salon", "url": "/Business-Opportunity/pet-grooming/listing-51234", "price": 165000}
+					]}
+				]
+			}`},
+			want: []fixtureListing{
+				{externalID: "30477", path: "/Business-Opportunity/bagel-bakery/listing-30477", title: "Bagel Bakery", price: 18500000},
+				{externalID: "51234", path: "/Business-Opportunity/pet-grooming/listing-51234", title: "Pet Grooming Salon", price: 16500000},
+			},
+		},
+		{
+			name: "invalid and repeated",
+			scripts: []string{
+				`{not json`,
+				`[{"@type": "Product", "name": "Dry Cleaner", "url": "/Business-Opportunity/dry-cleaner/listing-445601"}]`,
+				`{"@type": "Product", "name": "Dry Cleaner", "url": "/Business-Opportunity/dry-cleaner/listing-445601"}`,
+				`{"@type": "Product", "name": "Confidential", "url": "/Business-Opportunity/confidential/listing-445602"}`,
+				`{"@type": "Organization", "name": "BizBuySell", "url": "https://www.bizbuysell.com/"}`,
+			},
+			want: []fixtureListing{
+				{externalID: "445601", path: "/Business-Opportunity/dry-cleaner/listing-445601", title: "Dry Cleaner"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseJSONLD(tt.scripts, site, extractBizBuySellID)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parsed %d listings, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				l := got[i]
+				if l.ExternalID != want.externalID {
+					t.Errorf("[%d] external ID = %q, want %q", i, l.ExternalID, want.externalID)
+				}
+				if l.URL != "https://www.bizbuysell.com"+want.path {
+					t.Errorf("[%d] URL = %q, want %q", i, l.URL, want.path)
+				}
+				if l.Title != want.title {
+					t.Errorf("[%d] title = %q, want %q", i, l.Title, want.title)
+				}
+				if want.price == 0 && l.AskingPrice != nil {
+					t.Errorf("[%d] asking price = %d, want none", i, *l.AskingPrice)
+				}
+				if want.price != 0 && (l.AskingPrice == nil || *l.AskingPrice != want.price) {
+					t.Errorf("[%d] asking price = %v, want %d", i, l.AskingPrice, want.price)
+				}
+			}
+		})
+	}
+}
+
+func TestParseJSONLDPriceText(t *testing.T) {
+	site := newSite("https://www.bizbuysell.com", "/", nil).forRun(domain.ScrapeOptions{})
+	got := parseJSONLD([]string{`[
+		{"@type": "Product", "name": "Coffee Shop", "url": "/listing-1",
+			"offers": {"price": 450000, "priceCurrency": "CAD"}},
+		{"@type": "Offer", "name": "Marina", "url": "/listing-2", "lowPrice": "$1.2M", "highPrice": "$1.5M"}
+	]`}, site, extractBizBuySellID)
+	if len(got) != 2 {
+		t.Fatalf("parsed %d listings, want 2", len(got))
+	}
+
+	want := []map[string]interface{}{
+		{"price_text": "450000", "currency": "CAD"},
+		{"price_text": "$1.2M - $1.5M", "currency": nil},
+	}
+	for i, l := range got {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(l.RawData, &raw); err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range want[i] {
+			if raw[key] != value {
+				t.Errorf("[%d] raw_data %s = %v, want %v", i, key, raw[key], value)
+			}
+		}
+	}
+}
+
+func TestParseJSONLDFallbackID(t *testing.T) {
+	site := newSite("https://example.com", "/", nil).forRun(domain.ScrapeOptions{})
+	got := parseJSONLD([]string{`{"@type": "Product", "name": "Marina", "url": "/businesses/marina"}`}, site, extractBizBuySellID)
+	if len(got) != 1 {
+		t.Fatalf("parsed %d listings, want 1", len(got))
+	}
+	if got[0].ExternalID != "https-example-com-businesses-marina" {
+		t.Errorf("external ID = %q", got[0].ExternalID)
+	}
+}
+
+func TestCollyScraperJSONLD(t *testing.T) {
+	got, baseURL := scrapeFixture(t, "bizquest_jsonld.html", func(baseURL string) fixtureScraper {
+		return NewBizQuestScraper(nil, WithBaseURL(baseURL))
+	})
+	if len(got) != 2 {
+		t.Fatalf("scraped %d listings, want 2", len(got))
+	}
+	if got[0].ExternalID != "1789012" || got[0].URL != baseURL+"/business-for-sale/detail/1789012/" {
+		t.Errorf("[0] = %s %s", got[0].ExternalID, got[0].URL)
+	}
+	if got[1].Title != "Landscaping Business with Equipment" || got[1].AskingPrice == nil || *got[1].AskingPrice != 61000000 {
+		t.Errorf("[1] = %q %v", got[1].Title, got[1].AskingPrice)
+	}
+}
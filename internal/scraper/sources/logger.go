@@ -0,0 +1,11 @@
+package sources
+
+import "log/slog"
+
+// scraperLogger tags a scraper's logs with its source. A nil logger uses slog.Default().
+func scraperLogger(logger *slog.Logger, source string) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("source", source)
+}
@@ -0,0 +1,67 @@
+package sources
+
+import (
+	"strings"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// priceTextKeys are the raw_data keys of the original text of each financial
+// field, e.g. "price_text": "$1.2M"
+var priceTextKeys = map[string]string{
+	finAskingPrice: "price_text",
+	finRevenue:     "revenue_text",
+	finCashFlow:    "cashflow_text",
+	finEBITDA:      "ebitda_text",
+	finInventory:   "inventory_text",
+}
+
+// priceTexts holds the text each financial figure of a listing was parsed
+// from, keyed by raw_data key. Kept in raw_data, it lets parsePrice be audited
+// against the source and listings be reparsed without scraping them again.
+type priceTexts map[string]string
+
+// set records text as the original of field, replacing any earlier text.
+// Blank text is ignored.
+func (p priceTexts) set(field, text string) {
+	if text = strings.TrimSpace(text); text != "" {
+		p[priceTextKeys[field]] = text
+	}
+}
+
+// setPriceRange records text as the original of field and parses it as
+// setPriceRange does. Text that doesn't parse is still recorded, so
+// mis-parses show up in raw_data.
+func (p priceTexts) setPriceRange(field, text string, low, high **int64) bool {
+	p.set(field, text)
+	return setPriceRange(text, low, high)
+}
+
+// setAskingPrice records text as the original asking price and parses it
+// into the listing's asking price. Text withholding the price, such as "Call
+// for price", marks the listing PriceOnRequest instead; a price found later
+// clears it. Reports whether a price was found.
+func (p priceTexts) setAskingPrice(listing *domain.Listing, text string) bool {
+	if p.setPriceRange(finAskingPrice, text, &listing.AskingPrice, &listing.AskingPriceMax) {
+		listing.PriceOnRequest = false
+		return true
+	}
+	if _, _, onRequest := parsePriceRange(text); onRequest {
+		listing.PriceOnRequest = true
+	}
+	return false
+}
+
+// merge records every text of other, replacing those of the same fields
+func (p priceTexts) merge(other priceTexts) {
+	for key, text := range other {
+		p[key] = text
+	}
+}
+
+// addTo copies the texts into a listing's raw data
+func (p priceTexts) addTo(rawData map[string]interface{}) {
+	for key, text := range p {
+		rawData[key] = text
+	}
+}
@@ -0,0 +1,183 @@
+package sources
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// siteConfig is where a scraper starts crawling and how it resolves relative
+// links. Options override the built-in defaults, e.g. to point a scraper at a
+// fixture server in tests, and the source row overrides both for each run.
+type siteConfig struct {
+	baseURL   string
+	startPath string
+	// blockSignatures are the source's block page signatures, nil for the defaults
+	blockSignatures []string
+	// waitSelector matches the content rod scrapers wait for after loading a
+	// page, for up to waitTimeout
+	waitSelector string
+	waitTimeout  time.Duration
+	// titleRules strip boilerplate from listing titles, nil for the defaults
+	titleRules titleRules
+	// skipPatterns match URLs not to follow or keep listings for
+	skipPatterns []*regexp.Regexp
+	// headers are the source's configured request headers
+	headers map[string]string
+}
+
+// defaultWaitTimeout is how long rod scrapers wait for a page's content
+// unless the source's config sets wait_timeout_seconds
+const defaultWaitTimeout = 15 * time.Second
+
+// Option configures a scraper
+type Option func(*siteConfig)
+
+// WithBaseURL overrides the scheme and host a scraper crawls, e.g. "http://127.0.0.1:8080"
+func WithBaseURL(baseURL string) Option {
+	return func(s *siteConfig) {
+		s.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithStartPath overrides the path of the first search results page
+func WithStartPath(path string) Option {
+	return func(s *siteConfig) {
+		s.startPath = path
+	}
+}
+
+func newSite(baseURL, startPath string, opts []Option) siteConfig {
+	s := siteConfig{baseURL: baseURL, startPath: startPath, waitTimeout: defaultWaitTimeout}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// forRun applies the base URL, start path, block signatures, content wait,
+// title rules, skip patterns and headers from the source row, when set
+func (s siteConfig) forRun(opts domain.ScrapeOptions) siteConfig {
+	if opts.BaseURL != "" {
+		s.baseURL = strings.TrimRight(opts.BaseURL, "/")
+	}
+	if opts.StartPath != "" {
+		s.startPath = opts.StartPath
+	}
+	// The engine has already rejected runs with an invalid config
+	cfg, err := domain.ParseSourceConfig(opts.SourceConfig)
+	if err != nil {
+		return s
+	}
+	if len(cfg.BlockSignatures) > 0 {
+		s.blockSignatures = cfg.BlockSignatures
+	}
+	if cfg.WaitSelector != "" {
+		s.waitSelector = cfg.WaitSelector
+	}
+	if cfg.WaitTimeoutSeconds > 0 {
+		s.waitTimeout = time.Duration(cfg.WaitTimeoutSeconds) * time.Second
+	}
+	if len(cfg.TitleRules) > 0 {
+		s.titleRules = append(defaultTitles[:len(defaultTitles):len(defaultTitles)], compileTitleRules(cfg.TitleRules)...)
+	}
+	s.headers = cfg.Headers
+	s.skipPatterns = nil
+	for _, p := range cfg.SkipPatterns {
+		s.skipPatterns = append(s.skipPatterns, regexp.MustCompile("(?i)"+p)) // validated by ParseSourceConfig
+	}
+	return s
+}
+
+// shouldSkipURL reports whether url matches any of patterns
+func shouldSkipURL(url string, patterns []*regexp.Regexp) bool {
+	for _, p := range patterns {
+		if p.MatchString(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// skips reports whether the source's skip_patterns exclude url, which should
+// be absolute
+func (s siteConfig) skips(url string) bool {
+	return shouldSkipURL(url, s.skipPatterns)
+}
+
+// cleanTitle strips boilerplate from a scraped title with the default rules
+// and the source's own
+func (s siteConfig) cleanTitle(raw string) string {
+	if s.titleRules == nil {
+		return cleanTitle(raw)
+	}
+	return s.titleRules.clean(raw)
+}
+
+func (s siteConfig) startURL() string {
+	return s.baseURL + s.startPath
+}
+
+// pageURL returns search results page n, numbered from 1, as the start path
+// followed by "n/", keeping any query string: "/for-sale/?industry=cafes"
+// page 2 is "/for-sale/2/?industry=cafes"
+func (s siteConfig) pageURL(n int) string {
+	start := s.startURL()
+	if n <= 1 {
+		return start
+	}
+	u, err := url.Parse(start)
+	if err != nil {
+		return start + strconv.Itoa(n) + "/"
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.Path += strconv.Itoa(n) + "/"
+	u.RawPath = ""
+	return u.String()
+}
+
+// host returns the base URL's host without port or leading "www."
+func (s siteConfig) host() string {
+	u, err := url.Parse(s.baseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// allowedDomains returns the host with and without "www."
+func (s siteConfig) allowedDomains() []string {
+	host := s.host()
+	return []string{"www." + host, host}
+}
+
+// domainGlob matches the host for colly's rate limit rule
+func (s siteConfig) domainGlob() string {
+	return "*" + s.host() + "*"
+}
+
+// absURL resolves a site-relative link against the base URL
+func (s siteConfig) absURL(link string) string {
+	if strings.HasPrefix(link, "http") {
+		return link
+	}
+	return s.baseURL + link
+}
+
+// maxFollowedPages returns how many pagination links a crawl may follow after
+// the start page: enough for MaxListings at 20 per page, or 50
+func maxFollowedPages(opts domain.ScrapeOptions) int {
+	if opts.MaxPages > 0 {
+		return opts.MaxPages - 1
+	}
+	if opts.MaxListings > 0 {
+		return (opts.MaxListings / 20) + 1
+	}
+	return 50
+}
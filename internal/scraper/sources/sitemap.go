@@ -0,0 +1,353 @@
+package sources
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/uuid"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+const (
+	// sitemapMaxDepth bounds how deeply sitemap indexes are followed
+	sitemapMaxDepth = 3
+	// sitemapMaxBytes caps a single (decompressed) sitemap; the protocol allows 50MB
+	sitemapMaxBytes = 50 << 20
+)
+
+// SitemapScraper discovers listings from a source's sitemap instead of its search
+// pages, following sitemap indexes, and parses each listing's detail page with the
+// same labelled-value rules as enrichment. Sources opt in with crawl_strategy
+// "sitemap"; the sitemap path and listing URL pattern come from the source config.
+type SitemapScraper struct {
+	logger *slog.Logger
+	client *http.Client
+}
+
+func NewSitemapScraper(logger *slog.Logger) *SitemapScraper {
+	return &SitemapScraper{
+		logger: scraperLogger(logger, "sitemap"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *SitemapScraper) Name() string {
+	return "sitemap"
+}
+
+func (s *SitemapScraper) Version() int {
+	return sitemapVersion
+}
+
+// sitemapDoc decodes both a <urlset> and a <sitemapindex>
+type sitemapDoc struct {
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// sitemapListing is a listing URL from the sitemap and its lastmod, zero if absent
+type sitemapListing struct {
+	url     string
+	lastMod time.Time
+}
+
+// Scrape reads the sitemap, then fetches the matching listing pages in sitemap
+// order. Incremental runs skip listings that haven't changed (see shouldFetch).
+func (s *SitemapScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
+	listings := make(chan *domain.Listing, 100)
+	errors := make(chan error, 10)
+
+	go func() {
+		defer close(listings)
+		defer close(errors)
+
+		cfg, err := domain.ParseSourceConfig(opts.SourceConfig)
+		if err != nil {
+			errors <- err
+			return
+		}
+		if cfg.Sitemap == nil || opts.BaseURL == "" {
+			errors <- fmt.Errorf("sitemap: source needs a base_url and a sitemap config")
+			return
+		}
+		pattern := regexp.MustCompile(cfg.Sitemap.ListingPattern) // validated by ParseSourceConfig
+
+		site := newSite(strings.TrimRight(opts.BaseURL, "/"), "", nil).forRun(opts)
+		f := &sitemapFetcher{pageFetcher{
+			source: s.Name(), client: s.client, logger: s.logger,
+			opts: opts, errors: errors, maxBytes: sitemapMaxBytes, headers: site.headers,
+		}}
+
+		// Child sitemaps unchanged since the last run are skipped. Their
+		// entries are only skipped by lastmod if there are no known listings to
+		// compare each one with, so shouldFetch decides per listing and those it
+		// skips are reported unchanged.
+		var sitemapsSince, entriesSince time.Time
+		if !opts.FullScrape {
+			sitemapsSince = opts.LastScrapeAt
+			if opts.KnownListings == nil {
+				entriesSince = opts.LastScrapeAt
+			}
+		}
+		entries := f.listingURLs(ctx, site.absURL(cfg.Sitemap.SitemapPath()), pattern, sitemapsSince, entriesSince)
+		s.logger.Info("sitemap read", "listings", len(entries))
+
+		count, unchanged := 0, 0
+		for _, entry := range entries {
+			if ctx.Err() != nil || (opts.MaxListings > 0 && count >= opts.MaxListings) {
+				break
+			}
+
+			if site.skips(entry.url) {
+				continue
+			}
+			externalID := sitemapExternalID(entry.url, pattern)
+			if !opts.FullScrape && opts.KnownListings != nil {
+				known, ok := opts.KnownListings[externalID]
+				if ok && !shouldFetch(entry.lastMod, known) {
+					opts.Unchanged(externalID)
+					unchanged++
+					continue
+				}
+			}
+
+			listing, err := f.listing(ctx, entry.url, pattern, site)
+			if err != nil {
+				f.sendError(err)
+				continue
+			}
+			if !entry.lastMod.IsZero() {
+				listing.SitemapLastMod = &entry.lastMod
+			}
+			select {
+			case listings <- listing:
+				count++
+				if count%10 == 0 {
+					s.logger.Debug("scraped listings", "count", count)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+		if unchanged > 0 {
+			s.logger.Info("skipped unchanged listings", "count", unchanged)
+		}
+	}()
+
+	return listings, errors
+}
+
+// shouldFetch decides whether an incremental run re-fetches a listing it has
+// seen before. A lastmod no newer than the one the listing was last fetched at,
+// or older than when it was last seen, means it hasn't changed. Entries
+// without a lastmod are always fetched.
+func shouldFetch(lastMod time.Time, known domain.ListingFreshness) bool {
+	if lastMod.IsZero() {
+		return true
+	}
+	if known.SitemapLastMod != nil {
+		return lastMod.After(*known.SitemapLastMod)
+	}
+	return !lastMod.Before(known.LastSeenAt)
+}
+
+// sitemapFetcher fetches one run's sitemaps and listing pages
+type sitemapFetcher struct {
+	pageFetcher
+}
+
+// listingURLs returns the listing URLs in the sitemap at url, following
+// indexes, deduplicated and in document order. Child sitemaps whose lastmod is
+// before sitemapsSince, and entries whose lastmod is before entriesSince, are
+// left out.
+func (f *sitemapFetcher) listingURLs(ctx context.Context, url string, pattern *regexp.Regexp, sitemapsSince, entriesSince time.Time) []sitemapListing {
+	var entries []sitemapListing
+	seen := make(map[string]bool)
+
+	var walk func(url string, depth int)
+	walk = func(url string, depth int) {
+		if seen[url] || ctx.Err() != nil {
+			return
+		}
+		seen[url] = true
+
+		body, err := f.fetch(ctx, url)
+		if err != nil {
+			f.sendError(err)
+			return
+		}
+		doc, err := decodeSitemap(body)
+		if err != nil {
+			f.sendError(fmt.Errorf("sitemap %s: %w", url, err))
+			return
+		}
+
+		for _, entry := range doc.URLs {
+			loc := strings.TrimSpace(entry.Loc)
+			if seen[loc] || !pattern.MatchString(loc) || !modifiedSince(entry.LastMod, entriesSince) {
+				continue
+			}
+			seen[loc] = true
+			lastMod, _ := parseLastMod(entry.LastMod)
+			entries = append(entries, sitemapListing{url: loc, lastMod: lastMod})
+		}
+
+		if depth >= sitemapMaxDepth {
+			if len(doc.Sitemaps) > 0 {
+				f.logger.Warn("sitemap index nested too deeply, skipping children", "url", url)
+			}
+			return
+		}
+		for _, entry := range doc.Sitemaps {
+			if modifiedSince(entry.LastMod, sitemapsSince) {
+				walk(strings.TrimSpace(entry.Loc), depth+1)
+			}
+		}
+	}
+
+	walk(url, 0)
+	return entries
+}
+
+// listing fetches and parses a listing's detail page
+func (f *sitemapFetcher) listing(ctx context.Context, url string, pattern *regexp.Regexp, site siteConfig) (*domain.Listing, error) {
+	body, err := f.fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", url, err)
+	}
+	return parseSitemapListing(doc, url, pattern, site)
+}
+
+// decodeSitemap parses a sitemap or sitemap index, gunzipping it if needed
+func decodeSitemap(body []byte) (*sitemapDoc, error) {
+	// Gzipped sitemaps start with the gzip magic number whatever they're called
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		if body, err = io.ReadAll(io.LimitReader(zr, sitemapMaxBytes)); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc sitemapDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// sitemapDateLayouts are the W3C datetime forms allowed in <lastmod>
+var sitemapDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
+// parseLastMod parses a <lastmod>, reporting false if it is missing or malformed
+func parseLastMod(lastMod string) (time.Time, bool) {
+	lastMod = strings.TrimSpace(lastMod)
+	for _, layout := range sitemapDateLayouts {
+		if t, err := time.Parse(layout, lastMod); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// modifiedSince reports whether a <lastmod> is at or after since. A missing or
+// malformed lastmod, or a zero since, always counts as modified.
+func modifiedSince(lastMod string, since time.Time) bool {
+	if since.IsZero() {
+		return true
+	}
+	t, ok := parseLastMod(lastMod)
+	return !ok || !t.Before(since)
+}
+
+// parseSitemapListing builds a listing from a detail page. The external ID is
+// the pattern's first capture group, or the URL path without one.
+func parseSitemapListing(doc *goquery.Document, url string, pattern *regexp.Regexp, site siteConfig) (*domain.Listing, error) {
+	rawTitle := strings.TrimSpace(doc.Find("h1").First().Text())
+	if rawTitle == "" {
+		rawTitle = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+	title := site.cleanTitle(rawTitle)
+	if title == "" {
+		return nil, fmt.Errorf("no title on listing page %s", url)
+	}
+
+	externalID := sitemapExternalID(url, pattern)
+	if externalID == "" {
+		return nil, fmt.Errorf("no external ID in listing URL %s", url)
+	}
+
+	listing, texts := parseDetail(pageText(doc.Selection))
+	listing.ID = uuid.New()
+	listing.ExternalID = externalID
+	listing.URL = url
+	listing.Title = title
+	listing.Country = domain.StrPtr("US")
+	listing.IsActive = true
+
+	// The first location on the page is the listing's own
+	if len(listing.Locations) > 0 {
+		listing.City = listing.Locations[0].City
+		listing.State = listing.Locations[0].State
+		listing.ZipCode = listing.Locations[0].ZipCode
+	}
+	listing.Locations = nil
+
+	if desc, ok := doc.Find(`meta[name="description"]`).Attr("content"); ok && strings.TrimSpace(desc) != "" {
+		desc = strings.TrimSpace(desc)
+		listing.Description = &desc
+	}
+
+	rawData := map[string]interface{}{
+		"source_url": url,
+		"title":      rawTitle,
+		"discovery":  domain.CrawlStrategySitemap,
+		"scraped_at": time.Now().Format(time.RFC3339),
+	}
+	texts.addTo(rawData)
+	if jsonBytes, err := json.Marshal(rawData); err == nil {
+		listing.RawData = jsonBytes
+	}
+
+	return listing, nil
+}
+
+func sitemapExternalID(link string, pattern *regexp.Regexp) string {
+	if m := pattern.FindStringSubmatch(link); len(m) >= 2 {
+		return m[1]
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(u.Path, "/")
+}
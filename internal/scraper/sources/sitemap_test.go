@@ -0,0 +1,288 @@
+package sources
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// sitemapServer serves a sitemap index pointing at a plain and a gzipped
+// sitemap, and the same listing page for every /listing/ path
+func sitemapServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var paths []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+
+		base := srv.URL
+		switch {
+		case r.URL.Path == "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%[1]s/sitemaps/listings-1.xml</loc><lastmod>2024-05-01</lastmod></sitemap>
+  <sitemap><loc>%[1]s/sitemaps/listings-2.xml.gz</loc><lastmod>2024-05-09T08:00:00Z</lastmod></sitemap>
+</sitemapindex>`, base)
+		case r.URL.Path == "/sitemaps/listings-1.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/listing/1001/harbor-marina</loc><lastmod>2024-04-20</lastmod></url>
+  <url><loc>%[1]s/about-us</loc></url>
+  <url><loc>%[1]s/listing/1002/bakery</loc><lastmod>2024-05-01</lastmod></url>
+</urlset>`, base)
+		case r.URL.Path == "/sitemaps/listings-2.xml.gz":
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			fmt.Fprintf(zw, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/listing/1003/car-wash</loc><lastmod>2024-05-09T08:00:00+00:00</lastmod></url>
+  <url><loc>%[1]s/listing/1001/harbor-marina</loc><lastmod>2024-04-20</lastmod></url>
+</urlset>`, base)
+			zw.Close()
+			w.Write(buf.Bytes())
+		case strings.HasPrefix(r.URL.Path, "/listing/"):
+			http.ServeFile(w, r, filepath.Join("testdata", "sitemap_listing.html"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &paths
+}
+
+func scrapeSitemap(t *testing.T, opts domain.ScrapeOptions) []*domain.Listing {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	listingsCh, errCh := NewSitemapScraper(nil).Scrape(ctx, opts)
+
+	var listings []*domain.Listing
+	for l := range listingsCh {
+		listings = append(listings, l)
+	}
+	for err := range errCh {
+		t.Errorf("scrape error: %v", err)
+	}
+
+	sort.Slice(listings, func(i, j int) bool {
+		return listings[i].ExternalID < listings[j].ExternalID
+	})
+	return listings
+}
+
+const sitemapTestConfig = `{"crawl_strategy":"sitemap","sitemap":{"listing_pattern":"/listing/(\\d+)/"}}`
+
+func TestSitemapScraper(t *testing.T) {
+	srv, paths := sitemapServer(t)
+
+	var recorded []string
+	got := scrapeSitemap(t, domain.ScrapeOptions{
+		FullScrape:    true,
+		BaseURL:       srv.URL,
+		SourceConfig:  json.RawMessage(sitemapTestConfig),
+		RecordRequest: func(url string, status int, err error) { recorded = append(recorded, url) },
+	})
+
+	var ids []string
+	for _, l := range got {
+		ids = append(ids, l.ExternalID)
+	}
+	if want := "1001,1002,1003"; strings.Join(ids, ",") != want {
+		t.Fatalf("external IDs = %v, want %s", ids, want)
+	}
+
+	l := got[0]
+	if l.URL != srv.URL+"/listing/1001/harbor-marina" {
+		t.Errorf("URL = %q", l.URL)
+	}
+	if l.Title != "Harbor Marina & Boat Storage" {
+		t.Errorf("title = %q", l.Title)
+	}
+	if l.AskingPrice == nil || *l.AskingPrice != 215000000 {
+		t.Errorf("asking price = %v, want 215000000", l.AskingPrice)
+	}
+	if l.CashFlow == nil || *l.CashFlow != 41000000 {
+		t.Errorf("cash flow = %v, want 41000000", l.CashFlow)
+	}
+	if l.City == nil || *l.City != "Annapolis" || l.State == nil || *l.State != "MD" {
+		t.Errorf("location = %v, %v; want Annapolis, MD", l.City, l.State)
+	}
+	if l.Description == nil || !strings.HasPrefix(*l.Description, "Full-service marina") {
+		t.Errorf("description = %v", l.Description)
+	}
+
+	// Index, two sitemaps and three listing pages; the duplicate isn't fetched twice
+	if len(*paths) != 6 {
+		t.Errorf("fetched %v, want 6 pages", *paths)
+	}
+	if len(recorded) != len(*paths) {
+		t.Errorf("recorded %d requests, want %d", len(recorded), len(*paths))
+	}
+}
+
+func TestSitemapScraperIncremental(t *testing.T) {
+	srv, paths := sitemapServer(t)
+
+	got := scrapeSitemap(t, domain.ScrapeOptions{
+		LastScrapeAt: time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC),
+		BaseURL:      srv.URL,
+		SourceConfig: json.RawMessage(sitemapTestConfig),
+	})
+
+	if len(got) != 1 || got[0].ExternalID != "1003" {
+		t.Fatalf("scraped %v, want only the listing modified since the last scrape", got)
+	}
+	// listings-1.xml wasn't modified since the last scrape, so it isn't fetched
+	for _, p := range *paths {
+		if p == "/sitemaps/listings-1.xml" {
+			t.Error("fetched a sitemap unchanged since the last scrape")
+		}
+	}
+}
+
+func TestModifiedSince(t *testing.T) {
+	since := time.Date(2024, 5, 5, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		lastMod string
+		want    bool
+	}{
+		{"2024-05-06", true},
+		{"2024-05-04", false},
+		{"2024-05-05T13:00:00Z", true},
+		{"2024-05-05T11:59+00:00", false},
+		{"", true},
+		{"last tuesday", true},
+	}
+
+	for _, tt := range tests {
+		if got := modifiedSince(tt.lastMod, since); got != tt.want {
+			t.Errorf("modifiedSince(%q) = %v, want %v", tt.lastMod, got, tt.want)
+		}
+	}
+	if !modifiedSince("2001-01-01", time.Time{}) {
+		t.Error("a zero since should match every lastmod")
+	}
+}
+
+func TestShouldFetch(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name    string
+		lastMod time.Time
+		known   domain.ListingFreshness
+		want    bool
+	}{
+		{"no lastmod", time.Time{}, domain.ListingFreshness{LastSeenAt: day(10)}, true},
+		{"changed since stored lastmod", day(5), domain.ListingFreshness{LastSeenAt: day(10), SitemapLastMod: domain.Ptr(day(4))}, true},
+		{"same as stored lastmod", day(4), domain.ListingFreshness{LastSeenAt: day(10), SitemapLastMod: domain.Ptr(day(4))}, false},
+		// The stored lastmod wins over last seen, which a search crawl may have bumped
+		{"older than stored lastmod", day(3), domain.ListingFreshness{LastSeenAt: day(1), SitemapLastMod: domain.Ptr(day(4))}, false},
+		{"newer than last seen, none stored", day(11), domain.ListingFreshness{LastSeenAt: day(10)}, true},
+		{"older than last seen, none stored", day(9), domain.ListingFreshness{LastSeenAt: day(10)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldFetch(tt.lastMod, tt.known); got != tt.want {
+				t.Errorf("shouldFetch = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSitemapScraperSkipsUnchanged(t *testing.T) {
+	srv, paths := sitemapServer(t)
+
+	var unchanged []string
+	got := scrapeSitemap(t, domain.ScrapeOptions{
+		BaseURL:      srv.URL,
+		SourceConfig: json.RawMessage(sitemapTestConfig),
+		KnownListings: map[string]domain.ListingFreshness{
+			// Unchanged: lastmod 2024-04-20 matches the stored one
+			"1001": {LastSeenAt: time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC), SitemapLastMod: domain.Ptr(time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC))},
+			// Changed: lastmod 2024-05-01 is after it was last seen
+			"1002": {LastSeenAt: time.Date(2024, 4, 25, 0, 0, 0, 0, time.UTC)},
+		},
+		MarkUnchanged: func(externalID string) { unchanged = append(unchanged, externalID) },
+	})
+
+	var ids []string
+	for _, l := range got {
+		ids = append(ids, l.ExternalID)
+	}
+	if want := "1002,1003"; strings.Join(ids, ",") != want {
+		t.Fatalf("external IDs = %v, want %s", ids, want)
+	}
+	if len(unchanged) != 1 || unchanged[0] != "1001" {
+		t.Errorf("unchanged = %v, want [1001]", unchanged)
+	}
+	for _, p := range *paths {
+		if strings.HasPrefix(p, "/listing/1001/") {
+			t.Error("fetched the unchanged listing")
+		}
+	}
+
+	// The lastmod is kept for the next run to compare against
+	if want := time.Date(2024, 5, 9, 8, 0, 0, 0, time.UTC); got[1].SitemapLastMod == nil || !got[1].SitemapLastMod.Equal(want) {
+		t.Errorf("SitemapLastMod = %v, want %v", got[1].SitemapLastMod, want)
+	}
+}
+
+func TestSitemapScraperKnownListingsIgnoreLastScrape(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/listing/2001/laundromat</loc><lastmod>2024-04-20</lastmod></url>
+  <url><loc>%[1]s/listing/2002/deli</loc><lastmod>2024-04-20</lastmod></url>
+</urlset>`, srv.URL)
+		case strings.HasPrefix(r.URL.Path, "/listing/"):
+			http.ServeFile(w, r, filepath.Join("testdata", "sitemap_listing.html"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	var unchanged []string
+	got := scrapeSitemap(t, domain.ScrapeOptions{
+		// Both lastmods are before the last scrape
+		LastScrapeAt: time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC),
+		BaseURL:      srv.URL,
+		SourceConfig: json.RawMessage(sitemapTestConfig),
+		// 2002 isn't stored, e.g. its fetch failed last time
+		KnownListings: map[string]domain.ListingFreshness{
+			"2001": {LastSeenAt: time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)},
+		},
+		MarkUnchanged: func(externalID string) { unchanged = append(unchanged, externalID) },
+	})
+
+	if len(got) != 1 || got[0].ExternalID != "2002" {
+		t.Fatalf("scraped %v, want only the listing that isn't stored", got)
+	}
+	if len(unchanged) != 1 || unchanged[0] != "2001" {
+		t.Errorf("unchanged = %v, want [2001] so it stays fresh", unchanged)
+	}
+}
@@ -0,0 +1,80 @@
+package sources
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+// defaultTitleRules are case-insensitive regexps matching boilerplate brokers
+// put around listing titles. Matches are removed, so each rule includes the
+// separator that went with the text.
+var defaultTitleRules = []string{
+	// "For Sale:", "Business for Sale -", "Company For Sale |"
+	`^(?:(?:business|company)\s+)?for\s+sale\s*[:|–—-]\s*`,
+	// "New Listing!", "Price Reduced -", "Just Listed:"
+	`^(?:new\s+listing|just\s+listed|(?:price\s+)?reduced)\s*[:!|–—-]\s*`,
+	// "Confidential - ...", "Confidential Listing: ..."
+	`^confidential\b(?:\s+listing\b)?\s*[:|–—-]?\s*`,
+	// "(Confidential)", "[Confidential]" anywhere, "- Confidential" at the end
+	`\s*[(\[]\s*confidential\s*[)\]]`,
+	`\s+[:|–—-]\s*confidential$`,
+	// "... - For Sale", "... Business for Sale"
+	`\s*(?:[:|–—-]\s*)?(?:business\s+)?for\s+sale$`,
+	// A trailing city and state code: "... - Dallas, TX", "... in Fort Worth, TX 76102",
+	// "..., Austin, TX", "... (Plano, TX)"
+	`(?:\s+[|–—-]\s+|\s*,\s*|\s+(?:in|near)\s+)[a-z][a-z .']*,\s*(?-i:[A-Z]{2})(?:\s+\d{5})?$`,
+	`\s*\(\s*[a-z][a-z .']*,\s*(?-i:[A-Z]{2})(?:\s+\d{5})?\s*\)$`,
+}
+
+// titleRules are compiled title cleanup rules
+type titleRules []*regexp.Regexp
+
+// compileTitleRules compiles case-insensitive rule patterns, which must be
+// valid; source config rules are checked by domain.ParseSourceConfig
+func compileTitleRules(patterns []string) titleRules {
+	rules := make(titleRules, len(patterns))
+	for i, p := range patterns {
+		rules[i] = regexp.MustCompile("(?i)" + p)
+	}
+	return rules
+}
+
+var defaultTitles = compileTitleRules(defaultTitleRules)
+
+// maxTitlePasses bounds how often the rules are reapplied, for boilerplate
+// one rule only uncovers once another has run
+const maxTitlePasses = 3
+
+// clean removes what the rules match from a scraped title, collapses
+// whitespace and trims leftover separators. The result is empty if nothing
+// but boilerplate was left; scrapers drop such listings.
+func (rules titleRules) clean(raw string) string {
+	title := strings.Join(strings.Fields(raw), " ")
+	for pass := 0; pass < maxTitlePasses; pass++ {
+		before := title
+		for _, rule := range rules {
+			title = strings.TrimSpace(rule.ReplaceAllString(title, " "))
+		}
+		if title == before {
+			break
+		}
+	}
+	return strings.Trim(strings.Join(strings.Fields(title), " "), " :|,–—-")
+}
+
+// cleanTitle strips boilerplate from a scraped title with the default rules
+func cleanTitle(raw string) string {
+	return defaultTitles.clean(raw)
+}
+
+// CleanListingTitle is a processor for the scraper engine applying the
+// default title rules to every scraped listing, whichever scraper produced
+// it; scrapers have already applied their source's own. A listing left
+// without a title is dropped.
+func CleanListingTitle(ctx context.Context, listing *domain.Listing) (bool, error) {
+	listing.Title = cleanTitle(listing.Title)
+	return listing.Title != "", nil
+}
@@ -0,0 +1,77 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/kbsch/trough/internal/domain"
+)
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"Profitable Pizza Restaurant", "Profitable Pizza Restaurant"},
+		{"  Profitable   Pizza\n\tRestaurant  ", "Profitable Pizza Restaurant"},
+		{"For Sale: Profitable Pizza Restaurant", "Profitable Pizza Restaurant"},
+		{"Business for Sale - Established HVAC Company", "Established HVAC Company"},
+		{"BUSINESS FOR SALE | Turnkey Car Wash", "Turnkey Car Wash"},
+		{"Price Reduced! Turnkey Car Wash", "Turnkey Car Wash"},
+		{"New Listing: Dog Grooming Salon", "Dog Grooming Salon"},
+		{"Confidential - Commercial Cleaning Company", "Commercial Cleaning Company"},
+		{"Confidential Listing: Commercial Cleaning Company", "Commercial Cleaning Company"},
+		{"Commercial Cleaning Company (Confidential)", "Commercial Cleaning Company"},
+		{"Commercial Cleaning Company - Confidential", "Commercial Cleaning Company"},
+		{"Profitable Pizza Restaurant - Dallas, TX", "Profitable Pizza Restaurant"},
+		{"Profitable Pizza Restaurant in Fort Worth, TX 76102", "Profitable Pizza Restaurant"},
+		{"Profitable Pizza Restaurant (St. Louis, MO)", "Profitable Pizza Restaurant"},
+		{"Coffee Shop, Austin, TX", "Coffee Shop"},
+		{"Liquor Store for Sale", "Liquor Store"},
+		{"For Sale: Confidential - Bakery & Cafe - Portland, OR", "Bakery & Cafe"},
+		// Only a trailing city and state is a location
+		{"Bed-and-Breakfast - Asheville, NC", "Bed-and-Breakfast"},
+		{"Pizza, Wings and Subs", "Pizza, Wings and Subs"},
+		{"Landscaping Company in Business 20 Years", "Landscaping Company in Business 20 Years"},
+		{"Sale - Leaseback Opportunity", "Sale - Leaseback Opportunity"},
+		{"Confidentiality Agreement Services Firm", "Confidentiality Agreement Services Firm"},
+		// Nothing but boilerplate
+		{"Confidential", ""},
+		{"Business For Sale", ""},
+		{"For Sale: Confidential", ""},
+	}
+	for _, tt := range tests {
+		if got := cleanTitle(tt.raw); got != tt.want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestSiteTitleRules(t *testing.T) {
+	site := newSite("https://example.com", "/", nil).forRun(domain.ScrapeOptions{
+		SourceConfig: json.RawMessage(`{"title_rules":["\\s+-\\s+sunbelt business brokers$"]}`),
+	})
+
+	// The source's rules run after the defaults
+	got := site.cleanTitle("For Sale: Marina - Sunbelt Business Brokers")
+	if got != "Marina" {
+		t.Errorf("cleanTitle = %q, want %q", got, "Marina")
+	}
+	if got := cleanTitle("Marina - Sunbelt Business Brokers"); got != "Marina - Sunbelt Business Brokers" {
+		t.Errorf("default rules applied a source's rule: %q", got)
+	}
+}
+
+func TestCleanListingTitle(t *testing.T) {
+	listing := &domain.Listing{Title: "  Price Reduced - Corner Cafe  "}
+	if keep, err := CleanListingTitle(context.Background(), listing); !keep || err != nil {
+		t.Fatalf("CleanListingTitle = %v, %v; want kept", keep, err)
+	}
+	if listing.Title != "Corner Cafe" {
+		t.Errorf("title = %q, want %q", listing.Title, "Corner Cafe")
+	}
+
+	if keep, _ := CleanListingTitle(context.Background(), &domain.Listing{Title: "Business For Sale"}); keep {
+		t.Error("listing with only boilerplate for a title was kept")
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"regexp"
 	"strings"
 	"time"
@@ -17,16 +17,37 @@ import (
 
 // TransworldScraper scrapes listings from Transworld Business Advisors
 // A large national franchise business brokerage network
-type TransworldScraper struct{}
+// Listing card selectors, reported to ScrapeOptions.MatchCard
+const (
+	transworldCardSelector    = ".listing-card, .business-listing, .listing-row, .listing-item, article.business"
+	transworldAltCardSelector = ".business-card, div[data-business-id]"
+)
+
+type TransworldScraper struct {
+	logger *slog.Logger
+	site   siteConfig
+}
 
-func NewTransworldScraper() *TransworldScraper {
-	return &TransworldScraper{}
+func NewTransworldScraper(logger *slog.Logger, opts ...Option) *TransworldScraper {
+	return &TransworldScraper{
+		logger: scraperLogger(logger, "transworld"),
+		site:   newSite("https://www.tworld.com", "/businesses-for-sale/", opts),
+	}
 }
 
 func (s *TransworldScraper) Name() string {
 	return "transworld"
 }
 
+func (s *TransworldScraper) Version() int {
+	return transworldVersion
+}
+
+// CardSelectors returns the selector groups that find listing cards
+func (s *TransworldScraper) CardSelectors() []string {
+	return []string{transworldCardSelector, transworldAltCardSelector}
+}
+
 func (s *TransworldScraper) Scrape(ctx context.Context, opts domain.ScrapeOptions) (<-chan *domain.Listing, <-chan error) {
 	listings := make(chan *domain.Listing, 100)
 	errors := make(chan error, 10)
@@ -35,14 +56,15 @@ func (s *TransworldScraper) Scrape(ctx context.Context, opts domain.ScrapeOption
 		defer close(listings)
 		defer close(errors)
 
+		site := s.site.forRun(opts)
+
 		c := colly.NewCollector(
-			colly.AllowedDomains("www.tworld.com", "tworld.com"),
-			colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"),
+			colly.AllowedDomains(site.allowedDomains()...),
 			colly.MaxDepth(2),
 		)
 
 		c.Limit(&colly.LimitRule{
-			DomainGlob:  "*tworld.com*",
+			DomainGlob:  site.domainGlob(),
 			Delay:       opts.RateLimit,
 			RandomDelay: 1 * time.Second,
 			Parallelism: 1,
@@ -50,24 +72,22 @@ func (s *TransworldScraper) Scrape(ctx context.Context, opts domain.ScrapeOption
 
 		count := 0
 		pageCount := 0
-		maxPages := 50
-		if opts.MaxListings > 0 {
-			maxPages = (opts.MaxListings / 20) + 1
-		}
+		maxPages := maxFollowedPages(opts)
 
 		// Parse listing cards from search results
-		c.OnHTML(".listing-card, .business-listing, .listing-row, .listing-item, article.business", func(e *colly.HTMLElement) {
+		c.OnHTML(transworldCardSelector, func(e *colly.HTMLElement) {
+			opts.MatchedCard(transworldCardSelector)
 			if opts.MaxListings > 0 && count >= opts.MaxListings {
 				return
 			}
 
-			listing := s.parseListingCard(e)
-			if listing != nil {
+			listing := s.parseListingCard(e, site)
+			if listing != nil && !site.skips(listing.URL) {
 				select {
 				case listings <- listing:
 					count++
 					if count%10 == 0 {
-						log.Printf("Transworld: scraped %d listings", count)
+						s.logger.Debug("scraped listings", "count", count)
 					}
 				case <-ctx.Done():
 					return
@@ -76,13 +96,29 @@ func (s *TransworldScraper) Scrape(ctx context.Context, opts domain.ScrapeOption
 		})
 
 		// Alternative selector for card-based layouts
-		c.OnHTML(".business-card, div[data-business-id]", func(e *colly.HTMLElement) {
+		c.OnHTML(transworldAltCardSelector, func(e *colly.HTMLElement) {
+			opts.MatchedCard(transworldAltCardSelector)
 			if opts.MaxListings > 0 && count >= opts.MaxListings {
 				return
 			}
 
-			listing := s.parseBusinessCard(e)
-			if listing != nil {
+			listing := s.parseBusinessCard(e, site)
+			if listing != nil && !site.skips(listing.URL) {
+				select {
+				case listings <- listing:
+					count++
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+
+		// Structured data, for pages the card selectors miss
+		c.OnHTML("html", func(e *colly.HTMLElement) {
+			for _, listing := range parseJSONLD(pageJSONLD(e, s.CardSelectors()), site, extractTransworldID) {
+				if opts.MaxListings > 0 && count >= opts.MaxListings {
+					return
+				}
 				select {
 				case listings <- listing:
 					count++
@@ -103,43 +139,52 @@ func (s *TransworldScraper) Scrape(ctx context.Context, opts domain.ScrapeOption
 
 			nextURL := e.Attr("href")
 			if nextURL != "" && !strings.HasPrefix(nextURL, "javascript:") && !strings.Contains(e.Attr("class"), "disabled") {
-				if !strings.HasPrefix(nextURL, "http") {
-					nextURL = "https://www.tworld.com" + nextURL
+				nextURL = site.absURL(nextURL)
+				if site.skips(nextURL) {
+					return
 				}
 				pageCount++
-				log.Printf("Transworld: following page %d: %s", pageCount, nextURL)
+				s.logger.Debug("following page", "page", pageCount, "url", nextURL)
 				e.Request.Visit(nextURL)
 			}
 		})
 
+		c.OnResponse(func(r *colly.Response) {
+			err := blockedPageError(s.Name(), r, site)
+			opts.Record(r.Request.URL.String(), r.StatusCode, err)
+			if err != nil {
+				select {
+				case errors <- err:
+				default:
+				}
+			}
+		})
+
 		c.OnError(func(r *colly.Response, err error) {
+			opts.Record(r.Request.URL.String(), r.StatusCode, err)
 			select {
-			case errors <- fmt.Errorf("request error %d: %s - %v", r.StatusCode, r.Request.URL, err):
+			case errors <- requestError(s.Name(), r, err):
 			default:
 			}
 		})
 
-		c.OnRequest(func(r *colly.Request) {
-			r.Headers.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-			r.Headers.Set("Accept-Language", "en-US,en;q=0.5")
-			r.Headers.Set("Connection", "keep-alive")
-		})
+		c.OnRequest(site.onRequest(ctx, opts))
 
-		startURL := "https://www.tworld.com/businesses-for-sale/"
-		log.Printf("Transworld: starting scrape from %s", startURL)
+		startURL := site.startURL()
+		s.logger.Info("starting scrape", "url", startURL)
 
 		if err := c.Visit(startURL); err != nil {
 			errors <- fmt.Errorf("failed to start scrape: %w", err)
 		}
 
 		c.Wait()
-		log.Printf("Transworld: scrape completed with %d listings", count)
+		s.logger.Info("scrape completed", "listings", count)
 	}()
 
 	return listings, errors
 }
 
-func (s *TransworldScraper) parseListingCard(e *colly.HTMLElement) *domain.Listing {
+func (s *TransworldScraper) parseListingCard(e *colly.HTMLElement, site siteConfig) *domain.Listing {
 	// Try multiple selectors for URL
 	url := e.ChildAttr("a.listing-title", "href")
 	if url == "" {
@@ -183,12 +228,14 @@ func (s *TransworldScraper) parseListingCard(e *colly.HTMLElement) *domain.Listi
 	if title == "" {
 		return nil
 	}
-
-	fullURL := url
-	if !strings.HasPrefix(url, "http") {
-		fullURL = "https://www.tworld.com" + url
+	// Boilerplate is stripped from the title; the raw one is kept in raw_data
+	rawTitle := title
+	if title = site.cleanTitle(title); title == "" {
+		return nil
 	}
 
+	fullURL := site.absURL(url)
+
 	listing := &domain.Listing{
 		ID:         uuid.New(),
 		ExternalID: externalID,
@@ -196,7 +243,9 @@ func (s *TransworldScraper) parseListingCard(e *colly.HTMLElement) *domain.Listi
 		Title:      title,
 		Country:    domain.StrPtr("US"),
 		IsActive:   true,
+		IsFeatured: isFeaturedCard(e.Attr("class")),
 	}
+	texts := make(priceTexts)
 
 	// Parse description
 	desc := strings.TrimSpace(e.ChildText(".listing-description, .description, p.summary, .business-description"))
@@ -206,21 +255,21 @@ func (s *TransworldScraper) parseListingCard(e *colly.HTMLElement) *domain.Listi
 
 	// Parse asking price
 	priceText := e.ChildText(".asking-price, .price, .listing-price")
-	if price := parsePrice(priceText); price > 0 {
-		listing.AskingPrice = &price
-	}
+	texts.setAskingPrice(listing, priceText)
 
 	// Parse cash flow
 	cashFlowText := e.ChildText(".cash-flow, .cashflow, .sde, .net-income")
-	if cf := parsePrice(cashFlowText); cf > 0 {
-		listing.CashFlow = &cf
-	}
+	texts.setPriceRange(finCashFlow, cashFlowText, &listing.CashFlow, &listing.CashFlowMax)
 
 	// Parse revenue
 	revenueText := e.ChildText(".revenue, .gross-revenue, .gross-sales, .annual-revenue")
-	if rev := parsePrice(revenueText); rev > 0 {
-		listing.Revenue = &rev
-	}
+	texts.setPriceRange(finRevenue, revenueText, &listing.Revenue, &listing.RevenueMax)
+
+	// EBITDA, FF&E and figures the selectors missed, and the founding year
+	// and head count, found by their labels
+	cardText := pageText(e.DOM)
+	texts.merge(applyLabeledFinancials(listing, cardText))
+	applyBusinessDetails(listing, cardText)
 
 	// Parse location
 	location := strings.TrimSpace(e.ChildText(".location, .city-state, .listing-location, .business-location"))
@@ -253,8 +302,10 @@ func (s *TransworldScraper) parseListingCard(e *colly.HTMLElement) *domain.Listi
 
 	rawData := map[string]interface{}{
 		"source_url": url,
+		"title":      rawTitle,
 		"scraped_at": time.Now().Format(time.RFC3339),
 	}
+	texts.addTo(rawData)
 	if jsonBytes, err := json.Marshal(rawData); err == nil {
 		listing.RawData = jsonBytes
 	}
@@ -262,7 +313,7 @@ func (s *TransworldScraper) parseListingCard(e *colly.HTMLElement) *domain.Listi
 	return listing
 }
 
-func (s *TransworldScraper) parseBusinessCard(e *colly.HTMLElement) *domain.Listing {
+func (s *TransworldScraper) parseBusinessCard(e *colly.HTMLElement, site siteConfig) *domain.Listing {
 	listingID := e.Attr("data-business-id")
 	if listingID == "" {
 		listingID = e.Attr("data-listing-id")
@@ -283,12 +334,14 @@ func (s *TransworldScraper) parseBusinessCard(e *colly.HTMLElement) *domain.List
 	if title == "" {
 		return nil
 	}
-
-	fullURL := url
-	if !strings.HasPrefix(url, "http") {
-		fullURL = "https://www.tworld.com" + url
+	// Boilerplate is stripped from the title; the raw one is kept in raw_data
+	rawTitle := title
+	if title = site.cleanTitle(title); title == "" {
+		return nil
 	}
 
+	fullURL := site.absURL(url)
+
 	listing := &domain.Listing{
 		ID:         uuid.New(),
 		ExternalID: "tw-" + listingID,
@@ -296,13 +349,13 @@ func (s *TransworldScraper) parseBusinessCard(e *colly.HTMLElement) *domain.List
 		Title:      title,
 		Country:    domain.StrPtr("US"),
 		IsActive:   true,
+		IsFeatured: isFeaturedCard(e.Attr("class")),
 	}
+	texts := make(priceTexts)
 
 	// Parse data attributes
 	if price := e.Attr("data-price"); price != "" {
-		if p := parsePrice(price); p > 0 {
-			listing.AskingPrice = &p
-		}
+		texts.setAskingPrice(listing, price)
 	}
 
 	if loc := e.Attr("data-location"); loc != "" {
@@ -319,6 +372,17 @@ func (s *TransworldScraper) parseBusinessCard(e *colly.HTMLElement) *domain.List
 		listing.Industry = &industry
 	}
 
+	// Store raw data
+	rawData := map[string]interface{}{
+		"source_url": url,
+		"title":      rawTitle,
+		"scraped_at": time.Now().Format(time.RFC3339),
+	}
+	texts.addTo(rawData)
+	if jsonBytes, err := json.Marshal(rawData); err == nil {
+		listing.RawData = jsonBytes
+	}
+
 	return listing
 }
 
@@ -0,0 +1,17 @@
+package sources
+
+// Scraper versions number each scraper's parsing. Bump one when a change to
+// its parsing fills in or corrects fields: listings record the version that
+// parsed them as parsed_by_version, and `trough rescrape-outdated` re-fetches
+// the detail pages of those parsed by an older one. The colly and rod
+// scrapers of a site share its version.
+const (
+	apiVersion            = 1
+	bizBuySellVersion     = 1
+	bizQuestVersion       = 1
+	businessBrokerVersion = 1
+	firstChoiceVersion    = 1
+	sitemapVersion        = 1
+	sunbeltVersion        = 1
+	transworldVersion     = 1
+)
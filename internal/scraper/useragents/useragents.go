@@ -0,0 +1,97 @@
+package useragents
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultUserAgents is a set of current desktop browser user agents
+var DefaultUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36 Edg/131.0.0.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:133.0) Gecko/20100101 Firefox/133.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Safari/605.1.15",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+}
+
+// Profile is a user agent with the headers a real browser would send alongside it
+type Profile struct {
+	UserAgent      string
+	AcceptLanguage string
+	Platform       string // navigator.platform value
+}
+
+// Pool hands out user agent profiles in round-robin order
+type Pool struct {
+	profiles []Profile
+	next     atomic.Uint64
+}
+
+// NewPool creates a pool from the given user agents, falling back to the defaults if empty
+func NewPool(userAgents []string) *Pool {
+	var profiles []Profile
+	for _, ua := range userAgents {
+		if ua = strings.TrimSpace(ua); ua != "" {
+			profiles = append(profiles, newProfile(ua))
+		}
+	}
+	if len(profiles) == 0 {
+		for _, ua := range DefaultUserAgents {
+			profiles = append(profiles, newProfile(ua))
+		}
+	}
+	return &Pool{profiles: profiles}
+}
+
+// Next returns the next profile in the rotation
+func (p *Pool) Next() Profile {
+	i := p.next.Add(1) - 1
+	return p.profiles[i%uint64(len(p.profiles))]
+}
+
+// Len returns the number of profiles in the pool
+func (p *Pool) Len() int {
+	return len(p.profiles)
+}
+
+// defaultPool is the process-wide pool used by Next
+var defaultPool atomic.Pointer[Pool]
+
+func init() {
+	defaultPool.Store(NewPool(nil))
+}
+
+// SetDefault replaces the process-wide pool used by Next, e.g. with the user
+// agents from SCRAPE_USER_AGENTS
+func SetDefault(p *Pool) {
+	defaultPool.Store(p)
+}
+
+// Next returns the next profile from the process-wide pool
+func Next() Profile {
+	return defaultPool.Load().Next()
+}
+
+// newProfile derives Accept-Language and platform values matching the user agent
+func newProfile(ua string) Profile {
+	profile := Profile{
+		UserAgent:      ua,
+		AcceptLanguage: "en-US,en;q=0.9",
+		Platform:       "Win32",
+	}
+
+	// Firefox sends a lower q-value for the fallback language
+	if strings.Contains(ua, "Firefox/") {
+		profile.AcceptLanguage = "en-US,en;q=0.5"
+	}
+
+	switch {
+	case strings.Contains(ua, "Macintosh"):
+		profile.Platform = "MacIntel"
+	case strings.Contains(ua, "Linux"):
+		profile.Platform = "Linux x86_64"
+	}
+
+	return profile
+}
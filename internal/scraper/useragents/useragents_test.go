@@ -0,0 +1,45 @@
+package useragents
+
+import "testing"
+
+func TestPoolCycles(t *testing.T) {
+	uas := []string{"agent-a", "agent-b", "agent-c"}
+	pool := NewPool(uas)
+
+	for round := 0; round < 2; round++ {
+		for i, want := range uas {
+			if got := pool.Next().UserAgent; got != want {
+				t.Errorf("round %d call %d = %q, want %q", round, i, got, want)
+			}
+		}
+	}
+}
+
+func TestPoolDefaults(t *testing.T) {
+	pool := NewPool(nil)
+	if pool.Len() != len(DefaultUserAgents) {
+		t.Fatalf("len = %d, want %d", pool.Len(), len(DefaultUserAgents))
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < pool.Len(); i++ {
+		seen[pool.Next().UserAgent] = true
+	}
+	if len(seen) != len(DefaultUserAgents) {
+		t.Errorf("got %d distinct user agents, want %d", len(seen), len(DefaultUserAgents))
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	SetDefault(NewPool([]string{"Mozilla/5.0 (Macintosh; rv:133.0) Firefox/133.0", " Mozilla/5.0 (X11; Linux x86_64) Chrome/131.0"}))
+	t.Cleanup(func() { SetDefault(NewPool(nil)) })
+
+	first := Next()
+	if first.Platform != "MacIntel" || first.AcceptLanguage != "en-US,en;q=0.5" {
+		t.Errorf("unexpected firefox profile: %+v", first)
+	}
+	second := Next()
+	if second.Platform != "Linux x86_64" || second.AcceptLanguage != "en-US,en;q=0.9" {
+		t.Errorf("unexpected chrome profile: %+v", second)
+	}
+}
@@ -0,0 +1,138 @@
+// Package taxonomy normalizes how listings are classified across sources.
+package taxonomy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Tag is a normalized listing tag and the phrases in a title or description
+// that earn it
+type Tag struct {
+	Name    string
+	Phrases []string
+}
+
+// Tag names
+const (
+	TagHomeBased           = "home-based"
+	TagAbsenteeOwner       = "absentee-owner"
+	TagSemiAbsentee        = "semi-absentee"
+	TagSBAPrequalified     = "sba-prequalified"
+	TagSellerFinancing     = "seller-financing"
+	TagECommerce           = "e-commerce"
+	TagTurnkey             = "turnkey"
+	TagRelocatable         = "relocatable"
+	TagRecurringRevenue    = "recurring-revenue"
+	TagGovernmentContracts = "government-contracts"
+)
+
+// Dictionary is the tags extracted from listings. Phrases match whole words,
+// ignoring case and punctuation, so "home-based" also matches "Home Based".
+var Dictionary = []Tag{
+	{TagHomeBased, []string{"home based", "home-based business", "run from home", "work from home", "operate from home", "from your home"}},
+	{TagAbsenteeOwner, []string{"absentee", "absentee owner", "absentee owned", "absentee run", "owner absentee"}},
+	// Longer than "absentee", so semi-absentee listings aren't also tagged absentee-owner
+	{TagSemiAbsentee, []string{"semi absentee", "semiabsentee", "semi absentee owner", "semi absentee run"}},
+	{TagSBAPrequalified, []string{"sba pre qualified", "sba prequalified", "sba pre approved", "sba preapproved", "pre qualified for sba", "prequalified for sba"}},
+	{TagSellerFinancing, []string{"seller financing", "owner financing", "seller finance", "seller will finance", "seller will carry", "owner will carry", "seller carry"}},
+	{TagECommerce, []string{"e commerce", "ecommerce", "online store", "amazon fba", "shopify store"}},
+	{TagTurnkey, []string{"turnkey", "turn key"}},
+	{TagRelocatable, []string{"relocatable", "can be relocated", "easily relocated"}},
+	{TagRecurringRevenue, []string{"recurring revenue", "subscription revenue", "recurring income"}},
+	{TagGovernmentContracts, []string{"government contracts", "government contract", "government contractor"}},
+}
+
+// Tagger extracts tags from text with a dictionary
+type Tagger struct {
+	// phrases by their first word, longest first
+	phrases map[string][]phrase
+}
+
+type phrase struct {
+	words []string
+	tag   string
+}
+
+// NewTagger builds a tagger for the tags in dict
+func NewTagger(dict []Tag) *Tagger {
+	t := &Tagger{phrases: make(map[string][]phrase)}
+	for _, tag := range dict {
+		for _, p := range tag.Phrases {
+			words := words(p)
+			if len(words) == 0 {
+				continue
+			}
+			t.phrases[words[0]] = append(t.phrases[words[0]], phrase{words: words, tag: tag.Name})
+		}
+	}
+	for _, ps := range t.phrases {
+		sort.SliceStable(ps, func(i, j int) bool { return len(ps[i].words) > len(ps[j].words) })
+	}
+	return t
+}
+
+// Tags returns the sorted tags the texts earn. At each word the longest
+// matching phrase wins and the words it covers aren't matched again, so
+// overlapping phrases tag a listing once: "semi-absentee owner" is
+// semi-absentee, not also absentee-owner.
+func (t *Tagger) Tags(texts ...string) []string {
+	found := make(map[string]bool)
+	for _, text := range texts {
+		w := words(text)
+		for i := 0; i < len(w); {
+			p, ok := t.match(w[i:])
+			if !ok {
+				i++
+				continue
+			}
+			found[p.tag] = true
+			i += len(p.words)
+		}
+	}
+
+	tags := make([]string, 0, len(found))
+	for tag := range found {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// match returns the longest phrase w starts with
+func (t *Tagger) match(w []string) (phrase, bool) {
+	for _, p := range t.phrases[w[0]] {
+		if len(p.words) <= len(w) && equalWords(p.words, w[:len(p.words)]) {
+			return p, true
+		}
+	}
+	return phrase{}, false
+}
+
+func equalWords(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// words splits text into lowercase words, treating anything but letters and
+// digits as a separator
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+var defaultTagger = NewTagger(Dictionary)
+
+// ListingTags returns the Dictionary tags a listing's title and description earn
+func ListingTags(title string, description *string) []string {
+	if description == nil {
+		return defaultTagger.Tags(title)
+	}
+	return defaultTagger.Tags(title, *description)
+}
@@ -0,0 +1,63 @@
+package taxonomy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListingTags(t *testing.T) {
+	tests := []struct {
+		title, description string
+		want               []string
+	}{
+		{"Home-Based Bookkeeping Practice", "", []string{TagHomeBased}},
+		{"Bookkeeping Practice", "Run from home with a laptop.", []string{TagHomeBased}},
+		{"Laundromat", "Fully ABSENTEE owner, managed by staff.", []string{TagAbsenteeOwner}},
+		{"Car Wash", "Semi-absentee opportunity", []string{TagSemiAbsentee}},
+		{"Dental Lab", "SBA pre-qualified. Seller financing available.", []string{TagSBAPrequalified, TagSellerFinancing}},
+		{"Dental Lab", "Prequalified for SBA lending", []string{TagSBAPrequalified}},
+		{"E-Commerce Pet Supplies", "Shopify store with recurring revenue", []string{TagECommerce, TagRecurringRevenue}},
+		{"Ecommerce Brand", "", []string{TagECommerce}},
+		{"Turn-key Cafe", "", []string{TagTurnkey}},
+		{"Janitorial Company", "Government contracts in place; easily relocated.", []string{TagGovernmentContracts, TagRelocatable}},
+		{"Pizza Restaurant", "Great location downtown", []string{}},
+		// Phrases match whole words only
+		{"Homebased", "The seller finances nothing; e-commerceplatform", []string{}},
+	}
+	for _, tt := range tests {
+		desc := &tt.description
+		if got := ListingTags(tt.title, desc); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListingTags(%q, %q) = %v, want %v", tt.title, tt.description, got, tt.want)
+		}
+	}
+
+	if got := ListingTags("Turnkey Salon", nil); !reflect.DeepEqual(got, []string{TagTurnkey}) {
+		t.Errorf("ListingTags without a description = %v, want [%s]", got, TagTurnkey)
+	}
+}
+
+func TestTaggerOverlappingPhrases(t *testing.T) {
+	tagger := NewTagger([]Tag{
+		{"absentee", []string{"absentee", "absentee owner"}},
+		{"semi-absentee", []string{"semi absentee", "semi absentee owner"}},
+		{"owner-operator", []string{"owner operator"}},
+	})
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		// The longest phrase at a word wins, and its words aren't matched again
+		{"Semi-absentee owner", []string{"semi-absentee"}},
+		{"semi absentee owner operator", []string{"semi-absentee"}},
+		{"absentee owner operator", []string{"absentee"}},
+		// Separate mentions each count, once per tag
+		{"Absentee owner. Absentee run. Semi-absentee possible.", []string{"absentee", "semi-absentee"}},
+		{"Owner operator, not absentee", []string{"absentee", "owner-operator"}},
+	}
+	for _, tt := range tests {
+		if got := tagger.Tags(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tags(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
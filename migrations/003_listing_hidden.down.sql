@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_listings_hidden;
+ALTER TABLE listings DROP COLUMN IF EXISTS hidden;
@@ -0,0 +1,5 @@
+-- Manually hidden listings (spam, miscategorized). Independent of is_active,
+-- which tracks scrape state, so re-scrapes never un-hide a listing.
+ALTER TABLE listings ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX idx_listings_hidden ON listings(hidden) WHERE hidden = true;
@@ -0,0 +1,8 @@
+-- Fixed-window rate limit buckets shared by all API replicas
+CREATE TABLE rate_limits (
+    key TEXT PRIMARY KEY,
+    window_start TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_rate_limits_window_start ON rate_limits(window_start);
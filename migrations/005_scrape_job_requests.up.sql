@@ -0,0 +1,11 @@
+-- Pages fetched by each scrape job, for debugging blocks and coverage
+CREATE TABLE scrape_job_requests (
+    id BIGSERIAL PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES scrape_jobs(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_scrape_job_requests_job ON scrape_job_requests(job_id, fetched_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_listings_needs_enrichment;
+
+ALTER TABLE listings DROP COLUMN IF EXISTS enriched_at;
+ALTER TABLE listings DROP COLUMN IF EXISTS broker_phone;
+ALTER TABLE listings DROP COLUMN IF EXISTS broker_name;
@@ -0,0 +1,8 @@
+-- Fields filled in by the detail-page enrichment job. Cards rarely carry
+-- broker contact details, so these are never written by the crawl.
+ALTER TABLE listings ADD COLUMN broker_name TEXT;
+ALTER TABLE listings ADD COLUMN broker_phone TEXT;
+ALTER TABLE listings ADD COLUMN enriched_at TIMESTAMPTZ;
+
+CREATE INDEX idx_listings_needs_enrichment ON listings(last_seen_at)
+    WHERE is_active = true AND enriched_at IS NULL;
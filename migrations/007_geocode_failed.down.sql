@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_listings_needs_geocode;
+
+ALTER TABLE listings DROP COLUMN IF EXISTS geocode_failed_at;
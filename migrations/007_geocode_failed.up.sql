@@ -0,0 +1,6 @@
+-- Set when every geocoder failed to resolve a listing's city/state, so the
+-- backfill job skips it until the marker ages out.
+ALTER TABLE listings ADD COLUMN geocode_failed_at TIMESTAMPTZ;
+
+CREATE INDEX idx_listings_needs_geocode ON listings(last_seen_at)
+    WHERE is_active = true AND lat IS NULL AND state IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE scrape_jobs DROP COLUMN IF EXISTS fallback_used;
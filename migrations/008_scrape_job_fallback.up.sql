@@ -0,0 +1,2 @@
+-- Set when a run was blocked and finished with the source's fallback (rod) scraper
+ALTER TABLE scrape_jobs ADD COLUMN fallback_used BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,19 @@
+-- Additional locations for multi-unit and multi-state listings. The primary
+-- location stays denormalized on listings for search; listings with a single
+-- location have no rows here.
+CREATE TABLE listing_locations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    listing_id UUID NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    city TEXT,
+    state TEXT,
+    zip_code TEXT,
+    lat DOUBLE PRECISION,
+    lng DOUBLE PRECISION,
+    is_primary BOOLEAN NOT NULL DEFAULT false,
+    geocode_failed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_listing_locations_listing ON listing_locations(listing_id);
+CREATE INDEX idx_listing_locations_needs_geocode ON listing_locations(created_at)
+    WHERE lat IS NULL AND state IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_listings_featured_last_seen;
+ALTER TABLE listings DROP COLUMN IF EXISTS is_featured;
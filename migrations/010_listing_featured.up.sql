@@ -0,0 +1,6 @@
+-- Featured/promoted placement on the source site (e.g. BizBuySell diamond
+-- listings). Refreshed on every scrape since sellers buy it for a period.
+ALTER TABLE listings ADD COLUMN is_featured BOOLEAN NOT NULL DEFAULT false;
+
+-- Default sort boosts featured listings ahead of last_seen_at
+CREATE INDEX idx_listings_featured_last_seen ON listings(is_featured DESC, last_seen_at DESC) WHERE is_active = true;
@@ -0,0 +1,7 @@
+-- Requests made to each source per UTC day, capped by max_requests_per_day in its config
+CREATE TABLE scrape_budget (
+    source_id UUID NOT NULL REFERENCES sources(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    requests INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (source_id, day)
+);
@@ -0,0 +1,3 @@
+-- <lastmod> of the listing's sitemap entry when it was last fetched, so incremental
+-- sitemap runs only re-fetch listings the source has changed since
+ALTER TABLE listings ADD COLUMN sitemap_lastmod TIMESTAMPTZ;
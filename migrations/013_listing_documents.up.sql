@@ -0,0 +1,11 @@
+-- Downloadable documents (CIMs, financial summaries) linked from listing detail
+-- pages. Only the link is stored, not the file.
+CREATE TABLE listing_documents (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    listing_id UUID NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    url TEXT NOT NULL,
+    title TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (listing_id, url)
+);
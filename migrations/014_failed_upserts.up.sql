@@ -0,0 +1,13 @@
+-- Scraped listings the database rejected, kept with the error so they can be
+-- replayed with `trough replay-failed` once the cause is fixed. Scrapes stop
+-- retrying a listing after a few attempts.
+CREATE TABLE failed_upserts (
+    source_id UUID NOT NULL REFERENCES sources(id) ON DELETE CASCADE,
+    external_id TEXT NOT NULL,
+    listing JSONB NOT NULL,
+    error TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 1,
+    first_failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (source_id, external_id)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_listings_price_high;
+ALTER TABLE listings DROP COLUMN IF EXISTS cash_flow_max;
+ALTER TABLE listings DROP COLUMN IF EXISTS revenue_max;
+ALTER TABLE listings DROP COLUMN IF EXISTS asking_price_max;
@@ -0,0 +1,8 @@
+-- High ends of asking price, revenue and cash flow given as a range; the low
+-- end stays in the existing column
+ALTER TABLE listings ADD COLUMN asking_price_max BIGINT;
+ALTER TABLE listings ADD COLUMN revenue_max BIGINT;
+ALTER TABLE listings ADD COLUMN cash_flow_max BIGINT;
+
+-- price_min matches a listing whose range reaches the minimum
+CREATE INDEX idx_listings_price_high ON listings ((COALESCE(asking_price_max, asking_price))) WHERE is_active = true;
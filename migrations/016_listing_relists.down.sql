@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_listings_relisted_at;
+ALTER TABLE listings DROP COLUMN IF EXISTS relist_count;
+ALTER TABLE listings DROP COLUMN IF EXISTS relisted_at;
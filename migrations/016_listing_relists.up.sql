@@ -0,0 +1,6 @@
+-- When a listing marked inactive by MarkStale was last seen again, and how
+-- many times that has happened
+ALTER TABLE listings ADD COLUMN relisted_at TIMESTAMPTZ;
+ALTER TABLE listings ADD COLUMN relist_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_listings_relisted_at ON listings (relisted_at DESC) WHERE relisted_at IS NOT NULL AND is_active = true;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_scrape_jobs_trigger;
+ALTER TABLE scrape_jobs DROP COLUMN IF EXISTS trigger;
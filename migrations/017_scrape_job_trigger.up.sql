@@ -0,0 +1,6 @@
+-- What started a scrape run: the periodic scheduler, the API's refresh
+-- endpoint, the CLI, a River retry, or (manual) a job queued without one
+ALTER TABLE scrape_jobs ADD COLUMN trigger TEXT NOT NULL DEFAULT 'manual'
+    CHECK (trigger IN ('periodic', 'manual', 'api', 'cli', 'retry'));
+
+CREATE INDEX idx_scrape_jobs_trigger ON scrape_jobs (trigger, created_at DESC);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS listings_price_history_trigger ON listings;
+DROP FUNCTION IF EXISTS listings_record_price();
+DROP TABLE IF EXISTS listing_price_history;
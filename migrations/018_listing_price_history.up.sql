@@ -0,0 +1,32 @@
+-- Every asking price a listing has had, written by a trigger whenever a
+-- listing is inserted or its price changes
+CREATE TABLE listing_price_history (
+    id BIGSERIAL PRIMARY KEY,
+    listing_id UUID NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    asking_price BIGINT,
+    asking_price_max BIGINT,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_listing_price_history_listing ON listing_price_history (listing_id, recorded_at);
+
+CREATE OR REPLACE FUNCTION listings_record_price() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT'
+        OR NEW.asking_price IS DISTINCT FROM OLD.asking_price
+        OR NEW.asking_price_max IS DISTINCT FROM OLD.asking_price_max THEN
+        INSERT INTO listing_price_history (listing_id, asking_price, asking_price_max, recorded_at)
+        VALUES (NEW.id, NEW.asking_price, NEW.asking_price_max, NEW.last_seen_at);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER listings_price_history_trigger
+    AFTER INSERT OR UPDATE OF asking_price, asking_price_max ON listings
+    FOR EACH ROW
+    EXECUTE FUNCTION listings_record_price();
+
+-- Existing listings start from the price they were last seen at
+INSERT INTO listing_price_history (listing_id, asking_price, asking_price_max, recorded_at)
+SELECT id, asking_price, asking_price_max, last_seen_at FROM listings;
@@ -0,0 +1,2 @@
+ALTER TABLE sources DROP COLUMN IF EXISTS quarantined_until;
+ALTER TABLE sources DROP COLUMN IF EXISTS consecutive_blocks;
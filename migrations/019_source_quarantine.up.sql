@@ -0,0 +1,5 @@
+-- Sources whose scrapes keep getting blocked are quarantined: periodic and
+-- on-demand runs skip them until quarantined_until passes or an operator
+-- clears it. consecutive_blocks counts blocked runs since the last clean one.
+ALTER TABLE sources ADD COLUMN consecutive_blocks INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sources ADD COLUMN quarantined_until TIMESTAMPTZ;
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS listings_search_vector_trigger ON listings;
+CREATE TRIGGER listings_search_vector_trigger
+    BEFORE INSERT OR UPDATE ON listings
+    FOR EACH ROW
+    EXECUTE FUNCTION listings_search_vector_update();
+
+ALTER TABLE listings DROP COLUMN IF EXISTS content_hash;
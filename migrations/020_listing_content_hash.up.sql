@@ -0,0 +1,11 @@
+-- Hash of the scraped fields of a listing. An upsert whose hash matches the
+-- stored one only bumps last_seen_at instead of rewriting the row.
+ALTER TABLE listings ADD COLUMN content_hash TEXT;
+
+-- Recompute the search vector only when the text it is built from changes,
+-- not on every last_seen_at bump
+DROP TRIGGER IF EXISTS listings_search_vector_trigger ON listings;
+CREATE TRIGGER listings_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF title, description, industry, city, state ON listings
+    FOR EACH ROW
+    EXECUTE FUNCTION listings_search_vector_update();
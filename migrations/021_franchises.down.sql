@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_listings_franchise;
+ALTER TABLE listings DROP COLUMN IF EXISTS franchise_id;
+DROP TABLE IF EXISTS franchises;
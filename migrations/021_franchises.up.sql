@@ -0,0 +1,13 @@
+-- Franchise resales of the same brand, grouped across sources by their
+-- normalized franchise_name (domain.NormalizeFranchiseName). Listings are
+-- linked when upserted.
+CREATE TABLE franchises (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    slug TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE listings ADD COLUMN franchise_id UUID REFERENCES franchises(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_listings_franchise ON listings(franchise_id) WHERE franchise_id IS NOT NULL;
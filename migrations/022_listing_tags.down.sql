@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_listings_tags;
+
+ALTER TABLE listings DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,5 @@
+-- Normalized tags extracted from each listing's title and description at
+-- upsert, e.g. home-based or seller-financing
+ALTER TABLE listings ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_listings_tags ON listings USING GIN (tags);
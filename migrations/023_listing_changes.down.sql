@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS listings_changes_trigger ON listings;
+DROP FUNCTION IF EXISTS listings_record_changes();
+DROP TABLE IF EXISTS listing_changes;
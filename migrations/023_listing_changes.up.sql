@@ -0,0 +1,35 @@
+-- Field-level changes to listings, written by a trigger whenever an update
+-- changes one of the fields buyers follow. Values are stored as text.
+CREATE TABLE listing_changes (
+    id BIGSERIAL PRIMARY KEY,
+    listing_id UUID NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    field TEXT NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_listing_changes_listing ON listing_changes (listing_id, changed_at);
+
+-- One insert per updated row, of only the tracked fields that changed
+CREATE OR REPLACE FUNCTION listings_record_changes() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO listing_changes (listing_id, field, old_value, new_value, changed_at)
+    SELECT NEW.id, c.field, c.old_value, c.new_value, NOW()
+    FROM (VALUES
+        ('asking_price', OLD.asking_price::text, NEW.asking_price::text),
+        ('asking_price_max', OLD.asking_price_max::text, NEW.asking_price_max::text),
+        ('revenue', OLD.revenue::text, NEW.revenue::text),
+        ('cash_flow', OLD.cash_flow::text, NEW.cash_flow::text),
+        ('title', OLD.title, NEW.title),
+        ('is_active', OLD.is_active::text, NEW.is_active::text)
+    ) AS c(field, old_value, new_value)
+    WHERE c.old_value IS DISTINCT FROM c.new_value;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER listings_changes_trigger
+    AFTER UPDATE OF asking_price, asking_price_max, revenue, cash_flow, title, is_active ON listings
+    FOR EACH ROW
+    EXECUTE FUNCTION listings_record_changes();
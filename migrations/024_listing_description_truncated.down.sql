@@ -0,0 +1,14 @@
+CREATE OR REPLACE FUNCTION listings_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := to_tsvector('english',
+        COALESCE(NEW.title, '') || ' ' ||
+        COALESCE(NEW.description, '') || ' ' ||
+        COALESCE(NEW.industry, '') || ' ' ||
+        COALESCE(NEW.city, '') || ' ' ||
+        COALESCE(NEW.state, '')
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE listings DROP COLUMN IF EXISTS description_truncated;
@@ -0,0 +1,17 @@
+-- Set when the stored description was cut to MAX_DESCRIPTION_LENGTH; the
+-- full text is kept in raw_data->>'full_description' if it isn't too long
+ALTER TABLE listings ADD COLUMN description_truncated BOOLEAN NOT NULL DEFAULT false;
+
+-- Index the full text of a truncated description rather than its stored cut
+CREATE OR REPLACE FUNCTION listings_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := to_tsvector('english',
+        COALESCE(NEW.title, '') || ' ' ||
+        COALESCE(NEW.raw_data->>'full_description', NEW.description, '') || ' ' ||
+        COALESCE(NEW.industry, '') || ' ' ||
+        COALESCE(NEW.city, '') || ' ' ||
+        COALESCE(NEW.state, '')
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
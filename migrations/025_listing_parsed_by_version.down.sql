@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_listings_source_parsed_by_version;
+ALTER TABLE listings DROP COLUMN IF EXISTS parsed_by_version;
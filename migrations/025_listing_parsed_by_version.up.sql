@@ -0,0 +1,6 @@
+-- Version of the scraper that parsed each listing, so a parser change can be
+-- re-applied to listings parsed before it (trough rescrape-outdated). The
+-- scrapers start at version 1, which existing listings were parsed by.
+ALTER TABLE listings ADD COLUMN parsed_by_version INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX idx_listings_source_parsed_by_version ON listings (source_id, parsed_by_version) WHERE is_active = true;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_listings_financial_score;
+ALTER TABLE listings DROP COLUMN IF EXISTS financial_score;
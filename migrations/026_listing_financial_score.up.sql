@@ -0,0 +1,6 @@
+-- Financial score (0-100) computed from each listing's figures on upsert and
+-- enrichment; NULL when there are too few to rate. Existing listings are
+-- scored on their next scrape, since the score is part of the content hash.
+ALTER TABLE listings ADD COLUMN financial_score SMALLINT;
+
+CREATE INDEX idx_listings_financial_score ON listings(financial_score) WHERE is_active = true;
@@ -0,0 +1,8 @@
+-- Set when the source withholds the asking price on purpose ("Call for
+-- price", "Not disclosed"), as opposed to a price that wasn't found
+ALTER TABLE listings ADD COLUMN price_on_request BOOLEAN NOT NULL DEFAULT false;
+
+-- Listings scraped before keep the price text they were parsed from
+UPDATE listings SET price_on_request = true
+WHERE asking_price IS NULL
+    AND lower(raw_data->>'price_text') ~ '(contact|call|(on|upon|by)\s+request|disclosed)';
@@ -0,0 +1,13 @@
+-- Corrections users submit for listings ("sold", "wrong location", ...),
+-- kept for admins to review
+CREATE TABLE listing_reports (
+    id BIGSERIAL PRIMARY KEY,
+    listing_id UUID NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    note TEXT,
+    reporter_ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_listing_reports_listing ON listing_reports (listing_id, reason);
+CREATE INDEX idx_listing_reports_created ON listing_reports (created_at DESC);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS listings_updated_at_trigger ON listings;
+DROP FUNCTION IF EXISTS listings_set_updated_at();
+ALTER TABLE listings DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,17 @@
+-- When a listing row last changed in any way, hiding and deactivation
+-- included, for the detail's ETag and Last-Modified
+ALTER TABLE listings ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE listings SET updated_at = last_seen_at;
+
+CREATE OR REPLACE FUNCTION listings_set_updated_at() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER listings_updated_at_trigger
+    BEFORE UPDATE ON listings
+    FOR EACH ROW
+    EXECUTE FUNCTION listings_set_updated_at();
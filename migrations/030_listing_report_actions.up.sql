@@ -0,0 +1,8 @@
+-- Listings a report threshold has already acted on, one row per reason, so
+-- the threshold acts once however many reports arrive at the same time
+CREATE TABLE listing_report_actions (
+    listing_id UUID NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    acted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (listing_id, reason)
+);
@@ -1,5 +1,5 @@
 import { writable, derived } from 'svelte/store';
-import type { Listing, ListingSearchParams, ListingSearchResult, FilterOptions } from '$lib/types/listing';
+import type { Listing, ListingBatchResult, ListingSearchParams, ListingSearchResult, FilterOptions } from '$lib/types/listing';
 
 const API_URL = import.meta.env.PUBLIC_API_URL || 'http://localhost:8080';
 
@@ -25,10 +25,15 @@ export async function searchListings(params: ListingSearchParams): Promise<void>
 		if (params.price_max) queryParams.set('price_max', params.price_max.toString());
 		if (params.revenue_min) queryParams.set('revenue_min', params.revenue_min.toString());
 		if (params.cash_flow_min) queryParams.set('cash_flow_min', params.cash_flow_min.toString());
+		if (params.min_score) queryParams.set('min_score', params.min_score.toString());
 		if (params.states?.length) queryParams.set('state', params.states.join(','));
 		if (params.industries?.length) queryParams.set('industry', params.industries.join(','));
+		if (params.business_types?.length) queryParams.set('business_type', params.business_types.join(','));
+		if (params.categories?.length) queryParams.set('category', params.categories.join(','));
 		if (params.franchise !== undefined) queryParams.set('franchise', params.franchise.toString());
 		if (params.real_estate !== undefined) queryParams.set('real_estate', params.real_estate.toString());
+		if (params.price_on_request !== undefined) queryParams.set('price_on_request', params.price_on_request.toString());
+		if (params.featured_only !== undefined) queryParams.set('featured_only', params.featured_only.toString());
 		if (params.sort) queryParams.set('sort', params.sort);
 		if (params.page) queryParams.set('page', params.page.toString());
 		if (params.per_page) queryParams.set('per_page', params.per_page.toString());
@@ -65,6 +70,24 @@ export async function fetchListing(id: string): Promise<Listing | null> {
 	}
 }
 
+// Fetches up to 100 listings in the order given; missing or inactive IDs come back in not_found
+export async function fetchListingsByIds(ids: string[]): Promise<ListingBatchResult | null> {
+	try {
+		const response = await fetch(`${API_URL}/api/v1/listings/batch`, {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify({ ids })
+		});
+		if (!response.ok) {
+			throw new Error(`Failed to fetch listings: ${response.statusText}`);
+		}
+		return await response.json();
+	} catch (e) {
+		error.set(e instanceof Error ? e.message : 'An error occurred');
+		return null;
+	}
+}
+
 export async function fetchFilterOptions(): Promise<void> {
 	try {
 		const response = await fetch(`${API_URL}/api/v1/filters`);
@@ -5,7 +5,10 @@ export interface Listing {
 	url: string;
 	title: string;
 	description?: string;
+	description_truncated?: boolean;
+	financial_score: number | null;
 	asking_price?: number;
+	price_on_request: boolean;
 	revenue?: number;
 	cash_flow?: number;
 	ebitda?: number;
@@ -26,9 +29,33 @@ export interface Listing {
 	reason_for_sale?: string;
 	is_franchise: boolean;
 	franchise_name?: string;
+	is_featured: boolean;
+	broker_name?: string;
+	broker_phone?: string;
 	first_seen_at: string;
 	last_seen_at: string;
 	is_active: boolean;
+	enriched_at?: string;
+	source?: ListingSource;
+	/** Every location of a multi-location listing, primary first; absent for single-location listings */
+	locations?: ListingLocation[];
+}
+
+export interface ListingLocation {
+	id: string;
+	city?: string;
+	state?: string;
+	zip_code?: string;
+	lat?: number;
+	lng?: number;
+	is_primary: boolean;
+}
+
+export interface ListingSource {
+	id: string;
+	name: string;
+	slug: string;
+	base_url: string;
 }
 
 export interface ListingSearchParams {
@@ -37,10 +64,15 @@ export interface ListingSearchParams {
 	price_max?: number;
 	revenue_min?: number;
 	cash_flow_min?: number;
+	min_score?: number;
 	states?: string[];
 	industries?: string[];
+	business_types?: string[];
+	categories?: string[];
 	franchise?: boolean;
 	real_estate?: boolean;
+	price_on_request?: boolean;
+	featured_only?: boolean;
 	bounds?: GeoBounds;
 	sort?: string;
 	page?: number;
@@ -60,11 +92,19 @@ export interface ListingSearchResult {
 	page: number;
 	per_page: number;
 	total_pages: number;
+	facets?: Record<string, FilterOption[]>;
+}
+
+export interface ListingBatchResult {
+	listings: Listing[];
+	not_found: string[];
 }
 
 export interface FilterOptions {
 	industries: FilterOption[];
 	states: FilterOption[];
+	business_types: FilterOption[];
+	categories: FilterOption[];
 	price_range: PriceRange;
 }
 
@@ -86,4 +126,8 @@ export interface MapMarker {
 	title: string;
 	asking_price?: number;
 	industry?: string;
+	city?: string;
+	state?: string;
+	/** An additional location of a multi-location listing */
+	secondary?: boolean;
 }